@@ -35,20 +35,52 @@ package layers
 
 import "github.com/ghedo/go.pkt/packet"
 
+import "github.com/ghedo/go.pkt/packet/ah"
 import "github.com/ghedo/go.pkt/packet/arp"
+import "github.com/ghedo/go.pkt/packet/att"
+import "github.com/ghedo/go.pkt/packet/ble"
+import "github.com/ghedo/go.pkt/packet/cdp"
+import "github.com/ghedo/go.pkt/packet/dhcpv4"
+import "github.com/ghedo/go.pkt/packet/dhcpv6"
+import "github.com/ghedo/go.pkt/packet/dns"
+import "github.com/ghedo/go.pkt/packet/eapol"
+import "github.com/ghedo/go.pkt/packet/erspan"
+import "github.com/ghedo/go.pkt/packet/esp"
 import "github.com/ghedo/go.pkt/packet/eth"
+import "github.com/ghedo/go.pkt/packet/geneve"
+import "github.com/ghedo/go.pkt/packet/gre"
+import "github.com/ghedo/go.pkt/packet/hci"
 import "github.com/ghedo/go.pkt/packet/icmpv4"
 import "github.com/ghedo/go.pkt/packet/icmpv6"
+import "github.com/ghedo/go.pkt/packet/igmp"
 import "github.com/ghedo/go.pkt/packet/ipv4"
 import "github.com/ghedo/go.pkt/packet/ipv6"
+import "github.com/ghedo/go.pkt/packet/isis"
+import "github.com/ghedo/go.pkt/packet/l2cap"
+import "github.com/ghedo/go.pkt/packet/l2tp"
 import "github.com/ghedo/go.pkt/packet/llc"
+import "github.com/ghedo/go.pkt/packet/lldp"
+import "github.com/ghedo/go.pkt/packet/mpls"
+import "github.com/ghedo/go.pkt/packet/ntp"
+import "github.com/ghedo/go.pkt/packet/ospf"
+import "github.com/ghedo/go.pkt/packet/pbb"
+import "github.com/ghedo/go.pkt/packet/ppp"
+import "github.com/ghedo/go.pkt/packet/pppoe"
 import "github.com/ghedo/go.pkt/packet/radiotap"
 import "github.com/ghedo/go.pkt/packet/raw"
 import "github.com/ghedo/go.pkt/packet/sll"
+import "github.com/ghedo/go.pkt/packet/sctp"
 import "github.com/ghedo/go.pkt/packet/snap"
+import "github.com/ghedo/go.pkt/packet/stp"
 import "github.com/ghedo/go.pkt/packet/tcp"
+import "github.com/ghedo/go.pkt/packet/tls"
+import "github.com/ghedo/go.pkt/packet/trill"
 import "github.com/ghedo/go.pkt/packet/udp"
+import "github.com/ghedo/go.pkt/packet/udplite"
 import "github.com/ghedo/go.pkt/packet/vlan"
+import "github.com/ghedo/go.pkt/packet/vxlan"
+import "github.com/ghedo/go.pkt/packet/wifi"
+import "github.com/ghedo/go.pkt/packet/wol"
 
 // Compose packets into a chain and update their values (e.g. length, payload
 // protocol) accordingly.
@@ -113,7 +145,7 @@ func Unpack(buf []byte, pkts ...packet.Packet) (packet.Packet, error) {
     var b packet.Buffer
     b.Init(buf)
 
-    prev_pkt := packet.Packet(nil)
+    var decoded []packet.Packet
 
     for _, p := range pkts {
         if b.Len() <= 0 {
@@ -127,17 +159,15 @@ func Unpack(buf []byte, pkts ...packet.Packet) (packet.Packet, error) {
             return nil, err
         }
 
-        if prev_pkt != nil {
-            prev_pkt.SetPayload(p)
-        }
+        decoded = append(decoded, p)
 
         if p.GuessPayloadType() == packet.None {
             break
         }
-
-        prev_pkt = p
     }
 
+    link_payloads(decoded)
+
     return pkts[0], nil
 }
 
@@ -154,8 +184,7 @@ func UnpackAll(buf []byte, link_type packet.Type) (packet.Packet, error) {
     var b packet.Buffer
     b.Init(buf)
 
-    first_pkt := packet.Packet(nil)
-    prev_pkt  := packet.Packet(nil)
+    var decoded []packet.Packet
 
     for link_type != packet.None {
         var p packet.Packet
@@ -165,19 +194,54 @@ func UnpackAll(buf []byte, link_type packet.Type) (packet.Packet, error) {
         }
 
         switch link_type {
+        case packet.AH:       p = &ah.Packet{}
         case packet.ARP:      p = &arp.Packet{}
+        case packet.ATT:      p = &att.Packet{}
+        case packet.BLE:      p = &ble.Packet{}
+        case packet.BLERF:    p = &ble.Packet{ RF: true }
+        case packet.CDP:      p = &cdp.Packet{}
+        case packet.DHCPv4:   p = &dhcpv4.Packet{}
+        case packet.DHCPv6:   p = &dhcpv6.Packet{}
+        case packet.DNS:      p = &dns.Packet{}
+        case packet.DNSTCP:   p = &dns.Packet{ OverTCP: true }
+        case packet.EAPOL:    p = &eapol.Packet{}
+        case packet.ERSPAN:   p = &erspan.Packet{}
+        case packet.ESP:      p = &esp.Packet{}
         case packet.Eth:      p = &eth.Packet{}
+        case packet.Geneve:   p = &geneve.Packet{}
+        case packet.GRE:      p = &gre.Packet{}
+        case packet.HCI:      p = &hci.Packet{}
         case packet.ICMPv4:   p = &icmpv4.Packet{}
         case packet.ICMPv6:   p = &icmpv6.Packet{}
+        case packet.IGMP:     p = &igmp.Packet{}
         case packet.IPv4:     p = &ipv4.Packet{}
         case packet.IPv6:     p = &ipv6.Packet{}
+        case packet.ISIS:     p = &isis.Packet{}
+        case packet.L2CAP:    p = &l2cap.Packet{}
+        case packet.L2TP:     p = &l2tp.Packet{}
+        case packet.L2TPIP:   p = &l2tp.Packet{ OverIP: true }
         case packet.LLC:      p = &llc.Packet{}
+        case packet.LLDP:     p = &lldp.Packet{}
+        case packet.MPLS:     p = &mpls.Packet{}
+        case packet.NTP:      p = &ntp.Packet{}
+        case packet.OSPF:     p = &ospf.Packet{}
+        case packet.PBB:      p = &pbb.Packet{}
+        case packet.PPP:      p = &ppp.Packet{}
+        case packet.PPPoE:    p = &pppoe.Packet{}
         case packet.RadioTap: p = &radiotap.Packet{}
+        case packet.SCTP:     p = &sctp.Packet{}
         case packet.SLL:      p = &sll.Packet{}
         case packet.SNAP:     p = &snap.Packet{}
+        case packet.STP:      p = &stp.Packet{}
         case packet.TCP:      p = &tcp.Packet{}
+        case packet.TLS:      p = &tls.Packet{}
+        case packet.TRILL:    p = &trill.Packet{}
         case packet.UDP:      p = &udp.Packet{}
+        case packet.UDPLite:  p = &udplite.Packet{}
         case packet.VLAN:     p = &vlan.Packet{}
+        case packet.VXLAN:    p = &vxlan.Packet{}
+        case packet.WiFi:     p = &wifi.Packet{}
+        case packet.WoL:      p = &wol.Packet{}
         default:              p = &raw.Packet{}
         }
 
@@ -185,24 +249,58 @@ func UnpackAll(buf []byte, link_type packet.Type) (packet.Packet, error) {
             break
         }
 
+        data := b.Buffer()
+        off  := len(data) - b.Len()
+
         b.NewLayer()
 
         err := p.Unpack(&b)
         if err != nil {
-            return nil, err
-        }
+            if len(decoded) == 0 ||
+               !guessed_from_port(decoded[len(decoded) - 1]) {
+                return nil, err
+            }
 
-        if prev_pkt != nil {
-            prev_pkt.SetPayload(p)
-        } else {
-            first_pkt = p
+            /* the payload type was only guessed from the transport ports,
+             * so keep the payload as raw data instead */
+            b.Init(data)
+            b.SetOffset(off)
+            b.NewLayer()
+
+            p = &raw.Packet{}
+            p.Unpack(&b)
         }
 
-        prev_pkt  = p
+        decoded   = append(decoded, p)
         link_type = p.GuessPayloadType()
     }
 
-    return first_pkt, nil
+    if len(decoded) == 0 {
+        return nil, nil
+    }
+
+    link_payloads(decoded)
+
+    return decoded[0], nil
+}
+
+// Return whether the payload type of the given packet is guessed from its port
+// numbers, rather than being specified by a protocol field.
+func guessed_from_port(p packet.Packet) bool {
+    switch p.(type) {
+    case *tcp.Packet, *udp.Packet, *udplite.Packet:
+        return true
+    }
+
+    return false
+}
+
+// Chain the given decoded packets, starting from the innermost one, so that the
+// length of each payload is known when it is set.
+func link_payloads(pkts []packet.Packet) {
+    for i := len(pkts) - 1; i > 0; i-- {
+        pkts[i - 1].SetPayload(pkts[i])
+    }
 }
 
 // Return the first layer of the given type in the packet. If no suitable layer
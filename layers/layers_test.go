@@ -611,3 +611,44 @@ func ExampleUnpack() {
 
     log.Println(pkt)
 }
+
+func TestUnpackAllEthIPv4UDPJunk(t *testing.T) {
+    ports := []uint16{
+        udp.DNS, udp.BOOTPServer, udp.BOOTPClient, udp.NTP,
+        udp.DHCPv6Client, udp.DHCPv6Server, udp.L2TP, udp.VXLAN,
+        udp.Geneve, udp.MDNS, udp.LLMNR, udp.MPLS,
+    }
+
+    for _, port := range ports {
+        eth_pkt := eth.Make()
+        eth_pkt.SrcAddr, _ = net.ParseMAC(hwsrc_str)
+        eth_pkt.DstAddr, _ = net.ParseMAC(hwdst_str)
+
+        ip4_pkt := ipv4.Make()
+        ip4_pkt.SrcAddr = net.ParseIP(ipsrc_str)
+        ip4_pkt.DstAddr = net.ParseIP(ipdst_str)
+
+        udp_pkt := udp.Make()
+        udp_pkt.SrcPort = 41562
+        udp_pkt.DstPort = port
+
+        raw_pkt := raw.Make()
+        raw_pkt.Data = []byte{ 0xff, 0xff, 0xff }
+
+        data, err := layers.Pack(eth_pkt, ip4_pkt, udp_pkt, raw_pkt)
+        if err != nil {
+            t.Fatalf("Error packing: %s", err)
+        }
+
+        pkt, err := layers.UnpackAll(data, packet.Eth)
+        if err != nil {
+            t.Fatalf("Error unpacking port %d: %s", port, err)
+        }
+
+        dec, ok := layers.FindLayer(pkt, packet.Raw).(*raw.Packet)
+        if !ok || !bytes.Equal(dec.Data, raw_pkt.Data) ||
+           layers.FindLayer(pkt, packet.UDP) == nil {
+            t.Fatalf("Packet mismatch for port %d: %s", port, pkt)
+        }
+    }
+}
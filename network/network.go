@@ -41,6 +41,9 @@ import "github.com/ghedo/go.pkt/capture"
 import "github.com/ghedo/go.pkt/packet"
 import "github.com/ghedo/go.pkt/packet/arp"
 import "github.com/ghedo/go.pkt/packet/eth"
+import "github.com/ghedo/go.pkt/packet/ipv4"
+import "github.com/ghedo/go.pkt/packet/udp"
+import "github.com/ghedo/go.pkt/packet/wol"
 import "github.com/ghedo/go.pkt/layers"
 import "github.com/ghedo/go.pkt/routing"
 
@@ -141,3 +144,41 @@ func NextHopMAC(c capture.Handle, t time.Duration, r *routing.Route, addr net.IP
 
     return pkt.Payload().(*arp.Packet).HWSrcAddr, nil
 }
+
+// Send a Wake-on-LAN magic packet for the given MAC address, optionally
+// including a SecureOn password (nil, 4 or 6 bytes long), using src as source
+// hardware address. Only Ethernet and raw IPv4 capture handles are supported:
+// on the former the magic packet is broadcast with the WoL EtherType, on the
+// latter it's broadcast to the UDP discard port.
+func WakeOnLAN(c capture.Handle, src, target net.HardwareAddr, password []byte) error {
+    wol_pkt := wol.Make(target)
+    wol_pkt.Password = password
+
+    switch c.LinkType() {
+    case packet.Eth:
+        if len(src) != 6 {
+            return fmt.Errorf("Invalid source address %s", src)
+        }
+
+        eth_pkt := eth.Make()
+        eth_pkt.SrcAddr = src
+        eth_pkt.DstAddr, _ = net.ParseMAC("ff:ff:ff:ff:ff:ff")
+
+        return Send(c, eth_pkt, wol_pkt)
+
+    case packet.IPv4:
+        ip4_pkt := ipv4.Make()
+        ip4_pkt.SrcAddr = net.IPv4zero
+        ip4_pkt.DstAddr = net.IPv4bcast
+
+        udp_pkt := udp.Make()
+        udp_pkt.SrcPort = udp.WoL
+        udp_pkt.DstPort = udp.WoL
+
+        return Send(c, ip4_pkt, udp_pkt, wol_pkt)
+
+    default:
+        return fmt.Errorf("Wake-on-LAN unsupported on link type %s",
+                          c.LinkType())
+    }
+}
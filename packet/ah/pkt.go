@@ -0,0 +1,145 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+// Provides encoding and decoding for IPsec Authentication Header packets (RFC
+// 4302).
+package ah
+
+import "fmt"
+
+import "github.com/ghedo/go.pkt/packet"
+import "github.com/ghedo/go.pkt/packet/ipv4"
+
+type Packet struct {
+    NextHdr     ipv4.Protocol `string:"next"`
+    PayloadLen  uint8         `cmp:"skip" string:"len"`
+    Reserved    uint16        `cmp:"skip" string:"skip"`
+    SPI         uint32        `string:"spi"`
+    Seq         uint32
+    ICV         []byte        `string:"skip"`
+    pkt_payload packet.Packet `cmp:"skip" string:"skip"`
+}
+
+func Make() *Packet {
+    return &Packet{
+        PayloadLen: 4,
+        ICV: make([]byte, 12),
+    }
+}
+
+func (p *Packet) GetType() packet.Type {
+    return packet.AH
+}
+
+func (p *Packet) GetLength() uint16 {
+    length := 12 + uint16(len(p.ICV))
+
+    if p.pkt_payload != nil {
+        return p.pkt_payload.GetLength() + length
+    }
+
+    return length
+}
+
+func (p *Packet) Equals(other packet.Packet) bool {
+    return packet.Compare(p, other)
+}
+
+func (p *Packet) Answers(other packet.Packet) bool {
+    if other == nil || other.GetType() != packet.AH {
+        return false
+    }
+
+    if p.Payload() != nil {
+        return p.Payload().Answers(other.Payload())
+    }
+
+    return true
+}
+
+func (p *Packet) Pack(buf *packet.Buffer) error {
+    if len(p.ICV) % 4 != 0 {
+        return fmt.Errorf("Invalid ICV length %d", len(p.ICV))
+    }
+
+    p.PayloadLen = uint8((12 + len(p.ICV)) / 4 - 2)
+
+    buf.WriteN(p.NextHdr)
+    buf.WriteN(p.PayloadLen)
+    buf.WriteN(p.Reserved)
+    buf.WriteN(p.SPI)
+    buf.WriteN(p.Seq)
+    buf.Write(p.ICV)
+
+    return nil
+}
+
+func (p *Packet) Unpack(buf *packet.Buffer) error {
+    buf.ReadN(&p.NextHdr)
+    buf.ReadN(&p.PayloadLen)
+    buf.ReadN(&p.Reserved)
+    buf.ReadN(&p.SPI)
+    buf.ReadN(&p.Seq)
+
+    icv_len := (int(p.PayloadLen) + 2) * 4 - 12
+    if icv_len < 0 || icv_len > buf.Len() {
+        return fmt.Errorf("Invalid AH payload length %d", p.PayloadLen)
+    }
+
+    p.ICV = buf.Next(icv_len)
+
+    return nil
+}
+
+func (p *Packet) Payload() packet.Packet {
+    return p.pkt_payload
+}
+
+func (p *Packet) GuessPayloadType() packet.Type {
+    return ipv4.ProtocolToType(p.NextHdr)
+}
+
+func (p *Packet) SetPayload(pl packet.Packet) error {
+    p.pkt_payload = pl
+
+    /* keep the original protocol of undecoded payloads */
+    if proto := ipv4.TypeToProtocol(pl.GetType()); proto != ipv4.None {
+        p.NextHdr = proto
+    }
+
+    return nil
+}
+
+func (p *Packet) InitChecksum(csum uint32) {
+}
+
+func (p *Packet) String() string {
+    return packet.Stringify(p)
+}
@@ -0,0 +1,160 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package ah_test
+
+import "bytes"
+import "net"
+import "testing"
+
+import "github.com/ghedo/go.pkt/layers"
+import "github.com/ghedo/go.pkt/packet"
+import "github.com/ghedo/go.pkt/packet/ah"
+import "github.com/ghedo/go.pkt/packet/ipv4"
+import "github.com/ghedo/go.pkt/packet/udp"
+
+var test_simple = []byte{
+    0x11, 0x04, 0x00, 0x00, 0x00, 0x00, 0x10, 0x00, 0x00, 0x00, 0x00, 0x01,
+    0x0d, 0xf1, 0x8a, 0x1e, 0x3c, 0x55, 0x2e, 0x5b, 0x09, 0xc7, 0x14, 0x63,
+}
+
+func MakeTestSimple() *ah.Packet {
+    return &ah.Packet{
+        NextHdr: ipv4.UDP,
+        PayloadLen: 4,
+        SPI: 0x1000,
+        Seq: 1,
+        ICV: []byte{
+            0x0d, 0xf1, 0x8a, 0x1e, 0x3c, 0x55, 0x2e, 0x5b,
+            0x09, 0xc7, 0x14, 0x63,
+        },
+    }
+}
+
+func TestPack(t *testing.T) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_simple)))
+
+    p := MakeTestSimple()
+
+    err := p.Pack(&b)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if !bytes.Equal(test_simple, b.Buffer()) {
+        t.Fatalf("Raw packet mismatch: %x", b.Buffer())
+    }
+}
+
+func BenchmarkPack(bn *testing.B) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_simple)))
+
+    p := MakeTestSimple()
+
+    for n := 0; n < bn.N; n++ {
+        p.Pack(&b)
+    }
+}
+
+func TestUnpack(t *testing.T) {
+    var p ah.Packet
+
+    cmp := MakeTestSimple()
+
+    var b packet.Buffer
+    b.Init(test_simple)
+
+    err := p.Unpack(&b)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if !p.Equals(cmp) {
+        t.Fatalf("Packet mismatch:\n%s\n%s", &p, cmp)
+    }
+}
+
+func BenchmarkUnpack(bn *testing.B) {
+    var p ah.Packet
+    var b packet.Buffer
+
+    for n := 0; n < bn.N; n++ {
+        b.Init(test_simple)
+        p.Unpack(&b)
+    }
+}
+
+func TestUnpackInvalid(t *testing.T) {
+    var p ah.Packet
+
+    var b packet.Buffer
+    b.Init(test_simple[:16])
+
+    err := p.Unpack(&b)
+    if err == nil {
+        t.Fatalf("Truncated packet unpacked: %s", &p)
+    }
+}
+
+func TestPayload(t *testing.T) {
+    ip4 := ipv4.Make()
+    ip4.SrcAddr = net.ParseIP("192.168.1.1")
+    ip4.DstAddr = net.ParseIP("192.168.1.2")
+
+    ah_pkt := MakeTestSimple()
+
+    udp_pkt := udp.Make()
+    udp_pkt.SrcPort = 500
+    udp_pkt.DstPort = 500
+
+    buf, err := layers.Pack(ip4, ah_pkt, udp_pkt)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    pkt, err := layers.UnpackAll(buf, packet.IPv4)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if pkt.(*ipv4.Packet).Protocol != ipv4.IPSecAH {
+        t.Fatalf("Protocol mismatch: %s", pkt)
+    }
+
+    if !layers.FindLayer(pkt, packet.AH).Equals(ah_pkt) {
+        t.Fatalf("AH layer mismatch: %s", pkt)
+    }
+
+    if !layers.FindLayer(pkt, packet.UDP).Equals(udp_pkt) {
+        t.Fatalf("UDP layer mismatch: %s", pkt)
+    }
+}
@@ -0,0 +1,327 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package att
+
+import "encoding/binary"
+import "fmt"
+import "strings"
+
+// Bluetooth UUID, either 16-bit or 128-bit, in transmission (little-endian)
+// byte order.
+type UUID []byte
+
+// Attribute types of the GATT declarations and descriptors.
+var (
+    PrimaryServiceUUID   = UUID16(0x2800)
+    SecondaryServiceUUID = UUID16(0x2801)
+    IncludeUUID          = UUID16(0x2802)
+    CharacteristicUUID   = UUID16(0x2803)
+    ExtPropertiesUUID    = UUID16(0x2900)
+    UserDescriptionUUID  = UUID16(0x2901)
+    ClientConfigUUID     = UUID16(0x2902)
+    DeviceNameUUID       = UUID16(0x2a00)
+    AppearanceUUID       = UUID16(0x2a01)
+)
+
+/* Bluetooth base UUID 00000000-0000-1000-8000-00805f9b34fb */
+var base_uuid = UUID{
+    0xfb, 0x34, 0x9b, 0x5f, 0x80, 0x00, 0x00, 0x80,
+    0x00, 0x10, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+}
+
+// Attribute data, as found in the lists carried by find information, find by
+// type value, read by type and read by group type responses. Fields that are
+// not part of the list entries are left empty.
+type Attribute struct {
+    Handle    uint16
+    EndHandle uint16
+    UUID      UUID
+    Value     []byte
+}
+
+// Service definition, as discovered with read by group type requests.
+type Service struct {
+    Handle    uint16
+    EndHandle uint16
+    UUID      UUID
+}
+
+// Characteristic declaration, as discovered with read by type requests.
+type Characteristic struct {
+    Handle      uint16
+    Properties  Properties
+    ValueHandle uint16
+    UUID        UUID
+}
+
+// Characteristic properties.
+type Properties uint8
+
+const (
+    Broadcast         Properties = 0x01
+    Read                         = 0x02
+    WriteWithoutResp             = 0x04
+    Write                        = 0x08
+    Notify                       = 0x10
+    Indicate                     = 0x20
+    AuthSignedWrite              = 0x40
+    ExtendedProps                = 0x80
+)
+
+// Make a 16-bit UUID.
+func UUID16(u uint16) UUID {
+    return UUID{ uint8(u), uint8(u >> 8) }
+}
+
+// Return the 128-bit form of the UUID.
+func (u UUID) Full() UUID {
+    if len(u) != 2 && len(u) != 4 {
+        return u
+    }
+
+    full := make(UUID, 16)
+    copy(full, base_uuid)
+    copy(full[12:], u)
+
+    return full
+}
+
+// Compare two UUIDs, which may be of different sizes.
+func (u UUID) Equal(other UUID) bool {
+    a := u.Full()
+    b := other.Full()
+
+    if len(a) != len(b) {
+        return false
+    }
+
+    for i := range a {
+        if a[i] != b[i] {
+            return false
+        }
+    }
+
+    return true
+}
+
+func (u UUID) String() string {
+    switch len(u) {
+    case 0:
+        return ""
+
+    case 2:
+        return fmt.Sprintf("%04x", binary.LittleEndian.Uint16(u))
+
+    case 16:
+        var b [16]byte
+
+        for i := range u {
+            b[15 - i] = u[i]
+        }
+
+        return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8],
+                           b[8:10], b[10:16])
+
+    default:
+        return fmt.Sprintf("%x", []byte(u))
+    }
+}
+
+// Decode the list of attribute data of find information, find by type value,
+// read by type and read by group type responses.
+func (p *Packet) Attributes() ([]Attribute, error) {
+    var attrs []Attribute
+    var entry_len int
+
+    switch p.Opcode {
+    case FindInfoRsp:
+        switch p.Format {
+        case 0x01: entry_len = 4
+        case 0x02: entry_len = 18
+        default:
+            return nil, fmt.Errorf("Invalid format %d", p.Format)
+        }
+
+    case FindByTypeValueRsp:
+        entry_len = 4
+
+    case ReadByTypeRsp:
+        entry_len = int(p.Format)
+
+        if entry_len < 2 {
+            return nil, fmt.Errorf("Invalid attribute data length %d", entry_len)
+        }
+
+    case ReadByGroupTypeRsp:
+        entry_len = int(p.Format)
+
+        if entry_len < 4 {
+            return nil, fmt.Errorf("Invalid attribute data length %d", entry_len)
+        }
+
+    default:
+        return nil, fmt.Errorf("Not an attribute list: %s", p.Opcode)
+    }
+
+    if len(p.Value) % entry_len != 0 {
+        return nil, fmt.Errorf("Invalid attribute list length %d", len(p.Value))
+    }
+
+    for data := p.Value; len(data) > 0; data = data[entry_len:] {
+        entry := data[:entry_len]
+
+        attr := Attribute{ Handle: binary.LittleEndian.Uint16(entry) }
+
+        switch p.Opcode {
+        case FindInfoRsp:
+            attr.UUID = UUID(entry[2:])
+
+        case FindByTypeValueRsp:
+            attr.EndHandle = binary.LittleEndian.Uint16(entry[2:])
+
+        case ReadByTypeRsp:
+            attr.Value = entry[2:]
+
+        case ReadByGroupTypeRsp:
+            attr.EndHandle = binary.LittleEndian.Uint16(entry[2:])
+            attr.Value     = entry[4:]
+        }
+
+        attrs = append(attrs, attr)
+    }
+
+    return attrs, nil
+}
+
+// Return the list of handles of a read multiple request.
+func (p *Packet) Handles() ([]uint16, error) {
+    if p.Opcode != ReadMultipleReq {
+        return nil, fmt.Errorf("Not a read multiple request")
+    }
+
+    if len(p.Value) % 2 != 0 {
+        return nil, fmt.Errorf("Invalid handle list length %d", len(p.Value))
+    }
+
+    var handles []uint16
+
+    for i := 0; i < len(p.Value); i += 2 {
+        handles = append(handles, binary.LittleEndian.Uint16(p.Value[i:]))
+    }
+
+    return handles, nil
+}
+
+// Decode the services of a read by group type response to a primary or
+// secondary service discovery.
+func (p *Packet) Services() ([]Service, error) {
+    if p.Opcode != ReadByGroupTypeRsp {
+        return nil, fmt.Errorf("Not a read by group type response")
+    }
+
+    attrs, err := p.Attributes()
+    if err != nil {
+        return nil, err
+    }
+
+    var services []Service
+
+    for _, a := range attrs {
+        if len(a.Value) != 2 && len(a.Value) != 16 {
+            return nil, fmt.Errorf("Invalid service UUID length %d", len(a.Value))
+        }
+
+        services = append(services, Service{
+            Handle:    a.Handle,
+            EndHandle: a.EndHandle,
+            UUID:      UUID(a.Value),
+        })
+    }
+
+    return services, nil
+}
+
+// Decode the characteristic declarations of a read by type response to a
+// characteristic discovery.
+func (p *Packet) Characteristics() ([]Characteristic, error) {
+    if p.Opcode != ReadByTypeRsp {
+        return nil, fmt.Errorf("Not a read by type response")
+    }
+
+    attrs, err := p.Attributes()
+    if err != nil {
+        return nil, err
+    }
+
+    var chars []Characteristic
+
+    for _, a := range attrs {
+        c, err := ParseCharacteristic(a.Handle, a.Value)
+        if err != nil {
+            return nil, err
+        }
+
+        chars = append(chars, *c)
+    }
+
+    return chars, nil
+}
+
+// Decode the value of the characteristic declaration with the given handle.
+func ParseCharacteristic(handle uint16, value []byte) (*Characteristic, error) {
+    if len(value) != 5 && len(value) != 19 {
+        return nil, fmt.Errorf("Invalid characteristic length %d", len(value))
+    }
+
+    return &Characteristic{
+        Handle:      handle,
+        Properties:  Properties(value[0]),
+        ValueHandle: binary.LittleEndian.Uint16(value[1:]),
+        UUID:        UUID(value[3:]),
+    }, nil
+}
+
+func (p Properties) String() string {
+    var props []string
+
+    names := []string{
+        "broadcast", "read", "write_without_rsp", "write", "notify",
+        "indicate", "auth_signed_write", "extended",
+    }
+
+    for i, name := range names {
+        if p & (1 << uint(i)) != 0 {
+            props = append(props, name)
+        }
+    }
+
+    return strings.Join(props, "|")
+}
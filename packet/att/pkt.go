@@ -0,0 +1,399 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+// Provides encoding and decoding for Bluetooth ATT (attribute protocol) PDUs,
+// which carry the GATT procedures of Bluetooth LE devices.
+package att
+
+import "fmt"
+
+import "github.com/ghedo/go.pkt/packet"
+
+type Packet struct {
+    Opcode      Opcode    `string:"op"`
+    ReqOpcode   Opcode    `string:"req"`
+    ErrorCode   ErrorCode `string:"err"`
+    Handle      uint16    `string:"handle"`
+    EndHandle   uint16    `string:"end"`
+    MTU         uint16    `string:"mtu"`
+    Offset      uint16    `string:"off"`
+    Flags       uint8     `string:"flags"`
+    Format      uint8     `string:"fmt"`
+    UUID        UUID      `string:"uuid"`
+    Value       []byte    `string:"skip"`
+    Signature   []byte    `string:"skip"`
+}
+
+type Opcode uint8
+
+const (
+    ErrorRsp                Opcode = 0x01
+    ExchangeMTUReq                 = 0x02
+    ExchangeMTURsp                 = 0x03
+    FindInfoReq                    = 0x04
+    FindInfoRsp                    = 0x05
+    FindByTypeValueReq             = 0x06
+    FindByTypeValueRsp             = 0x07
+    ReadByTypeReq                  = 0x08
+    ReadByTypeRsp                  = 0x09
+    ReadReq                        = 0x0a
+    ReadRsp                        = 0x0b
+    ReadBlobReq                    = 0x0c
+    ReadBlobRsp                    = 0x0d
+    ReadMultipleReq                = 0x0e
+    ReadMultipleRsp                = 0x0f
+    ReadByGroupTypeReq             = 0x10
+    ReadByGroupTypeRsp             = 0x11
+    WriteReq                       = 0x12
+    WriteRsp                       = 0x13
+    PrepareWriteReq                = 0x16
+    PrepareWriteRsp                = 0x17
+    ExecuteWriteReq                = 0x18
+    ExecuteWriteRsp                = 0x19
+    HandleValueNotification        = 0x1b
+    HandleValueIndication          = 0x1d
+    HandleValueConfirmation        = 0x1e
+    WriteCmd                       = 0x52
+    SignedWriteCmd                 = 0xd2
+)
+
+// Opcode flags.
+const (
+    CommandFlag   Opcode = 0x40
+    SignatureFlag        = 0x80
+)
+
+type ErrorCode uint8
+
+const (
+    InvalidHandle          ErrorCode = 0x01
+    ReadNotPermitted                 = 0x02
+    WriteNotPermitted                = 0x03
+    InvalidPDU                       = 0x04
+    InsufficientAuthn                = 0x05
+    RequestNotSupported              = 0x06
+    InvalidOffset                    = 0x07
+    InsufficientAuthz                = 0x08
+    PrepareQueueFull                 = 0x09
+    AttributeNotFound                = 0x0a
+    AttributeNotLong                 = 0x0b
+    InsufficientKeySize              = 0x0c
+    InvalidValueLength               = 0x0d
+    UnlikelyError                    = 0x0e
+    InsufficientEncryption           = 0x0f
+    UnsupportedGroupType             = 0x10
+    InsufficientResources            = 0x11
+)
+
+func Make() *Packet {
+    return &Packet{
+        Opcode: ReadReq,
+    }
+}
+
+func (p *Packet) GetType() packet.Type {
+    return packet.ATT
+}
+
+func (p *Packet) GetLength() uint16 {
+    return 1 + p.params_len() + uint16(len(p.UUID)) +
+           uint16(len(p.Value)) + uint16(len(p.Signature))
+}
+
+/* length of the fixed size parameters of each opcode */
+func (p *Packet) params_len() uint16 {
+    switch p.Opcode {
+    case ErrorRsp:
+        return 4
+
+    case ExchangeMTUReq, ExchangeMTURsp, ReadReq:
+        return 2
+
+    case FindInfoReq, FindByTypeValueReq, ReadByTypeReq, ReadBlobReq,
+         ReadByGroupTypeReq, PrepareWriteReq, PrepareWriteRsp:
+        return 4
+
+    case FindInfoRsp, ReadByTypeRsp, ReadByGroupTypeRsp, ExecuteWriteReq:
+        return 1
+
+    case WriteReq, WriteCmd, SignedWriteCmd, HandleValueNotification,
+         HandleValueIndication:
+        return 2
+
+    default:
+        return 0
+    }
+}
+
+func (p *Packet) Equals(other packet.Packet) bool {
+    return packet.Compare(p, other)
+}
+
+// Check if the packet is an answer to another packet. Responses answer the
+// corresponding requests, error responses answer the request they report an
+// error for, and confirmations answer indications.
+func (p *Packet) Answers(other packet.Packet) bool {
+    if other == nil || other.GetType() != packet.ATT {
+        return false
+    }
+
+    o := other.(*Packet)
+
+    if p.Opcode == ErrorRsp {
+        return o.Opcode == p.ReqOpcode && o.Opcode.IsRequest()
+    }
+
+    return o.Opcode.Response() == p.Opcode
+}
+
+func (p *Packet) Pack(buf *packet.Buffer) error {
+    if p.Opcode == SignedWriteCmd && len(p.Signature) != 12 {
+        return fmt.Errorf("Invalid ATT signature length %d", len(p.Signature))
+    }
+
+    buf.WriteN(p.Opcode)
+
+    switch p.Opcode {
+    case ErrorRsp:
+        buf.WriteN(p.ReqOpcode)
+        buf.WriteL(p.Handle)
+        buf.WriteN(p.ErrorCode)
+
+    case ExchangeMTUReq, ExchangeMTURsp:
+        buf.WriteL(p.MTU)
+
+    case FindInfoReq, FindByTypeValueReq, ReadByTypeReq,
+         ReadByGroupTypeReq:
+        buf.WriteL(p.Handle)
+        buf.WriteL(p.EndHandle)
+
+    case ReadReq, WriteReq, WriteCmd, SignedWriteCmd,
+         HandleValueNotification, HandleValueIndication:
+        buf.WriteL(p.Handle)
+
+    case ReadBlobReq, PrepareWriteReq, PrepareWriteRsp:
+        buf.WriteL(p.Handle)
+        buf.WriteL(p.Offset)
+
+    case FindInfoRsp, ReadByTypeRsp, ReadByGroupTypeRsp:
+        buf.WriteN(p.Format)
+
+    case ExecuteWriteReq:
+        buf.WriteN(p.Flags)
+    }
+
+    buf.Write(p.UUID)
+    buf.Write(p.Value)
+    buf.Write(p.Signature)
+
+    return nil
+}
+
+func (p *Packet) Unpack(buf *packet.Buffer) error {
+    buf.ReadN(&p.Opcode)
+
+    if buf.Len() < int(p.params_len()) {
+        return fmt.Errorf("Invalid ATT %s length %d", p.Opcode, buf.Len())
+    }
+
+    p.UUID      = nil
+    p.Value     = nil
+    p.Signature = nil
+
+    switch p.Opcode {
+    case ErrorRsp:
+        buf.ReadN(&p.ReqOpcode)
+        buf.ReadL(&p.Handle)
+        buf.ReadN(&p.ErrorCode)
+
+    case ExchangeMTUReq, ExchangeMTURsp:
+        buf.ReadL(&p.MTU)
+
+    case FindInfoReq:
+        buf.ReadL(&p.Handle)
+        buf.ReadL(&p.EndHandle)
+
+    case FindByTypeValueReq:
+        buf.ReadL(&p.Handle)
+        buf.ReadL(&p.EndHandle)
+
+        if buf.Len() < 2 {
+            return fmt.Errorf("Invalid ATT %s length %d", p.Opcode, buf.Len())
+        }
+
+        p.UUID = buf.Next(2)
+
+    case ReadByTypeReq, ReadByGroupTypeReq:
+        buf.ReadL(&p.Handle)
+        buf.ReadL(&p.EndHandle)
+
+        if buf.Len() != 2 && buf.Len() != 16 {
+            return fmt.Errorf("Invalid ATT UUID length %d", buf.Len())
+        }
+
+        p.UUID = buf.Next(buf.Len())
+
+    case ReadReq, WriteReq, WriteCmd, SignedWriteCmd,
+         HandleValueNotification, HandleValueIndication:
+        buf.ReadL(&p.Handle)
+
+    case ReadBlobReq, PrepareWriteReq, PrepareWriteRsp:
+        buf.ReadL(&p.Handle)
+        buf.ReadL(&p.Offset)
+
+    case FindInfoRsp, ReadByTypeRsp, ReadByGroupTypeRsp:
+        buf.ReadN(&p.Format)
+
+    case ExecuteWriteReq:
+        buf.ReadN(&p.Flags)
+    }
+
+    if p.Opcode == SignedWriteCmd {
+        if buf.Len() < 12 {
+            return fmt.Errorf("Invalid ATT signature length %d", buf.Len())
+        }
+
+        p.Value     = buf.Next(buf.Len() - 12)
+        p.Signature = buf.Next(12)
+    } else if buf.Len() > 0 {
+        p.Value = buf.Next(buf.Len())
+    }
+
+    return nil
+}
+
+func (p *Packet) Payload() packet.Packet {
+    return nil
+}
+
+func (p *Packet) GuessPayloadType() packet.Type {
+    return packet.None
+}
+
+func (p *Packet) SetPayload(pl packet.Packet) error {
+    return nil
+}
+
+func (p *Packet) InitChecksum(csum uint32) {
+}
+
+func (p *Packet) String() string {
+    return packet.Stringify(p)
+}
+
+var request_to_response_map = map[Opcode]Opcode{
+    ExchangeMTUReq:        ExchangeMTURsp,
+    FindInfoReq:           FindInfoRsp,
+    FindByTypeValueReq:    FindByTypeValueRsp,
+    ReadByTypeReq:         ReadByTypeRsp,
+    ReadReq:               ReadRsp,
+    ReadBlobReq:           ReadBlobRsp,
+    ReadMultipleReq:       ReadMultipleRsp,
+    ReadByGroupTypeReq:    ReadByGroupTypeRsp,
+    WriteReq:              WriteRsp,
+    PrepareWriteReq:       PrepareWriteRsp,
+    ExecuteWriteReq:       ExecuteWriteRsp,
+    HandleValueIndication: HandleValueConfirmation,
+}
+
+// Return the opcode of the response (or confirmation) to the given request
+// (or indication), or 0 if the opcode doesn't expect one.
+func (o Opcode) Response() Opcode {
+    return request_to_response_map[o]
+}
+
+// Return whether the opcode is a request that expects a response.
+func (o Opcode) IsRequest() bool {
+    return o.Response() != 0 && o != HandleValueIndication
+}
+
+// Return whether the opcode is a command, which expects no response.
+func (o Opcode) IsCommand() bool {
+    return o & CommandFlag != 0
+}
+
+func (o Opcode) String() string {
+    switch o {
+    case ErrorRsp:                return "error_rsp"
+    case ExchangeMTUReq:          return "exchange_mtu_req"
+    case ExchangeMTURsp:          return "exchange_mtu_rsp"
+    case FindInfoReq:             return "find_info_req"
+    case FindInfoRsp:             return "find_info_rsp"
+    case FindByTypeValueReq:      return "find_by_type_value_req"
+    case FindByTypeValueRsp:      return "find_by_type_value_rsp"
+    case ReadByTypeReq:           return "read_by_type_req"
+    case ReadByTypeRsp:           return "read_by_type_rsp"
+    case ReadReq:                 return "read_req"
+    case ReadRsp:                 return "read_rsp"
+    case ReadBlobReq:             return "read_blob_req"
+    case ReadBlobRsp:             return "read_blob_rsp"
+    case ReadMultipleReq:         return "read_multiple_req"
+    case ReadMultipleRsp:         return "read_multiple_rsp"
+    case ReadByGroupTypeReq:      return "read_by_group_type_req"
+    case ReadByGroupTypeRsp:      return "read_by_group_type_rsp"
+    case WriteReq:                return "write_req"
+    case WriteRsp:                return "write_rsp"
+    case PrepareWriteReq:         return "prepare_write_req"
+    case PrepareWriteRsp:         return "prepare_write_rsp"
+    case ExecuteWriteReq:         return "execute_write_req"
+    case ExecuteWriteRsp:         return "execute_write_rsp"
+    case HandleValueNotification: return "notification"
+    case HandleValueIndication:   return "indication"
+    case HandleValueConfirmation: return "confirmation"
+    case WriteCmd:                return "write_cmd"
+    case SignedWriteCmd:          return "signed_write_cmd"
+    case 0:                       return ""
+    default:                      return fmt.Sprintf("0x%x", uint8(o))
+    }
+}
+
+func (e ErrorCode) String() string {
+    switch e {
+    case 0:                      return ""
+    case InvalidHandle:          return "invalid_handle"
+    case ReadNotPermitted:       return "read_not_permitted"
+    case WriteNotPermitted:      return "write_not_permitted"
+    case InvalidPDU:             return "invalid_pdu"
+    case InsufficientAuthn:      return "insufficient_authentication"
+    case RequestNotSupported:    return "request_not_supported"
+    case InvalidOffset:          return "invalid_offset"
+    case InsufficientAuthz:      return "insufficient_authorization"
+    case PrepareQueueFull:       return "prepare_queue_full"
+    case AttributeNotFound:      return "attribute_not_found"
+    case AttributeNotLong:       return "attribute_not_long"
+    case InsufficientKeySize:    return "insufficient_key_size"
+    case InvalidValueLength:     return "invalid_value_length"
+    case UnlikelyError:          return "unlikely_error"
+    case InsufficientEncryption: return "insufficient_encryption"
+    case UnsupportedGroupType:   return "unsupported_group_type"
+    case InsufficientResources:  return "insufficient_resources"
+    default:                     return fmt.Sprintf("0x%x", uint8(e))
+    }
+}
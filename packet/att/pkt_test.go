@@ -0,0 +1,193 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package att_test
+
+import "bytes"
+import "testing"
+
+import "github.com/ghedo/go.pkt/packet"
+import "github.com/ghedo/go.pkt/packet/att"
+
+var test_simple = []byte{
+    0x11, 0x06, 0x01, 0x00, 0x05, 0x00, 0x00, 0x18, 0x06, 0x00, 0x09, 0x00,
+    0x0f, 0x18,
+}
+
+func MakeTestSimple() *att.Packet {
+    return &att.Packet{
+        Opcode: att.ReadByGroupTypeRsp,
+        Format: 6,
+        Value: []byte{
+            0x01, 0x00, 0x05, 0x00, 0x00, 0x18,
+            0x06, 0x00, 0x09, 0x00, 0x0f, 0x18,
+        },
+    }
+}
+
+func TestPack(t *testing.T) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_simple)))
+
+    p := MakeTestSimple()
+
+    err := p.Pack(&b)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if !bytes.Equal(test_simple, b.Buffer()) {
+        t.Fatalf("Raw packet mismatch: %x", b.Buffer())
+    }
+}
+
+func BenchmarkPack(bn *testing.B) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_simple)))
+
+    p := MakeTestSimple()
+
+    for n := 0; n < bn.N; n++ {
+        p.Pack(&b)
+    }
+}
+
+func TestUnpack(t *testing.T) {
+    var p att.Packet
+
+    cmp := MakeTestSimple()
+
+    var b packet.Buffer
+    b.Init(test_simple)
+
+    err := p.Unpack(&b)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if !p.Equals(cmp) {
+        t.Fatalf("Packet mismatch:\n%s\n%s", &p, cmp)
+    }
+}
+
+func BenchmarkUnpack(bn *testing.B) {
+    var p att.Packet
+    var b packet.Buffer
+
+    for n := 0; n < bn.N; n++ {
+        b.Init(test_simple)
+        p.Unpack(&b)
+    }
+}
+
+func TestServices(t *testing.T) {
+    p := MakeTestSimple()
+
+    services, err := p.Services()
+    if err != nil {
+        t.Fatalf("Error decoding services: %s", err)
+    }
+
+    if len(services) != 2 ||
+       services[0].Handle != 1 || services[0].EndHandle != 5 ||
+       services[1].UUID.String() != "180f" ||
+       !services[1].UUID.Equal(att.UUID{
+           0xfb, 0x34, 0x9b, 0x5f, 0x80, 0x00, 0x00, 0x80,
+           0x00, 0x10, 0x00, 0x00, 0x0f, 0x18, 0x00, 0x00,
+       }) {
+        t.Fatalf("Services mismatch: %v", services)
+    }
+
+    req := &att.Packet{
+        Opcode: att.ReadByGroupTypeReq,
+        Handle: 0x0001,
+        EndHandle: 0xffff,
+        UUID: att.PrimaryServiceUUID,
+    }
+
+    if !p.Answers(req) {
+        t.Fatalf("No answer: %s", p)
+    }
+
+    rsp := &att.Packet{
+        Opcode: att.ErrorRsp,
+        ReqOpcode: att.ReadByGroupTypeReq,
+        Handle: 0x000a,
+        ErrorCode: att.AttributeNotFound,
+    }
+
+    if !rsp.Answers(req) || rsp.Answers(p) {
+        t.Fatalf("Error response mismatch: %s", rsp)
+    }
+}
+
+func TestCharacteristics(t *testing.T) {
+    p := &att.Packet{
+        Opcode: att.ReadByTypeRsp,
+        Format: 7,
+        Value: []byte{
+            0x02, 0x00, 0x12, 0x03, 0x00, 0x19, 0x2a,
+        },
+    }
+
+    chars, err := p.Characteristics()
+    if err != nil {
+        t.Fatalf("Error decoding characteristics: %s", err)
+    }
+
+    if len(chars) != 1 || chars[0].Handle != 2 ||
+       chars[0].ValueHandle != 3 || chars[0].UUID.String() != "2a19" ||
+       chars[0].Properties.String() != "read|notify" {
+        t.Fatalf("Characteristics mismatch: %v", chars)
+    }
+}
+
+var test_signed = []byte{
+    0xd2, 0x03, 0x00, 0x01, 0x02, 0x00, 0x00, 0x00, 0x00, 0x0a, 0x0b, 0x0c,
+    0x0d, 0x0e, 0x0f, 0x10, 0x11,
+}
+
+func TestSignedWrite(t *testing.T) {
+    var p att.Packet
+
+    var b packet.Buffer
+    b.Init(test_signed)
+
+    err := p.Unpack(&b)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if !p.Opcode.IsCommand() || p.Handle != 3 ||
+       !bytes.Equal(p.Value, []byte{ 0x01, 0x02 }) ||
+       len(p.Signature) != 12 || int(p.GetLength()) != len(test_signed) {
+        t.Fatalf("Packet mismatch: %s", &p)
+    }
+}
@@ -0,0 +1,204 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package ble
+
+import "encoding/binary"
+import "fmt"
+
+// Advertising data structure.
+type AdvElement struct {
+    Type ADType
+    Data []byte
+}
+
+// Advertising data type.
+type ADType uint8
+
+const (
+    ADFlags              ADType = 0x01
+    ADIncompleteUUID16          = 0x02
+    ADCompleteUUID16            = 0x03
+    ADIncompleteUUID32          = 0x04
+    ADCompleteUUID32            = 0x05
+    ADIncompleteUUID128         = 0x06
+    ADCompleteUUID128           = 0x07
+    ADShortName                 = 0x08
+    ADCompleteName              = 0x09
+    ADTxPower                   = 0x0a
+    ADServiceData16             = 0x16
+    ADAppearance                = 0x19
+    ADServiceData32             = 0x20
+    ADServiceData128            = 0x21
+    ADManufacturerData          = 0xff
+)
+
+// Connection parameters, as carried by CONNECT_IND PDUs.
+type ConnParams struct {
+    AccessAddr AccessAddr
+    CRCInit    uint32
+    WinSize    uint8
+    WinOffset  uint16
+    Interval   uint16
+    Latency    uint16
+    Timeout    uint16
+    ChannelMap [5]byte
+    Hop        uint8
+    SCA        uint8
+}
+
+// Decode the advertising data structures in the given data.
+func ParseAdvData(data []byte) ([]AdvElement, error) {
+    var elems []AdvElement
+
+    for len(data) > 0 {
+        length := int(data[0])
+
+        /* the rest of the data is padding */
+        if length == 0 {
+            break
+        }
+
+        if len(data) < length + 1 {
+            return nil, fmt.Errorf("Invalid AD structure length %d", length)
+        }
+
+        elems = append(elems, AdvElement{
+            Type: ADType(data[1]),
+            Data: data[2:length + 1],
+        })
+
+        data = data[length + 1:]
+    }
+
+    return elems, nil
+}
+
+// Encode the given advertising data structures.
+func MakeAdvData(elems []AdvElement) []byte {
+    var data []byte
+
+    for _, e := range elems {
+        data = append(data, uint8(len(e.Data) + 1), uint8(e.Type))
+        data = append(data, e.Data...)
+    }
+
+    return data
+}
+
+// Decode the advertising data of ADV_IND, ADV_NONCONN_IND, ADV_SCAN_IND and
+// SCAN_RSP PDUs.
+func (p *Packet) AdvElements() ([]AdvElement, error) {
+    if !p.IsAdvertising() {
+        return nil, fmt.Errorf("Not an advertising PDU")
+    }
+
+    switch p.PDUType {
+    case AdvInd, AdvNonconnInd, AdvScanInd, ScanRsp:
+        return ParseAdvData(p.Data)
+
+    default:
+        return nil, fmt.Errorf("No advertising data in %s", p.PDUType)
+    }
+}
+
+// Return the first advertising data structure of the given type.
+func (p *Packet) FindAdvElement(t ADType) *AdvElement {
+    elems, _ := p.AdvElements()
+
+    for i := range elems {
+        if elems[i].Type == t {
+            return &elems[i]
+        }
+    }
+
+    return nil
+}
+
+// Return the complete or shortened local name of the advertiser.
+func (p *Packet) LocalName() string {
+    if e := p.FindAdvElement(ADCompleteName); e != nil {
+        return string(e.Data)
+    }
+
+    if e := p.FindAdvElement(ADShortName); e != nil {
+        return string(e.Data)
+    }
+
+    return ""
+}
+
+// Decode the connection parameters of CONNECT_IND PDUs.
+func (p *Packet) ConnParams() (*ConnParams, error) {
+    if !p.IsAdvertising() || p.PDUType != ConnectInd || len(p.Data) != 22 {
+        return nil, fmt.Errorf("Not a connection request")
+    }
+
+    d := p.Data
+
+    params := &ConnParams{
+        AccessAddr: AccessAddr(binary.LittleEndian.Uint32(d)),
+        CRCInit:    uint32(d[4]) | uint32(d[5]) << 8 | uint32(d[6]) << 16,
+        WinSize:    d[7],
+        WinOffset:  binary.LittleEndian.Uint16(d[8:]),
+        Interval:   binary.LittleEndian.Uint16(d[10:]),
+        Latency:    binary.LittleEndian.Uint16(d[12:]),
+        Timeout:    binary.LittleEndian.Uint16(d[14:]),
+        Hop:        d[21] & 0x1f,
+        SCA:        d[21] >> 5,
+    }
+
+    copy(params.ChannelMap[:], d[16:21])
+
+    return params, nil
+}
+
+// Encode the connection parameters as the LL data of a CONNECT_IND PDU.
+func (c *ConnParams) Bytes() []byte {
+    d := make([]byte, 22)
+
+    binary.LittleEndian.PutUint32(d, uint32(c.AccessAddr))
+
+    d[4] = uint8(c.CRCInit)
+    d[5] = uint8(c.CRCInit >> 8)
+    d[6] = uint8(c.CRCInit >> 16)
+    d[7] = c.WinSize
+
+    binary.LittleEndian.PutUint16(d[8:], c.WinOffset)
+    binary.LittleEndian.PutUint16(d[10:], c.Interval)
+    binary.LittleEndian.PutUint16(d[12:], c.Latency)
+    binary.LittleEndian.PutUint16(d[14:], c.Timeout)
+
+    copy(d[16:], c.ChannelMap[:])
+
+    d[21] = c.Hop & 0x1f | c.SCA << 5
+
+    return d
+}
@@ -0,0 +1,687 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+// Provides encoding and decoding for Bluetooth Low Energy link layer packets
+// (LINKTYPE_BLUETOOTH_LE_LL), optionally preceded by the RF information
+// pseudo-header (LINKTYPE_BLUETOOTH_LE_LL_WITH_PHDR), as captured by BLE
+// sniffers. Advertising channel PDUs are fully decoded by this layer, while
+// the payload of data channel PDUs starting an L2CAP frame is L2CAP.
+package ble
+
+import "fmt"
+import "net"
+import "strings"
+
+import "github.com/ghedo/go.pkt/packet"
+
+type Packet struct {
+    /* RF pseudo-header */
+    RF            bool          `string:"skip"`
+    Channel       uint8         `string:"ch"`
+    Signal        int8          `string:"signal"`
+    Noise         int8          `string:"noise"`
+    AAOffenses    uint8         `string:"aa_offenses"`
+    RefAccessAddr AccessAddr    `string:"ref_aa"`
+    RFFlags       RFFlags       `string:"rf_flags"`
+
+    AccessAddr    AccessAddr    `string:"aa"`
+
+    /* advertising channel PDUs */
+    PDUType       PDUType       `string:"skip"`
+    ChSel         bool          `string:"chsel"`
+    TxAdd         bool          `string:"txadd"`
+    RxAdd         bool          `string:"rxadd"`
+    AdvAddr       net.HardwareAddr `string:"adva"`
+    PeerAddr      net.HardwareAddr `string:"peer"`
+
+    /* data channel PDUs */
+    LLID          LLID          `string:"llid"`
+    NESN          bool          `string:"nesn"`
+    SN            bool          `string:"sn"`
+    MD            bool          `string:"md"`
+    CP            bool          `string:"cp"`
+    CTEInfo       uint8         `string:"cte"`
+    Control       ControlOpcode `string:"skip"`
+
+    Length        uint8         `string:"len"`
+    Data          []byte        `string:"skip"`
+    CRC           uint32        `string:"sum"`
+    CRCInit       uint32        `cmp:"skip" string:"skip"`
+    pdu_data      []byte        `cmp:"skip" string:"skip"`
+    pkt_payload   packet.Packet `cmp:"skip" string:"skip"`
+}
+
+// Access address. The advertising channel PDUs use the AdvAccessAddr address,
+// while each connection uses its own random address.
+type AccessAddr uint32
+
+const AdvAccessAddr AccessAddr = 0x8e89bed6
+
+// CRC initialization value of advertising channel PDUs.
+const AdvCRCInit uint32 = 0x555555
+
+// Flags of the RF information pseudo-header.
+type RFFlags uint16
+
+const (
+    Dewhitened        RFFlags = 0x0001
+    SignalValid               = 0x0002
+    NoiseValid                = 0x0004
+    Decrypted                 = 0x0008
+    RefAccessAddrValid        = 0x0010
+    AAOffensesValid           = 0x0020
+    ChannelAliased            = 0x0040
+    CRCChecked                = 0x0400
+    CRCValid                  = 0x0800
+    MICChecked                = 0x1000
+    MICValid                  = 0x2000
+)
+
+// Advertising channel PDU type.
+type PDUType uint8
+
+const (
+    AdvInd        PDUType = 0x0
+    AdvDirectInd          = 0x1
+    AdvNonconnInd         = 0x2
+    ScanReq               = 0x3
+    ScanRsp               = 0x4
+    ConnectInd            = 0x5
+    AdvScanInd            = 0x6
+    AdvExtInd             = 0x7
+)
+
+// Logical link identifier of data channel PDUs.
+type LLID uint8
+
+const (
+    LLIDContinuation LLID = 0x1
+    LLIDStart             = 0x2
+    LLIDControl           = 0x3
+)
+
+// LL control PDU opcode.
+type ControlOpcode uint8
+
+const (
+    ConnUpdateInd  ControlOpcode = 0x00
+    ChannelMapInd                = 0x01
+    TerminateInd                 = 0x02
+    EncReq                       = 0x03
+    EncRsp                       = 0x04
+    StartEncReq                  = 0x05
+    StartEncRsp                  = 0x06
+    UnknownRsp                   = 0x07
+    FeatureReq                   = 0x08
+    FeatureRsp                   = 0x09
+    PauseEncReq                  = 0x0a
+    PauseEncRsp                  = 0x0b
+    VersionInd                   = 0x0c
+    RejectInd                    = 0x0d
+    PeripheralFeatureReq         = 0x0e
+    ConnParamReq                 = 0x0f
+    ConnParamRsp                 = 0x10
+    RejectExtInd                 = 0x11
+    PingReq                      = 0x12
+    PingRsp                      = 0x13
+    LengthReq                    = 0x14
+    LengthRsp                    = 0x15
+    PHYReq                       = 0x16
+    PHYRsp                       = 0x17
+    PHYUpdateInd                 = 0x18
+)
+
+// Make a new advertising channel PDU.
+func Make() *Packet {
+    return &Packet{
+        AccessAddr: AdvAccessAddr,
+        PDUType: AdvInd,
+    }
+}
+
+// Make a new advertising channel PDU preceded by the RF information
+// pseudo-header. The channel is the RF channel number, that is the packet is
+// transmitted on 2402 + 2 * channel MHz.
+func MakeRF(channel uint8) *Packet {
+    return &Packet{
+        RF: true,
+        Channel: channel,
+        RFFlags: Dewhitened,
+        AccessAddr: AdvAccessAddr,
+        PDUType: AdvInd,
+    }
+}
+
+func (p *Packet) GetType() packet.Type {
+    if p.RF {
+        return packet.BLERF
+    }
+
+    return packet.BLE
+}
+
+func (p *Packet) GetLength() uint16 {
+    length := 4 + 2 + p.pdu_len() + 3
+
+    if p.RF {
+        length += 10
+    }
+
+    if p.IsData() && p.CP {
+        length += 1
+    }
+
+    return length
+}
+
+/* length of the PDU payload, including the layer payload */
+func (p *Packet) pdu_len() uint16 {
+    length := uint16(len(p.Data))
+
+    if p.IsAdvertising() {
+        length += uint16(len(p.AdvAddr) + len(p.PeerAddr))
+    } else if p.LLID == LLIDControl {
+        length += 1
+    }
+
+    if p.pkt_payload != nil {
+        length += p.pkt_payload.GetLength()
+    }
+
+    return length
+}
+
+func (p *Packet) Equals(other packet.Packet) bool {
+    return packet.Compare(p, other)
+}
+
+// Check if the packet is an answer to another packet. Scan responses answer
+// the scan requests sent to the same advertiser, LL control responses answer
+// the corresponding requests, and the other data channel PDUs are matched on
+// their payload.
+func (p *Packet) Answers(other packet.Packet) bool {
+    if other == nil || other.GetType() != p.GetType() {
+        return false
+    }
+
+    o := other.(*Packet)
+
+    if p.AccessAddr != o.AccessAddr {
+        return false
+    }
+
+    if p.IsAdvertising() {
+        return p.PDUType == ScanRsp && o.PDUType == ScanReq &&
+               p.AdvAddr.String() == o.AdvAddr.String()
+    }
+
+    if p.LLID == LLIDControl {
+        return o.LLID == LLIDControl && o.Control.Response() == p.Control
+    }
+
+    if p.Payload() != nil {
+        return p.Payload().Answers(other.Payload())
+    }
+
+    return false
+}
+
+func (p *Packet) Pack(buf *packet.Buffer) error {
+    if p.RF {
+        buf.WriteN(p.Channel)
+        buf.WriteN(p.Signal)
+        buf.WriteN(p.Noise)
+        buf.WriteN(p.AAOffenses)
+        buf.WriteL(p.RefAccessAddr)
+        buf.WriteL(p.RFFlags)
+    }
+
+    buf.WriteL(p.AccessAddr)
+
+    pdu_len := p.pdu_len()
+    if pdu_len > 255 {
+        return fmt.Errorf("Invalid PDU length %d", pdu_len)
+    }
+
+    p.Length = uint8(pdu_len)
+
+    pdu_off := buf.LayerLen()
+
+    var hdr uint8
+
+    if p.IsAdvertising() {
+        hdr = uint8(p.PDUType) & 0x0f |
+              bool_bit(p.ChSel, 5) | bool_bit(p.TxAdd, 6) |
+              bool_bit(p.RxAdd, 7)
+    } else {
+        hdr = uint8(p.LLID) & 0x03 |
+              bool_bit(p.NESN, 2) | bool_bit(p.SN, 3) |
+              bool_bit(p.MD, 4) | bool_bit(p.CP, 5)
+    }
+
+    buf.WriteN(hdr)
+    buf.WriteN(p.Length)
+
+    if p.IsData() && p.CP {
+        buf.WriteN(p.CTEInfo)
+    }
+
+    if p.IsAdvertising() {
+        switch p.PDUType {
+        case ScanReq, ConnectInd:
+            write_addr(buf, p.PeerAddr)
+            write_addr(buf, p.AdvAddr)
+
+        default:
+            write_addr(buf, p.AdvAddr)
+            write_addr(buf, p.PeerAddr)
+        }
+    } else if p.LLID == LLIDControl {
+        buf.WriteN(p.Control)
+    }
+
+    buf.Write(p.Data)
+
+    /*
+     * The payload has already been packed at the end of the buffer, so
+     * it needs to be moved before the CRC.
+     */
+    frame := buf.LayerBytes()[:p.GetLength()]
+
+    if p.pkt_payload != nil {
+        hdr_len := buf.LayerLen()
+        copy(frame[hdr_len:], frame[hdr_len + 3:])
+    }
+
+    pdu := frame[pdu_off:len(frame) - 3]
+
+    crc_init := p.CRCInit
+    if p.IsAdvertising() {
+        crc_init = AdvCRCInit
+    }
+
+    if crc_init != 0 {
+        p.CRC = CRC(pdu, crc_init)
+    }
+
+    put_crc(frame[len(frame) - 3:], p.CRC)
+
+    return nil
+}
+
+func (p *Packet) Unpack(buf *packet.Buffer) error {
+    if p.RF {
+        if buf.Len() < 10 {
+            return fmt.Errorf("Invalid RF header length %d", buf.Len())
+        }
+
+        buf.ReadN(&p.Channel)
+        buf.ReadN(&p.Signal)
+        buf.ReadN(&p.Noise)
+        buf.ReadN(&p.AAOffenses)
+        buf.ReadL(&p.RefAccessAddr)
+        buf.ReadL(&p.RFFlags)
+    }
+
+    if buf.Len() < 4 + 2 + 3 {
+        return fmt.Errorf("Invalid BLE packet length %d", buf.Len())
+    }
+
+    buf.ReadL(&p.AccessAddr)
+
+    pdu := buf.Bytes()
+
+    var hdr uint8
+    buf.ReadN(&hdr)
+    buf.ReadN(&p.Length)
+
+    pdu_len := int(p.Length)
+
+    /* the CTEInfo field is not counted in the PDU length */
+    if !p.IsAdvertising() && hdr & (1 << 5) != 0 {
+        pdu_len += 1
+    }
+
+    if buf.Len() < pdu_len + 3 {
+        return fmt.Errorf("Invalid PDU length %d", p.Length)
+    }
+
+    p.pdu_data = pdu[:2 + pdu_len]
+    p.CRC      = get_crc(buf.Bytes()[pdu_len:])
+
+    buf.Truncate(pdu_len)
+
+    p.AdvAddr  = nil
+    p.PeerAddr = nil
+    p.Data     = nil
+
+    if p.IsAdvertising() {
+        p.PDUType = PDUType(hdr & 0x0f)
+        p.ChSel   = hdr & (1 << 5) != 0
+        p.TxAdd   = hdr & (1 << 6) != 0
+        p.RxAdd   = hdr & (1 << 7) != 0
+
+        switch p.PDUType {
+        case AdvInd, AdvNonconnInd, AdvScanInd, ScanRsp:
+            p.AdvAddr = read_addr(buf)
+
+        case AdvDirectInd:
+            p.AdvAddr  = read_addr(buf)
+            p.PeerAddr = read_addr(buf)
+
+        case ScanReq, ConnectInd:
+            p.PeerAddr = read_addr(buf)
+            p.AdvAddr  = read_addr(buf)
+        }
+
+        if p.PDUType == ConnectInd && buf.Len() != 22 {
+            return fmt.Errorf("Invalid LL data length %d", buf.Len())
+        }
+
+        if buf.Len() > 0 {
+            p.Data = buf.Next(buf.Len())
+        }
+
+        return nil
+    }
+
+    p.LLID = LLID(hdr & 0x03)
+    p.NESN = hdr & (1 << 2) != 0
+    p.SN   = hdr & (1 << 3) != 0
+    p.MD   = hdr & (1 << 4) != 0
+    p.CP   = hdr & (1 << 5) != 0
+
+    if p.CP {
+        buf.ReadN(&p.CTEInfo)
+    }
+
+    if p.LLID == LLIDControl {
+        if buf.Len() < 1 {
+            return fmt.Errorf("Invalid LL control PDU length")
+        }
+
+        buf.ReadN(&p.Control)
+
+        if buf.Len() > 0 {
+            p.Data = buf.Next(buf.Len())
+        }
+    }
+
+    return nil
+}
+
+func (p *Packet) Payload() packet.Packet {
+    return p.pkt_payload
+}
+
+func (p *Packet) GuessPayloadType() packet.Type {
+    if p.IsAdvertising() || p.LLID == LLIDControl {
+        return packet.None
+    }
+
+    if p.LLID == LLIDStart {
+        return packet.L2CAP
+    }
+
+    return packet.Raw
+}
+
+func (p *Packet) SetPayload(pl packet.Packet) error {
+    p.pkt_payload = pl
+
+    if pl.GetType() == packet.L2CAP {
+        p.LLID = LLIDStart
+    }
+
+    return nil
+}
+
+func (p *Packet) InitChecksum(csum uint32) {
+}
+
+// Return the string representation of the packet. The PDU type is only shown
+// for advertising channel PDUs, and the opcode for LL control PDUs.
+func (p *Packet) String() string {
+    var pdu string
+
+    switch {
+    case p.IsAdvertising():
+        pdu = p.PDUType.String()
+
+    case p.LLID == LLIDControl:
+        pdu = p.Control.String()
+    }
+
+    s := packet.Stringify(p)
+
+    if pdu != "" {
+        name := strings.ToLower(p.GetType().String()) + "("
+        s = strings.Replace(s, name, name + "pdu=" + pdu + ", ", 1)
+    }
+
+    return s
+}
+
+// Return whether the packet is an advertising channel PDU.
+func (p *Packet) IsAdvertising() bool {
+    return p.AccessAddr == AdvAccessAddr
+}
+
+// Return whether the packet is a data channel PDU.
+func (p *Packet) IsData() bool {
+    return !p.IsAdvertising()
+}
+
+// Verify the CRC of a decoded packet. Advertising channel PDUs always use the
+// AdvCRCInit value, while data channel PDUs use the CRC initialization value
+// of their connection (see ConnParams).
+func (p *Packet) ValidCRC(crc_init uint32) bool {
+    if p.pdu_data == nil {
+        return false
+    }
+
+    if p.IsAdvertising() {
+        crc_init = AdvCRCInit
+    }
+
+    return CRC(p.pdu_data, crc_init) == p.CRC
+}
+
+// Compute the 24-bit CRC of the given PDU (header and payload). The returned
+// value has the first transmitted bit in its most significant bit.
+func CRC(pdu []byte, crc_init uint32) uint32 {
+    state := crc_init & 0xffffff
+
+    for _, b := range pdu {
+        for i := uint(0); i < 8; i++ {
+            bit := uint32(b >> i) & 1
+            fb  := (state >> 23) ^ bit
+
+            state = (state << 1) & 0xffffff
+
+            if fb != 0 {
+                state ^= 0x00065b
+            }
+        }
+    }
+
+    return state
+}
+
+/* the CRC is transmitted most significant bit first */
+func put_crc(buf []byte, crc uint32) {
+    for i := 0; i < 3; i++ {
+        buf[i] = reverse_bits(uint8(crc >> uint(16 - 8 * i)))
+    }
+}
+
+func get_crc(buf []byte) uint32 {
+    var crc uint32
+
+    for i := 0; i < 3; i++ {
+        crc = crc << 8 | uint32(reverse_bits(buf[i]))
+    }
+
+    return crc
+}
+
+func reverse_bits(b uint8) uint8 {
+    var r uint8
+
+    for i := uint(0); i < 8; i++ {
+        r |= ((b >> i) & 1) << (7 - i)
+    }
+
+    return r
+}
+
+func bool_bit(b bool, bit uint) uint8 {
+    if b {
+        return 1 << bit
+    }
+
+    return 0
+}
+
+/* device addresses are transmitted least significant byte first */
+func write_addr(buf *packet.Buffer, addr net.HardwareAddr) {
+    for i := len(addr) - 1; i >= 0; i-- {
+        buf.WriteN(addr[i])
+    }
+}
+
+func read_addr(buf *packet.Buffer) net.HardwareAddr {
+    if buf.Len() < 6 {
+        return nil
+    }
+
+    data := buf.Next(6)
+    addr := make(net.HardwareAddr, 6)
+
+    for i := range data {
+        addr[5 - i] = data[i]
+    }
+
+    return addr
+}
+
+var control_to_response_map = map[ControlOpcode]ControlOpcode{
+    EncReq:               EncRsp,
+    StartEncReq:          StartEncRsp,
+    FeatureReq:           FeatureRsp,
+    PauseEncReq:          PauseEncRsp,
+    VersionInd:           VersionInd,
+    PeripheralFeatureReq: FeatureRsp,
+    ConnParamReq:         ConnParamRsp,
+    PingReq:              PingRsp,
+    LengthReq:            LengthRsp,
+    PHYReq:               PHYRsp,
+}
+
+// Return the opcode of the response to the given LL control request, or
+// UnknownRsp if the opcode doesn't expect one.
+func (o ControlOpcode) Response() ControlOpcode {
+    if rsp, ok := control_to_response_map[o]; ok {
+        return rsp
+    }
+
+    return UnknownRsp
+}
+
+func (a AccessAddr) String() string {
+    if a == 0 {
+        return ""
+    }
+
+    return fmt.Sprintf("0x%08x", uint32(a))
+}
+
+func (f RFFlags) String() string {
+    if f == 0 {
+        return ""
+    }
+
+    return fmt.Sprintf("0x%04x", uint16(f))
+}
+
+func (t PDUType) String() string {
+    switch t {
+    case AdvInd:        return "adv_ind"
+    case AdvDirectInd:  return "adv_direct_ind"
+    case AdvNonconnInd: return "adv_nonconn_ind"
+    case ScanReq:       return "scan_req"
+    case ScanRsp:       return "scan_rsp"
+    case ConnectInd:    return "connect_ind"
+    case AdvScanInd:    return "adv_scan_ind"
+    case AdvExtInd:     return "adv_ext_ind"
+    default:            return fmt.Sprintf("0x%x", uint8(t))
+    }
+}
+
+func (l LLID) String() string {
+    switch l {
+    case 0:                return ""
+    case LLIDContinuation: return "continuation"
+    case LLIDStart:        return "start"
+    case LLIDControl:      return "control"
+    default:               return fmt.Sprintf("%d", uint8(l))
+    }
+}
+
+func (o ControlOpcode) String() string {
+    switch o {
+    case ConnUpdateInd:        return "conn_update_ind"
+    case ChannelMapInd:        return "channel_map_ind"
+    case TerminateInd:         return "terminate_ind"
+    case EncReq:               return "enc_req"
+    case EncRsp:               return "enc_rsp"
+    case StartEncReq:          return "start_enc_req"
+    case StartEncRsp:          return "start_enc_rsp"
+    case UnknownRsp:           return "unknown_rsp"
+    case FeatureReq:           return "feature_req"
+    case FeatureRsp:           return "feature_rsp"
+    case PauseEncReq:          return "pause_enc_req"
+    case PauseEncRsp:          return "pause_enc_rsp"
+    case VersionInd:           return "version_ind"
+    case RejectInd:            return "reject_ind"
+    case PeripheralFeatureReq: return "peripheral_feature_req"
+    case ConnParamReq:         return "conn_param_req"
+    case ConnParamRsp:         return "conn_param_rsp"
+    case RejectExtInd:         return "reject_ext_ind"
+    case PingReq:              return "ping_req"
+    case PingRsp:              return "ping_rsp"
+    case LengthReq:            return "length_req"
+    case LengthRsp:            return "length_rsp"
+    case PHYReq:               return "phy_req"
+    case PHYRsp:               return "phy_rsp"
+    case PHYUpdateInd:         return "phy_update_ind"
+    default:                   return fmt.Sprintf("0x%x", uint8(o))
+    }
+}
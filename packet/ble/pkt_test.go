@@ -0,0 +1,225 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package ble_test
+
+import "bytes"
+import "net"
+import "testing"
+
+import "github.com/ghedo/go.pkt/layers"
+import "github.com/ghedo/go.pkt/packet"
+import "github.com/ghedo/go.pkt/packet/att"
+import "github.com/ghedo/go.pkt/packet/ble"
+import "github.com/ghedo/go.pkt/packet/l2cap"
+
+var test_simple = []byte{
+    0xd6, 0xbe, 0x89, 0x8e, 0x40, 0x0d, 0x55, 0x44, 0x33, 0x22, 0x11, 0x00,
+    0x02, 0x01, 0x06, 0x03, 0x09, 0x67, 0x6f, 0xd5, 0x27, 0xd7,
+}
+
+var test_addr, _ = net.ParseMAC("00:11:22:33:44:55")
+
+func MakeTestSimple() *ble.Packet {
+    return &ble.Packet{
+        AccessAddr: ble.AdvAccessAddr,
+        PDUType: ble.AdvInd,
+        TxAdd: true,
+        Length: 13,
+        AdvAddr: test_addr,
+        Data: []byte{ 0x02, 0x01, 0x06, 0x03, 0x09, 0x67, 0x6f },
+        CRC: 0xabe4eb,
+    }
+}
+
+func TestPack(t *testing.T) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_simple)))
+
+    p := MakeTestSimple()
+    p.CRC = 0
+
+    err := p.Pack(&b)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if !bytes.Equal(test_simple, b.Buffer()) {
+        t.Fatalf("Raw packet mismatch: %x", b.Buffer())
+    }
+}
+
+func BenchmarkPack(bn *testing.B) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_simple)))
+
+    p := MakeTestSimple()
+
+    for n := 0; n < bn.N; n++ {
+        p.Pack(&b)
+    }
+}
+
+func TestUnpack(t *testing.T) {
+    var p ble.Packet
+
+    cmp := MakeTestSimple()
+
+    var b packet.Buffer
+    b.Init(test_simple)
+
+    err := p.Unpack(&b)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if !p.Equals(cmp) {
+        t.Fatalf("Packet mismatch:\n%s\n%s", &p, cmp)
+    }
+
+    if !p.ValidCRC(0) {
+        t.Fatalf("CRC mismatch: %x", p.CRC)
+    }
+
+    if p.LocalName() != "go" {
+        t.Fatalf("Name mismatch: %s", p.LocalName())
+    }
+}
+
+func BenchmarkUnpack(bn *testing.B) {
+    var p ble.Packet
+    var b packet.Buffer
+
+    for n := 0; n < bn.N; n++ {
+        b.Init(test_simple)
+        p.Unpack(&b)
+    }
+}
+
+var test_rf = append([]byte{
+    0x0c, 0xc4, 0xa6, 0x00, 0xd6, 0xbe, 0x89, 0x8e, 0x13, 0x08,
+}, test_simple...)
+
+func TestUnpackRF(t *testing.T) {
+    p, err := layers.UnpackAll(test_rf, packet.LinkType(256))
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    ble_pkt := p.(*ble.Packet)
+
+    if ble_pkt.GetType() != packet.BLERF || ble_pkt.Channel != 12 ||
+       ble_pkt.Signal != -60 || ble_pkt.Noise != -90 ||
+       ble_pkt.RFFlags & ble.CRCValid == 0 ||
+       ble_pkt.AdvAddr.String() != test_addr.String() {
+        t.Fatalf("Packet mismatch: %s", p)
+    }
+
+    buf, err := layers.Pack(p)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if !bytes.Equal(buf, test_rf) {
+        t.Fatalf("Raw packet mismatch: %x", buf)
+    }
+}
+
+var test_data = []byte{
+    0x78, 0x56, 0x34, 0x12, 0x02, 0x07, 0x03, 0x00, 0x04, 0x00, 0x0a, 0x03,
+    0x00, 0x97, 0xbf, 0xa6,
+}
+
+func TestData(t *testing.T) {
+    params := &ble.ConnParams{
+        AccessAddr: 0x12345678,
+        CRCInit: 0x123456,
+        WinSize: 2,
+        Interval: 24,
+        Timeout: 72,
+        ChannelMap: [5]byte{ 0xff, 0xff, 0xff, 0xff, 0x1f },
+        Hop: 7,
+        SCA: 1,
+    }
+
+    connect_pkt := ble.Make()
+    connect_pkt.PDUType  = ble.ConnectInd
+    connect_pkt.AdvAddr  = test_addr
+    connect_pkt.PeerAddr = test_addr
+    connect_pkt.Data     = params.Bytes()
+
+    buf, err := layers.Pack(connect_pkt)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    p, err := layers.UnpackAll(buf, packet.BLE)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    conn, err := p.(*ble.Packet).ConnParams()
+    if err != nil || *conn != *params {
+        t.Fatalf("Connection parameters mismatch: %v", conn)
+    }
+
+    data_pkt := &ble.Packet{
+        AccessAddr: conn.AccessAddr,
+        CRCInit: conn.CRCInit,
+    }
+
+    l2cap_pkt := l2cap.Make()
+
+    att_pkt := att.Make()
+    att_pkt.Handle = 3
+
+    buf, err = layers.Pack(data_pkt, l2cap_pkt, att_pkt)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if !bytes.Equal(buf, test_data) {
+        t.Fatalf("Raw packet mismatch: %x", buf)
+    }
+
+    p, err = layers.UnpackAll(buf, packet.BLE)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if !p.(*ble.Packet).ValidCRC(conn.CRCInit) {
+        t.Fatalf("CRC mismatch: %s", p)
+    }
+
+    l := layers.FindLayer(p, packet.ATT)
+    if l == nil || !l.Equals(att_pkt) {
+        t.Fatalf("Packet mismatch: %s", p)
+    }
+}
@@ -66,6 +66,16 @@ func (b *Buffer) Len() int {
     return len(b.buf) - b.off
 }
 
+// Discard all but the first n unread bytes from the buffer. This can be used
+// to strip trailers (e.g. checksums) before the payload is decoded.
+func (b *Buffer) Truncate(n int) {
+    if n < 0 || n > b.Len() {
+        return
+    }
+
+    b.buf = b.buf[:b.off + n]
+}
+
 // Manually set the buffer offset to off.
 func (b *Buffer) SetOffset(off int) {
     b.off = off
@@ -0,0 +1,435 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+// Provides encoding and decoding for CDP (Cisco Discovery Protocol) packets.
+package cdp
+
+import "bytes"
+import "fmt"
+import "net"
+import "strings"
+
+import "github.com/ghedo/go.pkt/packet"
+import "github.com/ghedo/go.pkt/packet/ipv4"
+
+type Packet struct {
+    Version   uint8    `string:"ver"`
+    TTL       uint8    `string:"ttl"`
+    Checksum  uint16   `cmp:"skip" string:"sum"`
+    TLVs      []TLV    `string:"skip"`
+
+    csum_data []byte   `cmp:"skip" string:"skip"`
+}
+
+// TLV is a field of a CDP packet. TLVs are stored undecoded so that packets can
+// be encoded back unchanged, use the accessor methods of Packet to get their
+// typed representation.
+type TLV struct {
+    Type  TLVType
+    Value []byte
+}
+
+type TLVType uint16
+
+const (
+    DeviceID         TLVType = 0x0001
+    Addresses                = 0x0002
+    PortID                   = 0x0003
+    Capabilities             = 0x0004
+    SoftwareVersion          = 0x0005
+    Platform                 = 0x0006
+    IPPrefixes               = 0x0007
+    VTPDomain                = 0x0009
+    NativeVLAN               = 0x000a
+    Duplex                   = 0x000b
+    PowerConsumption         = 0x0010
+    SystemName               = 0x0014
+    MgmtAddresses            = 0x0016
+)
+
+type Capability uint32
+
+const (
+    CapRouter            Capability = 0x0001
+    CapTransBridge                  = 0x0002
+    CapSourceRouteBridge            = 0x0004
+    CapSwitch                       = 0x0008
+    CapHost                         = 0x0010
+    CapIGMP                         = 0x0020
+    CapRepeater                     = 0x0040
+    CapPhone                        = 0x0080
+)
+
+// Make a new CDPv2 packet with the default TTL.
+func Make() *Packet {
+    return &Packet{
+        Version: 2,
+        TTL: 180,
+    }
+}
+
+func (p *Packet) GetType() packet.Type {
+    return packet.CDP
+}
+
+func (p *Packet) GetLength() uint16 {
+    length := 4
+
+    for _, t := range p.TLVs {
+        length += 4 + len(t.Value)
+    }
+
+    return uint16(length)
+}
+
+func (p *Packet) Equals(other packet.Packet) bool {
+    return packet.Compare(p, other)
+}
+
+func (p *Packet) Answers(other packet.Packet) bool {
+    return false
+}
+
+func (p *Packet) Pack(buf *packet.Buffer) error {
+    buf.WriteN(p.Version)
+    buf.WriteN(p.TTL)
+    buf.WriteN(uint16(0x00))
+
+    for _, t := range p.TLVs {
+        if len(t.Value) > 0xffff - 4 {
+            return fmt.Errorf("Invalid TLV length %d", len(t.Value))
+        }
+
+        buf.WriteN(t.Type)
+        buf.WriteN(uint16(4 + len(t.Value)))
+        buf.Write(t.Value)
+    }
+
+    p.csum_data = buf.LayerBytes()[:p.GetLength()]
+    p.Checksum  = checksum(p.csum_data)
+
+    buf.PutUint16N(2, p.Checksum)
+
+    return nil
+}
+
+func (p *Packet) Unpack(buf *packet.Buffer) error {
+    data := buf.LayerBytes()
+
+    buf.ReadN(&p.Version)
+    buf.ReadN(&p.TTL)
+    buf.ReadN(&p.Checksum)
+
+    p.TLVs = nil
+
+    for buf.Len() >= 4 {
+        var t TLV
+        var length uint16
+
+        buf.ReadN(&t.Type)
+        buf.ReadN(&length)
+
+        if length < 4 || buf.Len() < int(length) - 4 {
+            return fmt.Errorf("Invalid TLV length %d", length)
+        }
+
+        t.Value = buf.Next(int(length) - 4)
+
+        p.TLVs = append(p.TLVs, t)
+    }
+
+    p.csum_data = data[:buf.LayerLen()]
+
+    return nil
+}
+
+func (p *Packet) Payload() packet.Packet {
+    return nil
+}
+
+func (p *Packet) GuessPayloadType() packet.Type {
+    return packet.None
+}
+
+func (p *Packet) SetPayload(pl packet.Packet) error {
+    return nil
+}
+
+func (p *Packet) InitChecksum(csum uint32) {
+}
+
+func (p *Packet) String() string {
+    return packet.Stringify(p)
+}
+
+// Return whether the checksum of an encoded or decoded packet is valid.
+func (p *Packet) ValidChecksum() bool {
+    if p.csum_data == nil {
+        return false
+    }
+
+    return checksum(p.csum_data) == 0
+}
+
+/*
+ * CDP uses the IP checksum, except that the last byte of odd length packets is
+ * summed as the low (instead of the high) byte of the last 16-bit word.
+ */
+func checksum(data []byte) uint16 {
+    var csum uint32
+
+    n := len(data) &^ 1
+
+    if n != len(data) {
+        csum = uint32(data[n])
+    }
+
+    return ipv4.CalculateChecksum(data[:n], csum)
+}
+
+// Return the first TLV of the given type, or nil.
+func (p *Packet) FindTLV(t TLVType) *TLV {
+    for i := range p.TLVs {
+        if p.TLVs[i].Type == t {
+            return &p.TLVs[i]
+        }
+    }
+
+    return nil
+}
+
+func (p *Packet) find_string(t TLVType) (string, bool) {
+    tlv := p.FindTLV(t)
+    if tlv == nil {
+        return "", false
+    }
+
+    return string(tlv.Value), true
+}
+
+// Return the device ID advertised in the packet, if any.
+func (p *Packet) DeviceID() (string, bool) {
+    return p.find_string(DeviceID)
+}
+
+// Return the port ID advertised in the packet, if any.
+func (p *Packet) PortID() (string, bool) {
+    return p.find_string(PortID)
+}
+
+// Return the software version advertised in the packet, if any.
+func (p *Packet) SoftwareVersion() (string, bool) {
+    return p.find_string(SoftwareVersion)
+}
+
+// Return the platform advertised in the packet, if any.
+func (p *Packet) Platform() (string, bool) {
+    return p.find_string(Platform)
+}
+
+// Return the VTP management domain advertised in the packet, if any.
+func (p *Packet) VTPDomain() (string, bool) {
+    return p.find_string(VTPDomain)
+}
+
+// Return the system name advertised in the packet, if any.
+func (p *Packet) SystemName() (string, bool) {
+    return p.find_string(SystemName)
+}
+
+// Return the capabilities advertised in the packet.
+func (p *Packet) Capabilities() Capability {
+    tlv := p.FindTLV(Capabilities)
+    if tlv == nil || len(tlv.Value) != 4 {
+        return 0
+    }
+
+    return Capability(uint32(tlv.Value[0]) << 24 |
+                      uint32(tlv.Value[1]) << 16 |
+                      uint32(tlv.Value[2]) << 8 | uint32(tlv.Value[3]))
+}
+
+// Return the native VLAN advertised in the packet, if any.
+func (p *Packet) NativeVLAN() (uint16, bool) {
+    tlv := p.FindTLV(NativeVLAN)
+    if tlv == nil || len(tlv.Value) != 2 {
+        return 0, false
+    }
+
+    return uint16(tlv.Value[0]) << 8 | uint16(tlv.Value[1]), true
+}
+
+// Return the duplex mode advertised in the packet, if any.
+func (p *Packet) FullDuplex() (bool, bool) {
+    tlv := p.FindTLV(Duplex)
+    if tlv == nil || len(tlv.Value) != 1 {
+        return false, false
+    }
+
+    return tlv.Value[0] == 1, true
+}
+
+// Return the interface addresses advertised in the packet.
+func (p *Packet) Addresses() []net.IP {
+    tlv := p.FindTLV(Addresses)
+    if tlv == nil {
+        return nil
+    }
+
+    addrs, _ := ParseAddresses(tlv.Value)
+    return addrs
+}
+
+// Return the management addresses advertised in the packet.
+func (p *Packet) MgmtAddresses() []net.IP {
+    tlv := p.FindTLV(MgmtAddresses)
+    if tlv == nil {
+        return nil
+    }
+
+    addrs, _ := ParseAddresses(tlv.Value)
+    return addrs
+}
+
+var ipv6_proto = []byte{ 0xaa, 0xaa, 0x03, 0x00, 0x00, 0x00, 0x86, 0xdd }
+
+// Parse the body of an addresses TLV. Only IPv4 (NLPID) and IPv6 (802.2)
+// addresses are returned, other protocols are skipped.
+func ParseAddresses(data []byte) ([]net.IP, error) {
+    var b packet.Buffer
+    b.Init(data)
+
+    var count uint32
+    var addrs []net.IP
+
+    if b.Len() < 4 {
+        return nil, fmt.Errorf("Invalid addresses TLV")
+    }
+
+    b.ReadN(&count)
+
+    for i := 0; i < int(count); i++ {
+        var proto_type, proto_len uint8
+        var addr_len uint16
+
+        if b.Len() < 2 {
+            return addrs, fmt.Errorf("Invalid addresses TLV")
+        }
+
+        b.ReadN(&proto_type)
+        b.ReadN(&proto_len)
+
+        if b.Len() < int(proto_len) + 2 {
+            return addrs, fmt.Errorf("Invalid addresses TLV")
+        }
+
+        proto := b.Next(int(proto_len))
+        b.ReadN(&addr_len)
+
+        if b.Len() < int(addr_len) {
+            return addrs, fmt.Errorf("Invalid addresses TLV")
+        }
+
+        addr := b.Next(int(addr_len))
+
+        switch {
+        case proto_type == 1 && bytes.Equal(proto, []byte{ 0xcc }) &&
+             addr_len == 4:
+            addrs = append(addrs, net.IP(addr))
+
+        case proto_type == 2 && bytes.Equal(proto, ipv6_proto) &&
+             addr_len == 16:
+            addrs = append(addrs, net.IP(addr))
+        }
+    }
+
+    return addrs, nil
+}
+
+// Encode the given IPv4 and IPv6 addresses as the body of an addresses TLV.
+func MakeAddresses(addrs []net.IP) []byte {
+    var data []byte
+
+    data = append(data, 0, 0, 0, uint8(len(addrs)))
+
+    for _, addr := range addrs {
+        if ip4 := addr.To4(); ip4 != nil {
+            data = append(data, 1, 1, 0xcc, 0, 4)
+            data = append(data, ip4...)
+        } else {
+            data = append(data, 2, uint8(len(ipv6_proto)))
+            data = append(data, ipv6_proto...)
+            data = append(data, 0, 16)
+            data = append(data, addr.To16()...)
+        }
+    }
+
+    return data
+}
+
+func (t TLV) Equal(other TLV) bool {
+    return t.Type == other.Type && bytes.Equal(t.Value, other.Value)
+}
+
+func (t TLVType) String() string {
+    switch t {
+    case DeviceID:         return "device-id"
+    case Addresses:        return "addresses"
+    case PortID:           return "port-id"
+    case Capabilities:     return "capabilities"
+    case SoftwareVersion:  return "software-version"
+    case Platform:         return "platform"
+    case IPPrefixes:       return "ip-prefixes"
+    case VTPDomain:        return "vtp-domain"
+    case NativeVLAN:       return "native-vlan"
+    case Duplex:           return "duplex"
+    case PowerConsumption: return "power-consumption"
+    case SystemName:       return "system-name"
+    case MgmtAddresses:    return "mgmt-addresses"
+    default:               return fmt.Sprintf("0x%x", uint16(t))
+    }
+}
+
+func (c Capability) String() string {
+    var caps []string
+
+    names := []string{
+        "router", "trans-bridge", "source-route-bridge", "switch", "host",
+        "igmp", "repeater", "phone",
+    }
+
+    for i, name := range names {
+        if c & (1 << uint(i)) != 0 {
+            caps = append(caps, name)
+        }
+    }
+
+    return strings.Join(caps, "|")
+}
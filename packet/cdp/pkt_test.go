@@ -0,0 +1,174 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package cdp_test
+
+import "bytes"
+import "net"
+import "testing"
+
+import "github.com/ghedo/go.pkt/layers"
+import "github.com/ghedo/go.pkt/packet"
+import "github.com/ghedo/go.pkt/packet/cdp"
+import "github.com/ghedo/go.pkt/packet/eth"
+import "github.com/ghedo/go.pkt/packet/llc"
+import "github.com/ghedo/go.pkt/packet/snap"
+
+var test_simple = []byte{
+    0x02, 0xb4, 0xae, 0xd7, 0x00, 0x01, 0x00, 0x07, 0x73, 0x77, 0x32, 0x00,
+    0x03, 0x00, 0x09, 0x47, 0x69, 0x30, 0x2f, 0x32, 0x00, 0x06, 0x00, 0x12,
+    0x63, 0x69, 0x73, 0x63, 0x6f, 0x20, 0x57, 0x53, 0x2d, 0x43, 0x32, 0x39,
+    0x36, 0x30, 0x00, 0x0a, 0x00, 0x06, 0x00, 0x14, 0x00, 0x02, 0x00, 0x11,
+    0x00, 0x00, 0x00, 0x01, 0x01, 0x01, 0xcc, 0x00, 0x04, 0x0a, 0x00, 0x00,
+    0x02,
+}
+
+func MakeTestSimple() *cdp.Packet {
+    return &cdp.Packet{
+        Version: 2,
+        TTL: 180,
+        TLVs: []cdp.TLV{
+            { Type: cdp.DeviceID, Value: []byte("sw2") },
+            { Type: cdp.PortID, Value: []byte("Gi0/2") },
+            { Type: cdp.Platform, Value: []byte("cisco WS-C2960") },
+            { Type: cdp.NativeVLAN, Value: []byte{ 0x00, 0x14 } },
+            {
+                Type: cdp.Addresses,
+                Value: cdp.MakeAddresses([]net.IP{ net.ParseIP("10.0.0.2") }),
+            },
+        },
+    }
+}
+
+func TestPack(t *testing.T) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_simple)))
+
+    p := MakeTestSimple()
+
+    err := p.Pack(&b)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if !bytes.Equal(test_simple, b.Buffer()) {
+        t.Fatalf("Raw packet mismatch: %x", b.Buffer())
+    }
+}
+
+func BenchmarkPack(bn *testing.B) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_simple)))
+
+    p := MakeTestSimple()
+
+    for n := 0; n < bn.N; n++ {
+        p.Pack(&b)
+    }
+}
+
+func TestUnpack(t *testing.T) {
+    var p cdp.Packet
+
+    cmp := MakeTestSimple()
+
+    var b packet.Buffer
+    b.Init(test_simple)
+
+    err := p.Unpack(&b)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if !p.Equals(cmp) {
+        t.Fatalf("Packet mismatch:\n%s\n%s", &p, cmp)
+    }
+
+    if !p.ValidChecksum() {
+        t.Fatalf("Invalid checksum: 0x%x", p.Checksum)
+    }
+
+    if id, _ := p.DeviceID(); id != "sw2" {
+        t.Fatalf("Device ID mismatch: %s", id)
+    }
+
+    if vlan, _ := p.NativeVLAN(); vlan != 20 {
+        t.Fatalf("Native VLAN mismatch: %d", vlan)
+    }
+
+    addrs := p.Addresses()
+    if len(addrs) != 1 || !addrs[0].Equal(net.ParseIP("10.0.0.2")) {
+        t.Fatalf("Addresses mismatch: %v", addrs)
+    }
+}
+
+func BenchmarkUnpack(bn *testing.B) {
+    var p cdp.Packet
+    var b packet.Buffer
+
+    for n := 0; n < bn.N; n++ {
+        b.Init(test_simple)
+        p.Unpack(&b)
+    }
+}
+
+func TestSNAP(t *testing.T) {
+    eth_pkt := eth.Make()
+    eth_pkt.SrcAddr, _ = net.ParseMAC("00:aa:bb:cc:dd:ee")
+    eth_pkt.DstAddr, _ = net.ParseMAC("01:00:0c:cc:cc:cc")
+
+    llc_pkt := llc.Make()
+    llc_pkt.Control = 0x03
+
+    snap_pkt := snap.Make()
+
+    cdp_pkt := MakeTestSimple()
+
+    buf, err := layers.Pack(eth_pkt, llc_pkt, snap_pkt, cdp_pkt)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    hdr := []byte{ 0x00, 0x45, 0xaa, 0xaa, 0x03, 0x00, 0x00, 0x0c, 0x20, 0x00 }
+
+    if !bytes.Equal(buf[12:22], hdr) {
+        t.Fatalf("Raw header mismatch: %x", buf[12:22])
+    }
+
+    p, err := layers.UnpackAll(buf, packet.Eth)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    l := layers.FindLayer(p, packet.CDP)
+    if l == nil || !l.Equals(cdp_pkt) {
+        t.Fatalf("Packet mismatch:\n%s\n%s", p, cdp_pkt)
+    }
+}
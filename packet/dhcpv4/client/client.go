@@ -0,0 +1,245 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+// Provides a minimal DHCPv4 client that performs the DORA (discover, offer,
+// request, ack) exchange on a capture handle. It's meant for testing DHCP
+// servers, so the acquired lease is only reported and never applied to the
+// network interface.
+package client
+
+import "crypto/rand"
+import "encoding/binary"
+import "fmt"
+import "net"
+import "time"
+
+import "github.com/ghedo/go.pkt/capture"
+import "github.com/ghedo/go.pkt/layers"
+import "github.com/ghedo/go.pkt/network"
+import "github.com/ghedo/go.pkt/packet"
+import "github.com/ghedo/go.pkt/packet/dhcpv4"
+import "github.com/ghedo/go.pkt/packet/eth"
+import "github.com/ghedo/go.pkt/packet/ipv4"
+import "github.com/ghedo/go.pkt/packet/udp"
+
+// Client holds the parameters of the exchange. The transaction ID is chosen
+// randomly by New(), and the timeout applies to each answer.
+type Client struct {
+    HWAddr   net.HardwareAddr
+    HostName string
+    Xid      uint32
+    Params   []dhcpv4.OptionCode
+    Timeout  time.Duration
+    handle   capture.Handle
+}
+
+// Lease describes the configuration acknowledged by the server.
+type Lease struct {
+    Addr     net.IP
+    Mask     net.IPMask
+    Server   net.IP
+    Routers  []net.IP
+    DNS      []net.IP
+    Duration time.Duration
+    Offer    *dhcpv4.Packet
+    Ack      *dhcpv4.Packet
+}
+
+// Create a new client for the given capture handle, which must be either an
+// Ethernet or an IPv4 one.
+func New(c capture.Handle, hwaddr net.HardwareAddr) *Client {
+    var xid uint32
+    binary.Read(rand.Reader, binary.BigEndian, &xid)
+
+    return &Client{
+        HWAddr: hwaddr,
+        Xid: xid,
+        Params: []dhcpv4.OptionCode{
+            dhcpv4.SubnetMask, dhcpv4.Router, dhcpv4.DNSServer,
+            dhcpv4.DomainName, dhcpv4.LeaseTime,
+        },
+        Timeout: 5 * time.Second,
+        handle: c,
+    }
+}
+
+// Perform the whole DORA exchange, accepting the first offer received.
+func (c *Client) Run() (*Lease, error) {
+    offer, err := c.Discover()
+    if err != nil {
+        return nil, err
+    }
+
+    ack, err := c.Request(offer)
+    if err != nil {
+        return nil, err
+    }
+
+    return &Lease{
+        Addr:     ack.YourAddr,
+        Mask:     ack.SubnetMask(),
+        Server:   ack.OptionIP(dhcpv4.ServerID),
+        Routers:  ack.OptionIPs(dhcpv4.Router),
+        DNS:      ack.OptionIPs(dhcpv4.DNSServer),
+        Duration: ack.OptionDuration(dhcpv4.LeaseTime),
+        Offer:    offer,
+        Ack:      ack,
+    }, nil
+}
+
+// Broadcast a discover message and wait for an offer.
+func (c *Client) Discover() (*dhcpv4.Packet, error) {
+    return c.send_recv(c.make_msg(dhcpv4.Discover))
+}
+
+// Request the address of the given offer and wait for the server's ack. A nak
+// is returned as an error.
+func (c *Client) Request(offer *dhcpv4.Packet) (*dhcpv4.Packet, error) {
+    req := c.make_msg(dhcpv4.Request)
+    req.SetOption(dhcpv4.RequestedIP, dhcpv4.MakeIPs(offer.YourAddr))
+
+    if server := offer.FindOption(dhcpv4.ServerID); server != nil {
+        req.SetOption(dhcpv4.ServerID, server)
+    }
+
+    ack, err := c.send_recv(req)
+    if err != nil {
+        return nil, err
+    }
+
+    if ack.MessageType() == dhcpv4.Nak {
+        return nil, fmt.Errorf("Request refused: %s",
+                               ack.FindOption(dhcpv4.MessageText))
+    }
+
+    return ack, nil
+}
+
+// Release the given lease. No answer is expected from the server.
+func (c *Client) Release(l *Lease) error {
+    msg := c.make_msg(dhcpv4.Release)
+    msg.ClientAddr = l.Addr
+    msg.Options    = msg.Options[:1]
+
+    if l.Server != nil {
+        msg.SetOption(dhcpv4.ServerID, dhcpv4.MakeIPs(l.Server))
+    }
+
+    pkts, err := c.stack(msg)
+    if err != nil {
+        return err
+    }
+
+    return network.Send(c.handle, pkts...)
+}
+
+func (c *Client) make_msg(msg_type dhcpv4.MessageType) *dhcpv4.Packet {
+    msg := dhcpv4.Make(msg_type, c.HWAddr)
+    msg.Xid   = c.Xid
+    msg.Flags = dhcpv4.Broadcast
+
+    if c.HostName != "" {
+        msg.SetOption(dhcpv4.HostName, []byte(c.HostName))
+    }
+
+    if len(c.Params) > 0 {
+        var params []byte
+
+        for _, p := range c.Params {
+            params = append(params, uint8(p))
+        }
+
+        msg.SetOption(dhcpv4.ParamRequestList, params)
+    }
+
+    return msg
+}
+
+/* stack the lower layers needed to send the given message on the handle */
+func (c *Client) stack(msg *dhcpv4.Packet) ([]packet.Packet, error) {
+    ip4_pkt := ipv4.Make()
+    ip4_pkt.SrcAddr = net.IPv4zero
+    ip4_pkt.DstAddr = net.IPv4bcast
+
+    if msg.ClientAddr != nil {
+        ip4_pkt.SrcAddr = msg.ClientAddr
+    }
+
+    if msg.MessageType() == dhcpv4.Release {
+        if server := msg.OptionIP(dhcpv4.ServerID); server != nil {
+            ip4_pkt.DstAddr = server
+        }
+    }
+
+    udp_pkt := udp.Make()
+    udp_pkt.SrcPort = udp.BOOTPClient
+    udp_pkt.DstPort = udp.BOOTPServer
+
+    switch c.handle.LinkType() {
+    case packet.Eth:
+        eth_pkt := eth.Make()
+        eth_pkt.SrcAddr = c.HWAddr
+        eth_pkt.DstAddr, _ = net.ParseMAC("ff:ff:ff:ff:ff:ff")
+
+        return []packet.Packet{ eth_pkt, ip4_pkt, udp_pkt, msg }, nil
+
+    case packet.IPv4:
+        return []packet.Packet{ ip4_pkt, udp_pkt, msg }, nil
+
+    default:
+        return nil, fmt.Errorf("Unsupported link type %s",
+                               c.handle.LinkType())
+    }
+}
+
+func (c *Client) send_recv(msg *dhcpv4.Packet) (*dhcpv4.Packet, error) {
+    pkts, err := c.stack(msg)
+    if err != nil {
+        return nil, err
+    }
+
+    rsp, err := network.SendRecv(c.handle, c.Timeout, pkts...)
+    if err != nil {
+        return nil, err
+    }
+
+    if rsp == nil {
+        return nil, fmt.Errorf("No answer to %s", msg.MessageType())
+    }
+
+    /* ICMP errors quoting the request also answer it */
+    reply, ok := layers.FindLayer(rsp, packet.DHCPv4).(*dhcpv4.Packet)
+    if !ok {
+        return nil, fmt.Errorf("Invalid answer to %s: %s", msg.MessageType(),
+                               rsp)
+    }
+
+    return reply, nil
+}
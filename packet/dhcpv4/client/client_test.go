@@ -0,0 +1,246 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package client_test
+
+import "io/ioutil"
+import "log"
+import "net"
+import "os"
+import "path/filepath"
+import "testing"
+import "time"
+
+import "github.com/ghedo/go.pkt/capture/file"
+import "github.com/ghedo/go.pkt/capture/pcap"
+import "github.com/ghedo/go.pkt/layers"
+import "github.com/ghedo/go.pkt/packet/dhcpv4"
+import "github.com/ghedo/go.pkt/packet/dhcpv4/client"
+import "github.com/ghedo/go.pkt/packet/eth"
+import "github.com/ghedo/go.pkt/packet/icmpv4"
+import "github.com/ghedo/go.pkt/packet/ipv4"
+import "github.com/ghedo/go.pkt/packet/raw"
+import "github.com/ghedo/go.pkt/packet/udp"
+
+var test_hwaddr, _ = net.ParseMAC("00:0b:82:01:fc:42")
+var test_server, _ = net.ParseMAC("00:0c:29:36:ed:b0")
+
+/* inject a server reply in the capture file */
+func inject_reply(t *testing.T, h *file.Handle, msg_type dhcpv4.MessageType) {
+    eth_pkt := eth.Make()
+    eth_pkt.SrcAddr = test_server
+    eth_pkt.DstAddr, _ = net.ParseMAC("ff:ff:ff:ff:ff:ff")
+
+    ip4_pkt := ipv4.Make()
+    ip4_pkt.SrcAddr = net.ParseIP("192.168.0.1")
+    ip4_pkt.DstAddr = net.IPv4bcast
+
+    udp_pkt := udp.Make()
+    udp_pkt.SrcPort = udp.BOOTPServer
+    udp_pkt.DstPort = udp.BOOTPClient
+
+    dhcp_pkt := dhcpv4.Make(msg_type, test_hwaddr)
+    dhcp_pkt.Op       = dhcpv4.BootReply
+    dhcp_pkt.Xid      = 0x3d1d
+    dhcp_pkt.YourAddr = net.ParseIP("192.168.0.10")
+
+    dhcp_pkt.SetOption(dhcpv4.ServerID,
+                       dhcpv4.MakeIPs(ip4_pkt.SrcAddr))
+    dhcp_pkt.SetOption(dhcpv4.LeaseTime, dhcpv4.MakeDuration(time.Hour))
+    dhcp_pkt.SetOption(dhcpv4.SubnetMask,
+                       dhcpv4.MakeIPs(net.IP(net.CIDRMask(24, 32))))
+    dhcp_pkt.SetOption(dhcpv4.Router, dhcpv4.MakeIPs(ip4_pkt.SrcAddr))
+
+    buf, err := layers.Pack(eth_pkt, ip4_pkt, udp_pkt, dhcp_pkt)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    err = h.Inject(buf)
+    if err != nil {
+        t.Fatalf("Error injecting: %s", err)
+    }
+}
+
+func TestRun(t *testing.T) {
+    dir, err := ioutil.TempDir("", "dhcpv4")
+    if err != nil {
+        t.Fatalf("Error creating directory: %s", err)
+    }
+    defer os.RemoveAll(dir)
+
+    h, err := file.Open(filepath.Join(dir, "dhcpv4.pcap"))
+    if err != nil {
+        t.Fatalf("Error opening: %s", err)
+    }
+    defer h.Close()
+
+    inject_reply(t, h, dhcpv4.Offer)
+    inject_reply(t, h, dhcpv4.Ack)
+
+    c := client.New(h, test_hwaddr)
+    c.Xid = 0x3d1d
+
+    lease, err := c.Run()
+    if err != nil {
+        t.Fatalf("Error running: %s", err)
+    }
+
+    if !lease.Addr.Equal(net.ParseIP("192.168.0.10")) ||
+       !lease.Server.Equal(net.ParseIP("192.168.0.1")) ||
+       lease.Mask.String() != "ffffff00" || len(lease.Routers) != 1 ||
+       lease.Duration != time.Hour {
+        t.Fatalf("Lease mismatch: %+v", lease)
+    }
+
+    if lease.Offer.MessageType() != dhcpv4.Offer ||
+       lease.Ack.MessageType() != dhcpv4.Ack {
+        t.Fatalf("Messages mismatch: %s %s", lease.Offer, lease.Ack)
+    }
+}
+
+func TestNoAnswer(t *testing.T) {
+    dir, err := ioutil.TempDir("", "dhcpv4")
+    if err != nil {
+        t.Fatalf("Error creating directory: %s", err)
+    }
+    defer os.RemoveAll(dir)
+
+    h, err := file.Open(filepath.Join(dir, "dhcpv4.pcap"))
+    if err != nil {
+        t.Fatalf("Error opening: %s", err)
+    }
+    defer h.Close()
+
+    inject_reply(t, h, dhcpv4.Offer)
+    inject_reply(t, h, dhcpv4.Nak)
+
+    c := client.New(h, test_hwaddr)
+
+    /* replies for a different transaction are ignored */
+    _, err = c.Discover()
+    if err == nil {
+        t.Fatalf("Discover succeeded")
+    }
+}
+
+func TestICMPError(t *testing.T) {
+    dir, err := ioutil.TempDir("", "dhcpv4")
+    if err != nil {
+        t.Fatalf("Error creating directory: %s", err)
+    }
+    defer os.RemoveAll(dir)
+
+    h, err := file.Open(filepath.Join(dir, "dhcpv4.pcap"))
+    if err != nil {
+        t.Fatalf("Error opening: %s", err)
+    }
+    defer h.Close()
+
+    c := client.New(h, test_hwaddr)
+    c.Xid = 0x3d1d
+
+    /* rebuild the discover sent by the client to quote it */
+    discover := dhcpv4.Make(dhcpv4.Discover, test_hwaddr)
+    discover.Xid   = c.Xid
+    discover.Flags = dhcpv4.Broadcast
+
+    var params []byte
+    for _, p := range c.Params {
+        params = append(params, uint8(p))
+    }
+
+    discover.SetOption(dhcpv4.ParamRequestList, params)
+
+    req_ip4 := ipv4.Make()
+    req_ip4.SrcAddr = net.IPv4zero
+    req_ip4.DstAddr = net.IPv4bcast
+
+    req_udp := udp.Make()
+    req_udp.SrcPort = udp.BOOTPClient
+    req_udp.DstPort = udp.BOOTPServer
+
+    req, err := layers.Pack(req_ip4, req_udp, discover)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    eth_pkt := eth.Make()
+    eth_pkt.SrcAddr = test_server
+    eth_pkt.DstAddr = test_hwaddr
+
+    ip4_pkt := ipv4.Make()
+    ip4_pkt.SrcAddr = net.ParseIP("192.168.0.1")
+    ip4_pkt.DstAddr = net.ParseIP("192.168.0.10")
+
+    icmp_pkt := icmpv4.Make()
+    icmp_pkt.Type = icmpv4.DstUnreachable
+    icmp_pkt.Code = 3
+
+    buf, err := layers.Pack(eth_pkt, ip4_pkt, icmp_pkt,
+                            &raw.Packet{ Data: req[:28] })
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    err = h.Inject(buf)
+    if err != nil {
+        t.Fatalf("Error injecting: %s", err)
+    }
+
+    _, err = c.Discover()
+    if err == nil {
+        t.Fatalf("Discover succeeded")
+    }
+}
+
+func ExampleClient() {
+    src, err := pcap.Open("eth0")
+    if err != nil {
+        log.Fatal(err)
+    }
+    defer src.Close()
+
+    err = src.Activate()
+    if err != nil {
+        log.Fatal(err)
+    }
+
+    hwaddr, _ := net.ParseMAC("00:0b:82:01:fc:42")
+
+    c := client.New(src, hwaddr)
+
+    lease, err := c.Run()
+    if err != nil {
+        log.Fatal(err)
+    }
+
+    log.Println(lease.Addr, lease.Server)
+}
@@ -0,0 +1,369 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package dhcpv4
+
+import "bytes"
+import "encoding/binary"
+import "fmt"
+import "net"
+import "strings"
+import "time"
+
+type Option struct {
+    Code OptionCode
+    Data []byte
+}
+
+type Options []Option
+
+type OptionCode uint8
+
+const (
+    Pad                  OptionCode = 0
+    SubnetMask                      = 1
+    TimeOffset                      = 2
+    Router                          = 3
+    DNSServer                       = 6
+    HostName                        = 12
+    DomainName                      = 15
+    BroadcastAddr                   = 28
+    NTPServer                       = 42
+    VendorSpecific                  = 43
+    RequestedIP                     = 50
+    LeaseTime                       = 51
+    Overload                        = 52
+    MessageTypeOption               = 53
+    ServerID                        = 54
+    ParamRequestList                = 55
+    MessageText                     = 56
+    MaxMessageSize                  = 57
+    RenewalTime                     = 58
+    RebindingTime                   = 59
+    VendorClassID                   = 60
+    ClientID                        = 61
+    TFTPServer                      = 66
+    BootFileName                    = 67
+    UserClass                       = 77
+    RapidCommit                     = 80
+    RelayAgentInfo                  = 82
+    DomainSearch                    = 119
+    ClasslessRoutes                 = 121
+    End                             = 255
+)
+
+type MessageType uint8
+
+const (
+    Discover MessageType = 1
+    Offer                = 2
+    Request              = 3
+    Decline              = 4
+    Ack                  = 5
+    Nak                  = 6
+    Release              = 7
+    Inform               = 8
+)
+
+// Relay agent information sub-option codes (RFC 3046).
+const (
+    AgentCircuitID uint8 = 1
+    AgentRemoteID        = 2
+)
+
+// Relay agent information sub-option.
+type SubOption struct {
+    Code uint8
+    Data []byte
+}
+
+// Classless static route (RFC 3442).
+type Route struct {
+    Dest    *net.IPNet
+    Gateway net.IP
+}
+
+// Return the data of the option with the given code, or nil if not present.
+// The data of options split in multiple instances is concatenated (RFC 3396).
+func (p *Packet) FindOption(code OptionCode) []byte {
+    var data []byte
+    var found bool
+
+    for _, o := range p.Options {
+        if o.Code == code {
+            data  = append(data, o.Data...)
+            found = true
+        }
+    }
+
+    if found && data == nil {
+        return []byte{}
+    }
+
+    return data
+}
+
+// Set the option with the given code, replacing any existing instance.
+func (p *Packet) SetOption(code OptionCode, data []byte) {
+    var opts Options
+
+    for _, o := range p.Options {
+        if o.Code != code {
+            opts = append(opts, o)
+        }
+    }
+
+    p.Options = append(opts, Option{ Code: code, Data: data })
+}
+
+// Return the DHCP message type, or 0 for BOOTP messages.
+func (p *Packet) MessageType() MessageType {
+    data := p.FindOption(MessageTypeOption)
+    if len(data) != 1 {
+        return 0
+    }
+
+    return MessageType(data[0])
+}
+
+// Return the first address of the given option (e.g. RequestedIP, ServerID).
+func (p *Packet) OptionIP(code OptionCode) net.IP {
+    addrs := p.OptionIPs(code)
+    if len(addrs) == 0 {
+        return nil
+    }
+
+    return addrs[0]
+}
+
+// Return the list of addresses of the given option (e.g. Router, DNSServer).
+func (p *Packet) OptionIPs(code OptionCode) []net.IP {
+    data := p.FindOption(code)
+
+    if len(data) == 0 || len(data) % 4 != 0 {
+        return nil
+    }
+
+    var addrs []net.IP
+
+    for i := 0; i < len(data); i += 4 {
+        addrs = append(addrs, net.IP(data[i:i + 4]))
+    }
+
+    return addrs
+}
+
+// Return the value of the given time option (e.g. LeaseTime, RenewalTime).
+func (p *Packet) OptionDuration(code OptionCode) time.Duration {
+    data := p.FindOption(code)
+    if len(data) != 4 {
+        return 0
+    }
+
+    return time.Duration(binary.BigEndian.Uint32(data)) * time.Second
+}
+
+// Return the subnet mask option.
+func (p *Packet) SubnetMask() net.IPMask {
+    data := p.FindOption(SubnetMask)
+    if len(data) != 4 {
+        return nil
+    }
+
+    return net.IPMask(data)
+}
+
+// Return the list of options requested by the client.
+func (p *Packet) ParamRequestList() []OptionCode {
+    var codes []OptionCode
+
+    for _, c := range p.FindOption(ParamRequestList) {
+        codes = append(codes, OptionCode(c))
+    }
+
+    return codes
+}
+
+// Decode the relay agent information option.
+func (p *Packet) RelayAgentInfo() ([]SubOption, error) {
+    var subs []SubOption
+
+    for d := p.FindOption(RelayAgentInfo); len(d) > 0; {
+        if len(d) < 2 || len(d) < 2 + int(d[1]) {
+            return nil, fmt.Errorf("Invalid relay agent sub-option length")
+        }
+
+        subs = append(subs, SubOption{ Code: d[0], Data: d[2:2 + int(d[1])] })
+        d    = d[2 + int(d[1]):]
+    }
+
+    return subs, nil
+}
+
+// Decode the classless static route option.
+func (p *Packet) ClasslessRoutes() ([]Route, error) {
+    var routes []Route
+
+    for d := p.FindOption(ClasslessRoutes); len(d) > 0; {
+        bits := int(d[0])
+        if bits > 32 {
+            return nil, fmt.Errorf("Invalid route prefix length %d", bits)
+        }
+
+        octets := (bits + 7) / 8
+
+        if len(d) < 1 + octets + 4 {
+            return nil, fmt.Errorf("Invalid route length")
+        }
+
+        dest := make(net.IP, 4)
+        copy(dest, d[1:1 + octets])
+
+        routes = append(routes, Route{
+            Dest:    &net.IPNet{ IP: dest, Mask: net.CIDRMask(bits, 32) },
+            Gateway: net.IP(d[1 + octets:5 + octets]),
+        })
+
+        d = d[5 + octets:]
+    }
+
+    return routes, nil
+}
+
+// Encode the given addresses as option data.
+func MakeIPs(addrs ...net.IP) []byte {
+    var data []byte
+
+    for _, a := range addrs {
+        data = append(data, a.To4()...)
+    }
+
+    return data
+}
+
+// Encode the given duration as the data of a time option.
+func MakeDuration(d time.Duration) []byte {
+    data := make([]byte, 4)
+    binary.BigEndian.PutUint32(data, uint32(d / time.Second))
+
+    return data
+}
+
+// Encode the given sub-options as relay agent information option data.
+func MakeRelayAgentInfo(subs []SubOption) []byte {
+    var data []byte
+
+    for _, s := range subs {
+        data = append(data, s.Code, uint8(len(s.Data)))
+        data = append(data, s.Data...)
+    }
+
+    return data
+}
+
+// Encode the given routes as classless static route option data.
+func MakeClasslessRoutes(routes []Route) []byte {
+    var data []byte
+
+    for _, r := range routes {
+        bits, _ := r.Dest.Mask.Size()
+
+        data = append(data, uint8(bits))
+        data = append(data, r.Dest.IP.To4()[:(bits + 7) / 8]...)
+        data = append(data, r.Gateway.To4()...)
+    }
+
+    return data
+}
+
+func (o Option) Equal(other Option) bool {
+    return o.Code == other.Code && bytes.Equal(o.Data, other.Data)
+}
+
+func (o Option) String() string {
+    var val string
+
+    switch o.Code {
+    case MessageTypeOption:
+        if len(o.Data) == 1 {
+            val = MessageType(o.Data[0]).String()
+        }
+
+    case SubnetMask, Router, DNSServer, BroadcastAddr, NTPServer,
+         RequestedIP, ServerID:
+        if len(o.Data) > 0 && len(o.Data) % 4 == 0 {
+            var addrs []string
+
+            for i := 0; i < len(o.Data); i += 4 {
+                addrs = append(addrs, net.IP(o.Data[i:i + 4]).String())
+            }
+
+            val = strings.Join(addrs, ",")
+        }
+
+    case LeaseTime, RenewalTime, RebindingTime:
+        if len(o.Data) == 4 {
+            val = fmt.Sprintf("%ds", binary.BigEndian.Uint32(o.Data))
+        }
+
+    case HostName, DomainName, MessageText, VendorClassID, BootFileName:
+        val = fmt.Sprintf("%q", o.Data)
+    }
+
+    if val == "" {
+        val = fmt.Sprintf("%x", o.Data)
+    }
+
+    return fmt.Sprintf("%d=%s", uint8(o.Code), val)
+}
+
+func (opts Options) String() string {
+    var s []string
+
+    for _, o := range opts {
+        s = append(s, o.String())
+    }
+
+    return "[" + strings.Join(s, " ") + "]"
+}
+
+func (t MessageType) String() string {
+    switch t {
+    case Discover: return "discover"
+    case Offer:    return "offer"
+    case Request:  return "request"
+    case Decline:  return "decline"
+    case Ack:      return "ack"
+    case Nak:      return "nak"
+    case Release:  return "release"
+    case Inform:   return "inform"
+    default:       return fmt.Sprintf("%d", uint8(t))
+    }
+}
@@ -0,0 +1,371 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+// Provides encoding and decoding for BOOTP (RFC 951) and DHCPv4 (RFC 2131)
+// messages, including the DHCP options (RFC 2132).
+package dhcpv4
+
+import "bytes"
+import "fmt"
+import "net"
+
+import "github.com/ghedo/go.pkt/packet"
+
+type Packet struct {
+    Op           Op               `string:"op"`
+    HWType       uint8            `string:"htype"`
+    HWLen        uint8            `string:"hlen"`
+    Hops         uint8            `string:"hops"`
+    Xid          uint32           `string:"xid"`
+    Secs         uint16           `string:"secs"`
+    Flags        Flags            `string:"flags"`
+    ClientAddr   net.IP           `string:"ciaddr"`
+    YourAddr     net.IP           `string:"yiaddr"`
+    ServerAddr   net.IP           `string:"siaddr"`
+    RelayAddr    net.IP           `string:"giaddr"`
+    ClientHWAddr net.HardwareAddr `string:"chaddr"`
+    ServerName   []byte           `string:"skip"`
+    BootFile     []byte           `string:"skip"`
+    Options      Options          `string:"opts"`
+    Padding      []byte           `cmp:"skip" string:"skip"`
+}
+
+type Op uint8
+
+const (
+    BootRequest Op = 1
+    BootReply      = 2
+)
+
+type Flags uint16
+
+const (
+    Broadcast Flags = 0x8000
+)
+
+/* BOOTP messages must be at least 300 bytes long (RFC 1542) */
+const min_len = 300
+
+var magic_cookie = []byte{ 99, 130, 83, 99 }
+
+// Make a new DHCP request from the client with the given hardware address.
+func Make(msg_type MessageType, hwaddr net.HardwareAddr) *Packet {
+    return &Packet{
+        Op: BootRequest,
+        HWType: 1,
+        HWLen: uint8(len(hwaddr)),
+        ClientHWAddr: hwaddr,
+        Options: Options{
+            { Code: MessageTypeOption, Data: []byte{ uint8(msg_type) } },
+        },
+    }
+}
+
+func (p *Packet) GetType() packet.Type {
+    return packet.DHCPv4
+}
+
+func (p *Packet) GetLength() uint16 {
+    length := 236 + p.options_len() + len(p.Padding)
+
+    if p.Padding == nil && length < min_len {
+        return min_len
+    }
+
+    return uint16(length)
+}
+
+func (p *Packet) options_len() int {
+    if len(p.Options) == 0 {
+        return 0
+    }
+
+    /* magic cookie and end option */
+    length := 4 + 1
+
+    for _, o := range p.Options {
+        /* long options are split in multiple ones (RFC 3396) */
+        length += len(o.Data) + 2 * ((len(o.Data) + 254) / 255)
+
+        if len(o.Data) == 0 {
+            length += 2
+        }
+    }
+
+    return length
+}
+
+func (p *Packet) Equals(other packet.Packet) bool {
+    return packet.Compare(p, other)
+}
+
+// Check if the packet is an answer to another packet. Replies answer the
+// request with the same transaction ID and client hardware address: offers
+// answer discovers, while acks and naks answer requests (and acks answer
+// informs).
+func (p *Packet) Answers(other packet.Packet) bool {
+    if other == nil || other.GetType() != packet.DHCPv4 {
+        return false
+    }
+
+    req := other.(*Packet)
+
+    if p.Op != BootReply || req.Op != BootRequest || p.Xid != req.Xid ||
+       !bytes.Equal(p.ClientHWAddr, req.ClientHWAddr) {
+        return false
+    }
+
+    switch req.MessageType() {
+    case Discover:
+        return p.MessageType() == Offer
+
+    case Request:
+        return p.MessageType() == Ack || p.MessageType() == Nak
+
+    case Inform:
+        return p.MessageType() == Ack
+
+    case 0:
+        return p.MessageType() == 0
+
+    default:
+        return false
+    }
+}
+
+func (p *Packet) Pack(buf *packet.Buffer) error {
+    if len(p.ClientHWAddr) > 16 {
+        return fmt.Errorf("Invalid hardware address length %d",
+                          len(p.ClientHWAddr))
+    }
+
+    if len(p.ServerName) > 64 || len(p.BootFile) > 128 {
+        return fmt.Errorf("Invalid server name or boot file length")
+    }
+
+    buf.WriteN(p.Op)
+    buf.WriteN(p.HWType)
+    buf.WriteN(p.HWLen)
+    buf.WriteN(p.Hops)
+    buf.WriteN(p.Xid)
+    buf.WriteN(p.Secs)
+    buf.WriteN(p.Flags)
+
+    for _, addr := range []net.IP{ p.ClientAddr, p.YourAddr, p.ServerAddr,
+                                   p.RelayAddr } {
+        write_addr(buf, addr)
+    }
+
+    write_padded(buf, p.ClientHWAddr, 16)
+    write_padded(buf, p.ServerName, 64)
+    write_padded(buf, p.BootFile, 128)
+
+    if len(p.Options) > 0 {
+        buf.Write(magic_cookie)
+
+        for _, o := range p.Options {
+            data := o.Data
+
+            for {
+                n := len(data)
+                if n > 255 {
+                    n = 255
+                }
+
+                buf.WriteN(o.Code)
+                buf.WriteN(uint8(n))
+                buf.Write(data[:n])
+
+                data = data[n:]
+
+                if len(data) == 0 {
+                    break
+                }
+            }
+        }
+
+        buf.WriteN(OptionCode(End))
+    }
+
+    if p.Padding != nil {
+        buf.Write(p.Padding)
+    } else {
+        for buf.LayerLen() < min_len {
+            buf.WriteN(uint8(0))
+        }
+    }
+
+    return nil
+}
+
+func (p *Packet) Unpack(buf *packet.Buffer) error {
+    if buf.Len() < 236 {
+        return fmt.Errorf("Invalid BOOTP message length %d", buf.Len())
+    }
+
+    buf.ReadN(&p.Op)
+    buf.ReadN(&p.HWType)
+    buf.ReadN(&p.HWLen)
+    buf.ReadN(&p.Hops)
+    buf.ReadN(&p.Xid)
+    buf.ReadN(&p.Secs)
+    buf.ReadN(&p.Flags)
+
+    p.ClientAddr = read_addr(buf)
+    p.YourAddr   = read_addr(buf)
+    p.ServerAddr = read_addr(buf)
+    p.RelayAddr  = read_addr(buf)
+
+    chaddr := buf.Next(16)
+
+    if p.HWLen <= 16 {
+        p.ClientHWAddr = net.HardwareAddr(chaddr[:p.HWLen])
+    } else {
+        p.ClientHWAddr = net.HardwareAddr(chaddr)
+    }
+
+    p.ServerName = trim_zeros(buf.Next(64))
+    p.BootFile   = trim_zeros(buf.Next(128))
+
+    p.Options = nil
+
+    if buf.Len() >= 4 && bytes.Equal(buf.Bytes()[:4], magic_cookie) {
+        buf.Next(4)
+
+        for buf.Len() > 0 {
+            var code OptionCode
+            buf.ReadN(&code)
+
+            if code == End {
+                break
+            }
+
+            if code == Pad {
+                continue
+            }
+
+            if buf.Len() < 1 {
+                return fmt.Errorf("Invalid option %d", code)
+            }
+
+            var length uint8
+            buf.ReadN(&length)
+
+            if buf.Len() < int(length) {
+                return fmt.Errorf("Invalid option %d length %d", code, length)
+            }
+
+            p.Options = append(p.Options, Option{
+                Code: code,
+                Data: buf.Next(int(length)),
+            })
+        }
+    }
+
+    p.Padding = buf.Next(buf.Len())
+
+    return nil
+}
+
+func (p *Packet) Payload() packet.Packet {
+    return nil
+}
+
+func (p *Packet) GuessPayloadType() packet.Type {
+    return packet.None
+}
+
+func (p *Packet) SetPayload(pl packet.Packet) error {
+    return nil
+}
+
+func (p *Packet) InitChecksum(csum uint32) {
+}
+
+func (p *Packet) String() string {
+    return packet.Stringify(p)
+}
+
+/* addresses are always 4 bytes long, unset ones are all zeros */
+func write_addr(buf *packet.Buffer, addr net.IP) {
+    if ip4 := addr.To4(); ip4 != nil {
+        buf.Write(ip4)
+    } else {
+        buf.Write(net.IPv4zero.To4())
+    }
+}
+
+func read_addr(buf *packet.Buffer) net.IP {
+    addr := net.IP(buf.Next(4))
+
+    if addr.Equal(net.IPv4zero) {
+        return nil
+    }
+
+    return addr
+}
+
+func write_padded(buf *packet.Buffer, data []byte, length int) {
+    buf.Write(data)
+
+    for i := len(data); i < length; i++ {
+        buf.WriteN(uint8(0))
+    }
+}
+
+func trim_zeros(data []byte) []byte {
+    data = bytes.TrimRight(data, "\x00")
+
+    if len(data) == 0 {
+        return nil
+    }
+
+    return data
+}
+
+func (o Op) String() string {
+    switch o {
+    case BootRequest: return "request"
+    case BootReply:   return "reply"
+    default:          return fmt.Sprintf("%d", uint8(o))
+    }
+}
+
+func (f Flags) String() string {
+    if f & Broadcast != 0 {
+        return "broadcast"
+    }
+
+    if f != 0 {
+        return fmt.Sprintf("0x%x", uint16(f))
+    }
+
+    return ""
+}
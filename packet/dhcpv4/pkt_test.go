@@ -0,0 +1,278 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package dhcpv4_test
+
+import "bytes"
+import "net"
+import "testing"
+import "time"
+
+import "github.com/ghedo/go.pkt/layers"
+import "github.com/ghedo/go.pkt/packet"
+import "github.com/ghedo/go.pkt/packet/dhcpv4"
+import "github.com/ghedo/go.pkt/packet/ipv4"
+import "github.com/ghedo/go.pkt/packet/udp"
+
+var test_hwaddr, _ = net.ParseMAC("00:0b:82:01:fc:42")
+
+var test_simple = append(append(append([]byte{
+    0x01, 0x01, 0x06, 0x00, 0x00, 0x00, 0x3d, 0x1d,
+    0x00, 0x00, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00,
+    0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+    0x00, 0x00, 0x00, 0x00, 0x00, 0x0b, 0x82, 0x01,
+    0xfc, 0x42, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+    0x00, 0x00, 0x00, 0x00,
+}, make([]byte, 192)...), []byte{
+    0x63, 0x82, 0x53, 0x63, 0x35, 0x01, 0x01, 0x32,
+    0x04, 0xc0, 0xa8, 0x00, 0x0a, 0x37, 0x04, 0x01,
+    0x03, 0x06, 0x2a, 0xff,
+}...), make([]byte, 44)...)
+
+func MakeTestSimple() *dhcpv4.Packet {
+    p := dhcpv4.Make(dhcpv4.Discover, test_hwaddr)
+    p.Xid   = 0x3d1d
+    p.Flags = dhcpv4.Broadcast
+
+    p.SetOption(dhcpv4.RequestedIP,
+                dhcpv4.MakeIPs(net.ParseIP("192.168.0.10")))
+    p.SetOption(dhcpv4.ParamRequestList, []byte{
+        dhcpv4.SubnetMask, dhcpv4.Router, dhcpv4.DNSServer, dhcpv4.NTPServer,
+    })
+
+    return p
+}
+
+func TestPack(t *testing.T) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_simple)))
+
+    p := MakeTestSimple()
+
+    if int(p.GetLength()) != len(test_simple) {
+        t.Fatalf("Length mismatch: %d", p.GetLength())
+    }
+
+    err := p.Pack(&b)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if !bytes.Equal(test_simple, b.Buffer()) {
+        t.Fatalf("Raw packet mismatch: %x", b.Buffer())
+    }
+}
+
+func BenchmarkPack(bn *testing.B) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_simple)))
+
+    p := MakeTestSimple()
+
+    for n := 0; n < bn.N; n++ {
+        p.Pack(&b)
+    }
+}
+
+func TestUnpack(t *testing.T) {
+    var p dhcpv4.Packet
+
+    cmp := MakeTestSimple()
+
+    var b packet.Buffer
+    b.Init(test_simple)
+
+    err := p.Unpack(&b)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if !p.Equals(cmp) {
+        t.Fatalf("Packet mismatch:\n%s\n%s", &p, cmp)
+    }
+
+    if p.MessageType() != dhcpv4.Discover ||
+       !p.OptionIP(dhcpv4.RequestedIP).Equal(net.ParseIP("192.168.0.10")) ||
+       len(p.ParamRequestList()) != 4 {
+        t.Fatalf("Options mismatch: %s", p.Options)
+    }
+}
+
+func BenchmarkUnpack(bn *testing.B) {
+    var p dhcpv4.Packet
+    var b packet.Buffer
+
+    for n := 0; n < bn.N; n++ {
+        b.Init(test_simple)
+        p.Unpack(&b)
+    }
+}
+
+func MakeTestAck() *dhcpv4.Packet {
+    p := dhcpv4.Make(dhcpv4.Ack, test_hwaddr)
+    p.Op       = dhcpv4.BootReply
+    p.Xid      = 0x3d1d
+    p.YourAddr = net.ParseIP("192.168.0.10")
+
+    p.SetOption(dhcpv4.ServerID, dhcpv4.MakeIPs(net.ParseIP("192.168.0.1")))
+    p.SetOption(dhcpv4.LeaseTime, dhcpv4.MakeDuration(time.Hour))
+    p.SetOption(dhcpv4.SubnetMask,
+                dhcpv4.MakeIPs(net.IP(net.CIDRMask(24, 32))))
+    p.SetOption(dhcpv4.DNSServer,
+                dhcpv4.MakeIPs(net.ParseIP("8.8.8.8"), net.ParseIP("8.8.4.4")))
+
+    return p
+}
+
+func TestOptions(t *testing.T) {
+    p := MakeTestAck()
+
+    _, dest, _ := net.ParseCIDR("10.0.0.0/8")
+    routes := []dhcpv4.Route{
+        { Dest: dest, Gateway: net.ParseIP("192.168.0.254") },
+        {
+            Dest: &net.IPNet{ IP: net.IPv4zero, Mask: net.CIDRMask(0, 32) },
+            Gateway: net.ParseIP("192.168.0.1"),
+        },
+    }
+
+    p.SetOption(dhcpv4.ClasslessRoutes, dhcpv4.MakeClasslessRoutes(routes))
+
+    subs := []dhcpv4.SubOption{
+        { Code: dhcpv4.AgentCircuitID, Data: []byte("eth0:10") },
+        { Code: dhcpv4.AgentRemoteID, Data: []byte{ 0x00, 0x11, 0x22 } },
+    }
+
+    p.SetOption(dhcpv4.RelayAgentInfo, dhcpv4.MakeRelayAgentInfo(subs))
+
+    /* options longer than 255 bytes are split */
+    p.SetOption(dhcpv4.VendorSpecific, bytes.Repeat([]byte{ 0x42 }, 300))
+
+    buf := make([]byte, p.GetLength())
+
+    var b packet.Buffer
+    b.Init(buf)
+
+    err := p.Pack(&b)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    var p2 dhcpv4.Packet
+    b.Init(buf)
+
+    err = p2.Unpack(&b)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if len(p2.Options) != len(p.Options) + 1 {
+        t.Fatalf("Options mismatch: %s", p2.Options)
+    }
+
+    if len(p2.FindOption(dhcpv4.VendorSpecific)) != 300 {
+        t.Fatalf("Split option mismatch: %s", p2.Options)
+    }
+
+    if p2.OptionDuration(dhcpv4.LeaseTime) != time.Hour ||
+       p2.SubnetMask().String() != "ffffff00" ||
+       len(p2.OptionIPs(dhcpv4.DNSServer)) != 2 {
+        t.Fatalf("Options mismatch: %s", p2.Options)
+    }
+
+    r, err := p2.ClasslessRoutes()
+    if err != nil {
+        t.Fatalf("Error decoding routes: %s", err)
+    }
+
+    if len(r) != 2 || r[0].Dest.String() != "10.0.0.0/8" ||
+       !r[0].Gateway.Equal(routes[0].Gateway) ||
+       r[1].Dest.String() != "0.0.0.0/0" {
+        t.Fatalf("Routes mismatch: %v", r)
+    }
+
+    s, err := p2.RelayAgentInfo()
+    if err != nil {
+        t.Fatalf("Error decoding relay agent info: %s", err)
+    }
+
+    if len(s) != 2 || string(s[0].Data) != "eth0:10" ||
+       s[1].Code != dhcpv4.AgentRemoteID {
+        t.Fatalf("Relay agent info mismatch: %v", s)
+    }
+}
+
+func TestAnswers(t *testing.T) {
+    req := MakeTestSimple()
+    ack := MakeTestAck()
+
+    if ack.Answers(req) {
+        t.Fatalf("Ack answers discover")
+    }
+
+    req.SetOption(dhcpv4.MessageTypeOption, []byte{ dhcpv4.Request })
+
+    if !ack.Answers(req) {
+        t.Fatalf("Ack doesn't answer request")
+    }
+
+    ack.Xid = 0x3d1e
+
+    if ack.Answers(req) {
+        t.Fatalf("Ack answers request with different xid")
+    }
+}
+
+func TestUDP(t *testing.T) {
+    ip4_pkt := ipv4.Make()
+    ip4_pkt.SrcAddr = net.IPv4zero
+    ip4_pkt.DstAddr = net.IPv4bcast
+
+    udp_pkt := udp.Make()
+    udp_pkt.SrcPort = udp.BOOTPClient
+    udp_pkt.DstPort = udp.BOOTPServer
+
+    dhcp_pkt := MakeTestSimple()
+
+    buf, err := layers.Pack(ip4_pkt, udp_pkt, dhcp_pkt)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    p, err := layers.UnpackAll(buf, packet.IPv4)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    l := layers.FindLayer(p, packet.DHCPv4)
+    if l == nil || !l.Equals(dhcp_pkt) {
+        t.Fatalf("Packet mismatch: %s", p)
+    }
+}
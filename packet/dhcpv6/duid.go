@@ -0,0 +1,161 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package dhcpv6
+
+import "encoding/binary"
+import "fmt"
+import "net"
+import "time"
+
+// DHCP unique identifier (RFC 8415, section 11).
+type DUID []byte
+
+type DUIDType uint16
+
+const (
+    DUIDLLT  DUIDType = 1
+    DUIDEN            = 2
+    DUIDLL            = 3
+    DUIDUUID          = 4
+)
+
+/* DUID-LLT times are seconds since midnight (UTC), January 1, 2000 */
+var duid_epoch = time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// Make a new DUID based on the given Ethernet address and time.
+func MakeDUIDLLT(hwaddr net.HardwareAddr, t time.Time) DUID {
+    d := make(DUID, 8)
+
+    binary.BigEndian.PutUint16(d[0:2], uint16(DUIDLLT))
+    binary.BigEndian.PutUint16(d[2:4], 1)
+    binary.BigEndian.PutUint32(d[4:8], uint32(t.Sub(duid_epoch) / time.Second))
+
+    return append(d, hwaddr...)
+}
+
+// Make a new DUID based on the given enterprise number and identifier.
+func MakeDUIDEN(enterprise uint32, id []byte) DUID {
+    d := make(DUID, 6)
+
+    binary.BigEndian.PutUint16(d[0:2], uint16(DUIDEN))
+    binary.BigEndian.PutUint32(d[2:6], enterprise)
+
+    return append(d, id...)
+}
+
+// Make a new DUID based on the given Ethernet address.
+func MakeDUIDLL(hwaddr net.HardwareAddr) DUID {
+    d := make(DUID, 4)
+
+    binary.BigEndian.PutUint16(d[0:2], uint16(DUIDLL))
+    binary.BigEndian.PutUint16(d[2:4], 1)
+
+    return append(d, hwaddr...)
+}
+
+// Make a new DUID based on the given 16 bytes UUID.
+func MakeDUIDUUID(uuid []byte) DUID {
+    d := make(DUID, 2)
+
+    binary.BigEndian.PutUint16(d[0:2], uint16(DUIDUUID))
+
+    return append(d, uuid...)
+}
+
+// Return the type of the DUID.
+func (d DUID) Type() DUIDType {
+    if len(d) < 2 {
+        return 0
+    }
+
+    return DUIDType(binary.BigEndian.Uint16(d))
+}
+
+// Return the link-layer address of DUID-LLT and DUID-LL identifiers, or nil.
+func (d DUID) HWAddr() net.HardwareAddr {
+    switch {
+    case d.Type() == DUIDLLT && len(d) > 8:
+        return net.HardwareAddr(d[8:])
+
+    case d.Type() == DUIDLL && len(d) > 4:
+        return net.HardwareAddr(d[4:])
+
+    default:
+        return nil
+    }
+}
+
+// Return the time of DUID-LLT identifiers, or the zero time.
+func (d DUID) Time() time.Time {
+    if d.Type() != DUIDLLT || len(d) < 8 {
+        return time.Time{}
+    }
+
+    secs := binary.BigEndian.Uint32(d[4:8])
+
+    return duid_epoch.Add(time.Duration(secs) * time.Second)
+}
+
+// Return the enterprise number and identifier of DUID-EN identifiers.
+func (d DUID) Enterprise() (uint32, []byte) {
+    if d.Type() != DUIDEN || len(d) < 6 {
+        return 0, nil
+    }
+
+    return binary.BigEndian.Uint32(d[2:6]), d[6:]
+}
+
+func (d DUID) String() string {
+    switch {
+    case d.HWAddr() != nil:
+        return fmt.Sprintf("%s(%s)", d.Type(), d.HWAddr())
+
+    case d.Type() == DUIDEN && len(d) >= 6:
+        enterprise, id := d.Enterprise()
+        return fmt.Sprintf("%s(%d,%x)", d.Type(), enterprise, id)
+
+    case d.Type() == DUIDUUID:
+        return fmt.Sprintf("%s(%x)", d.Type(), []byte(d[2:]))
+
+    default:
+        return fmt.Sprintf("%x", []byte(d))
+    }
+}
+
+func (t DUIDType) String() string {
+    switch t {
+    case DUIDLLT:  return "llt"
+    case DUIDEN:   return "en"
+    case DUIDLL:   return "ll"
+    case DUIDUUID: return "uuid"
+    default:       return fmt.Sprintf("%d", uint16(t))
+    }
+}
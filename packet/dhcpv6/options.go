@@ -0,0 +1,573 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package dhcpv6
+
+import "bytes"
+import "encoding/binary"
+import "fmt"
+import "net"
+import "strings"
+import "time"
+
+import "github.com/ghedo/go.pkt/packet"
+import "github.com/ghedo/go.pkt/packet/dns"
+
+type Option struct {
+    Code OptionCode
+    Data []byte
+}
+
+type Options []Option
+
+type OptionCode uint16
+
+const (
+    ClientID        OptionCode = 1
+    ServerID                   = 2
+    IANA                       = 3
+    IATA                       = 4
+    IAAddrOption               = 5
+    OptionRequest              = 6
+    Preference                 = 7
+    ElapsedTime                = 8
+    RelayMsg                   = 9
+    Auth                       = 11
+    Unicast                    = 12
+    StatusCodeOption           = 13
+    RapidCommit                = 14
+    UserClass                  = 15
+    VendorClass                = 16
+    VendorOpts                 = 17
+    InterfaceID                = 18
+    ReconfMsg                  = 19
+    ReconfAccept               = 20
+    DNSServers                 = 23
+    DomainList                 = 24
+    IAPD                       = 25
+    IAPrefixOption             = 26
+    InfoRefreshTime            = 32
+    RemoteID                   = 37
+    ClientFQDN                 = 39
+    NTPServer                  = 56
+    SOLMaxRT                   = 82
+)
+
+type StatusCode uint16
+
+const (
+    Success      StatusCode = 0
+    UnspecFail              = 1
+    NoAddrsAvail            = 2
+    NoBinding               = 3
+    NotOnLink               = 4
+    UseMulticast            = 5
+    NoPrefixAvail           = 6
+)
+
+// Lifetime value meaning infinity.
+const Infinity = time.Duration(0xffffffff) * time.Second
+
+// Identity association for non-temporary addresses (IA_NA) or for prefix
+// delegation (IA_PD), which share the same layout.
+type IA struct {
+    IAID    uint32
+    T1      time.Duration
+    T2      time.Duration
+    Options Options
+}
+
+// Address of an IA_NA.
+type IAAddr struct {
+    Addr      net.IP
+    Preferred time.Duration
+    Valid     time.Duration
+    Options   Options
+}
+
+// Prefix of an IA_PD.
+type IAPrefix struct {
+    Preferred time.Duration
+    Valid     time.Duration
+    Prefix    *net.IPNet
+    Options   Options
+}
+
+// Decode the given options data.
+func ParseOptions(data []byte) (Options, error) {
+    var opts Options
+
+    for len(data) > 0 {
+        if len(data) < 4 {
+            return nil, fmt.Errorf("Invalid option length %d", len(data))
+        }
+
+        code   := OptionCode(binary.BigEndian.Uint16(data[0:2]))
+        length := int(binary.BigEndian.Uint16(data[2:4]))
+
+        if len(data) < 4 + length {
+            return nil, fmt.Errorf("Invalid option %d length %d",
+                                   code, length)
+        }
+
+        opts = append(opts, Option{ Code: code, Data: data[4:4 + length] })
+        data = data[4 + length:]
+    }
+
+    return opts, nil
+}
+
+// Return the encoded length of the options.
+func (opts Options) Len() int {
+    length := 0
+
+    for _, o := range opts {
+        length += 4 + len(o.Data)
+    }
+
+    return length
+}
+
+func (opts Options) pack(buf *packet.Buffer) error {
+    for _, o := range opts {
+        if len(o.Data) > 0xffff {
+            return fmt.Errorf("Invalid option %d length %d",
+                              o.Code, len(o.Data))
+        }
+
+        buf.WriteN(o.Code)
+        buf.WriteN(uint16(len(o.Data)))
+        buf.Write(o.Data)
+    }
+
+    return nil
+}
+
+// Encode the options.
+func (opts Options) Bytes() []byte {
+    var b packet.Buffer
+    b.Init(make([]byte, opts.Len()))
+
+    opts.pack(&b)
+
+    return b.Buffer()
+}
+
+// Return the data of the first option with the given code, or nil if not
+// present.
+func (opts Options) Find(code OptionCode) []byte {
+    for _, o := range opts {
+        if o.Code == code {
+            if o.Data == nil {
+                return []byte{}
+            }
+
+            return o.Data
+        }
+    }
+
+    return nil
+}
+
+// Return the data of all the options with the given code.
+func (opts Options) FindAll(code OptionCode) [][]byte {
+    var data [][]byte
+
+    for _, o := range opts {
+        if o.Code == code {
+            data = append(data, o.Data)
+        }
+    }
+
+    return data
+}
+
+// Set the option with the given code, replacing any existing instance.
+func (opts *Options) Set(code OptionCode, data []byte) {
+    var new_opts Options
+
+    for _, o := range *opts {
+        if o.Code != code {
+            new_opts = append(new_opts, o)
+        }
+    }
+
+    *opts = append(new_opts, Option{ Code: code, Data: data })
+}
+
+// Return the list of addresses of the given option (e.g. DNSServers).
+func (opts Options) IPs(code OptionCode) []net.IP {
+    data := opts.Find(code)
+
+    if len(data) == 0 || len(data) % 16 != 0 {
+        return nil
+    }
+
+    var addrs []net.IP
+
+    for i := 0; i < len(data); i += 16 {
+        addrs = append(addrs, net.IP(data[i:i + 16]))
+    }
+
+    return addrs
+}
+
+// Return the status code option and its message. Missing status codes mean
+// success.
+func (opts Options) Status() (StatusCode, string) {
+    data := opts.Find(StatusCodeOption)
+    if len(data) < 2 {
+        return Success, ""
+    }
+
+    return StatusCode(binary.BigEndian.Uint16(data)), string(data[2:])
+}
+
+// Return the client DUID.
+func (p *Packet) ClientID() DUID {
+    return DUID(p.Options.Find(ClientID))
+}
+
+// Return the server DUID.
+func (p *Packet) ServerID() DUID {
+    return DUID(p.Options.Find(ServerID))
+}
+
+// Decode the IA_NA options.
+func (p *Packet) IANA() ([]IA, error) {
+    return p.find_ia(IANA)
+}
+
+// Decode the IA_PD options.
+func (p *Packet) IAPD() ([]IA, error) {
+    return p.find_ia(IAPD)
+}
+
+func (p *Packet) find_ia(code OptionCode) ([]IA, error) {
+    var ias []IA
+
+    for _, data := range p.Options.FindAll(code) {
+        ia, err := ParseIA(data)
+        if err != nil {
+            return nil, err
+        }
+
+        ias = append(ias, ia)
+    }
+
+    return ias, nil
+}
+
+// Return the list of options requested by the client.
+func (p *Packet) OptionRequest() []OptionCode {
+    var codes []OptionCode
+
+    data := p.Options.Find(OptionRequest)
+
+    for i := 0; i + 1 < len(data); i += 2 {
+        codes = append(codes,
+                       OptionCode(binary.BigEndian.Uint16(data[i:])))
+    }
+
+    return codes
+}
+
+// Return the time elapsed since the client started the exchange.
+func (p *Packet) ElapsedTime() time.Duration {
+    data := p.Options.Find(ElapsedTime)
+    if len(data) != 2 {
+        return 0
+    }
+
+    return time.Duration(binary.BigEndian.Uint16(data)) * 10 *
+           time.Millisecond
+}
+
+// Decode the domain search list option.
+func (p *Packet) DomainList() ([]string, error) {
+    var names []string
+
+    for data := p.Options.Find(DomainList); len(data) > 0; {
+        name, n, err := dns.DecodeName(data)
+        if err != nil {
+            return nil, err
+        }
+
+        names = append(names, name)
+        data  = data[n:]
+    }
+
+    return names, nil
+}
+
+// Decode the given IA_NA or IA_PD option data.
+func ParseIA(data []byte) (IA, error) {
+    if len(data) < 12 {
+        return IA{}, fmt.Errorf("Invalid IA length %d", len(data))
+    }
+
+    opts, err := ParseOptions(data[12:])
+    if err != nil {
+        return IA{}, err
+    }
+
+    return IA{
+        IAID:    binary.BigEndian.Uint32(data[0:4]),
+        T1:      read_duration(data[4:8]),
+        T2:      read_duration(data[8:12]),
+        Options: opts,
+    }, nil
+}
+
+// Encode the IA as option data.
+func (ia IA) Bytes() []byte {
+    data := make([]byte, 12)
+
+    binary.BigEndian.PutUint32(data[0:4], ia.IAID)
+    write_duration(data[4:8], ia.T1)
+    write_duration(data[8:12], ia.T2)
+
+    return append(data, ia.Options.Bytes()...)
+}
+
+// Decode the addresses of the IA.
+func (ia IA) Addrs() ([]IAAddr, error) {
+    var addrs []IAAddr
+
+    for _, data := range ia.Options.FindAll(IAAddrOption) {
+        if len(data) < 24 {
+            return nil, fmt.Errorf("Invalid IA address length %d", len(data))
+        }
+
+        opts, err := ParseOptions(data[24:])
+        if err != nil {
+            return nil, err
+        }
+
+        addrs = append(addrs, IAAddr{
+            Addr:      net.IP(data[0:16]),
+            Preferred: read_duration(data[16:20]),
+            Valid:     read_duration(data[20:24]),
+            Options:   opts,
+        })
+    }
+
+    return addrs, nil
+}
+
+// Decode the prefixes of the IA.
+func (ia IA) Prefixes() ([]IAPrefix, error) {
+    var prefixes []IAPrefix
+
+    for _, data := range ia.Options.FindAll(IAPrefixOption) {
+        if len(data) < 25 || data[8] > 128 {
+            return nil, fmt.Errorf("Invalid IA prefix")
+        }
+
+        opts, err := ParseOptions(data[25:])
+        if err != nil {
+            return nil, err
+        }
+
+        prefixes = append(prefixes, IAPrefix{
+            Preferred: read_duration(data[0:4]),
+            Valid:     read_duration(data[4:8]),
+            Prefix:    &net.IPNet{
+                IP:   net.IP(data[9:25]),
+                Mask: net.CIDRMask(int(data[8]), 128),
+            },
+            Options:   opts,
+        })
+    }
+
+    return prefixes, nil
+}
+
+// Encode the address as IA address option data.
+func (a IAAddr) Bytes() []byte {
+    data := make([]byte, 24)
+
+    copy(data[0:16], a.Addr.To16())
+    write_duration(data[16:20], a.Preferred)
+    write_duration(data[20:24], a.Valid)
+
+    return append(data, a.Options.Bytes()...)
+}
+
+// Encode the prefix as IA prefix option data.
+func (p IAPrefix) Bytes() []byte {
+    data := make([]byte, 25)
+
+    bits, _ := p.Prefix.Mask.Size()
+
+    write_duration(data[0:4], p.Preferred)
+    write_duration(data[4:8], p.Valid)
+    data[8] = uint8(bits)
+    copy(data[9:25], p.Prefix.IP.To16())
+
+    return append(data, p.Options.Bytes()...)
+}
+
+// Encode the given addresses as option data.
+func MakeIPs(addrs ...net.IP) []byte {
+    var data []byte
+
+    for _, a := range addrs {
+        data = append(data, a.To16()...)
+    }
+
+    return data
+}
+
+// Encode the given option codes as option request option data.
+func MakeOptionRequest(codes ...OptionCode) []byte {
+    data := make([]byte, 2 * len(codes))
+
+    for i, c := range codes {
+        binary.BigEndian.PutUint16(data[2 * i:], uint16(c))
+    }
+
+    return data
+}
+
+// Encode the given elapsed time as option data.
+func MakeElapsedTime(d time.Duration) []byte {
+    data := make([]byte, 2)
+
+    cs := d / (10 * time.Millisecond)
+    if cs > 0xffff {
+        cs = 0xffff
+    }
+
+    binary.BigEndian.PutUint16(data, uint16(cs))
+
+    return data
+}
+
+// Encode the given status code and message as option data.
+func MakeStatus(code StatusCode, msg string) []byte {
+    data := make([]byte, 2)
+    binary.BigEndian.PutUint16(data, uint16(code))
+
+    return append(data, msg...)
+}
+
+// Encode the given domain names as domain search list option data.
+func MakeDomainList(names ...string) ([]byte, error) {
+    var data []byte
+
+    for _, n := range names {
+        name, err := dns.EncodeName(n)
+        if err != nil {
+            return nil, err
+        }
+
+        data = append(data, name...)
+    }
+
+    return data, nil
+}
+
+func read_duration(data []byte) time.Duration {
+    return time.Duration(binary.BigEndian.Uint32(data)) * time.Second
+}
+
+func write_duration(data []byte, d time.Duration) {
+    binary.BigEndian.PutUint32(data, uint32(d / time.Second))
+}
+
+func (o Option) Equal(other Option) bool {
+    return o.Code == other.Code && bytes.Equal(o.Data, other.Data)
+}
+
+func (o Option) String() string {
+    var val string
+
+    switch o.Code {
+    case ClientID, ServerID:
+        val = DUID(o.Data).String()
+
+    case IANA, IAPD:
+        if ia, err := ParseIA(o.Data); err == nil {
+            val = fmt.Sprintf("iaid=0x%x t1=%ds t2=%ds %s", ia.IAID,
+                              ia.T1 / time.Second, ia.T2 / time.Second,
+                              ia.Options)
+        }
+
+    case IAAddrOption:
+        if len(o.Data) >= 24 {
+            val = fmt.Sprintf("%s pref=%ds valid=%ds",
+                              net.IP(o.Data[0:16]),
+                              binary.BigEndian.Uint32(o.Data[16:20]),
+                              binary.BigEndian.Uint32(o.Data[20:24]))
+        }
+
+    case IAPrefixOption:
+        if len(o.Data) >= 25 {
+            val = fmt.Sprintf("%s/%d pref=%ds valid=%ds",
+                              net.IP(o.Data[9:25]), o.Data[8],
+                              binary.BigEndian.Uint32(o.Data[0:4]),
+                              binary.BigEndian.Uint32(o.Data[4:8]))
+        }
+
+    case DNSServers, Unicast:
+        if len(o.Data) > 0 && len(o.Data) % 16 == 0 {
+            var addrs []string
+
+            for i := 0; i < len(o.Data); i += 16 {
+                addrs = append(addrs, net.IP(o.Data[i:i + 16]).String())
+            }
+
+            val = strings.Join(addrs, ",")
+        }
+
+    case StatusCodeOption:
+        if len(o.Data) >= 2 {
+            val = fmt.Sprintf("%d %q", binary.BigEndian.Uint16(o.Data),
+                              o.Data[2:])
+        }
+    }
+
+    if val == "" {
+        val = fmt.Sprintf("%x", o.Data)
+    }
+
+    return fmt.Sprintf("%d=%s", uint16(o.Code), val)
+}
+
+func (opts Options) String() string {
+    var s []string
+
+    for _, o := range opts {
+        s = append(s, o.String())
+    }
+
+    return "[" + strings.Join(s, " ") + "]"
+}
@@ -0,0 +1,304 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+// Provides encoding and decoding for DHCPv6 (RFC 8415) client/server and relay
+// agent messages, including their options.
+package dhcpv6
+
+import "fmt"
+import "net"
+
+import "github.com/ghedo/go.pkt/packet"
+
+type Packet struct {
+    MsgType  MessageType `string:"msg"`
+    Xid      uint32      `string:"xid"`
+    HopCount uint8       `string:"hops"`
+    LinkAddr net.IP      `string:"link"`
+    PeerAddr net.IP      `string:"peer"`
+    Options  Options     `string:"opts"`
+}
+
+type MessageType uint8
+
+const (
+    Solicit            MessageType = 1
+    Advertise                      = 2
+    Request                        = 3
+    Confirm                        = 4
+    Renew                          = 5
+    Rebind                         = 6
+    Reply                          = 7
+    Release                        = 8
+    Decline                        = 9
+    Reconfigure                    = 10
+    InformationRequest             = 11
+    RelayForw                      = 12
+    RelayRepl                      = 13
+)
+
+// Make a new client message with the given transaction ID and client DUID.
+func Make(msg_type MessageType, xid uint32, client_id DUID) *Packet {
+    return &Packet{
+        MsgType: msg_type,
+        Xid: xid & 0xffffff,
+        Options: Options{
+            { Code: ClientID, Data: client_id },
+        },
+    }
+}
+
+// Make a new relay message carrying the given message, as relayed by the agent
+// with the given link address on behalf of the given peer.
+func MakeRelay(msg_type MessageType, msg *Packet, link, peer net.IP) (*Packet, error) {
+    var b packet.Buffer
+    b.Init(make([]byte, msg.GetLength()))
+
+    err := msg.Pack(&b)
+    if err != nil {
+        return nil, err
+    }
+
+    hops := uint8(0)
+    if msg.IsRelay() {
+        hops = msg.HopCount + 1
+    }
+
+    return &Packet{
+        MsgType: msg_type,
+        HopCount: hops,
+        LinkAddr: link,
+        PeerAddr: peer,
+        Options: Options{
+            { Code: RelayMsg, Data: b.Buffer() },
+        },
+    }, nil
+}
+
+func (p *Packet) GetType() packet.Type {
+    return packet.DHCPv6
+}
+
+func (p *Packet) GetLength() uint16 {
+    if p.IsRelay() {
+        return uint16(34 + p.Options.Len())
+    }
+
+    return uint16(4 + p.Options.Len())
+}
+
+func (p *Packet) Equals(other packet.Packet) bool {
+    return packet.Compare(p, other)
+}
+
+// Check if the packet is an answer to another packet. Replies answer the client
+// message with the same transaction ID: advertises answer solicits, while
+// replies answer all the other messages (and solicits using rapid commit).
+// Relay replies answer relay forwards when the relayed messages match.
+func (p *Packet) Answers(other packet.Packet) bool {
+    if other == nil || other.GetType() != packet.DHCPv6 {
+        return false
+    }
+
+    req := other.(*Packet)
+
+    if p.MsgType == RelayRepl {
+        if req.MsgType != RelayForw || p.HopCount != req.HopCount ||
+           !p.LinkAddr.Equal(req.LinkAddr) ||
+           !p.PeerAddr.Equal(req.PeerAddr) {
+            return false
+        }
+
+        rsp_msg, err := p.RelayMessage()
+        if err != nil {
+            return false
+        }
+
+        req_msg, err := req.RelayMessage()
+        if err != nil {
+            return false
+        }
+
+        return rsp_msg.Answers(req_msg)
+    }
+
+    if p.Xid != req.Xid {
+        return false
+    }
+
+    switch p.MsgType {
+    case Advertise:
+        return req.MsgType == Solicit
+
+    case Reply:
+        switch req.MsgType {
+        case Solicit:
+            return p.Options.Find(RapidCommit) != nil
+
+        case Request, Confirm, Renew, Rebind, Release, Decline,
+             InformationRequest:
+            return true
+        }
+    }
+
+    return false
+}
+
+func (p *Packet) Pack(buf *packet.Buffer) error {
+    buf.WriteN(p.MsgType)
+
+    if p.IsRelay() {
+        buf.WriteN(p.HopCount)
+        write_addr(buf, p.LinkAddr)
+        write_addr(buf, p.PeerAddr)
+    } else {
+        if p.Xid > 0xffffff {
+            return fmt.Errorf("Invalid transaction ID 0x%x", p.Xid)
+        }
+
+        buf.WriteN(uint8(p.Xid >> 16))
+        buf.WriteN(uint16(p.Xid))
+    }
+
+    return p.Options.pack(buf)
+}
+
+func (p *Packet) Unpack(buf *packet.Buffer) error {
+    if buf.Len() < 4 {
+        return fmt.Errorf("Invalid DHCPv6 message length %d", buf.Len())
+    }
+
+    buf.ReadN(&p.MsgType)
+
+    p.Xid      = 0
+    p.HopCount = 0
+    p.LinkAddr = nil
+    p.PeerAddr = nil
+
+    if p.IsRelay() {
+        if buf.Len() < 33 {
+            return fmt.Errorf("Invalid relay message length %d", buf.Len())
+        }
+
+        buf.ReadN(&p.HopCount)
+
+        p.LinkAddr = net.IP(buf.Next(16))
+        p.PeerAddr = net.IP(buf.Next(16))
+    } else {
+        var xid_hi uint8
+        var xid_lo uint16
+
+        buf.ReadN(&xid_hi)
+        buf.ReadN(&xid_lo)
+
+        p.Xid = uint32(xid_hi) << 16 | uint32(xid_lo)
+    }
+
+    opts, err := ParseOptions(buf.Next(buf.Len()))
+    if err != nil {
+        return err
+    }
+
+    p.Options = opts
+
+    return nil
+}
+
+func (p *Packet) Payload() packet.Packet {
+    return nil
+}
+
+func (p *Packet) GuessPayloadType() packet.Type {
+    return packet.None
+}
+
+func (p *Packet) SetPayload(pl packet.Packet) error {
+    return nil
+}
+
+func (p *Packet) InitChecksum(csum uint32) {
+}
+
+func (p *Packet) String() string {
+    return packet.Stringify(p)
+}
+
+// Return whether the packet is a relay agent message.
+func (p *Packet) IsRelay() bool {
+    return p.MsgType == RelayForw || p.MsgType == RelayRepl
+}
+
+// Decode the message carried by a relay agent message.
+func (p *Packet) RelayMessage() (*Packet, error) {
+    data := p.Options.Find(RelayMsg)
+    if data == nil {
+        return nil, fmt.Errorf("No relay message")
+    }
+
+    var b packet.Buffer
+    b.Init(data)
+
+    msg := &Packet{}
+
+    err := msg.Unpack(&b)
+    if err != nil {
+        return nil, err
+    }
+
+    return msg, nil
+}
+
+/* addresses are always 16 bytes long, unset ones are all zeros */
+func write_addr(buf *packet.Buffer, addr net.IP) {
+    if ip6 := addr.To16(); ip6 != nil {
+        buf.Write(ip6)
+    } else {
+        buf.Write(net.IPv6zero)
+    }
+}
+
+func (t MessageType) String() string {
+    switch t {
+    case Solicit:            return "solicit"
+    case Advertise:          return "advertise"
+    case Request:            return "request"
+    case Confirm:            return "confirm"
+    case Renew:              return "renew"
+    case Rebind:             return "rebind"
+    case Reply:              return "reply"
+    case Release:            return "release"
+    case Decline:            return "decline"
+    case Reconfigure:        return "reconfigure"
+    case InformationRequest: return "information-request"
+    case RelayForw:          return "relay-forw"
+    case RelayRepl:          return "relay-repl"
+    default:                 return fmt.Sprintf("%d", uint8(t))
+    }
+}
@@ -0,0 +1,398 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package dhcpv6_test
+
+import "bytes"
+import "net"
+import "testing"
+import "time"
+
+import "github.com/ghedo/go.pkt/layers"
+import "github.com/ghedo/go.pkt/packet"
+import "github.com/ghedo/go.pkt/packet/dhcpv6"
+import "github.com/ghedo/go.pkt/packet/ipv6"
+import "github.com/ghedo/go.pkt/packet/udp"
+
+var test_hwaddr, _ = net.ParseMAC("00:0b:82:01:fc:42")
+
+var test_simple = []byte{
+    0x01, 0x10, 0x08, 0x74, 0x00, 0x01, 0x00, 0x0a,
+    0x00, 0x03, 0x00, 0x01, 0x00, 0x0b, 0x82, 0x01,
+    0xfc, 0x42, 0x00, 0x08, 0x00, 0x02, 0x00, 0x00,
+    0x00, 0x06, 0x00, 0x04, 0x00, 0x17, 0x00, 0x18,
+    0x00, 0x03, 0x00, 0x0c, 0x00, 0x00, 0x00, 0x01,
+    0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+}
+
+func MakeTestSimple() *dhcpv6.Packet {
+    p := dhcpv6.Make(dhcpv6.Solicit, 0x100874, dhcpv6.MakeDUIDLL(test_hwaddr))
+
+    p.Options.Set(dhcpv6.ElapsedTime, dhcpv6.MakeElapsedTime(0))
+    p.Options.Set(dhcpv6.OptionRequest,
+                  dhcpv6.MakeOptionRequest(dhcpv6.DNSServers,
+                                           dhcpv6.DomainList))
+    p.Options.Set(dhcpv6.IANA, dhcpv6.IA{ IAID: 1 }.Bytes())
+
+    return p
+}
+
+func TestPack(t *testing.T) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_simple)))
+
+    p := MakeTestSimple()
+
+    if int(p.GetLength()) != len(test_simple) {
+        t.Fatalf("Length mismatch: %d", p.GetLength())
+    }
+
+    err := p.Pack(&b)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if !bytes.Equal(test_simple, b.Buffer()) {
+        t.Fatalf("Raw packet mismatch: %x", b.Buffer())
+    }
+}
+
+func BenchmarkPack(bn *testing.B) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_simple)))
+
+    p := MakeTestSimple()
+
+    for n := 0; n < bn.N; n++ {
+        p.Pack(&b)
+    }
+}
+
+func TestUnpack(t *testing.T) {
+    var p dhcpv6.Packet
+
+    cmp := MakeTestSimple()
+
+    var b packet.Buffer
+    b.Init(test_simple)
+
+    err := p.Unpack(&b)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if !p.Equals(cmp) {
+        t.Fatalf("Packet mismatch:\n%s\n%s", &p, cmp)
+    }
+
+    oro := p.OptionRequest()
+    if len(oro) != 2 || oro[0] != dhcpv6.DNSServers ||
+       oro[1] != dhcpv6.DomainList {
+        t.Fatalf("Option request mismatch: %v", oro)
+    }
+}
+
+func BenchmarkUnpack(bn *testing.B) {
+    var p dhcpv6.Packet
+    var b packet.Buffer
+
+    for n := 0; n < bn.N; n++ {
+        b.Init(test_simple)
+        p.Unpack(&b)
+    }
+}
+
+func MakeTestReply() *dhcpv6.Packet {
+    p := dhcpv6.Make(dhcpv6.Reply, 0x100874, dhcpv6.MakeDUIDLL(test_hwaddr))
+
+    server_id := dhcpv6.MakeDUIDEN(32473, []byte{ 0x01, 0x02 })
+    p.Options.Set(dhcpv6.ServerID, server_id)
+
+    addr := dhcpv6.IAAddr{
+        Addr:      net.ParseIP("2001:db8::10"),
+        Preferred: time.Hour,
+        Valid:     2 * time.Hour,
+    }
+
+    p.Options.Set(dhcpv6.IANA, dhcpv6.IA{
+        IAID: 1,
+        T1:   30 * time.Minute,
+        T2:   48 * time.Minute,
+        Options: dhcpv6.Options{
+            { Code: dhcpv6.IAAddrOption, Data: addr.Bytes() },
+        },
+    }.Bytes())
+
+    _, prefix, _ := net.ParseCIDR("2001:db8:1000::/48")
+
+    pd := dhcpv6.IAPrefix{
+        Preferred: dhcpv6.Infinity,
+        Valid:     dhcpv6.Infinity,
+        Prefix:    prefix,
+    }
+
+    p.Options.Set(dhcpv6.IAPD, dhcpv6.IA{
+        IAID: 2,
+        Options: dhcpv6.Options{
+            { Code: dhcpv6.IAPrefixOption, Data: pd.Bytes() },
+            {
+                Code: dhcpv6.StatusCodeOption,
+                Data: dhcpv6.MakeStatus(dhcpv6.Success, "ok"),
+            },
+        },
+    }.Bytes())
+
+    p.Options.Set(dhcpv6.DNSServers,
+                  dhcpv6.MakeIPs(net.ParseIP("2001:db8::53")))
+
+    domains, _ := dhcpv6.MakeDomainList("example.com", "example.org")
+    p.Options.Set(dhcpv6.DomainList, domains)
+
+    return p
+}
+
+func TestOptions(t *testing.T) {
+    p := MakeTestReply()
+
+    buf := make([]byte, p.GetLength())
+
+    var b packet.Buffer
+    b.Init(buf)
+
+    err := p.Pack(&b)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    var p2 dhcpv6.Packet
+    b.Init(buf)
+
+    err = p2.Unpack(&b)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if !p2.Equals(p) {
+        t.Fatalf("Packet mismatch:\n%s\n%s", &p2, p)
+    }
+
+    na, err := p2.IANA()
+    if err != nil {
+        t.Fatalf("Error decoding IA_NA: %s", err)
+    }
+
+    if len(na) != 1 || na[0].IAID != 1 || na[0].T1 != 30 * time.Minute {
+        t.Fatalf("IA_NA mismatch: %v", na)
+    }
+
+    addrs, err := na[0].Addrs()
+    if err != nil {
+        t.Fatalf("Error decoding addresses: %s", err)
+    }
+
+    if len(addrs) != 1 || !addrs[0].Addr.Equal(net.ParseIP("2001:db8::10")) ||
+       addrs[0].Valid != 2 * time.Hour {
+        t.Fatalf("Addresses mismatch: %v", addrs)
+    }
+
+    pd, err := p2.IAPD()
+    if err != nil {
+        t.Fatalf("Error decoding IA_PD: %s", err)
+    }
+
+    prefixes, err := pd[0].Prefixes()
+    if err != nil {
+        t.Fatalf("Error decoding prefixes: %s", err)
+    }
+
+    if len(prefixes) != 1 ||
+       prefixes[0].Prefix.String() != "2001:db8:1000::/48" ||
+       prefixes[0].Valid != dhcpv6.Infinity {
+        t.Fatalf("Prefixes mismatch: %v", prefixes)
+    }
+
+    if code, msg := pd[0].Options.Status(); code != dhcpv6.Success ||
+       msg != "ok" {
+        t.Fatalf("Status mismatch: %d %s", code, msg)
+    }
+
+    dns := p2.Options.IPs(dhcpv6.DNSServers)
+    if len(dns) != 1 || !dns[0].Equal(net.ParseIP("2001:db8::53")) {
+        t.Fatalf("DNS servers mismatch: %v", dns)
+    }
+
+    domains, err := p2.DomainList()
+    if err != nil {
+        t.Fatalf("Error decoding domains: %s", err)
+    }
+
+    if len(domains) != 2 || domains[1] != "example.org" {
+        t.Fatalf("Domains mismatch: %v", domains)
+    }
+}
+
+func TestDUID(t *testing.T) {
+    now := time.Date(2020, time.June, 1, 12, 0, 0, 0, time.UTC)
+
+    d := dhcpv6.MakeDUIDLLT(test_hwaddr, now)
+    if d.Type() != dhcpv6.DUIDLLT || !d.Time().Equal(now) ||
+       d.HWAddr().String() != test_hwaddr.String() {
+        t.Fatalf("DUID-LLT mismatch: %s", d)
+    }
+
+    d = dhcpv6.MakeDUIDEN(32473, []byte{ 0x01, 0x02 })
+    if n, id := d.Enterprise(); n != 32473 || !bytes.Equal(id, []byte{ 1, 2 }) {
+        t.Fatalf("DUID-EN mismatch: %s", d)
+    }
+
+    if d.String() != "en(32473,0102)" {
+        t.Fatalf("DUID string mismatch: %s", d)
+    }
+}
+
+func TestRelay(t *testing.T) {
+    link := net.ParseIP("2001:db8::1")
+    peer := net.ParseIP("fe80::20b:82ff:fe01:fc42")
+
+    fwd, err := dhcpv6.MakeRelay(dhcpv6.RelayForw, MakeTestSimple(), link, peer)
+    if err != nil {
+        t.Fatalf("Error making relay: %s", err)
+    }
+
+    fwd.Options.Set(dhcpv6.InterfaceID, []byte("eth0"))
+
+    buf := make([]byte, fwd.GetLength())
+
+    var b packet.Buffer
+    b.Init(buf)
+
+    err = fwd.Pack(&b)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if !bytes.Equal(buf[34 + 4:34 + 4 + len(test_simple)], test_simple) {
+        t.Fatalf("Raw packet mismatch: %x", buf)
+    }
+
+    var p dhcpv6.Packet
+    b.Init(buf)
+
+    err = p.Unpack(&b)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if !p.Equals(fwd) || !p.PeerAddr.Equal(peer) {
+        t.Fatalf("Packet mismatch:\n%s\n%s", &p, fwd)
+    }
+
+    msg, err := p.RelayMessage()
+    if err != nil {
+        t.Fatalf("Error decoding relay message: %s", err)
+    }
+
+    if !msg.Equals(MakeTestSimple()) {
+        t.Fatalf("Relay message mismatch: %s", msg)
+    }
+
+    adv := MakeTestReply()
+    adv.MsgType = dhcpv6.Advertise
+
+    repl, err := dhcpv6.MakeRelay(dhcpv6.RelayRepl, adv, link, peer)
+    if err != nil {
+        t.Fatalf("Error making relay: %s", err)
+    }
+
+    if !repl.Answers(fwd) {
+        t.Fatalf("Relay reply doesn't answer relay forward")
+    }
+}
+
+func TestAnswers(t *testing.T) {
+    req := MakeTestSimple()
+    rsp := MakeTestReply()
+
+    if rsp.Answers(req) {
+        t.Fatalf("Reply answers solicit")
+    }
+
+    rsp.Options.Set(dhcpv6.RapidCommit, nil)
+
+    if !rsp.Answers(req) {
+        t.Fatalf("Rapid commit reply doesn't answer solicit")
+    }
+
+    rsp.MsgType = dhcpv6.Advertise
+
+    if !rsp.Answers(req) {
+        t.Fatalf("Advertise doesn't answer solicit")
+    }
+
+    req.MsgType = dhcpv6.Request
+
+    if rsp.Answers(req) {
+        t.Fatalf("Advertise answers request")
+    }
+
+    rsp.MsgType = dhcpv6.Reply
+    rsp.Xid     = 0x100875
+
+    if rsp.Answers(req) {
+        t.Fatalf("Reply answers request with different xid")
+    }
+}
+
+func TestUDP(t *testing.T) {
+    ip6_pkt := ipv6.Make()
+    ip6_pkt.SrcAddr = net.ParseIP("fe80::20b:82ff:fe01:fc42")
+    ip6_pkt.DstAddr = net.ParseIP("ff02::1:2")
+
+    udp_pkt := udp.Make()
+    udp_pkt.SrcPort = udp.DHCPv6Client
+    udp_pkt.DstPort = udp.DHCPv6Server
+
+    dhcp_pkt := MakeTestSimple()
+
+    buf, err := layers.Pack(ip6_pkt, udp_pkt, dhcp_pkt)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    p, err := layers.UnpackAll(buf, packet.IPv6)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    l := layers.FindLayer(p, packet.DHCPv6)
+    if l == nil || !l.Equals(dhcp_pkt) {
+        t.Fatalf("Packet mismatch: %s", p)
+    }
+}
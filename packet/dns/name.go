@@ -0,0 +1,267 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package dns
+
+import "fmt"
+import "strings"
+
+/* maximum number of compression pointers followed when decoding a name */
+const max_pointers = 64
+
+// Decode the domain name at the given offset of the message, following
+// compression pointers. Return the name (without the trailing dot) and the
+// offset following the name in the original position.
+func decode_name(msg []byte, off int) (string, int, error) {
+    var labels []string
+
+    end      := -1
+    pointers := 0
+    length   := 0
+
+    for {
+        if off >= len(msg) {
+            return "", 0, fmt.Errorf("Invalid name offset %d", off)
+        }
+
+        c := int(msg[off])
+
+        switch c & 0xc0 {
+        case 0x00:
+            if c == 0 {
+                if end < 0 {
+                    end = off + 1
+                }
+
+                return strings.Join(labels, "."), end, nil
+            }
+
+            if off + 1 + c > len(msg) {
+                return "", 0, fmt.Errorf("Invalid label length %d", c)
+            }
+
+            length += c + 1
+            if length > 255 {
+                return "", 0, fmt.Errorf("Invalid name length")
+            }
+
+            labels = append(labels, escape_label(msg[off + 1:off + 1 + c]))
+            off   += 1 + c
+
+        case 0xc0:
+            if off + 1 >= len(msg) {
+                return "", 0, fmt.Errorf("Invalid name pointer")
+            }
+
+            if end < 0 {
+                end = off + 2
+            }
+
+            pointers += 1
+            if pointers > max_pointers {
+                return "", 0, fmt.Errorf("Too many name pointers")
+            }
+
+            off = (c & 0x3f) << 8 | int(msg[off + 1])
+
+        default:
+            return "", 0, fmt.Errorf("Invalid label type 0x%x", c & 0xc0)
+        }
+    }
+}
+
+/* escape dots and non-printable characters in labels, like zone files do */
+func escape_label(label []byte) string {
+    var s strings.Builder
+
+    for _, c := range label {
+        switch {
+        case c == '.' || c == '\\':
+            s.WriteByte('\\')
+            s.WriteByte(c)
+
+        case c < 0x21 || c > 0x7e:
+            fmt.Fprintf(&s, "\\%03d", c)
+
+        default:
+            s.WriteByte(c)
+        }
+    }
+
+    return s.String()
+}
+
+/* split a name in its (unescaped) labels */
+func split_name(name string) ([][]byte, error) {
+    var labels [][]byte
+    var label []byte
+
+    name = strings.TrimSuffix(name, ".")
+
+    if name == "" {
+        return nil, nil
+    }
+
+    for i := 0; i < len(name); i++ {
+        c := name[i]
+
+        switch {
+        case c == '.':
+            labels = append(labels, label)
+            label  = nil
+
+        case c == '\\' && i + 3 < len(name) && is_digit(name[i + 1]) &&
+             is_digit(name[i + 2]) && is_digit(name[i + 3]):
+            v := int(name[i + 1] - '0') * 100 + int(name[i + 2] - '0') * 10 +
+                 int(name[i + 3] - '0')
+
+            if v > 255 {
+                return nil, fmt.Errorf("Invalid escape in name %s", name)
+            }
+
+            label = append(label, uint8(v))
+            i    += 3
+
+        case c == '\\' && i + 1 < len(name):
+            label = append(label, name[i + 1])
+            i    += 1
+
+        default:
+            label = append(label, c)
+        }
+    }
+
+    labels = append(labels, label)
+
+    length := 1
+
+    for _, l := range labels {
+        if len(l) == 0 || len(l) > 63 {
+            return nil, fmt.Errorf("Invalid label length in name %s", name)
+        }
+
+        length += len(l) + 1
+    }
+
+    if length > 255 {
+        return nil, fmt.Errorf("Invalid name length %d", length)
+    }
+
+    return labels, nil
+}
+
+func is_digit(c byte) bool {
+    return c >= '0' && c <= '9'
+}
+
+// Encode the given domain name in uncompressed wire format.
+func EncodeName(name string) ([]byte, error) {
+    labels, err := split_name(name)
+    if err != nil {
+        return nil, err
+    }
+
+    var data []byte
+
+    for _, l := range labels {
+        data = append(data, uint8(len(l)))
+        data = append(data, l...)
+    }
+
+    return append(data, 0), nil
+}
+
+// Decode the uncompressed domain name at the start of the given data, and
+// return it together with the number of bytes it takes.
+func DecodeName(data []byte) (string, int, error) {
+    for off := 0; off < len(data); off += int(data[off]) + 1 {
+        if data[off] & 0xc0 != 0 {
+            return "", 0, fmt.Errorf("Invalid label type 0x%x", data[off])
+        }
+
+        if data[off] == 0 {
+            return decode_name(data[:off + 1], 0)
+        }
+    }
+
+    return "", 0, fmt.Errorf("Invalid name")
+}
+
+/* message encoder keeping track of the names to compress */
+type encoder struct {
+    msg   []byte
+    names map[string]int
+}
+
+/* append a name to the message, compressing it when possible */
+func (e *encoder) name(name string, compress bool) error {
+    labels, err := split_name(name)
+    if err != nil {
+        return err
+    }
+
+    for i := range labels {
+        key := string(join_labels(labels[i:]))
+
+        if off, ok := e.names[key]; ok && compress {
+            e.msg = append(e.msg, 0xc0 | uint8(off >> 8), uint8(off))
+            return nil
+        }
+
+        /* only offsets that fit in the pointer can be referenced */
+        if len(e.msg) < 0x4000 {
+            if e.names == nil {
+                e.names = map[string]int{}
+            }
+
+            if _, ok := e.names[key]; !ok {
+                e.names[key] = len(e.msg)
+            }
+        }
+
+        e.msg = append(e.msg, uint8(len(labels[i])))
+        e.msg = append(e.msg, labels[i]...)
+    }
+
+    e.msg = append(e.msg, 0)
+
+    return nil
+}
+
+func join_labels(labels [][]byte) []byte {
+    var data []byte
+
+    for _, l := range labels {
+        data = append(data, uint8(len(l)))
+        data = append(data, l...)
+    }
+
+    return data
+}
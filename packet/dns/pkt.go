@@ -0,0 +1,457 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+// Provides encoding and decoding for DNS messages (RFC 1035), including the
+// multicast DNS (RFC 6762) and LLMNR (RFC 4795) variants and messages carried
+// over TCP. Domain names are compressed when the message is encoded.
+package dns
+
+import "encoding/binary"
+import "fmt"
+import "strings"
+
+import "github.com/ghedo/go.pkt/packet"
+
+type Packet struct {
+    Id         uint16    `string:"id"`
+    Flags      Flags     `string:"flags"`
+    Question   Questions `string:"qd"`
+    Answer     Records   `string:"an"`
+    Authority  Records   `string:"ns"`
+    Additional Records   `string:"ar"`
+    OverTCP    bool      `string:"skip"`
+}
+
+// Header flags, including the opcode and the response code.
+type Flags uint16
+
+const (
+    QR Flags = 0x8000
+    AA       = 0x0400
+    TC       = 0x0200
+    RD       = 0x0100
+    RA       = 0x0080
+    AD       = 0x0020
+    CD       = 0x0010
+)
+
+type Opcode uint8
+
+const (
+    Query  Opcode = 0
+    IQuery        = 1
+    Status        = 2
+    Notify        = 4
+    Update        = 5
+)
+
+type RCode uint16
+
+const (
+    NoError  RCode = 0
+    FormErr        = 1
+    ServFail       = 2
+    NXDomain       = 3
+    NotImp         = 4
+    Refused        = 5
+    YXDomain       = 6
+    NotAuth        = 9
+    BadVers        = 16
+)
+
+// Make a new recursive query for the given name and type.
+func Make(name string, t Type) *Packet {
+    return &Packet{
+        Flags: RD,
+        Question: Questions{ { Name: name, Type: t, Class: IN } },
+    }
+}
+
+func (p *Packet) GetType() packet.Type {
+    if p.OverTCP {
+        return packet.DNSTCP
+    }
+
+    return packet.DNS
+}
+
+func (p *Packet) GetLength() uint16 {
+    msg, _ := p.encode()
+
+    if p.OverTCP {
+        return uint16(len(msg)) + 2
+    }
+
+    return uint16(len(msg))
+}
+
+func (p *Packet) Equals(other packet.Packet) bool {
+    return packet.Compare(p, other)
+}
+
+// Check if the packet is an answer to another packet. Responses answer the
+// query with the same ID and questions. Multicast DNS responses, which usually
+// carry no questions, answer queries asking for any of their records.
+func (p *Packet) Answers(other packet.Packet) bool {
+    if other == nil || other.GetType() != p.GetType() {
+        return false
+    }
+
+    q := other.(*Packet)
+
+    if p.Flags & QR == 0 || q.Flags & QR != 0 || p.Id != q.Id {
+        return false
+    }
+
+    if len(p.Question) == 0 {
+        for _, question := range q.Question {
+            for _, rr := range p.Answer {
+                if question.Matches(rr) {
+                    return true
+                }
+            }
+        }
+
+        return len(q.Question) == 0
+    }
+
+    if len(p.Question) != len(q.Question) {
+        return false
+    }
+
+    for i := range p.Question {
+        if !strings.EqualFold(p.Question[i].Name, q.Question[i].Name) ||
+           p.Question[i].Type != q.Question[i].Type ||
+           p.Question[i].Class.Base() != q.Question[i].Class.Base() {
+            return false
+        }
+    }
+
+    return true
+}
+
+/* encode the message, without the TCP length prefix */
+func (p *Packet) encode() ([]byte, error) {
+    var e encoder
+
+    e.msg = make([]byte, 12, 512)
+
+    binary.BigEndian.PutUint16(e.msg[0:], p.Id)
+    binary.BigEndian.PutUint16(e.msg[2:], uint16(p.Flags))
+    binary.BigEndian.PutUint16(e.msg[4:], uint16(len(p.Question)))
+    binary.BigEndian.PutUint16(e.msg[6:], uint16(len(p.Answer)))
+    binary.BigEndian.PutUint16(e.msg[8:], uint16(len(p.Authority)))
+    binary.BigEndian.PutUint16(e.msg[10:], uint16(len(p.Additional)))
+
+    for _, q := range p.Question {
+        err := e.name(q.Name, true)
+        if err != nil {
+            return e.msg, err
+        }
+
+        e.msg = append(e.msg, uint8(q.Type >> 8), uint8(q.Type),
+                       uint8(q.Class >> 8), uint8(q.Class))
+    }
+
+    for _, section := range []Records{ p.Answer, p.Authority, p.Additional } {
+        for _, rr := range section {
+            err := e.name(rr.Name, true)
+            if err != nil {
+                return e.msg, err
+            }
+
+            e.msg = append(e.msg, uint8(rr.Type >> 8), uint8(rr.Type),
+                           uint8(rr.Class >> 8), uint8(rr.Class),
+                           uint8(rr.TTL >> 24), uint8(rr.TTL >> 16),
+                           uint8(rr.TTL >> 8), uint8(rr.TTL), 0, 0)
+
+            rdata_off := len(e.msg)
+
+            err = e.rdata(rr.Type, rr.Data)
+            if err != nil {
+                return e.msg, err
+            }
+
+            binary.BigEndian.PutUint16(e.msg[rdata_off - 2:],
+                                       uint16(len(e.msg) - rdata_off))
+        }
+    }
+
+    if len(e.msg) > 0xffff {
+        return e.msg, fmt.Errorf("Invalid DNS message length %d", len(e.msg))
+    }
+
+    return e.msg, nil
+}
+
+func (p *Packet) Pack(buf *packet.Buffer) error {
+    msg, err := p.encode()
+    if err != nil {
+        return err
+    }
+
+    if p.OverTCP {
+        buf.WriteN(uint16(len(msg)))
+    }
+
+    buf.Write(msg)
+
+    return nil
+}
+
+func (p *Packet) Unpack(buf *packet.Buffer) error {
+    if p.OverTCP {
+        var length uint16
+        buf.ReadN(&length)
+
+        if buf.Len() < int(length) {
+            return fmt.Errorf("Invalid DNS message length %d", length)
+        }
+
+        buf.Truncate(int(length))
+    }
+
+    msg := buf.Next(buf.Len())
+
+    if len(msg) < 12 {
+        return fmt.Errorf("Invalid DNS message length %d", len(msg))
+    }
+
+    p.Id    = binary.BigEndian.Uint16(msg[0:])
+    p.Flags = Flags(binary.BigEndian.Uint16(msg[2:]))
+
+    qdcount := int(binary.BigEndian.Uint16(msg[4:]))
+    ancount := int(binary.BigEndian.Uint16(msg[6:]))
+    nscount := int(binary.BigEndian.Uint16(msg[8:]))
+    arcount := int(binary.BigEndian.Uint16(msg[10:]))
+
+    off := 12
+
+    p.Question = nil
+
+    for i := 0; i < qdcount; i++ {
+        name, next, err := decode_name(msg, off)
+        if err != nil {
+            return err
+        }
+
+        if next + 4 > len(msg) {
+            return fmt.Errorf("Invalid question length")
+        }
+
+        p.Question = append(p.Question, Question{
+            Name:  name,
+            Type:  Type(binary.BigEndian.Uint16(msg[next:])),
+            Class: Class(binary.BigEndian.Uint16(msg[next + 2:])),
+        })
+
+        off = next + 4
+    }
+
+    var err error
+
+    p.Answer, off, err = unpack_records(msg, off, ancount)
+    if err != nil {
+        return err
+    }
+
+    p.Authority, off, err = unpack_records(msg, off, nscount)
+    if err != nil {
+        return err
+    }
+
+    p.Additional, _, err = unpack_records(msg, off, arcount)
+    if err != nil {
+        return err
+    }
+
+    return nil
+}
+
+func unpack_records(msg []byte, off, count int) (Records, int, error) {
+    var rrs Records
+
+    for i := 0; i < count; i++ {
+        name, next, err := decode_name(msg, off)
+        if err != nil {
+            return nil, 0, err
+        }
+
+        if next + 10 > len(msg) {
+            return nil, 0, fmt.Errorf("Invalid record length")
+        }
+
+        rr := RR{
+            Name:  name,
+            Type:  Type(binary.BigEndian.Uint16(msg[next:])),
+            Class: Class(binary.BigEndian.Uint16(msg[next + 2:])),
+            TTL:   binary.BigEndian.Uint32(msg[next + 4:]),
+        }
+
+        length := int(binary.BigEndian.Uint16(msg[next + 8:]))
+
+        rr.Data, err = unpack_rdata(msg, next + 10, length, rr.Type)
+        if err != nil {
+            return nil, 0, err
+        }
+
+        rrs = append(rrs, rr)
+        off = next + 10 + length
+    }
+
+    return rrs, off, nil
+}
+
+func (p *Packet) Payload() packet.Packet {
+    return nil
+}
+
+func (p *Packet) GuessPayloadType() packet.Type {
+    return packet.None
+}
+
+func (p *Packet) SetPayload(pl packet.Packet) error {
+    return nil
+}
+
+func (p *Packet) InitChecksum(csum uint32) {
+}
+
+func (p *Packet) String() string {
+    return packet.Stringify(p)
+}
+
+// Return whether the message is a response.
+func (p *Packet) IsResponse() bool {
+    return p.Flags & QR != 0
+}
+
+// Return the OPT record of the message, or nil if the message doesn't use
+// EDNS(0).
+func (p *Packet) OPT() *RR {
+    for i := range p.Additional {
+        if p.Additional[i].Type == OPT {
+            return &p.Additional[i]
+        }
+    }
+
+    return nil
+}
+
+// Return the response code, including the upper bits carried by the OPT
+// record, if present.
+func (p *Packet) RCode() RCode {
+    rcode := RCode(p.Flags.RCode())
+
+    if opt := p.OPT(); opt != nil {
+        rcode |= RCode(opt.ExtRCode()) << 4
+    }
+
+    return rcode
+}
+
+// Return the opcode of the message.
+func (f Flags) Opcode() Opcode {
+    return Opcode(f >> 11) & 0xf
+}
+
+// Return the lower 4 bits of the response code.
+func (f Flags) RCode() RCode {
+    return RCode(f & 0xf)
+}
+
+// Return the flags with the given opcode.
+func (f Flags) WithOpcode(op Opcode) Flags {
+    return f &^ 0x7800 | Flags(op & 0xf) << 11
+}
+
+// Return the flags with the given response code (only the lower 4 bits are
+// stored in the header).
+func (f Flags) WithRCode(rcode RCode) Flags {
+    return f &^ 0x000f | Flags(rcode & 0xf)
+}
+
+func (f Flags) String() string {
+    var flags []string
+
+    if f & QR != 0 {
+        flags = append(flags, "qr")
+    }
+
+    if f.Opcode() != Query {
+        flags = append(flags, f.Opcode().String())
+    }
+
+    names := []struct {
+        flag Flags
+        name string
+    }{
+        { AA, "aa" }, { TC, "tc" }, { RD, "rd" }, { RA, "ra" },
+        { AD, "ad" }, { CD, "cd" },
+    }
+
+    for _, n := range names {
+        if f & n.flag != 0 {
+            flags = append(flags, n.name)
+        }
+    }
+
+    if f.RCode() != NoError {
+        flags = append(flags, f.RCode().String())
+    }
+
+    return strings.Join(flags, "|")
+}
+
+func (o Opcode) String() string {
+    switch o {
+    case Query:  return "query"
+    case IQuery: return "iquery"
+    case Status: return "status"
+    case Notify: return "notify"
+    case Update: return "update"
+    default:     return fmt.Sprintf("opcode%d", uint8(o))
+    }
+}
+
+func (r RCode) String() string {
+    switch r {
+    case NoError:  return "noerror"
+    case FormErr:  return "formerr"
+    case ServFail: return "servfail"
+    case NXDomain: return "nxdomain"
+    case NotImp:   return "notimp"
+    case Refused:  return "refused"
+    case YXDomain: return "yxdomain"
+    case NotAuth:  return "notauth"
+    case BadVers:  return "badvers"
+    default:       return fmt.Sprintf("rcode%d", uint16(r))
+    }
+}
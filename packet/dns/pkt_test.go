@@ -0,0 +1,370 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package dns_test
+
+import "bytes"
+import "net"
+import "testing"
+
+import "github.com/ghedo/go.pkt/layers"
+import "github.com/ghedo/go.pkt/packet"
+import "github.com/ghedo/go.pkt/packet/dns"
+import "github.com/ghedo/go.pkt/packet/ipv4"
+import "github.com/ghedo/go.pkt/packet/tcp"
+import "github.com/ghedo/go.pkt/packet/udp"
+
+var test_simple = []byte{
+    0x12, 0x34, 0x81, 0x80, 0x00, 0x01, 0x00, 0x01, 0x00, 0x00, 0x00, 0x01,
+    0x07, 0x65, 0x78, 0x61, 0x6d, 0x70, 0x6c, 0x65, 0x03, 0x63, 0x6f, 0x6d,
+    0x00, 0x00, 0x01, 0x00, 0x01, 0xc0, 0x0c, 0x00, 0x01, 0x00, 0x01, 0x00,
+    0x00, 0x0e, 0x10, 0x00, 0x04, 0x5d, 0xb8, 0xd8, 0x22, 0x00, 0x00, 0x29,
+    0x10, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+}
+
+func MakeTestSimple() *dns.Packet {
+    return &dns.Packet{
+        Id: 0x1234,
+        Flags: dns.QR | dns.RD | dns.RA,
+        Question: dns.Questions{
+            { Name: "example.com", Type: dns.A, Class: dns.IN },
+        },
+        Answer: dns.Records{
+            {
+                Name: "example.com",
+                Type: dns.A,
+                Class: dns.IN,
+                TTL: 3600,
+                Data: []byte{ 93, 184, 216, 34 },
+            },
+        },
+        Additional: dns.Records{ dns.MakeOPT(4096, false, nil) },
+    }
+}
+
+func TestPack(t *testing.T) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_simple)))
+
+    p := MakeTestSimple()
+
+    if int(p.GetLength()) != len(test_simple) {
+        t.Fatalf("Length mismatch: %d", p.GetLength())
+    }
+
+    err := p.Pack(&b)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if !bytes.Equal(test_simple, b.Buffer()) {
+        t.Fatalf("Raw packet mismatch: %x", b.Buffer())
+    }
+}
+
+func BenchmarkPack(bn *testing.B) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_simple)))
+
+    p := MakeTestSimple()
+
+    for n := 0; n < bn.N; n++ {
+        p.Pack(&b)
+    }
+}
+
+func TestUnpack(t *testing.T) {
+    var p dns.Packet
+
+    cmp := MakeTestSimple()
+
+    var b packet.Buffer
+    b.Init(test_simple)
+
+    err := p.Unpack(&b)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if !p.Equals(cmp) {
+        t.Fatalf("Packet mismatch:\n%s\n%s", &p, cmp)
+    }
+
+    if !p.Answer[0].IP().Equal(net.ParseIP("93.184.216.34")) ||
+       p.OPT() == nil || p.OPT().UDPSize() != 4096 ||
+       p.RCode() != dns.NoError {
+        t.Fatalf("Packet mismatch: %s", &p)
+    }
+}
+
+func BenchmarkUnpack(bn *testing.B) {
+    var p dns.Packet
+    var b packet.Buffer
+
+    for n := 0; n < bn.N; n++ {
+        b.Init(test_simple)
+        p.Unpack(&b)
+    }
+}
+
+func TestRecords(t *testing.T) {
+    mx, _ := (&dns.MXData{ Preference: 10, Exchange: "mail.example.com" }).Bytes()
+    ns, _ := dns.EncodeName("ns.example.com")
+    txt, _ := dns.MakeTXT([]string{ "v=spf1 -all", "x" })
+    srv, _ := (&dns.SRVData{
+        Priority: 1, Weight: 2, Port: 5060, Target: "sip.example.com",
+    }).Bytes()
+    soa, _ := (&dns.SOAData{
+        MName: "ns.example.com", RName: "hostmaster.example.com",
+        Serial: 2024010101, Refresh: 7200, Retry: 3600, Expire: 1209600,
+        Minimum: 300,
+    }).Bytes()
+
+    p := &dns.Packet{
+        Id: 1,
+        Flags: dns.QR | dns.AA,
+        Question: dns.Questions{
+            { Name: "example.com", Type: dns.ANY, Class: dns.IN },
+        },
+        Answer: dns.Records{
+            { Name: "example.com", Type: dns.MX, Class: dns.IN, Data: mx },
+            { Name: "example.com", Type: dns.TXT, Class: dns.IN, Data: txt },
+            { Name: "_sip._udp.example.com", Type: dns.SRV, Class: dns.IN,
+              Data: srv },
+        },
+        Authority: dns.Records{
+            { Name: "example.com", Type: dns.NS, Class: dns.IN, Data: ns },
+            { Name: "example.com", Type: dns.SOA, Class: dns.IN, Data: soa },
+        },
+    }
+
+    buf, err := layers.Pack(p)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    /* names are compressed in the record data, but not in SRV targets */
+    if !bytes.Contains(buf, []byte{ 0x00, 0x0a, 0x04, 'm', 'a', 'i', 'l', 0xc0 }) ||
+       !bytes.Contains(buf, []byte{ 0x03, 's', 'i', 'p', 0x07 }) ||
+       len(buf) != int(p.GetLength()) {
+        t.Fatalf("Compression mismatch: %x", buf)
+    }
+
+    q, err := layers.UnpackAll(buf, packet.DNS)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if !q.Equals(p) {
+        t.Fatalf("Packet mismatch:\n%s\n%s", q, p)
+    }
+
+    rrs := q.(*dns.Packet).Answer
+
+    if m, err := rrs[0].MX(); err != nil || m.Exchange != "mail.example.com" {
+        t.Fatalf("MX mismatch: %v", rrs[0])
+    }
+
+    if s, err := rrs[1].TXT(); err != nil || len(s) != 2 || s[0] != "v=spf1 -all" {
+        t.Fatalf("TXT mismatch: %v", rrs[1])
+    }
+
+    if s, err := rrs[2].SRV(); err != nil || s.Port != 5060 || s.Target != "sip.example.com" {
+        t.Fatalf("SRV mismatch: %v", rrs[2])
+    }
+
+    rrs = q.(*dns.Packet).Authority
+
+    if s, err := rrs[1].SOA(); err != nil || s.Serial != 2024010101 ||
+       s.RName != "hostmaster.example.com" {
+        t.Fatalf("SOA mismatch: %v", rrs[1])
+    }
+}
+
+func TestNames(t *testing.T) {
+    for _, name := range []string{ "", "a.b", "dot\\.label.local", "x\\000y" } {
+        data, err := dns.EncodeName(name)
+        if err != nil {
+            t.Fatalf("Error encoding %s: %s", name, err)
+        }
+
+        dec, n, err := dns.DecodeName(data)
+        if err != nil || dec != name || n != len(data) {
+            t.Fatalf("Name mismatch: %s %s", name, dec)
+        }
+    }
+
+    long := string(bytes.Repeat([]byte{ 'a' }, 64))
+
+    if _, err := dns.EncodeName(long + ".com"); err == nil {
+        t.Fatalf("Long label accepted")
+    }
+
+    /* compression pointer loop */
+    var b packet.Buffer
+    b.Init([]byte{
+        0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+        0xc0, 0x0c, 0x00, 0x01, 0x00, 0x01,
+    })
+
+    var p dns.Packet
+
+    if err := p.Unpack(&b); err == nil {
+        t.Fatalf("Pointer loop accepted: %s", &p)
+    }
+}
+
+func TestUDP(t *testing.T) {
+    ip4_pkt := ipv4.Make()
+    ip4_pkt.SrcAddr = net.ParseIP("192.168.1.10")
+    ip4_pkt.DstAddr = net.ParseIP("192.168.1.1")
+
+    udp_pkt := udp.Make()
+    udp_pkt.SrcPort = 40000
+    udp_pkt.DstPort = udp.DNS
+
+    query := dns.Make("example.com", dns.A)
+    query.Id = 0x1234
+
+    buf, err := layers.Pack(ip4_pkt, udp_pkt, query)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    req, err := layers.UnpackAll(buf, packet.IPv4)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    rsp_ip4 := ipv4.Make()
+    rsp_ip4.SrcAddr = ip4_pkt.DstAddr
+    rsp_ip4.DstAddr = ip4_pkt.SrcAddr
+
+    rsp_udp := udp.Make()
+    rsp_udp.SrcPort = udp.DNS
+    rsp_udp.DstPort = 40000
+
+    buf, err = layers.Pack(rsp_ip4, rsp_udp, MakeTestSimple())
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    rsp, err := layers.UnpackAll(buf, packet.IPv4)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if layers.FindLayer(rsp, packet.DNS) == nil || !rsp.Answers(req) {
+        t.Fatalf("No answer: %s", rsp)
+    }
+
+    other := MakeTestSimple()
+    other.Question[0].Name = "example.org"
+
+    if other.Answers(layers.FindLayer(req, packet.DNS)) {
+        t.Fatalf("Unexpected answer: %s", other)
+    }
+}
+
+func TestMDNS(t *testing.T) {
+    query := dns.Make("printer.local", dns.A)
+    query.Flags = 0
+    query.Question[0].Class |= dns.CacheFlush
+
+    rsp := &dns.Packet{
+        Flags: dns.QR | dns.AA,
+        Answer: dns.Records{
+            {
+                Name: "printer.local",
+                Type: dns.A,
+                Class: dns.IN | dns.CacheFlush,
+                TTL: 120,
+                Data: []byte{ 192, 168, 1, 20 },
+            },
+        },
+    }
+
+    udp_pkt := udp.Make()
+    udp_pkt.SrcPort = udp.MDNS
+    udp_pkt.DstPort = udp.MDNS
+
+    buf, err := layers.Pack(udp_pkt, rsp)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    p, err := layers.UnpackAll(buf, packet.UDP)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if !p.Payload().Equals(rsp) || !rsp.Answers(query) {
+        t.Fatalf("Packet mismatch: %s", p)
+    }
+}
+
+func TestTCP(t *testing.T) {
+    tcp_pkt := tcp.Make()
+    tcp_pkt.SrcPort = tcp.DNS
+    tcp_pkt.DstPort = 40000
+
+    dns_pkt := MakeTestSimple()
+    dns_pkt.OverTCP = true
+
+    buf, err := layers.Pack(tcp_pkt, dns_pkt)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if !bytes.Equal(buf[20:22], []byte{ 0x00, uint8(len(test_simple)) }) ||
+       !bytes.Equal(buf[22:], test_simple) {
+        t.Fatalf("Raw packet mismatch: %x", buf)
+    }
+
+    p, err := layers.UnpackAll(buf, packet.TCP)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if p.Payload() == nil || p.Payload().GetType() != packet.DNSTCP ||
+       !p.Payload().Equals(dns_pkt) {
+        t.Fatalf("Packet mismatch: %s", p)
+    }
+
+    /* partial messages are not decoded */
+    p, err = layers.UnpackAll(buf[:len(buf) - 1], packet.TCP)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if p.Payload().GetType() != packet.Raw {
+        t.Fatalf("Packet mismatch: %s", p)
+    }
+}
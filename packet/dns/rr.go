@@ -0,0 +1,749 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package dns
+
+import "bytes"
+import "encoding/binary"
+import "encoding/hex"
+import "fmt"
+import "net"
+import "strconv"
+import "strings"
+
+// Resource record type.
+type Type uint16
+
+const (
+    A      Type = 1
+    NS          = 2
+    CNAME       = 5
+    SOA         = 6
+    PTR         = 12
+    HINFO       = 13
+    MX          = 15
+    TXT         = 16
+    AAAA        = 28
+    SRV         = 33
+    NAPTR       = 35
+    DNAME       = 39
+    OPT         = 41
+    DS          = 43
+    RRSIG       = 46
+    NSEC        = 47
+    DNSKEY      = 48
+    NSEC3       = 50
+    SVCB        = 64
+    HTTPS       = 65
+    AXFR        = 252
+    ANY         = 255
+    CAA         = 257
+)
+
+// Resource record class. In mDNS messages the most significant bit is used as
+// the unicast-response bit in questions and as the cache-flush bit in
+// resource records.
+type Class uint16
+
+const (
+    IN         Class = 1
+    CH               = 3
+    HS               = 4
+    ClassNone        = 254
+    ClassAny         = 255
+    CacheFlush       = 0x8000
+)
+
+type Question struct {
+    Name  string
+    Type  Type
+    Class Class
+}
+
+// Resource record. The data is stored in uncompressed wire format, and can be
+// decoded with the methods matching the record type.
+type RR struct {
+    Name  string
+    Type  Type
+    Class Class
+    TTL   uint32
+    Data  []byte
+}
+
+type Questions []Question
+
+type Records []RR
+
+// MX record data.
+type MXData struct {
+    Preference uint16
+    Exchange   string
+}
+
+// SOA record data.
+type SOAData struct {
+    MName   string
+    RName   string
+    Serial  uint32
+    Refresh uint32
+    Retry   uint32
+    Expire  uint32
+    Minimum uint32
+}
+
+// SRV record data.
+type SRVData struct {
+    Priority uint16
+    Weight   uint16
+    Port     uint16
+    Target   string
+}
+
+// DS record data.
+type DSData struct {
+    KeyTag     uint16
+    Algorithm  uint8
+    DigestType uint8
+    Digest     []byte
+}
+
+// DNSKEY record data.
+type DNSKEYData struct {
+    Flags     uint16
+    Protocol  uint8
+    Algorithm uint8
+    PublicKey []byte
+}
+
+// RRSIG record data.
+type RRSIGData struct {
+    TypeCovered Type
+    Algorithm   uint8
+    Labels      uint8
+    OrigTTL     uint32
+    Expiration  uint32
+    Inception   uint32
+    KeyTag      uint16
+    SignerName  string
+    Signature   []byte
+}
+
+// EDNS(0) option, as carried by OPT records.
+type EDNSOption struct {
+    Code uint16
+    Data []byte
+}
+
+// EDNS(0) option codes.
+const (
+    OptionNSID         uint16 = 3
+    OptionClientSubnet        = 8
+    OptionCookie              = 10
+    OptionPadding             = 12
+)
+
+/*
+ * Layout of the record types with domain names in their data: the length of
+ * the fixed fields before the names, the number of names, and whether the
+ * names may be compressed (RFC 3597 section 4).
+ */
+type rdata_layout struct {
+    prefix   int
+    names    int
+    compress bool
+}
+
+var rdata_layouts = map[Type]rdata_layout{
+    NS:    { 0, 1, true  },
+    CNAME: { 0, 1, true  },
+    SOA:   { 0, 2, true  },
+    PTR:   { 0, 1, true  },
+    MX:    { 2, 1, true  },
+    SRV:   { 6, 1, false },
+    DNAME: { 0, 1, false },
+}
+
+/* decode the record data at the given offset of the message */
+func unpack_rdata(msg []byte, off, length int, t Type) ([]byte, error) {
+    end := off + length
+
+    if end > len(msg) {
+        return nil, fmt.Errorf("Invalid record data length %d", length)
+    }
+
+    layout, ok := rdata_layouts[t]
+    if !ok || length == 0 {
+        return msg[off:end], nil
+    }
+
+    if length < layout.prefix {
+        return nil, fmt.Errorf("Invalid %s record length %d", t, length)
+    }
+
+    data := append([]byte{}, msg[off:off + layout.prefix]...)
+    off  += layout.prefix
+
+    for i := 0; i < layout.names; i++ {
+        name, next, err := decode_name(msg[:end], off)
+        if err != nil {
+            return nil, err
+        }
+
+        enc, err := EncodeName(name)
+        if err != nil {
+            return nil, err
+        }
+
+        data = append(data, enc...)
+        off  = next
+    }
+
+    return append(data, msg[off:end]...), nil
+}
+
+/* encode the record data, compressing the domain names where allowed */
+func (e *encoder) rdata(t Type, data []byte) error {
+    layout, ok := rdata_layouts[t]
+    if !ok || len(data) < layout.prefix {
+        e.msg = append(e.msg, data...)
+        return nil
+    }
+
+    e.msg = append(e.msg, data[:layout.prefix]...)
+    data  = data[layout.prefix:]
+
+    for i := 0; i < layout.names; i++ {
+        name, n, err := DecodeName(data)
+        if err != nil {
+            return err
+        }
+
+        err = e.name(name, layout.compress)
+        if err != nil {
+            return err
+        }
+
+        data = data[n:]
+    }
+
+    e.msg = append(e.msg, data...)
+
+    return nil
+}
+
+func (q Question) Equal(other Question) bool {
+    return q.Name == other.Name && q.Type == other.Type &&
+           q.Class == other.Class
+}
+
+// Check whether the question asks for the given record, ignoring the case of
+// the name and the mDNS unicast-response bit.
+func (q Question) Matches(rr RR) bool {
+    if !strings.EqualFold(q.Name, rr.Name) {
+        return false
+    }
+
+    if q.Type != ANY && q.Type != rr.Type && rr.Type != CNAME {
+        return false
+    }
+
+    return q.Class.Base() == ClassAny || q.Class.Base() == rr.Class.Base()
+}
+
+func (q Question) String() string {
+    return fmt.Sprintf("%s %s %s", q.Name, q.Class, q.Type)
+}
+
+func (rr RR) Equal(other RR) bool {
+    return rr.Name == other.Name && rr.Type == other.Type &&
+           rr.Class == other.Class && rr.TTL == other.TTL &&
+           bytes.Equal(rr.Data, other.Data)
+}
+
+func (rr RR) String() string {
+    if rr.Type == OPT {
+        return fmt.Sprintf("OPT udp=%d ver=%d do=%t", rr.UDPSize(),
+                           rr.Version(), rr.DNSSECOK())
+    }
+
+    return fmt.Sprintf("%s %d %s %s %s", rr.Name, rr.TTL, rr.Class, rr.Type,
+                       rr.DataString())
+}
+
+// Return the presentation format of the record data.
+func (rr RR) DataString() string {
+    switch rr.Type {
+    case A, AAAA:
+        if ip := rr.IP(); ip != nil {
+            return ip.String()
+        }
+
+    case NS, CNAME, PTR, DNAME:
+        if target, err := rr.Target(); err == nil {
+            return target
+        }
+
+    case MX:
+        if mx, err := rr.MX(); err == nil {
+            return fmt.Sprintf("%d %s", mx.Preference, mx.Exchange)
+        }
+
+    case SOA:
+        if soa, err := rr.SOA(); err == nil {
+            return fmt.Sprintf("%s %s %d %d %d %d %d", soa.MName, soa.RName,
+                               soa.Serial, soa.Refresh, soa.Retry,
+                               soa.Expire, soa.Minimum)
+        }
+
+    case SRV:
+        if srv, err := rr.SRV(); err == nil {
+            return fmt.Sprintf("%d %d %d %s", srv.Priority, srv.Weight,
+                               srv.Port, srv.Target)
+        }
+
+    case TXT:
+        if txt, err := rr.TXT(); err == nil {
+            var quoted []string
+
+            for _, s := range txt {
+                quoted = append(quoted, strconv.Quote(s))
+            }
+
+            return strings.Join(quoted, " ")
+        }
+
+    case DS:
+        if ds, err := rr.DS(); err == nil {
+            return fmt.Sprintf("%d %d %d %x", ds.KeyTag, ds.Algorithm,
+                               ds.DigestType, ds.Digest)
+        }
+    }
+
+    return hex.EncodeToString(rr.Data)
+}
+
+// Return the address of A and AAAA records.
+func (rr RR) IP() net.IP {
+    switch {
+    case rr.Type == A && len(rr.Data) == 4:
+        return net.IP(rr.Data).To16()
+
+    case rr.Type == AAAA && len(rr.Data) == 16:
+        return net.IP(rr.Data)
+    }
+
+    return nil
+}
+
+// Return the domain name of NS, CNAME, PTR and DNAME records.
+func (rr RR) Target() (string, error) {
+    switch rr.Type {
+    case NS, CNAME, PTR, DNAME:
+        name, _, err := DecodeName(rr.Data)
+        return name, err
+    }
+
+    return "", fmt.Errorf("No target in %s record", rr.Type)
+}
+
+// Decode the data of MX records.
+func (rr RR) MX() (*MXData, error) {
+    if rr.Type != MX || len(rr.Data) < 3 {
+        return nil, fmt.Errorf("Invalid MX record")
+    }
+
+    name, _, err := DecodeName(rr.Data[2:])
+    if err != nil {
+        return nil, err
+    }
+
+    return &MXData{
+        Preference: binary.BigEndian.Uint16(rr.Data),
+        Exchange:   name,
+    }, nil
+}
+
+// Decode the data of SOA records.
+func (rr RR) SOA() (*SOAData, error) {
+    if rr.Type != SOA {
+        return nil, fmt.Errorf("Invalid SOA record")
+    }
+
+    mname, n, err := DecodeName(rr.Data)
+    if err != nil {
+        return nil, err
+    }
+
+    rname, m, err := DecodeName(rr.Data[n:])
+    if err != nil {
+        return nil, err
+    }
+
+    d := rr.Data[n + m:]
+
+    if len(d) != 20 {
+        return nil, fmt.Errorf("Invalid SOA record length %d", len(rr.Data))
+    }
+
+    return &SOAData{
+        MName:   mname,
+        RName:   rname,
+        Serial:  binary.BigEndian.Uint32(d[0:]),
+        Refresh: binary.BigEndian.Uint32(d[4:]),
+        Retry:   binary.BigEndian.Uint32(d[8:]),
+        Expire:  binary.BigEndian.Uint32(d[12:]),
+        Minimum: binary.BigEndian.Uint32(d[16:]),
+    }, nil
+}
+
+// Decode the data of SRV records.
+func (rr RR) SRV() (*SRVData, error) {
+    if rr.Type != SRV || len(rr.Data) < 7 {
+        return nil, fmt.Errorf("Invalid SRV record")
+    }
+
+    name, _, err := DecodeName(rr.Data[6:])
+    if err != nil {
+        return nil, err
+    }
+
+    return &SRVData{
+        Priority: binary.BigEndian.Uint16(rr.Data[0:]),
+        Weight:   binary.BigEndian.Uint16(rr.Data[2:]),
+        Port:     binary.BigEndian.Uint16(rr.Data[4:]),
+        Target:   name,
+    }, nil
+}
+
+// Decode the character strings of TXT records.
+func (rr RR) TXT() ([]string, error) {
+    if rr.Type != TXT {
+        return nil, fmt.Errorf("Invalid TXT record")
+    }
+
+    var txt []string
+
+    for d := rr.Data; len(d) > 0; {
+        length := int(d[0])
+
+        if len(d) < length + 1 {
+            return nil, fmt.Errorf("Invalid TXT string length %d", length)
+        }
+
+        txt = append(txt, string(d[1:length + 1]))
+        d   = d[length + 1:]
+    }
+
+    return txt, nil
+}
+
+// Decode the data of DS records.
+func (rr RR) DS() (*DSData, error) {
+    if rr.Type != DS || len(rr.Data) < 4 {
+        return nil, fmt.Errorf("Invalid DS record")
+    }
+
+    return &DSData{
+        KeyTag:     binary.BigEndian.Uint16(rr.Data),
+        Algorithm:  rr.Data[2],
+        DigestType: rr.Data[3],
+        Digest:     rr.Data[4:],
+    }, nil
+}
+
+// Decode the data of DNSKEY records.
+func (rr RR) DNSKEY() (*DNSKEYData, error) {
+    if rr.Type != DNSKEY || len(rr.Data) < 4 {
+        return nil, fmt.Errorf("Invalid DNSKEY record")
+    }
+
+    return &DNSKEYData{
+        Flags:     binary.BigEndian.Uint16(rr.Data),
+        Protocol:  rr.Data[2],
+        Algorithm: rr.Data[3],
+        PublicKey: rr.Data[4:],
+    }, nil
+}
+
+// Decode the data of RRSIG records.
+func (rr RR) RRSIG() (*RRSIGData, error) {
+    if rr.Type != RRSIG || len(rr.Data) < 19 {
+        return nil, fmt.Errorf("Invalid RRSIG record")
+    }
+
+    d := rr.Data
+
+    signer, n, err := DecodeName(d[18:])
+    if err != nil {
+        return nil, err
+    }
+
+    return &RRSIGData{
+        TypeCovered: Type(binary.BigEndian.Uint16(d[0:])),
+        Algorithm:   d[2],
+        Labels:      d[3],
+        OrigTTL:     binary.BigEndian.Uint32(d[4:]),
+        Expiration:  binary.BigEndian.Uint32(d[8:]),
+        Inception:   binary.BigEndian.Uint32(d[12:]),
+        KeyTag:      binary.BigEndian.Uint16(d[16:]),
+        SignerName:  signer,
+        Signature:   d[18 + n:],
+    }, nil
+}
+
+// Return the requestor's UDP payload size of OPT records.
+func (rr RR) UDPSize() uint16 {
+    return uint16(rr.Class)
+}
+
+// Return the upper 8 bits of the extended response code of OPT records.
+func (rr RR) ExtRCode() uint8 {
+    return uint8(rr.TTL >> 24)
+}
+
+// Return the EDNS version of OPT records.
+func (rr RR) Version() uint8 {
+    return uint8(rr.TTL >> 16)
+}
+
+// Return whether the DNSSEC OK bit of OPT records is set.
+func (rr RR) DNSSECOK() bool {
+    return rr.TTL & 0x8000 != 0
+}
+
+// Decode the EDNS(0) options of OPT records.
+func (rr RR) Options() ([]EDNSOption, error) {
+    if rr.Type != OPT {
+        return nil, fmt.Errorf("Invalid OPT record")
+    }
+
+    var opts []EDNSOption
+
+    for d := rr.Data; len(d) > 0; {
+        if len(d) < 4 {
+            return nil, fmt.Errorf("Invalid EDNS option length")
+        }
+
+        length := int(binary.BigEndian.Uint16(d[2:]))
+
+        if len(d) < 4 + length {
+            return nil, fmt.Errorf("Invalid EDNS option length %d", length)
+        }
+
+        opts = append(opts, EDNSOption{
+            Code: binary.BigEndian.Uint16(d),
+            Data: d[4:4 + length],
+        })
+
+        d = d[4 + length:]
+    }
+
+    return opts, nil
+}
+
+// Make an OPT record with the given UDP payload size, DNSSEC OK bit and
+// options.
+func MakeOPT(udp_size uint16, dnssec_ok bool, opts []EDNSOption) RR {
+    rr := RR{ Type: OPT, Class: Class(udp_size) }
+
+    if dnssec_ok {
+        rr.TTL |= 0x8000
+    }
+
+    for _, o := range opts {
+        rr.Data = append(rr.Data, uint8(o.Code >> 8), uint8(o.Code),
+                         uint8(len(o.Data) >> 8), uint8(len(o.Data)))
+        rr.Data = append(rr.Data, o.Data...)
+    }
+
+    return rr
+}
+
+// Encode the given character strings as TXT record data.
+func MakeTXT(txt []string) ([]byte, error) {
+    var data []byte
+
+    for _, s := range txt {
+        if len(s) > 255 {
+            return nil, fmt.Errorf("Invalid TXT string length %d", len(s))
+        }
+
+        data = append(data, uint8(len(s)))
+        data = append(data, s...)
+    }
+
+    return data, nil
+}
+
+// Encode the MX record data.
+func (mx *MXData) Bytes() ([]byte, error) {
+    name, err := EncodeName(mx.Exchange)
+    if err != nil {
+        return nil, err
+    }
+
+    return append([]byte{ uint8(mx.Preference >> 8), uint8(mx.Preference) },
+                  name...), nil
+}
+
+// Encode the SOA record data.
+func (soa *SOAData) Bytes() ([]byte, error) {
+    mname, err := EncodeName(soa.MName)
+    if err != nil {
+        return nil, err
+    }
+
+    rname, err := EncodeName(soa.RName)
+    if err != nil {
+        return nil, err
+    }
+
+    d := make([]byte, 20)
+
+    binary.BigEndian.PutUint32(d[0:], soa.Serial)
+    binary.BigEndian.PutUint32(d[4:], soa.Refresh)
+    binary.BigEndian.PutUint32(d[8:], soa.Retry)
+    binary.BigEndian.PutUint32(d[12:], soa.Expire)
+    binary.BigEndian.PutUint32(d[16:], soa.Minimum)
+
+    return append(append(mname, rname...), d...), nil
+}
+
+// Encode the SRV record data.
+func (srv *SRVData) Bytes() ([]byte, error) {
+    target, err := EncodeName(srv.Target)
+    if err != nil {
+        return nil, err
+    }
+
+    d := make([]byte, 6)
+
+    binary.BigEndian.PutUint16(d[0:], srv.Priority)
+    binary.BigEndian.PutUint16(d[2:], srv.Weight)
+    binary.BigEndian.PutUint16(d[4:], srv.Port)
+
+    return append(d, target...), nil
+}
+
+// Compute the key tag of the DNSKEY record data (RFC 4034 appendix B).
+func (key *DNSKEYData) KeyTag() uint16 {
+    d := []byte{
+        uint8(key.Flags >> 8), uint8(key.Flags), key.Protocol, key.Algorithm,
+    }
+
+    d = append(d, key.PublicKey...)
+
+    var ac uint32
+
+    for i, c := range d {
+        if i & 1 != 0 {
+            ac += uint32(c)
+        } else {
+            ac += uint32(c) << 8
+        }
+    }
+
+    ac += ac >> 16 & 0xffff
+
+    return uint16(ac)
+}
+
+// Return the class without the mDNS unicast-response or cache-flush bit.
+func (c Class) Base() Class {
+    return c &^ CacheFlush
+}
+
+func (qs Questions) String() string {
+    var s []string
+
+    for _, q := range qs {
+        s = append(s, q.String())
+    }
+
+    return "[" + strings.Join(s, ", ") + "]"
+}
+
+func (rrs Records) String() string {
+    var s []string
+
+    for _, rr := range rrs {
+        s = append(s, rr.String())
+    }
+
+    return "[" + strings.Join(s, ", ") + "]"
+}
+
+func (t Type) String() string {
+    switch t {
+    case A:      return "A"
+    case NS:     return "NS"
+    case CNAME:  return "CNAME"
+    case SOA:    return "SOA"
+    case PTR:    return "PTR"
+    case HINFO:  return "HINFO"
+    case MX:     return "MX"
+    case TXT:    return "TXT"
+    case AAAA:   return "AAAA"
+    case SRV:    return "SRV"
+    case NAPTR:  return "NAPTR"
+    case DNAME:  return "DNAME"
+    case OPT:    return "OPT"
+    case DS:     return "DS"
+    case RRSIG:  return "RRSIG"
+    case NSEC:   return "NSEC"
+    case DNSKEY: return "DNSKEY"
+    case NSEC3:  return "NSEC3"
+    case SVCB:   return "SVCB"
+    case HTTPS:  return "HTTPS"
+    case AXFR:   return "AXFR"
+    case ANY:    return "ANY"
+    case CAA:    return "CAA"
+    default:     return fmt.Sprintf("TYPE%d", uint16(t))
+    }
+}
+
+func (c Class) String() string {
+    var s string
+
+    switch c.Base() {
+    case IN:        s = "IN"
+    case CH:        s = "CH"
+    case HS:        s = "HS"
+    case ClassNone: s = "NONE"
+    case ClassAny:  s = "ANY"
+    default:        s = fmt.Sprintf("CLASS%d", uint16(c.Base()))
+    }
+
+    if c & CacheFlush != 0 {
+        s += "/flush"
+    }
+
+    return s
+}
@@ -0,0 +1,313 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+// Provides encoding and decoding for EAPOL (802.1X EAP over LAN) packets,
+// including EAPOL-Key frames used by the WPA/WPA2 handshakes.
+package eapol
+
+import "bytes"
+import "fmt"
+import "strings"
+
+import "github.com/ghedo/go.pkt/packet"
+
+type Packet struct {
+    Version       uint8
+    Type          Type
+    Length        uint16        `string:"len"`
+
+    /* EAPOL-Key frames */
+    DescType      uint8         `string:"desc"`
+    KeyInfo       KeyInfo       `string:"info"`
+    KeyLength     uint16        `string:"keylen"`
+    ReplayCounter uint64        `string:"replay"`
+    Nonce         []byte        `string:"skip"`
+    IV            []byte        `string:"skip"`
+    RSC           uint64        `string:"rsc"`
+    MIC           []byte        `string:"skip"`
+    Data          []byte        `string:"skip"`
+
+    pkt_payload   packet.Packet `cmp:"skip" string:"skip"`
+}
+
+type Type uint8
+
+const (
+    EAP Type = 0
+    Start    = 1
+    Logoff   = 2
+    Key      = 3
+    Alert    = 4
+)
+
+type KeyInfo uint16
+
+const (
+    KeyVersionMask KeyInfo = 0x0007
+    KeyPairwise            = 0x0008
+    KeyInstall             = 0x0040
+    KeyAck                 = 0x0080
+    KeyMIC                 = 0x0100
+    KeySecure              = 0x0200
+    KeyError               = 0x0400
+    KeyRequest             = 0x0800
+    KeyEncrypted           = 0x1000
+)
+
+const (
+    DescRC4 uint8 = 1
+    DescRSN       = 2
+    DescWPA       = 254
+)
+
+func Make() *Packet {
+    return &Packet{
+        Version: 2,
+        Type: Key,
+        DescType: DescRSN,
+        Nonce: make([]byte, 32),
+        IV: make([]byte, 16),
+        MIC: make([]byte, 16),
+    }
+}
+
+func (p *Packet) GetType() packet.Type {
+    return packet.EAPOL
+}
+
+func (p *Packet) GetLength() uint16 {
+    if p.Type == Key {
+        return 4 + 95 + uint16(len(p.Data))
+    }
+
+    if p.pkt_payload != nil {
+        return p.pkt_payload.GetLength() + 4
+    }
+
+    return 4
+}
+
+func (p *Packet) Equals(other packet.Packet) bool {
+    return packet.Compare(p, other)
+}
+
+func (p *Packet) Answers(other packet.Packet) bool {
+    if other == nil || other.GetType() != packet.EAPOL {
+        return false
+    }
+
+    o := other.(*Packet)
+
+    if p.Type != Key || o.Type != Key {
+        return false
+    }
+
+    /* handshake messages 2 and 4 answer messages 1 and 3 respectively */
+    return p.KeyInfo & KeyAck == 0 && o.KeyInfo & KeyAck != 0 &&
+           p.ReplayCounter == o.ReplayCounter
+}
+
+func (p *Packet) Pack(buf *packet.Buffer) error {
+    if p.Type == Key && p.Length == 0 {
+        p.Length = p.GetLength() - 4
+    }
+
+    buf.WriteN(p.Version)
+    buf.WriteN(p.Type)
+    buf.WriteN(p.Length)
+
+    if p.Type != Key {
+        return nil
+    }
+
+    buf.WriteN(p.DescType)
+    buf.WriteN(p.KeyInfo)
+    buf.WriteN(p.KeyLength)
+    buf.WriteN(p.ReplayCounter)
+    write_fixed(buf, p.Nonce, 32)
+    write_fixed(buf, p.IV, 16)
+    buf.WriteN(p.RSC)
+    buf.WriteN(uint64(0))
+    write_fixed(buf, p.MIC, 16)
+    buf.WriteN(uint16(len(p.Data)))
+    buf.Write(p.Data)
+
+    return nil
+}
+
+func write_fixed(buf *packet.Buffer, data []byte, length int) {
+    buf.Write(data)
+
+    for i := len(data); i < length; i++ {
+        buf.WriteN(uint8(0x00))
+    }
+}
+
+func (p *Packet) Unpack(buf *packet.Buffer) error {
+    buf.ReadN(&p.Version)
+    buf.ReadN(&p.Type)
+    buf.ReadN(&p.Length)
+
+    if int(p.Length) < buf.Len() {
+        buf.Truncate(int(p.Length))
+    }
+
+    if p.Type != Key {
+        return nil
+    }
+
+    if buf.Len() < 95 {
+        return fmt.Errorf("Invalid EAPOL-Key length %d", buf.Len())
+    }
+
+    buf.ReadN(&p.DescType)
+    buf.ReadN(&p.KeyInfo)
+    buf.ReadN(&p.KeyLength)
+    buf.ReadN(&p.ReplayCounter)
+    p.Nonce = buf.Next(32)
+    p.IV    = buf.Next(16)
+    buf.ReadN(&p.RSC)
+    buf.Next(8)
+    p.MIC   = buf.Next(16)
+
+    var data_len uint16
+    buf.ReadN(&data_len)
+
+    if int(data_len) > buf.Len() {
+        return fmt.Errorf("Invalid EAPOL-Key data length %d", data_len)
+    }
+
+    p.Data = buf.Next(int(data_len))
+
+    return nil
+}
+
+func (p *Packet) Payload() packet.Packet {
+    return p.pkt_payload
+}
+
+func (p *Packet) GuessPayloadType() packet.Type {
+    if p.Type == EAP {
+        return packet.Raw
+    }
+
+    return packet.None
+}
+
+func (p *Packet) SetPayload(pl packet.Packet) error {
+    p.pkt_payload = pl
+    p.Length      = p.GetLength() - 4
+
+    return nil
+}
+
+func (p *Packet) InitChecksum(csum uint32) {
+}
+
+func (p *Packet) String() string {
+    return packet.Stringify(p)
+}
+
+// Return the number of the 4-way handshake message (from 1 to 4) carried by
+// the EAPOL-Key frame, or 0 if it's not part of a pairwise handshake.
+func (p *Packet) HandshakeMessage() int {
+    if p.Type != Key || p.KeyInfo & KeyPairwise == 0 {
+        return 0
+    }
+
+    switch {
+    case p.KeyInfo & KeyAck != 0 && p.KeyInfo & KeyMIC == 0:
+        return 1
+
+    case p.KeyInfo & KeyAck != 0:
+        return 3
+
+    case p.KeyInfo & KeySecure == 0 || !zero(p.Nonce):
+        return 2
+
+    default:
+        return 4
+    }
+}
+
+func zero(data []byte) bool {
+    return len(bytes.Trim(data, "\x00")) == 0
+}
+
+func (t Type) String() string {
+    switch t {
+    case EAP:    return "eap"
+    case Start:  return "start"
+    case Logoff: return "logoff"
+    case Key:    return "key"
+    case Alert:  return "alert"
+    default:     return fmt.Sprintf("0x%x", uint8(t))
+    }
+}
+
+func (k KeyInfo) String() string {
+    var flags []string
+
+    flags = append(flags, fmt.Sprintf("v%d", uint16(k & KeyVersionMask)))
+
+    if k & KeyPairwise != 0 {
+        flags = append(flags, "pairwise")
+    }
+
+    if k & KeyInstall != 0 {
+        flags = append(flags, "install")
+    }
+
+    if k & KeyAck != 0 {
+        flags = append(flags, "ack")
+    }
+
+    if k & KeyMIC != 0 {
+        flags = append(flags, "mic")
+    }
+
+    if k & KeySecure != 0 {
+        flags = append(flags, "secure")
+    }
+
+    if k & KeyError != 0 {
+        flags = append(flags, "error")
+    }
+
+    if k & KeyRequest != 0 {
+        flags = append(flags, "request")
+    }
+
+    if k & KeyEncrypted != 0 {
+        flags = append(flags, "encrypted")
+    }
+
+    return strings.Join(flags, "|")
+}
@@ -0,0 +1,155 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package eapol_test
+
+import "bytes"
+import "testing"
+
+import "github.com/ghedo/go.pkt/packet"
+import "github.com/ghedo/go.pkt/packet/eapol"
+
+var test_simple = []byte{
+    0x01, 0x03, 0x00, 0x5f, 0x02, 0x00, 0x8a, 0x00, 0x10, 0x00, 0x00, 0x00,
+    0x00, 0x00, 0x00, 0x00, 0x01, 0x10, 0x11, 0x12, 0x13, 0x14, 0x15, 0x16,
+    0x17, 0x18, 0x19, 0x1a, 0x1b, 0x1c, 0x1d, 0x1e, 0x1f, 0x20, 0x21, 0x22,
+    0x23, 0x24, 0x25, 0x26, 0x27, 0x28, 0x29, 0x2a, 0x2b, 0x2c, 0x2d, 0x2e,
+    0x2f, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+    0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+    0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+    0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+    0x00, 0x00, 0x00,
+}
+
+func MakeTestSimple() *eapol.Packet {
+    nonce := make([]byte, 32)
+    for i := range nonce {
+        nonce[i] = 0x10 + byte(i)
+    }
+
+    return &eapol.Packet{
+        Version: 1,
+        Type: eapol.Key,
+        Length: 95,
+        DescType: eapol.DescRSN,
+        KeyInfo: 2 | eapol.KeyPairwise | eapol.KeyAck,
+        KeyLength: 16,
+        ReplayCounter: 1,
+        Nonce: nonce,
+        IV: make([]byte, 16),
+        MIC: make([]byte, 16),
+        Data: []byte{},
+    }
+}
+
+func TestPack(t *testing.T) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_simple)))
+
+    p := MakeTestSimple()
+
+    err := p.Pack(&b)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if !bytes.Equal(test_simple, b.Buffer()) {
+        t.Fatalf("Raw packet mismatch: %x", b.Buffer())
+    }
+}
+
+func BenchmarkPack(bn *testing.B) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_simple)))
+
+    p := MakeTestSimple()
+
+    for n := 0; n < bn.N; n++ {
+        p.Pack(&b)
+    }
+}
+
+func TestUnpack(t *testing.T) {
+    var p eapol.Packet
+
+    cmp := MakeTestSimple()
+
+    var b packet.Buffer
+    b.Init(test_simple)
+
+    err := p.Unpack(&b)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if !p.Equals(cmp) {
+        t.Fatalf("Packet mismatch:\n%s\n%s", &p, cmp)
+    }
+
+    if p.HandshakeMessage() != 1 {
+        t.Fatalf("Handshake message mismatch: %d", p.HandshakeMessage())
+    }
+}
+
+func BenchmarkUnpack(bn *testing.B) {
+    var p eapol.Packet
+    var b packet.Buffer
+
+    for n := 0; n < bn.N; n++ {
+        b.Init(test_simple)
+        p.Unpack(&b)
+    }
+}
+
+func TestHandshakeMessage(t *testing.T) {
+    p := MakeTestSimple()
+
+    p.KeyInfo = 2 | eapol.KeyPairwise | eapol.KeyMIC
+    if p.HandshakeMessage() != 2 {
+        t.Fatalf("Expected message 2: %s", p.KeyInfo)
+    }
+
+    p.KeyInfo = 2 | eapol.KeyPairwise | eapol.KeyInstall | eapol.KeyAck |
+                eapol.KeyMIC | eapol.KeySecure | eapol.KeyEncrypted
+    if p.HandshakeMessage() != 3 {
+        t.Fatalf("Expected message 3: %s", p.KeyInfo)
+    }
+
+    p.KeyInfo = 2 | eapol.KeyPairwise | eapol.KeyMIC | eapol.KeySecure
+    p.Nonce   = make([]byte, 32)
+    if p.HandshakeMessage() != 4 {
+        t.Fatalf("Expected message 4: %s", p.KeyInfo)
+    }
+
+    p.KeyInfo = 2 | eapol.KeyAck | eapol.KeyMIC | eapol.KeySecure
+    if p.HandshakeMessage() != 0 {
+        t.Fatalf("Expected group key message: %s", p.KeyInfo)
+    }
+}
@@ -0,0 +1,207 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+// Provides encoding and decoding for ERSPAN type II and type III headers, as
+// carried by GRE.
+package erspan
+
+import "github.com/ghedo/go.pkt/packet"
+
+type Packet struct {
+    Version     Version
+    VLAN        uint16
+    COS         uint8         `string:"cos"`
+    Encap       uint8         `string:"encap"`
+    Truncated   bool          `string:"trunc"`
+    SessionId   uint16        `string:"session"`
+
+    /* type II */
+    Index       uint32
+
+    /* type III */
+    Timestamp   uint32        `string:"ts"`
+    SGT         uint16        `string:"sgt"`
+    PDU         bool          `string:"pdu"`
+    FrameType   uint8         `string:"ft"`
+    HWId        uint8         `string:"hwid"`
+    Egress      bool
+    Granularity uint8         `string:"gra"`
+    Platform    []byte        `string:"skip"`
+
+    pkt_payload packet.Packet `cmp:"skip" string:"skip"`
+}
+
+type Version uint8
+
+const (
+    TypeII Version = 1
+    TypeIII        = 2
+)
+
+func Make() *Packet {
+    return &Packet{
+        Version: TypeII,
+    }
+}
+
+func (p *Packet) GetType() packet.Type {
+    return packet.ERSPAN
+}
+
+func (p *Packet) GetLength() uint16 {
+    length := uint16(8)
+
+    if p.Version == TypeIII {
+        length = 12 + uint16(len(p.Platform))
+    }
+
+    if p.pkt_payload != nil {
+        length += p.pkt_payload.GetLength()
+    }
+
+    return length
+}
+
+func (p *Packet) Equals(other packet.Packet) bool {
+    return packet.Compare(p, other)
+}
+
+func (p *Packet) Answers(other packet.Packet) bool {
+    return false
+}
+
+func (p *Packet) Pack(buf *packet.Buffer) error {
+    buf.WriteN(uint16(p.Version) << 12 | p.VLAN & 0x0fff)
+
+    word := uint16(p.COS & 0x07) << 13 | uint16(p.Encap & 0x03) << 11 |
+            p.SessionId & 0x03ff
+    if p.Truncated {
+        word |= 0x0400
+    }
+
+    buf.WriteN(word)
+
+    if p.Version != TypeIII {
+        buf.WriteN(p.Index & 0x000fffff)
+        return nil
+    }
+
+    buf.WriteN(p.Timestamp)
+    buf.WriteN(p.SGT)
+
+    word = uint16(p.FrameType & 0x1f) << 10 | uint16(p.HWId & 0x3f) << 4 |
+           uint16(p.Granularity & 0x03) << 1
+    if p.PDU {
+        word |= 0x8000
+    }
+
+    if p.Egress {
+        word |= 0x0008
+    }
+
+    if len(p.Platform) > 0 {
+        word |= 0x0001
+    }
+
+    buf.WriteN(word)
+    buf.Write(p.Platform)
+
+    return nil
+}
+
+func (p *Packet) Unpack(buf *packet.Buffer) error {
+    var word uint16
+
+    buf.ReadN(&word)
+    p.Version = Version(word >> 12)
+    p.VLAN    = word & 0x0fff
+
+    buf.ReadN(&word)
+    p.COS       = uint8(word >> 13)
+    p.Encap     = uint8(word >> 11) & 0x03
+    p.Truncated = word & 0x0400 != 0
+    p.SessionId = word & 0x03ff
+
+    if p.Version != TypeIII {
+        buf.ReadN(&p.Index)
+        p.Index &= 0x000fffff
+        return nil
+    }
+
+    buf.ReadN(&p.Timestamp)
+    buf.ReadN(&p.SGT)
+
+    buf.ReadN(&word)
+    p.PDU         = word & 0x8000 != 0
+    p.FrameType   = uint8(word >> 10) & 0x1f
+    p.HWId        = uint8(word >> 4) & 0x3f
+    p.Egress      = word & 0x0008 != 0
+    p.Granularity = uint8(word >> 1) & 0x03
+
+    if word & 0x0001 != 0 {
+        p.Platform = buf.Next(8)
+    }
+
+    return nil
+}
+
+func (p *Packet) Payload() packet.Packet {
+    return p.pkt_payload
+}
+
+func (p *Packet) GuessPayloadType() packet.Type {
+    /* type III frame type 2 is IP, otherwise Ethernet */
+    if p.Version == TypeIII && p.FrameType == 2 {
+        return packet.IPv4
+    }
+
+    return packet.Eth
+}
+
+func (p *Packet) SetPayload(pl packet.Packet) error {
+    p.pkt_payload = pl
+
+    return nil
+}
+
+func (p *Packet) InitChecksum(csum uint32) {
+}
+
+func (p *Packet) String() string {
+    return packet.Stringify(p)
+}
+
+func (v Version) String() string {
+    switch v {
+    case TypeII:  return "II"
+    case TypeIII: return "III"
+    default:      return "unknown"
+    }
+}
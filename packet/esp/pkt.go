@@ -0,0 +1,178 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+// Provides encoding and decoding for IPsec Encapsulating Security Payload
+// packets (RFC 4303).
+//
+// Since the ESP payload is encrypted, it is normally decoded as raw data. Once
+// decrypted (see the esp/sa package) the layer also carries the fields of the
+// ESP trailer and its payload is the inner packet, which is an IP packet in
+// tunnel mode or a transport protocol packet (e.g. TCP) in transport mode.
+package esp
+
+import "github.com/ghedo/go.pkt/packet"
+import "github.com/ghedo/go.pkt/packet/ipv4"
+
+type Packet struct {
+    SPI         uint32        `string:"spi"`
+    Seq         uint32
+    Decrypted   bool          `string:"skip"`
+    IV          []byte        `string:"skip"`
+    Padding     []byte        `string:"skip"`
+    NextHdr     ipv4.Protocol `string:"next"`
+    ICV         []byte        `string:"skip"`
+    pkt_payload packet.Packet `cmp:"skip" string:"skip"`
+}
+
+func Make() *Packet {
+    return &Packet{ }
+}
+
+func (p *Packet) GetType() packet.Type {
+    return packet.ESP
+}
+
+func (p *Packet) GetLength() uint16 {
+    length := 8
+
+    if p.Decrypted {
+        length += len(p.IV) + p.TrailerLen()
+    }
+
+    if p.pkt_payload != nil {
+        return p.pkt_payload.GetLength() + uint16(length)
+    }
+
+    return uint16(length)
+}
+
+func (p *Packet) Equals(other packet.Packet) bool {
+    return packet.Compare(p, other)
+}
+
+func (p *Packet) Answers(other packet.Packet) bool {
+    if other == nil || other.GetType() != packet.ESP {
+        return false
+    }
+
+    if p.Payload() != nil && p.Decrypted && other.(*Packet).Decrypted {
+        return p.Payload().Answers(other.Payload())
+    }
+
+    return true
+}
+
+// Encode the packet. Decrypted packets are encoded in their plaintext form,
+// that is with the IV, the inner packet, the trailer and the ICV following the
+// ESP header.
+func (p *Packet) Pack(buf *packet.Buffer) error {
+    buf.WriteN(p.SPI)
+    buf.WriteN(p.Seq)
+
+    if !p.Decrypted {
+        return nil
+    }
+
+    buf.Write(p.IV)
+
+    /*
+     * The payload has already been packed at the end of the buffer, so
+     * it needs to be moved before the trailer.
+     */
+    hdr_len := buf.LayerLen()
+    pkt_len := int(p.GetLength())
+    trl_len := p.TrailerLen()
+
+    frame := buf.LayerBytes()[:pkt_len]
+    copy(frame[hdr_len:], frame[hdr_len + trl_len:])
+
+    trailer := frame[pkt_len - trl_len:]
+    copy(trailer, p.Padding)
+
+    trailer = trailer[len(p.Padding):]
+    trailer[0] = uint8(len(p.Padding))
+    trailer[1] = uint8(p.NextHdr)
+    copy(trailer[2:], p.ICV)
+
+    return nil
+}
+
+func (p *Packet) Unpack(buf *packet.Buffer) error {
+    buf.ReadN(&p.SPI)
+    buf.ReadN(&p.Seq)
+
+    return nil
+}
+
+func (p *Packet) Payload() packet.Packet {
+    return p.pkt_payload
+}
+
+func (p *Packet) GuessPayloadType() packet.Type {
+    if !p.Decrypted {
+        return packet.Raw
+    }
+
+    return ipv4.ProtocolToType(p.NextHdr)
+}
+
+func (p *Packet) SetPayload(pl packet.Packet) error {
+    p.pkt_payload = pl
+
+    if !p.Decrypted {
+        return nil
+    }
+
+    /* keep the original protocol of undecoded payloads */
+    if proto := ipv4.TypeToProtocol(pl.GetType()); proto != ipv4.None {
+        p.NextHdr = proto
+    }
+
+    return nil
+}
+
+func (p *Packet) InitChecksum(csum uint32) {
+}
+
+func (p *Packet) String() string {
+    return packet.Stringify(p)
+}
+
+// Return the length of the ESP trailer (padding, pad length, next header and
+// ICV) of a decrypted packet.
+func (p *Packet) TrailerLen() int {
+    return len(p.Padding) + 2 + len(p.ICV)
+}
+
+// Return whether the decrypted packet uses tunnel mode, that is whether it
+// carries a whole IP packet.
+func (p *Packet) Tunnel() bool {
+    return p.NextHdr == ipv4.IPv4 || p.NextHdr == ipv4.IPv6
+}
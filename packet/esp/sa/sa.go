@@ -0,0 +1,406 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+// Provides a security association table that can be used to decrypt (and
+// encrypt) IPsec ESP packets when their keys are known.
+//
+// Both AES-GCM (RFC 4106) and AES-CBC (RFC 3602) with HMAC-SHA1-96 (RFC 2404)
+// or HMAC-SHA256-128 (RFC 4868) authentication are supported. Extended
+// sequence numbers are not supported.
+package sa
+
+import "crypto/aes"
+import "crypto/cipher"
+import "crypto/hmac"
+import "crypto/rand"
+import "crypto/sha1"
+import "crypto/sha256"
+import "crypto/subtle"
+import "encoding/binary"
+import "fmt"
+import "hash"
+
+import "github.com/ghedo/go.pkt/layers"
+import "github.com/ghedo/go.pkt/packet"
+import "github.com/ghedo/go.pkt/packet/esp"
+import "github.com/ghedo/go.pkt/packet/ipv4"
+import "github.com/ghedo/go.pkt/packet/raw"
+
+// Association describes the keys used to protect the packets sent with a
+// given SPI.
+type Association struct {
+    SPI     uint32
+    Cipher  Cipher
+    Key     []byte
+    Auth    Auth
+    AuthKey []byte
+}
+
+type Cipher uint8
+
+const (
+    AESGCM Cipher = 0x01 /* the key includes the 4 bytes salt */
+    AESCBC        = 0x02
+)
+
+type Auth uint8
+
+const (
+    NoAuth Auth   = 0x00
+    HMACSHA1      = 0x01
+    HMACSHA256    = 0x02
+)
+
+// Table holds the security associations used to decrypt ESP packets.
+type Table struct {
+    sas map[uint32]*Association
+}
+
+// Create a new empty table.
+func New() *Table {
+    return &Table{
+        sas: make(map[uint32]*Association),
+    }
+}
+
+// Add the given security association to the table, replacing any other
+// association with the same SPI.
+func (t *Table) Add(sa *Association) error {
+    switch sa.Cipher {
+    case AESGCM:
+        if !valid_aes_key(len(sa.Key) - 4) {
+            return fmt.Errorf("Invalid AES-GCM key length %d", len(sa.Key))
+        }
+
+        if sa.Auth != NoAuth {
+            return fmt.Errorf("AES-GCM doesn't need an authentication algorithm")
+        }
+
+    case AESCBC:
+        if !valid_aes_key(len(sa.Key)) {
+            return fmt.Errorf("Invalid AES-CBC key length %d", len(sa.Key))
+        }
+
+    default:
+        return fmt.Errorf("Invalid cipher %d", sa.Cipher)
+    }
+
+    if sa.Auth > HMACSHA256 {
+        return fmt.Errorf("Invalid authentication algorithm %d", sa.Auth)
+    }
+
+    t.sas[sa.SPI] = sa
+
+    return nil
+}
+
+// Return the security association with the given SPI or nil.
+func (t *Table) Lookup(spi uint32) *Association {
+    return t.sas[spi]
+}
+
+// Decrypt the ESP packet found in the given packet, replacing its raw payload
+// with the decoded inner packet and filling the IV, trailer and ICV fields of
+// the ESP layer. In tunnel mode the inner packet starts with the IP header,
+// while in transport mode it starts with the transport header.
+func (t *Table) Decrypt(pkt packet.Packet) error {
+    p, ok := layers.FindLayer(pkt, packet.ESP).(*esp.Packet)
+    if !ok {
+        return fmt.Errorf("No ESP layer found")
+    }
+
+    if p.Decrypted {
+        return fmt.Errorf("Packet is already decrypted")
+    }
+
+    body, ok := p.Payload().(*raw.Packet)
+    if !ok {
+        return fmt.Errorf("Invalid ESP payload")
+    }
+
+    sa := t.Lookup(p.SPI)
+    if sa == nil {
+        return fmt.Errorf("No security association for SPI 0x%x", p.SPI)
+    }
+
+    iv_len, icv_len := sa.iv_len(), sa.icv_len()
+    if len(body.Data) < iv_len + 2 + icv_len {
+        return fmt.Errorf("Invalid ESP payload length %d", len(body.Data))
+    }
+
+    iv   := body.Data[:iv_len]
+    data := body.Data[iv_len:len(body.Data) - icv_len]
+    icv  := body.Data[len(body.Data) - icv_len:]
+
+    plain, err := sa.open(p, iv, data, icv)
+    if err != nil {
+        return err
+    }
+
+    pad_len := int(plain[len(plain) - 2])
+    if pad_len + 2 > len(plain) {
+        return fmt.Errorf("Invalid ESP padding length %d", pad_len)
+    }
+
+    inner := plain[:len(plain) - pad_len - 2]
+    next  := ipv4.Protocol(plain[len(plain) - 1])
+
+    pl, err := layers.UnpackAll(inner, ipv4.ProtocolToType(next))
+    if pl == nil {
+        if err != nil {
+            return err
+        }
+
+        pl = &raw.Packet{ Data: inner }
+    }
+
+    p.Decrypted = true
+    p.IV        = dup(iv)
+    p.Padding   = plain[len(inner):len(plain) - 2]
+    p.NextHdr   = next
+    p.ICV       = dup(icv)
+
+    return p.SetPayload(pl)
+}
+
+// Encrypt the decrypted ESP packet found in the given packet with the keys of
+// the matching security association, replacing its payload with the raw
+// encrypted data. If the IV of the packet doesn't have the right length a new
+// one is generated.
+func (t *Table) Encrypt(pkt packet.Packet) error {
+    p, ok := layers.FindLayer(pkt, packet.ESP).(*esp.Packet)
+    if !ok {
+        return fmt.Errorf("No ESP layer found")
+    }
+
+    if !p.Decrypted || p.Payload() == nil {
+        return fmt.Errorf("Packet is not decrypted")
+    }
+
+    sa := t.Lookup(p.SPI)
+    if sa == nil {
+        return fmt.Errorf("No security association for SPI 0x%x", p.SPI)
+    }
+
+    var stack []packet.Packet
+    for pl := p.Payload(); pl != nil; pl = pl.Payload() {
+        stack = append(stack, pl)
+    }
+
+    inner, err := layers.Pack(stack...)
+    if err != nil {
+        return err
+    }
+
+    iv := p.IV
+    if len(iv) != sa.iv_len() {
+        iv, err = sa.new_iv(p)
+        if err != nil {
+            return err
+        }
+    }
+
+    /* use the default padding, aligning the data to the cipher block */
+    pad_len := sa.block_len() - (len(inner) + 2) % sa.block_len()
+    pad_len %= sa.block_len()
+
+    plain := append(inner, make([]byte, pad_len + 2)...)
+    for i := 0; i < pad_len; i++ {
+        plain[len(inner) + i] = uint8(i + 1)
+    }
+
+    plain[len(plain) - 2] = uint8(pad_len)
+    plain[len(plain) - 1] = uint8(p.NextHdr)
+
+    data, icv, err := sa.seal(p, iv, plain)
+    if err != nil {
+        return err
+    }
+
+    body := append(append(dup(iv), data...), icv...)
+
+    p.Decrypted = false
+    p.IV        = nil
+    p.Padding   = nil
+    p.ICV       = nil
+
+    return p.SetPayload(&raw.Packet{ Data: body })
+}
+
+func (sa *Association) iv_len() int {
+    if sa.Cipher == AESGCM {
+        return 8
+    }
+
+    return aes.BlockSize
+}
+
+func (sa *Association) icv_len() int {
+    switch {
+    case sa.Cipher == AESGCM:   return 16
+    case sa.Auth == HMACSHA1:   return 12
+    case sa.Auth == HMACSHA256: return 16
+    default:                    return 0
+    }
+}
+
+func (sa *Association) block_len() int {
+    if sa.Cipher == AESGCM {
+        return 4
+    }
+
+    return aes.BlockSize
+}
+
+func (sa *Association) new_iv(p *esp.Packet) ([]byte, error) {
+    iv := make([]byte, sa.iv_len())
+
+    /* GCM only needs a unique IV, so the sequence number can be used */
+    if sa.Cipher == AESGCM {
+        binary.BigEndian.PutUint64(iv, uint64(p.Seq))
+        return iv, nil
+    }
+
+    _, err := rand.Read(iv)
+    return iv, err
+}
+
+func (sa *Association) open(p *esp.Packet, iv, data, icv []byte) ([]byte, error) {
+    if sa.Cipher == AESGCM {
+        aead, err := sa.gcm()
+        if err != nil {
+            return nil, err
+        }
+
+        out, err := aead.Open(nil, sa.gcm_nonce(iv),
+                              append(dup(data), icv...), esp_aad(p))
+        if err != nil {
+            return nil, fmt.Errorf("Invalid ESP ICV")
+        }
+
+        return out, nil
+    }
+
+    if sa.Auth != NoAuth {
+        mac := sa.mac(p, iv, data)
+        if subtle.ConstantTimeCompare(mac, icv) != 1 {
+            return nil, fmt.Errorf("Invalid ESP ICV")
+        }
+    }
+
+    if len(data) == 0 || len(data) % aes.BlockSize != 0 {
+        return nil, fmt.Errorf("Invalid ESP payload length %d", len(data))
+    }
+
+    block, err := aes.NewCipher(sa.Key)
+    if err != nil {
+        return nil, err
+    }
+
+    out := make([]byte, len(data))
+    cipher.NewCBCDecrypter(block, iv).CryptBlocks(out, data)
+
+    return out, nil
+}
+
+func (sa *Association) seal(p *esp.Packet, iv, plain []byte) ([]byte, []byte, error) {
+    if sa.Cipher == AESGCM {
+        aead, err := sa.gcm()
+        if err != nil {
+            return nil, nil, err
+        }
+
+        out := aead.Seal(nil, sa.gcm_nonce(iv), plain, esp_aad(p))
+        tag := len(out) - aead.Overhead()
+
+        return out[:tag], out[tag:], nil
+    }
+
+    block, err := aes.NewCipher(sa.Key)
+    if err != nil {
+        return nil, nil, err
+    }
+
+    out := make([]byte, len(plain))
+    cipher.NewCBCEncrypter(block, iv).CryptBlocks(out, plain)
+
+    if sa.Auth == NoAuth {
+        return out, nil, nil
+    }
+
+    return out, sa.mac(p, iv, out), nil
+}
+
+func (sa *Association) gcm() (cipher.AEAD, error) {
+    block, err := aes.NewCipher(sa.Key[:len(sa.Key) - 4])
+    if err != nil {
+        return nil, err
+    }
+
+    return cipher.NewGCM(block)
+}
+
+func (sa *Association) gcm_nonce(iv []byte) []byte {
+    salt := sa.Key[len(sa.Key) - 4:]
+    return append(dup(salt), iv...)
+}
+
+func (sa *Association) mac(p *esp.Packet, iv, data []byte) []byte {
+    var h func() hash.Hash
+
+    switch sa.Auth {
+    case HMACSHA1:   h = sha1.New
+    case HMACSHA256: h = sha256.New
+    }
+
+    m := hmac.New(h, sa.AuthKey)
+    m.Write(esp_aad(p))
+    m.Write(iv)
+    m.Write(data)
+
+    return m.Sum(nil)[:sa.icv_len()]
+}
+
+func esp_aad(p *esp.Packet) []byte {
+    aad := make([]byte, 8)
+    binary.BigEndian.PutUint32(aad[0:], p.SPI)
+    binary.BigEndian.PutUint32(aad[4:], p.Seq)
+    return aad
+}
+
+func valid_aes_key(length int) bool {
+    return length == 16 || length == 24 || length == 32
+}
+
+func dup(data []byte) []byte {
+    out := make([]byte, len(data))
+    copy(out, data)
+    return out
+}
@@ -0,0 +1,240 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package sa_test
+
+import "bytes"
+import "crypto/aes"
+import "crypto/cipher"
+import "net"
+import "testing"
+
+import "github.com/ghedo/go.pkt/layers"
+import "github.com/ghedo/go.pkt/packet"
+import "github.com/ghedo/go.pkt/packet/esp"
+import "github.com/ghedo/go.pkt/packet/esp/sa"
+import "github.com/ghedo/go.pkt/packet/ipv4"
+import "github.com/ghedo/go.pkt/packet/tcp"
+import "github.com/ghedo/go.pkt/packet/udp"
+
+var gcm_key = []byte{
+    0xfe, 0xff, 0xe9, 0x92, 0x86, 0x65, 0x73, 0x1c,
+    0x6d, 0x6a, 0x8f, 0x94, 0x67, 0x30, 0x83, 0x08,
+    0xca, 0xfe, 0xba, 0xbe, /* salt */
+}
+
+var cbc_key = []byte{
+    0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07,
+    0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f,
+}
+
+var auth_key = []byte{
+    0x10, 0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17, 0x18, 0x19,
+    0x1a, 0x1b, 0x1c, 0x1d, 0x1e, 0x1f, 0x20, 0x21, 0x22, 0x23,
+}
+
+func MakeOuter() *ipv4.Packet {
+    ip4 := ipv4.Make()
+    ip4.SrcAddr = net.ParseIP("198.51.100.1")
+    ip4.DstAddr = net.ParseIP("198.51.100.2")
+    return ip4
+}
+
+func MakeInner() (*ipv4.Packet, *udp.Packet) {
+    ip4 := ipv4.Make()
+    ip4.SrcAddr = net.ParseIP("10.0.0.1")
+    ip4.DstAddr = net.ParseIP("10.1.0.1")
+
+    udp_pkt := udp.Make()
+    udp_pkt.SrcPort = 12345
+    udp_pkt.DstPort = 53
+
+    return ip4, udp_pkt
+}
+
+func TestDecryptGCM(t *testing.T) {
+    inner_ip4, inner_udp := MakeInner()
+
+    inner, err := layers.Pack(inner_ip4, inner_udp)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    /* encrypt the tunnel mode payload independently of the sa package */
+    plain := append(inner, 0x01, 0x02, 0x02, 0x04)
+    iv    := []byte{ 0xde, 0xca, 0xf8, 0x88, 0x00, 0x00, 0x00, 0x01 }
+    hdr   := []byte{ 0x00, 0x00, 0xa5, 0xf8, 0x00, 0x00, 0x00, 0x0a }
+
+    block, _ := aes.NewCipher(gcm_key[:16])
+    aead, _  := cipher.NewGCM(block)
+    nonce    := append(append([]byte{}, gcm_key[16:]...), iv...)
+
+    body := append(append(append([]byte{}, hdr...), iv...),
+                   aead.Seal(nil, nonce, plain, hdr)...)
+
+    outer := MakeOuter()
+    outer.Protocol = ipv4.IPSecESP
+    outer.Length   = uint16(20 + len(body))
+
+    outer_buf, err := layers.Pack(outer)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    pkt, err := layers.UnpackAll(append(outer_buf, body...), packet.IPv4)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    table := sa.New()
+
+    err = table.Decrypt(pkt)
+    if err == nil {
+        t.Fatalf("Packet decrypted without keys: %s", pkt)
+    }
+
+    err = table.Add(&sa.Association{
+        SPI: 0xa5f8, Cipher: sa.AESGCM, Key: gcm_key,
+    })
+    if err != nil {
+        t.Fatalf("Error adding SA: %s", err)
+    }
+
+    err = table.Decrypt(pkt)
+    if err != nil {
+        t.Fatalf("Error decrypting: %s", err)
+    }
+
+    esp_pkt := layers.FindLayer(pkt, packet.ESP).(*esp.Packet)
+    if !esp_pkt.Tunnel() || esp_pkt.Seq != 10 ||
+       !bytes.Equal(esp_pkt.Padding, []byte{ 0x01, 0x02 }) {
+        t.Fatalf("ESP layer mismatch: %s", pkt)
+    }
+
+    if !layers.FindLayer(esp_pkt, packet.IPv4).Equals(inner_ip4) {
+        t.Fatalf("Inner IPv4 mismatch: %s", pkt)
+    }
+
+    if !layers.FindLayer(esp_pkt, packet.UDP).Equals(inner_udp) {
+        t.Fatalf("Inner UDP mismatch: %s", pkt)
+    }
+}
+
+func TestEncryptCBC(t *testing.T) {
+    for _, auth := range []sa.Auth{ sa.HMACSHA1, sa.HMACSHA256 } {
+        table := sa.New()
+
+        err := table.Add(&sa.Association{
+            SPI: 0x1001, Cipher: sa.AESCBC, Key: cbc_key,
+            Auth: auth, AuthKey: auth_key,
+        })
+        if err != nil {
+            t.Fatalf("Error adding SA: %s", err)
+        }
+
+        esp_pkt := esp.Make()
+        esp_pkt.SPI       = 0x1001
+        esp_pkt.Seq       = 1
+        esp_pkt.Decrypted = true
+
+        tcp_pkt := tcp.Make()
+        tcp_pkt.SrcPort = 41562
+        tcp_pkt.DstPort = 8338
+        tcp_pkt.Seq     = 1000
+
+        layers.Compose(MakeOuter(), esp_pkt, tcp_pkt)
+
+        err = table.Encrypt(esp_pkt)
+        if err != nil {
+            t.Fatalf("Error encrypting: %s", err)
+        }
+
+        if esp_pkt.Decrypted || esp_pkt.NextHdr != ipv4.TCP {
+            t.Fatalf("ESP layer mismatch: %s", esp_pkt)
+        }
+
+        buf, err := layers.Pack(MakeOuter(), esp_pkt, esp_pkt.Payload())
+        if err != nil {
+            t.Fatalf("Error packing: %s", err)
+        }
+
+        /* 8 bytes header, 16 bytes IV, 32 bytes data and the ICV */
+        if len(buf) != 20 + 8 + 16 + 32 + 12 + 4 * int(auth - 1) {
+            t.Fatalf("Length mismatch: %d", len(buf))
+        }
+
+        pkt, err := layers.UnpackAll(buf, packet.IPv4)
+        if err != nil {
+            t.Fatalf("Error unpacking: %s", err)
+        }
+
+        err = table.Decrypt(pkt)
+        if err != nil {
+            t.Fatalf("Error decrypting: %s", err)
+        }
+
+        dec := layers.FindLayer(pkt, packet.ESP).(*esp.Packet)
+        if dec.Tunnel() || len(dec.Padding) != 10 {
+            t.Fatalf("ESP layer mismatch: %s", pkt)
+        }
+
+        if !layers.FindLayer(pkt, packet.TCP).Equals(tcp_pkt) {
+            t.Fatalf("Inner TCP mismatch: %s", pkt)
+        }
+
+        /* tamper with the ciphertext */
+        buf[len(buf) - 20] ^= 0x01
+
+        pkt, _ = layers.UnpackAll(buf, packet.IPv4)
+
+        err = table.Decrypt(pkt)
+        if err == nil {
+            t.Fatalf("Tampered packet decrypted: %s", pkt)
+        }
+    }
+}
+
+func TestAdd(t *testing.T) {
+    table := sa.New()
+
+    err := table.Add(&sa.Association{ Cipher: sa.AESGCM, Key: cbc_key })
+    if err == nil {
+        t.Fatalf("Invalid GCM key accepted")
+    }
+
+    err = table.Add(&sa.Association{ Cipher: sa.AESCBC, Key: gcm_key })
+    if err == nil {
+        t.Fatalf("Invalid CBC key accepted")
+    }
+
+    if table.Lookup(0) != nil {
+        t.Fatalf("Invalid SA added")
+    }
+}
@@ -50,11 +50,22 @@ type EtherType uint16
 const (
     None EtherType = 0x0000
     ARP            = 0x0806
+    EAPOL          = 0x888e
+    ERSPAN         = 0x88be
+    ERSPAN3        = 0x22eb
     IPv4           = 0x0800
     IPv6           = 0x86dd
     LLC            = 0x0001  /* pseudo ethertype */
     LLDP           = 0x088cc
+    MPLS           = 0x8847
+    MPLSMcast      = 0x8848
+    PBB            = 0x88e7
+    PPP            = 0x880b
+    PPPoEDiscovery = 0x8863
+    PPPoESession   = 0x8864
     QinQ           = 0x88a8
+    QinQLegacy     = 0x9100
+    TEB            = 0x6558
     TRILL          = 0x22f3
     VLAN           = 0x8100
     WoL            = 0x0842
@@ -137,10 +148,11 @@ func (p *Packet) GuessPayloadType() packet.Type {
 
 func (p *Packet) SetPayload(pl packet.Packet) error {
     p.pkt_payload = pl
-    p.Type        = TypeToEtherType(pl.GetType())
+    p.Type        = UpdateEtherType(p.Type, pl)
 
+    /* the 802.3 length field only covers the payload */
     if p.Type < 0x0600 {
-        p.Length = p.GetLength()
+        p.Length = pl.GetLength()
     }
 
     return nil
@@ -154,16 +166,27 @@ func (p *Packet) String() string {
 }
 
 var ethertype_to_type_map = map[EtherType]packet.Type{
-    None:  packet.None,
-    ARP:   packet.ARP,
-    IPv4:  packet.IPv4,
-    IPv6:  packet.IPv6,
-    LLC:   packet.LLC,
-    LLDP:  packet.LLDP,
-    VLAN:  packet.VLAN,
-    QinQ:  packet.VLAN,
-    TRILL: packet.TRILL,
-    WoL:   packet.WoL,
+    None:           packet.None,
+    ARP:            packet.ARP,
+    EAPOL:          packet.EAPOL,
+    ERSPAN:         packet.ERSPAN,
+    ERSPAN3:        packet.ERSPAN,
+    IPv4:           packet.IPv4,
+    IPv6:           packet.IPv6,
+    LLC:            packet.LLC,
+    LLDP:           packet.LLDP,
+    MPLS:           packet.MPLS,
+    MPLSMcast:      packet.MPLS,
+    PBB:            packet.PBB,
+    PPP:            packet.PPP,
+    PPPoEDiscovery: packet.PPPoE,
+    PPPoESession:   packet.PPPoE,
+    VLAN:           packet.VLAN,
+    QinQ:           packet.VLAN,
+    QinQLegacy:     packet.VLAN,
+    TEB:            packet.Eth,
+    TRILL:          packet.TRILL,
+    WoL:            packet.WoL,
 }
 
 // Create a new Type from the given EtherType.
@@ -184,6 +207,18 @@ func TypeToEtherType(pkttype packet.Type) EtherType {
         return VLAN
     }
 
+    if pkttype == packet.ERSPAN {
+        return ERSPAN
+    }
+
+    if pkttype == packet.MPLS {
+        return MPLS
+    }
+
+    if pkttype == packet.PPPoE {
+        return PPPoESession
+    }
+
     for e, t := range ethertype_to_type_map {
         if t == pkttype {
             return e
@@ -193,18 +228,56 @@ func TypeToEtherType(pkttype packet.Type) EtherType {
     return None
 }
 
+// Return the EtherType of the given packet. Packets whose EtherType depends on
+// their content (e.g. PPPoE discovery and session packets) can override the
+// default mapping by implementing an EtherType() method.
+func PayloadEtherType(pl packet.Packet) EtherType {
+    if e, ok := pl.(interface{ EtherType() EtherType }); ok {
+        return e.EtherType()
+    }
+
+    return TypeToEtherType(pl.GetType())
+}
+
+// Return the EtherType of the given packet, like PayloadEtherType(), but keep
+// the current EtherType if it already matches the packet type. This preserves
+// alternative EtherTypes (e.g. 0x88a8 for S-VLAN tags) and the EtherType of
+// undecoded payloads when decoded packets are encoded again.
+func UpdateEtherType(cur EtherType, pl packet.Packet) EtherType {
+    if _, ok := pl.(interface{ EtherType() EtherType }); ok {
+        return PayloadEtherType(pl)
+    }
+
+    if cur != None && EtherTypeToType(cur) == pl.GetType() {
+        return cur
+    }
+
+    return PayloadEtherType(pl)
+}
+
 func (t EtherType) String() string {
     switch t {
-    case ARP:   return "ARP"
-    case IPv4:  return "IPv4"
-    case IPv6:  return "IPv6"
-    case LLC:   return "LLC"
-    case LLDP:  return "LLDP"
-    case None:  return "None"
-    case QinQ:  return "QinQ"
-    case TRILL: return "TRILL"
-    case VLAN:  return "VLAN"
-    case WoL:   return "WoL"
-    default:    return fmt.Sprintf("0x%x", uint16(t))
+    case ARP:            return "ARP"
+    case EAPOL:          return "EAPOL"
+    case ERSPAN:         return "ERSPAN"
+    case ERSPAN3:        return "ERSPANv3"
+    case IPv4:           return "IPv4"
+    case IPv6:           return "IPv6"
+    case LLC:            return "LLC"
+    case LLDP:           return "LLDP"
+    case MPLS:           return "MPLS"
+    case MPLSMcast:      return "MPLS multicast"
+    case PBB:            return "PBB"
+    case PPP:            return "PPP"
+    case PPPoEDiscovery: return "PPPoE discovery"
+    case PPPoESession:   return "PPPoE session"
+    case None:           return "None"
+    case QinQ:           return "QinQ"
+    case QinQLegacy:     return "QinQ legacy"
+    case TEB:            return "TEB"
+    case TRILL:          return "TRILL"
+    case VLAN:           return "VLAN"
+    case WoL:            return "WoL"
+    default:             return fmt.Sprintf("0x%x", uint16(t))
     }
 }
@@ -0,0 +1,258 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+// Provides encoding and decoding for Geneve packets (RFC 8926).
+package geneve
+
+import "bytes"
+import "fmt"
+
+import "github.com/ghedo/go.pkt/packet"
+import "github.com/ghedo/go.pkt/packet/eth"
+import "github.com/ghedo/go.pkt/packet/udp"
+import "github.com/ghedo/go.pkt/packet/vxlan"
+
+type Packet struct {
+    Version     uint8         `string:"ver"`
+    OAM         bool          `string:"oam"`
+    Critical    bool          `string:"crit"`
+    Type        eth.EtherType
+    VNI         uint32        `string:"vni"`
+    Options     []Option      `string:"skip"`
+    pkt_payload packet.Packet `cmp:"skip" string:"skip"`
+}
+
+// Option is a Geneve TLV option. The length of the data must be a multiple of
+// 4 bytes.
+type Option struct {
+    Class uint16
+    Type  uint8
+    Data  []byte
+}
+
+func Make() *Packet {
+    return &Packet{
+        Type: eth.TEB,
+    }
+}
+
+func (p *Packet) GetType() packet.Type {
+    return packet.Geneve
+}
+
+func (p *Packet) GetLength() uint16 {
+    length := 8 + uint16(p.options_len())
+
+    if p.pkt_payload != nil {
+        length += p.pkt_payload.GetLength()
+    }
+
+    return length
+}
+
+func (p *Packet) options_len() int {
+    length := 0
+
+    for _, o := range p.Options {
+        length += 4 + len(o.Data)
+    }
+
+    return length
+}
+
+func (p *Packet) Equals(other packet.Packet) bool {
+    return packet.Compare(p, other)
+}
+
+func (p *Packet) Answers(other packet.Packet) bool {
+    if other == nil || other.GetType() != packet.Geneve {
+        return false
+    }
+
+    if p.VNI != other.(*Packet).VNI {
+        return false
+    }
+
+    if p.Payload() != nil {
+        return p.Payload().Answers(other.Payload())
+    }
+
+    return true
+}
+
+func (p *Packet) Pack(buf *packet.Buffer) error {
+    opt_len := p.options_len()
+    if opt_len % 4 != 0 || opt_len > 252 {
+        return fmt.Errorf("Invalid options length %d", opt_len)
+    }
+
+    for _, o := range p.Options {
+        if len(o.Data) % 4 != 0 || len(o.Data) > 124 {
+            return fmt.Errorf("Invalid option data length %d", len(o.Data))
+        }
+    }
+
+    buf.WriteN(p.Version << 6 | uint8(opt_len / 4))
+
+    var flags uint8
+
+    if p.OAM {
+        flags |= 0x80
+    }
+
+    if p.Critical {
+        flags |= 0x40
+    }
+
+    buf.WriteN(flags)
+    buf.WriteN(p.Type)
+    buf.WriteN(p.VNI << 8)
+
+    for _, o := range p.Options {
+        buf.WriteN(o.Class)
+        buf.WriteN(o.Type)
+        buf.WriteN(uint8(len(o.Data) / 4) & 0x1f)
+        buf.Write(o.Data)
+    }
+
+    return nil
+}
+
+func (p *Packet) Unpack(buf *packet.Buffer) error {
+    if buf.Len() < 8 {
+        return fmt.Errorf("Invalid Geneve header length %d", buf.Len())
+    }
+
+    var ver_len, flags uint8
+
+    buf.ReadN(&ver_len)
+    buf.ReadN(&flags)
+
+    p.Version  = ver_len >> 6
+    p.OAM      = flags & 0x80 != 0
+    p.Critical = flags & 0x40 != 0
+
+    buf.ReadN(&p.Type)
+    buf.ReadN(&p.VNI)
+
+    p.VNI >>= 8
+
+    opt_len := int(ver_len & 0x3f) * 4
+    if opt_len > buf.Len() {
+        return fmt.Errorf("Invalid options length %d", opt_len)
+    }
+
+    p.Options = nil
+
+    for opts := buf.Next(opt_len); len(opts) >= 4; {
+        var o Option
+
+        o.Class = uint16(opts[0]) << 8 | uint16(opts[1])
+        o.Type  = opts[2]
+
+        length := 4 + int(opts[3] & 0x1f) * 4
+        if length > len(opts) {
+            return fmt.Errorf("Invalid option length %d", length)
+        }
+
+        o.Data = opts[4:length]
+        opts   = opts[length:]
+
+        p.Options = append(p.Options, o)
+    }
+
+    return nil
+}
+
+func (p *Packet) Payload() packet.Packet {
+    return p.pkt_payload
+}
+
+func (p *Packet) GuessPayloadType() packet.Type {
+    return eth.EtherTypeToType(p.Type)
+}
+
+func (p *Packet) SetPayload(pl packet.Packet) error {
+    p.pkt_payload = pl
+    p.Type        = eth.UpdateEtherType(p.Type, pl)
+
+    return nil
+}
+
+func (p *Packet) InitChecksum(csum uint32) {
+}
+
+func (p *Packet) String() string {
+    return packet.Stringify(p)
+}
+
+// Return the first option with the given class and type, or nil.
+func (p *Packet) FindOption(class uint16, opt_type uint8) *Option {
+    for i := range p.Options {
+        if p.Options[i].Class == class && p.Options[i].Type == opt_type {
+            return &p.Options[i]
+        }
+    }
+
+    return nil
+}
+
+// Return whether the option is critical (i.e. the most significant bit of the
+// option type is set).
+func (o Option) IsCritical() bool {
+    return o.Type & 0x80 != 0
+}
+
+func (o Option) Equal(other Option) bool {
+    return o.Class == other.Class && o.Type == other.Type &&
+           bytes.Equal(o.Data, other.Data)
+}
+
+// Encapsulate the given packets (starting with the inner Ethernet frame or IP
+// packet) into a Geneve tunnel with the given VNI and options. The returned UDP
+// and Geneve layers followed by the inner packets can be prepended with the
+// outer Ethernet and IP headers and sent with network.Send().
+func Encapsulate(vni uint32, opts []Option, pkts ...packet.Packet) []packet.Packet {
+    udp_pkt := udp.Make()
+    udp_pkt.SrcPort = vxlan.SourcePort(pkts...)
+    udp_pkt.DstPort = udp.Geneve
+
+    geneve_pkt := Make()
+    geneve_pkt.VNI     = vni
+    geneve_pkt.Options = opts
+
+    for _, o := range opts {
+        if o.IsCritical() {
+            geneve_pkt.Critical = true
+        }
+    }
+
+    return append([]packet.Packet{ udp_pkt, geneve_pkt }, pkts...)
+}
@@ -0,0 +1,221 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package geneve_test
+
+import "bytes"
+import "net"
+import "testing"
+
+import "github.com/ghedo/go.pkt/layers"
+import "github.com/ghedo/go.pkt/packet"
+import "github.com/ghedo/go.pkt/packet/eth"
+import "github.com/ghedo/go.pkt/packet/geneve"
+import "github.com/ghedo/go.pkt/packet/icmpv4"
+import "github.com/ghedo/go.pkt/packet/ipv4"
+import "github.com/ghedo/go.pkt/packet/raw"
+import "github.com/ghedo/go.pkt/packet/udp"
+
+var test_simple = []byte{
+    0x02, 0x40, 0x65, 0x58, 0x00, 0xab, 0xcd, 0x00, 0x01, 0x02, 0x80, 0x01,
+    0xde, 0xad, 0xbe, 0xef,
+}
+
+func MakeTestSimple() *geneve.Packet {
+    return &geneve.Packet{
+        Critical: true,
+        Type: eth.TEB,
+        VNI: 0xabcd,
+        Options: []geneve.Option{
+            {
+                Class: 0x0102,
+                Type: 0x80,
+                Data: []byte{ 0xde, 0xad, 0xbe, 0xef },
+            },
+        },
+    }
+}
+
+func TestPack(t *testing.T) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_simple)))
+
+    p := MakeTestSimple()
+
+    err := p.Pack(&b)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if !bytes.Equal(test_simple, b.Buffer()) {
+        t.Fatalf("Raw packet mismatch: %x", b.Buffer())
+    }
+}
+
+func BenchmarkPack(bn *testing.B) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_simple)))
+
+    p := MakeTestSimple()
+
+    for n := 0; n < bn.N; n++ {
+        p.Pack(&b)
+    }
+}
+
+func TestUnpack(t *testing.T) {
+    var p geneve.Packet
+
+    cmp := MakeTestSimple()
+
+    var b packet.Buffer
+    b.Init(test_simple)
+
+    err := p.Unpack(&b)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if !p.Equals(cmp) {
+        t.Fatalf("Packet mismatch:\n%s\n%s", &p, cmp)
+    }
+
+    o := p.FindOption(0x0102, 0x80)
+    if o == nil || !o.IsCritical() {
+        t.Fatalf("Option not found: %s", &p)
+    }
+}
+
+func BenchmarkUnpack(bn *testing.B) {
+    var p geneve.Packet
+    var b packet.Buffer
+
+    for n := 0; n < bn.N; n++ {
+        b.Init(test_simple)
+        p.Unpack(&b)
+    }
+}
+
+func TestEncapsulate(t *testing.T) {
+    outer_ip4 := ipv4.Make()
+    outer_ip4.SrcAddr = net.ParseIP("10.0.0.1")
+    outer_ip4.DstAddr = net.ParseIP("10.0.0.2")
+
+    inner_eth := eth.Make()
+    inner_eth.SrcAddr, _ = net.ParseMAC("02:00:00:00:00:01")
+    inner_eth.DstAddr, _ = net.ParseMAC("02:00:00:00:00:02")
+
+    inner_ip4 := ipv4.Make()
+    inner_ip4.SrcAddr = net.ParseIP("192.168.1.1")
+    inner_ip4.DstAddr = net.ParseIP("192.168.1.2")
+
+    inner_icmp := icmpv4.Make()
+    inner_icmp.Id = 0x1234
+
+    opts := []geneve.Option{
+        { Class: 0x0103, Type: 0x01, Data: []byte{ 0x00, 0x00, 0x00, 0x01 } },
+    }
+
+    stack := geneve.Encapsulate(7, opts, inner_eth, inner_ip4, inner_icmp)
+
+    buf, err := layers.Pack(append([]packet.Packet{ outer_ip4 }, stack...)...)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    pkt, err := layers.UnpackAll(buf, packet.IPv4)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    udp_pkt, ok := layers.FindLayer(pkt, packet.UDP).(*udp.Packet)
+    if !ok || udp_pkt.DstPort != udp.Geneve {
+        t.Fatalf("UDP layer mismatch: %s", pkt)
+    }
+
+    geneve_pkt, ok := layers.FindLayer(pkt, packet.Geneve).(*geneve.Packet)
+    if !ok || geneve_pkt.VNI != 7 || len(geneve_pkt.Options) != 1 {
+        t.Fatalf("Geneve layer mismatch: %s", pkt)
+    }
+
+    icmp_pkt := layers.FindLayer(geneve_pkt, packet.ICMPv4)
+    if icmp_pkt == nil || !icmp_pkt.Equals(inner_icmp) {
+        t.Fatalf("Inner packet mismatch: %s", pkt)
+    }
+}
+
+var test_unknown = []byte{
+    0x00, 0x00, 0x12, 0x34, 0x00, 0xab, 0xcd, 0x00, 0xde, 0xad, 0xbe, 0xef,
+}
+
+func TestUnknownProtocol(t *testing.T) {
+    var geneve_pkt geneve.Packet
+    var raw_pkt raw.Packet
+
+    _, err := layers.Unpack(test_unknown, &geneve_pkt, &raw_pkt)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    buf, err := layers.Pack(&geneve_pkt, &raw_pkt)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if !bytes.Equal(buf, test_unknown) {
+        t.Fatalf("Raw packet mismatch: %x", buf)
+    }
+}
+
+func TestInvalidOption(t *testing.T) {
+    for _, l := range []int{ 3, 128 } {
+        p := MakeTestSimple()
+        p.Options[0].Data = make([]byte, l)
+
+        var b packet.Buffer
+        b.Init(make([]byte, p.GetLength()))
+
+        if p.Pack(&b) == nil {
+            t.Fatalf("Option data length %d accepted", l)
+        }
+    }
+}
+
+func TestTruncated(t *testing.T) {
+    var p geneve.Packet
+
+    var b packet.Buffer
+    b.Init(test_simple[:3])
+
+    err := p.Unpack(&b)
+    if err == nil {
+        t.Fatalf("Truncated header accepted: %s", &p)
+    }
+}
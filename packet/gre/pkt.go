@@ -0,0 +1,269 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+// Provides encoding and decoding for GRE packets (RFC 2784, RFC 2890), including
+// the enhanced GRE header used by PPTP and NVGRE (RFC 7637).
+package gre
+
+import "fmt"
+import "strings"
+
+import "github.com/ghedo/go.pkt/packet"
+import "github.com/ghedo/go.pkt/packet/erspan"
+import "github.com/ghedo/go.pkt/packet/eth"
+import "github.com/ghedo/go.pkt/packet/ipv4"
+
+type Packet struct {
+    Flags       Flags
+    Version     uint8
+    Type        eth.EtherType
+    Checksum    uint16        `string:"sum"`
+    Offset      uint16        `string:"off"`
+    Key         uint32
+    Seq         uint32
+    Ack         uint32
+    pkt_payload packet.Packet `cmp:"skip" string:"skip"`
+}
+
+type Flags uint16
+
+const (
+    Checksum Flags = 0x8000
+    Routing        = 0x4000
+    Key            = 0x2000
+    Seq            = 0x1000
+    StrictRoute    = 0x0800
+    Ack            = 0x0080
+)
+
+func Make() *Packet {
+    return &Packet{ }
+}
+
+func (p *Packet) GetType() packet.Type {
+    return packet.GRE
+}
+
+func (p *Packet) GetLength() uint16 {
+    length := uint16(4)
+
+    if p.Flags & (Checksum | Routing) != 0 {
+        length += 4
+    }
+
+    if p.Flags & Key != 0 {
+        length += 4
+    }
+
+    if p.Flags & Seq != 0 {
+        length += 4
+    }
+
+    if p.Flags & Ack != 0 {
+        length += 4
+    }
+
+    if p.pkt_payload != nil {
+        length += p.pkt_payload.GetLength()
+    }
+
+    return length
+}
+
+func (p *Packet) Equals(other packet.Packet) bool {
+    return packet.Compare(p, other)
+}
+
+func (p *Packet) Answers(other packet.Packet) bool {
+    if other == nil || other.GetType() != packet.GRE {
+        return false
+    }
+
+    if p.Key != other.(*Packet).Key {
+        return false
+    }
+
+    if p.Payload() != nil {
+        return p.Payload().Answers(other.Payload())
+    }
+
+    return true
+}
+
+func (p *Packet) Pack(buf *packet.Buffer) error {
+    buf.WriteN(uint16(p.Flags) | uint16(p.Version & 0x07))
+    buf.WriteN(p.Type)
+
+    if p.Flags & (Checksum | Routing) != 0 {
+        buf.WriteN(uint16(0x0000))
+        buf.WriteN(p.Offset)
+    }
+
+    if p.Flags & Key != 0 {
+        buf.WriteN(p.Key)
+    }
+
+    if p.Flags & Seq != 0 {
+        buf.WriteN(p.Seq)
+    }
+
+    if p.Flags & Ack != 0 {
+        buf.WriteN(p.Ack)
+    }
+
+    if p.Flags & Checksum != 0 {
+        p.Checksum = ipv4.CalculateChecksum(buf.LayerBytes(), 0)
+        buf.PutUint16N(4, p.Checksum)
+    }
+
+    return nil
+}
+
+func (p *Packet) Unpack(buf *packet.Buffer) error {
+    var flags uint16
+    buf.ReadN(&flags)
+
+    p.Flags   = Flags(flags & 0xfff8)
+    p.Version = uint8(flags & 0x07)
+
+    buf.ReadN(&p.Type)
+
+    if p.Flags & (Checksum | Routing) != 0 {
+        buf.ReadN(&p.Checksum)
+        buf.ReadN(&p.Offset)
+    }
+
+    if p.Flags & Key != 0 {
+        buf.ReadN(&p.Key)
+    }
+
+    if p.Flags & Seq != 0 {
+        buf.ReadN(&p.Seq)
+    }
+
+    if p.Flags & Ack != 0 {
+        buf.ReadN(&p.Ack)
+    }
+
+    return nil
+}
+
+func (p *Packet) Payload() packet.Packet {
+    return p.pkt_payload
+}
+
+func (p *Packet) GuessPayloadType() packet.Type {
+    /* source routing entries are not supported */
+    if p.Flags & Routing != 0 {
+        return packet.Raw
+    }
+
+    /* ERSPAN type I has no ERSPAN header nor sequence number */
+    if p.Type == eth.ERSPAN && p.Flags & Seq == 0 {
+        return packet.Eth
+    }
+
+    return eth.EtherTypeToType(p.Type)
+}
+
+func (p *Packet) SetPayload(pl packet.Packet) error {
+    p.pkt_payload = pl
+    p.Type        = eth.UpdateEtherType(p.Type, pl)
+
+    if pl.GetType() == packet.ERSPAN && p.Flags & Seq == 0 {
+        p.Flags |= Seq
+    }
+
+    if e, ok := pl.(*erspan.Packet); ok && e.Version == erspan.TypeIII {
+        p.Type = eth.ERSPAN3
+    }
+
+    return nil
+}
+
+func (p *Packet) InitChecksum(csum uint32) {
+}
+
+func (p *Packet) String() string {
+    return packet.Stringify(p)
+}
+
+// Return the virtual subnet identifier of an NVGRE packet, stored in the upper
+// 24 bits of the key.
+func (p *Packet) VSID() uint32 {
+    return p.Key >> 8
+}
+
+// Return the flow identifier of an NVGRE packet, stored in the lower 8 bits of
+// the key.
+func (p *Packet) FlowID() uint8 {
+    return uint8(p.Key)
+}
+
+// Set the key of an NVGRE packet from the given virtual subnet and flow
+// identifiers.
+func (p *Packet) SetVSID(vsid uint32, flow_id uint8) {
+    p.Flags |= Key
+    p.Key    = vsid << 8 | uint32(flow_id)
+}
+
+func (f Flags) String() string {
+    var flags []string
+
+    if f & Checksum != 0 {
+        flags = append(flags, "checksum")
+    }
+
+    if f & Routing != 0 {
+        flags = append(flags, "routing")
+    }
+
+    if f & Key != 0 {
+        flags = append(flags, "key")
+    }
+
+    if f & Seq != 0 {
+        flags = append(flags, "seq")
+    }
+
+    if f & StrictRoute != 0 {
+        flags = append(flags, "strict")
+    }
+
+    if f & Ack != 0 {
+        flags = append(flags, "ack")
+    }
+
+    if len(flags) == 0 {
+        return fmt.Sprintf("0x%x", uint16(f))
+    }
+
+    return strings.Join(flags, "|")
+}
@@ -0,0 +1,249 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package gre_test
+
+import "bytes"
+import "net"
+import "testing"
+
+import "github.com/ghedo/go.pkt/layers"
+import "github.com/ghedo/go.pkt/packet"
+import "github.com/ghedo/go.pkt/packet/erspan"
+import "github.com/ghedo/go.pkt/packet/eth"
+import "github.com/ghedo/go.pkt/packet/gre"
+import "github.com/ghedo/go.pkt/packet/icmpv4"
+import "github.com/ghedo/go.pkt/packet/ipv4"
+import "github.com/ghedo/go.pkt/packet/raw"
+
+var test_simple = []byte{
+    0xb0, 0x00, 0x08, 0x00, 0x43, 0xe9, 0x00, 0x00, 0x01, 0x02, 0x03, 0x04,
+    0x00, 0x00, 0x00, 0x10,
+}
+
+func MakeTestSimple() *gre.Packet {
+    return &gre.Packet{
+        Flags: gre.Checksum | gre.Key | gre.Seq,
+        Type: eth.IPv4,
+        Checksum: 0x43e9,
+        Key: 0x01020304,
+        Seq: 0x10,
+    }
+}
+
+func TestPack(t *testing.T) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_simple)))
+
+    p := MakeTestSimple()
+
+    err := p.Pack(&b)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if !bytes.Equal(test_simple, b.Buffer()) {
+        t.Fatalf("Raw packet mismatch: %x", b.Buffer())
+    }
+}
+
+func BenchmarkPack(bn *testing.B) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_simple)))
+
+    p := MakeTestSimple()
+
+    for n := 0; n < bn.N; n++ {
+        p.Pack(&b)
+    }
+}
+
+func TestUnpack(t *testing.T) {
+    var p gre.Packet
+
+    cmp := MakeTestSimple()
+
+    var b packet.Buffer
+    b.Init(test_simple)
+
+    err := p.Unpack(&b)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if !p.Equals(cmp) {
+        t.Fatalf("Packet mismatch:\n%s\n%s", &p, cmp)
+    }
+}
+
+func BenchmarkUnpack(bn *testing.B) {
+    var p gre.Packet
+    var b packet.Buffer
+
+    for n := 0; n < bn.N; n++ {
+        b.Init(test_simple)
+        p.Unpack(&b)
+    }
+}
+
+func make_inner() (*eth.Packet, *ipv4.Packet, *icmpv4.Packet) {
+    eth_pkt := eth.Make()
+    eth_pkt.SrcAddr, _ = net.ParseMAC("4c:72:b9:54:e5:3d")
+    eth_pkt.DstAddr, _ = net.ParseMAC("1f:92:2b:56:ed:77")
+
+    ip4_pkt := ipv4.Make()
+    ip4_pkt.SrcAddr = net.ParseIP("192.168.1.2")
+    ip4_pkt.DstAddr = net.ParseIP("192.168.1.1")
+
+    icmp_pkt := icmpv4.Make()
+    icmp_pkt.Id  = 0x1234
+    icmp_pkt.Seq = 1
+
+    return eth_pkt, ip4_pkt, icmp_pkt
+}
+
+func unpack_inner(t *testing.T, buf []byte) *icmpv4.Packet {
+    pkt, err := layers.UnpackAll(buf, packet.IPv4)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    inner, ok := layers.FindLayer(pkt, packet.ICMPv4).(*icmpv4.Packet)
+    if !ok {
+        t.Fatalf("Inner packet not found: %s", pkt)
+    }
+
+    var stack []packet.Packet
+    for p := pkt; p != nil; p = p.Payload() {
+        stack = append(stack, p)
+    }
+
+    raw, err := layers.Pack(stack...)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if !bytes.Equal(raw, buf) {
+        t.Fatalf("Raw packet mismatch:\n%x\n%x", raw, buf)
+    }
+
+    return inner
+}
+
+func TestERSPAN(t *testing.T) {
+    for _, version := range []erspan.Version{ erspan.TypeII, erspan.TypeIII } {
+        outer := ipv4.Make()
+        outer.SrcAddr = net.ParseIP("10.0.0.1")
+        outer.DstAddr = net.ParseIP("10.0.0.2")
+
+        gre_pkt := gre.Make()
+
+        erspan_pkt := erspan.Make()
+        erspan_pkt.Version   = version
+        erspan_pkt.SessionId = 42
+
+        eth_pkt, ip4_pkt, icmp_pkt := make_inner()
+
+        buf, err := layers.Pack(outer, gre_pkt, erspan_pkt, eth_pkt, ip4_pkt,
+                                icmp_pkt)
+        if err != nil {
+            t.Fatalf("Error packing: %s", err)
+        }
+
+        if gre_pkt.Flags & gre.Seq == 0 {
+            t.Fatalf("Sequence number missing: %s", gre_pkt)
+        }
+
+        if version == erspan.TypeIII && gre_pkt.Type != eth.ERSPAN3 {
+            t.Fatalf("Protocol type mismatch: %s", gre_pkt.Type)
+        }
+
+        inner := unpack_inner(t, buf)
+        if !inner.Equals(icmp_pkt) {
+            t.Fatalf("Inner packet mismatch: %s", inner)
+        }
+    }
+}
+
+func TestNVGRE(t *testing.T) {
+    outer := ipv4.Make()
+    outer.SrcAddr = net.ParseIP("10.0.0.1")
+    outer.DstAddr = net.ParseIP("10.0.0.2")
+
+    gre_pkt := gre.Make()
+    gre_pkt.SetVSID(0x123456, 0x78)
+
+    eth_pkt, ip4_pkt, icmp_pkt := make_inner()
+
+    buf, err := layers.Pack(outer, gre_pkt, eth_pkt, ip4_pkt, icmp_pkt)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if gre_pkt.Type != eth.TEB {
+        t.Fatalf("Protocol type mismatch: %s", gre_pkt.Type)
+    }
+
+    unpack_inner(t, buf)
+
+    pkt, _ := layers.UnpackAll(buf, packet.IPv4)
+
+    gre_pkt = layers.FindLayer(pkt, packet.GRE).(*gre.Packet)
+    if gre_pkt.VSID() != 0x123456 || gre_pkt.FlowID() != 0x78 {
+        t.Fatalf("VSID mismatch: %s", gre_pkt)
+    }
+}
+
+var test_unknown = []byte{
+    0x00, 0x00, 0x12, 0x34, 0xde, 0xad, 0xbe, 0xef,
+}
+
+func TestUnknownProtocol(t *testing.T) {
+    var gre_pkt gre.Packet
+    var raw_pkt raw.Packet
+
+    _, err := layers.Unpack(test_unknown, &gre_pkt, &raw_pkt)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if gre_pkt.Type != 0x1234 {
+        t.Fatalf("Protocol type mismatch: %s", gre_pkt.Type)
+    }
+
+    buf, err := layers.Pack(&gre_pkt, &raw_pkt)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if !bytes.Equal(buf, test_unknown) {
+        t.Fatalf("Raw packet mismatch: %x", buf)
+    }
+}
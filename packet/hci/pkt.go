@@ -0,0 +1,548 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+// Provides encoding and decoding for Bluetooth HCI packets in the H4 format
+// with the Linux pseudo-header (LINKTYPE_BLUETOOTH_HCI_H4_WITH_PHDR), as
+// captured on Linux hosts. The payload of ACL data packets is L2CAP.
+package hci
+
+import "encoding/binary"
+import "fmt"
+import "net"
+
+import "github.com/ghedo/go.pkt/packet"
+
+type Packet struct {
+    Direction   Direction     `string:"dir"`
+    Type        Type
+    Opcode      Opcode        `string:"op"`
+    Event       EventCode     `string:"event"`
+    Handle      uint16        `string:"handle"`
+    Flags       uint8         `string:"flags"`
+    Length      uint16        `string:"len"`
+    Params      []byte        `string:"skip"`
+    pkt_payload packet.Packet `cmp:"skip" string:"skip"`
+}
+
+// Direction of the packet, from the point of view of the host.
+type Direction uint32
+
+const (
+    Sent     Direction = 0
+    Received           = 1
+)
+
+// H4 packet indicator.
+type Type uint8
+
+const (
+    Command Type = 0x01
+    ACLData      = 0x02
+    SCOData      = 0x03
+    Event        = 0x04
+    ISOData      = 0x05
+)
+
+// Command opcode, made of the OpCode Group Field (the upper 6 bits) and the
+// OpCode Command Field (the lower 10 bits).
+type Opcode uint16
+
+const (
+    Disconnect            Opcode = 0x0406
+    ReadRemoteVersion            = 0x041d
+    Reset                        = 0x0c03
+    ReadLocalVersion             = 0x1001
+    ReadBDAddr                   = 0x1009
+    LESetEventMask               = 0x2001
+    LEReadBufferSize             = 0x2002
+    LESetRandomAddress           = 0x2005
+    LESetAdvParams               = 0x2006
+    LESetAdvData                 = 0x2008
+    LESetScanRspData             = 0x2009
+    LESetAdvEnable               = 0x200a
+    LESetScanParams              = 0x200b
+    LESetScanEnable              = 0x200c
+    LECreateConn                 = 0x200d
+    LECreateConnCancel           = 0x200e
+    LEConnUpdate                 = 0x2013
+    LEStartEncryption            = 0x2019
+    LELongTermKeyReply           = 0x201a
+)
+
+type EventCode uint8
+
+const (
+    ConnComplete          EventCode = 0x03
+    DisconnComplete                 = 0x05
+    EncryptionChange                = 0x08
+    RemoteVersion                   = 0x0c
+    CommandComplete                 = 0x0e
+    CommandStatus                   = 0x0f
+    HardwareError                   = 0x10
+    NumCompletedPackets             = 0x13
+    EncryptionKeyRefresh            = 0x30
+    LEMeta                          = 0x3e
+)
+
+// LE meta event subevent code.
+type Subevent uint8
+
+const (
+    LEConnComplete         Subevent = 0x01
+    LEAdvReport                     = 0x02
+    LEConnUpdateComplete            = 0x03
+    LERemoteFeatures                = 0x04
+    LELongTermKeyRequest            = 0x05
+    LEDataLengthChange              = 0x07
+    LEEnhancedConnComplete          = 0x0a
+    LEPHYUpdateComplete             = 0x0c
+    LEExtAdvReport                  = 0x0d
+)
+
+// ACL packet boundary flags.
+const (
+    FirstNonFlushable uint8 = 0x0
+    Continuing              = 0x1
+    FirstFlushable          = 0x2
+)
+
+// Advertising report, as carried by LE advertising report events.
+type AdvReport struct {
+    EventType uint8
+    AddrType  uint8
+    Addr      net.HardwareAddr
+    Data      []byte
+    RSSI      int8
+}
+
+func Make() *Packet {
+    return &Packet{
+        Type: Command,
+    }
+}
+
+func (p *Packet) GetType() packet.Type {
+    return packet.HCI
+}
+
+func (p *Packet) GetLength() uint16 {
+    length := 5 + p.header_len() + uint16(len(p.Params))
+
+    if p.pkt_payload != nil {
+        return p.pkt_payload.GetLength() + length
+    }
+
+    return length
+}
+
+func (p *Packet) header_len() uint16 {
+    switch p.Type {
+    case Command: return 3
+    case ACLData: return 4
+    case SCOData: return 3
+    case Event:   return 2
+    case ISOData: return 4
+    default:      return 0
+    }
+}
+
+func (p *Packet) Equals(other packet.Packet) bool {
+    return packet.Compare(p, other)
+}
+
+// Check if the packet is an answer to another packet. Command complete and
+// command status events answer the command with the same opcode, while data
+// packets are matched on the connection handle.
+func (p *Packet) Answers(other packet.Packet) bool {
+    if other == nil || other.GetType() != packet.HCI {
+        return false
+    }
+
+    o := other.(*Packet)
+
+    switch p.Type {
+    case Event:
+        if o.Type != Command {
+            return false
+        }
+
+        opcode, ok := p.CommandOpcode()
+        return ok && opcode == o.Opcode
+
+    case ACLData, SCOData, ISOData:
+        if o.Type != p.Type || o.Handle != p.Handle {
+            return false
+        }
+
+        if p.Payload() != nil {
+            return p.Payload().Answers(other.Payload())
+        }
+
+        return true
+    }
+
+    return false
+}
+
+func (p *Packet) Pack(buf *packet.Buffer) error {
+    buf.WriteN(p.Direction)
+    buf.WriteN(p.Type)
+
+    switch p.Type {
+    case Command:
+        if len(p.Params) > 255 {
+            return fmt.Errorf("Invalid HCI parameters length %d", len(p.Params))
+        }
+
+        buf.WriteL(p.Opcode)
+        buf.WriteN(uint8(len(p.Params)))
+
+    case Event:
+        if len(p.Params) > 255 {
+            return fmt.Errorf("Invalid HCI parameters length %d", len(p.Params))
+        }
+
+        buf.WriteN(p.Event)
+        buf.WriteN(uint8(len(p.Params)))
+
+    case ACLData, ISOData:
+        buf.WriteL(p.Handle & 0x0fff | uint16(p.Flags) << 12)
+        buf.WriteL(p.Length)
+
+    case SCOData:
+        buf.WriteL(p.Handle & 0x0fff | uint16(p.Flags) << 12)
+        buf.WriteN(uint8(p.Length))
+
+    default:
+        return fmt.Errorf("Invalid HCI packet type %d", p.Type)
+    }
+
+    buf.Write(p.Params)
+
+    return nil
+}
+
+func (p *Packet) Unpack(buf *packet.Buffer) error {
+    if buf.Len() < 5 {
+        return fmt.Errorf("Invalid HCI packet length %d", buf.Len())
+    }
+
+    buf.ReadN(&p.Direction)
+    buf.ReadN(&p.Type)
+
+    if buf.Len() < int(p.header_len()) {
+        return fmt.Errorf("Invalid HCI packet length %d", buf.Len())
+    }
+
+    p.Params = nil
+
+    switch p.Type {
+    case Command, Event:
+        var length uint8
+
+        if p.Type == Command {
+            buf.ReadL(&p.Opcode)
+        } else {
+            buf.ReadN(&p.Event)
+        }
+
+        buf.ReadN(&length)
+
+        if buf.Len() < int(length) {
+            return fmt.Errorf("Invalid HCI parameters length %d", length)
+        }
+
+        p.Params = buf.Next(int(length))
+
+    case ACLData, SCOData, ISOData:
+        var hdr uint16
+        buf.ReadL(&hdr)
+
+        p.Handle = hdr & 0x0fff
+        p.Flags  = uint8(hdr >> 12)
+
+        if p.Type == SCOData {
+            var length uint8
+            buf.ReadN(&length)
+            p.Length = uint16(length)
+        } else {
+            buf.ReadL(&p.Length)
+        }
+
+        buf.Truncate(int(p.Length))
+
+    default:
+        return fmt.Errorf("Invalid HCI packet type %d", p.Type)
+    }
+
+    return nil
+}
+
+func (p *Packet) Payload() packet.Packet {
+    return p.pkt_payload
+}
+
+func (p *Packet) GuessPayloadType() packet.Type {
+    switch p.Type {
+    case ACLData:
+        if p.Boundary() == Continuing {
+            return packet.Raw
+        }
+
+        return packet.L2CAP
+
+    case SCOData, ISOData:
+        return packet.Raw
+
+    default:
+        return packet.None
+    }
+}
+
+func (p *Packet) SetPayload(pl packet.Packet) error {
+    p.pkt_payload = pl
+    p.Length      = pl.GetLength()
+
+    return nil
+}
+
+func (p *Packet) InitChecksum(csum uint32) {
+}
+
+func (p *Packet) String() string {
+    return packet.Stringify(p)
+}
+
+// Return the packet boundary flag of ACL data packets.
+func (p *Packet) Boundary() uint8 {
+    return p.Flags & 0x3
+}
+
+// Return the opcode of the command a command complete or command status event
+// refers to.
+func (p *Packet) CommandOpcode() (Opcode, bool) {
+    if p.Type != Event {
+        return 0, false
+    }
+
+    switch {
+    case p.Event == CommandComplete && len(p.Params) >= 3:
+        return Opcode(binary.LittleEndian.Uint16(p.Params[1:])), true
+
+    case p.Event == CommandStatus && len(p.Params) >= 4:
+        return Opcode(binary.LittleEndian.Uint16(p.Params[2:])), true
+    }
+
+    return 0, false
+}
+
+// Return the status of a command complete or command status event. For
+// command complete events this is the first return parameter, which is the
+// status for nearly all commands.
+func (p *Packet) Status() (uint8, bool) {
+    if p.Type != Event {
+        return 0, false
+    }
+
+    switch {
+    case p.Event == CommandComplete && len(p.Params) >= 4:
+        return p.Params[3], true
+
+    case p.Event == CommandStatus && len(p.Params) >= 1:
+        return p.Params[0], true
+
+    case p.Event == DisconnComplete && len(p.Params) >= 1:
+        return p.Params[0], true
+    }
+
+    return 0, false
+}
+
+// Return the return parameters of a command complete event.
+func (p *Packet) ReturnParams() []byte {
+    if p.Type != Event || p.Event != CommandComplete || len(p.Params) < 3 {
+        return nil
+    }
+
+    return p.Params[3:]
+}
+
+// Return the subevent code of LE meta events.
+func (p *Packet) Subevent() (Subevent, bool) {
+    if p.Type != Event || p.Event != LEMeta || len(p.Params) < 1 {
+        return 0, false
+    }
+
+    return Subevent(p.Params[0]), true
+}
+
+// Decode the reports of an LE advertising report event. The advertising data
+// can be further decoded with ble.ParseAdvData().
+func (p *Packet) AdvReports() ([]AdvReport, error) {
+    sub, ok := p.Subevent()
+    if !ok || sub != LEAdvReport {
+        return nil, fmt.Errorf("Not an advertising report")
+    }
+
+    data := p.Params[1:]
+
+    if len(data) < 1 {
+        return nil, fmt.Errorf("Invalid advertising report length")
+    }
+
+    count := int(data[0])
+    data   = data[1:]
+
+    var reports []AdvReport
+
+    for i := 0; i < count; i++ {
+        if len(data) < 9 || len(data) < 10 + int(data[8]) {
+            return nil, fmt.Errorf("Invalid advertising report length")
+        }
+
+        length := int(data[8])
+
+        reports = append(reports, AdvReport{
+            EventType: data[0],
+            AddrType:  data[1],
+            Addr:      ReverseAddr(data[2:8]),
+            Data:      data[9:9 + length],
+            RSSI:      int8(data[9 + length]),
+        })
+
+        data = data[10 + length:]
+    }
+
+    return reports, nil
+}
+
+// Return a copy of the given Bluetooth device address with the bytes in the
+// opposite order. Addresses are transmitted least significant byte first.
+func ReverseAddr(addr []byte) net.HardwareAddr {
+    rev := make(net.HardwareAddr, len(addr))
+
+    for i := range addr {
+        rev[len(addr) - 1 - i] = addr[i]
+    }
+
+    return rev
+}
+
+// Return the OpCode Group Field of the opcode.
+func (o Opcode) OGF() uint8 {
+    return uint8(o >> 10)
+}
+
+// Return the OpCode Command Field of the opcode.
+func (o Opcode) OCF() uint16 {
+    return uint16(o) & 0x03ff
+}
+
+// Make an opcode from the given OpCode Group and Command Fields.
+func MakeOpcode(ogf uint8, ocf uint16) Opcode {
+    return Opcode(uint16(ogf & 0x3f) << 10 | ocf & 0x03ff)
+}
+
+func (d Direction) String() string {
+    switch d {
+    case Sent:     return "sent"
+    case Received: return "rcvd"
+    default:       return fmt.Sprintf("%d", uint32(d))
+    }
+}
+
+func (t Type) String() string {
+    switch t {
+    case Command: return "cmd"
+    case ACLData: return "acl"
+    case SCOData: return "sco"
+    case Event:   return "event"
+    case ISOData: return "iso"
+    default:      return fmt.Sprintf("0x%x", uint8(t))
+    }
+}
+
+func (o Opcode) String() string {
+    switch o {
+    case 0:                  return ""
+    case Disconnect:         return "disconnect"
+    case ReadRemoteVersion:  return "read_remote_version"
+    case Reset:              return "reset"
+    case ReadLocalVersion:   return "read_local_version"
+    case ReadBDAddr:         return "read_bd_addr"
+    case LESetEventMask:     return "le_set_event_mask"
+    case LEReadBufferSize:   return "le_read_buffer_size"
+    case LESetRandomAddress: return "le_set_random_address"
+    case LESetAdvParams:     return "le_set_adv_params"
+    case LESetAdvData:       return "le_set_adv_data"
+    case LESetScanRspData:   return "le_set_scan_rsp_data"
+    case LESetAdvEnable:     return "le_set_adv_enable"
+    case LESetScanParams:    return "le_set_scan_params"
+    case LESetScanEnable:    return "le_set_scan_enable"
+    case LECreateConn:       return "le_create_conn"
+    case LECreateConnCancel: return "le_create_conn_cancel"
+    case LEConnUpdate:       return "le_conn_update"
+    case LEStartEncryption:  return "le_start_encryption"
+    case LELongTermKeyReply: return "le_ltk_reply"
+    default:                 return fmt.Sprintf("0x%04x", uint16(o))
+    }
+}
+
+func (e EventCode) String() string {
+    switch e {
+    case 0:                    return ""
+    case ConnComplete:         return "conn_complete"
+    case DisconnComplete:      return "disconn_complete"
+    case EncryptionChange:     return "encryption_change"
+    case RemoteVersion:        return "remote_version"
+    case CommandComplete:      return "cmd_complete"
+    case CommandStatus:        return "cmd_status"
+    case HardwareError:        return "hardware_error"
+    case NumCompletedPackets:  return "num_completed_packets"
+    case EncryptionKeyRefresh: return "encryption_key_refresh"
+    case LEMeta:               return "le_meta"
+    default:                   return fmt.Sprintf("0x%x", uint8(e))
+    }
+}
+
+func (s Subevent) String() string {
+    switch s {
+    case LEConnComplete:         return "le_conn_complete"
+    case LEAdvReport:            return "le_adv_report"
+    case LEConnUpdateComplete:   return "le_conn_update_complete"
+    case LERemoteFeatures:       return "le_remote_features"
+    case LELongTermKeyRequest:   return "le_ltk_request"
+    case LEDataLengthChange:     return "le_data_length_change"
+    case LEEnhancedConnComplete: return "le_enhanced_conn_complete"
+    case LEPHYUpdateComplete:    return "le_phy_update_complete"
+    case LEExtAdvReport:         return "le_ext_adv_report"
+    default:                     return fmt.Sprintf("0x%x", uint8(s))
+    }
+}
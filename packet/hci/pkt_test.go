@@ -0,0 +1,233 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package hci_test
+
+import "bytes"
+import "testing"
+
+import "github.com/ghedo/go.pkt/layers"
+import "github.com/ghedo/go.pkt/packet"
+import "github.com/ghedo/go.pkt/packet/att"
+import "github.com/ghedo/go.pkt/packet/hci"
+import "github.com/ghedo/go.pkt/packet/l2cap"
+
+var test_simple = []byte{
+    0x00, 0x00, 0x00, 0x00, 0x01, 0x0c, 0x20, 0x02, 0x01, 0x00,
+}
+
+func MakeTestSimple() *hci.Packet {
+    return &hci.Packet{
+        Direction: hci.Sent,
+        Type: hci.Command,
+        Opcode: hci.LESetScanEnable,
+        Params: []byte{ 0x01, 0x00 },
+    }
+}
+
+func TestPack(t *testing.T) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_simple)))
+
+    p := MakeTestSimple()
+
+    err := p.Pack(&b)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if !bytes.Equal(test_simple, b.Buffer()) {
+        t.Fatalf("Raw packet mismatch: %x", b.Buffer())
+    }
+}
+
+func BenchmarkPack(bn *testing.B) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_simple)))
+
+    p := MakeTestSimple()
+
+    for n := 0; n < bn.N; n++ {
+        p.Pack(&b)
+    }
+}
+
+func TestUnpack(t *testing.T) {
+    var p hci.Packet
+
+    cmp := MakeTestSimple()
+
+    var b packet.Buffer
+    b.Init(test_simple)
+
+    err := p.Unpack(&b)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if !p.Equals(cmp) {
+        t.Fatalf("Packet mismatch:\n%s\n%s", &p, cmp)
+    }
+
+    if p.Opcode.OGF() != 0x08 || p.Opcode.OCF() != 0x0c {
+        t.Fatalf("Opcode mismatch: %s", p.Opcode)
+    }
+}
+
+func BenchmarkUnpack(bn *testing.B) {
+    var p hci.Packet
+    var b packet.Buffer
+
+    for n := 0; n < bn.N; n++ {
+        b.Init(test_simple)
+        p.Unpack(&b)
+    }
+}
+
+var test_complete = []byte{
+    0x00, 0x00, 0x00, 0x01, 0x04, 0x0e, 0x04, 0x01, 0x0c, 0x20, 0x00,
+}
+
+var test_report = []byte{
+    0x00, 0x00, 0x00, 0x01, 0x04, 0x3e, 0x13, 0x02, 0x01, 0x00, 0x01, 0x55,
+    0x44, 0x33, 0x22, 0x11, 0x00, 0x07, 0x02, 0x01, 0x06, 0x03, 0x09, 0x67,
+    0x6f, 0xc4,
+}
+
+func TestEvent(t *testing.T) {
+    cmd, _ := layers.UnpackAll(test_simple, packet.LinkType(201))
+
+    p, err := layers.UnpackAll(test_complete, packet.LinkType(201))
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    status, ok := p.(*hci.Packet).Status()
+    if !ok || status != 0 || !p.Answers(cmd) {
+        t.Fatalf("Packet mismatch: %s", p)
+    }
+
+    p, err = layers.UnpackAll(test_report, packet.HCI)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    reports, err := p.(*hci.Packet).AdvReports()
+    if err != nil {
+        t.Fatalf("Error decoding reports: %s", err)
+    }
+
+    if len(reports) != 1 || reports[0].EventType != 0 ||
+       reports[0].Addr.String() != "00:11:22:33:44:55" ||
+       len(reports[0].Data) != 7 || reports[0].RSSI != -60 {
+        t.Fatalf("Report mismatch: %v", reports)
+    }
+
+    if p.Answers(cmd) {
+        t.Fatalf("Unexpected answer: %s", p)
+    }
+}
+
+var test_acl = []byte{
+    0x00, 0x00, 0x00, 0x01, 0x02, 0x40, 0x20, 0x09, 0x00, 0x05, 0x00, 0x04,
+    0x00, 0x0b, 0x67, 0x6f, 0x70, 0x6b,
+}
+
+func TestACL(t *testing.T) {
+    hci_pkt := &hci.Packet{
+        Direction: hci.Received,
+        Type: hci.ACLData,
+        Handle: 0x40,
+        Flags: hci.FirstFlushable,
+    }
+
+    att_pkt := &att.Packet{
+        Opcode: att.ReadRsp,
+        Value: []byte("gopk"),
+    }
+
+    buf, err := layers.Pack(hci_pkt, l2cap.Make(), att_pkt)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if !bytes.Equal(buf, test_acl) {
+        t.Fatalf("Raw packet mismatch: %x", buf)
+    }
+
+    p, err := layers.UnpackAll(buf, packet.HCI)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    l := layers.FindLayer(p, packet.ATT)
+    if l == nil || !l.Equals(att_pkt) {
+        t.Fatalf("Packet mismatch: %s", p)
+    }
+
+    req := &hci.Packet{
+        Direction: hci.Sent,
+        Type: hci.ACLData,
+        Handle: 0x40,
+        Flags: hci.FirstNonFlushable,
+    }
+
+    req_buf, err := layers.Pack(req, l2cap.Make(), &att.Packet{
+        Opcode: att.ReadReq,
+        Handle: 0x03,
+    })
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    req_pkt, err := layers.UnpackAll(req_buf, packet.HCI)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if !p.Answers(req_pkt) {
+        t.Fatalf("No answer: %s", p)
+    }
+
+    /* fragmented frames are not decoded */
+    buf[7] = 0x07
+    buf    = buf[:len(buf) - 2]
+
+    p, err = layers.UnpackAll(buf, packet.HCI)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    l = layers.FindLayer(p, packet.L2CAP)
+    if l == nil || !l.(*l2cap.Packet).Fragmented() ||
+       l.Payload().GetType() != packet.Raw {
+        t.Fatalf("Packet mismatch: %s", p)
+    }
+}
@@ -0,0 +1,462 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+// Provides encoding and decoding for IGMP packets, covering IGMPv1 (RFC 1112),
+// IGMPv2 (RFC 2236) and IGMPv3 (RFC 3376).
+package igmp
+
+import "bytes"
+import "fmt"
+import "net"
+import "time"
+
+import "github.com/ghedo/go.pkt/packet"
+import "github.com/ghedo/go.pkt/packet/ipv4"
+
+type Packet struct {
+    Type        Type
+    Version     uint8         `string:"ver"`
+    MaxResp     uint8         `string:"maxresp"`
+    Checksum    uint16        `string:"sum"`
+    Group       net.IP        `string:"group"`
+
+    /* IGMPv3 queries */
+    Suppress    bool          `string:"s"`
+    QRV         uint8         `string:"qrv"`
+    QQIC        uint8         `string:"qqic"`
+    Sources     []net.IP      `string:"skip"`
+
+    /* IGMPv3 reports */
+    Records     []GroupRecord `string:"skip"`
+}
+
+type Type uint8
+
+const (
+    Query    Type = 0x11
+    ReportV1      = 0x12
+    ReportV2      = 0x16
+    Leave         = 0x17
+    ReportV3      = 0x22
+)
+
+// GroupRecord describes the membership of a group in an IGMPv3 report.
+type GroupRecord struct {
+    Type    RecordType
+    Group   net.IP
+    Sources []net.IP
+    AuxData []byte
+}
+
+type RecordType uint8
+
+const (
+    ModeIsInclude   RecordType = 1
+    ModeIsExclude              = 2
+    ChangeToInclude            = 3
+    ChangeToExclude            = 4
+    AllowNewSources            = 5
+    BlockOldSources            = 6
+)
+
+func Make() *Packet {
+    return &Packet{
+        Type: Query,
+        Version: 2,
+        MaxResp: 100,
+        Group: net.IPv4zero,
+    }
+}
+
+// Create a report joining the given group, in the format of the given IGMP
+// version.
+func Join(version uint8, group net.IP) *Packet {
+    switch version {
+    case 1:
+        return &Packet{ Type: ReportV1, Version: 1, Group: group }
+
+    case 2:
+        return &Packet{ Type: ReportV2, Version: 2, Group: group }
+
+    default:
+        return &Packet{
+            Type: ReportV3,
+            Version: 3,
+            Records: []GroupRecord{
+                { Type: ChangeToExclude, Group: group },
+            },
+        }
+    }
+}
+
+// Create a message leaving the given group, in the format of the given IGMP
+// version. IGMPv1 hosts leave groups silently, so nil is returned.
+func LeaveGroup(version uint8, group net.IP) *Packet {
+    switch version {
+    case 1:
+        return nil
+
+    case 2:
+        return &Packet{ Type: Leave, Version: 2, Group: group }
+
+    default:
+        return &Packet{
+            Type: ReportV3,
+            Version: 3,
+            Records: []GroupRecord{
+                { Type: ChangeToInclude, Group: group },
+            },
+        }
+    }
+}
+
+func (p *Packet) GetType() packet.Type {
+    return packet.IGMP
+}
+
+func (p *Packet) GetLength() uint16 {
+    switch {
+    case p.Type == Query && p.Version == 3:
+        return 12 + 4 * uint16(len(p.Sources))
+
+    case p.Type == ReportV3:
+        length := 8
+
+        for _, r := range p.Records {
+            length += 8 + 4 * len(r.Sources) + len(r.AuxData)
+        }
+
+        return uint16(length)
+
+    default:
+        return 8
+    }
+}
+
+func (p *Packet) Equals(other packet.Packet) bool {
+    return packet.Compare(p, other)
+}
+
+// Check whether the packet is a report (or leave) for a group asked about by
+// the given query, or a group specific query triggered by the given leave.
+func (p *Packet) Answers(other packet.Packet) bool {
+    if other == nil || other.GetType() != packet.IGMP {
+        return false
+    }
+
+    req := other.(*Packet)
+
+    switch {
+    case req.Type == Query && p.Type != Query:
+        if req.Group == nil || req.Group.IsUnspecified() {
+            return true
+        }
+
+        for _, group := range p.Groups() {
+            if group.Equal(req.Group) {
+                return true
+            }
+        }
+
+        return false
+
+    case req.Type == Leave && p.Type == Query:
+        return p.Group.Equal(req.Group)
+
+    default:
+        return false
+    }
+}
+
+func (p *Packet) Pack(buf *packet.Buffer) error {
+    buf.WriteN(p.Type)
+
+    if p.Type == ReportV3 {
+        buf.WriteN(uint8(0x00))
+    } else {
+        buf.WriteN(p.MaxResp)
+    }
+
+    buf.WriteN(uint16(0x0000))
+
+    switch {
+    case p.Type == Query && p.Version == 3:
+        buf.Write(addr4(p.Group))
+
+        flags := p.QRV & 0x07
+        if p.Suppress {
+            flags |= 0x08
+        }
+
+        buf.WriteN(flags)
+        buf.WriteN(p.QQIC)
+        buf.WriteN(uint16(len(p.Sources)))
+
+        for _, src := range p.Sources {
+            buf.Write(addr4(src))
+        }
+
+    case p.Type == ReportV3:
+        buf.WriteN(uint16(0x0000))
+        buf.WriteN(uint16(len(p.Records)))
+
+        for _, r := range p.Records {
+            if len(r.AuxData) % 4 != 0 {
+                return fmt.Errorf("Invalid auxiliary data length %d",
+                                  len(r.AuxData))
+            }
+
+            buf.WriteN(r.Type)
+            buf.WriteN(uint8(len(r.AuxData) / 4))
+            buf.WriteN(uint16(len(r.Sources)))
+            buf.Write(addr4(r.Group))
+
+            for _, src := range r.Sources {
+                buf.Write(addr4(src))
+            }
+
+            buf.Write(r.AuxData)
+        }
+
+    default:
+        buf.Write(addr4(p.Group))
+    }
+
+    p.Checksum = ipv4.CalculateChecksum(buf.LayerBytes()[:p.GetLength()], 0)
+    buf.PutUint16N(2, p.Checksum)
+
+    return nil
+}
+
+func (p *Packet) Unpack(buf *packet.Buffer) error {
+    buf.ReadN(&p.Type)
+    buf.ReadN(&p.MaxResp)
+    buf.ReadN(&p.Checksum)
+
+    p.Sources = nil
+    p.Records = nil
+
+    switch p.Type {
+    case Query:
+        p.Group = net.IP(buf.Next(4))
+
+        /* the version of queries depends on their length (IGMPv3 queries
+         * are at least 12 bytes long, IGMPv1/v2 ones exactly 8) */
+        switch {
+        case buf.Len() >= 4:
+            p.Version = 3
+
+        case p.MaxResp == 0:
+            p.Version = 1
+
+        default:
+            p.Version = 2
+        }
+
+        if p.Version != 3 {
+            break
+        }
+
+        var flags uint8
+        buf.ReadN(&flags)
+
+        p.Suppress = flags & 0x08 != 0
+        p.QRV      = flags & 0x07
+
+        buf.ReadN(&p.QQIC)
+
+        var count uint16
+        buf.ReadN(&count)
+
+        if int(count) * 4 > buf.Len() {
+            return fmt.Errorf("Invalid number of sources %d", count)
+        }
+
+        for i := 0; i < int(count); i++ {
+            p.Sources = append(p.Sources, net.IP(buf.Next(4)))
+        }
+
+    case ReportV3:
+        p.Version = 3
+
+        var count uint16
+        buf.Next(2)
+        buf.ReadN(&count)
+
+        for i := 0; i < int(count); i++ {
+            var r GroupRecord
+            var aux_len uint8
+            var srcs uint16
+
+            buf.ReadN(&r.Type)
+            buf.ReadN(&aux_len)
+            buf.ReadN(&srcs)
+
+            r.Group = net.IP(buf.Next(4))
+
+            if int(srcs) * 4 + int(aux_len) * 4 > buf.Len() {
+                return fmt.Errorf("Invalid group record length")
+            }
+
+            for j := 0; j < int(srcs); j++ {
+                r.Sources = append(r.Sources, net.IP(buf.Next(4)))
+            }
+
+            if aux_len > 0 {
+                r.AuxData = buf.Next(int(aux_len) * 4)
+            }
+
+            p.Records = append(p.Records, r)
+        }
+
+    case ReportV1:
+        p.Version = 1
+        p.Group   = net.IP(buf.Next(4))
+
+    default:
+        p.Version = 2
+        p.Group   = net.IP(buf.Next(4))
+    }
+
+    return nil
+}
+
+func (p *Packet) Payload() packet.Packet {
+    return nil
+}
+
+func (p *Packet) GuessPayloadType() packet.Type {
+    return packet.None
+}
+
+func (p *Packet) SetPayload(pl packet.Packet) error {
+    return nil
+}
+
+func (p *Packet) InitChecksum(csum uint32) {
+}
+
+func (p *Packet) String() string {
+    return packet.Stringify(p)
+}
+
+// Return the groups the packet refers to. For IGMPv3 reports these are the
+// groups of all the records.
+func (p *Packet) Groups() []net.IP {
+    if p.Type != ReportV3 {
+        return []net.IP{ p.Group }
+    }
+
+    var groups []net.IP
+
+    for _, r := range p.Records {
+        groups = append(groups, r.Group)
+    }
+
+    return groups
+}
+
+// Return the maximum response time advertised by a query.
+func (p *Packet) MaxRespTime() time.Duration {
+    switch p.Version {
+    case 1:
+        return 10 * time.Second
+
+    case 2:
+        return time.Duration(p.MaxResp) * time.Second / 10
+    }
+
+    return decode_code(p.MaxResp) * time.Second / 10
+}
+
+// Return the querier's query interval advertised by an IGMPv3 query.
+func (p *Packet) QueryInterval() time.Duration {
+    return decode_code(p.QQIC) * time.Second
+}
+
+// Decode the floating point representation used by the max response code and
+// QQIC fields of IGMPv3 queries.
+func decode_code(code uint8) time.Duration {
+    if code < 128 {
+        return time.Duration(code)
+    }
+
+    mant := uint(code & 0x0f)
+    exp  := uint(code >> 4) & 0x07
+
+    return time.Duration((mant | 0x10) << (exp + 3))
+}
+
+func addr4(ip net.IP) []byte {
+    if ip4 := ip.To4(); ip4 != nil {
+        return ip4
+    }
+
+    return net.IPv4zero.To4()
+}
+
+func (r GroupRecord) Equal(other GroupRecord) bool {
+    if r.Type != other.Type || !r.Group.Equal(other.Group) ||
+       len(r.Sources) != len(other.Sources) ||
+       !bytes.Equal(r.AuxData, other.AuxData) {
+        return false
+    }
+
+    for i := range r.Sources {
+        if !r.Sources[i].Equal(other.Sources[i]) {
+            return false
+        }
+    }
+
+    return true
+}
+
+func (t Type) String() string {
+    switch t {
+    case Query:    return "query"
+    case ReportV1: return "v1-report"
+    case ReportV2: return "v2-report"
+    case Leave:    return "leave"
+    case ReportV3: return "v3-report"
+    default:       return fmt.Sprintf("0x%x", uint8(t))
+    }
+}
+
+func (t RecordType) String() string {
+    switch t {
+    case ModeIsInclude:   return "is-include"
+    case ModeIsExclude:   return "is-exclude"
+    case ChangeToInclude: return "to-include"
+    case ChangeToExclude: return "to-exclude"
+    case AllowNewSources: return "allow"
+    case BlockOldSources: return "block"
+    default:              return fmt.Sprintf("0x%x", uint8(t))
+    }
+}
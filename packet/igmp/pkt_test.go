@@ -0,0 +1,275 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package igmp_test
+
+import "bytes"
+import "net"
+import "testing"
+import "time"
+
+import "github.com/ghedo/go.pkt/layers"
+import "github.com/ghedo/go.pkt/packet"
+import "github.com/ghedo/go.pkt/packet/eth"
+import "github.com/ghedo/go.pkt/packet/igmp"
+import "github.com/ghedo/go.pkt/packet/ipv4"
+
+var test_simple = []byte{
+    0x11, 0x64, 0xfa, 0x1a, 0xe0, 0x00, 0x00, 0x01,
+    0x0a, 0x7d, 0x00, 0x01, 0x0a, 0x00, 0x00, 0x01,
+}
+
+func MakeTestSimple() *igmp.Packet {
+    return &igmp.Packet{
+        Type: igmp.Query,
+        Version: 3,
+        MaxResp: 100,
+        Checksum: 0xfa1a,
+        Group: net.ParseIP("224.0.0.1"),
+        Suppress: true,
+        QRV: 2,
+        QQIC: 125,
+        Sources: []net.IP{ net.ParseIP("10.0.0.1") },
+    }
+}
+
+func TestPack(t *testing.T) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_simple)))
+
+    p := MakeTestSimple()
+
+    err := p.Pack(&b)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if !bytes.Equal(test_simple, b.Buffer()) {
+        t.Fatalf("Raw packet mismatch: %x", b.Buffer())
+    }
+}
+
+func BenchmarkPack(bn *testing.B) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_simple)))
+
+    p := MakeTestSimple()
+
+    for n := 0; n < bn.N; n++ {
+        p.Pack(&b)
+    }
+}
+
+func TestUnpack(t *testing.T) {
+    var p igmp.Packet
+
+    cmp := MakeTestSimple()
+
+    var b packet.Buffer
+    b.Init(test_simple)
+
+    err := p.Unpack(&b)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if !p.Equals(cmp) {
+        t.Fatalf("Packet mismatch:\n%s\n%s", &p, cmp)
+    }
+
+    if p.MaxRespTime() != 10 * time.Second ||
+       p.QueryInterval() != 125 * time.Second {
+        t.Fatalf("Query timers mismatch: %s", &p)
+    }
+}
+
+func BenchmarkUnpack(bn *testing.B) {
+    var p igmp.Packet
+    var b packet.Buffer
+
+    for n := 0; n < bn.N; n++ {
+        b.Init(test_simple)
+        p.Unpack(&b)
+    }
+}
+
+var test_report = []byte{
+    0x22, 0x00, 0x46, 0x52, 0x00, 0x00, 0x00, 0x02,
+    0x04, 0x00, 0x00, 0x00, 0xe0, 0x00, 0x00, 0xfb,
+    0x01, 0x00, 0x00, 0x01, 0xef, 0x01, 0x02, 0x03, 0xc0, 0xa8, 0x00, 0x01,
+}
+
+func MakeTestReport() *igmp.Packet {
+    return &igmp.Packet{
+        Type: igmp.ReportV3,
+        Version: 3,
+        Checksum: 0x4652,
+        Records: []igmp.GroupRecord{
+            {
+                Type: igmp.ChangeToExclude,
+                Group: net.ParseIP("224.0.0.251"),
+            },
+            {
+                Type: igmp.ModeIsInclude,
+                Group: net.ParseIP("239.1.2.3"),
+                Sources: []net.IP{ net.ParseIP("192.168.0.1") },
+            },
+        },
+    }
+}
+
+func TestPackReport(t *testing.T) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_report)))
+
+    p := MakeTestReport()
+
+    err := p.Pack(&b)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if !bytes.Equal(test_report, b.Buffer()) {
+        t.Fatalf("Raw packet mismatch: %x", b.Buffer())
+    }
+}
+
+func TestUnpackReport(t *testing.T) {
+    var p igmp.Packet
+
+    cmp := MakeTestReport()
+
+    var b packet.Buffer
+    b.Init(test_report)
+
+    err := p.Unpack(&b)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if !p.Equals(cmp) {
+        t.Fatalf("Packet mismatch:\n%s\n%s", &p, cmp)
+    }
+}
+
+func TestVersions(t *testing.T) {
+    group := net.ParseIP("239.1.2.3")
+
+    for _, version := range []uint8{ 1, 2, 3 } {
+        ip4 := ipv4.Make()
+        ip4.SrcAddr = net.ParseIP("192.168.0.1")
+        ip4.DstAddr = group
+
+        join := igmp.Join(version, group)
+
+        buf, err := layers.Pack(ip4, join)
+        if err != nil {
+            t.Fatalf("Error packing: %s", err)
+        }
+
+        pkt, err := layers.UnpackAll(buf, packet.IPv4)
+        if err != nil {
+            t.Fatalf("Error unpacking: %s", err)
+        }
+
+        dec, ok := layers.FindLayer(pkt, packet.IGMP).(*igmp.Packet)
+        if !ok || !dec.Equals(join) || dec.Version != version {
+            t.Fatalf("IGMP layer mismatch: %s", pkt)
+        }
+
+        if ipv4.CalculateChecksum(buf[20:], 0) != 0 {
+            t.Fatalf("Invalid checksum: %x", buf[20:])
+        }
+    }
+
+    if igmp.LeaveGroup(1, group) != nil {
+        t.Fatalf("IGMPv1 leave message created")
+    }
+}
+
+func TestPadding(t *testing.T) {
+    ip4 := ipv4.Make()
+    ip4.SrcAddr = net.ParseIP("192.168.0.1")
+    ip4.DstAddr = net.ParseIP("224.0.0.1")
+
+    query := igmp.Make()
+    query.MaxResp = 200
+
+    buf, err := layers.Pack(eth.Make(), ip4, query)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    /* pad to the minimum Ethernet frame size */
+    buf = append(buf, make([]byte, 60 - len(buf))...)
+
+    pkt, err := layers.UnpackAll(buf, packet.Eth)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    dec, ok := layers.FindLayer(pkt, packet.IGMP).(*igmp.Packet)
+    if !ok || dec.Version != 2 || dec.GetLength() != 8 {
+        t.Fatalf("IGMP layer mismatch: %s", pkt)
+    }
+
+    if dec.MaxRespTime() != 20 * time.Second {
+        t.Fatalf("Max response time mismatch: %s", dec.MaxRespTime())
+    }
+}
+
+func TestAnswers(t *testing.T) {
+    general := igmp.Make()
+
+    specific := igmp.Make()
+    specific.Group = net.ParseIP("239.1.2.3")
+
+    report := MakeTestReport()
+
+    if !report.Answers(general) || !report.Answers(specific) {
+        t.Fatalf("Report doesn't answer query")
+    }
+
+    specific.Group = net.ParseIP("239.9.9.9")
+
+    if report.Answers(specific) {
+        t.Fatalf("Report answers query for another group")
+    }
+
+    leave := igmp.LeaveGroup(2, specific.Group)
+
+    if !specific.Answers(leave) {
+        t.Fatalf("Group specific query doesn't answer leave")
+    }
+
+    if general.Answers(report) {
+        t.Fatalf("Query answers report")
+    }
+}
@@ -71,9 +71,11 @@ const (
     IGMP          = 0x02
     IPSecAH       = 0x33
     IPSecESP      = 0x32
+    IPv4          = 0x04
     IPv6          = 0x29
     ISIS          = 0x7C
     L2TP          = 0x73
+    MPLS          = 0x89
     OSPF          = 0x59
     SCTP          = 0x84
     TCP           = 0x06
@@ -118,8 +120,15 @@ func (p *Packet) Answers(other packet.Packet) bool {
         return p.Payload().Payload().Equals(other)
     }
 
-    if !p.SrcAddr.Equal(other.(*Packet).DstAddr) ||
-        p.Protocol != other.(*Packet).Protocol {
+    /* answers to broadcast and multicast packets come from any address */
+    dst := other.(*Packet).DstAddr
+
+    if !dst.Equal(net.IPv4bcast) && !dst.IsMulticast() &&
+       !p.SrcAddr.Equal(dst) {
+        return false
+    }
+
+    if p.Protocol != other.(*Packet).Protocol {
         return false
     }
 
@@ -197,7 +206,13 @@ func (p *Packet) Unpack(buf *packet.Buffer) error {
     p.SrcAddr = net.IP(buf.Next(4))
     p.DstAddr = net.IP(buf.Next(4))
 
-    /* TODO: Options */
+    /* TODO: Options, skip them for now */
+    if p.IHL > 5 {
+        buf.Next(int(p.IHL) * 4 - 20)
+    }
+
+    /* strip the link-layer padding (e.g. of short Ethernet frames) */
+    buf.Truncate(int(p.Length) - buf.LayerLen())
 
     return nil
 }
@@ -253,6 +268,11 @@ func CalculateChecksum(raw_bytes []byte, csum uint32) uint16 {
         csum += uint32(raw_bytes[i + 1])
     }
 
+    /* pad odd-length data with a zero byte */
+    if len(raw_bytes) % 2 != 0 {
+        csum += uint32(raw_bytes[length]) << 8
+    }
+
     csum = (csum >> 16) + (csum & 0xffff)
 
     return ^uint16(csum + (csum >> 16))
@@ -264,12 +284,14 @@ var ipv4proto_to_type_map = map[Protocol]packet.Type{
     ICMPv4:   packet.ICMPv4,
     ICMPv6:   packet.ICMPv6,
     IGMP:     packet.IGMP,
-    IPSecAH:  packet.IPSec,
-    IPSecESP: packet.IPSec,
+    IPSecAH:  packet.AH,
+    IPSecESP: packet.ESP,
+    IPv4:     packet.IPv4,
     IPv6:     packet.IPv6,
     UDP:      packet.UDP,
     ISIS:     packet.ISIS,
-    L2TP:     packet.L2TP,
+    L2TP:     packet.L2TPIP,
+    MPLS:     packet.MPLS,
     OSPF:     packet.OSPF,
     SCTP:     packet.SCTP,
     UDPLite:  packet.UDPLite,
@@ -306,10 +328,12 @@ func (p Protocol) String() string {
     case IGMP:     return "IGMP"
     case IPSecAH:  return "IPSecAH"
     case IPSecESP: return "IPSecESP"
+    case IPv4:     return "IPv4"
     case IPv6:     return "IPv6"
     case UDP:      return "UDP"
     case ISIS:     return "ISIS"
     case L2TP:     return "L2TP"
+    case MPLS:     return "MPLS"
     case OSPF:     return "OSPF"
     case SCTP:     return "SCTP"
     case UDPLite:  return "UDPLite"
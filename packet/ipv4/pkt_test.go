@@ -34,8 +34,11 @@ import "bytes"
 import "net"
 import "testing"
 
+import "github.com/ghedo/go.pkt/layers"
 import "github.com/ghedo/go.pkt/packet"
 import "github.com/ghedo/go.pkt/packet/ipv4"
+import "github.com/ghedo/go.pkt/packet/raw"
+import "github.com/ghedo/go.pkt/packet/udp"
 
 var test_simple = []byte{
     0x45, 0x03, 0x00, 0x14, 0x00, 0x0f, 0x40, 0x00, 0x64, 0x06, 0x48, 0x97,
@@ -115,3 +118,42 @@ func BenchmarkUnpack(bn *testing.B) {
         p.Unpack(&b)
     }
 }
+
+func TestChecksumOddLength(t *testing.T) {
+    data := []byte{ 0x01, 0x02, 0x03 }
+
+    /* the last byte is padded with a zero byte */
+    csum := ipv4.CalculateChecksum(data, 0)
+    if csum != 0xfbfd {
+        t.Fatalf("Checksum mismatch: %x", csum)
+    }
+
+    if csum != ipv4.CalculateChecksum(append(data, 0x00), 0) {
+        t.Fatalf("Checksum mismatch with explicit padding: %x", csum)
+    }
+}
+
+var test_options = []byte{
+    0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x00, 0x11, 0x22, 0x33, 0x44, 0x55,
+    0x08, 0x00, 0x46, 0x00, 0x00, 0x22, 0x00, 0x01, 0x00, 0x00, 0x40, 0x11,
+    0x00, 0x00, 0xc0, 0xa8, 0x01, 0x01, 0xc0, 0xa8, 0x01, 0x02, 0x94, 0x04,
+    0x00, 0x00, 0x9c, 0x40, 0x22, 0xb8, 0x00, 0x0a, 0x00, 0x00, 0x68, 0x69,
+    0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+}
+
+func TestUnpackOptionsPadding(t *testing.T) {
+    pkt, err := layers.UnpackAll(test_options, packet.Eth)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    udp_pkt, ok := layers.FindLayer(pkt, packet.UDP).(*udp.Packet)
+    if !ok || udp_pkt.SrcPort != 40000 || udp_pkt.DstPort != 8888 {
+        t.Fatalf("UDP layer mismatch: %s", pkt)
+    }
+
+    raw_pkt, ok := layers.FindLayer(pkt, packet.Raw).(*raw.Packet)
+    if !ok || !bytes.Equal(raw_pkt.Data, []byte("hi")) {
+        t.Fatalf("Payload mismatch: %s", pkt)
+    }
+}
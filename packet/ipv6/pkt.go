@@ -147,6 +147,11 @@ func (p *Packet) Unpack(buf *packet.Buffer) error {
 
     /* TODO: Options */
 
+    /* strip the link-layer padding, a zero length is used by jumbograms */
+    if p.Length > 0 {
+        buf.Truncate(int(p.Length))
+    }
+
     return nil
 }
 
@@ -0,0 +1,481 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+// Provides encoding and decoding for IS-IS (ISO 10589, RFC 1195) PDUs,
+// including the TLVs they carry.
+package isis
+
+import "fmt"
+import "strings"
+
+import "github.com/ghedo/go.pkt/packet"
+import "github.com/ghedo/go.pkt/packet/ospf"
+
+type Packet struct {
+    Type           PDUType
+    Version        uint8       `string:"ver"`
+    MaxAreaAddrs   uint8       `string:"maxarea"`
+
+    /* Hello */
+    CircuitType    CircuitType `string:"circuit"`
+    SourceId       SystemId    `string:"src"`
+    HoldingTime    uint16      `string:"hold"`
+    Length         uint16      `cmp:"skip" string:"len"`
+    Priority       uint8       `string:"prio"`
+    LANId          NodeId      `string:"lan"`
+    LocalCircuitId uint8       `string:"circuit_id"`
+
+    /* Link State PDU */
+    Lifetime       uint16      `string:"lifetime"`
+    LSPId          LSPId       `string:"lsp"`
+    Seq            uint32      `string:"seq"`
+    Checksum       uint16      `cmp:"skip" string:"sum"`
+    LSPFlags       LSPFlags    `string:"flags"`
+
+    /* Complete Sequence Numbers PDU */
+    StartLSPId     LSPId       `string:"start"`
+    EndLSPId       LSPId       `string:"end"`
+
+    TLVs           []TLV       `string:"skip"`
+
+    csum_data      []byte      `cmp:"skip" string:"skip"`
+}
+
+type PDUType uint8
+
+const (
+    L1LANHello PDUType = 15
+    L2LANHello         = 16
+    P2PHello           = 17
+    L1LSP              = 18
+    L2LSP              = 20
+    L1CSNP             = 24
+    L2CSNP             = 25
+    L1PSNP             = 26
+    L2PSNP             = 27
+)
+
+type CircuitType uint8
+
+const (
+    L1   CircuitType = 1
+    L2               = 2
+    L1L2             = 3
+)
+
+// Flags of Link State PDUs. The IS type of the originator is stored in the low
+// two bits.
+type LSPFlags uint8
+
+const (
+    Partition   LSPFlags = 0x80
+    ATTError             = 0x40
+    ATTExpense           = 0x20
+    ATTDelay             = 0x10
+    ATTDefault           = 0x08
+    Overload             = 0x04
+    ISTypeL1             = 0x01
+    ISTypeL2             = 0x03
+)
+
+// SystemId identifies an intermediate system.
+type SystemId [6]byte
+
+// NodeId identifies an intermediate system or, if the last byte is not zero, a
+// pseudonode (i.e. a broadcast circuit).
+type NodeId [7]byte
+
+// LSPId identifies a Link State PDU. It's made of the node ID of the originator
+// followed by the LSP fragment number.
+type LSPId [8]byte
+
+// Intradomain routing protocol discriminator of IS-IS PDUs.
+const discriminator = 0x83
+
+// Make a new Level 1 LAN Hello PDU.
+func Make() *Packet {
+    return &Packet{
+        Type: L1LANHello,
+        Version: 1,
+        CircuitType: L1,
+        HoldingTime: 30,
+        Priority: 64,
+    }
+}
+
+func (p *Packet) GetType() packet.Type {
+    return packet.ISIS
+}
+
+func (p *Packet) GetLength() uint16 {
+    length := p.hdr_len()
+
+    for _, t := range p.TLVs {
+        length += 2 + len(t.Value)
+    }
+
+    return uint16(length)
+}
+
+func (p *Packet) Equals(other packet.Packet) bool {
+    return packet.Compare(p, other)
+}
+
+// Check whether the packet answers the given one: Link State PDUs answer the
+// Sequence Numbers PDUs that list (i.e. request) them, while Partial Sequence
+// Numbers PDUs answer (i.e. acknowledge) the Link State PDUs they list.
+func (p *Packet) Answers(other packet.Packet) bool {
+    if other == nil || other.GetType() != packet.ISIS {
+        return false
+    }
+
+    req := other.(*Packet)
+
+    switch {
+    case p.IsLSP() && req.IsSNP():
+        return p.Type.Level() == req.Type.Level() &&
+               req.FindLSPEntry(p.LSPId) != nil
+
+    case p.IsSNP() && !p.IsCSNP() && req.IsLSP():
+        e := p.FindLSPEntry(req.LSPId)
+
+        return p.Type.Level() == req.Type.Level() &&
+               e != nil && e.Seq == req.Seq
+    }
+
+    return false
+}
+
+func (p *Packet) Pack(buf *packet.Buffer) error {
+    hdr_len := p.hdr_len()
+    if hdr_len == 0 {
+        return fmt.Errorf("Invalid IS-IS PDU type %d", p.Type)
+    }
+
+    p.Length = p.GetLength()
+
+    buf.WriteN(uint8(discriminator))
+    buf.WriteN(uint8(hdr_len))
+    buf.WriteN(uint8(1))
+    buf.WriteN(uint8(0))
+    buf.WriteN(p.Type)
+    buf.WriteN(p.Version)
+    buf.WriteN(uint8(0))
+    buf.WriteN(p.MaxAreaAddrs)
+
+    switch p.Type {
+    case L1LANHello, L2LANHello, P2PHello:
+        buf.WriteN(p.CircuitType)
+        buf.Write(p.SourceId[:])
+        buf.WriteN(p.HoldingTime)
+        buf.WriteN(p.Length)
+
+        if p.Type == P2PHello {
+            buf.WriteN(p.LocalCircuitId)
+        } else {
+            buf.WriteN(p.Priority & 0x7f)
+            buf.Write(p.LANId[:])
+        }
+
+    case L1LSP, L2LSP:
+        buf.WriteN(p.Length)
+        buf.WriteN(p.Lifetime)
+        buf.Write(p.LSPId[:])
+        buf.WriteN(p.Seq)
+        buf.WriteN(uint16(0x00))
+        buf.WriteN(p.LSPFlags)
+
+    case L1CSNP, L2CSNP, L1PSNP, L2PSNP:
+        buf.WriteN(p.Length)
+        buf.Write(p.SourceId[:])
+        buf.WriteN(uint8(0))
+
+        if p.IsCSNP() {
+            buf.Write(p.StartLSPId[:])
+            buf.Write(p.EndLSPId[:])
+        }
+    }
+
+    for _, t := range p.TLVs {
+        if len(t.Value) > 255 {
+            return fmt.Errorf("Invalid TLV length %d", len(t.Value))
+        }
+
+        buf.WriteN(t.Type)
+        buf.WriteN(uint8(len(t.Value)))
+        buf.Write(t.Value)
+    }
+
+    if p.IsLSP() {
+        data := buf.LayerBytes()[:p.Length]
+
+        /* purged LSPs keep whatever checksum they were given */
+        if p.Lifetime != 0 {
+            p.Checksum = ospf.Fletcher(data[12:], 12)
+        }
+
+        buf.PutUint16N(24, p.Checksum)
+
+        p.csum_data = data
+    }
+
+    return nil
+}
+
+func (p *Packet) Unpack(buf *packet.Buffer) error {
+    data := buf.LayerBytes()
+
+    var disc, hdr_len, version_ext, id_len uint8
+
+    buf.ReadN(&disc)
+    buf.ReadN(&hdr_len)
+    buf.ReadN(&version_ext)
+    buf.ReadN(&id_len)
+
+    if disc != discriminator {
+        return fmt.Errorf("Invalid IS-IS discriminator 0x%x", disc)
+    }
+
+    if id_len != 0 && id_len != 6 {
+        return fmt.Errorf("Invalid IS-IS ID length %d", id_len)
+    }
+
+    buf.ReadN(&p.Type)
+    p.Type &= 0x1f
+
+    buf.ReadN(&p.Version)
+    buf.Next(1)
+    buf.ReadN(&p.MaxAreaAddrs)
+
+    if int(hdr_len) != p.hdr_len() || len(data) < int(hdr_len) {
+        return fmt.Errorf("Invalid IS-IS header length %d", hdr_len)
+    }
+
+    switch p.Type {
+    case L1LANHello, L2LANHello, P2PHello:
+        buf.ReadN(&p.CircuitType)
+        copy(p.SourceId[:], buf.Next(6))
+        buf.ReadN(&p.HoldingTime)
+        buf.ReadN(&p.Length)
+
+        if p.Type == P2PHello {
+            buf.ReadN(&p.LocalCircuitId)
+        } else {
+            buf.ReadN(&p.Priority)
+            p.Priority &= 0x7f
+
+            copy(p.LANId[:], buf.Next(7))
+        }
+
+    case L1LSP, L2LSP:
+        buf.ReadN(&p.Length)
+        buf.ReadN(&p.Lifetime)
+        copy(p.LSPId[:], buf.Next(8))
+        buf.ReadN(&p.Seq)
+        buf.ReadN(&p.Checksum)
+        buf.ReadN(&p.LSPFlags)
+
+    case L1CSNP, L2CSNP, L1PSNP, L2PSNP:
+        buf.ReadN(&p.Length)
+        copy(p.SourceId[:], buf.Next(6))
+        buf.Next(1)
+
+        if p.IsCSNP() {
+            copy(p.StartLSPId[:], buf.Next(8))
+            copy(p.EndLSPId[:], buf.Next(8))
+        }
+    }
+
+    if int(p.Length) < int(hdr_len) || int(p.Length) > len(data) {
+        return fmt.Errorf("Invalid IS-IS PDU length %d", p.Length)
+    }
+
+    if p.IsLSP() {
+        p.csum_data = data[:p.Length]
+    }
+
+    /* trailing data (e.g. Ethernet padding) is ignored */
+    tlvs, err := unpack_tlvs(buf.Next(int(p.Length) - int(hdr_len)))
+    if err != nil {
+        return err
+    }
+
+    p.TLVs = tlvs
+
+    return nil
+}
+
+func (p *Packet) Payload() packet.Packet {
+    return nil
+}
+
+func (p *Packet) GuessPayloadType() packet.Type {
+    return packet.None
+}
+
+func (p *Packet) SetPayload(pl packet.Packet) error {
+    return nil
+}
+
+func (p *Packet) InitChecksum(csum uint32) {
+}
+
+func (p *Packet) String() string {
+    return packet.Stringify(p)
+}
+
+// Return whether the checksum of an encoded or decoded Link State PDU is
+// valid. The checksum of purged LSPs (i.e. with a zero remaining lifetime) may
+// be zero, in which case it's not verified.
+func (p *Packet) ValidChecksum() bool {
+    if !p.IsLSP() || len(p.csum_data) < 27 {
+        return false
+    }
+
+    if p.Checksum == 0 {
+        return p.Lifetime == 0
+    }
+
+    var c0, c1 int
+
+    for _, b := range p.csum_data[12:] {
+        c0 = (c0 + int(b)) % 255
+        c1 = (c1 + c0) % 255
+    }
+
+    return c0 == 0 && c1 == 0
+}
+
+// Return whether the packet is a Hello PDU.
+func (p *Packet) IsHello() bool {
+    return p.Type == L1LANHello || p.Type == L2LANHello || p.Type == P2PHello
+}
+
+// Return whether the packet is a Link State PDU.
+func (p *Packet) IsLSP() bool {
+    return p.Type == L1LSP || p.Type == L2LSP
+}
+
+// Return whether the packet is a Complete Sequence Numbers PDU.
+func (p *Packet) IsCSNP() bool {
+    return p.Type == L1CSNP || p.Type == L2CSNP
+}
+
+// Return whether the packet is a (Complete or Partial) Sequence Numbers PDU.
+func (p *Packet) IsSNP() bool {
+    return p.IsCSNP() || p.Type == L1PSNP || p.Type == L2PSNP
+}
+
+func (p *Packet) hdr_len() int {
+    switch p.Type {
+    case L1LANHello, L2LANHello: return 27
+    case P2PHello:               return 20
+    case L1LSP, L2LSP:           return 27
+    case L1CSNP, L2CSNP:         return 33
+    case L1PSNP, L2PSNP:         return 17
+    default:                     return 0
+    }
+}
+
+// Return the level (1 or 2) of the PDU type, or 0 for point-to-point Hellos
+// which are used by both levels.
+func (t PDUType) Level() uint8 {
+    switch t {
+    case L1LANHello, L1LSP, L1CSNP, L1PSNP: return 1
+    case L2LANHello, L2LSP, L2CSNP, L2PSNP: return 2
+    default:                                return 0
+    }
+}
+
+func (t PDUType) String() string {
+    switch t {
+    case L1LANHello: return "L1-LAN-Hello"
+    case L2LANHello: return "L2-LAN-Hello"
+    case P2PHello:   return "P2P-Hello"
+    case L1LSP:      return "L1-LSP"
+    case L2LSP:      return "L2-LSP"
+    case L1CSNP:     return "L1-CSNP"
+    case L2CSNP:     return "L2-CSNP"
+    case L1PSNP:     return "L1-PSNP"
+    case L2PSNP:     return "L2-PSNP"
+    default:         return fmt.Sprintf("0x%x", uint8(t))
+    }
+}
+
+func (t CircuitType) String() string {
+    switch t {
+    case L1:   return "L1"
+    case L2:   return "L2"
+    case L1L2: return "L1L2"
+    default:   return ""
+    }
+}
+
+func (f LSPFlags) String() string {
+    var flags []string
+
+    if f & Partition != 0 {
+        flags = append(flags, "partition")
+    }
+
+    if f & (ATTError | ATTExpense | ATTDelay | ATTDefault) != 0 {
+        flags = append(flags, "attached")
+    }
+
+    if f & Overload != 0 {
+        flags = append(flags, "overload")
+    }
+
+    switch f & 0x3 {
+    case ISTypeL1: flags = append(flags, "L1")
+    case ISTypeL2: flags = append(flags, "L2")
+    }
+
+    return strings.Join(flags, "|")
+}
+
+func (id SystemId) String() string {
+    return fmt.Sprintf("%02x%02x.%02x%02x.%02x%02x",
+                       id[0], id[1], id[2], id[3], id[4], id[5])
+}
+
+func (id NodeId) String() string {
+    var sys SystemId
+    copy(sys[:], id[:6])
+
+    return fmt.Sprintf("%s.%02x", sys, id[6])
+}
+
+func (id LSPId) String() string {
+    var node NodeId
+    copy(node[:], id[:7])
+
+    return fmt.Sprintf("%s-%02x", node, id[7])
+}
@@ -0,0 +1,285 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package isis_test
+
+import "bytes"
+import "net"
+import "testing"
+
+import "github.com/ghedo/go.pkt/layers"
+import "github.com/ghedo/go.pkt/packet"
+import "github.com/ghedo/go.pkt/packet/eth"
+import "github.com/ghedo/go.pkt/packet/isis"
+import "github.com/ghedo/go.pkt/packet/llc"
+
+var test_simple = []byte{
+    0x83, 0x1b, 0x01, 0x00, 0x0f, 0x01, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00,
+    0x00, 0x00, 0x01, 0x00, 0x1e, 0x00, 0x2a, 0x40, 0x00, 0x00, 0x00, 0x00,
+    0x00, 0x01, 0x01, 0x81, 0x01, 0xcc, 0x01, 0x04, 0x03, 0x49, 0x00, 0x01,
+    0x84, 0x04, 0x0a, 0x00, 0x00, 0x01,
+}
+
+func MakeTestSimple() *isis.Packet {
+    return &isis.Packet{
+        Type: isis.L1LANHello,
+        Version: 1,
+        CircuitType: isis.L1,
+        SourceId: isis.SystemId{ 0x00, 0x00, 0x00, 0x00, 0x00, 0x01 },
+        HoldingTime: 30,
+        Priority: 64,
+        LANId: isis.NodeId{ 0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x01 },
+        TLVs: []isis.TLV{
+            { Type: isis.ProtocolsSupported, Value: []byte{ 0xcc } },
+            { Type: isis.AreaAddresses, Value: []byte{ 0x03, 0x49, 0x00, 0x01 } },
+            { Type: isis.IPInterfaceAddr, Value: []byte{ 0x0a, 0x00, 0x00, 0x01 } },
+        },
+    }
+}
+
+func TestPack(t *testing.T) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_simple)))
+
+    p := MakeTestSimple()
+
+    err := p.Pack(&b)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if !bytes.Equal(test_simple, b.Buffer()) {
+        t.Fatalf("Raw packet mismatch: %x", b.Buffer())
+    }
+}
+
+func BenchmarkPack(bn *testing.B) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_simple)))
+
+    p := MakeTestSimple()
+
+    for n := 0; n < bn.N; n++ {
+        p.Pack(&b)
+    }
+}
+
+func TestUnpack(t *testing.T) {
+    var p isis.Packet
+
+    cmp := MakeTestSimple()
+
+    var b packet.Buffer
+    b.Init(test_simple)
+
+    err := p.Unpack(&b)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if !p.Equals(cmp) {
+        t.Fatalf("Packet mismatch:\n%s\n%s", &p, cmp)
+    }
+
+    areas := p.AreaAddresses()
+    if len(areas) != 1 || !bytes.Equal(areas[0], []byte{ 0x49, 0x00, 0x01 }) {
+        t.Fatalf("Area addresses mismatch: %x", areas)
+    }
+}
+
+func BenchmarkUnpack(bn *testing.B) {
+    var p isis.Packet
+    var b packet.Buffer
+
+    for n := 0; n < bn.N; n++ {
+        b.Init(test_simple)
+        p.Unpack(&b)
+    }
+}
+
+var test_lsp_id = isis.LSPId{ 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0x00, 0x00 }
+
+func MakeTestLSP() *isis.Packet {
+    return &isis.Packet{
+        Type: isis.L2LSP,
+        Version: 1,
+        Lifetime: 1199,
+        LSPId: test_lsp_id,
+        Seq: 7,
+        LSPFlags: isis.ISTypeL2,
+        TLVs: []isis.TLV{
+            { Type: isis.AreaAddresses, Value: []byte{ 0x03, 0x49, 0x00, 0x01 } },
+            { Type: isis.Hostname, Value: []byte("r2") },
+            {
+                Type: isis.ExtISReach,
+                Value: []byte{
+                    0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x01,
+                    0x00, 0x00, 0x0a, 0x00,
+                },
+            },
+            {
+                Type: isis.ExtIPReach,
+                Value: []byte{
+                    0x00, 0x00, 0x00, 0x0a, 0x18, 0x0a, 0x00, 0x02,
+                },
+            },
+            {
+                Type: isis.IPv6Reach,
+                Value: []byte{
+                    0x00, 0x00, 0x00, 0x0a, 0x00, 0x40,
+                    0x20, 0x01, 0x0d, 0xb8, 0x00, 0x00, 0x00, 0x02,
+                },
+            },
+        },
+    }
+}
+
+func TestLSP(t *testing.T) {
+    lsp := MakeTestLSP()
+
+    eth_pkt := eth.Make()
+    eth_pkt.SrcAddr, _ = net.ParseMAC("00:00:00:00:00:02")
+    eth_pkt.DstAddr, _ = net.ParseMAC("01:80:c2:00:00:15")
+
+    llc_pkt := llc.Make()
+    llc_pkt.Control = 0x03
+
+    buf, err := layers.Pack(eth_pkt, llc_pkt, lsp)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if !lsp.ValidChecksum() {
+        t.Fatalf("Invalid checksum: 0x%x", lsp.Checksum)
+    }
+
+    p, err := layers.UnpackAll(buf, packet.Eth)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    l := layers.FindLayer(p, packet.ISIS)
+    if l == nil {
+        t.Fatalf("Not IS-IS: %s", p)
+    }
+
+    isis_pkt := l.(*isis.Packet)
+
+    if !isis_pkt.Equals(lsp) || isis_pkt.Checksum != lsp.Checksum {
+        t.Fatalf("Packet mismatch:\n%s\n%s", isis_pkt, lsp)
+    }
+
+    if !isis_pkt.ValidChecksum() {
+        t.Fatalf("Invalid checksum: 0x%x", isis_pkt.Checksum)
+    }
+
+    name, ok := isis_pkt.Hostname()
+    if !ok || name != "r2" {
+        t.Fatalf("Hostname mismatch: %s", name)
+    }
+
+    neighbors := isis_pkt.ISReachability()
+    if len(neighbors) != 1 || neighbors[0].Metric != 10 ||
+       neighbors[0].Id.String() != "0000.0000.0001.01" {
+        t.Fatalf("IS reachability mismatch: %v", neighbors)
+    }
+
+    prefixes := isis_pkt.IPReachability()
+    if len(prefixes) != 1 || prefixes[0].Metric != 10 ||
+       prefixes[0].Prefix.String() != "10.0.2.0/24" {
+        t.Fatalf("IP reachability mismatch: %v", prefixes)
+    }
+
+    prefixes = isis_pkt.IPv6Reachability()
+    if len(prefixes) != 1 || prefixes[0].Prefix.String() != "2001:db8:0:2::/64" {
+        t.Fatalf("IPv6 reachability mismatch: %v", prefixes)
+    }
+
+    if isis_pkt.LSPId.String() != "0000.0000.0002.00-00" {
+        t.Fatalf("LSP ID mismatch: %s", isis_pkt.LSPId)
+    }
+
+    buf[len(buf) - 1] ^= 0xff
+
+    p, _ = layers.UnpackAll(buf, packet.Eth)
+
+    if layers.FindLayer(p, packet.ISIS).(*isis.Packet).ValidChecksum() {
+        t.Fatalf("Checksum of corrupted LSP is valid")
+    }
+}
+
+func TestPSNP(t *testing.T) {
+    lsp := MakeTestLSP()
+
+    psnp := &isis.Packet{
+        Type: isis.L2PSNP,
+        Version: 1,
+        SourceId: isis.SystemId{ 0x00, 0x00, 0x00, 0x00, 0x00, 0x01 },
+        TLVs: []isis.TLV{
+            {
+                Type: isis.LSPEntries,
+                Value: []byte{
+                    0x04, 0xaf, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02,
+                    0x00, 0x00, 0x00, 0x00, 0x00, 0x07, 0x12, 0x34,
+                },
+            },
+        },
+    }
+
+    buf, err := layers.Pack(psnp)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if len(buf) != 35 || buf[1] != 17 {
+        t.Fatalf("Raw packet mismatch: %x", buf)
+    }
+
+    var p isis.Packet
+
+    _, err = layers.Unpack(buf, &p)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if !p.Equals(psnp) {
+        t.Fatalf("Packet mismatch:\n%s\n%s", &p, psnp)
+    }
+
+    if !p.Answers(lsp) {
+        t.Fatalf("PSNP doesn't acknowledge LSP")
+    }
+
+    lsp.Seq = 8
+
+    if p.Answers(lsp) {
+        t.Fatalf("PSNP acknowledges newer LSP")
+    }
+}
@@ -0,0 +1,510 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package isis
+
+import "bytes"
+import "fmt"
+import "net"
+
+import "github.com/ghedo/go.pkt/packet"
+
+// TLV is a variable length field of an IS-IS PDU. TLVs are stored undecoded so
+// that PDUs can be encoded back unchanged, use Decode() or the Parse*()
+// functions to get their typed representation.
+type TLV struct {
+    Type  TLVType
+    Value []byte
+}
+
+type TLVType uint8
+
+const (
+    AreaAddresses      TLVType = 1
+    ISReach                    = 2
+    ISNeighbors                = 6
+    Padding                    = 8
+    LSPEntries                 = 9
+    Authentication             = 10
+    ExtISReach                 = 22
+    IPIntReach                 = 128
+    ProtocolsSupported         = 129
+    IPExtReach                 = 130
+    IPInterfaceAddr            = 132
+    ExtIPReach                 = 135
+    Hostname                   = 137
+    IPv6InterfaceAddr          = 232
+    IPv6Reach                  = 236
+    P2PAdjacency               = 240
+)
+
+// ISNeighbor is an entry of an IS reachability TLV. For the old-style TLV (2)
+// the Metric field holds the default metric, while for the extended TLV (22) it
+// holds the 24-bit wide metric.
+type ISNeighbor struct {
+    Id      NodeId
+    Metric  uint32
+    SubTLVs []byte
+}
+
+// IPPrefix is an entry of an extended IP reachability TLV (135) or of an IPv6
+// reachability TLV (236). External is only used by the latter.
+type IPPrefix struct {
+    Prefix   net.IPNet
+    Metric   uint32
+    Down     bool
+    External bool
+    SubTLVs  []byte
+}
+
+// LSPEntry is an entry of a LSP entries TLV, as carried by Sequence Numbers
+// PDUs.
+type LSPEntry struct {
+    Lifetime uint16
+    LSPId    LSPId
+    Seq      uint32
+    Checksum uint16
+}
+
+// Decode the TLV into its typed representation. The returned value is a
+// [][]byte for area address TLVs, a []ISNeighbor for IS reachability TLVs, a
+// []net.HardwareAddr for IS neighbors TLVs, a []LSPEntry for LSP entries TLVs,
+// a []IPPrefix for extended IP and IPv6 reachability TLVs, a []net.IP for
+// interface address TLVs and a string for hostname TLVs. Other TLVs are
+// returned as is.
+func (t TLV) Decode() (interface{}, error) {
+    switch t.Type {
+    case AreaAddresses:
+        return ParseAreaAddresses(t.Value)
+
+    case ISReach:
+        return ParseISReach(t.Value)
+
+    case ExtISReach:
+        return ParseExtISReach(t.Value)
+
+    case ISNeighbors:
+        return ParseISNeighbors(t.Value)
+
+    case LSPEntries:
+        return ParseLSPEntries(t.Value)
+
+    case ExtIPReach:
+        return ParseExtIPReach(t.Value)
+
+    case IPv6Reach:
+        return ParseIPv6Reach(t.Value)
+
+    case IPInterfaceAddr:
+        return ParseAddresses(t.Value, 4)
+
+    case IPv6InterfaceAddr:
+        return ParseAddresses(t.Value, 16)
+
+    case Hostname:
+        return string(t.Value), nil
+    }
+
+    return t, nil
+}
+
+// Parse the body of an area addresses TLV.
+func ParseAreaAddresses(data []byte) ([][]byte, error) {
+    var areas [][]byte
+
+    for len(data) > 0 {
+        n := int(data[0])
+
+        if len(data) < 1 + n {
+            return nil, fmt.Errorf("Invalid area addresses TLV")
+        }
+
+        areas = append(areas, data[1:1 + n])
+        data  = data[1 + n:]
+    }
+
+    return areas, nil
+}
+
+// Parse the body of an old-style IS reachability TLV.
+func ParseISReach(data []byte) ([]ISNeighbor, error) {
+    if len(data) < 1 || (len(data) - 1) % 11 != 0 {
+        return nil, fmt.Errorf("Invalid IS reachability TLV")
+    }
+
+    var neighbors []ISNeighbor
+
+    /* skip the virtual flag */
+    for data = data[1:]; len(data) > 0; data = data[11:] {
+        var n ISNeighbor
+
+        n.Metric = uint32(data[0] & 0x3f)
+        copy(n.Id[:], data[4:11])
+
+        neighbors = append(neighbors, n)
+    }
+
+    return neighbors, nil
+}
+
+// Parse the body of an extended IS reachability TLV.
+func ParseExtISReach(data []byte) ([]ISNeighbor, error) {
+    var neighbors []ISNeighbor
+
+    for len(data) > 0 {
+        var n ISNeighbor
+
+        if len(data) < 11 || len(data) < 11 + int(data[10]) {
+            return nil, fmt.Errorf("Invalid extended IS reachability TLV")
+        }
+
+        copy(n.Id[:], data[:7])
+        n.Metric = uint32(data[7]) << 16 | uint32(data[8]) << 8 |
+                   uint32(data[9])
+
+        sub_len := int(data[10])
+
+        if sub_len > 0 {
+            n.SubTLVs = data[11:11 + sub_len]
+        }
+
+        neighbors = append(neighbors, n)
+        data      = data[11 + sub_len:]
+    }
+
+    return neighbors, nil
+}
+
+// Parse the body of an IS neighbors TLV, as carried by LAN Hello PDUs.
+func ParseISNeighbors(data []byte) ([]net.HardwareAddr, error) {
+    if len(data) % 6 != 0 {
+        return nil, fmt.Errorf("Invalid IS neighbors TLV")
+    }
+
+    var addrs []net.HardwareAddr
+
+    for ; len(data) > 0; data = data[6:] {
+        addrs = append(addrs, net.HardwareAddr(data[:6]))
+    }
+
+    return addrs, nil
+}
+
+// Parse the body of a LSP entries TLV.
+func ParseLSPEntries(data []byte) ([]LSPEntry, error) {
+    if len(data) % 16 != 0 {
+        return nil, fmt.Errorf("Invalid LSP entries TLV")
+    }
+
+    var b packet.Buffer
+    b.Init(data)
+
+    var entries []LSPEntry
+
+    for b.Len() > 0 {
+        var e LSPEntry
+
+        b.ReadN(&e.Lifetime)
+        copy(e.LSPId[:], b.Next(8))
+        b.ReadN(&e.Seq)
+        b.ReadN(&e.Checksum)
+
+        entries = append(entries, e)
+    }
+
+    return entries, nil
+}
+
+// Parse the body of an extended IP reachability TLV.
+func ParseExtIPReach(data []byte) ([]IPPrefix, error) {
+    var prefixes []IPPrefix
+
+    for len(data) > 0 {
+        var p IPPrefix
+
+        if len(data) < 5 {
+            return nil, fmt.Errorf("Invalid extended IP reachability TLV")
+        }
+
+        p.Metric = uint32(data[0]) << 24 | uint32(data[1]) << 16 |
+                   uint32(data[2]) << 8 | uint32(data[3])
+        p.Down   = data[4] & 0x80 != 0
+
+        rest, err := unpack_prefix(&p, data[5:], int(data[4] & 0x3f),
+                                   data[4] & 0x40 != 0, 4)
+        if err != nil {
+            return nil, err
+        }
+
+        prefixes = append(prefixes, p)
+        data     = rest
+    }
+
+    return prefixes, nil
+}
+
+// Parse the body of an IPv6 reachability TLV.
+func ParseIPv6Reach(data []byte) ([]IPPrefix, error) {
+    var prefixes []IPPrefix
+
+    for len(data) > 0 {
+        var p IPPrefix
+
+        if len(data) < 6 {
+            return nil, fmt.Errorf("Invalid IPv6 reachability TLV")
+        }
+
+        p.Metric   = uint32(data[0]) << 24 | uint32(data[1]) << 16 |
+                     uint32(data[2]) << 8 | uint32(data[3])
+        p.Down     = data[4] & 0x80 != 0
+        p.External = data[4] & 0x40 != 0
+
+        rest, err := unpack_prefix(&p, data[6:], int(data[5]),
+                                   data[4] & 0x20 != 0, 16)
+        if err != nil {
+            return nil, err
+        }
+
+        prefixes = append(prefixes, p)
+        data     = rest
+    }
+
+    return prefixes, nil
+}
+
+func unpack_prefix(p *IPPrefix, data []byte, bits int, sub bool,
+                   addr_len int) ([]byte, error) {
+    n := (bits + 7) / 8
+
+    if bits > addr_len * 8 || len(data) < n {
+        return nil, fmt.Errorf("Invalid IS-IS prefix length %d", bits)
+    }
+
+    addr := make(net.IP, addr_len)
+    copy(addr, data[:n])
+
+    p.Prefix = net.IPNet{
+        IP: addr,
+        Mask: net.CIDRMask(bits, addr_len * 8),
+    }
+
+    data = data[n:]
+
+    if sub {
+        if len(data) < 1 || len(data) < 1 + int(data[0]) {
+            return nil, fmt.Errorf("Invalid IS-IS prefix sub-TLVs")
+        }
+
+        p.SubTLVs = data[1:1 + int(data[0])]
+        data      = data[1 + int(data[0]):]
+    }
+
+    return data, nil
+}
+
+// Parse the body of an IPv4 (addr_len 4) or IPv6 (addr_len 16) interface
+// addresses TLV.
+func ParseAddresses(data []byte, addr_len int) ([]net.IP, error) {
+    if len(data) % addr_len != 0 {
+        return nil, fmt.Errorf("Invalid interface addresses TLV")
+    }
+
+    var addrs []net.IP
+
+    for ; len(data) > 0; data = data[addr_len:] {
+        addrs = append(addrs, net.IP(data[:addr_len]))
+    }
+
+    return addrs, nil
+}
+
+func unpack_tlvs(data []byte) ([]TLV, error) {
+    var tlvs []TLV
+
+    for len(data) > 0 {
+        if len(data) < 2 || len(data) < 2 + int(data[1]) {
+            return nil, fmt.Errorf("Invalid IS-IS TLV")
+        }
+
+        tlvs = append(tlvs, TLV{
+            Type: TLVType(data[0]),
+            Value: data[2:2 + int(data[1])],
+        })
+
+        data = data[2 + int(data[1]):]
+    }
+
+    return tlvs, nil
+}
+
+// Return the first TLV of the given type, or nil.
+func (p *Packet) FindTLV(t TLVType) *TLV {
+    for i := range p.TLVs {
+        if p.TLVs[i].Type == t {
+            return &p.TLVs[i]
+        }
+    }
+
+    return nil
+}
+
+// Return the area addresses listed in the PDU.
+func (p *Packet) AreaAddresses() [][]byte {
+    var areas [][]byte
+
+    for _, t := range p.TLVs {
+        if t.Type != AreaAddresses {
+            continue
+        }
+
+        a, err := ParseAreaAddresses(t.Value)
+        if err == nil {
+            areas = append(areas, a...)
+        }
+    }
+
+    return areas
+}
+
+// Return the dynamic hostname advertised in the PDU, if any.
+func (p *Packet) Hostname() (string, bool) {
+    t := p.FindTLV(Hostname)
+    if t == nil {
+        return "", false
+    }
+
+    return string(t.Value), true
+}
+
+// Return the neighbors listed in the old-style and extended IS reachability
+// TLVs of the PDU.
+func (p *Packet) ISReachability() []ISNeighbor {
+    var neighbors []ISNeighbor
+
+    for _, t := range p.TLVs {
+        var n []ISNeighbor
+        var err error
+
+        switch t.Type {
+        case ISReach:    n, err = ParseISReach(t.Value)
+        case ExtISReach: n, err = ParseExtISReach(t.Value)
+        default:         continue
+        }
+
+        if err == nil {
+            neighbors = append(neighbors, n...)
+        }
+    }
+
+    return neighbors
+}
+
+// Return the prefixes listed in the extended IP reachability TLVs of the PDU.
+func (p *Packet) IPReachability() []IPPrefix {
+    return p.prefixes(ExtIPReach, ParseExtIPReach)
+}
+
+// Return the prefixes listed in the IPv6 reachability TLVs of the PDU.
+func (p *Packet) IPv6Reachability() []IPPrefix {
+    return p.prefixes(IPv6Reach, ParseIPv6Reach)
+}
+
+func (p *Packet) prefixes(tlv_type TLVType,
+                          parse func([]byte) ([]IPPrefix, error)) []IPPrefix {
+    var prefixes []IPPrefix
+
+    for _, t := range p.TLVs {
+        if t.Type != tlv_type {
+            continue
+        }
+
+        pfx, err := parse(t.Value)
+        if err == nil {
+            prefixes = append(prefixes, pfx...)
+        }
+    }
+
+    return prefixes
+}
+
+// Return the LSP entries listed in the PDU.
+func (p *Packet) LSPEntries() []LSPEntry {
+    var entries []LSPEntry
+
+    for _, t := range p.TLVs {
+        if t.Type != LSPEntries {
+            continue
+        }
+
+        e, err := ParseLSPEntries(t.Value)
+        if err == nil {
+            entries = append(entries, e...)
+        }
+    }
+
+    return entries
+}
+
+// Return the LSP entry with the given LSP ID, or nil.
+func (p *Packet) FindLSPEntry(id LSPId) *LSPEntry {
+    for _, e := range p.LSPEntries() {
+        if e.LSPId == id {
+            return &e
+        }
+    }
+
+    return nil
+}
+
+func (t TLV) Equal(other TLV) bool {
+    return t.Type == other.Type && bytes.Equal(t.Value, other.Value)
+}
+
+func (t TLVType) String() string {
+    switch t {
+    case AreaAddresses:      return "area-addresses"
+    case ISReach:            return "is-reach"
+    case ISNeighbors:        return "is-neighbors"
+    case Padding:            return "padding"
+    case LSPEntries:         return "lsp-entries"
+    case Authentication:     return "authentication"
+    case ExtISReach:         return "ext-is-reach"
+    case IPIntReach:         return "ip-int-reach"
+    case ProtocolsSupported: return "protocols-supported"
+    case IPExtReach:         return "ip-ext-reach"
+    case IPInterfaceAddr:    return "ip-interface-addr"
+    case ExtIPReach:         return "ext-ip-reach"
+    case Hostname:           return "hostname"
+    case IPv6InterfaceAddr:  return "ipv6-interface-addr"
+    case IPv6Reach:          return "ipv6-reach"
+    case P2PAdjacency:       return "p2p-adjacency"
+    default:                 return fmt.Sprintf("0x%x", uint8(t))
+    }
+}
@@ -0,0 +1,619 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+// Provides encoding and decoding for L2TPv2 (RFC 2661) and L2TPv3 (RFC 3931)
+// packets, both over UDP and, for L2TPv3, directly over IP.
+package l2tp
+
+import "bytes"
+import "encoding/binary"
+import "fmt"
+import "strings"
+
+import "github.com/ghedo/go.pkt/packet"
+import "github.com/ghedo/go.pkt/packet/eth"
+
+type Packet struct {
+    OverIP      bool          `string:"skip"`
+    Flags       Flags
+    Version     uint8         `string:"ver"`
+    Length      uint16        `string:"len"`
+    TunnelId    uint32        `string:"tunnel"`
+    SessionId   uint32        `string:"session"`
+    Ns          uint16        `string:"ns"`
+    Nr          uint16        `string:"nr"`
+    Offset      uint16        `string:"off"`
+    Cookie      []byte        `string:"skip"`
+    HasSublayer bool          `string:"skip"`
+    Sublayer    uint32        `string:"l2sub"`
+    AVPs        []AVP         `string:"skip"`
+    pl_type     packet.Type   `cmp:"skip" string:"skip"`
+    pkt_payload packet.Packet `cmp:"skip" string:"skip"`
+}
+
+type Flags uint16
+
+const (
+    Control  Flags = 0x8000
+    Length         = 0x4000
+    Sequence       = 0x0800
+    Offset         = 0x0200
+    Priority       = 0x0100
+)
+
+// AVP is an attribute-value pair carried by control messages.
+type AVP struct {
+    Mandatory bool
+    Hidden    bool
+    Vendor    uint16
+    Type      uint16
+    Value     []byte
+}
+
+type MessageType uint16
+
+const (
+    SCCRQ   MessageType = 1
+    SCCRP               = 2
+    SCCCN               = 3
+    StopCCN             = 4
+    Hello               = 6
+    OCRQ                = 7
+    OCRP                = 8
+    OCCN                = 9
+    ICRQ                = 10
+    ICRP                = 11
+    ICCN                = 12
+    CDN                 = 14
+    WEN                 = 15
+    SLI                 = 16
+)
+
+// AVP types.
+const (
+    AVPMessageType     uint16 = 0
+    AVPResultCode             = 1
+    AVPProtocolVersion        = 2
+    AVPFramingCaps            = 3
+    AVPBearerCaps             = 4
+    AVPFirmwareRev            = 6
+    AVPHostName               = 7
+    AVPVendorName             = 8
+    AVPTunnelId               = 9
+    AVPWindowSize             = 10
+    AVPChallenge              = 11
+    AVPChallengeResp          = 13
+    AVPSessionId              = 14
+    AVPCallSerial             = 15
+    AVPRouterId               = 60
+    AVPConnectionId           = 61
+    AVPPseudowireCaps         = 62
+    AVPLocalSessionId         = 63
+    AVPRemoteSessionId        = 64
+    AVPAssignedCookie         = 65
+    AVPPseudowireType         = 68
+)
+
+func Make() *Packet {
+    return &Packet{
+        Version: 2,
+    }
+}
+
+func (p *Packet) GetType() packet.Type {
+    if p.OverIP {
+        return packet.L2TPIP
+    }
+
+    return packet.L2TP
+}
+
+func (p *Packet) GetLength() uint16 {
+    length := p.header_len()
+
+    for _, a := range p.AVPs {
+        length += 6 + len(a.Value)
+    }
+
+    if p.pkt_payload != nil {
+        return uint16(length) + p.pkt_payload.GetLength()
+    }
+
+    return uint16(length)
+}
+
+func (p *Packet) header_len() int {
+    length := 0
+
+    if p.OverIP {
+        length += 4
+
+        if p.Flags & Control == 0 {
+            return length + p.data_len()
+        }
+    }
+
+    if p.Version == 3 {
+        if p.Flags & Control != 0 {
+            return length + 12
+        }
+
+        return length + 8 + p.data_len()
+    }
+
+    length += 6
+
+    if p.Flags & Length != 0 {
+        length += 2
+    }
+
+    if p.Flags & Sequence != 0 {
+        length += 4
+    }
+
+    if p.Flags & Offset != 0 {
+        length += 2 + int(p.Offset)
+    }
+
+    return length
+}
+
+// Return the length of the cookie and L2-specific sublayer of L2TPv3 data
+// messages.
+func (p *Packet) data_len() int {
+    length := len(p.Cookie)
+
+    if p.HasSublayer {
+        length += 4
+    }
+
+    return length
+}
+
+func (p *Packet) Equals(other packet.Packet) bool {
+    return packet.Compare(p, other)
+}
+
+func (p *Packet) Answers(other packet.Packet) bool {
+    if other == nil || other.GetType() != p.GetType() {
+        return false
+    }
+
+    o := other.(*Packet)
+
+    if p.Flags & Control == 0 {
+        if p.Payload() != nil {
+            return p.Payload().Answers(other.Payload())
+        }
+
+        return false
+    }
+
+    if o.Flags & Control == 0 {
+        return false
+    }
+
+    /* replies acknowledge the request's sequence number */
+    if p.Nr != o.Ns + 1 {
+        return false
+    }
+
+    switch p.MessageType() {
+    case SCCRP:
+        return o.MessageType() == SCCRQ
+
+    case SCCCN:
+        return o.MessageType() == SCCRP
+
+    case ICRP:
+        return o.MessageType() == ICRQ
+
+    case ICCN:
+        return o.MessageType() == ICRP
+
+    case OCRP:
+        return o.MessageType() == OCRQ
+
+    case OCCN:
+        return o.MessageType() == OCRP
+
+    default:
+        /* ZLB acknowledgements */
+        return len(p.AVPs) == 0
+    }
+}
+
+func (p *Packet) Pack(buf *packet.Buffer) error {
+    if p.Flags & Length != 0 {
+        p.Length = p.GetLength()
+
+        if p.OverIP {
+            p.Length -= 4
+        }
+    }
+
+    if p.OverIP {
+        if p.Flags & Control != 0 {
+            buf.WriteN(uint32(0))
+        } else {
+            buf.WriteN(p.SessionId)
+            p.pack_data(buf)
+            return nil
+        }
+    }
+
+    buf.WriteN(uint16(p.Flags) | uint16(p.Version & 0x0f))
+
+    if p.Version == 3 {
+        if p.Flags & Control == 0 {
+            buf.WriteN(uint16(0))
+            buf.WriteN(p.SessionId)
+            p.pack_data(buf)
+            return nil
+        }
+
+        buf.WriteN(p.Length)
+        buf.WriteN(p.TunnelId)
+        buf.WriteN(p.Ns)
+        buf.WriteN(p.Nr)
+        p.pack_avps(buf)
+        return nil
+    }
+
+    if p.Flags & Length != 0 {
+        buf.WriteN(p.Length)
+    }
+
+    buf.WriteN(uint16(p.TunnelId))
+    buf.WriteN(uint16(p.SessionId))
+
+    if p.Flags & Sequence != 0 {
+        buf.WriteN(p.Ns)
+        buf.WriteN(p.Nr)
+    }
+
+    if p.Flags & Offset != 0 {
+        buf.WriteN(p.Offset)
+        buf.Write(make([]byte, p.Offset))
+    }
+
+    p.pack_avps(buf)
+
+    return nil
+}
+
+func (p *Packet) pack_data(buf *packet.Buffer) {
+    buf.Write(p.Cookie)
+
+    if p.HasSublayer {
+        buf.WriteN(p.Sublayer)
+    }
+}
+
+func (p *Packet) pack_avps(buf *packet.Buffer) {
+    for _, a := range p.AVPs {
+        hdr := uint16(6 + len(a.Value)) & 0x03ff
+
+        if a.Mandatory {
+            hdr |= 0x8000
+        }
+
+        if a.Hidden {
+            hdr |= 0x4000
+        }
+
+        buf.WriteN(hdr)
+        buf.WriteN(a.Vendor)
+        buf.WriteN(a.Type)
+        buf.Write(a.Value)
+    }
+}
+
+func (p *Packet) Unpack(buf *packet.Buffer) error {
+    *p = Packet{ OverIP: p.OverIP }
+
+    if p.OverIP {
+        if buf.Len() < 4 {
+            return fmt.Errorf("Invalid L2TP header length %d", buf.Len())
+        }
+
+        buf.ReadN(&p.SessionId)
+
+        if p.SessionId != 0 {
+            p.Version = 3
+            p.unpack_data(buf)
+            return nil
+        }
+    }
+
+    if buf.Len() < 2 {
+        return fmt.Errorf("Invalid L2TP header length %d", buf.Len())
+    }
+
+    var flags uint16
+    buf.ReadN(&flags)
+
+    p.Flags   = Flags(flags & 0xfff0)
+    p.Version = uint8(flags & 0x0f)
+
+    switch p.Version {
+    case 2:
+        if buf.Len() < p.header_len() - buf.LayerLen() {
+            return fmt.Errorf("Invalid L2TP header length %d", buf.Len())
+        }
+
+        if p.Flags & Length != 0 {
+            buf.ReadN(&p.Length)
+        }
+
+        var tunnel_id, session_id uint16
+        buf.ReadN(&tunnel_id)
+        buf.ReadN(&session_id)
+
+        p.TunnelId  = uint32(tunnel_id)
+        p.SessionId = uint32(session_id)
+
+        if p.Flags & Sequence != 0 {
+            buf.ReadN(&p.Ns)
+            buf.ReadN(&p.Nr)
+        }
+
+        if p.Flags & Offset != 0 {
+            buf.ReadN(&p.Offset)
+
+            if buf.Len() < int(p.Offset) {
+                return fmt.Errorf("Invalid L2TP offset %d", p.Offset)
+            }
+
+            buf.Next(int(p.Offset))
+        }
+
+        err := p.truncate(buf)
+        if err != nil {
+            return err
+        }
+
+        if p.Flags & Control == 0 {
+            p.pl_type = packet.PPP
+            return nil
+        }
+
+    case 3:
+        if buf.Len() < p.header_len() - buf.LayerLen() {
+            return fmt.Errorf("Invalid L2TP header length %d", buf.Len())
+        }
+
+        if p.Flags & Control == 0 {
+            buf.Next(2)
+            buf.ReadN(&p.SessionId)
+            p.unpack_data(buf)
+            return nil
+        }
+
+        buf.ReadN(&p.Length)
+        buf.ReadN(&p.TunnelId)
+        buf.ReadN(&p.Ns)
+        buf.ReadN(&p.Nr)
+
+        err := p.truncate(buf)
+        if err != nil {
+            return err
+        }
+
+    default:
+        return fmt.Errorf("Unsupported L2TP version %d", p.Version)
+    }
+
+    for buf.Len() >= 6 {
+        var a AVP
+        var hdr uint16
+
+        buf.ReadN(&hdr)
+        buf.ReadN(&a.Vendor)
+        buf.ReadN(&a.Type)
+
+        length := int(hdr & 0x03ff)
+        if length < 6 || length - 6 > buf.Len() {
+            return fmt.Errorf("Invalid L2TP AVP length %d", length)
+        }
+
+        a.Mandatory = hdr & 0x8000 != 0
+        a.Hidden    = hdr & 0x4000 != 0
+        a.Value     = buf.Next(length - 6)
+
+        p.AVPs = append(p.AVPs, a)
+    }
+
+    return nil
+}
+
+// Strip any trailing data not covered by the length field.
+func (p *Packet) truncate(buf *packet.Buffer) error {
+    if p.Flags & Length == 0 {
+        return nil
+    }
+
+    /* the length excludes the session ID of L2TPv3 over IP */
+    length := int(p.Length) - buf.LayerLen()
+    if p.OverIP {
+        length += 4
+    }
+
+    if length < 0 || length > buf.Len() {
+        return fmt.Errorf("Invalid L2TP length %d", p.Length)
+    }
+
+    buf.Truncate(length)
+
+    return nil
+}
+
+// Decode the cookie and L2-specific sublayer of L2TPv3 data messages. Since
+// these are negotiated by the control connection, their presence is guessed by
+// looking for a valid Ethernet frame after them.
+func (p *Packet) unpack_data(buf *packet.Buffer) {
+    data := buf.Bytes()
+
+    p.pl_type = packet.Raw
+
+    for _, cookie_len := range []int{ 0, 4, 8 } {
+        for _, sublayer := range []bool{ false, true } {
+            off := cookie_len
+
+            /* the default sublayer only has the sequence bit set */
+            if sublayer {
+                if len(data) < off + 4 || data[off] & 0xbf != 0 {
+                    continue
+                }
+
+                off += 4
+            }
+
+            if len(data) < off + 14 {
+                continue
+            }
+
+            ethertype := binary.BigEndian.Uint16(data[off + 12:])
+            pl_type   := eth.EtherTypeToType(eth.EtherType(ethertype))
+
+            if pl_type == packet.Raw || pl_type == packet.None {
+                continue
+            }
+
+            p.Cookie      = buf.Next(cookie_len)
+            p.HasSublayer = sublayer
+
+            if sublayer {
+                buf.ReadN(&p.Sublayer)
+            }
+
+            p.pl_type = packet.Eth
+            return
+        }
+    }
+}
+
+func (p *Packet) Payload() packet.Packet {
+    return p.pkt_payload
+}
+
+func (p *Packet) GuessPayloadType() packet.Type {
+    return p.pl_type
+}
+
+func (p *Packet) SetPayload(pl packet.Packet) error {
+    p.pkt_payload = pl
+    p.pl_type     = pl.GetType()
+
+    return nil
+}
+
+func (p *Packet) InitChecksum(csum uint32) {
+}
+
+func (p *Packet) String() string {
+    return packet.Stringify(p)
+}
+
+// Return the message type of a control message, or 0 for ZLB acknowledgements
+// and data messages.
+func (p *Packet) MessageType() MessageType {
+    a := p.FindAVP(0, AVPMessageType)
+    if a == nil || len(a.Value) < 2 {
+        return 0
+    }
+
+    return MessageType(binary.BigEndian.Uint16(a.Value))
+}
+
+// Return the first AVP with the given vendor and type, or nil.
+func (p *Packet) FindAVP(vendor uint16, avp_type uint16) *AVP {
+    for i := range p.AVPs {
+        if p.AVPs[i].Vendor == vendor && p.AVPs[i].Type == avp_type {
+            return &p.AVPs[i]
+        }
+    }
+
+    return nil
+}
+
+func (a AVP) Equal(other AVP) bool {
+    return a.Mandatory == other.Mandatory && a.Hidden == other.Hidden &&
+           a.Vendor == other.Vendor && a.Type == other.Type &&
+           bytes.Equal(a.Value, other.Value)
+}
+
+func (f Flags) String() string {
+    var flags []string
+
+    if f & Control != 0 {
+        flags = append(flags, "control")
+    } else {
+        flags = append(flags, "data")
+    }
+
+    if f & Length != 0 {
+        flags = append(flags, "len")
+    }
+
+    if f & Sequence != 0 {
+        flags = append(flags, "seq")
+    }
+
+    if f & Offset != 0 {
+        flags = append(flags, "off")
+    }
+
+    if f & Priority != 0 {
+        flags = append(flags, "prio")
+    }
+
+    return strings.Join(flags, "|")
+}
+
+func (m MessageType) String() string {
+    switch m {
+    case SCCRQ:   return "SCCRQ"
+    case SCCRP:   return "SCCRP"
+    case SCCCN:   return "SCCCN"
+    case StopCCN: return "StopCCN"
+    case Hello:   return "HELLO"
+    case OCRQ:    return "OCRQ"
+    case OCRP:    return "OCRP"
+    case OCCN:    return "OCCN"
+    case ICRQ:    return "ICRQ"
+    case ICRP:    return "ICRP"
+    case ICCN:    return "ICCN"
+    case CDN:     return "CDN"
+    case WEN:     return "WEN"
+    case SLI:     return "SLI"
+    default:      return "ZLB"
+    }
+}
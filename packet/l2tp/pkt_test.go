@@ -0,0 +1,319 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package l2tp_test
+
+import "bytes"
+import "net"
+import "testing"
+
+import "github.com/ghedo/go.pkt/layers"
+import "github.com/ghedo/go.pkt/packet"
+import "github.com/ghedo/go.pkt/packet/eth"
+import "github.com/ghedo/go.pkt/packet/icmpv4"
+import "github.com/ghedo/go.pkt/packet/ipv4"
+import "github.com/ghedo/go.pkt/packet/l2tp"
+import "github.com/ghedo/go.pkt/packet/ppp"
+import "github.com/ghedo/go.pkt/packet/udp"
+
+var test_simple = []byte{
+    0xc8, 0x02, 0x00, 0x25, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+    0x80, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x80, 0x08, 0x00, 0x00,
+    0x00, 0x02, 0x01, 0x00, 0x80, 0x09, 0x00, 0x00, 0x00, 0x07, 0x6c, 0x61,
+    0x63,
+}
+
+func MakeTestSimple() *l2tp.Packet {
+    return &l2tp.Packet{
+        Flags: l2tp.Control | l2tp.Length | l2tp.Sequence,
+        Version: 2,
+        Length: 37,
+        AVPs: []l2tp.AVP{
+            {
+                Mandatory: true,
+                Type: l2tp.AVPMessageType,
+                Value: []byte{ 0x00, 0x01 },
+            },
+            {
+                Mandatory: true,
+                Type: l2tp.AVPProtocolVersion,
+                Value: []byte{ 0x01, 0x00 },
+            },
+            {
+                Mandatory: true,
+                Type: l2tp.AVPHostName,
+                Value: []byte("lac"),
+            },
+        },
+    }
+}
+
+func TestPack(t *testing.T) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_simple)))
+
+    p := MakeTestSimple()
+
+    err := p.Pack(&b)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if !bytes.Equal(test_simple, b.Buffer()) {
+        t.Fatalf("Raw packet mismatch: %x", b.Buffer())
+    }
+}
+
+func BenchmarkPack(bn *testing.B) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_simple)))
+
+    p := MakeTestSimple()
+
+    for n := 0; n < bn.N; n++ {
+        p.Pack(&b)
+    }
+}
+
+func TestUnpack(t *testing.T) {
+    var p l2tp.Packet
+
+    cmp := MakeTestSimple()
+
+    var b packet.Buffer
+    b.Init(test_simple)
+
+    err := p.Unpack(&b)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if !p.Equals(cmp) {
+        t.Fatalf("Packet mismatch:\n%s\n%s", &p, cmp)
+    }
+
+    if p.MessageType() != l2tp.SCCRQ {
+        t.Fatalf("Message type mismatch: %s", p.MessageType())
+    }
+}
+
+func BenchmarkUnpack(bn *testing.B) {
+    var p l2tp.Packet
+    var b packet.Buffer
+
+    for n := 0; n < bn.N; n++ {
+        b.Init(test_simple)
+        p.Unpack(&b)
+    }
+}
+
+func TestAnswers(t *testing.T) {
+    req := MakeTestSimple()
+
+    rep := MakeTestSimple()
+    rep.Ns = 1
+    rep.Nr = 1
+    rep.AVPs[0].Value = []byte{ 0x00, byte(l2tp.SCCRP) }
+
+    if !rep.Answers(req) {
+        t.Fatalf("SCCRP doesn't answer SCCRQ")
+    }
+
+    zlb := &l2tp.Packet{ Flags: l2tp.Control | l2tp.Length | l2tp.Sequence,
+                         Version: 2, Nr: 1 }
+
+    if !zlb.Answers(req) || zlb.Answers(rep) {
+        t.Fatalf("ZLB answer mismatch")
+    }
+}
+
+func make_ipv4(proto ipv4.Protocol) *ipv4.Packet {
+    ip4_pkt := ipv4.Make()
+    ip4_pkt.SrcAddr = net.ParseIP("10.0.0.1")
+    ip4_pkt.DstAddr = net.ParseIP("10.0.0.2")
+
+    return ip4_pkt
+}
+
+func make_inner() (*ipv4.Packet, *icmpv4.Packet) {
+    ip4_pkt := ipv4.Make()
+    ip4_pkt.SrcAddr = net.ParseIP("192.168.1.2")
+    ip4_pkt.DstAddr = net.ParseIP("192.168.1.1")
+
+    icmp_pkt := icmpv4.Make()
+    icmp_pkt.Id = 0x1234
+
+    return ip4_pkt, icmp_pkt
+}
+
+func unpack(t *testing.T, pkts ...packet.Packet) packet.Packet {
+    buf, err := layers.Pack(pkts...)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    pkt, err := layers.UnpackAll(buf, packet.IPv4)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    icmp_pkt := layers.FindLayer(pkt, packet.ICMPv4)
+    if icmp_pkt == nil || !icmp_pkt.Equals(pkts[len(pkts) - 1]) {
+        t.Fatalf("Inner packet mismatch: %s", pkt)
+    }
+
+    return pkt
+}
+
+func TestDataV2(t *testing.T) {
+    udp_pkt := udp.Make()
+    udp_pkt.SrcPort = udp.L2TP
+    udp_pkt.DstPort = udp.L2TP
+
+    l2tp_pkt := l2tp.Make()
+    l2tp_pkt.Flags     = l2tp.Length
+    l2tp_pkt.TunnelId  = 1
+    l2tp_pkt.SessionId = 2
+
+    ppp_pkt := ppp.Make()
+    ppp_pkt.HasAddr = true
+
+    ip4_pkt, icmp_pkt := make_inner()
+
+    pkt := unpack(t, make_ipv4(ipv4.UDP), udp_pkt, l2tp_pkt, ppp_pkt, ip4_pkt,
+                  icmp_pkt)
+
+    l2tp_pkt, ok := layers.FindLayer(pkt, packet.L2TP).(*l2tp.Packet)
+    if !ok || l2tp_pkt.SessionId != 2 || l2tp_pkt.Length != 40 {
+        t.Fatalf("L2TP layer mismatch: %s", pkt)
+    }
+}
+
+func TestDataV3(t *testing.T) {
+    cookie := []byte{ 0xca, 0xfe, 0xba, 0xbe }
+
+    for _, over_ip := range []bool{ true, false } {
+        l2tp_pkt := &l2tp.Packet{
+            OverIP: over_ip,
+            Version: 3,
+            SessionId: 0x12345678,
+            Cookie: cookie,
+            HasSublayer: !over_ip,
+        }
+
+        outer := []packet.Packet{ make_ipv4(ipv4.L2TP) }
+
+        if !over_ip {
+            udp_pkt := udp.Make()
+            udp_pkt.SrcPort = udp.L2TP
+            udp_pkt.DstPort = udp.L2TP
+
+            outer = append(outer, udp_pkt)
+        }
+
+        eth_pkt := eth.Make()
+        eth_pkt.SrcAddr, _ = net.ParseMAC("02:00:00:00:00:01")
+        eth_pkt.DstAddr, _ = net.ParseMAC("02:00:00:00:00:02")
+
+        ip4_pkt, icmp_pkt := make_inner()
+
+        pkt := unpack(t, append(outer, l2tp_pkt, eth_pkt, ip4_pkt,
+                                icmp_pkt)...)
+
+        l2tp_type := packet.L2TP
+        if over_ip {
+            l2tp_type = packet.L2TPIP
+        }
+
+        l2tp_pkt, ok := layers.FindLayer(pkt, l2tp_type).(*l2tp.Packet)
+        if !ok || l2tp_pkt.SessionId != 0x12345678 ||
+           !bytes.Equal(l2tp_pkt.Cookie, cookie) ||
+           l2tp_pkt.HasSublayer == over_ip {
+            t.Fatalf("L2TP layer mismatch: %s", pkt)
+        }
+    }
+}
+
+func TestControlV3(t *testing.T) {
+    l2tp_pkt := &l2tp.Packet{
+        OverIP: true,
+        Flags: l2tp.Control | l2tp.Length | l2tp.Sequence,
+        Version: 3,
+        TunnelId: 0xabcd,
+        AVPs: []l2tp.AVP{
+            {
+                Mandatory: true,
+                Type: l2tp.AVPMessageType,
+                Value: []byte{ 0x00, byte(l2tp.Hello) },
+            },
+        },
+    }
+
+    buf, err := layers.Pack(make_ipv4(ipv4.L2TP), l2tp_pkt)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    pkt, err := layers.UnpackAll(buf, packet.IPv4)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    ctrl, ok := layers.FindLayer(pkt, packet.L2TPIP).(*l2tp.Packet)
+    if !ok || ctrl.Length != 20 || ctrl.TunnelId != 0xabcd ||
+       ctrl.MessageType() != l2tp.Hello {
+        t.Fatalf("L2TP layer mismatch: %s", pkt)
+    }
+}
+
+func TestTruncated(t *testing.T) {
+    for n := 1; n < len(test_simple); n++ {
+        var p l2tp.Packet
+
+        var b packet.Buffer
+        b.Init(test_simple[:n])
+
+        err := p.Unpack(&b)
+        if err == nil {
+            t.Fatalf("Truncated header of %d bytes accepted: %s", n, &p)
+        }
+    }
+
+    /* L2TPv3 control message over IP */
+    p := l2tp.Packet{ OverIP: true }
+
+    var b packet.Buffer
+    b.Init([]byte{ 0x00, 0x00, 0x00, 0x00, 0xc8, 0x03, 0x00 })
+
+    err := p.Unpack(&b)
+    if err == nil {
+        t.Fatalf("Truncated header accepted: %s", &p)
+    }
+}
@@ -41,6 +41,13 @@ type Packet struct {
     pkt_payload packet.Packet `string:"skip"`
 }
 
+// Well-known service access points used to guess the payload type.
+const (
+    ISIS uint8 = 0xfe
+    SNAP       = 0xaa
+    STP        = 0x42
+)
+
 func Make() *Packet {
     return &Packet{ }
 }
@@ -50,11 +57,17 @@ func (p *Packet) GetType() packet.Type {
 }
 
 func (p *Packet) GetLength() uint16 {
+    length := uint16(3)
+
+    if p.Control & 0x1 == 0 || p.Control & 0x3 == 0x1 {
+        length = 4
+    }
+
     if p.pkt_payload != nil {
-        return p.pkt_payload.GetLength() + 2
+        return p.pkt_payload.GetLength() + length
     }
 
-    return 2
+    return length
 }
 
 func (p *Packet) Equals(other packet.Packet) bool {
@@ -99,8 +112,12 @@ func (p *Packet) Payload() packet.Packet {
 }
 
 func (p *Packet) GuessPayloadType() packet.Type {
-    if p.DSAP == 0xaa && p.SSAP == 0xaa {
-        return packet.SNAP
+    if p.DSAP != p.SSAP {
+        return packet.None
+    }
+
+    if t, ok := sap_to_type_map[p.DSAP]; ok {
+        return t
     }
 
     return packet.None
@@ -109,6 +126,13 @@ func (p *Packet) GuessPayloadType() packet.Type {
 func (p *Packet) SetPayload(pl packet.Packet) error {
     p.pkt_payload = pl
 
+    for sap, t := range sap_to_type_map {
+        if t == pl.GetType() {
+            p.DSAP = sap
+            p.SSAP = sap
+        }
+    }
+
     return nil
 }
 
@@ -118,3 +142,9 @@ func (p *Packet) InitChecksum(csum uint32) {
 func (p *Packet) String() string {
     return packet.Stringify(p)
 }
+
+var sap_to_type_map = map[uint8]packet.Type{
+    ISIS: packet.ISIS,
+    SNAP: packet.SNAP,
+    STP:  packet.STP,
+}
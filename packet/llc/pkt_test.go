@@ -102,3 +102,22 @@ func BenchmarkUnpack(bn *testing.B) {
         p.Unpack(&b)
     }
 }
+
+func TestLength(t *testing.T) {
+    /* unnumbered frames have a 1-byte control field, I and S frames 2 */
+    for ctrl, length := range map[uint16]uint16{ 0x03: 3, 0x00: 4, 0x01: 4 } {
+        p := &llc.Packet{ DSAP: 0x42, SSAP: 0x42, Control: ctrl }
+
+        if p.GetLength() != length {
+            t.Fatalf("Length mismatch for control %x: %d", ctrl, p.GetLength())
+        }
+
+        var b packet.Buffer
+        b.Init(make([]byte, p.GetLength()))
+
+        err := p.Pack(&b)
+        if err != nil {
+            t.Fatalf("Error packing: %s", err)
+        }
+    }
+}
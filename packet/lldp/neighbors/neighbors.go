@@ -0,0 +1,208 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+// Provides a passive neighbor table built from captured LLDP and CDP
+// advertisements, which can be used to map the switch ports hosts are
+// connected to.
+package neighbors
+
+import "net"
+import "sort"
+import "time"
+
+import "github.com/ghedo/go.pkt/capture"
+import "github.com/ghedo/go.pkt/layers"
+import "github.com/ghedo/go.pkt/packet"
+import "github.com/ghedo/go.pkt/packet/cdp"
+import "github.com/ghedo/go.pkt/packet/eth"
+import "github.com/ghedo/go.pkt/packet/lldp"
+
+// Neighbor describes a device seen advertising itself during the capture.
+// Fields that are not advertised by the device are left empty.
+type Neighbor struct {
+    Protocol     packet.Type
+    SrcAddr      net.HardwareAddr
+    ChassisID    string
+    PortID       string
+    PortDesc     string
+    SystemName   string
+    SystemDesc   string
+    Platform     string
+    Capabilities string
+    VLAN         uint16
+    MgmtAddrs    []net.IP
+    TTL          time.Duration
+    Frames       uint64
+}
+
+// Table collects the neighbors seen in a capture.
+type Table struct {
+    neighbors map[string]*Neighbor
+}
+
+// Create a new empty neighbor table.
+func New() *Table {
+    return &Table{
+        neighbors: make(map[string]*Neighbor),
+    }
+}
+
+// Update the table with the given packet. Only LLDP and CDP packets are
+// considered, other packets are ignored. Return the updated neighbor, or nil.
+// LLDP shutdown advertisements (i.e. with a zero TTL) remove the neighbor from
+// the table.
+func (t *Table) Add(pkt packet.Packet) *Neighbor {
+    var n Neighbor
+
+    switch {
+    case layers.FindLayer(pkt, packet.LLDP) != nil:
+        lldp_pkt := layers.FindLayer(pkt, packet.LLDP).(*lldp.Packet)
+        from_lldp(&n, lldp_pkt)
+
+    case layers.FindLayer(pkt, packet.CDP) != nil:
+        cdp_pkt := layers.FindLayer(pkt, packet.CDP).(*cdp.Packet)
+        from_cdp(&n, cdp_pkt)
+
+    default:
+        return nil
+    }
+
+    if eth_pkt, ok := layers.FindLayer(pkt, packet.Eth).(*eth.Packet); ok {
+        n.SrcAddr = eth_pkt.SrcAddr
+    }
+
+    key := n.Protocol.String() + "|" + n.ChassisID + "|" + n.PortID
+
+    old := t.neighbors[key]
+    if old != nil {
+        n.Frames = old.Frames
+    }
+
+    n.Frames++
+
+    if n.Protocol == packet.LLDP && n.TTL == 0 {
+        delete(t.neighbors, key)
+        return &n
+    }
+
+    t.neighbors[key] = &n
+
+    return &n
+}
+
+func from_lldp(n *Neighbor, p *lldp.Packet) {
+    n.Protocol  = packet.LLDP
+    n.ChassisID = p.Chassis()
+    n.PortID    = p.Port()
+    n.TTL       = time.Duration(p.TTL) * time.Second
+
+    n.PortDesc, _   = p.PortDescription()
+    n.SystemName, _ = p.SystemName()
+    n.SystemDesc, _ = p.SystemDescription()
+
+    if caps := p.SystemCapabilities(); caps != nil {
+        n.Capabilities = caps.Enabled.String()
+    }
+
+    n.VLAN, _ = p.PortVLANID()
+
+    for _, a := range p.ManagementAddresses() {
+        if ip := a.IP(); ip != nil {
+            n.MgmtAddrs = append(n.MgmtAddrs, ip)
+        }
+    }
+}
+
+func from_cdp(n *Neighbor, p *cdp.Packet) {
+    n.Protocol = packet.CDP
+    n.TTL      = time.Duration(p.TTL) * time.Second
+
+    n.ChassisID, _  = p.DeviceID()
+    n.PortID, _     = p.PortID()
+    n.SystemName, _ = p.SystemName()
+    n.SystemDesc, _ = p.SoftwareVersion()
+    n.Platform, _   = p.Platform()
+
+    n.Capabilities = p.Capabilities().String()
+
+    n.VLAN, _ = p.NativeVLAN()
+
+    n.MgmtAddrs = p.MgmtAddresses()
+    if n.MgmtAddrs == nil {
+        n.MgmtAddrs = p.Addresses()
+    }
+}
+
+// Capture packets from the given capture handle and add them to the table
+// until no more packets are available (e.g. at the end of a dump file).
+func (t *Table) Capture(c capture.Handle) error {
+    for {
+        buf, err := c.Capture()
+        if err != nil {
+            return err
+        }
+
+        if buf == nil {
+            return nil
+        }
+
+        pkt, err := layers.UnpackAll(buf, c.LinkType())
+        if err != nil {
+            continue
+        }
+
+        t.Add(pkt)
+    }
+}
+
+// Return the neighbors in the table, sorted by chassis and port ID.
+func (t *Table) Neighbors() []*Neighbor {
+    var neighbors []*Neighbor
+
+    for _, n := range t.neighbors {
+        neighbors = append(neighbors, n)
+    }
+
+    sort.Slice(neighbors, func(a, b int) bool {
+        na, nb := neighbors[a], neighbors[b]
+
+        if na.ChassisID != nb.ChassisID {
+            return na.ChassisID < nb.ChassisID
+        }
+
+        if na.PortID != nb.PortID {
+            return na.PortID < nb.PortID
+        }
+
+        return na.Protocol < nb.Protocol
+    })
+
+    return neighbors
+}
@@ -0,0 +1,123 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package neighbors_test
+
+import "log"
+import "net"
+import "testing"
+import "time"
+
+import "github.com/ghedo/go.pkt/capture/file"
+import "github.com/ghedo/go.pkt/packet"
+import "github.com/ghedo/go.pkt/packet/lldp"
+import "github.com/ghedo/go.pkt/packet/lldp/neighbors"
+
+func TestCapture(t *testing.T) {
+    src, err := file.Open("neighbors_test.pcap")
+    if err != nil {
+        t.Fatalf("Error opening: %s", err)
+    }
+    defer src.Close()
+
+    table := neighbors.New()
+
+    err = table.Capture(src)
+    if err != nil {
+        t.Fatalf("Error capturing: %s", err)
+    }
+
+    list := table.Neighbors()
+    if len(list) != 2 {
+        t.Fatalf("Neighbor count mismatch: %d", len(list))
+    }
+
+    n := list[0]
+
+    if n.Protocol != packet.LLDP || n.ChassisID != "00:11:22:33:44:55" ||
+       n.PortID != "Gi0/1" || n.PortDesc != "uplink" ||
+       n.SystemName != "sw1" || n.Capabilities != "bridge" ||
+       n.VLAN != 10 || n.TTL != 120 * time.Second || n.Frames != 2 ||
+       len(n.MgmtAddrs) != 1 ||
+       !n.MgmtAddrs[0].Equal(net.ParseIP("192.168.0.1")) {
+        t.Fatalf("LLDP neighbor mismatch: %v", n)
+    }
+
+    n = list[1]
+
+    if n.Protocol != packet.CDP || n.ChassisID != "sw2" ||
+       n.PortID != "Gi0/2" || n.Platform != "cisco WS-C2960" ||
+       n.VLAN != 20 || n.SrcAddr.String() != "00:aa:bb:cc:dd:ee" ||
+       len(n.MgmtAddrs) != 1 ||
+       !n.MgmtAddrs[0].Equal(net.ParseIP("10.0.0.2")) {
+        t.Fatalf("CDP neighbor mismatch: %v", n)
+    }
+}
+
+func TestShutdown(t *testing.T) {
+    p := lldp.Make()
+    p.ChassisIDType = lldp.ChassisLocal
+    p.ChassisID     = []byte("sw3")
+    p.PortIDType    = lldp.PortLocal
+    p.PortID        = []byte("1")
+
+    table := neighbors.New()
+
+    if n := table.Add(p); n == nil || n.Frames != 1 {
+        t.Fatalf("Neighbor mismatch: %v", n)
+    }
+
+    p.TTL = 0
+
+    table.Add(p)
+
+    if len(table.Neighbors()) != 0 {
+        t.Fatalf("Neighbor not removed")
+    }
+}
+
+func ExampleTable() {
+    src, err := file.Open("/path/to/file/dump.pcap")
+    if err != nil {
+        log.Fatal(err)
+    }
+    defer src.Close()
+
+    table := neighbors.New()
+
+    err = table.Capture(src)
+    if err != nil {
+        log.Fatal(err)
+    }
+
+    for _, n := range table.Neighbors() {
+        log.Println(n.Protocol, n.SystemName, n.ChassisID, n.PortID)
+    }
+}
@@ -0,0 +1,397 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+// Provides encoding and decoding for LLDP (IEEE 802.1AB) packets, including
+// the IEEE 802.1, IEEE 802.3 and LLDP-MED organizationally specific TLVs.
+package lldp
+
+import "bytes"
+import "fmt"
+import "net"
+
+import "github.com/ghedo/go.pkt/packet"
+
+type Packet struct {
+    ChassisIDType ChassisIDType `string:"chassis_type"`
+    ChassisID     []byte        `string:"skip"`
+    PortIDType    PortIDType    `string:"port_type"`
+    PortID        []byte        `string:"skip"`
+    TTL           uint16        `string:"ttl"`
+    TLVs          []TLV         `string:"skip"`
+}
+
+// TLV is an optional TLV of a LLDPDU. TLVs are stored undecoded so that LLDPDUs
+// can be encoded back unchanged, use Decode() or the Parse*() functions to get
+// their typed representation.
+type TLV struct {
+    Type  TLVType
+    Value []byte
+}
+
+type TLVType uint8
+
+const (
+    End             TLVType = 0
+    ChassisID               = 1
+    PortID                  = 2
+    TTL                     = 3
+    PortDescription         = 4
+    SystemName              = 5
+    SystemDescription       = 6
+    SystemCapabilities      = 7
+    ManagementAddress       = 8
+    OrgSpecific             = 127
+)
+
+type ChassisIDType uint8
+
+const (
+    ChassisComponent ChassisIDType = 1
+    ChassisIfAlias                 = 2
+    ChassisPortComponent           = 3
+    ChassisMACAddress              = 4
+    ChassisNetworkAddress          = 5
+    ChassisIfName                  = 6
+    ChassisLocal                   = 7
+)
+
+type PortIDType uint8
+
+const (
+    PortIfAlias        PortIDType = 1
+    PortComponent                 = 2
+    PortMACAddress                = 3
+    PortNetworkAddress            = 4
+    PortIfName                    = 5
+    PortAgentCircuitID            = 6
+    PortLocal                     = 7
+)
+
+// Make a new LLDPDU with the default TTL.
+func Make() *Packet {
+    return &Packet{
+        TTL: 120,
+    }
+}
+
+func (p *Packet) GetType() packet.Type {
+    return packet.LLDP
+}
+
+func (p *Packet) GetLength() uint16 {
+    length := 3 + len(p.ChassisID) + 3 + len(p.PortID) + 4 + 2
+
+    for _, t := range p.TLVs {
+        length += 2 + len(t.Value)
+    }
+
+    return uint16(length)
+}
+
+func (p *Packet) Equals(other packet.Packet) bool {
+    return packet.Compare(p, other)
+}
+
+func (p *Packet) Answers(other packet.Packet) bool {
+    return false
+}
+
+func (p *Packet) Pack(buf *packet.Buffer) error {
+    id := append([]byte{ uint8(p.ChassisIDType) }, p.ChassisID...)
+    pack_tlv(buf, ChassisID, id)
+
+    id = append([]byte{ uint8(p.PortIDType) }, p.PortID...)
+    pack_tlv(buf, PortID, id)
+
+    pack_tlv(buf, TTL, []byte{ uint8(p.TTL >> 8), uint8(p.TTL) })
+
+    for _, t := range p.TLVs {
+        if len(t.Value) > 511 {
+            return fmt.Errorf("Invalid TLV length %d", len(t.Value))
+        }
+
+        pack_tlv(buf, t.Type, t.Value)
+    }
+
+    pack_tlv(buf, End, nil)
+
+    return nil
+}
+
+func pack_tlv(buf *packet.Buffer, t TLVType, value []byte) {
+    buf.WriteN(uint16(t) << 9 | uint16(len(value)))
+    buf.Write(value)
+}
+
+func (p *Packet) Unpack(buf *packet.Buffer) error {
+    p.TLVs = nil
+
+    for i := 0; ; i++ {
+        var hdr uint16
+
+        if buf.Len() < 2 {
+            return fmt.Errorf("Invalid LLDPDU: missing end TLV")
+        }
+
+        buf.ReadN(&hdr)
+
+        t := TLVType(hdr >> 9)
+        n := int(hdr & 0x1ff)
+
+        if buf.Len() < n {
+            return fmt.Errorf("Invalid TLV length %d", n)
+        }
+
+        value := buf.Next(n)
+
+        /* the first three TLVs are mandatory and in a fixed order */
+        switch {
+        case i == 0 && t == ChassisID && n >= 2:
+            p.ChassisIDType = ChassisIDType(value[0])
+            p.ChassisID     = value[1:]
+
+        case i == 1 && t == PortID && n >= 2:
+            p.PortIDType = PortIDType(value[0])
+            p.PortID     = value[1:]
+
+        case i == 2 && t == TTL && n >= 2:
+            p.TTL = uint16(value[0]) << 8 | uint16(value[1])
+
+        case i < 3:
+            return fmt.Errorf("Invalid LLDPDU: unexpected %s TLV", t)
+
+        case t == End:
+            /* trailing data (e.g. Ethernet padding) is ignored */
+            return nil
+
+        default:
+            p.TLVs = append(p.TLVs, TLV{ Type: t, Value: value })
+        }
+    }
+}
+
+func (p *Packet) Payload() packet.Packet {
+    return nil
+}
+
+func (p *Packet) GuessPayloadType() packet.Type {
+    return packet.None
+}
+
+func (p *Packet) SetPayload(pl packet.Packet) error {
+    return nil
+}
+
+func (p *Packet) InitChecksum(csum uint32) {
+}
+
+func (p *Packet) String() string {
+    return packet.Stringify(p)
+}
+
+// Return the chassis ID in a human readable form: MAC addresses and network
+// addresses are formatted as such, other IDs are returned as strings.
+func (p *Packet) Chassis() string {
+    switch p.ChassisIDType {
+    case ChassisMACAddress:
+        return net.HardwareAddr(p.ChassisID).String()
+
+    case ChassisNetworkAddress:
+        return network_address(p.ChassisID)
+    }
+
+    return string(p.ChassisID)
+}
+
+// Return the port ID in a human readable form: MAC addresses and network
+// addresses are formatted as such, other IDs are returned as strings.
+func (p *Packet) Port() string {
+    switch p.PortIDType {
+    case PortMACAddress:
+        return net.HardwareAddr(p.PortID).String()
+
+    case PortNetworkAddress:
+        return network_address(p.PortID)
+    }
+
+    return string(p.PortID)
+}
+
+/* network addresses are prefixed by their IANA address family number */
+func network_address(addr []byte) string {
+    if ip := address_ip(addr); ip != nil {
+        return ip.String()
+    }
+
+    return fmt.Sprintf("%x", addr)
+}
+
+func address_ip(addr []byte) net.IP {
+    switch {
+    case len(addr) == 5 && addr[0] == 1:
+        return net.IP(addr[1:])
+
+    case len(addr) == 17 && addr[0] == 2:
+        return net.IP(addr[1:])
+    }
+
+    return nil
+}
+
+// Return the first TLV of the given type, or nil.
+func (p *Packet) FindTLV(t TLVType) *TLV {
+    for i := range p.TLVs {
+        if p.TLVs[i].Type == t {
+            return &p.TLVs[i]
+        }
+    }
+
+    return nil
+}
+
+// Return the first organizationally specific TLV with the given OUI and
+// subtype, or nil.
+func (p *Packet) FindOrgTLV(oui [3]byte, subtype uint8) *OrgTLV {
+    for _, t := range p.TLVs {
+        if t.Type != OrgSpecific {
+            continue
+        }
+
+        o, err := ParseOrg(t.Value)
+        if err == nil && o.OUI == oui && o.Subtype == subtype {
+            return o
+        }
+    }
+
+    return nil
+}
+
+func (p *Packet) find_string(t TLVType) (string, bool) {
+    tlv := p.FindTLV(t)
+    if tlv == nil {
+        return "", false
+    }
+
+    return string(tlv.Value), true
+}
+
+// Return the port description advertised in the LLDPDU, if any.
+func (p *Packet) PortDescription() (string, bool) {
+    return p.find_string(PortDescription)
+}
+
+// Return the system name advertised in the LLDPDU, if any.
+func (p *Packet) SystemName() (string, bool) {
+    return p.find_string(SystemName)
+}
+
+// Return the system description advertised in the LLDPDU, if any.
+func (p *Packet) SystemDescription() (string, bool) {
+    return p.find_string(SystemDescription)
+}
+
+// Return the system capabilities advertised in the LLDPDU, or nil.
+func (p *Packet) SystemCapabilities() *Capabilities {
+    tlv := p.FindTLV(SystemCapabilities)
+    if tlv == nil {
+        return nil
+    }
+
+    c, err := ParseCapabilities(tlv.Value)
+    if err != nil {
+        return nil
+    }
+
+    return c
+}
+
+// Return the management addresses advertised in the LLDPDU.
+func (p *Packet) ManagementAddresses() []*MgmtAddress {
+    var addrs []*MgmtAddress
+
+    for _, t := range p.TLVs {
+        if t.Type != ManagementAddress {
+            continue
+        }
+
+        a, err := ParseMgmtAddress(t.Value)
+        if err == nil {
+            addrs = append(addrs, a)
+        }
+    }
+
+    return addrs
+}
+
+func (t TLV) Equal(other TLV) bool {
+    return t.Type == other.Type && bytes.Equal(t.Value, other.Value)
+}
+
+func (t TLVType) String() string {
+    switch t {
+    case End:                return "end"
+    case ChassisID:          return "chassis-id"
+    case PortID:             return "port-id"
+    case TTL:                return "ttl"
+    case PortDescription:    return "port-description"
+    case SystemName:         return "system-name"
+    case SystemDescription:  return "system-description"
+    case SystemCapabilities: return "system-capabilities"
+    case ManagementAddress:  return "management-address"
+    case OrgSpecific:        return "org-specific"
+    default:                 return fmt.Sprintf("0x%x", uint8(t))
+    }
+}
+
+func (t ChassisIDType) String() string {
+    switch t {
+    case ChassisComponent:      return "chassis-component"
+    case ChassisIfAlias:        return "interface-alias"
+    case ChassisPortComponent:  return "port-component"
+    case ChassisMACAddress:     return "mac-address"
+    case ChassisNetworkAddress: return "network-address"
+    case ChassisIfName:         return "interface-name"
+    case ChassisLocal:          return "local"
+    default:                    return ""
+    }
+}
+
+func (t PortIDType) String() string {
+    switch t {
+    case PortIfAlias:        return "interface-alias"
+    case PortComponent:      return "port-component"
+    case PortMACAddress:     return "mac-address"
+    case PortNetworkAddress: return "network-address"
+    case PortIfName:         return "interface-name"
+    case PortAgentCircuitID: return "agent-circuit-id"
+    case PortLocal:          return "local"
+    default:                 return ""
+    }
+}
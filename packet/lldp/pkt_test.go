@@ -0,0 +1,237 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package lldp_test
+
+import "bytes"
+import "net"
+import "reflect"
+import "testing"
+
+import "github.com/ghedo/go.pkt/layers"
+import "github.com/ghedo/go.pkt/packet"
+import "github.com/ghedo/go.pkt/packet/eth"
+import "github.com/ghedo/go.pkt/packet/lldp"
+
+var test_simple = []byte{
+    0x02, 0x07, 0x04, 0x00, 0x11, 0x22, 0x33, 0x44, 0x55, 0x04, 0x06, 0x05,
+    0x47, 0x69, 0x30, 0x2f, 0x31, 0x06, 0x02, 0x00, 0x78, 0x08, 0x06, 0x75,
+    0x70, 0x6c, 0x69, 0x6e, 0x6b, 0x0a, 0x03, 0x73, 0x77, 0x31, 0x0e, 0x04,
+    0x00, 0x14, 0x00, 0x04, 0x10, 0x0c, 0x05, 0x01, 0xc0, 0xa8, 0x00, 0x01,
+    0x02, 0x00, 0x00, 0x00, 0x01, 0x00, 0xfe, 0x06, 0x00, 0x80, 0xc2, 0x01,
+    0x00, 0x0a, 0x00, 0x00,
+}
+
+func MakeTestSimple() *lldp.Packet {
+    return &lldp.Packet{
+        ChassisIDType: lldp.ChassisMACAddress,
+        ChassisID: []byte{ 0x00, 0x11, 0x22, 0x33, 0x44, 0x55 },
+        PortIDType: lldp.PortIfName,
+        PortID: []byte("Gi0/1"),
+        TTL: 120,
+        TLVs: []lldp.TLV{
+            { Type: lldp.PortDescription, Value: []byte("uplink") },
+            { Type: lldp.SystemName, Value: []byte("sw1") },
+            {
+                Type: lldp.SystemCapabilities,
+                Value: []byte{ 0x00, 0x14, 0x00, 0x04 },
+            },
+            {
+                Type: lldp.ManagementAddress,
+                Value: []byte{
+                    0x05, 0x01, 0xc0, 0xa8, 0x00, 0x01, 0x02, 0x00, 0x00,
+                    0x00, 0x01, 0x00,
+                },
+            },
+            {
+                Type: lldp.OrgSpecific,
+                Value: []byte{ 0x00, 0x80, 0xc2, 0x01, 0x00, 0x0a },
+            },
+        },
+    }
+}
+
+func TestPack(t *testing.T) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_simple)))
+
+    p := MakeTestSimple()
+
+    err := p.Pack(&b)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if !bytes.Equal(test_simple, b.Buffer()) {
+        t.Fatalf("Raw packet mismatch: %x", b.Buffer())
+    }
+}
+
+func BenchmarkPack(bn *testing.B) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_simple)))
+
+    p := MakeTestSimple()
+
+    for n := 0; n < bn.N; n++ {
+        p.Pack(&b)
+    }
+}
+
+func TestUnpack(t *testing.T) {
+    var p lldp.Packet
+
+    cmp := MakeTestSimple()
+
+    var b packet.Buffer
+    b.Init(test_simple)
+
+    err := p.Unpack(&b)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if !p.Equals(cmp) {
+        t.Fatalf("Packet mismatch:\n%s\n%s", &p, cmp)
+    }
+
+    if p.Chassis() != "00:11:22:33:44:55" || p.Port() != "Gi0/1" {
+        t.Fatalf("ID mismatch: %s %s", p.Chassis(), p.Port())
+    }
+
+    if name, _ := p.SystemName(); name != "sw1" {
+        t.Fatalf("System name mismatch: %s", name)
+    }
+
+    caps := p.SystemCapabilities()
+    if caps == nil || caps.Supported != lldp.CapBridge | lldp.CapRouter ||
+       caps.Enabled != lldp.CapBridge {
+        t.Fatalf("Capabilities mismatch: %v", caps)
+    }
+
+    addrs := p.ManagementAddresses()
+    if len(addrs) != 1 || !addrs[0].IP().Equal(net.ParseIP("192.168.0.1")) ||
+       addrs[0].IfNumber != 1 {
+        t.Fatalf("Management address mismatch: %v", addrs)
+    }
+
+    if vlan, ok := p.PortVLANID(); !ok || vlan != 10 {
+        t.Fatalf("Port VLAN mismatch: %d", vlan)
+    }
+}
+
+func BenchmarkUnpack(bn *testing.B) {
+    var p lldp.Packet
+    var b packet.Buffer
+
+    for n := 0; n < bn.N; n++ {
+        b.Init(test_simple)
+        p.Unpack(&b)
+    }
+}
+
+func TestOrg(t *testing.T) {
+    var tests = []struct {
+        value []byte
+        out   interface{}
+    }{
+        {
+            []byte{ 0x00, 0x80, 0xc2, 0x03, 0x00, 0x14, 0x04, 'v', 'o', 'i', 'p' },
+            &lldp.VLANName{ VLAN: 20, Name: "voip" },
+        },
+        {
+            []byte{ 0x00, 0x12, 0x0f, 0x01, 0x03, 0x6c, 0x01, 0x00, 0x1e },
+            &lldp.MACPHYConfig{
+                AutoNegSupported: true,
+                AutoNegEnabled: true,
+                AutoNegAdv: 0x6c01,
+                MAUType: 30,
+            },
+        },
+        {
+            []byte{ 0x00, 0x12, 0x0f, 0x04, 0x05, 0xee },
+            uint16(1518),
+        },
+        {
+            []byte{ 0x00, 0x12, 0xbb, 0x02, 0x01, 0x40, 0x29, 0xae },
+            &lldp.NetworkPolicy{
+                AppType: 1,
+                Tagged: true,
+                VLAN: 20,
+                Priority: 6,
+                DSCP: 46,
+            },
+        },
+        {
+            []byte{ 0x00, 0x12, 0xbb, 0x08, 'S', 'N', '1' },
+            "SN1",
+        },
+    }
+
+    for _, test := range tests {
+        v, err := lldp.TLV{ Type: lldp.OrgSpecific, Value: test.value }.Decode()
+        if err != nil {
+            t.Fatalf("Error decoding %x: %s", test.value, err)
+        }
+
+        if !reflect.DeepEqual(v, test.out) {
+            t.Fatalf("Decoded TLV mismatch: %v", v)
+        }
+    }
+}
+
+func TestEth(t *testing.T) {
+    eth_pkt := eth.Make()
+    eth_pkt.SrcAddr, _ = net.ParseMAC("00:11:22:33:44:55")
+    eth_pkt.DstAddr, _ = net.ParseMAC("01:80:c2:00:00:0e")
+
+    lldp_pkt := MakeTestSimple()
+
+    buf, err := layers.Pack(eth_pkt, lldp_pkt)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if buf[12] != 0x88 || buf[13] != 0xcc {
+        t.Fatalf("EtherType mismatch: %x", buf[12:14])
+    }
+
+    /* Ethernet padding after the end TLV */
+    buf = append(buf, 0, 0, 0, 0)
+
+    p, err := layers.UnpackAll(buf, packet.Eth)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if !p.Payload().Equals(lldp_pkt) {
+        t.Fatalf("Packet mismatch:\n%s\n%s", p.Payload(), lldp_pkt)
+    }
+}
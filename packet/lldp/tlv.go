@@ -0,0 +1,492 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package lldp
+
+import "fmt"
+import "net"
+import "strings"
+
+import "github.com/ghedo/go.pkt/packet"
+
+// System capabilities TLV body.
+type Capabilities struct {
+    Supported Capability
+    Enabled   Capability
+}
+
+type Capability uint16
+
+const (
+    CapOther     Capability = 0x0001
+    CapRepeater             = 0x0002
+    CapBridge               = 0x0004
+    CapWLANAP               = 0x0008
+    CapRouter               = 0x0010
+    CapTelephone            = 0x0020
+    CapDOCSIS               = 0x0040
+    CapStation              = 0x0080
+    CapCVLAN                = 0x0100
+    CapSVLAN                = 0x0200
+    CapTPMR                 = 0x0400
+)
+
+// Management address TLV body. The address family is an IANA address family
+// number (e.g. 1 for IPv4 and 2 for IPv6).
+type MgmtAddress struct {
+    Family    uint8
+    Addr      []byte
+    IfSubtype uint8
+    IfNumber  uint32
+    OID       []byte
+}
+
+// Organizationally specific TLV body.
+type OrgTLV struct {
+    OUI     [3]byte
+    Subtype uint8
+    Info    []byte
+}
+
+var (
+    OUI8021 = [3]byte{ 0x00, 0x80, 0xc2 }
+    OUI8023 = [3]byte{ 0x00, 0x12, 0x0f }
+    OUIMED  = [3]byte{ 0x00, 0x12, 0xbb }
+)
+
+// IEEE 802.1 TLV subtypes.
+const (
+    Dot1PortVLANID       uint8 = 1
+    Dot1ProtocolVLAN           = 2
+    Dot1VLANName               = 3
+    Dot1ProtocolIdentity       = 4
+    Dot1LinkAggr               = 7
+)
+
+// IEEE 802.3 TLV subtypes.
+const (
+    Dot3MACPHYConfig uint8 = 1
+    Dot3PowerViaMDI        = 2
+    Dot3LinkAggr           = 3
+    Dot3MaxFrameSize       = 4
+)
+
+// LLDP-MED TLV subtypes.
+const (
+    MEDCaps             uint8 = 1
+    MEDNetworkPolicy          = 2
+    MEDLocation               = 3
+    MEDExtendedPower          = 4
+    MEDHardwareRevision       = 5
+    MEDFirmwareRevision       = 6
+    MEDSoftwareRevision       = 7
+    MEDSerialNumber           = 8
+    MEDManufacturer           = 9
+    MEDModelName              = 10
+    MEDAssetID                = 11
+)
+
+// IEEE 802.1 port and protocol VLAN ID TLV body.
+type ProtocolVLAN struct {
+    Supported bool
+    Enabled   bool
+    VLAN      uint16
+}
+
+// IEEE 802.1 VLAN name TLV body.
+type VLANName struct {
+    VLAN uint16
+    Name string
+}
+
+// IEEE 802.1 and 802.3 link aggregation TLV body.
+type LinkAggregation struct {
+    Capable   bool
+    Enabled   bool
+    AggPortID uint32
+}
+
+// IEEE 802.3 MAC/PHY configuration/status TLV body.
+type MACPHYConfig struct {
+    AutoNegSupported bool
+    AutoNegEnabled   bool
+    AutoNegAdv       uint16
+    MAUType          uint16
+}
+
+// IEEE 802.3 power via MDI TLV body. The type/source/priority, requested and
+// allocated fields are only present in the 802.3at version of the TLV.
+type PowerViaMDI struct {
+    MDISupport uint8
+    PSEPair    uint8
+    Class      uint8
+    Extended   bool
+    TypeSrcPri uint8
+    Requested  uint16
+    Allocated  uint16
+}
+
+// LLDP-MED capabilities TLV body.
+type MEDCapabilities struct {
+    Capabilities uint16
+    DeviceType   uint8
+}
+
+// LLDP-MED network policy TLV body.
+type NetworkPolicy struct {
+    AppType  uint8
+    Unknown  bool
+    Tagged   bool
+    VLAN     uint16
+    Priority uint8
+    DSCP     uint8
+}
+
+// LLDP-MED location identification TLV body.
+type Location struct {
+    Format uint8
+    Data   []byte
+}
+
+// LLDP-MED extended power via MDI TLV body. The power value is in units of
+// 0.1 W.
+type ExtendedPower struct {
+    TypeSrcPri uint8
+    Value      uint16
+}
+
+// Decode the TLV into its typed representation. The returned value is a string
+// for description and name TLVs, a pointer to the matching struct for
+// capabilities and management address TLVs, and the decoded body (see
+// OrgTLV.Decode()) for organizationally specific TLVs. Other TLVs are returned
+// as is.
+func (t TLV) Decode() (interface{}, error) {
+    switch t.Type {
+    case PortDescription, SystemName, SystemDescription:
+        return string(t.Value), nil
+
+    case SystemCapabilities:
+        return ParseCapabilities(t.Value)
+
+    case ManagementAddress:
+        return ParseMgmtAddress(t.Value)
+
+    case OrgSpecific:
+        o, err := ParseOrg(t.Value)
+        if err != nil {
+            return nil, err
+        }
+
+        return o.Decode()
+    }
+
+    return t, nil
+}
+
+// Parse the body of a system capabilities TLV.
+func ParseCapabilities(data []byte) (*Capabilities, error) {
+    if len(data) != 4 {
+        return nil, fmt.Errorf("Invalid system capabilities TLV")
+    }
+
+    return &Capabilities{
+        Supported: Capability(uint16(data[0]) << 8 | uint16(data[1])),
+        Enabled: Capability(uint16(data[2]) << 8 | uint16(data[3])),
+    }, nil
+}
+
+// Parse the body of a management address TLV.
+func ParseMgmtAddress(data []byte) (*MgmtAddress, error) {
+    if len(data) < 1 || data[0] < 1 || len(data) < 1 + int(data[0]) + 6 {
+        return nil, fmt.Errorf("Invalid management address TLV")
+    }
+
+    var b packet.Buffer
+    b.Init(data)
+
+    var addr_len, oid_len uint8
+    a := &MgmtAddress{}
+
+    b.ReadN(&addr_len)
+    b.ReadN(&a.Family)
+    a.Addr = b.Next(int(addr_len) - 1)
+    b.ReadN(&a.IfSubtype)
+    b.ReadN(&a.IfNumber)
+    b.ReadN(&oid_len)
+
+    if b.Len() < int(oid_len) {
+        return nil, fmt.Errorf("Invalid management address TLV")
+    }
+
+    if oid_len > 0 {
+        a.OID = b.Next(int(oid_len))
+    }
+
+    return a, nil
+}
+
+// Parse the body of an organizationally specific TLV.
+func ParseOrg(data []byte) (*OrgTLV, error) {
+    if len(data) < 4 {
+        return nil, fmt.Errorf("Invalid organizationally specific TLV")
+    }
+
+    o := &OrgTLV{ Subtype: data[3], Info: data[4:] }
+    copy(o.OUI[:], data[:3])
+
+    return o, nil
+}
+
+// Decode the body of the TLV. The returned value is an uint16 for port VLAN ID
+// and maximum frame size TLVs, a string for LLDP-MED inventory TLVs and a
+// pointer to the matching struct for the other known IEEE 802.1, IEEE 802.3
+// and LLDP-MED TLVs. Unknown TLVs are returned as is.
+func (o *OrgTLV) Decode() (interface{}, error) {
+    d := o.Info
+
+    invalid := fmt.Errorf("Invalid organizationally specific TLV")
+
+    switch {
+    case o.OUI == OUI8021 && o.Subtype == Dot1PortVLANID,
+         o.OUI == OUI8023 && o.Subtype == Dot3MaxFrameSize:
+        if len(d) != 2 {
+            return nil, invalid
+        }
+
+        return uint16(d[0]) << 8 | uint16(d[1]), nil
+
+    case o.OUI == OUI8021 && o.Subtype == Dot1ProtocolVLAN:
+        if len(d) != 3 {
+            return nil, invalid
+        }
+
+        return &ProtocolVLAN{
+            Supported: d[0] & 0x02 != 0,
+            Enabled: d[0] & 0x04 != 0,
+            VLAN: uint16(d[1]) << 8 | uint16(d[2]),
+        }, nil
+
+    case o.OUI == OUI8021 && o.Subtype == Dot1VLANName:
+        if len(d) < 3 || len(d) < 3 + int(d[2]) {
+            return nil, invalid
+        }
+
+        return &VLANName{
+            VLAN: uint16(d[0]) << 8 | uint16(d[1]),
+            Name: string(d[3:3 + int(d[2])]),
+        }, nil
+
+    case o.OUI == OUI8021 && o.Subtype == Dot1LinkAggr,
+         o.OUI == OUI8023 && o.Subtype == Dot3LinkAggr:
+        if len(d) != 5 {
+            return nil, invalid
+        }
+
+        return &LinkAggregation{
+            Capable: d[0] & 0x01 != 0,
+            Enabled: d[0] & 0x02 != 0,
+            AggPortID: uint32(d[1]) << 24 | uint32(d[2]) << 16 |
+                       uint32(d[3]) << 8 | uint32(d[4]),
+        }, nil
+
+    case o.OUI == OUI8023 && o.Subtype == Dot3MACPHYConfig:
+        if len(d) != 5 {
+            return nil, invalid
+        }
+
+        return &MACPHYConfig{
+            AutoNegSupported: d[0] & 0x01 != 0,
+            AutoNegEnabled: d[0] & 0x02 != 0,
+            AutoNegAdv: uint16(d[1]) << 8 | uint16(d[2]),
+            MAUType: uint16(d[3]) << 8 | uint16(d[4]),
+        }, nil
+
+    case o.OUI == OUI8023 && o.Subtype == Dot3PowerViaMDI:
+        if len(d) != 3 && len(d) < 8 {
+            return nil, invalid
+        }
+
+        pw := &PowerViaMDI{
+            MDISupport: d[0],
+            PSEPair: d[1],
+            Class: d[2],
+        }
+
+        if len(d) >= 8 {
+            pw.Extended   = true
+            pw.TypeSrcPri = d[3]
+            pw.Requested  = uint16(d[4]) << 8 | uint16(d[5])
+            pw.Allocated  = uint16(d[6]) << 8 | uint16(d[7])
+        }
+
+        return pw, nil
+
+    case o.OUI == OUIMED && o.Subtype == MEDCaps:
+        if len(d) != 3 {
+            return nil, invalid
+        }
+
+        return &MEDCapabilities{
+            Capabilities: uint16(d[0]) << 8 | uint16(d[1]),
+            DeviceType: d[2],
+        }, nil
+
+    case o.OUI == OUIMED && o.Subtype == MEDNetworkPolicy:
+        if len(d) != 4 {
+            return nil, invalid
+        }
+
+        policy := uint32(d[1]) << 16 | uint32(d[2]) << 8 | uint32(d[3])
+
+        return &NetworkPolicy{
+            AppType: d[0],
+            Unknown: policy & 0x800000 != 0,
+            Tagged: policy & 0x400000 != 0,
+            VLAN: uint16(policy >> 9) & 0xfff,
+            Priority: uint8(policy >> 6) & 0x7,
+            DSCP: uint8(policy) & 0x3f,
+        }, nil
+
+    case o.OUI == OUIMED && o.Subtype == MEDLocation:
+        if len(d) < 1 {
+            return nil, invalid
+        }
+
+        return &Location{ Format: d[0], Data: d[1:] }, nil
+
+    case o.OUI == OUIMED && o.Subtype == MEDExtendedPower:
+        if len(d) != 3 {
+            return nil, invalid
+        }
+
+        return &ExtendedPower{
+            TypeSrcPri: d[0],
+            Value: uint16(d[1]) << 8 | uint16(d[2]),
+        }, nil
+
+    case o.OUI == OUIMED && o.Subtype >= MEDHardwareRevision &&
+                            o.Subtype <= MEDAssetID:
+        return string(d), nil
+    }
+
+    return o, nil
+}
+
+// Return the port VLAN ID advertised in the LLDPDU, if any.
+func (p *Packet) PortVLANID() (uint16, bool) {
+    o := p.FindOrgTLV(OUI8021, Dot1PortVLANID)
+    if o == nil {
+        return 0, false
+    }
+
+    v, err := o.Decode()
+    if err != nil {
+        return 0, false
+    }
+
+    return v.(uint16), true
+}
+
+// Return the VLAN names advertised in the LLDPDU.
+func (p *Packet) VLANNames() []*VLANName {
+    var names []*VLANName
+
+    for _, v := range p.org_values(OUI8021, Dot1VLANName) {
+        names = append(names, v.(*VLANName))
+    }
+
+    return names
+}
+
+// Return the LLDP-MED network policies advertised in the LLDPDU.
+func (p *Packet) NetworkPolicies() []*NetworkPolicy {
+    var policies []*NetworkPolicy
+
+    for _, v := range p.org_values(OUIMED, MEDNetworkPolicy) {
+        policies = append(policies, v.(*NetworkPolicy))
+    }
+
+    return policies
+}
+
+// Return the IEEE 802.3 MAC/PHY configuration advertised in the LLDPDU, or
+// nil.
+func (p *Packet) MACPHYConfig() *MACPHYConfig {
+    for _, v := range p.org_values(OUI8023, Dot3MACPHYConfig) {
+        return v.(*MACPHYConfig)
+    }
+
+    return nil
+}
+
+func (p *Packet) org_values(oui [3]byte, subtype uint8) []interface{} {
+    var values []interface{}
+
+    for _, t := range p.TLVs {
+        if t.Type != OrgSpecific {
+            continue
+        }
+
+        o, err := ParseOrg(t.Value)
+        if err != nil || o.OUI != oui || o.Subtype != subtype {
+            continue
+        }
+
+        v, err := o.Decode()
+        if err == nil {
+            values = append(values, v)
+        }
+    }
+
+    return values
+}
+
+// Return the address as an IP address, or nil if it's not an IPv4 or IPv6
+// address.
+func (a *MgmtAddress) IP() net.IP {
+    return address_ip(append([]byte{ a.Family }, a.Addr...))
+}
+
+func (c Capability) String() string {
+    var caps []string
+
+    names := []string{
+        "other", "repeater", "bridge", "wlan-ap", "router", "telephone",
+        "docsis", "station", "c-vlan", "s-vlan", "tpmr",
+    }
+
+    for i, name := range names {
+        if c & (1 << uint(i)) != 0 {
+            caps = append(caps, name)
+        }
+    }
+
+    return strings.Join(caps, "|")
+}
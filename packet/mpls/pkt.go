@@ -0,0 +1,261 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+// Provides encoding and decoding for MPLS label stacks (RFC 3032), including
+// the pseudowire control word (RFC 4385) used by Ethernet pseudowires.
+package mpls
+
+import "fmt"
+import "strings"
+
+import "github.com/ghedo/go.pkt/packet"
+
+type Packet struct {
+    Labels      Stack
+    HasCW       bool          `string:"skip"`
+    CW          uint32        `string:"cw"`
+    pl_type     packet.Type   `cmp:"skip" string:"skip"`
+    pkt_payload packet.Packet `cmp:"skip" string:"skip"`
+}
+
+// Label is a single MPLS label stack entry.
+type Label struct {
+    Label  uint32
+    TC     uint8
+    Bottom bool
+    TTL    uint8
+}
+
+// Stack is a list of label stack entries, with the outermost label first.
+type Stack []Label
+
+// Reserved label values.
+const (
+    IPv4Null   uint32 = 0
+    RouterAlert       = 1
+    IPv6Null          = 2
+    ImplicitNull      = 3
+    EntropyInd        = 7
+    GAL               = 13
+    OAMAlert          = 14
+)
+
+func Make() *Packet {
+    return &Packet{ }
+}
+
+func (p *Packet) GetType() packet.Type {
+    return packet.MPLS
+}
+
+func (p *Packet) GetLength() uint16 {
+    length := uint16(len(p.Labels) * 4)
+
+    if p.HasCW {
+        length += 4
+    }
+
+    if p.pkt_payload != nil {
+        length += p.pkt_payload.GetLength()
+    }
+
+    return length
+}
+
+func (p *Packet) Equals(other packet.Packet) bool {
+    return packet.Compare(p, other)
+}
+
+func (p *Packet) Answers(other packet.Packet) bool {
+    if other == nil || other.GetType() != packet.MPLS {
+        return false
+    }
+
+    if p.Payload() != nil {
+        return p.Payload().Answers(other.Payload())
+    }
+
+    return true
+}
+
+func (p *Packet) Pack(buf *packet.Buffer) error {
+    if len(p.Labels) == 0 {
+        return fmt.Errorf("Empty MPLS label stack")
+    }
+
+    for i, l := range p.Labels {
+        entry := l.Label << 12 | uint32(l.TC & 0x07) << 9 | uint32(l.TTL)
+
+        if l.Bottom || i == len(p.Labels) - 1 {
+            entry |= 0x100
+        }
+
+        buf.WriteN(entry)
+    }
+
+    if p.HasCW {
+        buf.WriteN(p.CW)
+    }
+
+    return nil
+}
+
+func (p *Packet) Unpack(buf *packet.Buffer) error {
+    p.Labels = nil
+
+    for {
+        if buf.Len() < 4 {
+            return fmt.Errorf("Invalid MPLS label stack")
+        }
+
+        var entry uint32
+        buf.ReadN(&entry)
+
+        l := Label{
+            Label:  entry >> 12,
+            TC:     uint8(entry >> 9) & 0x07,
+            Bottom: entry & 0x100 != 0,
+            TTL:    uint8(entry),
+        }
+
+        p.Labels = append(p.Labels, l)
+
+        if l.Bottom {
+            break
+        }
+    }
+
+    p.HasCW   = false
+    p.pl_type = packet.None
+
+    if buf.Len() <= 0 {
+        return nil
+    }
+
+    /* there's no payload type field, so guess it from the bottom label and
+     * the first nibble after the label stack */
+    switch p.Labels[len(p.Labels) - 1].Label {
+    case IPv4Null:
+        p.pl_type = packet.IPv4
+        return nil
+
+    case IPv6Null:
+        p.pl_type = packet.IPv6
+        return nil
+    }
+
+    switch buf.Bytes()[0] >> 4 {
+    case 4:
+        p.pl_type = packet.IPv4
+
+    case 6:
+        p.pl_type = packet.IPv6
+
+    case 0:
+        if buf.Len() >= 4 {
+            buf.ReadN(&p.CW)
+            p.HasCW   = true
+            p.pl_type = packet.Eth
+        }
+
+    default:
+        p.pl_type = packet.Raw
+    }
+
+    return nil
+}
+
+func (p *Packet) Payload() packet.Packet {
+    return p.pkt_payload
+}
+
+func (p *Packet) GuessPayloadType() packet.Type {
+    return p.pl_type
+}
+
+func (p *Packet) SetPayload(pl packet.Packet) error {
+    p.pkt_payload = pl
+    p.pl_type     = pl.GetType()
+
+    /* Ethernet pseudowires need the control word to be detected */
+    if pl.GetType() == packet.Eth {
+        p.HasCW = true
+    }
+
+    return nil
+}
+
+func (p *Packet) InitChecksum(csum uint32) {
+}
+
+func (p *Packet) String() string {
+    return packet.Stringify(p)
+}
+
+// Push a new label on top of the stack.
+func (p *Packet) Push(label uint32, tc uint8, ttl uint8) {
+    l := Label{ Label: label, TC: tc, TTL: ttl }
+
+    p.Labels = append(Stack{ l }, p.Labels...)
+}
+
+// Return the sequence number carried by the pseudowire control word.
+func (p *Packet) Sequence() uint16 {
+    return uint16(p.CW)
+}
+
+func (l Label) Equal(other Label) bool {
+    return l == other
+}
+
+func (s Stack) Equal(other Stack) bool {
+    if len(s) != len(other) {
+        return false
+    }
+
+    for i := range s {
+        if s[i] != other[i] {
+            return false
+        }
+    }
+
+    return true
+}
+
+func (s Stack) String() string {
+    var labels []string
+
+    for _, l := range s {
+        labels = append(labels,
+                        fmt.Sprintf("%d/%d/%d", l.Label, l.TC, l.TTL))
+    }
+
+    return strings.Join(labels, ",")
+}
@@ -0,0 +1,209 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package mpls_test
+
+import "bytes"
+import "net"
+import "testing"
+
+import "github.com/ghedo/go.pkt/layers"
+import "github.com/ghedo/go.pkt/packet"
+import "github.com/ghedo/go.pkt/packet/eth"
+import "github.com/ghedo/go.pkt/packet/icmpv4"
+import "github.com/ghedo/go.pkt/packet/ipv4"
+import "github.com/ghedo/go.pkt/packet/ipv6"
+import "github.com/ghedo/go.pkt/packet/mpls"
+
+var test_simple = []byte{
+    0x03, 0xe8, 0x00, 0x40, 0x00, 0x06, 0x4b, 0xff,
+}
+
+func MakeTestSimple() *mpls.Packet {
+    return &mpls.Packet{
+        Labels: mpls.Stack{
+            { Label: 16000, TTL: 64 },
+            { Label: 100, TC: 5, Bottom: true, TTL: 255 },
+        },
+    }
+}
+
+func TestPack(t *testing.T) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_simple)))
+
+    p := MakeTestSimple()
+
+    err := p.Pack(&b)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if !bytes.Equal(test_simple, b.Buffer()) {
+        t.Fatalf("Raw packet mismatch: %x", b.Buffer())
+    }
+}
+
+func BenchmarkPack(bn *testing.B) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_simple)))
+
+    p := MakeTestSimple()
+
+    for n := 0; n < bn.N; n++ {
+        p.Pack(&b)
+    }
+}
+
+func TestUnpack(t *testing.T) {
+    var p mpls.Packet
+
+    cmp := MakeTestSimple()
+
+    var b packet.Buffer
+    b.Init(test_simple)
+
+    err := p.Unpack(&b)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if !p.Equals(cmp) {
+        t.Fatalf("Packet mismatch:\n%s\n%s", &p, cmp)
+    }
+}
+
+func BenchmarkUnpack(bn *testing.B) {
+    var p mpls.Packet
+    var b packet.Buffer
+
+    for n := 0; n < bn.N; n++ {
+        b.Init(test_simple)
+        p.Unpack(&b)
+    }
+}
+
+func TestUnpackTruncated(t *testing.T) {
+    var p mpls.Packet
+
+    var b packet.Buffer
+    b.Init(test_simple[:4])
+
+    err := p.Unpack(&b)
+    if err == nil {
+        t.Fatalf("Truncated stack unpacked: %s", &p)
+    }
+}
+
+func make_eth() *eth.Packet {
+    eth_pkt := eth.Make()
+    eth_pkt.SrcAddr, _ = net.ParseMAC("4c:72:b9:54:e5:3d")
+    eth_pkt.DstAddr, _ = net.ParseMAC("1f:92:2b:56:ed:77")
+
+    return eth_pkt
+}
+
+func make_ipv4() *ipv4.Packet {
+    ip4_pkt := ipv4.Make()
+    ip4_pkt.SrcAddr = net.ParseIP("192.168.1.2")
+    ip4_pkt.DstAddr = net.ParseIP("192.168.1.1")
+
+    return ip4_pkt
+}
+
+func check_inner(t *testing.T, buf []byte, layer packet.Type) packet.Packet {
+    pkt, err := layers.UnpackAll(buf, packet.Eth)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    mpls_pkt := layers.FindLayer(pkt, packet.MPLS)
+    if mpls_pkt == nil || mpls_pkt.Payload() == nil ||
+       mpls_pkt.Payload().GetType() != layer {
+        t.Fatalf("Inner packet mismatch: %s", pkt)
+    }
+
+    return mpls_pkt
+}
+
+func TestInnerIPv4(t *testing.T) {
+    mpls_pkt := mpls.Make()
+    mpls_pkt.Push(100, 0, 64)
+    mpls_pkt.Push(16000, 0, 64)
+
+    buf, err := layers.Pack(make_eth(), mpls_pkt, make_ipv4(), icmpv4.Make())
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    pkt := check_inner(t, buf, packet.IPv4)
+
+    labels := pkt.(*mpls.Packet).Labels
+    if len(labels) != 2 || labels[0].Label != 16000 || !labels[1].Bottom {
+        t.Fatalf("Label stack mismatch: %s", labels)
+    }
+}
+
+func TestInnerIPv6Null(t *testing.T) {
+    mpls_pkt := mpls.Make()
+    mpls_pkt.Push(mpls.IPv6Null, 0, 64)
+
+    ip6_pkt := ipv6.Make()
+    ip6_pkt.SrcAddr = net.ParseIP("fe80::1")
+    ip6_pkt.DstAddr = net.ParseIP("fe80::2")
+
+    buf, err := layers.Pack(make_eth(), mpls_pkt, ip6_pkt)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    check_inner(t, buf, packet.IPv6)
+}
+
+func TestInnerPseudowire(t *testing.T) {
+    mpls_pkt := mpls.Make()
+    mpls_pkt.Push(200, 0, 255)
+    mpls_pkt.CW = 0x0000002a
+
+    buf, err := layers.Pack(make_eth(), mpls_pkt, make_eth(), make_ipv4())
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    pkt := check_inner(t, buf, packet.Eth)
+
+    if pkt.(*mpls.Packet).Sequence() != 42 {
+        t.Fatalf("Control word mismatch: %s", pkt)
+    }
+
+    if layers.FindLayer(pkt, packet.IPv4) == nil {
+        t.Fatalf("Inner IPv4 packet not found: %s", pkt)
+    }
+}
@@ -0,0 +1,222 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package ntp
+
+import "fmt"
+import "strconv"
+import "strings"
+
+import "github.com/ghedo/go.pkt/packet"
+
+type ControlOp uint8
+
+const (
+    ReadStatus     ControlOp = 1
+    ReadVariables            = 2
+    WriteVariables           = 3
+    ReadClock                = 4
+    WriteClock               = 5
+    SetTrap                  = 6
+    AsyncMsg                 = 7
+    Configure                = 8
+    SaveConfig               = 9
+    ReadMRU                  = 10
+    ReadOrdList              = 11
+    RequestNonce             = 12
+    UnsetTrap                = 31
+)
+
+// Make a new control request with the given opcode and sequence number, as
+// sent by ntpq.
+func MakeControl(op ControlOp, seq uint16) *Packet {
+    return &Packet{
+        Version: 2,
+        Mode: Control,
+        Opcode: op,
+        Sequence: seq,
+    }
+}
+
+func (p *Packet) pack_control(buf *packet.Buffer) error {
+    if p.Opcode > 0x1f {
+        return fmt.Errorf("Invalid control opcode %d", p.Opcode)
+    }
+
+    if len(p.Data) > 0xffff {
+        return fmt.Errorf("Invalid control data length %d", len(p.Data))
+    }
+
+    flags := uint8(p.Opcode)
+
+    if p.Response {
+        flags |= 0x80
+    }
+
+    if p.Error {
+        flags |= 0x40
+    }
+
+    if p.More {
+        flags |= 0x20
+    }
+
+    buf.WriteN(flags)
+    buf.WriteN(p.Sequence)
+    buf.WriteN(p.Status)
+    buf.WriteN(p.AssocID)
+    buf.WriteN(p.Offset)
+    buf.WriteN(uint16(len(p.Data)))
+    buf.Write(p.Data)
+    write_padding(buf, len(p.Data))
+
+    p.pack_mac(buf)
+
+    return nil
+}
+
+func (p *Packet) unpack_control(buf *packet.Buffer) error {
+    if buf.Len() < 11 {
+        return fmt.Errorf("Invalid control message length %d", buf.Len() + 1)
+    }
+
+    var flags uint8
+    var count uint16
+
+    buf.ReadN(&flags)
+    buf.ReadN(&p.Sequence)
+    buf.ReadN(&p.Status)
+    buf.ReadN(&p.AssocID)
+    buf.ReadN(&p.Offset)
+    buf.ReadN(&count)
+
+    p.Response = flags & 0x80 != 0
+    p.Error    = flags & 0x40 != 0
+    p.More     = flags & 0x20 != 0
+    p.Opcode   = ControlOp(flags & 0x1f)
+
+    if buf.Len() < int(count) {
+        return fmt.Errorf("Invalid control data length %d", count)
+    }
+
+    p.Data = nil
+
+    if count > 0 {
+        p.Data = buf.Next(int(count))
+    }
+
+    /* the data is padded to 32 bits, and possibly followed by a MAC */
+    buf.Next(pad4(int(count)) - int(count))
+
+    p.KeyID  = 0
+    p.Digest = nil
+
+    if buf.Len() == 20 || buf.Len() == 24 {
+        return p.unpack_mac(buf)
+    }
+
+    return nil
+}
+
+// Decode the "name=value" list carried by read variables and read status
+// responses. Quoted values are unquoted.
+func (p *Packet) Variables() (map[string]string, error) {
+    vars := map[string]string{}
+
+    data := strings.TrimRight(string(p.Data), "\x00\r\n")
+
+    for len(data) > 0 {
+        var item string
+
+        item, data = split_variable(data)
+
+        item = strings.TrimSpace(item)
+        if item == "" {
+            continue
+        }
+
+        name, value := item, ""
+
+        if i := strings.IndexByte(item, '='); i >= 0 {
+            name  = strings.TrimSpace(item[:i])
+            value = strings.TrimSpace(item[i + 1:])
+        }
+
+        if strings.HasPrefix(value, "\"") {
+            unquoted, err := strconv.Unquote(value)
+            if err != nil {
+                return nil, fmt.Errorf("Invalid variable %s", name)
+            }
+
+            value = unquoted
+        }
+
+        vars[name] = value
+    }
+
+    return vars, nil
+}
+
+/* split the first item of a comma separated list, ignoring quoted commas */
+func split_variable(data string) (string, string) {
+    quoted := false
+
+    for i := 0; i < len(data); i++ {
+        switch {
+        case data[i] == '"':
+            quoted = !quoted
+
+        case data[i] == ',' && !quoted:
+            return data[:i], data[i + 1:]
+        }
+    }
+
+    return data, ""
+}
+
+func (op ControlOp) String() string {
+    switch op {
+    case ReadStatus:     return "readstat"
+    case ReadVariables:  return "readvar"
+    case WriteVariables: return "writevar"
+    case ReadClock:      return "readclock"
+    case WriteClock:     return "writeclock"
+    case SetTrap:        return "settrap"
+    case AsyncMsg:       return "asyncmsg"
+    case Configure:      return "config"
+    case SaveConfig:     return "saveconfig"
+    case ReadMRU:        return "readmru"
+    case ReadOrdList:    return "readordlist"
+    case RequestNonce:   return "reqnonce"
+    case UnsetTrap:      return "unsettrap"
+    case 0:              return ""
+    default:             return fmt.Sprintf("%d", uint8(op))
+    }
+}
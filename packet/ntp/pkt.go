@@ -0,0 +1,431 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+// Provides encoding and decoding for NTP (RFC 1305, RFC 5905) packets,
+// including NTPv4 extension fields (RFC 7822) and control messages (mode 6).
+package ntp
+
+import "bytes"
+import "fmt"
+import "net"
+import "strings"
+import "time"
+
+import "github.com/ghedo/go.pkt/packet"
+
+type Packet struct {
+    Leap           Leap          `string:"leap"`
+    Version        uint8         `string:"ver"`
+    Mode           Mode          `string:"mode"`
+    Stratum        uint8
+    Poll           int8
+    Precision      int8          `string:"prec"`
+    RootDelay      time.Duration `string:"rootdelay"`
+    RootDispersion time.Duration `string:"rootdisp"`
+    RefID          RefID         `string:"refid"`
+    RefTime        Timestamp     `string:"ref"`
+    OrigTime       Timestamp     `string:"org"`
+    RecvTime       Timestamp     `string:"rec"`
+    XmitTime       Timestamp     `string:"xmt"`
+    Extensions     Extensions    `string:"ext"`
+    Response       bool          `string:"r"`
+    Error          bool          `string:"e"`
+    More           bool          `string:"m"`
+    Opcode         ControlOp     `string:"op"`
+    Sequence       uint16        `string:"seq"`
+    Status         uint16
+    AssocID        uint16        `string:"assoc"`
+    Offset         uint16
+    Data           []byte        `string:"skip"`
+    KeyID          uint32        `string:"keyid"`
+    Digest         []byte        `string:"skip"`
+}
+
+type Leap uint8
+
+const (
+    LeapNone    Leap = 0
+    LeapInsert       = 1
+    LeapDelete       = 2
+    LeapUnknown      = 3
+)
+
+type Mode uint8
+
+const (
+    Reserved         Mode = 0
+    SymmetricActive       = 1
+    SymmetricPassive      = 2
+    Client                = 3
+    Server                = 4
+    Broadcast             = 5
+    Control               = 6
+    Private               = 7
+)
+
+// Reference identifier. Primary servers use it for a four character ASCII code
+// identifying the reference clock (kiss codes for stratum 0), while secondary
+// servers use it for the IPv4 address of their upstream server (or the hash of
+// its IPv6 address).
+type RefID [4]byte
+
+// Extension field (RFC 7822). The value includes any trailing padding.
+type Extension struct {
+    Type  uint16
+    Value []byte
+}
+
+type Extensions []Extension
+
+// Make a new NTPv4 client request. The transmit timestamp should be set to the
+// time the request is sent.
+func Make() *Packet {
+    return &Packet{
+        Version: 4,
+        Mode: Client,
+    }
+}
+
+func (p *Packet) GetType() packet.Type {
+    return packet.NTP
+}
+
+func (p *Packet) GetLength() uint16 {
+    switch p.Mode {
+    case Control:
+        return uint16(12 + pad4(len(p.Data)) + p.mac_len())
+
+    case Private:
+        return uint16(1 + len(p.Data))
+
+    default:
+        length := 48 + p.mac_len()
+
+        for _, e := range p.Extensions {
+            length += 4 + pad4(len(e.Value))
+        }
+
+        return uint16(length)
+    }
+}
+
+func (p *Packet) mac_len() int {
+    if p.Digest == nil {
+        return 0
+    }
+
+    return 4 + len(p.Digest)
+}
+
+func (p *Packet) Equals(other packet.Packet) bool {
+    return packet.Compare(p, other)
+}
+
+// Check if the packet is an answer to another packet. Server (and symmetric
+// passive) responses answer the request whose transmit timestamp they echo as
+// origin timestamp, while control responses answer the request with the same
+// opcode and sequence number.
+func (p *Packet) Answers(other packet.Packet) bool {
+    if other == nil || other.GetType() != packet.NTP {
+        return false
+    }
+
+    req := other.(*Packet)
+
+    switch p.Mode {
+    case Server:
+        return req.Mode == Client && p.OrigTime == req.XmitTime
+
+    case SymmetricPassive:
+        return req.Mode == SymmetricActive && p.OrigTime == req.XmitTime
+
+    case Control:
+        return req.Mode == Control && p.Response && !req.Response &&
+               p.Opcode == req.Opcode && p.Sequence == req.Sequence
+
+    default:
+        return false
+    }
+}
+
+func (p *Packet) Pack(buf *packet.Buffer) error {
+    buf.WriteN(uint8(p.Leap) << 6 | (p.Version & 0x7) << 3 | uint8(p.Mode))
+
+    switch p.Mode {
+    case Control:
+        return p.pack_control(buf)
+
+    case Private:
+        buf.Write(p.Data)
+        return nil
+    }
+
+    buf.WriteN(p.Stratum)
+    buf.WriteN(p.Poll)
+    buf.WriteN(p.Precision)
+    buf.WriteN(duration_to_short(p.RootDelay))
+    buf.WriteN(duration_to_short(p.RootDispersion))
+    buf.Write(p.RefID[:])
+    buf.WriteN(p.RefTime)
+    buf.WriteN(p.OrigTime)
+    buf.WriteN(p.RecvTime)
+    buf.WriteN(p.XmitTime)
+
+    for _, e := range p.Extensions {
+        length := 4 + pad4(len(e.Value))
+        if length > 0xffff {
+            return fmt.Errorf("Invalid extension field length %d", length)
+        }
+
+        buf.WriteN(e.Type)
+        buf.WriteN(uint16(length))
+        buf.Write(e.Value)
+        write_padding(buf, len(e.Value))
+    }
+
+    p.pack_mac(buf)
+
+    return nil
+}
+
+func (p *Packet) pack_mac(buf *packet.Buffer) {
+    if p.Digest != nil {
+        buf.WriteN(p.KeyID)
+        buf.Write(p.Digest)
+    }
+}
+
+func (p *Packet) Unpack(buf *packet.Buffer) error {
+    if buf.Len() < 1 {
+        return fmt.Errorf("Invalid NTP packet length %d", buf.Len())
+    }
+
+    var flags uint8
+    buf.ReadN(&flags)
+
+    p.Leap    = Leap(flags >> 6)
+    p.Version = (flags >> 3) & 0x7
+    p.Mode    = Mode(flags & 0x7)
+
+    if p.Version < 1 || p.Version > 4 {
+        return fmt.Errorf("Invalid NTP version %d", p.Version)
+    }
+
+    switch p.Mode {
+    case Control:
+        return p.unpack_control(buf)
+
+    case Private:
+        p.Data = buf.Next(buf.Len())
+        return nil
+    }
+
+    if buf.Len() < 47 {
+        return fmt.Errorf("Invalid NTP packet length %d", buf.Len() + 1)
+    }
+
+    var root_delay, root_disp uint32
+
+    buf.ReadN(&p.Stratum)
+    buf.ReadN(&p.Poll)
+    buf.ReadN(&p.Precision)
+    buf.ReadN(&root_delay)
+    buf.ReadN(&root_disp)
+    copy(p.RefID[:], buf.Next(4))
+    buf.ReadN(&p.RefTime)
+    buf.ReadN(&p.OrigTime)
+    buf.ReadN(&p.RecvTime)
+    buf.ReadN(&p.XmitTime)
+
+    p.RootDelay      = short_to_duration(root_delay)
+    p.RootDispersion = short_to_duration(root_disp)
+
+    p.Extensions = nil
+    p.KeyID      = 0
+    p.Digest     = nil
+
+    for buf.Len() > 0 {
+        /*
+         * A MAC is 4 (crypto-NAK), 20 or 24 bytes long, while the
+         * extension fields before it are at least 16 bytes long (RFC
+         * 7822). NTPv3 packets only carry a MAC.
+         */
+        rem := buf.Len()
+
+        if p.Version < 4 || rem == 4 || rem == 20 || rem == 24 {
+            return p.unpack_mac(buf)
+        }
+
+        if rem < 16 {
+            return fmt.Errorf("Invalid extension field length %d", rem)
+        }
+
+        var ext_type, ext_len uint16
+        buf.ReadN(&ext_type)
+        buf.ReadN(&ext_len)
+
+        if ext_len < 4 || ext_len % 4 != 0 || int(ext_len) > rem {
+            return fmt.Errorf("Invalid extension field length %d", ext_len)
+        }
+
+        p.Extensions = append(p.Extensions, Extension{
+            Type:  ext_type,
+            Value: buf.Next(int(ext_len) - 4),
+        })
+    }
+
+    return nil
+}
+
+func (p *Packet) unpack_mac(buf *packet.Buffer) error {
+    if buf.Len() < 4 {
+        return fmt.Errorf("Invalid MAC length %d", buf.Len())
+    }
+
+    buf.ReadN(&p.KeyID)
+    p.Digest = buf.Next(buf.Len())
+
+    return nil
+}
+
+func (p *Packet) Payload() packet.Packet {
+    return nil
+}
+
+func (p *Packet) GuessPayloadType() packet.Type {
+    return packet.None
+}
+
+func (p *Packet) SetPayload(pl packet.Packet) error {
+    return nil
+}
+
+func (p *Packet) InitChecksum(csum uint32) {
+}
+
+func (p *Packet) String() string {
+    return packet.Stringify(p)
+}
+
+// Return the kiss code of kiss-o'-death packets (e.g. "RATE", "DENY"), or an
+// empty string.
+func (p *Packet) KissCode() string {
+    if p.Mode == Control || p.Mode == Private || p.Stratum != 0 {
+        return ""
+    }
+
+    return p.RefID.ASCII()
+}
+
+// Return the reference ID as ASCII code, or an empty string if it's not
+// printable.
+func (r RefID) ASCII() string {
+    code := bytes.TrimRight(r[:], "\x00")
+
+    if len(code) == 0 {
+        return ""
+    }
+
+    for _, c := range code {
+        if c < 0x20 || c > 0x7e {
+            return ""
+        }
+    }
+
+    return string(code)
+}
+
+func (r RefID) String() string {
+    if r == (RefID{}) {
+        return ""
+    }
+
+    if code := r.ASCII(); code != "" {
+        return code
+    }
+
+    return net.IP(r[:]).String()
+}
+
+func (e Extension) Equal(other Extension) bool {
+    return e.Type == other.Type && bytes.Equal(e.Value, other.Value)
+}
+
+func (e Extension) String() string {
+    return fmt.Sprintf("0x%04x=%x", e.Type, e.Value)
+}
+
+func (exts Extensions) String() string {
+    if len(exts) == 0 {
+        return ""
+    }
+
+    var s []string
+
+    for _, e := range exts {
+        s = append(s, e.String())
+    }
+
+    return "[" + strings.Join(s, " ") + "]"
+}
+
+func pad4(n int) int {
+    return (n + 3) &^ 3
+}
+
+func write_padding(buf *packet.Buffer, n int) {
+    for i := n; i < pad4(n); i++ {
+        buf.WriteN(uint8(0))
+    }
+}
+
+func (l Leap) String() string {
+    switch l {
+    case LeapNone:    return ""
+    case LeapInsert:  return "+1s"
+    case LeapDelete:  return "-1s"
+    case LeapUnknown: return "unsync"
+    default:          return fmt.Sprintf("%d", uint8(l))
+    }
+}
+
+func (m Mode) String() string {
+    switch m {
+    case Reserved:         return "reserved"
+    case SymmetricActive:  return "sym-active"
+    case SymmetricPassive: return "sym-passive"
+    case Client:           return "client"
+    case Server:           return "server"
+    case Broadcast:        return "broadcast"
+    case Control:          return "control"
+    case Private:          return "private"
+    default:               return fmt.Sprintf("%d", uint8(m))
+    }
+}
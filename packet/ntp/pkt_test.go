@@ -0,0 +1,325 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package ntp_test
+
+import "bytes"
+import "net"
+import "testing"
+import "time"
+
+import "github.com/ghedo/go.pkt/layers"
+import "github.com/ghedo/go.pkt/packet"
+import "github.com/ghedo/go.pkt/packet/ipv4"
+import "github.com/ghedo/go.pkt/packet/ntp"
+import "github.com/ghedo/go.pkt/packet/udp"
+
+var test_simple = []byte{
+    0x24, 0x02, 0x06, 0xe9, 0x00, 0x00, 0x01, 0x00,
+    0x00, 0x00, 0x02, 0x00, 0xc0, 0x00, 0x02, 0x01,
+    0xe1, 0xf2, 0xa3, 0xb4, 0x00, 0x00, 0x00, 0x00,
+    0xe1, 0xf2, 0xa4, 0x00, 0x80, 0x00, 0x00, 0x00,
+    0xe1, 0xf2, 0xa4, 0x00, 0x80, 0x80, 0x00, 0x00,
+    0xe1, 0xf2, 0xa4, 0x00, 0x80, 0x90, 0x00, 0x00,
+}
+
+func MakeTestSimple() *ntp.Packet {
+    return &ntp.Packet{
+        Version: 4,
+        Mode: ntp.Server,
+        Stratum: 2,
+        Poll: 6,
+        Precision: -23,
+        RootDelay: 3906250 * time.Nanosecond,
+        RootDispersion: 7812500 * time.Nanosecond,
+        RefID: ntp.RefID{ 192, 0, 2, 1 },
+        RefTime: 0xe1f2a3b400000000,
+        OrigTime: 0xe1f2a40080000000,
+        RecvTime: 0xe1f2a40080800000,
+        XmitTime: 0xe1f2a40080900000,
+    }
+}
+
+func TestPack(t *testing.T) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_simple)))
+
+    p := MakeTestSimple()
+
+    err := p.Pack(&b)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if !bytes.Equal(test_simple, b.Buffer()) {
+        t.Fatalf("Raw packet mismatch: %x", b.Buffer())
+    }
+}
+
+func BenchmarkPack(bn *testing.B) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_simple)))
+
+    p := MakeTestSimple()
+
+    for n := 0; n < bn.N; n++ {
+        p.Pack(&b)
+    }
+}
+
+func TestUnpack(t *testing.T) {
+    var p ntp.Packet
+
+    cmp := MakeTestSimple()
+
+    var b packet.Buffer
+    b.Init(test_simple)
+
+    err := p.Unpack(&b)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if !p.Equals(cmp) {
+        t.Fatalf("Packet mismatch:\n%s\n%s", &p, cmp)
+    }
+
+    if p.RefID.String() != "192.0.2.1" {
+        t.Fatalf("Reference ID mismatch: %s", p.RefID)
+    }
+}
+
+func BenchmarkUnpack(bn *testing.B) {
+    var p ntp.Packet
+    var b packet.Buffer
+
+    for n := 0; n < bn.N; n++ {
+        b.Init(test_simple)
+        p.Unpack(&b)
+    }
+}
+
+func pack_unpack(t *testing.T, p *ntp.Packet) *ntp.Packet {
+    buf := make([]byte, p.GetLength())
+
+    var b packet.Buffer
+    b.Init(buf)
+
+    err := p.Pack(&b)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    var p2 ntp.Packet
+    b.Init(buf)
+
+    err = p2.Unpack(&b)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if !p2.Equals(p) {
+        t.Fatalf("Packet mismatch:\n%s\n%s", &p2, p)
+    }
+
+    return &p2
+}
+
+func TestInvalidVersion(t *testing.T) {
+    for _, flags := range []uint8{ 0x07, 0xff } {
+        var p ntp.Packet
+
+        var b packet.Buffer
+        b.Init([]byte{ flags, 0xff, 0xff })
+
+        err := p.Unpack(&b)
+        if err == nil {
+            t.Fatalf("Invalid version accepted: %s", &p)
+        }
+    }
+}
+
+func TestExtensions(t *testing.T) {
+    p := MakeTestSimple()
+    p.Extensions = ntp.Extensions{
+        { Type: 0x0104, Value: bytes.Repeat([]byte{ 0x11 }, 32) },
+        { Type: 0x0204, Value: bytes.Repeat([]byte{ 0x22 }, 12) },
+    }
+    p.KeyID  = 1
+    p.Digest = bytes.Repeat([]byte{ 0xaa }, 16)
+
+    if p.GetLength() != 48 + 36 + 16 + 20 {
+        t.Fatalf("Length mismatch: %d", p.GetLength())
+    }
+
+    pack_unpack(t, p)
+
+    /* crypto-NAK */
+    p.Extensions = nil
+    p.KeyID      = 0
+    p.Digest     = []byte{}
+
+    pack_unpack(t, p)
+
+    /* NTPv3 packets only carry a MAC */
+    p.Version = 3
+    p.KeyID   = 2
+    p.Digest  = bytes.Repeat([]byte{ 0xbb }, 20)
+
+    pack_unpack(t, p)
+}
+
+func TestKissCode(t *testing.T) {
+    p := MakeTestSimple()
+    p.Stratum = 0
+    p.RefID   = ntp.RefID{ 'R', 'A', 'T', 'E' }
+
+    if p.KissCode() != "RATE" {
+        t.Fatalf("Kiss code mismatch: %s", p.KissCode())
+    }
+
+    p.Stratum = 1
+    p.RefID   = ntp.RefID{ 'G', 'P', 'S', 0 }
+
+    if p.KissCode() != "" || p.RefID.String() != "GPS" {
+        t.Fatalf("Reference ID mismatch: %s", p.RefID)
+    }
+}
+
+func TestControl(t *testing.T) {
+    req := ntp.MakeControl(ntp.ReadVariables, 7)
+
+    if req.GetLength() != 12 {
+        t.Fatalf("Length mismatch: %d", req.GetLength())
+    }
+
+    pack_unpack(t, req)
+
+    rsp := ntp.MakeControl(ntp.ReadVariables, 7)
+    rsp.Response = true
+    rsp.Status   = 0x0618
+    rsp.Data     = []byte(`version="ntpd 4.2.8p15, Linux", stratum=2, ` +
+                          `refid=192.0.2.1, offset=-0.125`)
+
+    rsp.KeyID  = 1
+    rsp.Digest = bytes.Repeat([]byte{ 0xaa }, 16)
+
+    rsp = pack_unpack(t, rsp)
+
+    if !rsp.Answers(req) || req.Answers(rsp) {
+        t.Fatalf("Control response doesn't answer request")
+    }
+
+    vars, err := rsp.Variables()
+    if err != nil {
+        t.Fatalf("Error decoding variables: %s", err)
+    }
+
+    if len(vars) != 4 || vars["version"] != "ntpd 4.2.8p15, Linux" ||
+       vars["offset"] != "-0.125" {
+        t.Fatalf("Variables mismatch: %v", vars)
+    }
+}
+
+func TestTimestamp(t *testing.T) {
+    now := time.Date(2019, time.December, 4, 13, 24, 54, 123456789, time.UTC)
+
+    ts := ntp.MakeTimestamp(now)
+    if ts >> 32 != 3784454694 || !ts.Time().Equal(now) {
+        t.Fatalf("Timestamp mismatch: %x %s", uint64(ts), ts)
+    }
+
+    /* era 1 */
+    future := time.Date(2040, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+    if !ntp.MakeTimestamp(future).Time().Equal(future) {
+        t.Fatalf("Timestamp mismatch: %s", ntp.MakeTimestamp(future))
+    }
+
+    if ts.Sub(ntp.MakeTimestamp(now.Add(time.Second))) != -time.Second {
+        t.Fatalf("Difference mismatch")
+    }
+}
+
+func TestOffsetDelay(t *testing.T) {
+    t1 := time.Date(2019, time.December, 4, 13, 24, 54, 0, time.UTC)
+
+    req := ntp.Make()
+    req.XmitTime = ntp.MakeTimestamp(t1)
+
+    /* the server is 1s ahead, each way takes 10ms, processing 1ms */
+    rsp := MakeTestSimple()
+    rsp.OrigTime = req.XmitTime
+    rsp.RecvTime = ntp.MakeTimestamp(t1.Add(1010 * time.Millisecond))
+    rsp.XmitTime = ntp.MakeTimestamp(t1.Add(1011 * time.Millisecond))
+
+    offset, delay, err := ntp.OffsetDelay(req, rsp, t1.Add(21 * time.Millisecond))
+    if err != nil {
+        t.Fatalf("Error computing offset: %s", err)
+    }
+
+    if offset != time.Second || delay != 20 * time.Millisecond {
+        t.Fatalf("Offset/delay mismatch: %s %s", offset, delay)
+    }
+
+    rsp.OrigTime = 0
+
+    _, _, err = ntp.OffsetDelay(req, rsp, t1.Add(21 * time.Millisecond))
+    if err == nil {
+        t.Fatalf("Unmatched response accepted")
+    }
+}
+
+func TestUDP(t *testing.T) {
+    ip4_pkt := ipv4.Make()
+    ip4_pkt.SrcAddr = net.ParseIP("192.0.2.1")
+    ip4_pkt.DstAddr = net.ParseIP("192.0.2.10")
+
+    udp_pkt := udp.Make()
+    udp_pkt.SrcPort = udp.NTP
+    udp_pkt.DstPort = 40000
+
+    ntp_pkt := MakeTestSimple()
+
+    buf, err := layers.Pack(ip4_pkt, udp_pkt, ntp_pkt)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    p, err := layers.UnpackAll(buf, packet.IPv4)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    l := layers.FindLayer(p, packet.NTP)
+    if l == nil || !l.Equals(ntp_pkt) {
+        t.Fatalf("Packet mismatch: %s", p)
+    }
+}
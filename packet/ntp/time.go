@@ -0,0 +1,128 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package ntp
+
+import "fmt"
+import "time"
+
+// NTP timestamp, in 32.32 fixed point format, counting seconds since 1900.
+type Timestamp uint64
+
+/* NTP era 0 starts on January 1, 1900 */
+var ntp_epoch = time.Date(1900, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// Make a new NTP timestamp from the given time.
+func MakeTimestamp(t time.Time) Timestamp {
+    if t.IsZero() {
+        return 0
+    }
+
+    secs := uint32(t.Unix() - ntp_epoch.Unix())
+
+    /* round up so that converting back gives the same time */
+    frac := (uint64(t.Nanosecond()) << 32 + 999999999) / 1000000000
+
+    return Timestamp(uint64(secs) << 32 | frac)
+}
+
+// Return the time of the timestamp. Timestamps with the most significant bit
+// of the seconds unset are assumed to be in era 1 (starting in 2036), as per
+// RFC 4330.
+func (t Timestamp) Time() time.Time {
+    if t == 0 {
+        return time.Time{}
+    }
+
+    secs := int64(t >> 32)
+
+    if secs & 0x80000000 == 0 {
+        secs += 1 << 32
+    }
+
+    nsecs := int64((uint64(t & 0xffffffff) * 1000000000) >> 32)
+
+    return time.Unix(ntp_epoch.Unix() + secs, nsecs).UTC()
+}
+
+// Return the difference between two timestamps, which must be less than 68
+// years apart.
+func (t Timestamp) Sub(u Timestamp) time.Duration {
+    return fixed_to_duration(int64(t - u), 32)
+}
+
+func (t Timestamp) String() string {
+    if t == 0 {
+        return ""
+    }
+
+    return t.Time().Format(time.RFC3339Nano)
+}
+
+// Compute the clock offset of the server relative to the client and the round
+// trip delay from a request, the matching response and the time the response
+// was received (e.g. its capture time), as per RFC 5905.
+func OffsetDelay(req, rsp *Packet, recv time.Time) (time.Duration, time.Duration, error) {
+    if !rsp.Answers(req) {
+        return 0, 0, fmt.Errorf("Response doesn't answer request")
+    }
+
+    t1 := req.XmitTime
+    t2 := rsp.RecvTime
+    t3 := rsp.XmitTime
+    t4 := MakeTimestamp(recv)
+
+    offset := (t2.Sub(t1) + t3.Sub(t4)) / 2
+    delay  := t4.Sub(t1) - t3.Sub(t2)
+
+    return offset, delay, nil
+}
+
+/* convert a signed fixed point value with the given fraction bits */
+func fixed_to_duration(v int64, bits uint) time.Duration {
+    secs := v >> bits
+    frac := uint64(v) & (1 << bits - 1)
+
+    return time.Duration(secs) * time.Second +
+           time.Duration((frac * 1000000000 + 1 << (bits - 1)) >> bits)
+}
+
+/* root delay and dispersion use the 16.16 short format */
+func short_to_duration(v uint32) time.Duration {
+    return fixed_to_duration(int64(v), 16)
+}
+
+func duration_to_short(d time.Duration) uint32 {
+    if d <= 0 {
+        return 0
+    }
+
+    return uint32((uint64(d) << 16 + 500000000) / 1000000000)
+}
@@ -0,0 +1,747 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package ospf
+
+import "bytes"
+import "fmt"
+import "net"
+
+import "github.com/ghedo/go.pkt/packet"
+
+// LSA is a link state advertisement. Database Description and Link State Ack
+// packets only carry the LSA headers, while Link State Update packets carry
+// whole LSAs, whose body fields depend on the LSA type.
+type LSA struct {
+    Age        uint16
+    Type       LSAType
+    LSID       net.IP
+    AdvRouter  net.IP
+    Seq        uint32
+    Checksum   uint16
+    Length     uint16
+
+    /* OSPFv2 header options, OSPFv3 router, network, link and
+     * inter-area-router LSAs options */
+    Options    Options
+
+    /* router LSA flags, external LSA flags (E bit for OSPFv2, E/F/T bits
+     * for OSPFv3) */
+    Flags      uint8
+
+    /* summary, external, inter-area-prefix and inter-area-router LSAs */
+    Mask       net.IP
+    Metric     uint32
+    FwdAddr    net.IP
+    RouteTag   uint32
+    DestRouter net.IP
+
+    /* router and network LSAs */
+    Links      []RouterLink
+    Routers    []net.IP
+
+    /* OSPFv3 link and prefix LSAs */
+    Priority   uint8
+    LinkLocal  net.IP
+    RefType    LSAType
+    RefLSID    net.IP
+    RefRouter  net.IP
+    Prefixes   []Prefix
+
+    /* unsupported LSA types */
+    Data       []byte
+
+    raw        []byte
+}
+
+type LSAType uint16
+
+const (
+    Router          LSAType = 1
+    Network                 = 2
+    Summary                 = 3
+    ASBRSummary             = 4
+    External                = 5
+    NSSA                    = 7
+    RouterV3                = 0x2001
+    NetworkV3               = 0x2002
+    InterAreaPrefix         = 0x2003
+    InterAreaRouter         = 0x2004
+    ExternalV3              = 0x4005
+    NSSAV3                  = 0x2007
+    Link                    = 0x0008
+    IntraAreaPrefix         = 0x2009
+)
+
+// Router LSA flags.
+const (
+    RouterB uint8 = 0x01
+    RouterE       = 0x02
+    RouterV       = 0x04
+)
+
+// OSPFv2 external LSA flags.
+const (
+    ExternalE uint8 = 0x80
+)
+
+// OSPFv3 external LSA flags.
+const (
+    ExternalT uint8 = 0x01
+    ExternalF       = 0x02
+    ExternalV3E     = 0x04
+)
+
+// RouterLink describes a link of a router LSA. ID and Data are only used by
+// OSPFv2, while the interface and neighbor fields are only used by OSPFv3.
+type RouterLink struct {
+    Type           LinkType
+    Metric         uint16
+    ID             net.IP
+    Data           net.IP
+    TOS            []byte
+    InterfaceId    uint32
+    NbrInterfaceId uint32
+    NbrRouterId    net.IP
+}
+
+type LinkType uint8
+
+const (
+    PointToPoint LinkType = 1
+    Transit               = 2
+    Stub                  = 3
+    Virtual               = 4
+)
+
+// Prefix is an IPv6 prefix carried by OSPFv3 LSAs. The Metric field holds the
+// metric of intra-area-prefix and link LSA prefixes, and the referenced LS
+// type of external LSA prefixes.
+type Prefix struct {
+    Length  uint8
+    Options uint8
+    Metric  uint16
+    Addr    net.IP
+}
+
+// Return whether the checksum of a decoded LSA is valid.
+func (l *LSA) ValidChecksum() bool {
+    if len(l.raw) < 20 {
+        return false
+    }
+
+    var c0, c1 int
+
+    for _, b := range l.raw[2:] {
+        c0 = (c0 + int(b)) % 255
+        c1 = (c1 + c0) % 255
+    }
+
+    return c0 == 0 && c1 == 0
+}
+
+// Calculate the Fletcher checksum (ISO 8473) of the given data, with the
+// checksum located at the given offset.
+func Fletcher(data []byte, off int) uint16 {
+    var c0, c1 int
+
+    for i, b := range data {
+        if i == off || i == off + 1 {
+            b = 0
+        }
+
+        c0 = (c0 + int(b)) % 255
+        c1 = (c1 + c0) % 255
+    }
+
+    x := ((len(data) - off - 1) * c0 - c1) % 255
+    if x <= 0 {
+        x += 255
+    }
+
+    y := (510 - c0 - x) % 255
+    if y <= 0 {
+        y += 255
+    }
+
+    return uint16(x << 8 | y)
+}
+
+func (l *LSA) length(version uint8) int {
+    length := 20
+
+    switch l.Type {
+    case Router:
+        length += 4
+
+        for _, link := range l.Links {
+            length += 12 + len(link.TOS)
+        }
+
+    case Network, NetworkV3:
+        length += 4 + 4 * len(l.Routers)
+
+    case Summary, ASBRSummary:
+        length += 8
+
+    case External, NSSA:
+        length += 16
+
+    case RouterV3:
+        length += 4 + 16 * len(l.Links)
+
+    case InterAreaPrefix:
+        length += 4 + prefixes_len(l.Prefixes)
+
+    case InterAreaRouter:
+        length += 12
+
+    case ExternalV3, NSSAV3:
+        length += 4 + prefixes_len(l.Prefixes)
+
+        if l.Flags & ExternalF != 0 {
+            length += 16
+        }
+
+        if l.Flags & ExternalT != 0 {
+            length += 4
+        }
+
+        if l.RefType != 0 {
+            length += 4
+        }
+
+    case Link:
+        length += 24 + prefixes_len(l.Prefixes)
+
+    case IntraAreaPrefix:
+        length += 12 + prefixes_len(l.Prefixes)
+
+    default:
+        length += len(l.Data)
+    }
+
+    return length
+}
+
+func (l *LSA) pack_header(buf *packet.Buffer, version uint8) {
+    buf.WriteN(l.Age)
+
+    if version == 2 {
+        buf.WriteN(uint8(l.Options))
+        buf.WriteN(uint8(l.Type))
+    } else {
+        buf.WriteN(l.Type)
+    }
+
+    buf.Write(addr4(l.LSID))
+    buf.Write(addr4(l.AdvRouter))
+    buf.WriteN(l.Seq)
+    buf.WriteN(l.Checksum)
+    buf.WriteN(l.Length)
+}
+
+func (l *LSA) pack(buf *packet.Buffer, version uint8) {
+    l.Length = uint16(l.length(version))
+
+    l.pack_header(buf, version)
+
+    switch l.Type {
+    case Router:
+        buf.WriteN(l.Flags)
+        buf.WriteN(uint8(0x00))
+        buf.WriteN(uint16(len(l.Links)))
+
+        for _, link := range l.Links {
+            buf.Write(addr4(link.ID))
+            buf.Write(addr4(link.Data))
+            buf.WriteN(link.Type)
+            buf.WriteN(uint8(len(link.TOS) / 4))
+            buf.WriteN(link.Metric)
+            buf.Write(link.TOS)
+        }
+
+    case Network, NetworkV3:
+        if version == 2 {
+            buf.Write(addr4(l.Mask))
+        } else {
+            buf.WriteN(uint32(l.Options) & 0xffffff)
+        }
+
+        for _, r := range l.Routers {
+            buf.Write(addr4(r))
+        }
+
+    case Summary, ASBRSummary:
+        buf.Write(addr4(l.Mask))
+        buf.WriteN(l.Metric & 0xffffff)
+
+    case External, NSSA:
+        buf.Write(addr4(l.Mask))
+        buf.WriteN(uint32(l.Flags) << 24 | l.Metric & 0xffffff)
+        buf.Write(addr4(l.FwdAddr))
+        buf.WriteN(l.RouteTag)
+
+    case RouterV3:
+        buf.WriteN(uint32(l.Flags) << 24 | uint32(l.Options) & 0xffffff)
+
+        for _, link := range l.Links {
+            buf.WriteN(link.Type)
+            buf.WriteN(uint8(0x00))
+            buf.WriteN(link.Metric)
+            buf.WriteN(link.InterfaceId)
+            buf.WriteN(link.NbrInterfaceId)
+            buf.Write(addr4(link.NbrRouterId))
+        }
+
+    case InterAreaPrefix:
+        buf.WriteN(l.Metric & 0xffffff)
+        pack_prefixes(buf, l.Prefixes)
+
+    case InterAreaRouter:
+        buf.WriteN(uint32(l.Options) & 0xffffff)
+        buf.WriteN(l.Metric & 0xffffff)
+        buf.Write(addr4(l.DestRouter))
+
+    case ExternalV3, NSSAV3:
+        buf.WriteN(uint32(l.Flags) << 24 | l.Metric & 0xffffff)
+
+        if len(l.Prefixes) > 0 {
+            l.Prefixes[0].Metric = uint16(l.RefType)
+        }
+
+        pack_prefixes(buf, l.Prefixes)
+
+        if l.Flags & ExternalF != 0 {
+            buf.Write(addr16(l.FwdAddr))
+        }
+
+        if l.Flags & ExternalT != 0 {
+            buf.WriteN(l.RouteTag)
+        }
+
+        if l.RefType != 0 {
+            buf.Write(addr4(l.RefLSID))
+        }
+
+    case Link:
+        buf.WriteN(uint32(l.Priority) << 24 | uint32(l.Options) & 0xffffff)
+        buf.Write(addr16(l.LinkLocal))
+        buf.WriteN(uint32(len(l.Prefixes)))
+        pack_prefixes(buf, l.Prefixes)
+
+    case IntraAreaPrefix:
+        buf.WriteN(uint16(len(l.Prefixes)))
+        buf.WriteN(l.RefType)
+        buf.Write(addr4(l.RefLSID))
+        buf.Write(addr4(l.RefRouter))
+        pack_prefixes(buf, l.Prefixes)
+
+    default:
+        buf.Write(l.Data)
+    }
+}
+
+func (l *LSA) unpack_header(buf *packet.Buffer, version uint8) {
+    buf.ReadN(&l.Age)
+
+    if version == 2 {
+        var opts, lstype uint8
+
+        buf.ReadN(&opts)
+        buf.ReadN(&lstype)
+
+        l.Options = Options(opts)
+        l.Type    = LSAType(lstype)
+    } else {
+        buf.ReadN(&l.Type)
+    }
+
+    l.LSID      = net.IP(buf.Next(4))
+    l.AdvRouter = net.IP(buf.Next(4))
+
+    buf.ReadN(&l.Seq)
+    buf.ReadN(&l.Checksum)
+    buf.ReadN(&l.Length)
+}
+
+func (l *LSA) unpack(buf *packet.Buffer, version uint8) error {
+    raw := buf.Bytes()
+
+    if len(raw) < 20 {
+        return fmt.Errorf("Invalid LSA length %d", len(raw))
+    }
+
+    l.unpack_header(buf, version)
+
+    if l.Length < 20 || int(l.Length) > len(raw) {
+        return fmt.Errorf("Invalid LSA length %d", l.Length)
+    }
+
+    l.raw = raw[:l.Length]
+
+    data := buf.Next(int(l.Length) - 20)
+
+    var b packet.Buffer
+    b.Init(data)
+
+    if len(data) < l.Type.min_len() {
+        return fmt.Errorf("Invalid %s LSA length %d", l.Type, l.Length)
+    }
+
+    var word uint32
+
+    switch l.Type {
+    case Router:
+        var count uint16
+
+        b.ReadN(&l.Flags)
+        b.Next(1)
+        b.ReadN(&count)
+
+        for i := 0; i < int(count); i++ {
+            var link RouterLink
+            var tos uint8
+
+            if b.Len() < 12 {
+                return fmt.Errorf("Invalid router LSA length %d", l.Length)
+            }
+
+            link.ID   = net.IP(b.Next(4))
+            link.Data = net.IP(b.Next(4))
+
+            b.ReadN(&link.Type)
+            b.ReadN(&tos)
+            b.ReadN(&link.Metric)
+
+            if tos > 0 {
+                link.TOS = b.Next(int(tos) * 4)
+            }
+
+            l.Links = append(l.Links, link)
+        }
+
+    case Network, NetworkV3:
+        if version == 2 {
+            l.Mask = net.IP(b.Next(4))
+        } else {
+            b.ReadN(&word)
+            l.Options = Options(word & 0xffffff)
+        }
+
+        for b.Len() >= 4 {
+            l.Routers = append(l.Routers, net.IP(b.Next(4)))
+        }
+
+    case Summary, ASBRSummary:
+        l.Mask = net.IP(b.Next(4))
+        b.ReadN(&word)
+        l.Metric = word & 0xffffff
+
+    case External, NSSA:
+        l.Mask = net.IP(b.Next(4))
+        b.ReadN(&word)
+        l.Flags    = uint8(word >> 24)
+        l.Metric   = word & 0xffffff
+        l.FwdAddr  = net.IP(b.Next(4))
+        b.ReadN(&l.RouteTag)
+
+    case RouterV3:
+        b.ReadN(&word)
+        l.Flags   = uint8(word >> 24)
+        l.Options = Options(word & 0xffffff)
+
+        for b.Len() >= 16 {
+            var link RouterLink
+
+            b.ReadN(&link.Type)
+            b.Next(1)
+            b.ReadN(&link.Metric)
+            b.ReadN(&link.InterfaceId)
+            b.ReadN(&link.NbrInterfaceId)
+
+            link.NbrRouterId = net.IP(b.Next(4))
+
+            l.Links = append(l.Links, link)
+        }
+
+    case InterAreaPrefix:
+        b.ReadN(&word)
+        l.Metric = word & 0xffffff
+
+        prefixes, err := unpack_prefixes(&b, 1)
+        if err != nil {
+            return err
+        }
+
+        l.Prefixes = prefixes
+
+    case InterAreaRouter:
+        b.ReadN(&word)
+        l.Options = Options(word & 0xffffff)
+        b.ReadN(&word)
+        l.Metric = word & 0xffffff
+        l.DestRouter = net.IP(b.Next(4))
+
+    case ExternalV3, NSSAV3:
+        b.ReadN(&word)
+        l.Flags  = uint8(word >> 24)
+        l.Metric = word & 0xffffff
+
+        prefixes, err := unpack_prefixes(&b, 1)
+        if err != nil {
+            return err
+        }
+
+        l.Prefixes = prefixes
+        l.RefType  = LSAType(prefixes[0].Metric)
+
+        if l.Flags & ExternalF != 0 {
+            l.FwdAddr = net.IP(b.Next(16))
+        }
+
+        if l.Flags & ExternalT != 0 {
+            b.ReadN(&l.RouteTag)
+        }
+
+        if l.RefType != 0 {
+            l.RefLSID = net.IP(b.Next(4))
+        }
+
+    case Link:
+        var count uint32
+
+        b.ReadN(&word)
+        l.Priority  = uint8(word >> 24)
+        l.Options   = Options(word & 0xffffff)
+        l.LinkLocal = net.IP(b.Next(16))
+        b.ReadN(&count)
+
+        prefixes, err := unpack_prefixes(&b, int(count))
+        if err != nil {
+            return err
+        }
+
+        l.Prefixes = prefixes
+
+    case IntraAreaPrefix:
+        var count uint16
+
+        b.ReadN(&count)
+        b.ReadN(&l.RefType)
+        l.RefLSID   = net.IP(b.Next(4))
+        l.RefRouter = net.IP(b.Next(4))
+
+        prefixes, err := unpack_prefixes(&b, int(count))
+        if err != nil {
+            return err
+        }
+
+        l.Prefixes = prefixes
+
+    default:
+        l.Data = data
+    }
+
+    return nil
+}
+
+func prefixes_len(prefixes []Prefix) int {
+    length := 0
+
+    for _, p := range prefixes {
+        length += 4 + p.addr_len()
+    }
+
+    return length
+}
+
+func pack_prefixes(buf *packet.Buffer, prefixes []Prefix) {
+    for _, p := range prefixes {
+        buf.WriteN(p.Length)
+        buf.WriteN(p.Options)
+        buf.WriteN(p.Metric)
+        buf.Write(addr16(p.Addr)[:p.addr_len()])
+    }
+}
+
+func unpack_prefixes(buf *packet.Buffer, count int) ([]Prefix, error) {
+    var prefixes []Prefix
+
+    for i := 0; i < count; i++ {
+        var p Prefix
+
+        if buf.Len() < 4 {
+            return nil, fmt.Errorf("Invalid prefix length")
+        }
+
+        buf.ReadN(&p.Length)
+        buf.ReadN(&p.Options)
+        buf.ReadN(&p.Metric)
+
+        if p.Length > 128 || p.addr_len() > buf.Len() {
+            return nil, fmt.Errorf("Invalid prefix length %d", p.Length)
+        }
+
+        addr := make(net.IP, 16)
+        copy(addr, buf.Next(p.addr_len()))
+
+        p.Addr = addr
+
+        prefixes = append(prefixes, p)
+    }
+
+    return prefixes, nil
+}
+
+func (p Prefix) addr_len() int {
+    return (int(p.Length) + 31) / 32 * 4
+}
+
+// Return the prefix as a network address.
+func (p Prefix) IPNet() *net.IPNet {
+    return &net.IPNet{
+        IP:   addr16(p.Addr).Mask(net.CIDRMask(int(p.Length), 128)),
+        Mask: net.CIDRMask(int(p.Length), 128),
+    }
+}
+
+func addr16(ip net.IP) net.IP {
+    if ip16 := ip.To16(); ip16 != nil {
+        return ip16
+    }
+
+    return net.IPv6zero
+}
+
+func ips_equal(a, b []net.IP) bool {
+    if len(a) != len(b) {
+        return false
+    }
+
+    for i := range a {
+        if !a[i].Equal(b[i]) {
+            return false
+        }
+    }
+
+    return true
+}
+
+// Compare two IPs, treating nil as the unspecified address.
+func ip_equal(a, b net.IP) bool {
+    if a == nil || b == nil {
+        return (a == nil || a.IsUnspecified()) &&
+               (b == nil || b.IsUnspecified())
+    }
+
+    return a.Equal(b)
+}
+
+func (l LSA) Equal(other LSA) bool {
+    if l.Age != other.Age || l.Type != other.Type ||
+       !ip_equal(l.LSID, other.LSID) ||
+       !ip_equal(l.AdvRouter, other.AdvRouter) || l.Seq != other.Seq ||
+       l.Options != other.Options || l.Flags != other.Flags ||
+       !ip_equal(l.Mask, other.Mask) || l.Metric != other.Metric ||
+       !ip_equal(l.FwdAddr, other.FwdAddr) || l.RouteTag != other.RouteTag ||
+       !ip_equal(l.DestRouter, other.DestRouter) ||
+       l.Priority != other.Priority ||
+       !ip_equal(l.LinkLocal, other.LinkLocal) ||
+       l.RefType != other.RefType || !ip_equal(l.RefLSID, other.RefLSID) ||
+       !ip_equal(l.RefRouter, other.RefRouter) ||
+       !ips_equal(l.Routers, other.Routers) ||
+       !bytes.Equal(l.Data, other.Data) ||
+       len(l.Links) != len(other.Links) ||
+       len(l.Prefixes) != len(other.Prefixes) {
+        return false
+    }
+
+    for i := range l.Links {
+        if !l.Links[i].Equal(other.Links[i]) {
+            return false
+        }
+    }
+
+    for i := range l.Prefixes {
+        if !l.Prefixes[i].Equal(other.Prefixes[i]) {
+            return false
+        }
+    }
+
+    return true
+}
+
+func (r RouterLink) Equal(other RouterLink) bool {
+    return r.Type == other.Type && r.Metric == other.Metric &&
+           ip_equal(r.ID, other.ID) && ip_equal(r.Data, other.Data) &&
+           bytes.Equal(r.TOS, other.TOS) &&
+           r.InterfaceId == other.InterfaceId &&
+           r.NbrInterfaceId == other.NbrInterfaceId &&
+           ip_equal(r.NbrRouterId, other.NbrRouterId)
+}
+
+func (p Prefix) Equal(other Prefix) bool {
+    return p.Length == other.Length && p.Options == other.Options &&
+           p.Metric == other.Metric &&
+           p.IPNet().String() == other.IPNet().String()
+}
+
+func (t LSAType) min_len() int {
+    switch t {
+    case Router, Network, NetworkV3, RouterV3:   return 4
+    case Summary, ASBRSummary:                   return 8
+    case External, NSSA:                         return 16
+    case InterAreaPrefix, ExternalV3, NSSAV3:    return 8
+    case InterAreaRouter, IntraAreaPrefix:       return 12
+    case Link:                                   return 24
+    default:                                     return 0
+    }
+}
+
+func (t LSAType) String() string {
+    switch t {
+    case Router:          return "router"
+    case Network:         return "network"
+    case Summary:         return "summary"
+    case ASBRSummary:     return "asbr-summary"
+    case External:        return "external"
+    case NSSA:            return "nssa"
+    case RouterV3:        return "router"
+    case NetworkV3:       return "network"
+    case InterAreaPrefix: return "inter-area-prefix"
+    case InterAreaRouter: return "inter-area-router"
+    case ExternalV3:      return "external"
+    case NSSAV3:          return "nssa"
+    case Link:            return "link"
+    case IntraAreaPrefix: return "intra-area-prefix"
+    default:              return fmt.Sprintf("0x%x", uint16(t))
+    }
+}
@@ -0,0 +1,585 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+// Provides encoding and decoding for OSPFv2 (RFC 2328) and OSPFv3 (RFC 5340)
+// packets, including the link state advertisements they carry.
+package ospf
+
+import "fmt"
+import "net"
+
+import "github.com/ghedo/go.pkt/packet"
+import "github.com/ghedo/go.pkt/packet/ipv4"
+
+type Packet struct {
+    Version       uint8         `string:"ver"`
+    Type          Type
+    Length        uint16        `cmp:"skip" string:"len"`
+    RouterId      net.IP        `string:"router"`
+    AreaId        net.IP        `string:"area"`
+    Checksum      uint16        `cmp:"skip" string:"sum"`
+    AuType        uint16        `string:"auth"`
+    AuData        [8]byte       `string:"skip"`
+    InstanceId    uint8         `string:"instance"`
+
+    /* Hello */
+    NetworkMask   net.IP        `string:"mask"`
+    InterfaceId   uint32        `string:"iface"`
+    HelloInterval uint16        `string:"hello"`
+    DeadInterval  uint32        `string:"dead"`
+    Options       Options       `string:"opts"`
+    Priority      uint8         `string:"prio"`
+    DR            net.IP        `string:"dr"`
+    BDR           net.IP        `string:"bdr"`
+    Neighbors     []net.IP      `string:"skip"`
+
+    /* Database Description */
+    MTU           uint16        `string:"mtu"`
+    DBDFlags      uint8         `string:"dbd"`
+    DDSeq         uint32        `string:"ddseq"`
+
+    /* Link State Request */
+    Requests      []Request     `string:"skip"`
+
+    /* Database Description, Link State Update and Link State Ack */
+    LSAs          []LSA         `string:"skip"`
+
+    csum_seed     uint32        `cmp:"skip" string:"skip"`
+    csum_data     []byte        `cmp:"skip" string:"skip"`
+}
+
+type Type uint8
+
+const (
+    Hello Type = 1
+    DBD        = 2
+    LSR        = 3
+    LSU        = 4
+    LSAck      = 5
+)
+
+// Options of Hello, Database Description and LSAs. OSPFv2 only uses the low
+// 8 bits.
+type Options uint32
+
+const (
+    OptV6 Options = 0x01 /* OSPFv3 only */
+    OptE          = 0x02
+    OptMC         = 0x04
+    OptNP         = 0x08
+    OptL          = 0x10 /* OSPFv2 only */
+    OptR          = 0x10 /* OSPFv3 only */
+    OptDC         = 0x20
+    OptO          = 0x40 /* OSPFv2 only */
+    OptDN         = 0x80 /* OSPFv2 only */
+)
+
+// Database Description flags.
+const (
+    DBDMaster uint8 = 0x01
+    DBDMore         = 0x02
+    DBDInit         = 0x04
+)
+
+// Authentication types.
+const (
+    AuthNone   uint16 = 0
+    AuthSimple        = 1
+    AuthCrypto        = 2
+)
+
+// Request identifies an LSA in a Link State Request packet.
+type Request struct {
+    Type      LSAType
+    LSID      net.IP
+    AdvRouter net.IP
+}
+
+// Make a new OSPFv2 Hello packet.
+func Make() *Packet {
+    return &Packet{
+        Version: 2,
+        Type: Hello,
+        RouterId: net.IPv4zero,
+        AreaId: net.IPv4zero,
+        NetworkMask: net.IPv4zero,
+        HelloInterval: 10,
+        DeadInterval: 40,
+        Options: OptE,
+        Priority: 1,
+        DR: net.IPv4zero,
+        BDR: net.IPv4zero,
+    }
+}
+
+func (p *Packet) GetType() packet.Type {
+    return packet.OSPF
+}
+
+func (p *Packet) GetLength() uint16 {
+    length := p.hdr_len()
+
+    switch p.Type {
+    case Hello:
+        length += 20 + 4 * len(p.Neighbors)
+
+    case DBD:
+        length += 8 + 20 * len(p.LSAs)
+
+    case LSR:
+        length += 12 * len(p.Requests)
+
+    case LSU:
+        length += 4
+
+        for i := range p.LSAs {
+            length += p.LSAs[i].length(p.Version)
+        }
+
+    case LSAck:
+        length += 20 * len(p.LSAs)
+    }
+
+    return uint16(length)
+}
+
+func (p *Packet) Equals(other packet.Packet) bool {
+    return packet.Compare(p, other)
+}
+
+// Check whether the packet answers the given one: Database Description
+// packets with the same sequence number (the slave echoes the master's),
+// Link State Updates carrying the requested LSAs and Link State Acks
+// acknowledging the LSAs of an update.
+func (p *Packet) Answers(other packet.Packet) bool {
+    if other == nil || other.GetType() != packet.OSPF {
+        return false
+    }
+
+    req := other.(*Packet)
+
+    if p.Version != req.Version || !p.AreaId.Equal(req.AreaId) {
+        return false
+    }
+
+    switch {
+    case p.Type == DBD && req.Type == DBD:
+        return p.DDSeq == req.DDSeq &&
+               p.DBDFlags & DBDMaster != req.DBDFlags & DBDMaster
+
+    case p.Type == LSU && req.Type == LSR:
+        for _, r := range req.Requests {
+            if p.FindLSA(r.Type, r.LSID, r.AdvRouter) != nil {
+                return true
+            }
+        }
+
+    case p.Type == LSAck && req.Type == LSU:
+        for _, l := range p.LSAs {
+            if req.FindLSA(l.Type, l.LSID, l.AdvRouter) != nil {
+                return true
+            }
+        }
+    }
+
+    return false
+}
+
+func (p *Packet) Pack(buf *packet.Buffer) error {
+    p.Length = p.GetLength()
+
+    buf.WriteN(p.Version)
+    buf.WriteN(p.Type)
+    buf.WriteN(p.Length)
+    buf.Write(addr4(p.RouterId))
+    buf.Write(addr4(p.AreaId))
+    buf.WriteN(uint16(0x00))
+
+    switch p.Version {
+    case 2:
+        buf.WriteN(p.AuType)
+        buf.Write(make([]byte, 8))
+
+    case 3:
+        buf.WriteN(p.InstanceId)
+        buf.WriteN(uint8(0x00))
+
+    default:
+        return fmt.Errorf("Invalid OSPF version %d", p.Version)
+    }
+
+    switch p.Type {
+    case Hello:
+        if p.Version == 2 {
+            buf.Write(addr4(p.NetworkMask))
+            buf.WriteN(p.HelloInterval)
+            buf.WriteN(uint8(p.Options))
+            buf.WriteN(p.Priority)
+            buf.WriteN(p.DeadInterval)
+        } else {
+            buf.WriteN(p.InterfaceId)
+            buf.WriteN(uint32(p.Priority) << 24 | uint32(p.Options) & 0xffffff)
+            buf.WriteN(p.HelloInterval)
+            buf.WriteN(uint16(p.DeadInterval))
+        }
+
+        buf.Write(addr4(p.DR))
+        buf.Write(addr4(p.BDR))
+
+        for _, n := range p.Neighbors {
+            buf.Write(addr4(n))
+        }
+
+    case DBD:
+        if p.Version == 2 {
+            buf.WriteN(p.MTU)
+            buf.WriteN(uint8(p.Options))
+            buf.WriteN(p.DBDFlags)
+        } else {
+            buf.WriteN(uint32(p.Options) & 0xffffff)
+            buf.WriteN(p.MTU)
+            buf.WriteN(uint8(0x00))
+            buf.WriteN(p.DBDFlags)
+        }
+
+        buf.WriteN(p.DDSeq)
+
+        for i := range p.LSAs {
+            p.LSAs[i].pack_header(buf, p.Version)
+        }
+
+    case LSR:
+        for _, r := range p.Requests {
+            buf.WriteN(uint32(r.Type))
+            buf.Write(addr4(r.LSID))
+            buf.Write(addr4(r.AdvRouter))
+        }
+
+    case LSU:
+        buf.WriteN(uint32(len(p.LSAs)))
+
+        for i := range p.LSAs {
+            off := buf.LayerLen()
+
+            p.LSAs[i].pack(buf, p.Version)
+
+            lsa := buf.LayerBytes()[off:buf.LayerLen()]
+            p.LSAs[i].Checksum = Fletcher(lsa[2:], 14)
+            buf.PutUint16N(off + 16, p.LSAs[i].Checksum)
+        }
+
+    case LSAck:
+        for i := range p.LSAs {
+            p.LSAs[i].pack_header(buf, p.Version)
+        }
+    }
+
+    data := buf.LayerBytes()[:p.Length]
+
+    switch {
+    case p.Version == 3:
+        p.Checksum = ipv4.CalculateChecksum(data, p.csum_seed)
+
+    case p.AuType != AuthCrypto:
+        p.Checksum = ipv4.CalculateChecksum(data, 0)
+
+    default:
+        p.Checksum = 0
+    }
+
+    buf.PutUint16N(12, p.Checksum)
+
+    /* the authentication data is not covered by the checksum */
+    if p.Version == 2 {
+        copy(data[16:24], p.AuData[:])
+    }
+
+    p.csum_data = data
+
+    return nil
+}
+
+func (p *Packet) Unpack(buf *packet.Buffer) error {
+    data := buf.LayerBytes()
+
+    buf.ReadN(&p.Version)
+    buf.ReadN(&p.Type)
+    buf.ReadN(&p.Length)
+
+    p.RouterId = net.IP(buf.Next(4))
+    p.AreaId   = net.IP(buf.Next(4))
+
+    buf.ReadN(&p.Checksum)
+
+    switch p.Version {
+    case 2:
+        buf.ReadN(&p.AuType)
+        copy(p.AuData[:], buf.Next(8))
+
+    case 3:
+        buf.ReadN(&p.InstanceId)
+        buf.Next(1)
+
+    default:
+        return fmt.Errorf("Invalid OSPF version %d", p.Version)
+    }
+
+    hdr_len := p.hdr_len()
+
+    if int(p.Length) < hdr_len || int(p.Length) > len(data) {
+        return fmt.Errorf("Invalid OSPF length %d", p.Length)
+    }
+
+    p.csum_data = data[:p.Length]
+
+    /* trailing data (e.g. LLS blocks) is ignored */
+    body := data[hdr_len:p.Length]
+    buf.Next(len(body))
+
+    return p.unpack_body(body)
+}
+
+func (p *Packet) unpack_body(data []byte) error {
+    var b packet.Buffer
+    b.Init(data)
+
+    p.Neighbors = nil
+    p.Requests  = nil
+    p.LSAs      = nil
+
+    switch p.Type {
+    case Hello:
+        if len(data) < 20 {
+            return fmt.Errorf("Invalid Hello length %d", len(data))
+        }
+
+        if p.Version == 2 {
+            var opts uint8
+
+            p.NetworkMask = net.IP(b.Next(4))
+            b.ReadN(&p.HelloInterval)
+            b.ReadN(&opts)
+            b.ReadN(&p.Priority)
+            b.ReadN(&p.DeadInterval)
+
+            p.Options = Options(opts)
+        } else {
+            var opts uint32
+            var dead uint16
+
+            b.ReadN(&p.InterfaceId)
+            b.ReadN(&opts)
+            b.ReadN(&p.HelloInterval)
+            b.ReadN(&dead)
+
+            p.Priority     = uint8(opts >> 24)
+            p.Options      = Options(opts & 0xffffff)
+            p.DeadInterval = uint32(dead)
+        }
+
+        p.DR  = net.IP(b.Next(4))
+        p.BDR = net.IP(b.Next(4))
+
+        for b.Len() >= 4 {
+            p.Neighbors = append(p.Neighbors, net.IP(b.Next(4)))
+        }
+
+    case DBD:
+        if len(data) < 8 {
+            return fmt.Errorf("Invalid DBD length %d", len(data))
+        }
+
+        if p.Version == 2 {
+            var opts uint8
+
+            b.ReadN(&p.MTU)
+            b.ReadN(&opts)
+            b.ReadN(&p.DBDFlags)
+
+            p.Options = Options(opts)
+        } else {
+            var opts uint32
+
+            b.ReadN(&opts)
+            b.ReadN(&p.MTU)
+            b.Next(1)
+            b.ReadN(&p.DBDFlags)
+
+            p.Options = Options(opts & 0xffffff)
+        }
+
+        b.ReadN(&p.DDSeq)
+
+        return p.unpack_headers(&b)
+
+    case LSR:
+        for b.Len() >= 12 {
+            var r Request
+            var lstype uint32
+
+            b.ReadN(&lstype)
+
+            r.Type      = LSAType(lstype)
+            r.LSID      = net.IP(b.Next(4))
+            r.AdvRouter = net.IP(b.Next(4))
+
+            p.Requests = append(p.Requests, r)
+        }
+
+    case LSU:
+        var count uint32
+        b.ReadN(&count)
+
+        for i := 0; i < int(count); i++ {
+            var l LSA
+
+            err := l.unpack(&b, p.Version)
+            if err != nil {
+                return err
+            }
+
+            p.LSAs = append(p.LSAs, l)
+        }
+
+    case LSAck:
+        return p.unpack_headers(&b)
+    }
+
+    return nil
+}
+
+func (p *Packet) unpack_headers(b *packet.Buffer) error {
+    for b.Len() >= 20 {
+        var l LSA
+
+        l.unpack_header(b, p.Version)
+
+        p.LSAs = append(p.LSAs, l)
+    }
+
+    return nil
+}
+
+func (p *Packet) Payload() packet.Packet {
+    return nil
+}
+
+func (p *Packet) GuessPayloadType() packet.Type {
+    return packet.None
+}
+
+func (p *Packet) SetPayload(pl packet.Packet) error {
+    return nil
+}
+
+func (p *Packet) InitChecksum(csum uint32) {
+    p.csum_seed = csum
+}
+
+func (p *Packet) String() string {
+    return packet.Stringify(p)
+}
+
+// Return whether the checksum of the packet is valid. OSPFv3 checksums cover
+// the IPv6 pseudo-header, so OSPFv3 packets need to have been decoded or
+// encoded as payload of an IPv6 packet. Packets using cryptographic
+// authentication don't carry a checksum.
+func (p *Packet) ValidChecksum() bool {
+    if p.csum_data == nil {
+        return false
+    }
+
+    if p.Version == 3 {
+        return p.csum_seed != 0 &&
+               ipv4.CalculateChecksum(p.csum_data, p.csum_seed) == 0
+    }
+
+    if p.AuType == AuthCrypto {
+        return true
+    }
+
+    /* the authentication data is not covered by the checksum */
+    data := make([]byte, len(p.csum_data))
+    copy(data, p.csum_data)
+    copy(data[16:24], make([]byte, 8))
+
+    return ipv4.CalculateChecksum(data, 0) == 0
+}
+
+// Return the LSA with the given type, link state ID and advertising router,
+// or nil.
+func (p *Packet) FindLSA(lstype LSAType, lsid, adv_router net.IP) *LSA {
+    for i := range p.LSAs {
+        l := &p.LSAs[i]
+
+        if l.Type == lstype && l.LSID.Equal(lsid) &&
+           l.AdvRouter.Equal(adv_router) {
+            return l
+        }
+    }
+
+    return nil
+}
+
+func (p *Packet) hdr_len() int {
+    if p.Version == 3 {
+        return 16
+    }
+
+    return 24
+}
+
+func (r Request) Equal(other Request) bool {
+    return r.Type == other.Type && r.LSID.Equal(other.LSID) &&
+           r.AdvRouter.Equal(other.AdvRouter)
+}
+
+func (t Type) String() string {
+    switch t {
+    case Hello: return "hello"
+    case DBD:   return "dbd"
+    case LSR:   return "ls-request"
+    case LSU:   return "ls-update"
+    case LSAck: return "ls-ack"
+    default:    return fmt.Sprintf("0x%x", uint8(t))
+    }
+}
+
+func (o Options) String() string {
+    return fmt.Sprintf("0x%x", uint32(o))
+}
+
+func addr4(ip net.IP) []byte {
+    if ip4 := ip.To4(); ip4 != nil {
+        return ip4
+    }
+
+    return net.IPv4zero.To4()
+}
@@ -0,0 +1,396 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package ospf_test
+
+import "bytes"
+import "net"
+import "testing"
+
+import "github.com/ghedo/go.pkt/layers"
+import "github.com/ghedo/go.pkt/packet"
+import "github.com/ghedo/go.pkt/packet/ipv4"
+import "github.com/ghedo/go.pkt/packet/ipv6"
+import "github.com/ghedo/go.pkt/packet/ospf"
+
+var test_simple = []byte{
+    0x02, 0x01, 0x00, 0x30, 0x01, 0x01, 0x01, 0x01, 0x00, 0x00, 0x00, 0x00,
+    0x34, 0xeb, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+    0xff, 0xff, 0xff, 0x00, 0x00, 0x0a, 0x02, 0x01, 0x00, 0x00, 0x00, 0x28,
+    0xc0, 0xa8, 0x01, 0x01, 0x00, 0x00, 0x00, 0x00, 0x02, 0x02, 0x02, 0x02,
+}
+
+func MakeTestSimple() *ospf.Packet {
+    return &ospf.Packet{
+        Version: 2,
+        Type: ospf.Hello,
+        RouterId: net.ParseIP("1.1.1.1"),
+        AreaId: net.ParseIP("0.0.0.0"),
+        NetworkMask: net.ParseIP("255.255.255.0"),
+        HelloInterval: 10,
+        DeadInterval: 40,
+        Options: ospf.OptE,
+        Priority: 1,
+        DR: net.ParseIP("192.168.1.1"),
+        BDR: net.ParseIP("0.0.0.0"),
+        Neighbors: []net.IP{ net.ParseIP("2.2.2.2") },
+    }
+}
+
+func TestPack(t *testing.T) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_simple)))
+
+    p := MakeTestSimple()
+
+    err := p.Pack(&b)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if !bytes.Equal(test_simple, b.Buffer()) {
+        t.Fatalf("Raw packet mismatch: %x", b.Buffer())
+    }
+}
+
+func BenchmarkPack(bn *testing.B) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_simple)))
+
+    p := MakeTestSimple()
+
+    for n := 0; n < bn.N; n++ {
+        p.Pack(&b)
+    }
+}
+
+func TestUnpack(t *testing.T) {
+    var p ospf.Packet
+
+    cmp := MakeTestSimple()
+
+    var b packet.Buffer
+    b.Init(test_simple)
+
+    err := p.Unpack(&b)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if !p.Equals(cmp) {
+        t.Fatalf("Packet mismatch:\n%s\n%s", &p, cmp)
+    }
+
+    if !p.ValidChecksum() {
+        t.Fatalf("Invalid checksum: %x", p.Checksum)
+    }
+}
+
+func BenchmarkUnpack(bn *testing.B) {
+    var p ospf.Packet
+    var b packet.Buffer
+
+    for n := 0; n < bn.N; n++ {
+        b.Init(test_simple)
+        p.Unpack(&b)
+    }
+}
+
+func TestFletcher(t *testing.T) {
+    data := []byte{
+        0x02, 0x01, 0x01, 0x01, 0x01, 0x01, 0x01, 0x01, 0x01, 0x01,
+        0x80, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x24, 0x00, 0x00,
+        0x00, 0x01, 0x0a, 0x00, 0x00, 0x00, 0xff, 0xff, 0xff, 0x00,
+        0x03, 0x00, 0x00, 0x0a,
+    }
+
+    sum := ospf.Fletcher(data, 14)
+
+    data[14] = uint8(sum >> 8)
+    data[15] = uint8(sum)
+
+    var c0, c1 int
+
+    for _, b := range data {
+        c0 = (c0 + int(b)) % 255
+        c1 = (c1 + c0) % 255
+    }
+
+    if c0 != 0 || c1 != 0 {
+        t.Fatalf("Invalid Fletcher checksum: %x", sum)
+    }
+}
+
+func TestLSUv2(t *testing.T) {
+    ip4 := ipv4.Make()
+    ip4.SrcAddr = net.ParseIP("10.0.0.1")
+    ip4.DstAddr = net.ParseIP("224.0.0.5")
+
+    lsu := &ospf.Packet{
+        Version: 2,
+        Type: ospf.LSU,
+        RouterId: net.ParseIP("1.1.1.1"),
+        AreaId: net.ParseIP("0.0.0.0"),
+        AuType: ospf.AuthSimple,
+        AuData: [8]byte{ 's', 'e', 'c', 'r', 'e', 't' },
+        LSAs: []ospf.LSA{
+            {
+                Age: 1,
+                Options: ospf.OptE,
+                Type: ospf.Router,
+                LSID: net.ParseIP("1.1.1.1"),
+                AdvRouter: net.ParseIP("1.1.1.1"),
+                Seq: 0x80000001,
+                Flags: ospf.RouterB,
+                Links: []ospf.RouterLink{
+                    {
+                        Type: ospf.Stub,
+                        ID: net.ParseIP("10.0.0.0"),
+                        Data: net.ParseIP("255.255.255.0"),
+                        Metric: 10,
+                    },
+                    {
+                        Type: ospf.PointToPoint,
+                        ID: net.ParseIP("2.2.2.2"),
+                        Data: net.ParseIP("10.0.1.1"),
+                        Metric: 1,
+                    },
+                },
+            },
+            {
+                Age: 1,
+                Type: ospf.Network,
+                LSID: net.ParseIP("10.0.0.1"),
+                AdvRouter: net.ParseIP("1.1.1.1"),
+                Seq: 0x80000001,
+                Mask: net.ParseIP("255.255.255.0"),
+                Routers: []net.IP{
+                    net.ParseIP("1.1.1.1"), net.ParseIP("2.2.2.2"),
+                },
+            },
+            {
+                Age: 1,
+                Type: ospf.External,
+                LSID: net.ParseIP("192.0.2.0"),
+                AdvRouter: net.ParseIP("1.1.1.1"),
+                Seq: 0x80000001,
+                Mask: net.ParseIP("255.255.255.0"),
+                Flags: ospf.ExternalE,
+                Metric: 20,
+                FwdAddr: net.ParseIP("0.0.0.0"),
+                RouteTag: 42,
+            },
+        },
+    }
+
+    buf, err := layers.Pack(ip4, lsu)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if len(buf) != 20 + 24 + 4 + 48 + 32 + 36 {
+        t.Fatalf("Length mismatch: %d", len(buf))
+    }
+
+    pkt, err := layers.UnpackAll(buf, packet.IPv4)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    dec, ok := layers.FindLayer(pkt, packet.OSPF).(*ospf.Packet)
+    if !ok || !dec.Equals(lsu) || !dec.ValidChecksum() {
+        t.Fatalf("OSPF layer mismatch: %s", pkt)
+    }
+
+    for _, l := range dec.LSAs {
+        if !l.ValidChecksum() {
+            t.Fatalf("Invalid %s LSA checksum: %x", l.Type, l.Checksum)
+        }
+    }
+
+    ack := &ospf.Packet{
+        Version: 2,
+        Type: ospf.LSAck,
+        RouterId: net.ParseIP("2.2.2.2"),
+        AreaId: net.ParseIP("0.0.0.0"),
+        LSAs: []ospf.LSA{ dec.LSAs[2] },
+    }
+
+    if !ack.Answers(dec) {
+        t.Fatalf("LSAck doesn't answer LSU")
+    }
+
+    if ack.GetLength() != 24 + 20 {
+        t.Fatalf("LSAck length mismatch: %d", ack.GetLength())
+    }
+}
+
+func TestLSUv3(t *testing.T) {
+    ip6 := ipv6.Make()
+    ip6.SrcAddr = net.ParseIP("fe80::1")
+    ip6.DstAddr = net.ParseIP("ff02::5")
+
+    lsu := &ospf.Packet{
+        Version: 3,
+        Type: ospf.LSU,
+        RouterId: net.ParseIP("1.1.1.1"),
+        AreaId: net.ParseIP("0.0.0.0"),
+        LSAs: []ospf.LSA{
+            {
+                Type: ospf.RouterV3,
+                LSID: net.ParseIP("0.0.0.0"),
+                AdvRouter: net.ParseIP("1.1.1.1"),
+                Seq: 0x80000001,
+                Options: ospf.OptV6 | ospf.OptE | ospf.OptR,
+                Links: []ospf.RouterLink{
+                    {
+                        Type: ospf.PointToPoint,
+                        Metric: 10,
+                        InterfaceId: 5,
+                        NbrInterfaceId: 7,
+                        NbrRouterId: net.ParseIP("2.2.2.2"),
+                    },
+                },
+            },
+            {
+                Type: ospf.Link,
+                LSID: net.ParseIP("0.0.0.5"),
+                AdvRouter: net.ParseIP("1.1.1.1"),
+                Seq: 0x80000001,
+                Priority: 1,
+                Options: ospf.OptV6 | ospf.OptE | ospf.OptR,
+                LinkLocal: net.ParseIP("fe80::1"),
+                Prefixes: []ospf.Prefix{
+                    { Length: 64, Addr: net.ParseIP("2001:db8:1::") },
+                },
+            },
+            {
+                Type: ospf.IntraAreaPrefix,
+                LSID: net.ParseIP("0.0.0.0"),
+                AdvRouter: net.ParseIP("1.1.1.1"),
+                Seq: 0x80000001,
+                RefType: ospf.RouterV3,
+                RefLSID: net.ParseIP("0.0.0.0"),
+                RefRouter: net.ParseIP("1.1.1.1"),
+                Prefixes: []ospf.Prefix{
+                    { Length: 64, Metric: 10, Addr: net.ParseIP("2001:db8:1::") },
+                    { Length: 128, Options: 0x02, Addr: net.ParseIP("2001:db8::1") },
+                },
+            },
+            {
+                Type: ospf.ExternalV3,
+                LSID: net.ParseIP("0.0.0.1"),
+                AdvRouter: net.ParseIP("1.1.1.1"),
+                Seq: 0x80000001,
+                Flags: ospf.ExternalV3E | ospf.ExternalT,
+                Metric: 20,
+                RouteTag: 42,
+                Prefixes: []ospf.Prefix{
+                    { Length: 48, Addr: net.ParseIP("2001:db8:ff00::") },
+                },
+            },
+        },
+    }
+
+    buf, err := layers.Pack(ip6, lsu)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    pkt, err := layers.UnpackAll(buf, packet.IPv6)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    dec, ok := layers.FindLayer(pkt, packet.OSPF).(*ospf.Packet)
+    if !ok || !dec.Equals(lsu) || !dec.ValidChecksum() {
+        t.Fatalf("OSPF layer mismatch: %s", pkt)
+    }
+
+    for _, l := range dec.LSAs {
+        if !l.ValidChecksum() {
+            t.Fatalf("Invalid %s LSA checksum: %x", l.Type, l.Checksum)
+        }
+    }
+
+    if dec.LSAs[2].Prefixes[0].IPNet().String() != "2001:db8:1::/64" {
+        t.Fatalf("Prefix mismatch: %s", dec.LSAs[2].Prefixes[0].IPNet())
+    }
+
+    buf[len(buf) - 1] ^= 0xff
+
+    pkt, _ = layers.UnpackAll(buf, packet.IPv6)
+    dec    = layers.FindLayer(pkt, packet.OSPF).(*ospf.Packet)
+    if dec.ValidChecksum() || dec.LSAs[3].ValidChecksum() {
+        t.Fatalf("Corrupted packet has valid checksum")
+    }
+}
+
+func TestDBD(t *testing.T) {
+    master := &ospf.Packet{
+        Version: 2,
+        Type: ospf.DBD,
+        RouterId: net.ParseIP("1.1.1.1"),
+        AreaId: net.ParseIP("0.0.0.0"),
+        MTU: 1500,
+        DBDFlags: ospf.DBDInit | ospf.DBDMore | ospf.DBDMaster,
+        DDSeq: 0x1234,
+    }
+
+    slave := &ospf.Packet{
+        Version: 2,
+        Type: ospf.DBD,
+        RouterId: net.ParseIP("2.2.2.2"),
+        AreaId: net.ParseIP("0.0.0.0"),
+        MTU: 1500,
+        DBDFlags: ospf.DBDMore,
+        DDSeq: 0x1234,
+    }
+
+    if !slave.Answers(master) {
+        t.Fatalf("Slave DBD doesn't answer master")
+    }
+
+    var b packet.Buffer
+    b.Init(make([]byte, slave.GetLength()))
+
+    err := master.Pack(&b)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    var p ospf.Packet
+    b.Init(b.Buffer())
+
+    err = p.Unpack(&b)
+    if err != nil || !p.Equals(master) {
+        t.Fatalf("Packet mismatch:\n%s\n%s", &p, master)
+    }
+}
@@ -44,32 +44,65 @@ type Type uint16
 const (
     None Type = iota
     ARP
-    Bluetooth /* TODO */
+    _         /* formerly Bluetooth */
     Eth
-    GRE       /* TODO */
+    GRE
     ICMPv4
     ICMPv6
-    IGMP      /* TODO */
-    IPSec     /* TODO */
+    IGMP
+    _         /* formerly IPSec */
     IPv4
     IPv6
-    ISIS      /* TODO */
-    L2TP      /* TODO */
+    ISIS
+    L2TP
     LLC
-    LLDP      /* TODO */
-    OSPF      /* TODO */
+    LLDP
+    OSPF
     RadioTap  /* TODO */
     Raw
-    SCTP      /* TODO */
+    SCTP
     SLL
     SNAP
     TCP
-    TRILL     /* TODO */
+    TRILL
     UDP
-    UDPLite   /* TODO */
+    UDPLite
     VLAN
-    WiFi      /* TODO */
-    WoL       /* TODO */
+    WiFi
+    WoL
+    EAPOL
+    ERSPAN
+    VXLAN
+    Geneve
+    MPLS
+    PPP
+    PPPoE
+    L2TPIP
+    AH
+    ESP
+    CDP
+    STP
+    PBB
+    HCI
+    BLE
+    BLERF
+    L2CAP
+    ATT
+    DNS
+    DNSTCP
+    DHCPv4
+    DHCPv6
+    NTP
+    TLS
+)
+
+// Deprecated aliases of types that have been split into more specific ones.
+const (
+    // Deprecated: Bluetooth is an alias of HCI, use HCI instead.
+    Bluetooth = HCI
+
+    // Deprecated: IPSec is an alias of ESP, use AH or ESP instead.
+    IPSec     = ESP
 )
 
 // Packet is the interface used internally to implement packet encoding and
@@ -110,10 +143,16 @@ type Packet interface {
 
 var pcap_link_type_to_type_map = [][2]uint32{
     {   1, uint32(Eth)      },
+    {   9, uint32(PPP)      },
+    {  50, uint32(PPP)      },
+    { 105, uint32(WiFi)     },
     { 113, uint32(SLL)      },
     { 127, uint32(RadioTap) },
+    { 201, uint32(HCI)      },
     { 228, uint32(IPv4)     },
     { 229, uint32(IPv6)     },
+    { 251, uint32(BLE)      },
+    { 256, uint32(BLERF)    },
 }
 
 // Create a new type from the given PCAP link type.
@@ -140,31 +179,53 @@ func (pkttype Type) ToLinkType() uint32 {
 
 func (t Type) String() string {
     switch t {
+    case AH:        return "AH"
     case ARP:       return "ARP"
-    case Bluetooth: return "Bluetooth"
+    case ATT:       return "ATT"
+    case BLE:       return "BLE"
+    case BLERF:     return "BLE RF"
+    case CDP:       return "CDP"
+    case DHCPv4:    return "DHCPv4"
+    case DHCPv6:    return "DHCPv6"
+    case DNS:       return "DNS"
+    case DNSTCP:    return "DNS/TCP"
+    case EAPOL:     return "EAPOL"
+    case ERSPAN:    return "ERSPAN"
+    case ESP:       return "ESP"
     case Eth:       return "Ethernet"
+    case Geneve:    return "Geneve"
     case GRE:       return "GRE"
+    case HCI:       return "HCI"
     case ICMPv4:    return "ICMPv4"
     case ICMPv6:    return "ICMPv6"
     case IGMP:      return "IGMP"
-    case IPSec:     return "IPSec"
     case IPv4:      return "IPv4"
     case IPv6:      return "IPv6"
     case ISIS:      return "IS-IS"
+    case L2CAP:     return "L2CAP"
     case L2TP:      return "L2TP"
+    case L2TPIP:    return "L2TP/IP"
     case LLC:       return "LLC"
     case LLDP:      return "LLDP"
+    case MPLS:      return "MPLS"
+    case NTP:       return "NTP"
     case None:      return "None"
     case OSPF:      return "OSPF"
+    case PBB:       return "PBB"
+    case PPP:       return "PPP"
+    case PPPoE:     return "PPPoE"
     case RadioTap:  return "RadioTap"
     case SCTP:      return "SCTP"
     case SNAP:      return "SNAP"
+    case STP:       return "STP"
     case SLL:       return "SLL"
     case TCP:       return "TCP"
+    case TLS:       return "TLS"
     case TRILL:     return "TRILL"
     case UDPLite:   return "UDP Lite"
     case UDP:       return "UDP"
     case VLAN:      return "VLAN"
+    case VXLAN:     return "VXLAN"
     case WiFi:      return "WiFi"
     case WoL:       return "WoL"
     /* case Raw: */
@@ -218,6 +279,9 @@ func compare_value(a, b reflect.Value) bool {
     case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
         return a.Uint() == b.Uint()
 
+    case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+        return a.Int() == b.Int()
+
     case reflect.Array:
         for i := 0; i < a.Len(); i++ {
             if !compare_value(a.Index(i), b.Index(i)) {
@@ -308,6 +372,11 @@ func stringify_value(key string, val reflect.Value) string {
             }
         }
 
+    case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+        if val.Int() != 0 {
+            s = strconv.FormatInt(val.Int(), 10)
+        }
+
     case reflect.Interface, reflect.Slice, reflect.Struct:
         if val.IsNil() {
             goto end
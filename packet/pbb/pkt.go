@@ -0,0 +1,128 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+// Provides encoding and decoding for IEEE 802.1ah provider backbone bridging
+// (MAC-in-MAC) I-TAGs. The payload of the I-TAG is the customer Ethernet frame.
+package pbb
+
+import "github.com/ghedo/go.pkt/packet"
+
+type Packet struct {
+    Priority     uint8         `string:"prio"`
+    DropEligible bool          `string:"drop"`
+    UseCA        bool          `string:"uca"`
+    Reserved     uint8         `string:"res"`
+    ISID         uint32        `string:"isid"`
+    pkt_payload  packet.Packet `cmp:"skip" string:"skip"`
+}
+
+func Make() *Packet {
+    return &Packet{ }
+}
+
+func (p *Packet) GetType() packet.Type {
+    return packet.PBB
+}
+
+func (p *Packet) GetLength() uint16 {
+    if p.pkt_payload != nil {
+        return p.pkt_payload.GetLength() + 4
+    }
+
+    return 4
+}
+
+func (p *Packet) Equals(other packet.Packet) bool {
+    return packet.Compare(p, other)
+}
+
+func (p *Packet) Answers(other packet.Packet) bool {
+    if other == nil || other.GetType() != packet.PBB ||
+       p.ISID != other.(*Packet).ISID {
+        return false
+    }
+
+    if p.Payload() != nil {
+        return p.Payload().Answers(other.Payload())
+    }
+
+    return true
+}
+
+func (p *Packet) Pack(buf *packet.Buffer) error {
+    tci := uint32(p.Priority & 0x7) << 29 | uint32(p.Reserved & 0x7) << 24 |
+           p.ISID & 0xffffff
+
+    if p.DropEligible {
+        tci |= 1 << 28
+    }
+
+    if p.UseCA {
+        tci |= 1 << 27
+    }
+
+    buf.WriteN(tci)
+
+    return nil
+}
+
+func (p *Packet) Unpack(buf *packet.Buffer) error {
+    var tci uint32
+    buf.ReadN(&tci)
+
+    p.Priority     = uint8(tci >> 29)
+    p.DropEligible = tci & (1 << 28) != 0
+    p.UseCA        = tci & (1 << 27) != 0
+    p.Reserved     = uint8(tci >> 24) & 0x7
+    p.ISID         = tci & 0xffffff
+
+    return nil
+}
+
+func (p *Packet) Payload() packet.Packet {
+    return p.pkt_payload
+}
+
+func (p *Packet) GuessPayloadType() packet.Type {
+    return packet.Eth
+}
+
+func (p *Packet) SetPayload(pl packet.Packet) error {
+    p.pkt_payload = pl
+
+    return nil
+}
+
+func (p *Packet) InitChecksum(csum uint32) {
+}
+
+func (p *Packet) String() string {
+    return packet.Stringify(p)
+}
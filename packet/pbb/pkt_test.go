@@ -0,0 +1,153 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package pbb_test
+
+import "bytes"
+import "testing"
+
+import "github.com/ghedo/go.pkt/layers"
+import "github.com/ghedo/go.pkt/packet"
+import "github.com/ghedo/go.pkt/packet/eth"
+import "github.com/ghedo/go.pkt/packet/pbb"
+import "github.com/ghedo/go.pkt/packet/raw"
+import "github.com/ghedo/go.pkt/packet/vlan"
+
+var test_simple = []byte{
+    0x78, 0x01, 0x02, 0x03,
+}
+
+func MakeTestSimple() *pbb.Packet {
+    return &pbb.Packet{
+        Priority: 3,
+        DropEligible: true,
+        UseCA: true,
+        ISID: 0x010203,
+    }
+}
+
+func TestPack(t *testing.T) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_simple)))
+
+    p := MakeTestSimple()
+
+    err := p.Pack(&b)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if !bytes.Equal(test_simple, b.Buffer()) {
+        t.Fatalf("Raw packet mismatch: %x", b.Buffer())
+    }
+}
+
+func BenchmarkPack(bn *testing.B) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_simple)))
+
+    p := MakeTestSimple()
+
+    for n := 0; n < bn.N; n++ {
+        p.Pack(&b)
+    }
+}
+
+func TestUnpack(t *testing.T) {
+    var p pbb.Packet
+
+    cmp := MakeTestSimple()
+
+    var b packet.Buffer
+    b.Init(test_simple)
+
+    err := p.Unpack(&b)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if !p.Equals(cmp) {
+        t.Fatalf("Packet mismatch:\n%s\n%s", &p, cmp)
+    }
+}
+
+func BenchmarkUnpack(bn *testing.B) {
+    var p pbb.Packet
+    var b packet.Buffer
+
+    for n := 0; n < bn.N; n++ {
+        b.Init(test_simple)
+        p.Unpack(&b)
+    }
+}
+
+var test_frame = []byte{
+    0x00, 0x1e, 0x83, 0x01, 0x02, 0x03, 0x00, 0xaa, 0xbb, 0xcc, 0xdd, 0xee,
+    0x88, 0xa8, 0x00, 0x0a, 0x88, 0xe7, 0x60, 0x01, 0x02, 0x03, 0xff, 0xff,
+    0xff, 0xff, 0xff, 0xff, 0x00, 0x11, 0x22, 0x33, 0x44, 0x55, 0x12, 0x34,
+    0xde, 0xad, 0xbe, 0xef,
+}
+
+func TestFrame(t *testing.T) {
+    var b_eth eth.Packet
+    var b_tag vlan.Packet
+    var i_tag pbb.Packet
+    var c_eth eth.Packet
+    var raw_pkt raw.Packet
+
+    _, err := layers.Unpack(test_frame, &b_eth, &b_tag, &i_tag, &c_eth,
+                            &raw_pkt)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if b_tag.VLAN != 10 || i_tag.ISID != 0x010203 || i_tag.Priority != 3 ||
+       c_eth.SrcAddr.String() != "00:11:22:33:44:55" {
+        t.Fatalf("Packet mismatch: %s", &b_eth)
+    }
+
+    buf, err := layers.Pack(&b_eth, &b_tag, &i_tag, &c_eth, &raw_pkt)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if !bytes.Equal(buf, test_frame) {
+        t.Fatalf("Raw packet mismatch: %x", buf)
+    }
+
+    p, err := layers.UnpackAll(test_frame, packet.Eth)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if layers.FindLayer(p, packet.PBB) == nil {
+        t.Fatalf("Not PBB: %s", p)
+    }
+}
@@ -0,0 +1,534 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+// Provides encoding and decoding for PPP packets (RFC 1661), including the LCP,
+// IPCP (RFC 1332), IPv6CP (RFC 5072), PAP and CHAP (RFC 1334, RFC 1994) control
+// and authentication protocols.
+package ppp
+
+import "bytes"
+import "fmt"
+
+import "github.com/ghedo/go.pkt/packet"
+
+type Packet struct {
+    HasAddr     bool          `string:"skip"`
+    Compressed  bool          `string:"skip"`
+    Protocol    Protocol      `string:"proto"`
+
+    /* control protocols (LCP, IPCP, IPv6CP, CCP), PAP and CHAP */
+    Code        uint8
+    Id          uint8
+    Length      uint16        `string:"len"`
+    Options     []Option      `string:"skip"`
+    Magic       uint32
+
+    /* PAP peer ID and password, CHAP name and value */
+    Name        []byte        `string:"skip"`
+    Value       []byte        `string:"skip"`
+
+    /* other data (e.g. messages and rejected packets) */
+    Data        []byte        `string:"skip"`
+
+    pkt_payload packet.Packet `cmp:"skip" string:"skip"`
+}
+
+type Protocol uint16
+
+const (
+    None Protocol = 0x0000
+    IPv4          = 0x0021
+    IPv6          = 0x0057
+    MPLS          = 0x0281
+    IPCP          = 0x8021
+    IPv6CP        = 0x8057
+    CCP           = 0x80fd
+    LCP           = 0xc021
+    PAP           = 0xc023
+    LQR           = 0xc025
+    CHAP          = 0xc223
+)
+
+// Control protocol codes.
+const (
+    ConfReq uint8 = 1
+    ConfAck       = 2
+    ConfNak       = 3
+    ConfRej       = 4
+    TermReq       = 5
+    TermAck       = 6
+    CodeRej       = 7
+    ProtoRej      = 8
+    EchoReq       = 9
+    EchoReply     = 10
+    DiscardReq    = 11
+)
+
+// PAP codes.
+const (
+    AuthReq uint8 = 1
+    AuthAck       = 2
+    AuthNak       = 3
+)
+
+// CHAP codes.
+const (
+    Challenge uint8 = 1
+    Response        = 2
+    Success         = 3
+    Failure         = 4
+)
+
+// Option is a configuration option of a control protocol.
+type Option struct {
+    Type uint8
+    Data []byte
+}
+
+// LCP options.
+const (
+    OptMRU          uint8 = 1
+    OptACCM               = 2
+    OptAuthProto          = 3
+    OptQualityProto       = 4
+    OptMagic              = 5
+    OptPFC                = 7
+    OptACFC               = 8
+)
+
+// IPCP and IPv6CP options.
+const (
+    OptInterfaceId  uint8 = 1
+    OptIPAddress          = 3
+    OptPrimaryDNS         = 129
+    OptSecondaryDNS       = 131
+)
+
+func Make() *Packet {
+    return &Packet{ }
+}
+
+func (p *Packet) GetType() packet.Type {
+    return packet.PPP
+}
+
+func (p *Packet) GetLength() uint16 {
+    length := uint16(2)
+
+    if p.HasAddr {
+        length += 2
+    }
+
+    if p.Compressed {
+        length -= 1
+    }
+
+    if p.Protocol.IsControl() {
+        length += 4 + uint16(p.body_len())
+    }
+
+    if p.pkt_payload != nil {
+        length += p.pkt_payload.GetLength()
+    }
+
+    return length
+}
+
+// Return the length of the control packet data, after the code, identifier and
+// length fields.
+func (p *Packet) body_len() int {
+    switch p.Protocol {
+    case PAP:
+        if p.Code == AuthReq {
+            return 2 + len(p.Name) + len(p.Value)
+        }
+
+        return 1 + len(p.Data)
+
+    case CHAP:
+        if p.Code == Challenge || p.Code == Response {
+            return 1 + len(p.Value) + len(p.Name)
+        }
+
+        return len(p.Data)
+    }
+
+    switch p.Code {
+    case ConfReq, ConfAck, ConfNak, ConfRej:
+        length := 0
+
+        for _, o := range p.Options {
+            length += 2 + len(o.Data)
+        }
+
+        return length
+
+    case EchoReq, EchoReply, DiscardReq:
+        return 4 + len(p.Data)
+
+    default:
+        return len(p.Data)
+    }
+}
+
+func (p *Packet) Equals(other packet.Packet) bool {
+    return packet.Compare(p, other)
+}
+
+func (p *Packet) Answers(other packet.Packet) bool {
+    if other == nil || other.GetType() != packet.PPP {
+        return false
+    }
+
+    o := other.(*Packet)
+
+    if !p.Protocol.IsControl() {
+        if p.Payload() != nil {
+            return p.Payload().Answers(other.Payload())
+        }
+
+        return false
+    }
+
+    if p.Protocol != o.Protocol || p.Id != o.Id {
+        return false
+    }
+
+    switch p.Protocol {
+    case PAP:
+        return (p.Code == AuthAck || p.Code == AuthNak) && o.Code == AuthReq
+
+    case CHAP:
+        return (p.Code == Response && o.Code == Challenge) ||
+               ((p.Code == Success || p.Code == Failure) && o.Code == Response)
+    }
+
+    switch p.Code {
+    case ConfAck, ConfNak, ConfRej:
+        return o.Code == ConfReq
+
+    case TermAck:
+        return o.Code == TermReq
+
+    case EchoReply:
+        return o.Code == EchoReq
+
+    default:
+        return false
+    }
+}
+
+func (p *Packet) Pack(buf *packet.Buffer) error {
+    if p.HasAddr {
+        buf.WriteN(uint8(0xff))
+        buf.WriteN(uint8(0x03))
+    }
+
+    if p.Compressed {
+        buf.WriteN(uint8(p.Protocol))
+    } else {
+        buf.WriteN(p.Protocol)
+    }
+
+    if !p.Protocol.IsControl() {
+        return nil
+    }
+
+    p.Length = 4 + uint16(p.body_len())
+
+    buf.WriteN(p.Code)
+    buf.WriteN(p.Id)
+    buf.WriteN(p.Length)
+
+    switch p.Protocol {
+    case PAP:
+        if p.Code == AuthReq {
+            buf.WriteN(uint8(len(p.Name)))
+            buf.Write(p.Name)
+            buf.WriteN(uint8(len(p.Value)))
+            buf.Write(p.Value)
+        } else {
+            buf.WriteN(uint8(len(p.Data)))
+            buf.Write(p.Data)
+        }
+
+        return nil
+
+    case CHAP:
+        if p.Code == Challenge || p.Code == Response {
+            buf.WriteN(uint8(len(p.Value)))
+            buf.Write(p.Value)
+            buf.Write(p.Name)
+        } else {
+            buf.Write(p.Data)
+        }
+
+        return nil
+    }
+
+    switch p.Code {
+    case ConfReq, ConfAck, ConfNak, ConfRej:
+        for _, o := range p.Options {
+            buf.WriteN(o.Type)
+            buf.WriteN(uint8(2 + len(o.Data)))
+            buf.Write(o.Data)
+        }
+
+    case EchoReq, EchoReply, DiscardReq:
+        buf.WriteN(p.Magic)
+        buf.Write(p.Data)
+
+    default:
+        buf.Write(p.Data)
+    }
+
+    return nil
+}
+
+func (p *Packet) Unpack(buf *packet.Buffer) error {
+    *p = Packet{}
+
+    if buf.Len() >= 2 && buf.Bytes()[0] == 0xff && buf.Bytes()[1] == 0x03 {
+        p.HasAddr = true
+        buf.Next(2)
+    }
+
+    var proto uint8
+    buf.ReadN(&proto)
+
+    p.Protocol = Protocol(proto)
+
+    /* protocol field compression: odd first octet means 1 byte protocol */
+    if proto & 0x01 == 0 {
+        buf.ReadN(&proto)
+        p.Protocol = p.Protocol << 8 | Protocol(proto)
+    } else {
+        p.Compressed = true
+    }
+
+    if !p.Protocol.IsControl() {
+        return nil
+    }
+
+    buf.ReadN(&p.Code)
+    buf.ReadN(&p.Id)
+    buf.ReadN(&p.Length)
+
+    if p.Length < 4 || int(p.Length) - 4 > buf.Len() {
+        return fmt.Errorf("Invalid PPP control packet length %d", p.Length)
+    }
+
+    body := buf.Next(int(p.Length) - 4)
+
+    switch p.Protocol {
+    case PAP:
+        return p.unpack_pap(body)
+
+    case CHAP:
+        return p.unpack_chap(body)
+    }
+
+    switch p.Code {
+    case ConfReq, ConfAck, ConfNak, ConfRej:
+        for len(body) >= 2 {
+            length := int(body[1])
+            if length < 2 || length > len(body) {
+                return fmt.Errorf("Invalid PPP option length %d", length)
+            }
+
+            p.Options = append(p.Options,
+                               Option{ Type: body[0], Data: body[2:length] })
+
+            body = body[length:]
+        }
+
+    case EchoReq, EchoReply, DiscardReq:
+        if len(body) < 4 {
+            return fmt.Errorf("Invalid PPP echo length %d", len(body))
+        }
+
+        p.Magic = uint32(body[0]) << 24 | uint32(body[1]) << 16 |
+                  uint32(body[2]) << 8 | uint32(body[3])
+        p.Data  = body[4:]
+
+    default:
+        p.Data = body
+    }
+
+    return nil
+}
+
+func (p *Packet) unpack_pap(body []byte) error {
+    if p.Code == AuthReq {
+        if len(body) < 1 || len(body) < 2 + int(body[0]) {
+            return fmt.Errorf("Invalid PAP request")
+        }
+
+        n := int(body[0])
+
+        p.Name = body[1:1 + n]
+        body   = body[1 + n:]
+
+        n = int(body[0])
+
+        if len(body) < 1 + n {
+            return fmt.Errorf("Invalid PAP request")
+        }
+
+        p.Value = body[1:1 + n]
+        return nil
+    }
+
+    if len(body) < 1 || len(body) < 1 + int(body[0]) {
+        return fmt.Errorf("Invalid PAP message")
+    }
+
+    p.Data = body[1:1 + int(body[0])]
+    return nil
+}
+
+func (p *Packet) unpack_chap(body []byte) error {
+    if p.Code != Challenge && p.Code != Response {
+        p.Data = body
+        return nil
+    }
+
+    if len(body) < 1 || len(body) < 1 + int(body[0]) {
+        return fmt.Errorf("Invalid CHAP value")
+    }
+
+    n := int(body[0])
+
+    p.Value = body[1:1 + n]
+    p.Name  = body[1 + n:]
+
+    return nil
+}
+
+func (p *Packet) Payload() packet.Packet {
+    return p.pkt_payload
+}
+
+func (p *Packet) GuessPayloadType() packet.Type {
+    if p.Protocol.IsControl() {
+        return packet.None
+    }
+
+    return ProtocolToType(p.Protocol)
+}
+
+func (p *Packet) SetPayload(pl packet.Packet) error {
+    p.pkt_payload = pl
+
+    /* keep the original protocol of undecoded payloads */
+    if proto := TypeToProtocol(pl.GetType()); proto != None {
+        p.Protocol = proto
+    }
+
+    return nil
+}
+
+func (p *Packet) InitChecksum(csum uint32) {
+}
+
+func (p *Packet) String() string {
+    return packet.Stringify(p)
+}
+
+// Return the first configuration option of the given type, or nil.
+func (p *Packet) FindOption(opt_type uint8) *Option {
+    for i := range p.Options {
+        if p.Options[i].Type == opt_type {
+            return &p.Options[i]
+        }
+    }
+
+    return nil
+}
+
+func (o Option) Equal(other Option) bool {
+    return o.Type == other.Type && bytes.Equal(o.Data, other.Data)
+}
+
+// Return whether the protocol is a control or authentication protocol, which
+// are decoded by the PPP layer itself.
+func (p Protocol) IsControl() bool {
+    switch p {
+    case LCP, IPCP, IPv6CP, CCP, PAP, CHAP:
+        return true
+    }
+
+    return false
+}
+
+var protocol_to_type_map = map[Protocol]packet.Type{
+    None: packet.None,
+    IPv4: packet.IPv4,
+    IPv6: packet.IPv6,
+    MPLS: packet.MPLS,
+}
+
+// Create a new Type from the given PPP protocol.
+func ProtocolToType(proto Protocol) packet.Type {
+    for p, t := range protocol_to_type_map {
+        if p == proto {
+            return t
+        }
+    }
+
+    return packet.Raw
+}
+
+// Convert the Type to the corresponding PPP protocol.
+func TypeToProtocol(pkttype packet.Type) Protocol {
+    for p, t := range protocol_to_type_map {
+        if t == pkttype {
+            return p
+        }
+    }
+
+    return None
+}
+
+func (p Protocol) String() string {
+    switch p {
+    case IPv4:   return "IPv4"
+    case IPv6:   return "IPv6"
+    case MPLS:   return "MPLS"
+    case IPCP:   return "IPCP"
+    case IPv6CP: return "IPv6CP"
+    case CCP:    return "CCP"
+    case LCP:    return "LCP"
+    case PAP:    return "PAP"
+    case LQR:    return "LQR"
+    case CHAP:   return "CHAP"
+    default:     return fmt.Sprintf("0x%x", uint16(p))
+    }
+}
@@ -0,0 +1,264 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package ppp_test
+
+import "bytes"
+import "net"
+import "testing"
+
+import "github.com/ghedo/go.pkt/layers"
+import "github.com/ghedo/go.pkt/packet"
+import "github.com/ghedo/go.pkt/packet/icmpv4"
+import "github.com/ghedo/go.pkt/packet/ipv4"
+import "github.com/ghedo/go.pkt/packet/ppp"
+
+var test_simple = []byte{
+    0xc0, 0x21, 0x01, 0x01, 0x00, 0x0e, 0x01, 0x04, 0x05, 0xd4, 0x05, 0x06,
+    0x12, 0x34, 0x56, 0x78,
+}
+
+func MakeTestSimple() *ppp.Packet {
+    return &ppp.Packet{
+        Protocol: ppp.LCP,
+        Code: ppp.ConfReq,
+        Id: 1,
+        Length: 14,
+        Options: []ppp.Option{
+            { Type: ppp.OptMRU, Data: []byte{ 0x05, 0xd4 } },
+            { Type: ppp.OptMagic, Data: []byte{ 0x12, 0x34, 0x56, 0x78 } },
+        },
+    }
+}
+
+func TestPack(t *testing.T) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_simple)))
+
+    p := MakeTestSimple()
+
+    err := p.Pack(&b)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if !bytes.Equal(test_simple, b.Buffer()) {
+        t.Fatalf("Raw packet mismatch: %x", b.Buffer())
+    }
+}
+
+func BenchmarkPack(bn *testing.B) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_simple)))
+
+    p := MakeTestSimple()
+
+    for n := 0; n < bn.N; n++ {
+        p.Pack(&b)
+    }
+}
+
+func TestUnpack(t *testing.T) {
+    var p ppp.Packet
+
+    cmp := MakeTestSimple()
+
+    var b packet.Buffer
+    b.Init(test_simple)
+
+    err := p.Unpack(&b)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if !p.Equals(cmp) {
+        t.Fatalf("Packet mismatch:\n%s\n%s", &p, cmp)
+    }
+
+    if p.FindOption(ppp.OptMRU) == nil {
+        t.Fatalf("MRU option not found: %s", &p)
+    }
+}
+
+func BenchmarkUnpack(bn *testing.B) {
+    var p ppp.Packet
+    var b packet.Buffer
+
+    for n := 0; n < bn.N; n++ {
+        b.Init(test_simple)
+        p.Unpack(&b)
+    }
+}
+
+var test_control = []struct {
+    Name string
+    Raw  []byte
+}{
+    { "ipcp-conf-nak", []byte{
+        0x80, 0x21, 0x03, 0x02, 0x00, 0x0a, 0x03, 0x06, 0xc0, 0xa8, 0x01,
+        0x02,
+    } },
+    { "lcp-echo-reply", []byte{
+        0xc0, 0x21, 0x0a, 0x07, 0x00, 0x08, 0x12, 0x34, 0x56, 0x78,
+    } },
+    { "ipv6cp-conf-req", []byte{
+        0x80, 0x57, 0x01, 0x03, 0x00, 0x0e, 0x01, 0x0a, 0x02, 0x00, 0x00,
+        0xff, 0xfe, 0x00, 0x00, 0x01,
+    } },
+    { "pap-auth-req", []byte{
+        0xc0, 0x23, 0x01, 0x04, 0x00, 0x0e, 0x04, 0x75, 0x73, 0x65, 0x72,
+        0x04, 0x70, 0x61, 0x73, 0x73,
+    } },
+    { "pap-auth-ack", []byte{
+        0xc0, 0x23, 0x02, 0x04, 0x00, 0x07, 0x02, 0x6f, 0x6b,
+    } },
+    { "chap-challenge", []byte{
+        0xc2, 0x23, 0x01, 0x05, 0x00, 0x0b, 0x04, 0x01, 0x02, 0x03, 0x04,
+        0x61, 0x63,
+    } },
+    { "chap-success", []byte{
+        0xc2, 0x23, 0x03, 0x05, 0x00, 0x06, 0x6f, 0x6b,
+    } },
+    { "addr-ctrl-compressed", []byte{
+        0xff, 0x03, 0x21, 0x45, 0x00,
+    } },
+}
+
+func TestControl(t *testing.T) {
+    for _, v := range test_control {
+        var p ppp.Packet
+
+        var b packet.Buffer
+        b.Init(v.Raw)
+
+        err := p.Unpack(&b)
+        if err != nil {
+            t.Fatalf("%s: error unpacking: %s", v.Name, err)
+        }
+
+        /* the payload is not decoded here, leave it as is */
+        length := len(v.Raw) - b.Len()
+
+        b.Init(make([]byte, length))
+
+        err = p.Pack(&b)
+        if err != nil {
+            t.Fatalf("%s: error packing: %s", v.Name, err)
+        }
+
+        if !bytes.Equal(v.Raw[:length], b.Buffer()) {
+            t.Fatalf("%s: raw packet mismatch: %x", v.Name, b.Buffer())
+        }
+    }
+}
+
+func TestAnswers(t *testing.T) {
+    req := &ppp.Packet{ Protocol: ppp.PAP, Code: ppp.AuthReq, Id: 4,
+                        Name: []byte("user"), Value: []byte("pass") }
+    ack := &ppp.Packet{ Protocol: ppp.PAP, Code: ppp.AuthAck, Id: 4 }
+
+    if !ack.Answers(req) || req.Answers(ack) {
+        t.Fatalf("PAP answer mismatch")
+    }
+
+    echo_req := &ppp.Packet{ Protocol: ppp.LCP, Code: ppp.EchoReq, Id: 7 }
+    echo_rep := &ppp.Packet{ Protocol: ppp.LCP, Code: ppp.EchoReply, Id: 7 }
+
+    if !echo_rep.Answers(echo_req) {
+        t.Fatalf("LCP echo answer mismatch")
+    }
+
+    echo_rep.Id = 8
+    if echo_rep.Answers(echo_req) {
+        t.Fatalf("LCP echo answer with wrong id")
+    }
+}
+
+func TestLinkType(t *testing.T) {
+    ppp_pkt := ppp.Make()
+    ppp_pkt.HasAddr = true
+
+    ip4_pkt := ipv4.Make()
+    ip4_pkt.SrcAddr = net.ParseIP("192.168.1.2")
+    ip4_pkt.DstAddr = net.ParseIP("192.168.1.1")
+
+    buf, err := layers.Pack(ppp_pkt, ip4_pkt, icmpv4.Make())
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    for _, link_type := range []uint32{ 9, 50 } {
+        pkt, err := layers.UnpackAll(buf, packet.LinkType(link_type))
+        if err != nil {
+            t.Fatalf("Error unpacking: %s", err)
+        }
+
+        if !pkt.(*ppp.Packet).HasAddr ||
+           layers.FindLayer(pkt, packet.ICMPv4) == nil {
+            t.Fatalf("Packet mismatch: %s", pkt)
+        }
+    }
+}
+
+func TestLongAuth(t *testing.T) {
+    long := bytes.Repeat([]byte{ 'a' }, 255)
+
+    auth := []*ppp.Packet{
+        { Protocol: ppp.CHAP, Code: ppp.Response, Id: 1,
+          Value: long, Name: []byte("user") },
+        { Protocol: ppp.PAP, Code: ppp.AuthReq, Id: 2,
+          Name: long, Value: []byte("pass") },
+        { Protocol: ppp.PAP, Code: ppp.AuthNak, Id: 3, Data: long },
+    }
+
+    for _, p := range auth {
+        var b packet.Buffer
+        b.Init(make([]byte, p.GetLength()))
+
+        err := p.Pack(&b)
+        if err != nil {
+            t.Fatalf("Error packing: %s", err)
+        }
+
+        var q ppp.Packet
+
+        b.Init(b.Buffer())
+
+        err = q.Unpack(&b)
+        if err != nil {
+            t.Fatalf("Error unpacking: %s", err)
+        }
+
+        if !bytes.Equal(q.Name, p.Name) || !bytes.Equal(q.Value, p.Value) ||
+           !bytes.Equal(q.Data, p.Data) {
+            t.Fatalf("Auth mismatch: %s", &q)
+        }
+    }
+}
@@ -0,0 +1,279 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+// Provides encoding and decoding for PPPoE discovery and session packets
+// (RFC 2516).
+package pppoe
+
+import "bytes"
+import "fmt"
+
+import "github.com/ghedo/go.pkt/packet"
+import "github.com/ghedo/go.pkt/packet/eth"
+
+type Packet struct {
+    Version     uint8         `string:"ver"`
+    Type        uint8
+    Code        Code
+    SessionId   uint16        `string:"session"`
+    Length      uint16        `string:"len"`
+    Tags        []Tag         `string:"skip"`
+    pkt_payload packet.Packet `cmp:"skip" string:"skip"`
+}
+
+type Code uint8
+
+const (
+    Session Code = 0x00
+    PADO         = 0x07
+    PADI         = 0x09
+    PADR         = 0x19
+    PADS         = 0x65
+    PADT         = 0xa7
+)
+
+// Tag is a discovery packet tag.
+type Tag struct {
+    Type  TagType
+    Value []byte
+}
+
+type TagType uint16
+
+const (
+    EndOfList        TagType = 0x0000
+    ServiceName              = 0x0101
+    ACName                   = 0x0102
+    HostUniq                 = 0x0103
+    ACCookie                 = 0x0104
+    VendorSpecific           = 0x0105
+    RelaySessionId           = 0x0110
+    PPPMaxPayload            = 0x0120
+    ServiceNameError         = 0x0201
+    ACSystemError            = 0x0202
+    GenericError             = 0x0203
+)
+
+func Make() *Packet {
+    return &Packet{
+        Version: 1,
+        Type: 1,
+    }
+}
+
+func (p *Packet) GetType() packet.Type {
+    return packet.PPPoE
+}
+
+func (p *Packet) GetLength() uint16 {
+    length := 6 + uint16(p.tags_len())
+
+    if p.pkt_payload != nil {
+        length += p.pkt_payload.GetLength()
+    }
+
+    return length
+}
+
+func (p *Packet) tags_len() int {
+    length := 0
+
+    for _, t := range p.Tags {
+        length += 4 + len(t.Value)
+    }
+
+    return length
+}
+
+func (p *Packet) Equals(other packet.Packet) bool {
+    return packet.Compare(p, other)
+}
+
+func (p *Packet) Answers(other packet.Packet) bool {
+    if other == nil || other.GetType() != packet.PPPoE {
+        return false
+    }
+
+    o := other.(*Packet)
+
+    if p.Code == Session && o.Code == Session {
+        if p.SessionId != o.SessionId {
+            return false
+        }
+
+        if p.Payload() != nil {
+            return p.Payload().Answers(other.Payload())
+        }
+
+        return false
+    }
+
+    if !(p.Code == PADO && o.Code == PADI) &&
+       !(p.Code == PADS && o.Code == PADR) {
+        return false
+    }
+
+    /* the Host-Uniq tag, if present, must be echoed back */
+    req_uniq := o.FindTag(HostUniq)
+    if req_uniq == nil {
+        return true
+    }
+
+    uniq := p.FindTag(HostUniq)
+
+    return uniq != nil && bytes.Equal(uniq.Value, req_uniq.Value)
+}
+
+func (p *Packet) Pack(buf *packet.Buffer) error {
+    buf.WriteN(p.Version << 4 | p.Type & 0x0f)
+    buf.WriteN(p.Code)
+    buf.WriteN(p.SessionId)
+
+    if p.Code != Session {
+        p.Length = uint16(p.tags_len())
+    }
+
+    buf.WriteN(p.Length)
+
+    for _, t := range p.Tags {
+        buf.WriteN(t.Type)
+        buf.WriteN(uint16(len(t.Value)))
+        buf.Write(t.Value)
+    }
+
+    return nil
+}
+
+func (p *Packet) Unpack(buf *packet.Buffer) error {
+    var ver_type uint8
+    buf.ReadN(&ver_type)
+
+    p.Version = ver_type >> 4
+    p.Type    = ver_type & 0x0f
+
+    buf.ReadN(&p.Code)
+    buf.ReadN(&p.SessionId)
+    buf.ReadN(&p.Length)
+
+    if int(p.Length) > buf.Len() {
+        return fmt.Errorf("Invalid PPPoE length %d", p.Length)
+    }
+
+    /* strip the Ethernet padding */
+    buf.Truncate(int(p.Length))
+
+    p.Tags = nil
+
+    if p.Code == Session {
+        return nil
+    }
+
+    for buf.Len() >= 4 {
+        var t Tag
+        var length uint16
+
+        buf.ReadN(&t.Type)
+        buf.ReadN(&length)
+
+        if int(length) > buf.Len() {
+            return fmt.Errorf("Invalid PPPoE tag length %d", length)
+        }
+
+        t.Value = buf.Next(int(length))
+
+        p.Tags = append(p.Tags, t)
+    }
+
+    return nil
+}
+
+func (p *Packet) Payload() packet.Packet {
+    return p.pkt_payload
+}
+
+func (p *Packet) GuessPayloadType() packet.Type {
+    if p.Code == Session {
+        return packet.PPP
+    }
+
+    return packet.None
+}
+
+func (p *Packet) SetPayload(pl packet.Packet) error {
+    p.pkt_payload = pl
+    p.Code        = Session
+    p.Length      = pl.GetLength()
+
+    return nil
+}
+
+func (p *Packet) InitChecksum(csum uint32) {
+}
+
+func (p *Packet) String() string {
+    return packet.Stringify(p)
+}
+
+// Return the EtherType of the packet, which depends on whether it is part of
+// the discovery or of the session stage.
+func (p *Packet) EtherType() eth.EtherType {
+    if p.Code == Session {
+        return eth.PPPoESession
+    }
+
+    return eth.PPPoEDiscovery
+}
+
+// Return the first tag of the given type, or nil.
+func (p *Packet) FindTag(tag_type TagType) *Tag {
+    for i := range p.Tags {
+        if p.Tags[i].Type == tag_type {
+            return &p.Tags[i]
+        }
+    }
+
+    return nil
+}
+
+func (t Tag) Equal(other Tag) bool {
+    return t.Type == other.Type && bytes.Equal(t.Value, other.Value)
+}
+
+func (c Code) String() string {
+    switch c {
+    case Session: return "session"
+    case PADO:    return "PADO"
+    case PADI:    return "PADI"
+    case PADR:    return "PADR"
+    case PADS:    return "PADS"
+    case PADT:    return "PADT"
+    default:      return fmt.Sprintf("0x%x", uint8(c))
+    }
+}
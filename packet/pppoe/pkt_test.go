@@ -0,0 +1,198 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package pppoe_test
+
+import "bytes"
+import "net"
+import "testing"
+
+import "github.com/ghedo/go.pkt/layers"
+import "github.com/ghedo/go.pkt/packet"
+import "github.com/ghedo/go.pkt/packet/eth"
+import "github.com/ghedo/go.pkt/packet/ipv4"
+import "github.com/ghedo/go.pkt/packet/ppp"
+import "github.com/ghedo/go.pkt/packet/pppoe"
+
+var test_simple = []byte{
+    0x11, 0x09, 0x00, 0x00, 0x00, 0x0c, 0x01, 0x01, 0x00, 0x00, 0x01, 0x03,
+    0x00, 0x04, 0xde, 0xad, 0xbe, 0xef,
+}
+
+func MakeTestSimple() *pppoe.Packet {
+    return &pppoe.Packet{
+        Version: 1,
+        Type: 1,
+        Code: pppoe.PADI,
+        Length: 12,
+        Tags: []pppoe.Tag{
+            { Type: pppoe.ServiceName, Value: []byte{} },
+            { Type: pppoe.HostUniq, Value: []byte{ 0xde, 0xad, 0xbe, 0xef } },
+        },
+    }
+}
+
+func TestPack(t *testing.T) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_simple)))
+
+    p := MakeTestSimple()
+
+    err := p.Pack(&b)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if !bytes.Equal(test_simple, b.Buffer()) {
+        t.Fatalf("Raw packet mismatch: %x", b.Buffer())
+    }
+}
+
+func BenchmarkPack(bn *testing.B) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_simple)))
+
+    p := MakeTestSimple()
+
+    for n := 0; n < bn.N; n++ {
+        p.Pack(&b)
+    }
+}
+
+func TestUnpack(t *testing.T) {
+    var p pppoe.Packet
+
+    cmp := MakeTestSimple()
+
+    var b packet.Buffer
+    b.Init(test_simple)
+
+    err := p.Unpack(&b)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if !p.Equals(cmp) {
+        t.Fatalf("Packet mismatch:\n%s\n%s", &p, cmp)
+    }
+}
+
+func BenchmarkUnpack(bn *testing.B) {
+    var p pppoe.Packet
+    var b packet.Buffer
+
+    for n := 0; n < bn.N; n++ {
+        b.Init(test_simple)
+        p.Unpack(&b)
+    }
+}
+
+func TestAnswers(t *testing.T) {
+    padi := MakeTestSimple()
+
+    pado := pppoe.Make()
+    pado.Code = pppoe.PADO
+    pado.Tags = []pppoe.Tag{
+        { Type: pppoe.ACName, Value: []byte("bras") },
+        { Type: pppoe.HostUniq, Value: []byte{ 0xde, 0xad, 0xbe, 0xef } },
+    }
+
+    if !pado.Answers(padi) {
+        t.Fatalf("PADO doesn't answer PADI")
+    }
+
+    pado.Tags[1].Value = []byte{ 0x00 }
+
+    if pado.Answers(padi) {
+        t.Fatalf("PADO with wrong Host-Uniq answers PADI")
+    }
+}
+
+func TestEthType(t *testing.T) {
+    eth_pkt := eth.Make()
+    eth_pkt.DstAddr, _ = net.ParseMAC("ff:ff:ff:ff:ff:ff")
+
+    buf, err := layers.Pack(eth_pkt, MakeTestSimple())
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if eth_pkt.Type != eth.PPPoEDiscovery {
+        t.Fatalf("EtherType mismatch: %s", eth_pkt.Type)
+    }
+
+    pkt, err := layers.UnpackAll(buf, packet.Eth)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    padi := layers.FindLayer(pkt, packet.PPPoE)
+    if padi == nil || !padi.Equals(MakeTestSimple()) {
+        t.Fatalf("Packet mismatch: %s", pkt)
+    }
+}
+
+func TestSession(t *testing.T) {
+    eth_pkt := eth.Make()
+
+    pppoe_pkt := pppoe.Make()
+    pppoe_pkt.SessionId = 0x1234
+
+    ip4_pkt := ipv4.Make()
+    ip4_pkt.SrcAddr = net.ParseIP("192.168.1.2")
+    ip4_pkt.DstAddr = net.ParseIP("192.168.1.1")
+
+    buf, err := layers.Pack(eth_pkt, pppoe_pkt, ppp.Make(), ip4_pkt)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if eth_pkt.Type != eth.PPPoESession {
+        t.Fatalf("EtherType mismatch: %s", eth_pkt.Type)
+    }
+
+    /* add Ethernet padding */
+    buf = append(buf, make([]byte, 60 - len(buf))...)
+
+    pkt, err := layers.UnpackAll(buf, packet.Eth)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    session, ok := layers.FindLayer(pkt, packet.PPPoE).(*pppoe.Packet)
+    if !ok || session.SessionId != 0x1234 || session.Length != 22 {
+        t.Fatalf("Session mismatch: %s", pkt)
+    }
+
+    ip4, ok := layers.FindLayer(pkt, packet.IPv4).(*ipv4.Packet)
+    if !ok || !ip4.Equals(ip4_pkt) || ip4.Payload() != nil {
+        t.Fatalf("Inner packet mismatch: %s", pkt)
+    }
+}
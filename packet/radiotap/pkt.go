@@ -125,7 +125,7 @@ func (p *Packet) GuessPayloadType() packet.Type {
 
 func (p *Packet) SetPayload(pl packet.Packet) error {
     p.pkt_payload = pl
-    p.Length      = p.GetLength()
+    p.Length      = 8 + uint16(len(p.Data))
 
     return nil
 }
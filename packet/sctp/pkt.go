@@ -0,0 +1,809 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+// Provides encoding and decoding for SCTP packets (RFC 4960), including the
+// I-DATA chunk (RFC 8260).
+//
+// The user data of a DATA or I-DATA chunk at the end of the packet is decoded
+// as the payload of the SCTP packet, based on its payload protocol identifier
+// or on the SCTP ports. The user data of any other DATA chunk is kept in the
+// Data field of the chunk.
+package sctp
+
+import "bytes"
+import "encoding/binary"
+import "fmt"
+import "hash/crc32"
+import "strings"
+
+import "github.com/ghedo/go.pkt/packet"
+
+type Packet struct {
+    SrcPort     uint16        `string:"sport"`
+    DstPort     uint16        `string:"dport"`
+    Tag         uint32        `string:"tag"`
+    Checksum    uint32        `cmp:"skip" string:"sum"`
+    Chunks      Chunks
+    csum_ok     bool          `cmp:"skip" string:"skip"`
+    pl_type     packet.Type   `cmp:"skip" string:"skip"`
+    pkt_payload packet.Packet `cmp:"skip" string:"skip"`
+}
+
+// Chunk holds the fields of any chunk type. Only the fields relevant to the
+// chunk type are encoded, all chunks types not explicitly supported keep their
+// value in the Data field.
+type Chunk struct {
+    Type       ChunkType
+    Flags      uint8
+    Length     uint16
+
+    /* DATA, I-DATA, cumulative TSN of SACK, SHUTDOWN and FORWARD-TSN */
+    TSN        uint32
+    StreamId   uint16
+    StreamSeq  uint16
+    MID        uint32
+    PPID       PPID
+    FSN        uint32
+
+    /* INIT, INIT-ACK and SACK */
+    InitTag    uint32
+    Window     uint32
+    OutStreams uint16
+    InStreams  uint16
+    GapBlocks  []GapBlock
+    DupTSNs    []uint32
+
+    /* INIT and INIT-ACK parameters, HEARTBEAT info, ABORT and ERROR causes */
+    Params     []Param
+
+    Data       []byte
+}
+
+type Chunks []Chunk
+
+// GapBlock is a gap ack block of a SACK chunk, relative to its cumulative TSN.
+type GapBlock struct {
+    Start uint16
+    End   uint16
+}
+
+// Param is a TLV parameter or error cause.
+type Param struct {
+    Type  uint16
+    Value []byte
+}
+
+type ChunkType uint8
+
+const (
+    Data ChunkType   = 0
+    Init             = 1
+    InitAck          = 2
+    SACK             = 3
+    Heartbeat        = 4
+    HeartbeatAck     = 5
+    Abort            = 6
+    Shutdown         = 7
+    ShutdownAck      = 8
+    Error            = 9
+    CookieEcho       = 10
+    CookieAck        = 11
+    ECNE             = 12
+    CWR              = 13
+    ShutdownComplete = 14
+    Auth             = 15
+    IData            = 64
+    ASCONFAck        = 128
+    ReConfig         = 130
+    Pad              = 132
+    ForwardTSN       = 192
+    ASCONF           = 193
+    IForwardTSN      = 194
+)
+
+// DATA and I-DATA chunk flags.
+const (
+    End       uint8 = 0x01
+    Begin           = 0x02
+    Unordered       = 0x04
+    Immediate       = 0x08
+)
+
+// Parameter types.
+const (
+    ParamHeartbeatInfo uint16 = 1
+    ParamIPv4Addr             = 5
+    ParamIPv6Addr             = 6
+    ParamStateCookie          = 7
+    ParamUnrecognized         = 8
+    ParamCookiePreserve       = 9
+    ParamHostName             = 11
+    ParamAddrTypes            = 12
+    ParamECN                  = 0x8000
+    ParamRandom               = 0x8002
+    ParamChunkList            = 0x8003
+    ParamHMACAlgo             = 0x8004
+    ParamPadding              = 0x8005
+    ParamExtensions           = 0x8008
+    ParamForwardTSN           = 0xc000
+)
+
+// PPID is the payload protocol identifier of DATA chunks.
+type PPID uint32
+
+const (
+    PPIDNone     PPID = 0
+    IUA               = 1
+    M2UA              = 2
+    M3UA              = 3
+    SUA               = 4
+    M2PA              = 5
+    H248              = 7
+    S1AP              = 18
+    X2AP              = 27
+    Diameter          = 46
+    DiameterDTLS      = 47
+    NGAP              = 60
+    XnAP              = 61
+    F1AP              = 62
+    E1AP              = 64
+)
+
+var crc32c = crc32.MakeTable(crc32.Castagnoli)
+
+func Make() *Packet {
+    return &Packet{ }
+}
+
+func (p *Packet) GetType() packet.Type {
+    return packet.SCTP
+}
+
+func (p *Packet) GetLength() uint16 {
+    length := 12
+
+    for i := range p.Chunks {
+        length += pad(4 + p.chunk_len(i))
+    }
+
+    return uint16(length)
+}
+
+func (p *Packet) Equals(other packet.Packet) bool {
+    return packet.Compare(p, other)
+}
+
+func (p *Packet) Answers(other packet.Packet) bool {
+    if other == nil || other.GetType() != packet.SCTP {
+        return false
+    }
+
+    req := other.(*Packet)
+
+    if p.SrcPort != req.DstPort || p.DstPort != req.SrcPort {
+        return false
+    }
+
+    /* the INIT chunk carries the tag used by the peer */
+    if init := req.FindChunk(Init); init != nil {
+        return p.Tag == init.InitTag && p.FindChunk(InitAck) != nil
+    }
+
+    return true
+}
+
+func (p *Packet) Pack(buf *packet.Buffer) error {
+    buf.WriteN(p.SrcPort)
+    buf.WriteN(p.DstPort)
+    buf.WriteN(p.Tag)
+    buf.WriteN(uint32(0x00))
+
+    pl_len := 0
+
+    if p.pkt_payload != nil {
+        n := len(p.Chunks)
+        if n == 0 || !p.Chunks[n - 1].Type.HasData() {
+            return fmt.Errorf("Payload requires a trailing DATA chunk")
+        }
+
+        pl_len = int(p.pkt_payload.GetLength())
+    }
+
+    for i := range p.Chunks {
+        has_pl := i == len(p.Chunks) - 1 && p.pkt_payload != nil
+        p.Chunks[i].pack(buf, p.chunk_len(i), has_pl)
+    }
+
+    pkt_len := int(p.GetLength())
+    frame   := buf.LayerBytes()[:pkt_len]
+
+    if pl_len > 0 {
+        /*
+         * The payload has already been packed at the end of the buffer, so
+         * it needs to be moved before the padding of the last chunk.
+         */
+        hdr_len := buf.LayerLen()
+        pad_len := pkt_len - hdr_len - pl_len
+
+        copy(frame[hdr_len:], frame[hdr_len + pad_len:])
+
+        for i := pkt_len - pad_len; i < pkt_len; i++ {
+            frame[i] = 0x00
+        }
+    }
+
+    p.Checksum = crc32.Checksum(frame, crc32c)
+    binary.LittleEndian.PutUint32(frame[8:], p.Checksum)
+
+    p.csum_ok = true
+
+    return nil
+}
+
+func (p *Packet) Unpack(buf *packet.Buffer) error {
+    p.csum_ok = check_checksum(buf.LayerBytes())
+
+    buf.ReadN(&p.SrcPort)
+    buf.ReadN(&p.DstPort)
+    buf.ReadN(&p.Tag)
+    buf.ReadL(&p.Checksum)
+
+    p.Chunks  = nil
+    p.pl_type = packet.None
+
+    for buf.Len() >= 4 {
+        var c Chunk
+
+        buf.ReadN(&c.Type)
+        buf.ReadN(&c.Flags)
+        buf.ReadN(&c.Length)
+
+        body_len := int(c.Length) - 4
+        if body_len < 0 || body_len > buf.Len() {
+            return fmt.Errorf("Invalid chunk length %d", c.Length)
+        }
+
+        hdr_len := c.Type.data_hdr_len()
+
+        /* the user data of the last chunk is decoded as payload */
+        if hdr_len > 0 && pad(body_len) >= buf.Len() {
+            if body_len < hdr_len {
+                return fmt.Errorf("Invalid chunk length %d", c.Length)
+            }
+
+            c.unpack(buf.Next(hdr_len))
+
+            buf.Truncate(body_len - hdr_len)
+
+            p.Chunks  = append(p.Chunks, c)
+            p.pl_type = p.data_type(&c)
+
+            break
+        }
+
+        err := c.unpack(buf.Next(body_len))
+        if err != nil {
+            return err
+        }
+
+        buf.Next(pad(body_len) - body_len)
+
+        p.Chunks = append(p.Chunks, c)
+    }
+
+    return nil
+}
+
+func (p *Packet) Payload() packet.Packet {
+    return p.pkt_payload
+}
+
+func (p *Packet) GuessPayloadType() packet.Type {
+    return p.pl_type
+}
+
+func (p *Packet) SetPayload(pl packet.Packet) error {
+    p.pkt_payload = pl
+    p.pl_type     = pl.GetType()
+
+    return nil
+}
+
+func (p *Packet) InitChecksum(csum uint32) {
+}
+
+func (p *Packet) String() string {
+    return packet.Stringify(p)
+}
+
+// Return whether the checksum of the packet is valid. Only meaningful for
+// packets that have been decoded or encoded.
+func (p *Packet) ValidChecksum() bool {
+    return p.csum_ok
+}
+
+// Return the first chunk of the given type, or nil.
+func (p *Packet) FindChunk(chunk_type ChunkType) *Chunk {
+    for i := range p.Chunks {
+        if p.Chunks[i].Type == chunk_type {
+            return &p.Chunks[i]
+        }
+    }
+
+    return nil
+}
+
+// Return the length of the body of the i-th chunk. The user data of the last
+// chunk is replaced by the payload of the packet, if present.
+func (p *Packet) chunk_len(i int) int {
+    c := &p.Chunks[i]
+
+    if i == len(p.Chunks) - 1 && p.pkt_payload != nil {
+        return c.Type.data_hdr_len() + int(p.pkt_payload.GetLength())
+    }
+
+    return c.body_len()
+}
+
+func (p *Packet) data_type(c *Chunk) packet.Type {
+    /* fragmented user messages can't be decoded */
+    if c.Flags & (Begin | End) != Begin | End {
+        return packet.Raw
+    }
+
+    if t := PPIDToType(c.PPID); t != packet.Raw {
+        return t
+    }
+
+    if t := PortToType(p.DstPort); t != packet.Raw {
+        return t
+    }
+
+    return PortToType(p.SrcPort)
+}
+
+// Calculate the CRC32c checksum of the given SCTP packet, ignoring the current
+// value of its checksum field.
+func Checksum(data []byte) uint32 {
+    if len(data) < 12 {
+        return 0
+    }
+
+    csum := crc32.Update(0, crc32c, data[:8])
+    csum  = crc32.Update(csum, crc32c, []byte{ 0x00, 0x00, 0x00, 0x00 })
+    return crc32.Update(csum, crc32c, data[12:])
+}
+
+func check_checksum(data []byte) bool {
+    if len(data) < 12 {
+        return false
+    }
+
+    return Checksum(data) == binary.LittleEndian.Uint32(data[8:])
+}
+
+func (c *Chunk) body_len() int {
+    switch c.Type {
+    case Data:
+        return 12 + len(c.Data)
+
+    case IData:
+        return 16 + len(c.Data)
+
+    case Init, InitAck:
+        return 16 + params_len(c.Params)
+
+    case SACK:
+        return 12 + 4 * len(c.GapBlocks) + 4 * len(c.DupTSNs)
+
+    case Heartbeat, HeartbeatAck, Abort, Error:
+        return params_len(c.Params)
+
+    case Shutdown, ECNE, CWR:
+        return 4
+
+    case ForwardTSN, IForwardTSN:
+        return 4 + len(c.Data)
+
+    default:
+        return len(c.Data)
+    }
+}
+
+// Encode the chunk. If has_pl is set, the user data of the chunk is replaced by
+// the payload of the packet, which is packed separately.
+func (c *Chunk) pack(buf *packet.Buffer, body_len int, has_pl bool) {
+    c.Length = uint16(4 + body_len)
+
+    buf.WriteN(c.Type)
+    buf.WriteN(c.Flags)
+    buf.WriteN(c.Length)
+
+    switch c.Type {
+    case Data:
+        buf.WriteN(c.TSN)
+        buf.WriteN(c.StreamId)
+        buf.WriteN(c.StreamSeq)
+        buf.WriteN(c.PPID)
+
+        if has_pl {
+            return
+        }
+
+        buf.Write(c.Data)
+
+    case IData:
+        buf.WriteN(c.TSN)
+        buf.WriteN(c.StreamId)
+        buf.WriteN(uint16(0x00))
+        buf.WriteN(c.MID)
+
+        if c.Flags & Begin != 0 {
+            buf.WriteN(c.PPID)
+        } else {
+            buf.WriteN(c.FSN)
+        }
+
+        if has_pl {
+            return
+        }
+
+        buf.Write(c.Data)
+
+    case Init, InitAck:
+        buf.WriteN(c.InitTag)
+        buf.WriteN(c.Window)
+        buf.WriteN(c.OutStreams)
+        buf.WriteN(c.InStreams)
+        buf.WriteN(c.TSN)
+        pack_params(buf, c.Params)
+
+    case SACK:
+        buf.WriteN(c.TSN)
+        buf.WriteN(c.Window)
+        buf.WriteN(uint16(len(c.GapBlocks)))
+        buf.WriteN(uint16(len(c.DupTSNs)))
+
+        for _, g := range c.GapBlocks {
+            buf.WriteN(g.Start)
+            buf.WriteN(g.End)
+        }
+
+        for _, tsn := range c.DupTSNs {
+            buf.WriteN(tsn)
+        }
+
+    case Heartbeat, HeartbeatAck, Abort, Error:
+        pack_params(buf, c.Params)
+
+    case Shutdown, ECNE, CWR:
+        buf.WriteN(c.TSN)
+
+    case ForwardTSN, IForwardTSN:
+        buf.WriteN(c.TSN)
+        buf.Write(c.Data)
+
+    default:
+        buf.Write(c.Data)
+    }
+
+    buf.Write(make([]byte, pad(body_len) - body_len))
+}
+
+func (c *Chunk) unpack(data []byte) error {
+    if len(data) < c.Type.min_len() {
+        return fmt.Errorf("Invalid %s chunk length %d", c.Type, len(data))
+    }
+
+    var err error
+
+    switch c.Type {
+    case Data:
+        c.TSN       = binary.BigEndian.Uint32(data[0:])
+        c.StreamId  = binary.BigEndian.Uint16(data[4:])
+        c.StreamSeq = binary.BigEndian.Uint16(data[6:])
+        c.PPID      = PPID(binary.BigEndian.Uint32(data[8:]))
+        c.Data      = data[12:]
+
+    case IData:
+        c.TSN      = binary.BigEndian.Uint32(data[0:])
+        c.StreamId = binary.BigEndian.Uint16(data[4:])
+        c.MID      = binary.BigEndian.Uint32(data[8:])
+
+        if c.Flags & Begin != 0 {
+            c.PPID = PPID(binary.BigEndian.Uint32(data[12:]))
+        } else {
+            c.FSN  = binary.BigEndian.Uint32(data[12:])
+        }
+
+        c.Data = data[16:]
+
+    case Init, InitAck:
+        c.InitTag    = binary.BigEndian.Uint32(data[0:])
+        c.Window     = binary.BigEndian.Uint32(data[4:])
+        c.OutStreams = binary.BigEndian.Uint16(data[8:])
+        c.InStreams  = binary.BigEndian.Uint16(data[10:])
+        c.TSN        = binary.BigEndian.Uint32(data[12:])
+        c.Params, err = unpack_params(data[16:])
+
+    case SACK:
+        c.TSN    = binary.BigEndian.Uint32(data[0:])
+        c.Window = binary.BigEndian.Uint32(data[4:])
+
+        gaps := int(binary.BigEndian.Uint16(data[8:]))
+        dups := int(binary.BigEndian.Uint16(data[10:]))
+
+        if len(data) != 12 + 4 * gaps + 4 * dups {
+            return fmt.Errorf("Invalid SACK chunk length %d", len(data))
+        }
+
+        data = data[12:]
+
+        for i := 0; i < gaps; i++ {
+            c.GapBlocks = append(c.GapBlocks, GapBlock{
+                Start: binary.BigEndian.Uint16(data[0:]),
+                End:   binary.BigEndian.Uint16(data[2:]),
+            })
+
+            data = data[4:]
+        }
+
+        for i := 0; i < dups; i++ {
+            c.DupTSNs = append(c.DupTSNs, binary.BigEndian.Uint32(data))
+            data = data[4:]
+        }
+
+    case Heartbeat, HeartbeatAck, Abort, Error:
+        c.Params, err = unpack_params(data)
+
+    case Shutdown, ECNE, CWR:
+        c.TSN = binary.BigEndian.Uint32(data)
+
+    case ForwardTSN, IForwardTSN:
+        c.TSN  = binary.BigEndian.Uint32(data)
+        c.Data = data[4:]
+
+    default:
+        c.Data = data
+    }
+
+    return err
+}
+
+func params_len(params []Param) int {
+    length := 0
+
+    for _, prm := range params {
+        length = pad(length) + 4 + len(prm.Value)
+    }
+
+    return length
+}
+
+func pack_params(buf *packet.Buffer, params []Param) {
+    for i, prm := range params {
+        buf.WriteN(prm.Type)
+        buf.WriteN(uint16(4 + len(prm.Value)))
+        buf.Write(prm.Value)
+
+        /* the padding of the last parameter is the padding of the chunk */
+        if i < len(params) - 1 {
+            buf.Write(make([]byte, pad(len(prm.Value)) - len(prm.Value)))
+        }
+    }
+}
+
+func unpack_params(data []byte) ([]Param, error) {
+    var params []Param
+
+    for len(data) >= 4 {
+        prm_type := binary.BigEndian.Uint16(data[0:])
+        prm_len  := int(binary.BigEndian.Uint16(data[2:]))
+
+        if prm_len < 4 || prm_len > len(data) {
+            return nil, fmt.Errorf("Invalid parameter length %d", prm_len)
+        }
+
+        params = append(params, Param{
+            Type:  prm_type,
+            Value: data[4:prm_len],
+        })
+
+        if pad(prm_len) >= len(data) {
+            break
+        }
+
+        data = data[pad(prm_len):]
+    }
+
+    return params, nil
+}
+
+func pad(length int) int {
+    return (length + 3) &^ 3
+}
+
+// Return the first parameter of the given type, or nil.
+func (c *Chunk) FindParam(prm_type uint16) *Param {
+    for i := range c.Params {
+        if c.Params[i].Type == prm_type {
+            return &c.Params[i]
+        }
+    }
+
+    return nil
+}
+
+func (c Chunk) Equal(other Chunk) bool {
+    if c.Type != other.Type || c.Flags != other.Flags ||
+       c.TSN != other.TSN || c.StreamId != other.StreamId ||
+       c.StreamSeq != other.StreamSeq || c.MID != other.MID ||
+       c.PPID != other.PPID || c.FSN != other.FSN ||
+       c.InitTag != other.InitTag || c.Window != other.Window ||
+       c.OutStreams != other.OutStreams || c.InStreams != other.InStreams ||
+       !bytes.Equal(c.Data, other.Data) {
+        return false
+    }
+
+    if len(c.GapBlocks) != len(other.GapBlocks) ||
+       len(c.DupTSNs) != len(other.DupTSNs) ||
+       len(c.Params) != len(other.Params) {
+        return false
+    }
+
+    for i := range c.GapBlocks {
+        if c.GapBlocks[i] != other.GapBlocks[i] {
+            return false
+        }
+    }
+
+    for i := range c.DupTSNs {
+        if c.DupTSNs[i] != other.DupTSNs[i] {
+            return false
+        }
+    }
+
+    for i := range c.Params {
+        if c.Params[i].Type != other.Params[i].Type ||
+           !bytes.Equal(c.Params[i].Value, other.Params[i].Value) {
+            return false
+        }
+    }
+
+    return true
+}
+
+func (c Chunks) String() string {
+    var types []string
+
+    for _, chunk := range c {
+        types = append(types, chunk.Type.String())
+    }
+
+    return strings.Join(types, ",")
+}
+
+// Return whether the chunk carries user data.
+func (t ChunkType) HasData() bool {
+    return t == Data || t == IData
+}
+
+func (t ChunkType) data_hdr_len() int {
+    switch t {
+    case Data:  return 12
+    case IData: return 16
+    default:    return 0
+    }
+}
+
+func (t ChunkType) min_len() int {
+    switch t {
+    case Data:                          return 12
+    case IData, Init, InitAck:          return 16
+    case SACK:                          return 12
+    case Shutdown, ECNE, CWR:           return 4
+    case ForwardTSN, IForwardTSN:       return 4
+    default:                            return 0
+    }
+}
+
+func (t ChunkType) String() string {
+    switch t {
+    case Data:             return "DATA"
+    case Init:             return "INIT"
+    case InitAck:          return "INIT-ACK"
+    case SACK:             return "SACK"
+    case Heartbeat:        return "HEARTBEAT"
+    case HeartbeatAck:     return "HEARTBEAT-ACK"
+    case Abort:            return "ABORT"
+    case Shutdown:         return "SHUTDOWN"
+    case ShutdownAck:      return "SHUTDOWN-ACK"
+    case Error:            return "ERROR"
+    case CookieEcho:       return "COOKIE-ECHO"
+    case CookieAck:        return "COOKIE-ACK"
+    case ECNE:             return "ECNE"
+    case CWR:              return "CWR"
+    case ShutdownComplete: return "SHUTDOWN-COMPLETE"
+    case Auth:             return "AUTH"
+    case IData:            return "I-DATA"
+    case ASCONFAck:        return "ASCONF-ACK"
+    case ReConfig:         return "RE-CONFIG"
+    case Pad:              return "PAD"
+    case ForwardTSN:       return "FORWARD-TSN"
+    case ASCONF:           return "ASCONF"
+    case IForwardTSN:      return "I-FORWARD-TSN"
+    default:               return fmt.Sprintf("0x%x", uint8(t))
+    }
+}
+
+func (p PPID) String() string {
+    switch p {
+    case IUA:          return "IUA"
+    case M2UA:         return "M2UA"
+    case M3UA:         return "M3UA"
+    case SUA:          return "SUA"
+    case M2PA:         return "M2PA"
+    case H248:         return "H.248"
+    case S1AP:         return "S1AP"
+    case X2AP:         return "X2AP"
+    case Diameter:     return "Diameter"
+    case DiameterDTLS: return "Diameter/DTLS"
+    case NGAP:         return "NGAP"
+    case XnAP:         return "XnAP"
+    case F1AP:         return "F1AP"
+    case E1AP:         return "E1AP"
+    default:           return fmt.Sprintf("%d", uint32(p))
+    }
+}
+
+/* no SCTP user protocol can be decoded yet, everything is raw data */
+var ppid_to_type_map = map[PPID]packet.Type{
+}
+
+var port_to_type_map = map[uint16]packet.Type{
+}
+
+// Create a new Type from the given payload protocol identifier.
+func PPIDToType(ppid PPID) packet.Type {
+    if t, ok := ppid_to_type_map[ppid]; ok {
+        return t
+    }
+
+    return packet.Raw
+}
+
+// Create a new Type from the given well-known SCTP port.
+func PortToType(port uint16) packet.Type {
+    if t, ok := port_to_type_map[port]; ok {
+        return t
+    }
+
+    return packet.Raw
+}
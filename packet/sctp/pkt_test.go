@@ -0,0 +1,238 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package sctp_test
+
+import "bytes"
+import "net"
+import "testing"
+
+import "github.com/ghedo/go.pkt/layers"
+import "github.com/ghedo/go.pkt/packet"
+import "github.com/ghedo/go.pkt/packet/ipv4"
+import "github.com/ghedo/go.pkt/packet/raw"
+import "github.com/ghedo/go.pkt/packet/sctp"
+
+var test_simple = []byte{
+    0x0b, 0x59, 0x0b, 0x59, 0x00, 0x00, 0x00, 0x00, 0xe6, 0x5d, 0x8d, 0xdc,
+    0x01, 0x00, 0x00, 0x22, 0x11, 0x22, 0x33, 0x44, 0x00, 0x01, 0xa0, 0x00,
+    0x00, 0x0a, 0xff, 0xff, 0x01, 0x02, 0x03, 0x04, 0x00, 0x05, 0x00, 0x08,
+    0xc0, 0xa8, 0x01, 0x01, 0x00, 0x0c, 0x00, 0x06, 0x00, 0x05, 0x00, 0x00,
+}
+
+func MakeTestSimple() *sctp.Packet {
+    return &sctp.Packet{
+        SrcPort: 2905,
+        DstPort: 2905,
+        Chunks: []sctp.Chunk{
+            {
+                Type: sctp.Init,
+                InitTag: 0x11223344,
+                Window: 106496,
+                OutStreams: 10,
+                InStreams: 65535,
+                TSN: 0x01020304,
+                Params: []sctp.Param{
+                    { Type: sctp.ParamIPv4Addr, Value: []byte{ 192, 168, 1, 1 } },
+                    { Type: sctp.ParamAddrTypes, Value: []byte{ 0x00, 0x05 } },
+                },
+            },
+        },
+    }
+}
+
+func TestPack(t *testing.T) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_simple)))
+
+    p := MakeTestSimple()
+
+    err := p.Pack(&b)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if !bytes.Equal(test_simple, b.Buffer()) {
+        t.Fatalf("Raw packet mismatch: %x", b.Buffer())
+    }
+}
+
+func BenchmarkPack(bn *testing.B) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_simple)))
+
+    p := MakeTestSimple()
+
+    for n := 0; n < bn.N; n++ {
+        p.Pack(&b)
+    }
+}
+
+func TestUnpack(t *testing.T) {
+    var p sctp.Packet
+
+    cmp := MakeTestSimple()
+
+    var b packet.Buffer
+    b.Init(test_simple)
+
+    err := p.Unpack(&b)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if !p.Equals(cmp) {
+        t.Fatalf("Packet mismatch:\n%s\n%s", &p, cmp)
+    }
+
+    if !p.ValidChecksum() {
+        t.Fatalf("Invalid checksum: %x", p.Checksum)
+    }
+}
+
+func BenchmarkUnpack(bn *testing.B) {
+    var p sctp.Packet
+    var b packet.Buffer
+
+    for n := 0; n < bn.N; n++ {
+        b.Init(test_simple)
+        p.Unpack(&b)
+    }
+}
+
+func TestUnpackBadChecksum(t *testing.T) {
+    var p sctp.Packet
+
+    data := append([]byte{}, test_simple...)
+    data[20] ^= 0xff
+
+    var b packet.Buffer
+    b.Init(data)
+
+    err := p.Unpack(&b)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if p.ValidChecksum() {
+        t.Fatalf("Corrupted packet has valid checksum")
+    }
+}
+
+func TestData(t *testing.T) {
+    ip4 := ipv4.Make()
+    ip4.SrcAddr = net.ParseIP("10.0.0.1")
+    ip4.DstAddr = net.ParseIP("10.0.0.2")
+
+    sctp_pkt := &sctp.Packet{
+        SrcPort: 3868,
+        DstPort: 3868,
+        Tag: 0xdeadbeef,
+        Chunks: []sctp.Chunk{
+            {
+                Type: sctp.SACK,
+                TSN: 100,
+                Window: 65536,
+                GapBlocks: []sctp.GapBlock{ { Start: 2, End: 3 } },
+                DupTSNs: []uint32{ 99 },
+            },
+            {
+                Type: sctp.Data,
+                Flags: sctp.Begin | sctp.End,
+                TSN: 200,
+                StreamId: 1,
+                StreamSeq: 7,
+                PPID: sctp.Diameter,
+            },
+        },
+    }
+
+    data := &raw.Packet{ Data: []byte("hello") }
+
+    buf, err := layers.Pack(ip4, sctp_pkt, data)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    /* 12 bytes header, 24 bytes SACK, 16 bytes DATA and 8 bytes data */
+    if len(buf) != 20 + 12 + 24 + 16 + 8 {
+        t.Fatalf("Length mismatch: %d", len(buf))
+    }
+
+    if !bytes.Equal(buf[len(buf) - 8:], []byte("hello\x00\x00\x00")) {
+        t.Fatalf("Padding mismatch: %x", buf)
+    }
+
+    pkt, err := layers.UnpackAll(buf, packet.IPv4)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    dec, ok := layers.FindLayer(pkt, packet.SCTP).(*sctp.Packet)
+    if !ok || !dec.Equals(sctp_pkt) || !dec.ValidChecksum() {
+        t.Fatalf("SCTP layer mismatch: %s", pkt)
+    }
+
+    if dec.Chunks[1].Length != 21 {
+        t.Fatalf("DATA chunk length mismatch: %d", dec.Chunks[1].Length)
+    }
+
+    if !layers.FindLayer(dec, packet.Raw).Equals(data) {
+        t.Fatalf("Payload mismatch: %s", pkt)
+    }
+
+    repack, err := layers.Pack(pkt, dec, dec.Payload())
+    if err != nil || !bytes.Equal(repack, buf) {
+        t.Fatalf("Repacked packet mismatch: %x", repack)
+    }
+}
+
+func TestAnswers(t *testing.T) {
+    init := MakeTestSimple()
+
+    init_ack := &sctp.Packet{
+        SrcPort: 2905,
+        DstPort: 2905,
+        Tag: 0x11223344,
+        Chunks: []sctp.Chunk{
+            { Type: sctp.InitAck, InitTag: 0x55667788, TSN: 1 },
+        },
+    }
+
+    if !init_ack.Answers(init) {
+        t.Fatalf("INIT-ACK doesn't answer INIT")
+    }
+
+    init_ack.Tag = 0
+
+    if init_ack.Answers(init) {
+        t.Fatalf("INIT-ACK with wrong tag answers INIT")
+    }
+}
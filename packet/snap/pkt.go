@@ -41,6 +41,17 @@ type Packet struct {
     pkt_payload packet.Packet `cmp:"skip" string:"skip"`
 }
 
+// Organizationally unique identifiers used to guess the payload type.
+var (
+    OUIEncap = [3]byte{ 0x00, 0x00, 0x00 }
+    OUICisco = [3]byte{ 0x00, 0x00, 0x0c }
+)
+
+// Cisco protocol IDs.
+const (
+    CDP eth.EtherType = 0x2000
+)
+
 func Make() *Packet {
     return &Packet{ }
 }
@@ -84,16 +95,33 @@ func (p *Packet) Payload() packet.Packet {
 }
 
 func (p *Packet) GuessPayloadType() packet.Type {
-    if p.OUI[0] == 0x00 && p.OUI[1] == 0x00 && p.OUI[2] == 0x00 {
+    switch {
+    case p.OUI == OUIEncap:
         return eth.EtherTypeToType(p.Type)
-    } else {
+
+    case p.OUI == OUICisco && p.Type == CDP:
+        return packet.CDP
+
+    default:
         return packet.Raw
     }
 }
 
 func (p *Packet) SetPayload(pl packet.Packet) error {
     p.pkt_payload = pl
-    p.Type        = eth.TypeToEtherType(pl.GetType())
+
+    switch pl.GetType() {
+    case packet.CDP:
+        p.OUI  = OUICisco
+        p.Type = CDP
+
+    case packet.Raw:
+        /* keep the original protocol of undecoded payloads */
+
+    default:
+        p.OUI  = OUIEncap
+        p.Type = eth.UpdateEtherType(p.Type, pl)
+    }
 
     return nil
 }
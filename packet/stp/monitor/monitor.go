@@ -0,0 +1,216 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+// Provides a passive spanning tree monitor that tracks root bridge changes and
+// topology changes from captured BPDUs.
+package monitor
+
+import "fmt"
+
+import "github.com/ghedo/go.pkt/capture"
+import "github.com/ghedo/go.pkt/layers"
+import "github.com/ghedo/go.pkt/packet"
+import "github.com/ghedo/go.pkt/packet/stp"
+
+// Event describes a change of the spanning tree seen in a BPDU. Frame is the
+// index of the BPDU among the packets given to the monitor, starting from 1.
+type Event struct {
+    Type     EventType
+    Frame    uint64
+    Bridge   stp.BridgeId
+    Port     uint16
+    Root     stp.BridgeId
+    PrevRoot stp.BridgeId
+}
+
+type EventType uint8
+
+const (
+    RootChange     EventType = 1
+    TopologyChange           = 2
+    TCN                      = 3
+)
+
+// Monitor tracks the state of a spanning tree.
+type Monitor struct {
+    root     stp.BridgeId
+    has_root bool
+    frames   uint64
+    tc       map[port_key]bool
+    events   []Event
+}
+
+type port_key struct {
+    bridge stp.BridgeId
+    port   uint16
+}
+
+// Create a new monitor.
+func New() *Monitor {
+    return &Monitor{
+        tc: make(map[port_key]bool),
+    }
+}
+
+// Update the monitor with the given packet and return the events it caused.
+// Packets that don't contain a BPDU only advance the frame counter.
+//
+// A root change is reported whenever a configuration BPDU advertises a root
+// bridge different from the current one. A topology change is reported when a
+// port starts setting the topology change flag in its BPDUs, since the flag is
+// then kept set for a while.
+func (m *Monitor) Add(pkt packet.Packet) []Event {
+    m.frames++
+
+    bpdu, ok := layers.FindLayer(pkt, packet.STP).(*stp.Packet)
+    if !ok {
+        return nil
+    }
+
+    var events []Event
+
+    if bpdu.Type == stp.TCN {
+        events = append(events, Event{
+            Type: TCN,
+            Frame: m.frames,
+            Root: m.root,
+        })
+
+        m.events = append(m.events, events...)
+
+        return events
+    }
+
+    if !m.has_root || bpdu.RootId != m.root {
+        if m.has_root {
+            events = append(events, Event{
+                Type: RootChange,
+                Frame: m.frames,
+                Bridge: bpdu.BridgeId,
+                Port: bpdu.PortId,
+                Root: bpdu.RootId,
+                PrevRoot: m.root,
+            })
+        }
+
+        m.root     = bpdu.RootId
+        m.has_root = true
+    }
+
+    key := port_key{ bpdu.BridgeId, bpdu.PortId }
+    tc  := bpdu.Flags & stp.TopologyChange != 0
+
+    if tc && !m.tc[key] {
+        events = append(events, Event{
+            Type: TopologyChange,
+            Frame: m.frames,
+            Bridge: bpdu.BridgeId,
+            Port: bpdu.PortId,
+            Root: bpdu.RootId,
+        })
+    }
+
+    m.tc[key] = tc
+
+    m.events = append(m.events, events...)
+
+    return events
+}
+
+// Capture packets from the given capture handle and add them to the monitor
+// until no more packets are available (e.g. at the end of a dump file).
+func (m *Monitor) Capture(c capture.Handle) error {
+    for {
+        buf, err := c.Capture()
+        if err != nil {
+            return err
+        }
+
+        if buf == nil {
+            return nil
+        }
+
+        pkt, err := layers.UnpackAll(buf, c.LinkType())
+        if err != nil {
+            m.frames++
+            continue
+        }
+
+        m.Add(pkt)
+    }
+}
+
+// Return the current root bridge, and whether any BPDU advertising it has been
+// seen yet.
+func (m *Monitor) Root() (stp.BridgeId, bool) {
+    return m.root, m.has_root
+}
+
+// Return all the events seen so far.
+func (m *Monitor) Events() []Event {
+    return m.events
+}
+
+// Return the number of events of the given type seen so far.
+func (m *Monitor) Count(t EventType) int {
+    var n int
+
+    for _, e := range m.events {
+        if e.Type == t {
+            n++
+        }
+    }
+
+    return n
+}
+
+func (t EventType) String() string {
+    switch t {
+    case RootChange:     return "root-change"
+    case TopologyChange: return "topology-change"
+    case TCN:            return "tcn"
+    default:             return fmt.Sprintf("%d", uint8(t))
+    }
+}
+
+func (e Event) String() string {
+    switch e.Type {
+    case RootChange:
+        return fmt.Sprintf("#%d %s %s -> %s", e.Frame, e.Type, e.PrevRoot,
+                           e.Root)
+
+    case TopologyChange:
+        return fmt.Sprintf("#%d %s from %s port 0x%x", e.Frame, e.Type,
+                           e.Bridge, e.Port)
+
+    default:
+        return fmt.Sprintf("#%d %s", e.Frame, e.Type)
+    }
+}
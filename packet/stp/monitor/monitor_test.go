@@ -0,0 +1,111 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package monitor_test
+
+import "log"
+import "net"
+import "testing"
+
+import "github.com/ghedo/go.pkt/capture/file"
+import "github.com/ghedo/go.pkt/packet/raw"
+import "github.com/ghedo/go.pkt/packet/stp"
+import "github.com/ghedo/go.pkt/packet/stp/monitor"
+
+func TestMonitor(t *testing.T) {
+    addr1, _ := net.ParseMAC("00:11:22:33:44:55")
+    addr2, _ := net.ParseMAC("00:11:22:33:44:66")
+
+    root1 := stp.MakeBridgeId(32768, 0, addr1)
+    root2 := stp.MakeBridgeId(4096, 0, addr2)
+
+    bpdu := stp.Make()
+    bpdu.RootId   = root1
+    bpdu.BridgeId = root1
+
+    m := monitor.New()
+
+    if ev := m.Add(bpdu); len(ev) != 0 {
+        t.Fatalf("Unexpected events: %v", ev)
+    }
+
+    if root, ok := m.Root(); !ok || root != root1 {
+        t.Fatalf("Root mismatch: %s", root)
+    }
+
+    m.Add(raw.Make())
+
+    /* a better bridge takes over and signals a topology change */
+    bpdu.RootId = root2
+    bpdu.Flags  = stp.TopologyChange
+
+    ev := m.Add(bpdu)
+    if len(ev) != 2 ||
+       ev[0].Type != monitor.RootChange || ev[0].Frame != 3 ||
+       ev[0].PrevRoot != root1 || ev[0].Root != root2 ||
+       ev[1].Type != monitor.TopologyChange {
+        t.Fatalf("Events mismatch: %v", ev)
+    }
+
+    /* the topology change flag stays set for a while */
+    if ev := m.Add(bpdu); len(ev) != 0 {
+        t.Fatalf("Unexpected events: %v", ev)
+    }
+
+    ev = m.Add(&stp.Packet{ Type: stp.TCN })
+    if len(ev) != 1 || ev[0].Type != monitor.TCN || ev[0].Root != root2 {
+        t.Fatalf("Events mismatch: %v", ev)
+    }
+
+    if m.Count(monitor.RootChange) != 1 ||
+       m.Count(monitor.TopologyChange) != 1 ||
+       m.Count(monitor.TCN) != 1 || len(m.Events()) != 3 {
+        t.Fatalf("Events mismatch: %v", m.Events())
+    }
+}
+
+func ExampleMonitor() {
+    src, err := file.Open("/path/to/file/dump.pcap")
+    if err != nil {
+        log.Fatal(err)
+    }
+    defer src.Close()
+
+    m := monitor.New()
+
+    err = m.Capture(src)
+    if err != nil {
+        log.Fatal(err)
+    }
+
+    for _, e := range m.Events() {
+        log.Println(e)
+    }
+}
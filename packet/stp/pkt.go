@@ -0,0 +1,448 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+// Provides encoding and decoding for STP (IEEE 802.1D), RSTP (IEEE 802.1w) and
+// MSTP (IEEE 802.1s) bridge protocol data units.
+package stp
+
+import "fmt"
+import "net"
+import "strings"
+import "time"
+
+import "github.com/ghedo/go.pkt/packet"
+
+type Packet struct {
+    Protocol     uint16    `string:"proto"`
+    Version      Version   `string:"ver"`
+    Type         Type
+    Flags        Flags
+    RootId       BridgeId  `string:"root"`
+    RootPathCost uint32    `string:"cost"`
+    BridgeId     BridgeId  `string:"bridge"`
+    PortId       uint16    `string:"port"`
+    MessageAge   Time      `string:"age"`
+    MaxAge       Time      `string:"maxage"`
+    HelloTime    Time      `string:"hello"`
+    FwdDelay     Time      `string:"fwddelay"`
+
+    /* MSTP */
+    MSTConfig    MSTConfig `string:"skip"`
+    CISTCost     uint32    `string:"cist_cost"`
+    CISTBridgeId BridgeId  `string:"cist_bridge"`
+    CISTHops     uint8     `string:"hops"`
+    MSTIs        []MSTI    `string:"skip"`
+}
+
+type Version uint8
+
+const (
+    STP  Version = 0
+    RSTP         = 2
+    MSTP         = 3
+)
+
+type Type uint8
+
+const (
+    Config Type = 0x00
+    RST         = 0x02
+    TCN         = 0x80
+)
+
+type Flags uint8
+
+const (
+    TopologyChange    Flags = 0x01
+    Proposal                = 0x02
+    PortRoleMask            = 0x0c
+    Learning                = 0x10
+    Forwarding              = 0x20
+    Agreement               = 0x40
+    TopologyChangeAck       = 0x80
+)
+
+type PortRole uint8
+
+const (
+    RoleUnknown    PortRole = 0
+    RoleAlternate           = 1
+    RoleRoot                = 2
+    RoleDesignated          = 3
+)
+
+// BridgeId identifies a bridge. It's made of the bridge priority (the first 4
+// bits) and system ID extension (the following 12 bits, e.g. the VLAN ID of
+// per-VLAN spanning trees), followed by the MAC address of the bridge.
+type BridgeId [8]byte
+
+// Time is a BPDU timer value, in units of 1/256th of a second.
+type Time uint16
+
+// MST configuration identifier. Bridges with the same configuration
+// identifier belong to the same MST region.
+type MSTConfig struct {
+    Selector uint8
+    Name     [32]byte
+    Revision uint16
+    Digest   [16]byte
+}
+
+// MSTI configuration message.
+type MSTI struct {
+    Flags        Flags
+    RegRootId    BridgeId
+    InternalCost uint32
+    BridgePrio   uint8
+    PortPrio     uint8
+    Hops         uint8
+}
+
+// Make a new configuration BPDU with the default timers.
+func Make() *Packet {
+    return &Packet{
+        Version: STP,
+        Type: Config,
+        MaxAge: 20 * 256,
+        HelloTime: 2 * 256,
+        FwdDelay: 15 * 256,
+    }
+}
+
+func (p *Packet) GetType() packet.Type {
+    return packet.STP
+}
+
+func (p *Packet) GetLength() uint16 {
+    switch {
+    case p.Type == TCN:
+        return 4
+
+    case p.Type == Config:
+        return 35
+
+    case p.Version >= MSTP:
+        return 36 + 2 + 64 + 16 * uint16(len(p.MSTIs))
+
+    default:
+        return 36
+    }
+}
+
+func (p *Packet) Equals(other packet.Packet) bool {
+    return packet.Compare(p, other)
+}
+
+func (p *Packet) Answers(other packet.Packet) bool {
+    return false
+}
+
+func (p *Packet) Pack(buf *packet.Buffer) error {
+    buf.WriteN(p.Protocol)
+    buf.WriteN(p.Version)
+    buf.WriteN(p.Type)
+
+    if p.Type == TCN {
+        return nil
+    }
+
+    buf.WriteN(p.Flags)
+    buf.Write(p.RootId[:])
+    buf.WriteN(p.RootPathCost)
+    buf.Write(p.BridgeId[:])
+    buf.WriteN(p.PortId)
+    buf.WriteN(p.MessageAge)
+    buf.WriteN(p.MaxAge)
+    buf.WriteN(p.HelloTime)
+    buf.WriteN(p.FwdDelay)
+
+    if p.Type == Config {
+        return nil
+    }
+
+    /* Version 1 length */
+    buf.WriteN(uint8(0))
+
+    if p.Version < MSTP {
+        return nil
+    }
+
+    buf.WriteN(uint16(64 + 16 * len(p.MSTIs)))
+
+    buf.WriteN(p.MSTConfig.Selector)
+    buf.Write(p.MSTConfig.Name[:])
+    buf.WriteN(p.MSTConfig.Revision)
+    buf.Write(p.MSTConfig.Digest[:])
+
+    buf.WriteN(p.CISTCost)
+    buf.Write(p.CISTBridgeId[:])
+    buf.WriteN(p.CISTHops)
+
+    for _, m := range p.MSTIs {
+        buf.WriteN(m.Flags)
+        buf.Write(m.RegRootId[:])
+        buf.WriteN(m.InternalCost)
+        buf.WriteN(m.BridgePrio)
+        buf.WriteN(m.PortPrio)
+        buf.WriteN(m.Hops)
+    }
+
+    return nil
+}
+
+func (p *Packet) Unpack(buf *packet.Buffer) error {
+    if buf.Len() < 4 {
+        return fmt.Errorf("Invalid BPDU length %d", buf.Len())
+    }
+
+    buf.ReadN(&p.Protocol)
+    buf.ReadN(&p.Version)
+    buf.ReadN(&p.Type)
+
+    p.MSTIs = nil
+
+    switch {
+    case p.Type == TCN:
+        return nil
+
+    case p.Type == Config && buf.Len() < 31,
+         p.Type == RST && buf.Len() < 32:
+        return fmt.Errorf("Invalid BPDU length %d", buf.Len() + 4)
+
+    case p.Type != Config && p.Type != RST:
+        return fmt.Errorf("Invalid BPDU type 0x%x", uint8(p.Type))
+    }
+
+    buf.ReadN(&p.Flags)
+    copy(p.RootId[:], buf.Next(8))
+    buf.ReadN(&p.RootPathCost)
+    copy(p.BridgeId[:], buf.Next(8))
+    buf.ReadN(&p.PortId)
+    buf.ReadN(&p.MessageAge)
+    buf.ReadN(&p.MaxAge)
+    buf.ReadN(&p.HelloTime)
+    buf.ReadN(&p.FwdDelay)
+
+    if p.Type == Config {
+        return nil
+    }
+
+    buf.Next(1)
+
+    if p.Version < MSTP {
+        return nil
+    }
+
+    var v3_len uint16
+
+    if buf.Len() < 2 {
+        return fmt.Errorf("Invalid MST BPDU")
+    }
+
+    buf.ReadN(&v3_len)
+
+    if v3_len < 64 || (v3_len - 64) % 16 != 0 || buf.Len() < int(v3_len) {
+        return fmt.Errorf("Invalid MST BPDU version 3 length %d", v3_len)
+    }
+
+    buf.ReadN(&p.MSTConfig.Selector)
+    copy(p.MSTConfig.Name[:], buf.Next(32))
+    buf.ReadN(&p.MSTConfig.Revision)
+    copy(p.MSTConfig.Digest[:], buf.Next(16))
+
+    buf.ReadN(&p.CISTCost)
+    copy(p.CISTBridgeId[:], buf.Next(8))
+    buf.ReadN(&p.CISTHops)
+
+    for i := 0; i < int(v3_len - 64) / 16; i++ {
+        var m MSTI
+
+        buf.ReadN(&m.Flags)
+        copy(m.RegRootId[:], buf.Next(8))
+        buf.ReadN(&m.InternalCost)
+        buf.ReadN(&m.BridgePrio)
+        buf.ReadN(&m.PortPrio)
+        buf.ReadN(&m.Hops)
+
+        p.MSTIs = append(p.MSTIs, m)
+    }
+
+    return nil
+}
+
+func (p *Packet) Payload() packet.Packet {
+    return nil
+}
+
+func (p *Packet) GuessPayloadType() packet.Type {
+    return packet.None
+}
+
+func (p *Packet) SetPayload(pl packet.Packet) error {
+    return nil
+}
+
+func (p *Packet) InitChecksum(csum uint32) {
+}
+
+func (p *Packet) String() string {
+    return packet.Stringify(p)
+}
+
+// Return the role of the port sending the BPDU (RSTP and MSTP only).
+func (f Flags) Role() PortRole {
+    return PortRole((f & PortRoleMask) >> 2)
+}
+
+// Return the flags with the given port role.
+func (f Flags) WithRole(role PortRole) Flags {
+    return f &^ PortRoleMask | Flags(role << 2) & PortRoleMask
+}
+
+// Return the name of the MST region.
+func (c MSTConfig) RegionName() string {
+    return strings.TrimRight(string(c.Name[:]), "\x00")
+}
+
+// Make a new bridge ID from the given priority, system ID extension and MAC
+// address.
+func MakeBridgeId(prio uint16, sys_id uint16, addr net.HardwareAddr) BridgeId {
+    var id BridgeId
+
+    v := prio & 0xf000 | sys_id & 0x0fff
+
+    id[0] = uint8(v >> 8)
+    id[1] = uint8(v)
+
+    copy(id[2:], addr)
+
+    return id
+}
+
+// Return the bridge priority.
+func (id BridgeId) Priority() uint16 {
+    return uint16(id[0] & 0xf0) << 8
+}
+
+// Return the system ID extension.
+func (id BridgeId) SystemId() uint16 {
+    return uint16(id[0] & 0x0f) << 8 | uint16(id[1])
+}
+
+// Return the MAC address of the bridge.
+func (id BridgeId) Addr() net.HardwareAddr {
+    return net.HardwareAddr(id[2:])
+}
+
+func (id BridgeId) String() string {
+    return fmt.Sprintf("%d.%d.%s", id.Priority(), id.SystemId(), id.Addr())
+}
+
+// Return the time value as a time.Duration.
+func (t Time) Duration() time.Duration {
+    return time.Duration(t) * time.Second / 256
+}
+
+func (t Time) String() string {
+    if t == 0 {
+        return ""
+    }
+
+    return t.Duration().String()
+}
+
+func (v Version) String() string {
+    switch v {
+    case STP:  return "STP"
+    case RSTP: return "RSTP"
+    case MSTP: return "MSTP"
+    default:   return fmt.Sprintf("%d", uint8(v))
+    }
+}
+
+func (t Type) String() string {
+    switch t {
+    case Config: return "config"
+    case RST:    return "rst"
+    case TCN:    return "tcn"
+    default:     return fmt.Sprintf("0x%x", uint8(t))
+    }
+}
+
+func (r PortRole) String() string {
+    switch r {
+    case RoleAlternate:  return "alternate"
+    case RoleRoot:       return "root"
+    case RoleDesignated: return "designated"
+    default:             return "unknown"
+    }
+}
+
+func (f Flags) String() string {
+    var flags []string
+
+    if f & TopologyChange != 0 {
+        flags = append(flags, "tc")
+    }
+
+    if f & Proposal != 0 {
+        flags = append(flags, "proposal")
+    }
+
+    if f.Role() != RoleUnknown {
+        flags = append(flags, f.Role().String())
+    }
+
+    if f & Learning != 0 {
+        flags = append(flags, "learning")
+    }
+
+    if f & Forwarding != 0 {
+        flags = append(flags, "forwarding")
+    }
+
+    if f & Agreement != 0 {
+        flags = append(flags, "agreement")
+    }
+
+    if f & TopologyChangeAck != 0 {
+        flags = append(flags, "tc-ack")
+    }
+
+    return strings.Join(flags, "|")
+}
+
+func (c MSTConfig) Equal(other MSTConfig) bool {
+    return c == other
+}
+
+func (m MSTI) Equal(other MSTI) bool {
+    return m == other
+}
@@ -0,0 +1,215 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package stp_test
+
+import "bytes"
+import "net"
+import "testing"
+import "time"
+
+import "github.com/ghedo/go.pkt/layers"
+import "github.com/ghedo/go.pkt/packet"
+import "github.com/ghedo/go.pkt/packet/eth"
+import "github.com/ghedo/go.pkt/packet/llc"
+import "github.com/ghedo/go.pkt/packet/stp"
+
+var test_simple = []byte{
+    0x00, 0x00, 0x00, 0x00, 0x01, 0x80, 0x00, 0x00, 0x11, 0x22, 0x33, 0x44,
+    0x55, 0x00, 0x00, 0x00, 0x04, 0x80, 0x01, 0x00, 0xaa, 0xbb, 0xcc, 0xdd,
+    0xee, 0x80, 0x02, 0x01, 0x00, 0x14, 0x00, 0x02, 0x00, 0x0f, 0x00,
+}
+
+func MakeTestSimple() *stp.Packet {
+    root, _   := net.ParseMAC("00:11:22:33:44:55")
+    bridge, _ := net.ParseMAC("00:aa:bb:cc:dd:ee")
+
+    return &stp.Packet{
+        Version: stp.STP,
+        Type: stp.Config,
+        Flags: stp.TopologyChange,
+        RootId: stp.MakeBridgeId(32768, 0, root),
+        RootPathCost: 4,
+        BridgeId: stp.MakeBridgeId(32768, 1, bridge),
+        PortId: 0x8002,
+        MessageAge: 1 * 256,
+        MaxAge: 20 * 256,
+        HelloTime: 2 * 256,
+        FwdDelay: 15 * 256,
+    }
+}
+
+func TestPack(t *testing.T) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_simple)))
+
+    p := MakeTestSimple()
+
+    err := p.Pack(&b)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if !bytes.Equal(test_simple, b.Buffer()) {
+        t.Fatalf("Raw packet mismatch: %x", b.Buffer())
+    }
+}
+
+func BenchmarkPack(bn *testing.B) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_simple)))
+
+    p := MakeTestSimple()
+
+    for n := 0; n < bn.N; n++ {
+        p.Pack(&b)
+    }
+}
+
+func TestUnpack(t *testing.T) {
+    var p stp.Packet
+
+    cmp := MakeTestSimple()
+
+    var b packet.Buffer
+    b.Init(test_simple)
+
+    err := p.Unpack(&b)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if !p.Equals(cmp) {
+        t.Fatalf("Packet mismatch:\n%s\n%s", &p, cmp)
+    }
+
+    if p.BridgeId.Priority() != 32768 || p.BridgeId.SystemId() != 1 ||
+       p.BridgeId.Addr().String() != "00:aa:bb:cc:dd:ee" {
+        t.Fatalf("Bridge ID mismatch: %s", p.BridgeId)
+    }
+
+    if p.MaxAge.Duration() != 20 * time.Second {
+        t.Fatalf("Max age mismatch: %s", p.MaxAge)
+    }
+}
+
+func BenchmarkUnpack(bn *testing.B) {
+    var p stp.Packet
+    var b packet.Buffer
+
+    for n := 0; n < bn.N; n++ {
+        b.Init(test_simple)
+        p.Unpack(&b)
+    }
+}
+
+func TestMSTP(t *testing.T) {
+    p := MakeTestSimple()
+    p.Version = stp.MSTP
+    p.Type    = stp.RST
+    p.Flags   = stp.Flags(stp.Learning | stp.Forwarding).WithRole(stp.RoleDesignated)
+
+    copy(p.MSTConfig.Name[:], "region1")
+    p.MSTConfig.Revision = 1
+    p.CISTBridgeId       = p.BridgeId
+    p.CISTHops           = 20
+
+    p.MSTIs = []stp.MSTI{
+        {
+            Flags: stp.Flags(stp.Agreement).WithRole(stp.RoleRoot),
+            RegRootId: p.RootId,
+            InternalCost: 20000,
+            BridgePrio: 0x80,
+            PortPrio: 0x80,
+            Hops: 19,
+        },
+    }
+
+    buf, err := layers.Pack(p)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if len(buf) != 118 || buf[36] != 0x00 || buf[37] != 80 {
+        t.Fatalf("Raw packet mismatch: %x", buf)
+    }
+
+    var q stp.Packet
+
+    _, err = layers.Unpack(buf, &q)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if !q.Equals(p) {
+        t.Fatalf("Packet mismatch:\n%s\n%s", &q, p)
+    }
+
+    if q.Flags.Role() != stp.RoleDesignated ||
+       q.MSTIs[0].Flags.Role() != stp.RoleRoot ||
+       q.MSTConfig.RegionName() != "region1" {
+        t.Fatalf("MST mismatch: %s %v", q.Flags, q.MSTIs)
+    }
+}
+
+func TestLLC(t *testing.T) {
+    eth_pkt := eth.Make()
+    eth_pkt.SrcAddr, _ = net.ParseMAC("00:aa:bb:cc:dd:ee")
+    eth_pkt.DstAddr, _ = net.ParseMAC("01:80:c2:00:00:00")
+
+    llc_pkt := llc.Make()
+    llc_pkt.Control = 0x03
+
+    tcn := &stp.Packet{ Type: stp.TCN }
+
+    buf, err := layers.Pack(eth_pkt, llc_pkt, tcn)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    raw := []byte{ 0x00, 0x07, 0x42, 0x42, 0x03, 0x00, 0x00, 0x00, 0x80 }
+
+    if !bytes.Equal(buf[12:], raw) {
+        t.Fatalf("Raw packet mismatch: %x", buf[12:])
+    }
+
+    /* Ethernet padding */
+    buf = append(buf, make([]byte, 60 - len(buf))...)
+
+    p, err := layers.UnpackAll(buf, packet.Eth)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    l := layers.FindLayer(p, packet.STP)
+    if l == nil || !l.Equals(tcn) {
+        t.Fatalf("Packet mismatch:\n%s\n%s", p, tcn)
+    }
+}
@@ -0,0 +1,224 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package http
+
+import "fmt"
+import "strconv"
+import "strings"
+import "time"
+
+// Message holds the parts common to requests and responses. The body is stored
+// decoded from the chunked transfer coding, if used. Start and End are the
+// times of the stream data carrying the first and last bytes of the message.
+type Message struct {
+    Version string
+    Header  Header
+    Body    []byte
+    Chunked bool
+    Trailer Header
+    Start   time.Time
+    End     time.Time
+}
+
+type Request struct {
+    Method string
+    URI    string
+    Message
+}
+
+type Response struct {
+    Status int
+    Reason string
+    Message
+}
+
+// Header fields, in the order they appear in the message.
+type Header []Field
+
+type Field struct {
+    Name  string
+    Value string
+}
+
+// Return the value of the first field with the given (case insensitive) name,
+// or an empty string.
+func (h Header) Get(name string) string {
+    for _, f := range h {
+        if strings.EqualFold(f.Name, name) {
+            return f.Value
+        }
+    }
+
+    return ""
+}
+
+// Return the values of all the fields with the given (case insensitive) name.
+func (h Header) Values(name string) []string {
+    var values []string
+
+    for _, f := range h {
+        if strings.EqualFold(f.Name, name) {
+            values = append(values, f.Value)
+        }
+    }
+
+    return values
+}
+
+// Return whether the given comma separated field contains the given token
+// (e.g. "Connection: keep-alive, Upgrade").
+func (h Header) HasToken(name, token string) bool {
+    for _, v := range h.Values(name) {
+        for _, t := range strings.Split(v, ",") {
+            if strings.EqualFold(strings.TrimSpace(t), token) {
+                return true
+            }
+        }
+    }
+
+    return false
+}
+
+// Return whether the connection persists after the message. HTTP/1.1
+// connections are persistent unless closed explicitly, while HTTP/1.0 ones
+// need to be kept alive explicitly.
+func (m *Message) KeepAlive() bool {
+    if m.Header.HasToken("Connection", "close") {
+        return false
+    }
+
+    if m.Version == "HTTP/1.0" {
+        return m.Header.HasToken("Connection", "keep-alive")
+    }
+
+    return true
+}
+
+/* return whether the message uses the chunked transfer coding */
+func (m *Message) chunked() bool {
+    codings := m.Header.Values("Transfer-Encoding")
+    if len(codings) == 0 {
+        return false
+    }
+
+    last := strings.Split(codings[len(codings) - 1], ",")
+
+    return strings.EqualFold(strings.TrimSpace(last[len(last) - 1]),
+                             "chunked")
+}
+
+/* return the content length, or -1 if not present */
+func (m *Message) content_length() (int64, error) {
+    value := m.Header.Get("Content-Length")
+    if value == "" {
+        return -1, nil
+    }
+
+    /* repeated values in the same field are allowed if identical */
+    value = strings.TrimSpace(strings.Split(value, ",")[0])
+
+    length, err := strconv.ParseInt(value, 10, 64)
+    if err != nil || length < 0 {
+        return -1, fmt.Errorf("Invalid content length %q", value)
+    }
+
+    return length, nil
+}
+
+func (r *Request) String() string {
+    return fmt.Sprintf("%s %s %s", r.Method, r.URI, r.Version)
+}
+
+func (r *Response) String() string {
+    return fmt.Sprintf("%s %d %s", r.Version, r.Status, r.Reason)
+}
+
+/* parse a request line (e.g. "GET / HTTP/1.1") */
+func parse_request_line(line string) (*Request, bool) {
+    parts := strings.Split(line, " ")
+    if len(parts) != 3 || !is_version(parts[2]) || !is_token(parts[0]) ||
+       parts[1] == "" {
+        return nil, false
+    }
+
+    return &Request{
+        Method: parts[0],
+        URI: parts[1],
+        Message: Message{ Version: parts[2] },
+    }, true
+}
+
+/* parse a status line (e.g. "HTTP/1.1 200 OK") */
+func parse_status_line(line string) (*Response, bool) {
+    parts := strings.SplitN(line, " ", 3)
+    if len(parts) < 2 || !is_version(parts[0]) || len(parts[1]) != 3 {
+        return nil, false
+    }
+
+    status, err := strconv.Atoi(parts[1])
+    if err != nil || status < 100 {
+        return nil, false
+    }
+
+    rsp := &Response{
+        Status: status,
+        Message: Message{ Version: parts[0] },
+    }
+
+    if len(parts) == 3 {
+        rsp.Reason = parts[2]
+    }
+
+    return rsp, true
+}
+
+func is_version(s string) bool {
+    return len(s) == 8 && strings.HasPrefix(s, "HTTP/1.") &&
+           s[7] >= '0' && s[7] <= '9'
+}
+
+const separators = "\"(),/:;<=>?@[\\]{}"
+
+func is_token(s string) bool {
+    if s == "" {
+        return false
+    }
+
+    for i := 0; i < len(s); i++ {
+        c := s[i]
+
+        if c <= ' ' || c >= 0x7f || strings.IndexByte(separators, c) >= 0 {
+            return false
+        }
+    }
+
+    return true
+}
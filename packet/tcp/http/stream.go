@@ -0,0 +1,525 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+// Provides a parser for the HTTP/1.x messages carried by a TCP connection,
+// which pairs requests and responses into transactions.
+//
+// The parser works on reassembled streams: the data sent by the client and by
+// the server must be given in order, but the two directions are independent.
+// Captures that start in the middle of a connection are handled by skipping
+// data until the start of a request or response, and responses that precede
+// any known request are reported without one.
+package http
+
+import "bytes"
+import "strconv"
+import "strings"
+import "time"
+
+// Transaction pairs a request with its response. Either can be nil, when the
+// capture started after the request was sent or ended before the response was
+// received.
+type Transaction struct {
+    Request  *Request
+    Response *Response
+}
+
+// Stream tracks the two directions of a single connection.
+type Stream struct {
+    client       parser
+    server       parser
+    pending      []*Request
+    transactions []Transaction
+    reported     int
+    tunnel       bool
+}
+
+type state uint8
+
+const (
+    st_start state = iota
+    st_header
+    st_body
+    st_body_close
+    st_chunk_size
+    st_chunk_data
+    st_chunk_end
+    st_trailer
+    st_tunnel
+)
+
+/* start lines, header lines and chunk sizes longer than this are discarded */
+const max_line_len = 64 * 1024
+
+type parser struct {
+    stream   *Stream
+    response bool
+    state    state
+    buf      []byte
+    off      int64
+    marks    []mark
+    req      *Request
+    rsp      *Response
+    msg      *Message
+    length   int64
+    skipped  int
+}
+
+/* end offset of the data received at the given time */
+type mark struct {
+    end int64
+    t   time.Time
+}
+
+// Create a new stream.
+func New() *Stream {
+    s := &Stream{}
+
+    s.client.stream   = s
+    s.server.stream   = s
+    s.server.response = true
+
+    return s
+}
+
+// Add the given data sent by the client at the given time, and return the
+// transactions completed by it.
+func (s *Stream) Client(data []byte, t time.Time) []Transaction {
+    s.client.feed(data, t)
+    return s.completed()
+}
+
+// Add the given data sent by the server at the given time, and return the
+// transactions completed by it.
+func (s *Stream) Server(data []byte, t time.Time) []Transaction {
+    s.server.feed(data, t)
+    return s.completed()
+}
+
+// Signal the end of the connection, and return the transactions completed by
+// it: the response whose body is delimited by the connection close, and the
+// requests left without response.
+func (s *Stream) Close() []Transaction {
+    if s.server.state == st_body_close {
+        s.server.emit()
+    }
+
+    for _, req := range s.pending {
+        s.transactions = append(s.transactions, Transaction{ Request: req })
+    }
+
+    s.pending = nil
+
+    return s.completed()
+}
+
+// Return all the transactions completed so far.
+func (s *Stream) Transactions() []Transaction {
+    return s.transactions
+}
+
+// Return whether the connection switched to a different protocol (e.g. after
+// a CONNECT request or a WebSocket upgrade), in which case the data following
+// the switch is ignored.
+func (s *Stream) Tunnel() bool {
+    return s.tunnel
+}
+
+// Return the number of bytes skipped while looking for the start of messages,
+// or because they couldn't be parsed.
+func (s *Stream) Skipped() int {
+    return s.client.skipped + s.server.skipped
+}
+
+func (s *Stream) completed() []Transaction {
+    done := s.transactions[s.reported:]
+    s.reported = len(s.transactions)
+
+    return done
+}
+
+/* return the request the given response answers, if known */
+func (s *Stream) request_for(rsp *Response) *Request {
+    /* responses sent before the request were answering a missed one */
+    if len(s.pending) == 0 || rsp.Start.Before(s.pending[0].Start) {
+        return nil
+    }
+
+    return s.pending[0]
+}
+
+func (s *Stream) add_request(req *Request) {
+    s.pending = append(s.pending, req)
+}
+
+func (s *Stream) add_response(rsp *Response) {
+    /* interim responses (e.g. 100 Continue) are followed by the final one */
+    if rsp.Status / 100 == 1 && rsp.Status != 101 {
+        return
+    }
+
+    req := s.request_for(rsp)
+    if req != nil {
+        s.pending = s.pending[1:]
+    }
+
+    if switches_protocol(req, rsp) {
+        s.tunnel       = true
+        s.client.state = st_tunnel
+        s.server.state = st_tunnel
+    }
+
+    s.transactions = append(s.transactions, Transaction{
+        Request: req,
+        Response: rsp,
+    })
+}
+
+func switches_protocol(req *Request, rsp *Response) bool {
+    if rsp.Status == 101 {
+        return true
+    }
+
+    return req != nil && req.Method == "CONNECT" && rsp.Status / 100 == 2
+}
+
+func (p *parser) feed(data []byte, t time.Time) {
+    if len(data) == 0 {
+        return
+    }
+
+    p.buf   = append(p.buf, data...)
+    p.marks = append(p.marks, mark{
+        end: p.off + int64(len(p.buf)),
+        t: t,
+    })
+
+    for p.step() {
+    }
+}
+
+/* return the time the byte at the given stream offset was received */
+func (p *parser) time_at(off int64) time.Time {
+    for _, m := range p.marks {
+        if off < m.end {
+            return m.t
+        }
+    }
+
+    return p.marks[len(p.marks) - 1].t
+}
+
+func (p *parser) consume(n int) {
+    p.buf  = p.buf[n:]
+    p.off += int64(n)
+
+    /* keep the mark of the last consumed byte */
+    for len(p.marks) > 1 && p.marks[0].end < p.off {
+        p.marks = p.marks[1:]
+    }
+
+    if len(p.buf) == 0 {
+        p.buf = nil
+    }
+}
+
+/* return the next line, without its terminator */
+func (p *parser) line() (string, bool) {
+    i := bytes.IndexByte(p.buf, '\n')
+    if i < 0 {
+        if len(p.buf) > max_line_len {
+            p.resync(len(p.buf))
+        }
+
+        return "", false
+    }
+
+    line := string(bytes.TrimSuffix(p.buf[:i], []byte{ '\r' }))
+    p.consume(i + 1)
+
+    return line, true
+}
+
+/* drop the current message and the given amount of data */
+func (p *parser) resync(n int) {
+    p.consume(n)
+
+    p.skipped += n
+    p.state    = st_start
+    p.req      = nil
+    p.rsp      = nil
+    p.msg      = nil
+}
+
+func (p *parser) step() bool {
+    switch p.state {
+    case st_start:
+        start := p.off
+
+        line, ok := p.line()
+        if !ok {
+            return false
+        }
+
+        /* empty lines between messages are allowed */
+        if line == "" {
+            return true
+        }
+
+        if p.response {
+            p.rsp, ok = parse_status_line(line)
+            if ok {
+                p.msg = &p.rsp.Message
+            }
+        } else {
+            p.req, ok = parse_request_line(line)
+            if ok {
+                p.msg = &p.req.Message
+            }
+        }
+
+        if !ok {
+            p.skipped += int(p.off - start)
+            return true
+        }
+
+        p.msg.Start = p.time_at(start)
+        p.state     = st_header
+
+    case st_header, st_trailer:
+        line, ok := p.line()
+        if !ok {
+            return false
+        }
+
+        hdr := &p.msg.Header
+        if p.state == st_trailer {
+            hdr = &p.msg.Trailer
+        }
+
+        if line == "" {
+            if p.state == st_header {
+                p.begin_body()
+            } else {
+                p.emit()
+            }
+
+            return true
+        }
+
+        /* obsolete line folding */
+        if (line[0] == ' ' || line[0] == '\t') && len(*hdr) > 0 {
+            last := &(*hdr)[len(*hdr) - 1]
+            last.Value += " " + strings.TrimSpace(line)
+            return true
+        }
+
+        i := strings.IndexByte(line, ':')
+        if i <= 0 || !is_token(line[:i]) {
+            p.resync(0)
+            return true
+        }
+
+        *hdr = append(*hdr, Field{
+            Name: line[:i],
+            Value: strings.TrimSpace(line[i + 1:]),
+        })
+
+    case st_body, st_chunk_data:
+        if len(p.buf) == 0 {
+            return false
+        }
+
+        n := int64(len(p.buf))
+        if n > p.length {
+            n = p.length
+        }
+
+        p.msg.Body = append(p.msg.Body, p.buf[:n]...)
+        p.consume(int(n))
+
+        p.length -= n
+
+        if p.length == 0 {
+            if p.state == st_body {
+                p.emit()
+            } else {
+                p.state = st_chunk_end
+            }
+        }
+
+    case st_body_close:
+        if len(p.buf) == 0 {
+            return false
+        }
+
+        p.msg.Body = append(p.msg.Body, p.buf...)
+        p.consume(len(p.buf))
+
+    case st_chunk_size:
+        line, ok := p.line()
+        if !ok {
+            return false
+        }
+
+        /* ignore chunk extensions */
+        if i := strings.IndexByte(line, ';'); i >= 0 {
+            line = line[:i]
+        }
+
+        size, err := strconv.ParseInt(strings.TrimSpace(line), 16, 64)
+        if err != nil || size < 0 {
+            p.resync(0)
+            return true
+        }
+
+        if size == 0 {
+            p.state = st_trailer
+        } else {
+            p.length = size
+            p.state  = st_chunk_data
+        }
+
+    case st_chunk_end:
+        line, ok := p.line()
+        if !ok {
+            return false
+        }
+
+        if line != "" {
+            p.resync(0)
+            return true
+        }
+
+        p.state = st_chunk_size
+
+    case st_tunnel:
+        p.consume(len(p.buf))
+        return false
+    }
+
+    return true
+}
+
+/*
+ * Determine how the body of the current message is delimited (RFC 7230,
+ * section 3.3.3). Requests without length have no body, while responses
+ * without length are delimited by the connection close.
+ */
+func (p *parser) begin_body() {
+    if p.response {
+        req    := p.stream.request_for(p.rsp)
+        status := p.rsp.Status
+
+        if status / 100 == 1 || status == 204 || status == 304 ||
+           switches_protocol(req, p.rsp) ||
+           (req != nil && req.Method == "HEAD") {
+            p.emit()
+            return
+        }
+    }
+
+    if p.msg.chunked() {
+        p.msg.Chunked = true
+        p.state       = st_chunk_size
+        return
+    }
+
+    length, err := p.msg.content_length()
+    if err != nil {
+        p.resync(0)
+        return
+    }
+
+    switch {
+    case length > 0:
+        p.length = length
+        p.state  = st_body
+
+    case length == 0 || !p.response:
+        p.emit()
+
+    default:
+        p.state = st_body_close
+    }
+}
+
+/* hand the current message to the stream */
+func (p *parser) emit() {
+    p.msg.End = p.time_at(p.off - 1)
+
+    req, rsp := p.req, p.rsp
+
+    p.state = st_start
+    p.req   = nil
+    p.rsp   = nil
+    p.msg   = nil
+
+    if p.response {
+        p.stream.add_response(rsp)
+    } else {
+        p.stream.add_request(req)
+    }
+}
+
+// Return the time between the start of the request and the end of the
+// response, or 0 if either is missing.
+func (t Transaction) Duration() time.Duration {
+    if t.Request == nil || t.Response == nil {
+        return 0
+    }
+
+    return t.Response.End.Sub(t.Request.Start)
+}
+
+// Return the time between the end of the request and the start of the
+// response (i.e. the time the server took to start answering), or 0 if either
+// is missing.
+func (t Transaction) Wait() time.Duration {
+    if t.Request == nil || t.Response == nil {
+        return 0
+    }
+
+    return t.Response.Start.Sub(t.Request.End)
+}
+
+func (t Transaction) String() string {
+    var req, rsp string = "-", "-"
+
+    if t.Request != nil {
+        req = t.Request.String()
+    }
+
+    if t.Response != nil {
+        rsp = t.Response.String()
+    }
+
+    return req + " -> " + rsp
+}
@@ -0,0 +1,197 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package http_test
+
+import "fmt"
+import "testing"
+import "time"
+
+import "github.com/ghedo/go.pkt/packet/tcp/http"
+
+var t0 = time.Date(2020, time.March, 1, 10, 0, 0, 0, time.UTC)
+
+func at(ms int) time.Time {
+    return t0.Add(time.Duration(ms) * time.Millisecond)
+}
+
+func TestPipelining(t *testing.T) {
+    s := http.New()
+
+    done := s.Client([]byte("GET /a HTTP/1.1\r\nHost: example.com\r\n\r\n" +
+                            "POST /b HTTP/1.1\r\nHost: example.com\r\n" +
+                            "Content-Length: 5\r\n\r\nhel"), at(0))
+    if len(done) != 0 {
+        t.Fatalf("Unexpected transactions: %v", done)
+    }
+
+    s.Client([]byte("lo"), at(1))
+
+    done = s.Server([]byte("HTTP/1.1 200 OK\r\nContent-Length: 3\r\n\r\nabc" +
+                           "HTTP/1.1 201 Created\r\n" +
+                           "Transfer-Encoding: chunked\r\n\r\n4;ext=1\r\n" +
+                           "wiki\r\n"), at(10))
+    if len(done) != 1 || done[0].Request.URI != "/a" ||
+       string(done[0].Response.Body) != "abc" {
+        t.Fatalf("Transactions mismatch: %v", done)
+    }
+
+    done = s.Server([]byte("5\r\npedia\r\n0\r\nExpires: never\r\n\r\n"),
+                    at(30))
+    if len(done) != 1 {
+        t.Fatalf("Transactions mismatch: %v", done)
+    }
+
+    tr := done[0]
+
+    if tr.Request.Method != "POST" || string(tr.Request.Body) != "hello" ||
+       tr.Request.Header.Get("host") != "example.com" {
+        t.Fatalf("Request mismatch: %s %q", tr.Request, tr.Request.Body)
+    }
+
+    if tr.Response.Status != 201 || !tr.Response.Chunked ||
+       string(tr.Response.Body) != "wikipedia" ||
+       tr.Response.Trailer.Get("Expires") != "never" ||
+       !tr.Response.KeepAlive() {
+        t.Fatalf("Response mismatch: %s %q", tr.Response, tr.Response.Body)
+    }
+
+    if tr.Duration() != 30 * time.Millisecond ||
+       tr.Wait() != 9 * time.Millisecond {
+        t.Fatalf("Timing mismatch: %s %s", tr.Duration(), tr.Wait())
+    }
+
+    if len(s.Transactions()) != 2 || s.Skipped() != 0 {
+        t.Fatalf("Stream mismatch: %v", s.Transactions())
+    }
+}
+
+func TestMidConnection(t *testing.T) {
+    s := http.New()
+
+    /* the tail of a response, and a response to a missed request */
+    s.Server([]byte("dy of a previous response\r\nmore body\r\n" +
+                    "HTTP/1.1 404 Not Found\r\nContent-Length: 0\r\n\r\n"),
+             at(0))
+
+    s.Client([]byte("d\": 1}\r\nGET /c HTTP/1.1\r\n\r\n"), at(5))
+    s.Server([]byte("HTTP/1.1 304 Not Modified\r\nETag: \"x\"\r\n\r\n"), at(8))
+
+    tr := s.Transactions()
+    if len(tr) != 2 {
+        t.Fatalf("Transactions mismatch: %v", tr)
+    }
+
+    if tr[0].Request != nil || tr[0].Response.Status != 404 {
+        t.Fatalf("Transaction mismatch: %s", tr[0])
+    }
+
+    if tr[1].Request.URI != "/c" || tr[1].Response.Status != 304 {
+        t.Fatalf("Transaction mismatch: %s", tr[1])
+    }
+
+    if s.Skipped() != 38 + 8 {
+        t.Fatalf("Skipped mismatch: %d", s.Skipped())
+    }
+}
+
+func TestClose(t *testing.T) {
+    s := http.New()
+
+    s.Client([]byte("GET / HTTP/1.0\r\n\r\nHEAD / HTTP/1.0\r\n\r\n" +
+                    "GET /x HTTP/1.0\r\n\r\n"), at(0))
+
+    /* responses to HEAD requests have no body */
+    s.Server([]byte("HTTP/1.0 200 OK\r\nContent-Length: 2\r\n\r\nok" +
+                    "HTTP/1.0 200 OK\r\nContent-Length: 100\r\n\r\n" +
+                    "HTTP/1.0 200 OK\r\n\r\nuntil "), at(1))
+    s.Server([]byte("close"), at(2))
+
+    if len(s.Transactions()) != 2 {
+        t.Fatalf("Transactions mismatch: %v", s.Transactions())
+    }
+
+    done := s.Close()
+    if len(done) != 1 || string(done[0].Response.Body) != "until close" ||
+       done[0].Response.KeepAlive() || !done[0].Response.End.Equal(at(2)) {
+        t.Fatalf("Transactions mismatch: %v", done)
+    }
+
+    /* requests without response */
+    s = http.New()
+    s.Client([]byte("GET / HTTP/1.1\r\n\r\n"), at(0))
+
+    done = s.Close()
+    if len(done) != 1 || done[0].Response != nil {
+        t.Fatalf("Transactions mismatch: %v", done)
+    }
+}
+
+func TestTunnel(t *testing.T) {
+    s := http.New()
+
+    s.Client([]byte("POST /up HTTP/1.1\r\nExpect: 100-continue\r\n" +
+                    "Content-Length: 2\r\n\r\n"), at(0))
+    s.Server([]byte("HTTP/1.1 100 Continue\r\n\r\n"), at(1))
+    s.Client([]byte("{}"), at(2))
+    s.Server([]byte("HTTP/1.1 204 No Content\r\n\r\n"), at(3))
+
+    s.Client([]byte("CONNECT example.com:443 HTTP/1.1\r\n\r\n"), at(4))
+    s.Server([]byte("HTTP/1.1 200 Connection established\r\n\r\n"), at(5))
+    s.Client([]byte("\x16\x03\x01\x00\xa5GET / HTTP/1.1\r\n\r\n"), at(6))
+
+    tr := s.Transactions()
+    if len(tr) != 2 || tr[0].Response.Status != 204 ||
+       string(tr[0].Request.Body) != "{}" ||
+       tr[1].Request.Method != "CONNECT" || !s.Tunnel() {
+        t.Fatalf("Transactions mismatch: %v", tr)
+    }
+
+    if len(s.Close()) != 0 {
+        t.Fatalf("Unexpected transactions")
+    }
+}
+
+func ExampleStream() {
+    s := http.New()
+
+    now := time.Now()
+
+    s.Client([]byte("GET / HTTP/1.1\r\nHost: example.com\r\n\r\n"), now)
+
+    done := s.Server([]byte("HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nhi"),
+                     now.Add(20 * time.Millisecond))
+
+    for _, tr := range done {
+        fmt.Println(tr, tr.Duration())
+    }
+
+    // Output: GET / HTTP/1.1 -> HTTP/1.1 200 OK 20ms
+}
@@ -31,6 +31,7 @@
 // Provides encoding and decoding for TCP packets.
 package tcp
 
+import "encoding/binary"
 import "strings"
 
 import "github.com/ghedo/go.pkt/packet"
@@ -48,9 +49,17 @@ type Packet struct {
     Urgent      uint16        `string:"urg"`
     Options     []Option      `cmp:"skip" string:"skip"`
     csum_seed   uint32        `cmp:"skip" string:"skip"`
+    dns_msg     bool          `cmp:"skip" string:"skip"`
+    tls_record  bool          `cmp:"skip" string:"skip"`
     pkt_payload packet.Packet `cmp:"skip" string:"skip"`
 }
 
+// Well-known ports used to guess the payload type.
+const (
+    DNS   uint16 = 53
+    HTTPS        = 443
+)
+
 type Flags uint16
 
 const (
@@ -272,6 +281,15 @@ options:
         buf.Next(int(p.DataOff) * 4 - buf.LayerLen())
     }
 
+    data := buf.Bytes()
+
+    p.dns_msg = len(data) > 2 &&
+                int(binary.BigEndian.Uint16(data)) == len(data) - 2
+
+    /* content type (change_cipher_spec to heartbeat) and SSLv3+ version */
+    p.tls_record = len(data) >= 5 && data[0] >= 20 && data[0] <= 24 &&
+                   data[1] == 3 && data[2] <= 4
+
     return nil
 }
 
@@ -279,7 +297,18 @@ func (p *Packet) Payload() packet.Packet {
     return p.pkt_payload
 }
 
+// Guess the payload type. Since segments are not reassembled, DNS messages are
+// only decoded when the segment carries exactly one of them, and TLS records
+// only when the segment starts with one.
 func (p *Packet) GuessPayloadType() packet.Type {
+    if (p.SrcPort == DNS || p.DstPort == DNS) && p.dns_msg {
+        return packet.DNSTCP
+    }
+
+    if (p.SrcPort == HTTPS || p.DstPort == HTTPS) && p.tls_record {
+        return packet.TLS
+    }
+
     return packet.Raw
 }
 
@@ -0,0 +1,257 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package tls
+
+import "crypto/md5"
+import "crypto/sha256"
+import "encoding/hex"
+import "fmt"
+import "sort"
+import "strconv"
+import "strings"
+
+// Return whether the given value is a GREASE value (RFC 8701), which clients
+// add to cipher suites, extensions and groups to prevent ossification.
+func IsGREASE(v uint16) bool {
+    return v & 0x0f0f == 0x0a0a && v >> 8 == v & 0xff
+}
+
+// Return the JA3 string of the given ClientHello, that is the version, cipher
+// suites, extensions, supported groups and point formats, without GREASE
+// values.
+func JA3String(ch *ClientHello) string {
+    var exts []uint16
+
+    for _, e := range ch.Extensions {
+        exts = append(exts, uint16(e.Type))
+    }
+
+    var formats []uint16
+
+    for _, f := range ch.ECPointFormats() {
+        formats = append(formats, uint16(f))
+    }
+
+    return strings.Join([]string{
+        strconv.Itoa(int(ch.Version)),
+        join_decimal(ch.CipherSuites),
+        join_decimal(exts),
+        join_decimal(ch.SupportedGroups()),
+        join_decimal(formats),
+    }, ",")
+}
+
+// Return the JA3 fingerprint of the given ClientHello, that is the MD5 hash of
+// its JA3 string.
+func JA3(ch *ClientHello) string {
+    sum := md5.Sum([]byte(JA3String(ch)))
+    return hex.EncodeToString(sum[:])
+}
+
+// Return the JA3S string of the given ServerHello, that is the version, cipher
+// suite and extensions.
+func JA3SString(sh *ServerHello) string {
+    var exts []uint16
+
+    for _, e := range sh.Extensions {
+        exts = append(exts, uint16(e.Type))
+    }
+
+    return strings.Join([]string{
+        strconv.Itoa(int(sh.Version)),
+        strconv.Itoa(int(sh.CipherSuite)),
+        join_decimal(exts),
+    }, ",")
+}
+
+// Return the JA3S fingerprint of the given ServerHello, that is the MD5 hash
+// of its JA3S string.
+func JA3S(sh *ServerHello) string {
+    sum := md5.Sum([]byte(JA3SString(sh)))
+    return hex.EncodeToString(sum[:])
+}
+
+// Return the JA4 fingerprint of the given ClientHello sent over TCP (use JA4QUIC
+// for QUIC).
+func JA4(ch *ClientHello) string {
+    return ja4(ch, 't')
+}
+
+// Return the JA4 fingerprint of the given ClientHello sent over QUIC.
+func JA4QUIC(ch *ClientHello) string {
+    return ja4(ch, 'q')
+}
+
+func ja4(ch *ClientHello, proto byte) string {
+    ciphers := strip_grease(ch.CipherSuites)
+
+    var exts []uint16
+
+    for _, e := range ch.Extensions {
+        exts = append(exts, uint16(e.Type))
+    }
+
+    exts = strip_grease(exts)
+
+    sni := "i"
+    if ch.Extension(ServerName) != nil {
+        sni = "d"
+    }
+
+    a := fmt.Sprintf("%c%s%s%02d%02d%s", proto, ja4_version(ch), sni,
+                     min99(len(ciphers)), min99(len(exts)), ja4_alpn(ch))
+
+    /* the SNI and ALPN extensions are already part of the first section */
+    var hashed_exts []uint16
+
+    for _, e := range exts {
+        if e != uint16(ServerName) && e != uint16(ALPN) {
+            hashed_exts = append(hashed_exts, e)
+        }
+    }
+
+    b := ja4_hash(join_hex(sorted(ciphers)), len(ciphers) == 0)
+
+    c_str := join_hex(sorted(hashed_exts))
+
+    if algs := ch.SignatureAlgorithms(); len(algs) > 0 {
+        c_str += "_" + join_hex(algs)
+    }
+
+    c := ja4_hash(c_str, len(hashed_exts) == 0)
+
+    return a + "_" + b + "_" + c
+}
+
+/* highest version offered, preferring the supported_versions extension */
+func ja4_version(ch *ClientHello) string {
+    version := ch.Version
+
+    for _, v := range ch.SupportedVersions() {
+        if !IsGREASE(uint16(v)) && v > version {
+            version = v
+        }
+    }
+
+    switch version {
+    case TLS13:  return "13"
+    case TLS12:  return "12"
+    case TLS11:  return "11"
+    case TLS10:  return "10"
+    case SSL30:  return "s3"
+    case 0x0002: return "s2"
+    case 0xfeff: return "d1"
+    case 0xfefd: return "d2"
+    case 0xfefc: return "d3"
+    default:     return "00"
+    }
+}
+
+/* first and last characters of the first ALPN protocol */
+func ja4_alpn(ch *ClientHello) string {
+    protos := ch.ALPN()
+    if len(protos) == 0 || protos[0] == "" {
+        return "00"
+    }
+
+    p := protos[0]
+
+    if !is_alnum(p[0]) || !is_alnum(p[len(p) - 1]) {
+        h := hex.EncodeToString([]byte(p))
+        return h[:1] + h[len(h) - 1:]
+    }
+
+    return p[:1] + p[len(p) - 1:]
+}
+
+/* truncated SHA256 hash, or zeros if the list is empty */
+func ja4_hash(s string, empty bool) string {
+    if empty {
+        return "000000000000"
+    }
+
+    sum := sha256.Sum256([]byte(s))
+
+    return hex.EncodeToString(sum[:])[:12]
+}
+
+func strip_grease(values []uint16) []uint16 {
+    var list []uint16
+
+    for _, v := range values {
+        if !IsGREASE(v) {
+            list = append(list, v)
+        }
+    }
+
+    return list
+}
+
+func sorted(values []uint16) []uint16 {
+    list := append([]uint16{}, values...)
+
+    sort.Slice(list, func(i, j int) bool { return list[i] < list[j] })
+
+    return list
+}
+
+func join_decimal(values []uint16) string {
+    var s []string
+
+    for _, v := range strip_grease(values) {
+        s = append(s, strconv.Itoa(int(v)))
+    }
+
+    return strings.Join(s, "-")
+}
+
+func join_hex(values []uint16) string {
+    var s []string
+
+    for _, v := range values {
+        s = append(s, fmt.Sprintf("%04x", v))
+    }
+
+    return strings.Join(s, ",")
+}
+
+func min99(n int) int {
+    if n > 99 {
+        return 99
+    }
+
+    return n
+}
+
+func is_alnum(c byte) bool {
+    return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') ||
+           (c >= 'A' && c <= 'Z')
+}
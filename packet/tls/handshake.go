@@ -0,0 +1,659 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package tls
+
+import "bytes"
+import "crypto/x509"
+import "encoding/binary"
+import "fmt"
+
+// Handshake message. The data doesn't include the message header.
+type Handshake struct {
+    Type HandshakeType
+    Data []byte
+}
+
+type HandshakeType uint8
+
+const (
+    HelloRequest        HandshakeType = 0
+    ClientHelloMsg                    = 1
+    ServerHelloMsg                    = 2
+    NewSessionTicket                  = 4
+    EndOfEarlyData                    = 5
+    EncryptedExtensions               = 8
+    CertificateMsg                    = 11
+    ServerKeyExchange                 = 12
+    CertificateRequest                = 13
+    ServerHelloDone                   = 14
+    CertificateVerify                 = 15
+    ClientKeyExchange                 = 16
+    Finished                          = 20
+    KeyUpdate                         = 24
+)
+
+type ClientHello struct {
+    Version      Version
+    Random       []byte
+    SessionID    []byte
+    CipherSuites []uint16
+    Compression  []uint8
+    Extensions   []Extension
+}
+
+type ServerHello struct {
+    Version     Version
+    Random      []byte
+    SessionID   []byte
+    CipherSuite uint16
+    Compression uint8
+    Extensions  []Extension
+}
+
+type Extension struct {
+    Type ExtensionType
+    Data []byte
+}
+
+type ExtensionType uint16
+
+const (
+    ServerName           ExtensionType = 0
+    StatusRequest                      = 5
+    SupportedGroups                    = 10
+    ECPointFormats                     = 11
+    SignatureAlgorithms                = 13
+    ALPN                               = 16
+    SCT                                = 18
+    Padding                            = 21
+    EncryptThenMAC                     = 22
+    ExtendedMasterSecret               = 23
+    CompressCertificate                = 27
+    RecordSizeLimit                    = 28
+    SessionTicket                      = 35
+    PreSharedKey                       = 41
+    EarlyData                          = 42
+    SupportedVersions                  = 43
+    PSKKeyExchangeModes                = 45
+    KeyShare                           = 51
+    EncryptedClientHello               = 0xfe0d
+    RenegotiationInfo                  = 0xff01
+)
+
+// Key share entry of the key_share extension.
+type KeyShareEntry struct {
+    Group uint16
+    Key   []byte
+}
+
+/* ServerHello random of HelloRetryRequest messages (RFC 8446, section 4.1.3) */
+var hello_retry_random = []byte{
+    0xcf, 0x21, 0xad, 0x74, 0xe5, 0x9a, 0x61, 0x11,
+    0xbe, 0x1d, 0x8c, 0x02, 0x1e, 0x65, 0xb8, 0x91,
+    0xc2, 0xa2, 0x11, 0x16, 0x7a, 0xbb, 0x8c, 0x5e,
+    0x07, 0x9e, 0x09, 0xe2, 0xc8, 0xa8, 0x33, 0x9c,
+}
+
+/* split the given data into complete handshake messages */
+func split_handshakes(data []byte) ([]Handshake, []byte) {
+    var msgs []Handshake
+
+    for len(data) >= 4 {
+        length := int(data[1]) << 16 | int(data[2]) << 8 | int(data[3])
+        if len(data) < 4 + length {
+            break
+        }
+
+        msgs = append(msgs, Handshake{
+            Type: HandshakeType(data[0]),
+            Data: data[4:4 + length],
+        })
+
+        data = data[4 + length:]
+    }
+
+    return msgs, data
+}
+
+// Encode the handshake message, including its header.
+func (h Handshake) Bytes() []byte {
+    length := len(h.Data)
+
+    data := []byte{
+        uint8(h.Type), uint8(length >> 16), uint8(length >> 8), uint8(length),
+    }
+
+    return append(data, h.Data...)
+}
+
+/* reader of length-prefixed vectors */
+type reader struct {
+    data []byte
+    err  bool
+}
+
+func (r *reader) next(n int) []byte {
+    if r.err || len(r.data) < n {
+        r.err = true
+        return nil
+    }
+
+    data  := r.data[:n]
+    r.data = r.data[n:]
+
+    return data
+}
+
+func (r *reader) u8() uint8 {
+    if d := r.next(1); d != nil {
+        return d[0]
+    }
+
+    return 0
+}
+
+func (r *reader) u16() uint16 {
+    if d := r.next(2); d != nil {
+        return binary.BigEndian.Uint16(d)
+    }
+
+    return 0
+}
+
+func (r *reader) u24() int {
+    if d := r.next(3); d != nil {
+        return int(d[0]) << 16 | int(d[1]) << 8 | int(d[2])
+    }
+
+    return 0
+}
+
+func (r *reader) vec8() []byte {
+    return r.next(int(r.u8()))
+}
+
+func (r *reader) vec16() []byte {
+    return r.next(int(r.u16()))
+}
+
+func (r *reader) vec24() []byte {
+    return r.next(r.u24())
+}
+
+func (r *reader) u16_list(data []byte) []uint16 {
+    if len(data) % 2 != 0 {
+        r.err = true
+        return nil
+    }
+
+    var list []uint16
+
+    for i := 0; i < len(data); i += 2 {
+        list = append(list, binary.BigEndian.Uint16(data[i:]))
+    }
+
+    return list
+}
+
+func (r *reader) extensions() []Extension {
+    /* the extensions are optional */
+    if len(r.data) == 0 || r.err {
+        return nil
+    }
+
+    ext_data := &reader{ data: r.vec16() }
+
+    var exts []Extension
+
+    for !ext_data.err && len(ext_data.data) > 0 {
+        t    := ExtensionType(ext_data.u16())
+        data := ext_data.vec16()
+
+        exts = append(exts, Extension{ Type: t, Data: data })
+    }
+
+    r.err = r.err || ext_data.err
+
+    return exts
+}
+
+// Decode the given ClientHello message data.
+func ParseClientHello(data []byte) (*ClientHello, error) {
+    r := &reader{ data: data }
+
+    ch := &ClientHello{}
+
+    ch.Version      = Version(r.u16())
+    ch.Random       = r.next(32)
+    ch.SessionID    = r.vec8()
+    ch.CipherSuites = r.u16_list(r.vec16())
+    ch.Compression  = r.vec8()
+    ch.Extensions   = r.extensions()
+
+    if r.err {
+        return nil, fmt.Errorf("Invalid ClientHello")
+    }
+
+    return ch, nil
+}
+
+// Decode the given ServerHello message data.
+func ParseServerHello(data []byte) (*ServerHello, error) {
+    r := &reader{ data: data }
+
+    sh := &ServerHello{}
+
+    sh.Version     = Version(r.u16())
+    sh.Random      = r.next(32)
+    sh.SessionID   = r.vec8()
+    sh.CipherSuite = r.u16()
+    sh.Compression = r.u8()
+    sh.Extensions  = r.extensions()
+
+    if r.err {
+        return nil, fmt.Errorf("Invalid ServerHello")
+    }
+
+    return sh, nil
+}
+
+// Decode the certificate chain of the given Certificate message data. TLS 1.3
+// messages carry a request context and per-certificate extensions.
+func ParseCertificate(data []byte, tls13 bool) ([]*x509.Certificate, error) {
+    r := &reader{ data: data }
+
+    if tls13 {
+        r.vec8()
+    }
+
+    list := &reader{ data: r.vec24() }
+
+    var certs []*x509.Certificate
+
+    for !r.err && len(list.data) > 0 {
+        der := list.vec24()
+
+        if tls13 {
+            list.vec16()
+        }
+
+        if list.err {
+            break
+        }
+
+        cert, err := x509.ParseCertificate(der)
+        if err != nil {
+            return nil, err
+        }
+
+        certs = append(certs, cert)
+    }
+
+    if r.err || list.err {
+        return nil, fmt.Errorf("Invalid Certificate")
+    }
+
+    return certs, nil
+}
+
+func find_extension(exts []Extension, t ExtensionType) []byte {
+    for _, e := range exts {
+        if e.Type == t {
+            return e.Data
+        }
+    }
+
+    return nil
+}
+
+// Return the data of the extension of the given type, or nil.
+func (ch *ClientHello) Extension(t ExtensionType) []byte {
+    return find_extension(ch.Extensions, t)
+}
+
+// Return the host name of the server_name extension (SNI).
+func (ch *ClientHello) ServerName() string {
+    r    := &reader{ data: ch.Extension(ServerName) }
+    list := &reader{ data: r.vec16() }
+
+    for !list.err && len(list.data) > 0 {
+        name_type := list.u8()
+        name      := list.vec16()
+
+        if name_type == 0 && !list.err {
+            return string(name)
+        }
+    }
+
+    return ""
+}
+
+// Return the protocols of the ALPN extension.
+func (ch *ClientHello) ALPN() []string {
+    return parse_alpn(ch.Extension(ALPN))
+}
+
+// Return the versions of the supported_versions extension.
+func (ch *ClientHello) SupportedVersions() []Version {
+    r := &reader{ data: ch.Extension(SupportedVersions) }
+
+    var versions []Version
+
+    for _, v := range r.u16_list(r.vec8()) {
+        versions = append(versions, Version(v))
+    }
+
+    return versions
+}
+
+// Return the groups of the supported_groups extension.
+func (ch *ClientHello) SupportedGroups() []uint16 {
+    r := &reader{ data: ch.Extension(SupportedGroups) }
+    return r.u16_list(r.vec16())
+}
+
+// Return the formats of the ec_point_formats extension.
+func (ch *ClientHello) ECPointFormats() []uint8 {
+    r := &reader{ data: ch.Extension(ECPointFormats) }
+    return r.vec8()
+}
+
+// Return the algorithms of the signature_algorithms extension.
+func (ch *ClientHello) SignatureAlgorithms() []uint16 {
+    r := &reader{ data: ch.Extension(SignatureAlgorithms) }
+    return r.u16_list(r.vec16())
+}
+
+// Return the entries of the key_share extension.
+func (ch *ClientHello) KeyShares() []KeyShareEntry {
+    r    := &reader{ data: ch.Extension(KeyShare) }
+    list := &reader{ data: r.vec16() }
+
+    var shares []KeyShareEntry
+
+    for !list.err && len(list.data) > 0 {
+        group := list.u16()
+        key   := list.vec16()
+
+        if !list.err {
+            shares = append(shares, KeyShareEntry{ Group: group, Key: key })
+        }
+    }
+
+    return shares
+}
+
+// Encode the ClientHello message data.
+func (ch *ClientHello) Bytes() []byte {
+    var b bytes.Buffer
+
+    binary.Write(&b, binary.BigEndian, ch.Version)
+    b.Write(ch.Random)
+    write_vec8(&b, ch.SessionID)
+    write_vec16(&b, u16_list(ch.CipherSuites))
+    write_vec8(&b, ch.Compression)
+    write_extensions(&b, ch.Extensions)
+
+    return b.Bytes()
+}
+
+// Return the data of the extension of the given type, or nil.
+func (sh *ServerHello) Extension(t ExtensionType) []byte {
+    return find_extension(sh.Extensions, t)
+}
+
+// Return the negotiated version, taking the supported_versions extension
+// into account.
+func (sh *ServerHello) SelectedVersion() Version {
+    if data := sh.Extension(SupportedVersions); len(data) == 2 {
+        return Version(binary.BigEndian.Uint16(data))
+    }
+
+    return sh.Version
+}
+
+// Return the protocol selected with the ALPN extension.
+func (sh *ServerHello) ALPN() string {
+    protos := parse_alpn(sh.Extension(ALPN))
+    if len(protos) != 1 {
+        return ""
+    }
+
+    return protos[0]
+}
+
+// Return the entry of the key_share extension. HelloRetryRequest messages only
+// carry the selected group.
+func (sh *ServerHello) KeyShare() KeyShareEntry {
+    r := &reader{ data: sh.Extension(KeyShare) }
+
+    group := r.u16()
+
+    if sh.IsHelloRetryRequest() {
+        return KeyShareEntry{ Group: group }
+    }
+
+    return KeyShareEntry{ Group: group, Key: r.vec16() }
+}
+
+// Return whether the message is a TLS 1.3 HelloRetryRequest.
+func (sh *ServerHello) IsHelloRetryRequest() bool {
+    return bytes.Equal(sh.Random, hello_retry_random)
+}
+
+// Encode the ServerHello message data.
+func (sh *ServerHello) Bytes() []byte {
+    var b bytes.Buffer
+
+    binary.Write(&b, binary.BigEndian, sh.Version)
+    b.Write(sh.Random)
+    write_vec8(&b, sh.SessionID)
+    binary.Write(&b, binary.BigEndian, sh.CipherSuite)
+    b.WriteByte(sh.Compression)
+    write_extensions(&b, sh.Extensions)
+
+    return b.Bytes()
+}
+
+// Make a server_name extension for the given host name.
+func MakeServerName(name string) Extension {
+    var entry bytes.Buffer
+
+    entry.WriteByte(0)
+    write_vec16(&entry, []byte(name))
+
+    return make_extension(ServerName, func(b *bytes.Buffer) {
+        write_vec16(b, entry.Bytes())
+    })
+}
+
+// Make an ALPN extension for the given protocols.
+func MakeALPN(protos ...string) Extension {
+    var list bytes.Buffer
+
+    for _, p := range protos {
+        write_vec8(&list, []byte(p))
+    }
+
+    return make_extension(ALPN, func(b *bytes.Buffer) {
+        write_vec16(b, list.Bytes())
+    })
+}
+
+// Make a supported_versions extension for a ClientHello.
+func MakeSupportedVersions(versions ...Version) Extension {
+    var list []uint16
+
+    for _, v := range versions {
+        list = append(list, uint16(v))
+    }
+
+    return make_extension(SupportedVersions, func(b *bytes.Buffer) {
+        write_vec8(b, u16_list(list))
+    })
+}
+
+// Make a supported_groups extension.
+func MakeSupportedGroups(groups ...uint16) Extension {
+    return make_extension(SupportedGroups, func(b *bytes.Buffer) {
+        write_vec16(b, u16_list(groups))
+    })
+}
+
+// Make a signature_algorithms extension.
+func MakeSignatureAlgorithms(algs ...uint16) Extension {
+    return make_extension(SignatureAlgorithms, func(b *bytes.Buffer) {
+        write_vec16(b, u16_list(algs))
+    })
+}
+
+// Make a key_share extension for a ClientHello.
+func MakeKeyShares(shares ...KeyShareEntry) Extension {
+    var list bytes.Buffer
+
+    for _, s := range shares {
+        binary.Write(&list, binary.BigEndian, s.Group)
+        write_vec16(&list, s.Key)
+    }
+
+    return make_extension(KeyShare, func(b *bytes.Buffer) {
+        write_vec16(b, list.Bytes())
+    })
+}
+
+// Encode the given certificate chain as Certificate message data.
+func MakeCertificate(certs []*x509.Certificate, tls13 bool) []byte {
+    var list bytes.Buffer
+
+    for _, c := range certs {
+        write_vec24(&list, c.Raw)
+
+        if tls13 {
+            write_vec16(&list, nil)
+        }
+    }
+
+    var b bytes.Buffer
+
+    if tls13 {
+        write_vec8(&b, nil)
+    }
+
+    write_vec24(&b, list.Bytes())
+
+    return b.Bytes()
+}
+
+func make_extension(t ExtensionType, write func(b *bytes.Buffer)) Extension {
+    var b bytes.Buffer
+    write(&b)
+
+    return Extension{ Type: t, Data: b.Bytes() }
+}
+
+func parse_alpn(data []byte) []string {
+    r    := &reader{ data: data }
+    list := &reader{ data: r.vec16() }
+
+    var protos []string
+
+    for !list.err && len(list.data) > 0 {
+        proto := list.vec8()
+
+        if !list.err {
+            protos = append(protos, string(proto))
+        }
+    }
+
+    return protos
+}
+
+func u16_list(list []uint16) []byte {
+    data := make([]byte, 2 * len(list))
+
+    for i, v := range list {
+        binary.BigEndian.PutUint16(data[2 * i:], v)
+    }
+
+    return data
+}
+
+func write_vec8(b *bytes.Buffer, data []byte) {
+    b.WriteByte(uint8(len(data)))
+    b.Write(data)
+}
+
+func write_vec16(b *bytes.Buffer, data []byte) {
+    binary.Write(b, binary.BigEndian, uint16(len(data)))
+    b.Write(data)
+}
+
+func write_vec24(b *bytes.Buffer, data []byte) {
+    b.Write([]byte{
+        uint8(len(data) >> 16), uint8(len(data) >> 8), uint8(len(data)),
+    })
+    b.Write(data)
+}
+
+func write_extensions(b *bytes.Buffer, exts []Extension) {
+    if exts == nil {
+        return
+    }
+
+    var list bytes.Buffer
+
+    for _, e := range exts {
+        binary.Write(&list, binary.BigEndian, uint16(e.Type))
+        write_vec16(&list, e.Data)
+    }
+
+    write_vec16(b, list.Bytes())
+}
+
+func (t HandshakeType) String() string {
+    switch t {
+    case HelloRequest:        return "hello-request"
+    case ClientHelloMsg:      return "client-hello"
+    case ServerHelloMsg:      return "server-hello"
+    case NewSessionTicket:    return "new-session-ticket"
+    case EndOfEarlyData:      return "end-of-early-data"
+    case EncryptedExtensions: return "encrypted-extensions"
+    case CertificateMsg:      return "certificate"
+    case ServerKeyExchange:   return "server-key-exchange"
+    case CertificateRequest:  return "certificate-request"
+    case ServerHelloDone:     return "server-hello-done"
+    case CertificateVerify:   return "certificate-verify"
+    case ClientKeyExchange:   return "client-key-exchange"
+    case Finished:            return "finished"
+    case KeyUpdate:           return "key-update"
+    default:                  return fmt.Sprintf("%d", uint8(t))
+    }
+}
@@ -0,0 +1,300 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+// Provides encoding and decoding for TLS records (RFC 5246, RFC 8446) and the
+// unencrypted handshake messages (ClientHello, ServerHello and Certificate),
+// together with JA3, JA3S and JA4 fingerprinting of the hellos.
+//
+// Since TCP segments are not reassembled, the layer decodes the records of a
+// single segment, the last of which may be truncated. Handshake messages split
+// over multiple segments can be decoded with a Stream instead.
+package tls
+
+import "bytes"
+import "fmt"
+import "strings"
+
+import "github.com/ghedo/go.pkt/packet"
+
+type Packet struct {
+    Records Records `string:"records"`
+    Partial []byte  `cmp:"skip" string:"skip"`
+}
+
+// TLS record. The data of the last record of a segment may be shorter than its
+// length, if the record continues in the following segments.
+type Record struct {
+    Type    ContentType
+    Version Version
+    Length  uint16
+    Data    []byte
+}
+
+type Records []Record
+
+type ContentType uint8
+
+const (
+    ChangeCipherSpec ContentType = 20
+    Alert                        = 21
+    HandshakeRecord              = 22
+    ApplicationData              = 23
+    Heartbeat                    = 24
+)
+
+type Version uint16
+
+const (
+    SSL30 Version = 0x0300
+    TLS10         = 0x0301
+    TLS11         = 0x0302
+    TLS12         = 0x0303
+    TLS13         = 0x0304
+)
+
+// Make a new record with the given data.
+func MakeRecord(t ContentType, v Version, data []byte) Record {
+    return Record{
+        Type: t,
+        Version: v,
+        Length: uint16(len(data)),
+        Data: data,
+    }
+}
+
+func Make() *Packet {
+    return &Packet{ }
+}
+
+func (p *Packet) GetType() packet.Type {
+    return packet.TLS
+}
+
+func (p *Packet) GetLength() uint16 {
+    length := len(p.Partial)
+
+    for _, r := range p.Records {
+        length += 5 + len(r.Data)
+    }
+
+    return uint16(length)
+}
+
+func (p *Packet) Equals(other packet.Packet) bool {
+    return packet.Compare(p, other)
+}
+
+// Check if the packet is an answer to another packet, that is if it carries a
+// ServerHello while the other one carries a ClientHello.
+func (p *Packet) Answers(other packet.Packet) bool {
+    if other == nil || other.GetType() != packet.TLS {
+        return false
+    }
+
+    return p.ServerHello() != nil && other.(*Packet).ClientHello() != nil
+}
+
+func (p *Packet) Pack(buf *packet.Buffer) error {
+    for _, r := range p.Records {
+        if len(r.Data) > int(r.Length) {
+            return fmt.Errorf("Invalid record length %d", r.Length)
+        }
+
+        buf.WriteN(r.Type)
+        buf.WriteN(r.Version)
+        buf.WriteN(r.Length)
+        buf.Write(r.Data)
+    }
+
+    buf.Write(p.Partial)
+
+    return nil
+}
+
+func (p *Packet) Unpack(buf *packet.Buffer) error {
+    p.Records = nil
+    p.Partial = nil
+
+    for buf.Len() > 0 {
+        if buf.Len() < 5 || !IsRecordHeader(buf.Bytes()) {
+            if len(p.Records) == 0 {
+                return fmt.Errorf("Invalid TLS record")
+            }
+
+            /* stray data following the last record */
+            p.Partial = buf.Next(buf.Len())
+            break
+        }
+
+        var r Record
+
+        buf.ReadN(&r.Type)
+        buf.ReadN(&r.Version)
+        buf.ReadN(&r.Length)
+
+        r.Data = buf.Next(int(r.Length))
+
+        p.Records = append(p.Records, r)
+    }
+
+    return nil
+}
+
+func (p *Packet) Payload() packet.Packet {
+    return nil
+}
+
+func (p *Packet) GuessPayloadType() packet.Type {
+    return packet.None
+}
+
+func (p *Packet) SetPayload(pl packet.Packet) error {
+    return nil
+}
+
+func (p *Packet) InitChecksum(csum uint32) {
+}
+
+func (p *Packet) String() string {
+    return packet.Stringify(p)
+}
+
+// Return the complete handshake messages carried by the packet. Messages split
+// over multiple records of the packet are joined, while those continuing in
+// the following segments are ignored.
+func (p *Packet) Handshakes() []Handshake {
+    var data []byte
+
+    for _, r := range p.Records {
+        if r.Type == HandshakeRecord {
+            data = append(data, r.Data...)
+        }
+    }
+
+    msgs, _ := split_handshakes(data)
+
+    return msgs
+}
+
+// Return the ClientHello carried by the packet, or nil.
+func (p *Packet) ClientHello() *ClientHello {
+    for _, h := range p.Handshakes() {
+        if h.Type == ClientHelloMsg {
+            ch, err := ParseClientHello(h.Data)
+            if err == nil {
+                return ch
+            }
+        }
+    }
+
+    return nil
+}
+
+// Return the ServerHello carried by the packet, or nil.
+func (p *Packet) ServerHello() *ServerHello {
+    for _, h := range p.Handshakes() {
+        if h.Type == ServerHelloMsg {
+            sh, err := ParseServerHello(h.Data)
+            if err == nil {
+                return sh
+            }
+        }
+    }
+
+    return nil
+}
+
+// Return whether the given data starts with a plausible record header.
+func IsRecordHeader(data []byte) bool {
+    if len(data) < 5 {
+        return false
+    }
+
+    t := ContentType(data[0])
+
+    return t >= ChangeCipherSpec && t <= Heartbeat &&
+           data[1] == 3 && data[2] <= 4
+}
+
+// Return whether the record continues in the following segments.
+func (r Record) Truncated() bool {
+    return len(r.Data) < int(r.Length)
+}
+
+func (r Record) Equal(other Record) bool {
+    return r.Type == other.Type && r.Version == other.Version &&
+           r.Length == other.Length && bytes.Equal(r.Data, other.Data)
+}
+
+func (r Record) String() string {
+    s := fmt.Sprintf("%s %s len=%d", r.Type, r.Version, r.Length)
+
+    if r.Type == HandshakeRecord && len(r.Data) > 0 {
+        s += fmt.Sprintf(" %s", HandshakeType(r.Data[0]))
+    }
+
+    if r.Truncated() {
+        s += " truncated"
+    }
+
+    return s
+}
+
+func (rs Records) String() string {
+    var s []string
+
+    for _, r := range rs {
+        s = append(s, r.String())
+    }
+
+    return "[" + strings.Join(s, ", ") + "]"
+}
+
+func (t ContentType) String() string {
+    switch t {
+    case ChangeCipherSpec: return "change-cipher-spec"
+    case Alert:            return "alert"
+    case HandshakeRecord:  return "handshake"
+    case ApplicationData:  return "application-data"
+    case Heartbeat:        return "heartbeat"
+    default:               return fmt.Sprintf("%d", uint8(t))
+    }
+}
+
+func (v Version) String() string {
+    switch v {
+    case SSL30: return "SSLv3"
+    case TLS10: return "TLSv1.0"
+    case TLS11: return "TLSv1.1"
+    case TLS12: return "TLSv1.2"
+    case TLS13: return "TLSv1.3"
+    default:    return fmt.Sprintf("0x%04x", uint16(v))
+    }
+}
@@ -0,0 +1,449 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package tls_test
+
+import "bytes"
+import "crypto/ecdsa"
+import "crypto/elliptic"
+import "crypto/rand"
+import "crypto/x509"
+import "crypto/x509/pkix"
+import "math/big"
+import "net"
+import "testing"
+import "time"
+
+import "github.com/ghedo/go.pkt/layers"
+import "github.com/ghedo/go.pkt/packet"
+import "github.com/ghedo/go.pkt/packet/ipv4"
+import "github.com/ghedo/go.pkt/packet/raw"
+import "github.com/ghedo/go.pkt/packet/tcp"
+import "github.com/ghedo/go.pkt/packet/tls"
+
+var test_random = bytes.Repeat([]byte{ 0x11 }, 32)
+
+var test_simple = append(append([]byte{
+    0x16, 0x03, 0x03, 0x00, 0x32, 0x02, 0x00, 0x00,
+    0x2e, 0x03, 0x03,
+}, test_random...), []byte{
+    0x00, 0x13, 0x01, 0x00, 0x00, 0x06, 0x00, 0x2b,
+    0x00, 0x02, 0x03, 0x04, 0x14, 0x03, 0x03, 0x00,
+    0x01, 0x01,
+}...)
+
+func MakeTestServerHello() *tls.ServerHello {
+    return &tls.ServerHello{
+        Version: tls.TLS12,
+        Random: test_random,
+        SessionID: []byte{},
+        CipherSuite: 0x1301,
+        Extensions: []tls.Extension{
+            { Type: tls.SupportedVersions, Data: []byte{ 0x03, 0x04 } },
+        },
+    }
+}
+
+func MakeTestSimple() *tls.Packet {
+    hs := tls.Handshake{
+        Type: tls.ServerHelloMsg,
+        Data: MakeTestServerHello().Bytes(),
+    }
+
+    return &tls.Packet{
+        Records: tls.Records{
+            tls.MakeRecord(tls.HandshakeRecord, tls.TLS12, hs.Bytes()),
+            tls.MakeRecord(tls.ChangeCipherSpec, tls.TLS12, []byte{ 0x01 }),
+        },
+    }
+}
+
+func TestPack(t *testing.T) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_simple)))
+
+    p := MakeTestSimple()
+
+    if int(p.GetLength()) != len(test_simple) {
+        t.Fatalf("Length mismatch: %d", p.GetLength())
+    }
+
+    err := p.Pack(&b)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if !bytes.Equal(test_simple, b.Buffer()) {
+        t.Fatalf("Raw packet mismatch: %x", b.Buffer())
+    }
+}
+
+func BenchmarkPack(bn *testing.B) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_simple)))
+
+    p := MakeTestSimple()
+
+    for n := 0; n < bn.N; n++ {
+        p.Pack(&b)
+    }
+}
+
+func TestUnpack(t *testing.T) {
+    var p tls.Packet
+
+    cmp := MakeTestSimple()
+
+    var b packet.Buffer
+    b.Init(test_simple)
+
+    err := p.Unpack(&b)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if !p.Equals(cmp) {
+        t.Fatalf("Packet mismatch:\n%s\n%s", &p, cmp)
+    }
+
+    sh := p.ServerHello()
+    if sh == nil || sh.SelectedVersion() != tls.TLS13 ||
+       sh.CipherSuite != 0x1301 || sh.IsHelloRetryRequest() {
+        t.Fatalf("ServerHello mismatch: %+v", sh)
+    }
+
+    if tls.JA3SString(sh) != "771,4865,43" {
+        t.Fatalf("JA3S mismatch: %s", tls.JA3SString(sh))
+    }
+}
+
+func BenchmarkUnpack(bn *testing.B) {
+    var p tls.Packet
+    var b packet.Buffer
+
+    for n := 0; n < bn.N; n++ {
+        b.Init(test_simple)
+        p.Unpack(&b)
+    }
+}
+
+/* ClientHello similar to the ones sent by Chrome, including GREASE values */
+func MakeTestClientHello() *tls.ClientHello {
+    return &tls.ClientHello{
+        Version: tls.TLS12,
+        Random: test_random,
+        SessionID: test_random,
+        CipherSuites: []uint16{
+            0x0a0a, 0x1301, 0x1302, 0x1303, 0xc02b, 0xc02f, 0xc02c, 0xc030,
+            0xcca9, 0xcca8, 0xc013, 0xc014, 0x009c, 0x009d, 0x002f, 0x0035,
+        },
+        Compression: []uint8{ 0 },
+        Extensions: []tls.Extension{
+            { Type: 0x1a1a, Data: []byte{} },
+            tls.MakeServerName("example.com"),
+            { Type: tls.ExtendedMasterSecret, Data: []byte{} },
+            { Type: tls.RenegotiationInfo, Data: []byte{ 0x00 } },
+            tls.MakeSupportedGroups(0x4a4a, 0x001d, 0x0017, 0x0018),
+            { Type: tls.ECPointFormats, Data: []byte{ 0x01, 0x00 } },
+            { Type: tls.SessionTicket, Data: []byte{} },
+            tls.MakeALPN("h2", "http/1.1"),
+            {
+                Type: tls.StatusRequest,
+                Data: []byte{ 0x01, 0x00, 0x00, 0x00, 0x00 },
+            },
+            tls.MakeSignatureAlgorithms(0x0403, 0x0804, 0x0401, 0x0503,
+                                        0x0805, 0x0501, 0x0806, 0x0601),
+            { Type: tls.SCT, Data: []byte{} },
+            tls.MakeKeyShares(
+                tls.KeyShareEntry{ Group: 0x4a4a, Key: []byte{ 0x00 } },
+                tls.KeyShareEntry{
+                    Group: 0x001d,
+                    Key: bytes.Repeat([]byte{ 0x22 }, 32),
+                },
+            ),
+            { Type: tls.PSKKeyExchangeModes, Data: []byte{ 0x01, 0x01 } },
+            tls.MakeSupportedVersions(0x6a6a, tls.TLS13, tls.TLS12),
+            {
+                Type: tls.CompressCertificate,
+                Data: []byte{ 0x02, 0x00, 0x02 },
+            },
+            { Type: tls.Padding, Data: make([]byte, 16) },
+            { Type: 0x4469, Data: []byte{ 0x00, 0x03, 0x02, 0x68, 0x32 } },
+            { Type: 0x2a2a, Data: []byte{ 0x00 } },
+        },
+    }
+}
+
+func make_segment(t *testing.T, data []byte) []byte {
+    ip4_pkt := ipv4.Make()
+    ip4_pkt.SrcAddr = net.ParseIP("192.168.1.10")
+    ip4_pkt.DstAddr = net.ParseIP("192.0.2.1")
+
+    tcp_pkt := tcp.Make()
+    tcp_pkt.SrcPort = 40000
+    tcp_pkt.DstPort = tcp.HTTPS
+    tcp_pkt.Flags   = tcp.Ack | tcp.PSH
+
+    buf, err := layers.Pack(ip4_pkt, tcp_pkt, &raw.Packet{ Data: data })
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    return buf
+}
+
+func TestClientHello(t *testing.T) {
+    ch := MakeTestClientHello()
+    hs := tls.Handshake{ Type: tls.ClientHelloMsg, Data: ch.Bytes() }
+    rc := tls.MakeRecord(tls.HandshakeRecord, tls.TLS10, hs.Bytes())
+
+    var b packet.Buffer
+    b.Init(make([]byte, 5 + len(rc.Data)))
+    (&tls.Packet{ Records: tls.Records{ rc } }).Pack(&b)
+
+    p, err := layers.UnpackAll(make_segment(t, b.Buffer()), packet.IPv4)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    tls_pkt, ok := layers.FindLayer(p, packet.TLS).(*tls.Packet)
+    if !ok {
+        t.Fatalf("Not TLS: %s", p)
+    }
+
+    ch = tls_pkt.ClientHello()
+    if ch == nil {
+        t.Fatalf("ClientHello missing: %s", p)
+    }
+
+    if ch.ServerName() != "example.com" || len(ch.ALPN()) != 2 ||
+       ch.ALPN()[0] != "h2" {
+        t.Fatalf("ClientHello mismatch: %+v", ch)
+    }
+
+    versions := ch.SupportedVersions()
+    if len(versions) != 3 || versions[1] != tls.TLS13 {
+        t.Fatalf("Versions mismatch: %v", versions)
+    }
+
+    shares := ch.KeyShares()
+    if len(shares) != 2 || shares[1].Group != 0x001d ||
+       len(shares[1].Key) != 32 {
+        t.Fatalf("Key shares mismatch: %v", shares)
+    }
+
+    ja4 := "t13d1516h2_8daaf6152771_e5627efa2ab1"
+    if tls.JA4(ch) != ja4 {
+        t.Fatalf("JA4 mismatch: %s", tls.JA4(ch))
+    }
+
+    ja3 := "771,4865-4866-4867-49195-49199-49196-49200-52393-52392-" +
+           "49171-49172-156-157-47-53,0-23-65281-10-11-35-16-5-13-18-" +
+           "51-45-43-27-21-17513,29-23-24,0"
+    if tls.JA3String(ch) != ja3 || len(tls.JA3(ch)) != 32 {
+        t.Fatalf("JA3 mismatch: %s", tls.JA3String(ch))
+    }
+
+    /* responses carry a ServerHello */
+    if !MakeTestSimple().Answers(tls_pkt) || tls_pkt.Answers(MakeTestSimple()) {
+        t.Fatalf("ServerHello doesn't answer ClientHello")
+    }
+}
+
+func TestJA3(t *testing.T) {
+    ch := &tls.ClientHello{
+        Version: tls.TLS10,
+        Random: test_random,
+        CipherSuites: []uint16{
+            47, 53, 5, 10, 49161, 49162, 49171, 49172, 50, 56, 19, 4,
+        },
+        Compression: []uint8{ 0 },
+        Extensions: []tls.Extension{
+            tls.MakeServerName("example.com"),
+            tls.MakeSupportedGroups(23, 24, 25),
+            { Type: tls.ECPointFormats, Data: []byte{ 0x01, 0x00 } },
+        },
+    }
+
+    if tls.JA3(ch) != "ada70206e40642a3e4461f35503241d5" {
+        t.Fatalf("JA3 mismatch: %s", tls.JA3String(ch))
+    }
+
+    if tls.JA4(ch) != "t10d120300_d94e65cdb899_33a13ba74d1c" {
+        t.Fatalf("JA4 mismatch: %s", tls.JA4(ch))
+    }
+}
+
+func TestTruncated(t *testing.T) {
+    hs := tls.Handshake{
+        Type: tls.ClientHelloMsg,
+        Data: MakeTestClientHello().Bytes(),
+    }
+
+    rc := tls.MakeRecord(tls.HandshakeRecord, tls.TLS10, hs.Bytes())
+
+    var b packet.Buffer
+    b.Init(make([]byte, 5 + len(rc.Data)))
+    (&tls.Packet{ Records: tls.Records{ rc } }).Pack(&b)
+
+    data := b.Buffer()
+    seg1 := data[:100]
+    seg2 := data[100:]
+
+    var p tls.Packet
+    b.Init(seg1)
+
+    err := p.Unpack(&b)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if len(p.Records) != 1 || !p.Records[0].Truncated() ||
+       p.ClientHello() != nil || int(p.GetLength()) != len(seg1) {
+        t.Fatalf("Packet mismatch: %s", &p)
+    }
+
+    s := tls.NewStream()
+
+    msgs, err := s.Add(seg1)
+    if err != nil || len(msgs) != 0 {
+        t.Fatalf("Stream mismatch: %v %s", msgs, err)
+    }
+
+    msgs, err = s.Add(seg2)
+    if err != nil || len(msgs) != 1 || s.ClientHello == nil ||
+       s.ClientHello.ServerName() != "example.com" {
+        t.Fatalf("Stream mismatch: %v %s", msgs, err)
+    }
+}
+
+func make_certificate(t *testing.T) *x509.Certificate {
+    key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+    if err != nil {
+        t.Fatalf("Error generating key: %s", err)
+    }
+
+    tmpl := &x509.Certificate{
+        SerialNumber: big.NewInt(1),
+        Subject: pkix.Name{ CommonName: "example.com" },
+        NotBefore: time.Now(),
+        NotAfter: time.Now().Add(time.Hour),
+    }
+
+    der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl,
+                                       &key.PublicKey, key)
+    if err != nil {
+        t.Fatalf("Error creating certificate: %s", err)
+    }
+
+    cert, err := x509.ParseCertificate(der)
+    if err != nil {
+        t.Fatalf("Error parsing certificate: %s", err)
+    }
+
+    return cert
+}
+
+func TestStream(t *testing.T) {
+    cert := make_certificate(t)
+
+    sh := MakeTestServerHello()
+    sh.Extensions = []tls.Extension{ tls.MakeALPN("h2") }
+
+    /* the server's first flight, with multiple messages in a record */
+    var flight []byte
+
+    flight = append(flight, tls.Handshake{
+        Type: tls.ServerHelloMsg,
+        Data: sh.Bytes(),
+    }.Bytes()...)
+
+    flight = append(flight, tls.Handshake{
+        Type: tls.CertificateMsg,
+        Data: tls.MakeCertificate([]*x509.Certificate{ cert }, false),
+    }.Bytes()...)
+
+    flight = append(flight, tls.Handshake{
+        Type: tls.ServerHelloDone,
+    }.Bytes()...)
+
+    var data []byte
+
+    for _, rc := range []tls.Record{
+        tls.MakeRecord(tls.HandshakeRecord, tls.TLS12, flight),
+        tls.MakeRecord(tls.ChangeCipherSpec, tls.TLS12, []byte{ 0x01 }),
+        tls.MakeRecord(tls.HandshakeRecord, tls.TLS12, test_random),
+    } {
+        var b packet.Buffer
+        b.Init(make([]byte, 5 + len(rc.Data)))
+        (&tls.Packet{ Records: tls.Records{ rc } }).Pack(&b)
+
+        data = append(data, b.Buffer()...)
+    }
+
+    s := tls.NewStream()
+
+    var msgs []tls.Handshake
+
+    /* feed the stream a few bytes at a time */
+    for len(data) > 0 {
+        n := 7
+        if n > len(data) {
+            n = len(data)
+        }
+
+        m, err := s.Add(data[:n])
+        if err != nil {
+            t.Fatalf("Error adding data: %s", err)
+        }
+
+        msgs = append(msgs, m...)
+        data = data[n:]
+    }
+
+    if len(msgs) != 3 || msgs[2].Type != tls.ServerHelloDone ||
+       !s.Encrypted {
+        t.Fatalf("Messages mismatch: %v", msgs)
+    }
+
+    if s.ServerHello == nil || s.ServerHello.ALPN() != "h2" {
+        t.Fatalf("ServerHello mismatch: %+v", s.ServerHello)
+    }
+
+    if len(s.Certificates) != 1 ||
+       s.Certificates[0].Subject.CommonName != "example.com" {
+        t.Fatalf("Certificates mismatch: %v", s.Certificates)
+    }
+
+    _, err := s.Add([]byte{ 0x42, 0x42, 0x42, 0x42, 0x42 })
+    if err == nil {
+        t.Fatalf("Invalid record accepted")
+    }
+}
@@ -0,0 +1,131 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package tls
+
+import "crypto/x509"
+import "fmt"
+
+// Stream reassembles the records and handshake messages sent in one direction
+// of a connection. The data must be given in order, starting from the
+// beginning of the connection.
+//
+// Once the sender switches to encrypted records (after a ChangeCipherSpec
+// record), the following handshake messages are ignored.
+type Stream struct {
+    ClientHello  *ClientHello
+    ServerHello  *ServerHello
+    Certificates []*x509.Certificate
+    Encrypted    bool
+    buf          []byte
+    hs           []byte
+    err          error
+}
+
+// Create a new stream.
+func NewStream() *Stream {
+    return &Stream{ }
+}
+
+// Add the given data to the stream, and return the handshake messages it
+// completed. The hellos and certificates found are also stored in the stream.
+func (s *Stream) Add(data []byte) ([]Handshake, error) {
+    if s.err != nil {
+        return nil, s.err
+    }
+
+    s.buf = append(s.buf, data...)
+
+    var msgs []Handshake
+
+    for len(s.buf) >= 5 {
+        if !IsRecordHeader(s.buf) {
+            s.err = fmt.Errorf("Invalid TLS record")
+            return msgs, s.err
+        }
+
+        length := int(s.buf[3]) << 8 | int(s.buf[4])
+        if len(s.buf) < 5 + length {
+            break
+        }
+
+        t := ContentType(s.buf[0])
+
+        switch {
+        case t == ChangeCipherSpec:
+            s.Encrypted = true
+
+        case t == HandshakeRecord && !s.Encrypted:
+            var complete []Handshake
+
+            s.hs = append(s.hs, s.buf[5:5 + length]...)
+
+            complete, s.hs = split_handshakes(s.hs)
+
+            for _, h := range complete {
+                /* the buffers are reused, so keep a copy */
+                h.Data = append([]byte{}, h.Data...)
+
+                s.add_handshake(h)
+                msgs = append(msgs, h)
+            }
+        }
+
+        s.buf = s.buf[5 + length:]
+    }
+
+    /* avoid keeping old data around */
+    s.buf = append([]byte{}, s.buf...)
+    s.hs  = append([]byte{}, s.hs...)
+
+    return msgs, nil
+}
+
+func (s *Stream) add_handshake(h Handshake) {
+    switch h.Type {
+    case ClientHelloMsg:
+        if ch, err := ParseClientHello(h.Data); err == nil {
+            s.ClientHello = ch
+        }
+
+    case ServerHelloMsg:
+        if sh, err := ParseServerHello(h.Data); err == nil {
+            s.ServerHello = sh
+        }
+
+    case CertificateMsg:
+        tls13 := s.ServerHello != nil &&
+                 s.ServerHello.SelectedVersion() == TLS13
+
+        if certs, err := ParseCertificate(h.Data, tls13); err == nil {
+            s.Certificates = certs
+        }
+    }
+}
@@ -0,0 +1,152 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+// Provides encoding and decoding for TRILL (RFC 6325) headers. The payload of
+// the header is the inner Ethernet frame.
+package trill
+
+import "fmt"
+
+import "github.com/ghedo/go.pkt/packet"
+
+type Packet struct {
+    Version     uint8         `string:"ver"`
+    Reserved    uint8         `string:"res"`
+    Multicast   bool          `string:"mcast"`
+    HopCount    uint8         `string:"hops"`
+    Egress      uint16        `string:"egress"`
+    Ingress     uint16        `string:"ingress"`
+    Options     []byte        `string:"skip"`
+    pkt_payload packet.Packet `cmp:"skip" string:"skip"`
+}
+
+func Make() *Packet {
+    return &Packet{
+        HopCount: 0x3f,
+    }
+}
+
+func (p *Packet) GetType() packet.Type {
+    return packet.TRILL
+}
+
+func (p *Packet) GetLength() uint16 {
+    length := 6 + uint16(len(p.Options))
+
+    if p.pkt_payload != nil {
+        return p.pkt_payload.GetLength() + length
+    }
+
+    return length
+}
+
+func (p *Packet) Equals(other packet.Packet) bool {
+    return packet.Compare(p, other)
+}
+
+func (p *Packet) Answers(other packet.Packet) bool {
+    if other == nil || other.GetType() != packet.TRILL {
+        return false
+    }
+
+    if p.Payload() != nil {
+        return p.Payload().Answers(other.Payload())
+    }
+
+    return true
+}
+
+func (p *Packet) Pack(buf *packet.Buffer) error {
+    if len(p.Options) % 4 != 0 || len(p.Options) > 31 * 4 {
+        return fmt.Errorf("Invalid TRILL options length %d", len(p.Options))
+    }
+
+    hdr := uint16(p.Version & 0x3) << 14 | uint16(p.Reserved & 0x3) << 12 |
+           uint16(len(p.Options) / 4) << 6 | uint16(p.HopCount & 0x3f)
+
+    if p.Multicast {
+        hdr |= 1 << 11
+    }
+
+    buf.WriteN(hdr)
+    buf.WriteN(p.Egress)
+    buf.WriteN(p.Ingress)
+    buf.Write(p.Options)
+
+    return nil
+}
+
+func (p *Packet) Unpack(buf *packet.Buffer) error {
+    var hdr uint16
+    buf.ReadN(&hdr)
+
+    p.Version   = uint8(hdr >> 14)
+    p.Reserved  = uint8(hdr >> 12) & 0x3
+    p.Multicast = hdr & (1 << 11) != 0
+    p.HopCount  = uint8(hdr) & 0x3f
+
+    buf.ReadN(&p.Egress)
+    buf.ReadN(&p.Ingress)
+
+    op_len := (int(hdr >> 6) & 0x1f) * 4
+
+    if buf.Len() < op_len {
+        return fmt.Errorf("Invalid TRILL options length %d", op_len)
+    }
+
+    p.Options = nil
+
+    if op_len > 0 {
+        p.Options = buf.Next(op_len)
+    }
+
+    return nil
+}
+
+func (p *Packet) Payload() packet.Packet {
+    return p.pkt_payload
+}
+
+func (p *Packet) GuessPayloadType() packet.Type {
+    return packet.Eth
+}
+
+func (p *Packet) SetPayload(pl packet.Packet) error {
+    p.pkt_payload = pl
+
+    return nil
+}
+
+func (p *Packet) InitChecksum(csum uint32) {
+}
+
+func (p *Packet) String() string {
+    return packet.Stringify(p)
+}
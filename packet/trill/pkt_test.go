@@ -0,0 +1,143 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package trill_test
+
+import "bytes"
+import "testing"
+
+import "github.com/ghedo/go.pkt/layers"
+import "github.com/ghedo/go.pkt/packet"
+import "github.com/ghedo/go.pkt/packet/eth"
+import "github.com/ghedo/go.pkt/packet/raw"
+import "github.com/ghedo/go.pkt/packet/trill"
+
+var test_simple = []byte{
+    0x08, 0x60, 0x01, 0x01, 0x02, 0x02, 0x00, 0x00, 0x00, 0x00,
+}
+
+func MakeTestSimple() *trill.Packet {
+    return &trill.Packet{
+        Multicast: true,
+        HopCount: 0x20,
+        Egress: 0x0101,
+        Ingress: 0x0202,
+        Options: []byte{ 0x00, 0x00, 0x00, 0x00 },
+    }
+}
+
+func TestPack(t *testing.T) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_simple)))
+
+    p := MakeTestSimple()
+
+    err := p.Pack(&b)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if !bytes.Equal(test_simple, b.Buffer()) {
+        t.Fatalf("Raw packet mismatch: %x", b.Buffer())
+    }
+}
+
+func BenchmarkPack(bn *testing.B) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_simple)))
+
+    p := MakeTestSimple()
+
+    for n := 0; n < bn.N; n++ {
+        p.Pack(&b)
+    }
+}
+
+func TestUnpack(t *testing.T) {
+    var p trill.Packet
+
+    cmp := MakeTestSimple()
+
+    var b packet.Buffer
+    b.Init(test_simple)
+
+    err := p.Unpack(&b)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if !p.Equals(cmp) {
+        t.Fatalf("Packet mismatch:\n%s\n%s", &p, cmp)
+    }
+}
+
+func BenchmarkUnpack(bn *testing.B) {
+    var p trill.Packet
+    var b packet.Buffer
+
+    for n := 0; n < bn.N; n++ {
+        b.Init(test_simple)
+        p.Unpack(&b)
+    }
+}
+
+var test_frame = []byte{
+    0x01, 0x80, 0xc2, 0x00, 0x00, 0x41, 0x00, 0xaa, 0xbb, 0xcc, 0xdd, 0xee,
+    0x22, 0xf3, 0x00, 0x3f, 0x00, 0x0a, 0x00, 0x0b, 0xff, 0xff, 0xff, 0xff,
+    0xff, 0xff, 0x00, 0x11, 0x22, 0x33, 0x44, 0x55, 0x12, 0x34, 0xde, 0xad,
+    0xbe, 0xef,
+}
+
+func TestFrame(t *testing.T) {
+    var outer_pkt eth.Packet
+    var trill_pkt trill.Packet
+    var inner_pkt eth.Packet
+    var raw_pkt raw.Packet
+
+    _, err := layers.Unpack(test_frame, &outer_pkt, &trill_pkt, &inner_pkt,
+                            &raw_pkt)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if trill_pkt.Egress != 10 || trill_pkt.Ingress != 11 ||
+       trill_pkt.HopCount != 0x3f || inner_pkt.Type != 0x1234 {
+        t.Fatalf("Packet mismatch: %s", &outer_pkt)
+    }
+
+    buf, err := layers.Pack(&outer_pkt, &trill_pkt, &inner_pkt, &raw_pkt)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if !bytes.Equal(buf, test_frame) {
+        t.Fatalf("Raw packet mismatch: %x", buf)
+    }
+}
@@ -33,6 +33,7 @@ package udp
 
 import "github.com/ghedo/go.pkt/packet"
 import "github.com/ghedo/go.pkt/packet/ipv4"
+import "github.com/ghedo/go.pkt/packet/wol"
 
 type Packet struct {
     SrcPort     uint16        `string:"sport"`
@@ -40,9 +41,28 @@ type Packet struct {
     Length      uint16        `string:"len"`
     Checksum    uint16        `string:"sum"`
     csum_seed   uint32        `cmp:"skip" string:"skip"`
+    wol_magic   bool          `cmp:"skip" string:"skip"`
     pkt_payload packet.Packet `cmp:"skip" string:"skip"`
 }
 
+// Well-known ports used to guess the payload type.
+const (
+    WoLEcho uint16 = 7
+    WoL            = 9
+    DNS            = 53
+    BOOTPServer    = 67
+    BOOTPClient    = 68
+    NTP            = 123
+    DHCPv6Client   = 546
+    DHCPv6Server   = 547
+    L2TP           = 1701
+    VXLAN          = 4789
+    Geneve         = 6081
+    MDNS           = 5353
+    LLMNR          = 5355
+    MPLS           = 6635
+)
+
 func Make() *Packet {
     return &Packet{
         Length: 8,
@@ -66,7 +86,7 @@ func (p *Packet) Equals(other packet.Packet) bool {
 }
 
 func (p *Packet) Answers(other packet.Packet) bool {
-    if other == nil || other.GetType() != packet.TCP {
+    if other == nil || other.GetType() != packet.UDP {
         return false
     }
 
@@ -75,6 +95,10 @@ func (p *Packet) Answers(other packet.Packet) bool {
         return false
     }
 
+    if p.Payload() != nil && p.Payload().GetType() != packet.Raw {
+        return p.Payload().Answers(other.Payload())
+    }
+
     return true
 }
 
@@ -99,6 +123,8 @@ func (p *Packet) Unpack(buf *packet.Buffer) error {
     buf.ReadN(&p.Length)
     buf.ReadN(&p.Checksum)
 
+    p.wol_magic = wol.IsMagic(buf.Bytes())
+
     return nil
 }
 
@@ -107,7 +133,14 @@ func (p *Packet) Payload() packet.Packet {
 }
 
 func (p *Packet) GuessPayloadType() packet.Type {
-    return packet.Raw
+    t := PortsToType(p.SrcPort, p.DstPort)
+
+    /* the WoL ports are shared with the echo and discard services */
+    if t == packet.WoL && !p.wol_magic {
+        return packet.Raw
+    }
+
+    return t
 }
 
 func (p *Packet) SetPayload(pl packet.Packet) error {
@@ -124,3 +157,39 @@ func (p *Packet) InitChecksum(csum uint32) {
 func (p *Packet) String() string {
     return packet.Stringify(p)
 }
+
+var port_to_type_map = map[uint16]packet.Type{
+    WoLEcho:      packet.WoL,
+    WoL:          packet.WoL,
+    DNS:          packet.DNS,
+    BOOTPServer:  packet.DHCPv4,
+    BOOTPClient:  packet.DHCPv4,
+    NTP:          packet.NTP,
+    DHCPv6Client: packet.DHCPv6,
+    DHCPv6Server: packet.DHCPv6,
+    L2TP:         packet.L2TP,
+    VXLAN:        packet.VXLAN,
+    Geneve:       packet.Geneve,
+    MDNS:         packet.DNS,
+    LLMNR:        packet.DNS,
+    MPLS:         packet.MPLS,
+}
+
+// Create a new Type from the given well-known UDP port.
+func PortToType(port uint16) packet.Type {
+    if t, ok := port_to_type_map[port]; ok {
+        return t
+    }
+
+    return packet.Raw
+}
+
+// Create a new Type from the given source and destination UDP ports, giving
+// precedence to the destination port.
+func PortsToType(src_port, dst_port uint16) packet.Type {
+    if t := PortToType(dst_port); t != packet.Raw {
+        return t
+    }
+
+    return PortToType(src_port)
+}
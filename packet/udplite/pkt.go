@@ -0,0 +1,178 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+// Provides encoding and decoding for UDP-Lite packets (RFC 3828).
+//
+// The checksum only covers the number of bytes given by the Coverage field
+// (which includes the UDP-Lite header), or the whole packet if it's 0. The
+// payload type is guessed from the ports, like for UDP packets.
+package udplite
+
+import "fmt"
+
+import "github.com/ghedo/go.pkt/packet"
+import "github.com/ghedo/go.pkt/packet/ipv4"
+import "github.com/ghedo/go.pkt/packet/udp"
+
+type Packet struct {
+    SrcPort     uint16        `string:"sport"`
+    DstPort     uint16        `string:"dport"`
+    Coverage    uint16        `string:"cov"`
+    Checksum    uint16        `cmp:"skip" string:"sum"`
+    csum_seed   uint32        `cmp:"skip" string:"skip"`
+    csum_data   []byte        `cmp:"skip" string:"skip"`
+    pkt_payload packet.Packet `cmp:"skip" string:"skip"`
+}
+
+func Make() *Packet {
+    return &Packet{
+        Coverage: 8,
+    }
+}
+
+func (p *Packet) GetType() packet.Type {
+    return packet.UDPLite
+}
+
+func (p *Packet) GetLength() uint16 {
+    if p.pkt_payload != nil {
+        return p.pkt_payload.GetLength() + 8
+    }
+
+    return 8
+}
+
+func (p *Packet) Equals(other packet.Packet) bool {
+    return packet.Compare(p, other)
+}
+
+func (p *Packet) Answers(other packet.Packet) bool {
+    if other == nil || other.GetType() != packet.UDPLite {
+        return false
+    }
+
+    if p.SrcPort != other.(*Packet).DstPort ||
+       p.DstPort != other.(*Packet).SrcPort {
+        return false
+    }
+
+    return true
+}
+
+func (p *Packet) Pack(buf *packet.Buffer) error {
+    buf.WriteN(p.SrcPort)
+    buf.WriteN(p.DstPort)
+    buf.WriteN(p.Coverage)
+    buf.WriteN(uint16(0x00))
+
+    data, err := p.covered(buf.LayerBytes()[:p.GetLength()])
+    if err != nil {
+        return err
+    }
+
+    p.Checksum = ipv4.CalculateChecksum(data, p.csum_seed)
+
+    /* a computed checksum of 0 is transmitted as all ones */
+    if p.Checksum == 0 {
+        p.Checksum = 0xffff
+    }
+
+    buf.PutUint16N(6, p.Checksum)
+
+    p.csum_data = data
+
+    return nil
+}
+
+func (p *Packet) Unpack(buf *packet.Buffer) error {
+    buf.ReadN(&p.SrcPort)
+    buf.ReadN(&p.DstPort)
+    buf.ReadN(&p.Coverage)
+    buf.ReadN(&p.Checksum)
+
+    if p.Coverage != 0 && p.Coverage < 8 {
+        return fmt.Errorf("Invalid checksum coverage %d", p.Coverage)
+    }
+
+    data, err := p.covered(buf.LayerBytes())
+    if err != nil {
+        return err
+    }
+
+    p.csum_data = data
+
+    return nil
+}
+
+func (p *Packet) Payload() packet.Packet {
+    return p.pkt_payload
+}
+
+func (p *Packet) GuessPayloadType() packet.Type {
+    return udp.PortsToType(p.SrcPort, p.DstPort)
+}
+
+func (p *Packet) SetPayload(pl packet.Packet) error {
+    p.pkt_payload = pl
+
+    return nil
+}
+
+func (p *Packet) InitChecksum(csum uint32) {
+    p.csum_seed = csum
+}
+
+func (p *Packet) String() string {
+    return packet.Stringify(p)
+}
+
+// Return whether the checksum of the packet is valid. This requires the packet
+// to have been decoded or encoded as payload of an IP packet, as the checksum
+// also covers the IP pseudo-header.
+func (p *Packet) ValidChecksum() bool {
+    if p.csum_data == nil || p.csum_seed == 0 {
+        return false
+    }
+
+    return ipv4.CalculateChecksum(p.csum_data, p.csum_seed) == 0
+}
+
+// Return the part of the given packet data covered by the checksum.
+func (p *Packet) covered(data []byte) ([]byte, error) {
+    if p.Coverage == 0 {
+        return data, nil
+    }
+
+    if int(p.Coverage) > len(data) {
+        return nil, fmt.Errorf("Invalid checksum coverage %d", p.Coverage)
+    }
+
+    return data[:p.Coverage], nil
+}
@@ -0,0 +1,243 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package udplite_test
+
+import "bytes"
+import "net"
+import "testing"
+
+import "github.com/ghedo/go.pkt/layers"
+import "github.com/ghedo/go.pkt/packet"
+import "github.com/ghedo/go.pkt/packet/eth"
+import "github.com/ghedo/go.pkt/packet/ipv4"
+import "github.com/ghedo/go.pkt/packet/ipv6"
+import "github.com/ghedo/go.pkt/packet/raw"
+import "github.com/ghedo/go.pkt/packet/udp"
+import "github.com/ghedo/go.pkt/packet/udplite"
+
+var test_simple = []byte{
+    0xcb, 0xa6, 0x00, 0x50, 0x00, 0x08, 0x34, 0x01,
+}
+
+func MakeTestSimple() *udplite.Packet {
+    return &udplite.Packet{
+        SrcPort: 52134,
+        DstPort: 80,
+        Coverage: 8,
+    }
+}
+
+func TestPack(t *testing.T) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_simple)))
+
+    p := MakeTestSimple()
+
+    err := p.Pack(&b)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if !bytes.Equal(test_simple, b.Buffer()) {
+        t.Fatalf("Raw packet mismatch: %x", b.Buffer())
+    }
+}
+
+func BenchmarkPack(bn *testing.B) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_simple)))
+
+    p := MakeTestSimple()
+
+    for n := 0; n < bn.N; n++ {
+        p.Pack(&b)
+    }
+}
+
+func TestUnpack(t *testing.T) {
+    var p udplite.Packet
+
+    cmp := MakeTestSimple()
+
+    var b packet.Buffer
+    b.Init(test_simple)
+
+    err := p.Unpack(&b)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if !p.Equals(cmp) {
+        t.Fatalf("Packet mismatch:\n%s\n%s", &p, cmp)
+    }
+}
+
+func BenchmarkUnpack(bn *testing.B) {
+    var p udplite.Packet
+    var b packet.Buffer
+
+    for n := 0; n < bn.N; n++ {
+        b.Init(test_simple)
+        p.Unpack(&b)
+    }
+}
+
+func TestPartialChecksum(t *testing.T) {
+    ip4 := ipv4.Make()
+    ip4.SrcAddr = net.ParseIP("192.168.1.1")
+    ip4.DstAddr = net.ParseIP("192.168.1.2")
+
+    udplite_pkt := MakeTestSimple()
+    udplite_pkt.Coverage = 12
+
+    data := &raw.Packet{ Data: []byte("codec frame payload") }
+
+    buf, err := layers.Pack(ip4, udplite_pkt, data)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if buf[9] != uint8(ipv4.UDPLite) {
+        t.Fatalf("Protocol mismatch: %x", buf[9])
+    }
+
+    pkt, err := layers.UnpackAll(buf, packet.IPv4)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    dec := layers.FindLayer(pkt, packet.UDPLite).(*udplite.Packet)
+    if !dec.Equals(udplite_pkt) || !dec.ValidChecksum() {
+        t.Fatalf("UDP-Lite layer mismatch: %s", pkt)
+    }
+
+    /* damage outside of the coverage is tolerated */
+    buf[len(buf) - 1] ^= 0xff
+
+    pkt, _ = layers.UnpackAll(buf, packet.IPv4)
+    dec    = layers.FindLayer(pkt, packet.UDPLite).(*udplite.Packet)
+    if !dec.ValidChecksum() {
+        t.Fatalf("Invalid checksum outside of coverage")
+    }
+
+    buf[20 + 9] ^= 0xff
+
+    pkt, _ = layers.UnpackAll(buf, packet.IPv4)
+    dec    = layers.FindLayer(pkt, packet.UDPLite).(*udplite.Packet)
+    if dec.ValidChecksum() {
+        t.Fatalf("Valid checksum inside of coverage")
+    }
+}
+
+func TestFullChecksumIPv6(t *testing.T) {
+    ip6 := ipv6.Make()
+    ip6.SrcAddr = net.ParseIP("2001:db8::1")
+    ip6.DstAddr = net.ParseIP("2001:db8::2")
+
+    udplite_pkt := MakeTestSimple()
+    udplite_pkt.Coverage = 0
+
+    data := &raw.Packet{ Data: []byte("full coverage") }
+
+    buf, err := layers.Pack(ip6, udplite_pkt, data)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    buf[len(buf) - 1] ^= 0xff
+
+    pkt, err := layers.UnpackAll(buf, packet.IPv6)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    dec := layers.FindLayer(pkt, packet.UDPLite).(*udplite.Packet)
+    if dec.ValidChecksum() {
+        t.Fatalf("Valid checksum with full coverage")
+    }
+}
+
+func TestPadding(t *testing.T) {
+    ip4 := ipv4.Make()
+    ip4.SrcAddr = net.ParseIP("192.168.1.1")
+    ip4.DstAddr = net.ParseIP("192.168.1.2")
+
+    udplite_pkt := MakeTestSimple()
+    udplite_pkt.Coverage = 0
+
+    data := &raw.Packet{ Data: []byte("short") }
+
+    buf, err := layers.Pack(eth.Make(), ip4, udplite_pkt, data)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    /* pad to the minimum Ethernet frame size */
+    buf = append(buf, make([]byte, 60 - len(buf))...)
+
+    pkt, err := layers.UnpackAll(buf, packet.Eth)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    dec := layers.FindLayer(pkt, packet.UDPLite).(*udplite.Packet)
+    if !dec.ValidChecksum() {
+        t.Fatalf("Invalid checksum with padding: %s", pkt)
+    }
+
+    if !bytes.Equal(dec.Payload().(*raw.Packet).Data, data.Data) {
+        t.Fatalf("Payload mismatch: %s", pkt)
+    }
+}
+
+func TestInvalidCoverage(t *testing.T) {
+    var p udplite.Packet
+
+    data := append([]byte{}, test_simple...)
+    data[5] = 0x10
+
+    var b packet.Buffer
+    b.Init(data)
+
+    err := p.Unpack(&b)
+    if err == nil {
+        t.Fatalf("Invalid coverage accepted: %s", &p)
+    }
+}
+
+func TestPayloadType(t *testing.T) {
+    p := MakeTestSimple()
+    p.DstPort = udp.VXLAN
+
+    if p.GuessPayloadType() != packet.VXLAN {
+        t.Fatalf("Payload type mismatch: %s", p.GuessPayloadType())
+    }
+}
@@ -82,7 +82,7 @@ func (p *Packet) Answers(other packet.Packet) bool {
 func (p *Packet) Pack(buf *packet.Buffer) error {
     tci := uint16(p.Priority) << 13 | p.VLAN
     if p.DropEligible {
-        tci |= 0x10
+        tci |= 0x1000
     }
 
     buf.WriteN(tci)
@@ -96,7 +96,7 @@ func (p *Packet) Unpack(buf *packet.Buffer) error {
     buf.ReadN(&tci)
 
     p.Priority     = (uint8(tci >> 8) & 0xE0) >> 5
-    p.DropEligible = uint8(tci) & 0x10 != 0
+    p.DropEligible = tci & 0x1000 != 0
     p.VLAN         = tci & 0x0FFF
 
     buf.ReadN(&p.Type)
@@ -114,7 +114,7 @@ func (p *Packet) GuessPayloadType() packet.Type {
 
 func (p *Packet) SetPayload(pl packet.Packet) error {
     p.pkt_payload = pl
-    p.Type        = eth.TypeToEtherType(pl.GetType())
+    p.Type        = eth.UpdateEtherType(p.Type, pl)
 
     return nil
 }
@@ -33,8 +33,10 @@ package vlan_test
 import "bytes"
 import "testing"
 
+import "github.com/ghedo/go.pkt/layers"
 import "github.com/ghedo/go.pkt/packet"
 import "github.com/ghedo/go.pkt/packet/eth"
+import "github.com/ghedo/go.pkt/packet/raw"
 import "github.com/ghedo/go.pkt/packet/vlan"
 
 var test_simple = []byte{
@@ -103,3 +105,49 @@ func BenchmarkUnpack(bn *testing.B) {
         p.Unpack(&b)
     }
 }
+
+func TestDropEligible(t *testing.T) {
+    var p vlan.Packet
+
+    var b packet.Buffer
+    b.Init([]byte{ 0x30, 0x14, 0x08, 0x00 })
+
+    p.Unpack(&b)
+
+    if p.Priority != 1 || !p.DropEligible || p.VLAN != 20 {
+        t.Fatalf("TCI mismatch: %s", &p)
+    }
+}
+
+var test_qinq = []byte{
+    0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x00, 0x11, 0x22, 0x33, 0x44, 0x55,
+    0x88, 0xa8, 0xa0, 0x64, 0x81, 0x00, 0x00, 0xc8, 0x12, 0x34, 0xde, 0xad,
+    0xbe, 0xef,
+}
+
+func TestQinQ(t *testing.T) {
+    var eth_pkt eth.Packet
+    var outer_pkt vlan.Packet
+    var inner_pkt vlan.Packet
+    var raw_pkt raw.Packet
+
+    _, err := layers.Unpack(test_qinq, &eth_pkt, &outer_pkt, &inner_pkt,
+                            &raw_pkt)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if eth_pkt.Type != eth.QinQ || outer_pkt.VLAN != 100 ||
+       inner_pkt.VLAN != 200 || inner_pkt.Type != 0x1234 {
+        t.Fatalf("Packet mismatch: %s", &eth_pkt)
+    }
+
+    buf, err := layers.Pack(&eth_pkt, &outer_pkt, &inner_pkt, &raw_pkt)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if !bytes.Equal(buf, test_qinq) {
+        t.Fatalf("Raw packet mismatch: %x", buf)
+    }
+}
@@ -0,0 +1,195 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+// Provides encoding and decoding for VXLAN packets (RFC 7348), including the
+// group policy extension.
+package vxlan
+
+import "encoding/binary"
+import "fmt"
+import "hash/fnv"
+
+import "github.com/ghedo/go.pkt/packet"
+import "github.com/ghedo/go.pkt/packet/eth"
+import "github.com/ghedo/go.pkt/packet/ipv4"
+import "github.com/ghedo/go.pkt/packet/ipv6"
+import "github.com/ghedo/go.pkt/packet/tcp"
+import "github.com/ghedo/go.pkt/packet/udp"
+
+type Packet struct {
+    Flags       Flags
+    GroupPolicy uint16        `string:"gbp"`
+    VNI         uint32        `string:"vni"`
+    pkt_payload packet.Packet `cmp:"skip" string:"skip"`
+}
+
+type Flags uint8
+
+const (
+    ValidVNI Flags = 0x08
+    Policy         = 0x80
+)
+
+func Make() *Packet {
+    return &Packet{
+        Flags: ValidVNI,
+    }
+}
+
+func (p *Packet) GetType() packet.Type {
+    return packet.VXLAN
+}
+
+func (p *Packet) GetLength() uint16 {
+    if p.pkt_payload != nil {
+        return p.pkt_payload.GetLength() + 8
+    }
+
+    return 8
+}
+
+func (p *Packet) Equals(other packet.Packet) bool {
+    return packet.Compare(p, other)
+}
+
+func (p *Packet) Answers(other packet.Packet) bool {
+    if other == nil || other.GetType() != packet.VXLAN {
+        return false
+    }
+
+    if p.VNI != other.(*Packet).VNI {
+        return false
+    }
+
+    if p.Payload() != nil {
+        return p.Payload().Answers(other.Payload())
+    }
+
+    return true
+}
+
+func (p *Packet) Pack(buf *packet.Buffer) error {
+    buf.WriteN(p.Flags)
+    buf.WriteN(uint8(0x00))
+    buf.WriteN(p.GroupPolicy)
+    buf.WriteN(p.VNI << 8)
+
+    return nil
+}
+
+func (p *Packet) Unpack(buf *packet.Buffer) error {
+    if buf.Len() < 8 {
+        return fmt.Errorf("Invalid VXLAN header length %d", buf.Len())
+    }
+
+    buf.ReadN(&p.Flags)
+    buf.Next(1)
+    buf.ReadN(&p.GroupPolicy)
+    buf.ReadN(&p.VNI)
+
+    p.VNI >>= 8
+
+    return nil
+}
+
+func (p *Packet) Payload() packet.Packet {
+    return p.pkt_payload
+}
+
+func (p *Packet) GuessPayloadType() packet.Type {
+    return packet.Eth
+}
+
+func (p *Packet) SetPayload(pl packet.Packet) error {
+    p.pkt_payload = pl
+
+    return nil
+}
+
+func (p *Packet) InitChecksum(csum uint32) {
+}
+
+func (p *Packet) String() string {
+    return packet.Stringify(p)
+}
+
+// Encapsulate the given packets (starting with the inner Ethernet frame) into
+// a VXLAN tunnel with the given VNI. The returned UDP and VXLAN layers followed
+// by the inner packets can be prepended with the outer Ethernet and IP headers
+// and sent with network.Send().
+func Encapsulate(vni uint32, pkts ...packet.Packet) []packet.Packet {
+    udp_pkt := udp.Make()
+    udp_pkt.SrcPort = SourcePort(pkts...)
+    udp_pkt.DstPort = udp.VXLAN
+
+    vxlan_pkt := Make()
+    vxlan_pkt.VNI = vni
+
+    return append([]packet.Packet{ udp_pkt, vxlan_pkt }, pkts...)
+}
+
+// Return a source port in the dynamic range (49152-65535) derived from a hash
+// of the addresses and ports of the given packets. UDP based tunnels use this
+// to spread different inner flows over multiple paths.
+func SourcePort(pkts ...packet.Packet) uint16 {
+    h := fnv.New32a()
+
+    var ports [4]byte
+
+    for _, p := range pkts {
+        switch p := p.(type) {
+        case *eth.Packet:
+            h.Write(p.SrcAddr)
+            h.Write(p.DstAddr)
+
+        case *ipv4.Packet:
+            h.Write(p.SrcAddr.To4())
+            h.Write(p.DstAddr.To4())
+            h.Write([]byte{ uint8(p.Protocol) })
+
+        case *ipv6.Packet:
+            h.Write(p.SrcAddr.To16())
+            h.Write(p.DstAddr.To16())
+            h.Write([]byte{ uint8(p.NextHdr) })
+
+        case *tcp.Packet:
+            binary.BigEndian.PutUint16(ports[0:], p.SrcPort)
+            binary.BigEndian.PutUint16(ports[2:], p.DstPort)
+            h.Write(ports[:])
+
+        case *udp.Packet:
+            binary.BigEndian.PutUint16(ports[0:], p.SrcPort)
+            binary.BigEndian.PutUint16(ports[2:], p.DstPort)
+            h.Write(ports[:])
+        }
+    }
+
+    return uint16(49152 + h.Sum32() % 16384)
+}
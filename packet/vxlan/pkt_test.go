@@ -0,0 +1,170 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package vxlan_test
+
+import "bytes"
+import "net"
+import "testing"
+
+import "github.com/ghedo/go.pkt/layers"
+import "github.com/ghedo/go.pkt/packet"
+import "github.com/ghedo/go.pkt/packet/eth"
+import "github.com/ghedo/go.pkt/packet/icmpv4"
+import "github.com/ghedo/go.pkt/packet/ipv4"
+import "github.com/ghedo/go.pkt/packet/udp"
+import "github.com/ghedo/go.pkt/packet/vxlan"
+
+var test_simple = []byte{
+    0x08, 0x00, 0x00, 0x00, 0x00, 0x12, 0x34, 0x00,
+}
+
+func MakeTestSimple() *vxlan.Packet {
+    return &vxlan.Packet{
+        Flags: vxlan.ValidVNI,
+        VNI: 0x1234,
+    }
+}
+
+func TestPack(t *testing.T) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_simple)))
+
+    p := MakeTestSimple()
+
+    err := p.Pack(&b)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if !bytes.Equal(test_simple, b.Buffer()) {
+        t.Fatalf("Raw packet mismatch: %x", b.Buffer())
+    }
+}
+
+func BenchmarkPack(bn *testing.B) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_simple)))
+
+    p := MakeTestSimple()
+
+    for n := 0; n < bn.N; n++ {
+        p.Pack(&b)
+    }
+}
+
+func TestUnpack(t *testing.T) {
+    var p vxlan.Packet
+
+    cmp := MakeTestSimple()
+
+    var b packet.Buffer
+    b.Init(test_simple)
+
+    err := p.Unpack(&b)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if !p.Equals(cmp) {
+        t.Fatalf("Packet mismatch:\n%s\n%s", &p, cmp)
+    }
+}
+
+func BenchmarkUnpack(bn *testing.B) {
+    var p vxlan.Packet
+    var b packet.Buffer
+
+    for n := 0; n < bn.N; n++ {
+        b.Init(test_simple)
+        p.Unpack(&b)
+    }
+}
+
+func TestEncapsulate(t *testing.T) {
+    outer_eth := eth.Make()
+    outer_eth.SrcAddr, _ = net.ParseMAC("4c:72:b9:54:e5:3d")
+    outer_eth.DstAddr, _ = net.ParseMAC("1f:92:2b:56:ed:77")
+
+    outer_ip4 := ipv4.Make()
+    outer_ip4.SrcAddr = net.ParseIP("10.0.0.1")
+    outer_ip4.DstAddr = net.ParseIP("10.0.0.2")
+
+    inner_eth := eth.Make()
+    inner_eth.SrcAddr, _ = net.ParseMAC("02:00:00:00:00:01")
+    inner_eth.DstAddr, _ = net.ParseMAC("02:00:00:00:00:02")
+
+    inner_ip4 := ipv4.Make()
+    inner_ip4.SrcAddr = net.ParseIP("192.168.1.1")
+    inner_ip4.DstAddr = net.ParseIP("192.168.1.2")
+
+    inner_icmp := icmpv4.Make()
+    inner_icmp.Id = 0x1234
+
+    stack := vxlan.Encapsulate(42, inner_eth, inner_ip4, inner_icmp)
+
+    udp_pkt := stack[0].(*udp.Packet)
+    if udp_pkt.DstPort != udp.VXLAN || udp_pkt.SrcPort < 49152 {
+        t.Fatalf("UDP ports mismatch: %s", udp_pkt)
+    }
+
+    buf, err := layers.Pack(append([]packet.Packet{ outer_eth, outer_ip4 },
+                                   stack...)...)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    pkt, err := layers.UnpackAll(buf, packet.Eth)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    vxlan_pkt, ok := layers.FindLayer(pkt, packet.VXLAN).(*vxlan.Packet)
+    if !ok || vxlan_pkt.VNI != 42 {
+        t.Fatalf("VXLAN layer mismatch: %s", pkt)
+    }
+
+    icmp_pkt := layers.FindLayer(vxlan_pkt, packet.ICMPv4)
+    if icmp_pkt == nil || !icmp_pkt.Equals(inner_icmp) {
+        t.Fatalf("Inner packet mismatch: %s", pkt)
+    }
+}
+
+func TestTruncated(t *testing.T) {
+    var p vxlan.Packet
+
+    var b packet.Buffer
+    b.Init(test_simple[:3])
+
+    err := p.Unpack(&b)
+    if err == nil {
+        t.Fatalf("Truncated header accepted: %s", &p)
+    }
+}
@@ -0,0 +1,654 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package wifi
+
+import "encoding/binary"
+import "fmt"
+import "strings"
+
+// Supported rate, in units of 500 kbit/s. The most significant bit is set for
+// rates that belong to the BSS basic rate set.
+type Rate uint8
+
+// Traffic indication map element.
+type TIMElement struct {
+    DTIMCount     uint8
+    DTIMPeriod    uint8
+    BitmapControl uint8
+    Bitmap        []byte
+}
+
+// Country element.
+type CountryElement struct {
+    Code        string
+    Environment uint8
+    Triplets    []CountryTriplet
+}
+
+type CountryTriplet struct {
+    FirstChannel uint8
+    NumChannels  uint8
+    MaxPower     uint8
+}
+
+// RSN element. This is also used for the WPA vendor-specific element, which
+// has the same layout.
+type RSNElement struct {
+    Version         uint16
+    GroupCipher     CipherSuite
+    PairwiseCiphers []CipherSuite
+    AKMs            []AKMSuite
+    Capabilities    uint16
+    PMKIDs          [][]byte
+    GroupMgmtCipher CipherSuite
+}
+
+// Cipher suite selector, with the OUI in the upper 24 bits and the suite type
+// in the lower 8 bits.
+type CipherSuite uint32
+
+const (
+    CipherGroup   CipherSuite = 0x000fac00
+    CipherWEP40               = 0x000fac01
+    CipherTKIP                = 0x000fac02
+    CipherCCMP                = 0x000fac04
+    CipherWEP104              = 0x000fac05
+    CipherBIP                 = 0x000fac06
+    CipherGCMP                = 0x000fac08
+    CipherGCMP256             = 0x000fac09
+    CipherCCMP256             = 0x000fac0a
+)
+
+// AKM suite selector, with the OUI in the upper 24 bits and the suite type in
+// the lower 8 bits.
+type AKMSuite uint32
+
+const (
+    AKM8021X       AKMSuite = 0x000fac01
+    AKMPSK                  = 0x000fac02
+    AKMFT8021X              = 0x000fac03
+    AKMFTPSK                = 0x000fac04
+    AKM8021XSHA256          = 0x000fac05
+    AKMPSKSHA256            = 0x000fac06
+    AKMSAE                  = 0x000fac08
+    AKMFTSAE                = 0x000fac09
+    AKMSuiteB               = 0x000fac0b
+    AKMSuiteB192            = 0x000fac0c
+    AKMOWE                  = 0x000fac12
+)
+
+// HT capabilities element.
+type HTCapabilitiesElement struct {
+    Info        uint16
+    AMPDUParams uint8
+    MCSSet      [16]byte
+    ExtCaps     uint16
+    TxBeamform  uint32
+    ASEL        uint8
+}
+
+// VHT capabilities element.
+type VHTCapabilitiesElement struct {
+    Info          uint32
+    RxMCSMap      uint16
+    RxHighestRate uint16
+    TxMCSMap      uint16
+    TxHighestRate uint16
+}
+
+// HE capabilities element (carried in an extension element).
+type HECapabilitiesElement struct {
+    MACCaps [6]byte
+    PHYCaps [11]byte
+    MCSNSS  []byte
+}
+
+// Vendor-specific element.
+type VendorElement struct {
+    OUI  [3]byte
+    Type uint8
+    Data []byte
+}
+
+// WPS (Wi-Fi Protected Setup) vendor-specific element.
+type WPSElement struct {
+    Attributes []WPSAttribute
+}
+
+type WPSAttribute struct {
+    Type uint16
+    Data []byte
+}
+
+const (
+    WPSConfigState  uint16 = 0x1044
+    WPSDeviceName          = 0x1011
+    WPSManufacturer        = 0x1021
+    WPSModelName           = 0x1023
+    WPSModelNumber         = 0x1024
+    WPSUUIDE               = 0x1047
+    WPSVersion             = 0x104a
+)
+
+const (
+    HECapabilities uint8 = 35
+    HEOperation          = 36
+)
+
+var oui_ieee = [3]byte{ 0x00, 0x0f, 0xac }
+var oui_microsoft = [3]byte{ 0x00, 0x50, 0xf2 }
+
+// Decode the element into its typed representation. The returned value is a
+// string for SSID elements, a []Rate for (extended) supported rates elements,
+// an uint8 channel for DS parameter elements and a pointer to the matching
+// *Element struct for the others. Unknown elements are returned as is.
+func (e Element) Decode() (interface{}, error) {
+    switch e.Id {
+    case SSID:
+        return string(e.Data), nil
+
+    case Rates, ExtRates:
+        return ParseRates(e.Data), nil
+
+    case DSParams:
+        if len(e.Data) < 1 {
+            return nil, fmt.Errorf("Invalid DS parameter element")
+        }
+
+        return e.Data[0], nil
+
+    case TIM:
+        return ParseTIM(e.Data)
+
+    case Country:
+        return ParseCountry(e.Data)
+
+    case RSN:
+        return ParseRSN(e.Data)
+
+    case HTCapabilities:
+        return ParseHTCapabilities(e.Data)
+
+    case VHTCapabilities:
+        return ParseVHTCapabilities(e.Data)
+
+    case Extension:
+        if len(e.Data) > 0 && e.Data[0] == HECapabilities {
+            return ParseHECapabilities(e.Data[1:])
+        }
+
+    case Vendor:
+        v, err := ParseVendor(e.Data)
+        if err != nil {
+            return nil, err
+        }
+
+        switch {
+        case v.OUI == oui_microsoft && v.Type == 1:
+            return ParseRSN(v.Data)
+
+        case v.OUI == oui_microsoft && v.Type == 4:
+            return ParseWPS(v.Data)
+        }
+
+        return v, nil
+    }
+
+    return e, nil
+}
+
+// Parse the body of a (extended) supported rates element.
+func ParseRates(data []byte) []Rate {
+    rates := make([]Rate, len(data))
+
+    for i, r := range data {
+        rates[i] = Rate(r)
+    }
+
+    return rates
+}
+
+// Parse the body of a TIM element.
+func ParseTIM(data []byte) (*TIMElement, error) {
+    if len(data) < 3 {
+        return nil, fmt.Errorf("Invalid TIM element")
+    }
+
+    return &TIMElement{
+        DTIMCount: data[0],
+        DTIMPeriod: data[1],
+        BitmapControl: data[2],
+        Bitmap: data[3:],
+    }, nil
+}
+
+// Parse the body of a country element.
+func ParseCountry(data []byte) (*CountryElement, error) {
+    if len(data) < 3 {
+        return nil, fmt.Errorf("Invalid country element")
+    }
+
+    c := &CountryElement{
+        Code: string(data[:2]),
+        Environment: data[2],
+    }
+
+    for i := 3; i + 3 <= len(data); i += 3 {
+        c.Triplets = append(c.Triplets, CountryTriplet{
+            FirstChannel: data[i],
+            NumChannels: data[i + 1],
+            MaxPower: data[i + 2],
+        })
+    }
+
+    return c, nil
+}
+
+// Parse the body of a RSN element (or of a WPA element, without the vendor
+// OUI and type). All fields after the version are optional.
+func ParseRSN(data []byte) (*RSNElement, error) {
+    if len(data) < 2 {
+        return nil, fmt.Errorf("Invalid RSN element")
+    }
+
+    r := &RSNElement{
+        Version: binary.LittleEndian.Uint16(data),
+    }
+
+    data = data[2:]
+
+    if len(data) >= 4 {
+        r.GroupCipher = CipherSuite(binary.BigEndian.Uint32(data))
+        data = data[4:]
+    }
+
+    if len(data) >= 2 {
+        count := int(binary.LittleEndian.Uint16(data))
+        data = data[2:]
+
+        if len(data) < count * 4 {
+            return nil, fmt.Errorf("Invalid RSN pairwise cipher count")
+        }
+
+        for i := 0; i < count; i++ {
+            r.PairwiseCiphers = append(r.PairwiseCiphers,
+                CipherSuite(binary.BigEndian.Uint32(data[i * 4:])))
+        }
+
+        data = data[count * 4:]
+    }
+
+    if len(data) >= 2 {
+        count := int(binary.LittleEndian.Uint16(data))
+        data = data[2:]
+
+        if len(data) < count * 4 {
+            return nil, fmt.Errorf("Invalid RSN AKM count")
+        }
+
+        for i := 0; i < count; i++ {
+            r.AKMs = append(r.AKMs,
+                AKMSuite(binary.BigEndian.Uint32(data[i * 4:])))
+        }
+
+        data = data[count * 4:]
+    }
+
+    if len(data) >= 2 {
+        r.Capabilities = binary.LittleEndian.Uint16(data)
+        data = data[2:]
+    }
+
+    if len(data) >= 2 {
+        count := int(binary.LittleEndian.Uint16(data))
+        data = data[2:]
+
+        if len(data) < count * 16 {
+            return nil, fmt.Errorf("Invalid RSN PMKID count")
+        }
+
+        for i := 0; i < count; i++ {
+            r.PMKIDs = append(r.PMKIDs, data[i * 16:i * 16 + 16])
+        }
+
+        data = data[count * 16:]
+    }
+
+    if len(data) >= 4 {
+        r.GroupMgmtCipher = CipherSuite(binary.BigEndian.Uint32(data))
+    }
+
+    return r, nil
+}
+
+// Parse the body of a HT capabilities element.
+func ParseHTCapabilities(data []byte) (*HTCapabilitiesElement, error) {
+    if len(data) < 26 {
+        return nil, fmt.Errorf("Invalid HT capabilities element")
+    }
+
+    h := &HTCapabilitiesElement{
+        Info: binary.LittleEndian.Uint16(data[0:]),
+        AMPDUParams: data[2],
+        ExtCaps: binary.LittleEndian.Uint16(data[19:]),
+        TxBeamform: binary.LittleEndian.Uint32(data[21:]),
+        ASEL: data[25],
+    }
+
+    copy(h.MCSSet[:], data[3:19])
+
+    return h, nil
+}
+
+// Parse the body of a VHT capabilities element.
+func ParseVHTCapabilities(data []byte) (*VHTCapabilitiesElement, error) {
+    if len(data) < 12 {
+        return nil, fmt.Errorf("Invalid VHT capabilities element")
+    }
+
+    return &VHTCapabilitiesElement{
+        Info: binary.LittleEndian.Uint32(data[0:]),
+        RxMCSMap: binary.LittleEndian.Uint16(data[4:]),
+        RxHighestRate: binary.LittleEndian.Uint16(data[6:]),
+        TxMCSMap: binary.LittleEndian.Uint16(data[8:]),
+        TxHighestRate: binary.LittleEndian.Uint16(data[10:]),
+    }, nil
+}
+
+// Parse the body of a HE capabilities element (without the extension ID).
+func ParseHECapabilities(data []byte) (*HECapabilitiesElement, error) {
+    if len(data) < 17 {
+        return nil, fmt.Errorf("Invalid HE capabilities element")
+    }
+
+    h := &HECapabilitiesElement{
+        MCSNSS: data[17:],
+    }
+
+    copy(h.MACCaps[:], data[0:6])
+    copy(h.PHYCaps[:], data[6:17])
+
+    return h, nil
+}
+
+// Parse the body of a vendor-specific element.
+func ParseVendor(data []byte) (*VendorElement, error) {
+    if len(data) < 4 {
+        return nil, fmt.Errorf("Invalid vendor element")
+    }
+
+    v := &VendorElement{
+        Type: data[3],
+        Data: data[4:],
+    }
+
+    copy(v.OUI[:], data[0:3])
+
+    return v, nil
+}
+
+// Parse the body of a WPS element (without the vendor OUI and type).
+func ParseWPS(data []byte) (*WPSElement, error) {
+    w := &WPSElement{}
+
+    for len(data) >= 4 {
+        attr_type := binary.BigEndian.Uint16(data[0:])
+        attr_len  := int(binary.BigEndian.Uint16(data[2:]))
+
+        if len(data) < 4 + attr_len {
+            return nil, fmt.Errorf("Invalid WPS attribute length")
+        }
+
+        w.Attributes = append(w.Attributes, WPSAttribute{
+            Type: attr_type,
+            Data: data[4:4 + attr_len],
+        })
+
+        data = data[4 + attr_len:]
+    }
+
+    return w, nil
+}
+
+// Return the first element with the given id, or nil.
+func (p *Packet) FindElement(id ElementId) *Element {
+    for i := range p.Elements {
+        if p.Elements[i].Id == id {
+            return &p.Elements[i]
+        }
+    }
+
+    return nil
+}
+
+// Return the first vendor-specific element with the given OUI and type, or
+// nil.
+func (p *Packet) FindVendorElement(oui [3]byte, vtype uint8) *VendorElement {
+    for _, e := range p.Elements {
+        if e.Id != Vendor {
+            continue
+        }
+
+        v, err := ParseVendor(e.Data)
+        if err == nil && v.OUI == oui && v.Type == vtype {
+            return v
+        }
+    }
+
+    return nil
+}
+
+// Return the SSID advertised in the frame, if any.
+func (p *Packet) SSID() (string, bool) {
+    e := p.FindElement(SSID)
+    if e == nil {
+        return "", false
+    }
+
+    return string(e.Data), true
+}
+
+// Return the supported and extended supported rates advertised in the frame.
+func (p *Packet) Rates() []Rate {
+    var rates []Rate
+
+    for _, e := range p.Elements {
+        if e.Id == Rates || e.Id == ExtRates {
+            rates = append(rates, ParseRates(e.Data)...)
+        }
+    }
+
+    return rates
+}
+
+// Return the channel advertised in the frame (either in the DS parameter or
+// the HT operation elements), or 0.
+func (p *Packet) Channel() uint8 {
+    if e := p.FindElement(DSParams); e != nil && len(e.Data) > 0 {
+        return e.Data[0]
+    }
+
+    if e := p.FindElement(HTOperation); e != nil && len(e.Data) > 0 {
+        return e.Data[0]
+    }
+
+    return 0
+}
+
+// Return the decoded RSN element, or nil.
+func (p *Packet) RSN() *RSNElement {
+    e := p.FindElement(RSN)
+    if e == nil {
+        return nil
+    }
+
+    r, _ := ParseRSN(e.Data)
+    return r
+}
+
+// Return the decoded WPA vendor-specific element, or nil.
+func (p *Packet) WPA() *RSNElement {
+    v := p.FindVendorElement(oui_microsoft, 1)
+    if v == nil {
+        return nil
+    }
+
+    r, _ := ParseRSN(v.Data)
+    return r
+}
+
+// Return the decoded WPS vendor-specific element, or nil.
+func (p *Packet) WPS() *WPSElement {
+    v := p.FindVendorElement(oui_microsoft, 4)
+    if v == nil {
+        return nil
+    }
+
+    w, _ := ParseWPS(v.Data)
+    return w
+}
+
+// Check whether the rate belongs to the BSS basic rate set.
+func (r Rate) Basic() bool {
+    return r & 0x80 != 0
+}
+
+// Return the rate in units of 500 kbit/s.
+func (r Rate) Value() uint8 {
+    return uint8(r & 0x7f)
+}
+
+func (r Rate) String() string {
+    s := fmt.Sprintf("%g", float64(r.Value()) / 2)
+
+    if r.Basic() {
+        s += "*"
+    }
+
+    return s
+}
+
+// Return the value of the first attribute with the given type, or nil.
+func (w *WPSElement) Attribute(attr_type uint16) []byte {
+    for _, a := range w.Attributes {
+        if a.Type == attr_type {
+            return a.Data
+        }
+    }
+
+    return nil
+}
+
+// Return the suite type (i.e. the lower 8 bits of the selector).
+func (c CipherSuite) Type() uint8 {
+    return uint8(c)
+}
+
+func (c CipherSuite) String() string {
+    if c >> 8 != 0x000fac && c >> 8 != 0x0050f2 {
+        return fmt.Sprintf("0x%08x", uint32(c))
+    }
+
+    switch c.Type() {
+    case 0x00: return "group"
+    case 0x01: return "wep40"
+    case 0x02: return "tkip"
+    case 0x04: return "ccmp"
+    case 0x05: return "wep104"
+    case 0x06: return "bip"
+    case 0x08: return "gcmp"
+    case 0x09: return "gcmp256"
+    case 0x0a: return "ccmp256"
+    default:   return fmt.Sprintf("0x%08x", uint32(c))
+    }
+}
+
+// Return the suite type (i.e. the lower 8 bits of the selector).
+func (a AKMSuite) Type() uint8 {
+    return uint8(a)
+}
+
+func (a AKMSuite) String() string {
+    if a >> 8 != 0x000fac && a >> 8 != 0x0050f2 {
+        return fmt.Sprintf("0x%08x", uint32(a))
+    }
+
+    switch a.Type() {
+    case 0x01: return "802.1x"
+    case 0x02: return "psk"
+    case 0x03: return "ft-802.1x"
+    case 0x04: return "ft-psk"
+    case 0x05: return "802.1x-sha256"
+    case 0x06: return "psk-sha256"
+    case 0x08: return "sae"
+    case 0x09: return "ft-sae"
+    case 0x0b: return "suite-b"
+    case 0x0c: return "suite-b-192"
+    case 0x12: return "owe"
+    default:   return fmt.Sprintf("0x%08x", uint32(a))
+    }
+}
+
+func (r *RSNElement) String() string {
+    var pairwise, akms []string
+
+    for _, c := range r.PairwiseCiphers {
+        pairwise = append(pairwise, c.String())
+    }
+
+    for _, a := range r.AKMs {
+        akms = append(akms, a.String())
+    }
+
+    return fmt.Sprintf("rsn(version=%d, group=%s, pairwise=%s, akm=%s)",
+                       r.Version, r.GroupCipher,
+                       strings.Join(pairwise, "|"), strings.Join(akms, "|"))
+}
+
+func (id ElementId) String() string {
+    switch id {
+    case SSID:            return "ssid"
+    case Rates:           return "rates"
+    case DSParams:        return "ds-params"
+    case TIM:             return "tim"
+    case Country:         return "country"
+    case Challenge:       return "challenge"
+    case HTCapabilities:  return "ht-caps"
+    case RSN:             return "rsn"
+    case ExtRates:        return "ext-rates"
+    case HTOperation:     return "ht-op"
+    case VHTCapabilities: return "vht-caps"
+    case VHTOperation:    return "vht-op"
+    case Vendor:          return "vendor"
+    case Extension:       return "extension"
+    default:              return fmt.Sprintf("%d", uint8(id))
+    }
+}
@@ -0,0 +1,814 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+// Provides encoding and decoding for IEEE 802.11 (WiFi) frames.
+package wifi
+
+import "bytes"
+import "encoding/binary"
+import "fmt"
+import "hash/crc32"
+import "net"
+import "strings"
+
+import "github.com/ghedo/go.pkt/packet"
+
+type Packet struct {
+    Type        Type
+    Flags       Flags
+    Duration    uint16           `string:"dur"`
+    Addr1       net.HardwareAddr `string:"addr1"`
+    Addr2       net.HardwareAddr `string:"addr2"`
+    Addr3       net.HardwareAddr `string:"addr3"`
+    Addr4       net.HardwareAddr `string:"addr4"`
+    SeqNum      uint16           `string:"seq"`
+    FragNum     uint8            `string:"frag"`
+    QoS         uint16           `string:"qos"`
+    HTControl   uint32           `string:"htc"`
+
+    /* Block Ack (Request) control frames */
+    BAControl   uint16           `string:"bactl"`
+    BAStartSeq  uint16           `string:"baseq"`
+    BABitmap    []byte           `string:"skip"`
+
+    /* Management frames */
+    Timestamp   uint64           `string:"ts"`
+    Interval    uint16           `string:"int"`
+    Capability  Capability       `string:"cap"`
+    ListenInt   uint16           `string:"listen"`
+    CurrentAP   net.HardwareAddr `string:"curap"`
+    AuthAlgo    uint16           `string:"algo"`
+    AuthSeq     uint16           `string:"aseq"`
+    Status      uint16
+    AID         uint16           `string:"aid"`
+    Reason      uint16
+    Category    uint8            `string:"cat"`
+    Elements    []Element        `string:"skip"`
+
+    /* Undecoded frame body (e.g. action frames, protected management) */
+    Body        []byte           `string:"skip"`
+
+    HasFCS      bool             `string:"skip"`
+    FCS         uint32           `string:"sum"`
+
+    pkt_payload packet.Packet    `cmp:"skip" string:"skip"`
+}
+
+// Type combines the frame type and subtype fields, with the type in the upper
+// nibble (0 = management, 1 = control, 2 = data, 3 = extension).
+type Type uint8
+
+const (
+    AssocReq Type    = 0x00
+    AssocResp        = 0x01
+    ReassocReq       = 0x02
+    ReassocResp      = 0x03
+    ProbeReq         = 0x04
+    ProbeResp        = 0x05
+    TimingAdv        = 0x06
+    Beacon           = 0x08
+    ATIM             = 0x09
+    Disassoc         = 0x0a
+    Auth             = 0x0b
+    Deauth           = 0x0c
+    Action           = 0x0d
+    ActionNoAck      = 0x0e
+
+    ControlWrapper   = 0x17
+    BlockAckReq      = 0x18
+    BlockAck         = 0x19
+    PSPoll           = 0x1a
+    RTS              = 0x1b
+    CTS              = 0x1c
+    ACK              = 0x1d
+    CFEnd            = 0x1e
+    CFEndAck         = 0x1f
+
+    Data             = 0x20
+    DataCFAck        = 0x21
+    DataCFPoll       = 0x22
+    DataCFAckPoll    = 0x23
+    Null             = 0x24
+    CFAck            = 0x25
+    CFPoll           = 0x26
+    CFAckPoll        = 0x27
+    QoSData          = 0x28
+    QoSDataCFAck     = 0x29
+    QoSDataCFPoll    = 0x2a
+    QoSDataCFAckPoll = 0x2b
+    QoSNull          = 0x2c
+    QoSCFPoll        = 0x2e
+    QoSCFAckPoll     = 0x2f
+)
+
+type Flags uint8
+
+const (
+    ToDS Flags = 1 << iota
+    FromDS
+    MoreFrag
+    Retry
+    PowerMgmt
+    MoreData
+    Protected
+    Order
+)
+
+type Capability uint16
+
+const (
+    ESS Capability = 1 << iota
+    IBSS
+    CFPollable
+    CFPollReq
+    Privacy
+    ShortPreamble
+    PBCC
+    ChannelAgility
+    SpectrumMgmt
+    QoS
+    ShortSlotTime
+    APSD
+    RadioMeasurement
+    DSSSOFDM
+    DelayedBA
+    ImmediateBA
+)
+
+// Information element carried in the body of management frames.
+type Element struct {
+    Id   ElementId
+    Data []byte
+}
+
+type ElementId uint8
+
+const (
+    SSID ElementId     = 0
+    Rates              = 1
+    DSParams           = 3
+    TIM                = 5
+    Country            = 7
+    Challenge          = 16
+    HTCapabilities     = 45
+    RSN                = 48
+    ExtRates           = 50
+    HTOperation        = 61
+    VHTCapabilities    = 191
+    VHTOperation       = 192
+    Vendor             = 221
+    Extension          = 255
+)
+
+func Make() *Packet {
+    return &Packet{
+        Type: Data,
+        Addr1: make([]byte, 6),
+        Addr2: make([]byte, 6),
+        Addr3: make([]byte, 6),
+    }
+}
+
+func (p *Packet) GetType() packet.Type {
+    return packet.WiFi
+}
+
+func (p *Packet) GetLength() uint16 {
+    length := p.header_len() + p.body_len()
+
+    if p.HasFCS {
+        length += 4
+    }
+
+    if p.pkt_payload != nil {
+        return p.pkt_payload.GetLength() + uint16(length)
+    }
+
+    return uint16(length)
+}
+
+func (p *Packet) Equals(other packet.Packet) bool {
+    return packet.Compare(p, other)
+}
+
+func (p *Packet) Answers(other packet.Packet) bool {
+    if other == nil || other.GetType() != packet.WiFi {
+        return false
+    }
+
+    o := other.(*Packet)
+
+    switch p.Type {
+    case CTS:
+        return o.Type == RTS && bytes.Equal(p.Addr1, o.Addr2)
+
+    case ACK:
+        return o.Type != ACK && o.Type != CTS && bytes.Equal(p.Addr1, o.Addr2)
+
+    case BlockAck:
+        return o.Type == BlockAckReq &&
+               bytes.Equal(p.Addr1, o.Addr2) && bytes.Equal(p.Addr2, o.Addr1)
+
+    case ProbeResp:
+        return o.Type == ProbeReq && bytes.Equal(p.Addr1, o.Addr2)
+
+    case AssocResp:
+        return o.Type == AssocReq && bytes.Equal(p.Addr1, o.Addr2)
+
+    case ReassocResp:
+        return o.Type == ReassocReq && bytes.Equal(p.Addr1, o.Addr2)
+
+    case Auth:
+        return o.Type == Auth && p.AuthSeq == o.AuthSeq + 1 &&
+               bytes.Equal(p.Addr1, o.Addr2)
+    }
+
+    return false
+}
+
+func (p *Packet) Pack(buf *packet.Buffer) error {
+    buf.WriteL(uint8(p.Type & 0x30) >> 2 | uint8(p.Type & 0x0f) << 4)
+    buf.WriteL(p.Flags)
+    buf.WriteL(p.Duration)
+
+    buf.Write(p.Addr1)
+
+    switch p.Type.Kind() {
+    case 0x00:
+        buf.Write(p.Addr2)
+        buf.Write(p.Addr3)
+        buf.WriteL(p.SeqNum << 4 | uint16(p.FragNum & 0x0f))
+
+        if p.Flags & Order != 0 {
+            buf.WriteL(p.HTControl)
+        }
+
+        p.pack_mgmt(buf)
+
+    case 0x10:
+        switch p.Type {
+        case CTS, ACK:
+            /* receiver address only */
+
+        case ControlWrapper:
+            buf.Write(p.Body)
+
+        case BlockAckReq, BlockAck:
+            buf.Write(p.Addr2)
+            buf.WriteL(p.BAControl)
+            buf.WriteL(p.BAStartSeq)
+            buf.Write(p.BABitmap)
+
+        default:
+            buf.Write(p.Addr2)
+            buf.Write(p.Body)
+        }
+
+    case 0x20:
+        buf.Write(p.Addr2)
+        buf.Write(p.Addr3)
+        buf.WriteL(p.SeqNum << 4 | uint16(p.FragNum & 0x0f))
+
+        if p.Flags & (ToDS | FromDS) == ToDS | FromDS {
+            buf.Write(p.Addr4)
+        }
+
+        if p.Type.IsQoS() {
+            buf.WriteL(p.QoS)
+
+            if p.Flags & Order != 0 {
+                buf.WriteL(p.HTControl)
+            }
+        }
+
+        buf.Write(p.Body)
+
+    default:
+        buf.Write(p.Body)
+    }
+
+    if p.HasFCS {
+        /*
+         * The payload has already been packed at the end of the buffer, so
+         * it needs to be moved before the FCS.
+         */
+        hdr_len := buf.LayerLen()
+        pkt_len := int(p.GetLength())
+
+        frame := buf.LayerBytes()[:pkt_len]
+        copy(frame[hdr_len:], frame[hdr_len + 4:])
+
+        p.FCS = crc32.ChecksumIEEE(frame[:pkt_len - 4])
+        binary.LittleEndian.PutUint32(frame[pkt_len - 4:], p.FCS)
+    }
+
+    return nil
+}
+
+func (p *Packet) pack_mgmt(buf *packet.Buffer) {
+    if p.Flags & Protected != 0 {
+        buf.Write(p.Body)
+        return
+    }
+
+    switch p.Type {
+    case Beacon, ProbeResp:
+        buf.WriteL(p.Timestamp)
+        buf.WriteL(p.Interval)
+        buf.WriteL(p.Capability)
+
+    case AssocReq:
+        buf.WriteL(p.Capability)
+        buf.WriteL(p.ListenInt)
+
+    case ReassocReq:
+        buf.WriteL(p.Capability)
+        buf.WriteL(p.ListenInt)
+        buf.Write(p.CurrentAP)
+
+    case AssocResp, ReassocResp:
+        buf.WriteL(p.Capability)
+        buf.WriteL(p.Status)
+        buf.WriteL(p.AID)
+
+    case Auth:
+        buf.WriteL(p.AuthAlgo)
+        buf.WriteL(p.AuthSeq)
+        buf.WriteL(p.Status)
+
+    case Deauth, Disassoc:
+        buf.WriteL(p.Reason)
+
+    case Action, ActionNoAck:
+        buf.WriteL(p.Category)
+        buf.Write(p.Body)
+        return
+    }
+
+    for _, e := range p.Elements {
+        buf.WriteL(e.Id)
+        buf.WriteL(uint8(len(e.Data)))
+        buf.Write(e.Data)
+    }
+
+    buf.Write(p.Body)
+}
+
+func (p *Packet) Unpack(buf *packet.Buffer) error {
+    *p = Packet{}
+
+    frame := buf.Bytes()
+    if len(frame) < 10 {
+        return fmt.Errorf("Invalid frame length %d", len(frame))
+    }
+
+    /*
+     * Captures may or may not include the FCS, so just check if the last 4
+     * bytes match the checksum of the rest of the frame.
+     */
+    if n := len(frame); n >= 14 &&
+       crc32.ChecksumIEEE(frame[:n - 4]) ==
+       binary.LittleEndian.Uint32(frame[n - 4:]) {
+        p.HasFCS = true
+        p.FCS    = binary.LittleEndian.Uint32(frame[n - 4:])
+
+        buf.Truncate(n - 4)
+    }
+
+    var fc uint8
+    buf.ReadL(&fc)
+
+    p.Type = Type((fc & 0x0c) << 2 | fc >> 4)
+
+    buf.ReadL(&p.Flags)
+    buf.ReadL(&p.Duration)
+
+    if buf.Len() < p.header_len() - 4 {
+        return fmt.Errorf("Invalid frame length %d", len(frame))
+    }
+
+    p.Addr1 = net.HardwareAddr(buf.Next(6))
+
+    switch p.Type.Kind() {
+    case 0x00:
+        p.Addr2 = net.HardwareAddr(buf.Next(6))
+        p.Addr3 = net.HardwareAddr(buf.Next(6))
+        p.unpack_seq(buf)
+
+        if p.Flags & Order != 0 {
+            buf.ReadL(&p.HTControl)
+        }
+
+        return p.unpack_mgmt(buf)
+
+    case 0x10:
+        switch p.Type {
+        case CTS, ACK:
+            /* receiver address only */
+
+        case ControlWrapper:
+            p.Body = buf.Next(buf.Len())
+
+        case BlockAckReq, BlockAck:
+            p.Addr2 = net.HardwareAddr(buf.Next(6))
+            buf.ReadL(&p.BAControl)
+            buf.ReadL(&p.BAStartSeq)
+            p.BABitmap = buf.Next(buf.Len())
+
+        default:
+            p.Addr2 = net.HardwareAddr(buf.Next(6))
+            p.Body  = buf.Next(buf.Len())
+        }
+
+    case 0x20:
+        p.Addr2 = net.HardwareAddr(buf.Next(6))
+        p.Addr3 = net.HardwareAddr(buf.Next(6))
+        p.unpack_seq(buf)
+
+        if p.Flags & (ToDS | FromDS) == ToDS | FromDS {
+            p.Addr4 = net.HardwareAddr(buf.Next(6))
+        }
+
+        if p.Type.IsQoS() {
+            buf.ReadL(&p.QoS)
+
+            if p.Flags & Order != 0 {
+                buf.ReadL(&p.HTControl)
+            }
+        }
+
+        if !p.Type.HasData() {
+            p.Body = buf.Next(buf.Len())
+        }
+
+    default:
+        p.Body = buf.Next(buf.Len())
+    }
+
+    return nil
+}
+
+func (p *Packet) unpack_seq(buf *packet.Buffer) {
+    var seq uint16
+    buf.ReadL(&seq)
+
+    p.SeqNum  = seq >> 4
+    p.FragNum = uint8(seq & 0x0f)
+}
+
+func (p *Packet) unpack_mgmt(buf *packet.Buffer) error {
+    if p.Flags & Protected != 0 {
+        p.Body = buf.Next(buf.Len())
+        return nil
+    }
+
+    switch p.Type {
+    case Beacon, ProbeResp:
+        buf.ReadL(&p.Timestamp)
+        buf.ReadL(&p.Interval)
+        buf.ReadL(&p.Capability)
+
+    case AssocReq:
+        buf.ReadL(&p.Capability)
+        buf.ReadL(&p.ListenInt)
+
+    case ReassocReq:
+        buf.ReadL(&p.Capability)
+        buf.ReadL(&p.ListenInt)
+        p.CurrentAP = net.HardwareAddr(buf.Next(6))
+
+    case AssocResp, ReassocResp:
+        buf.ReadL(&p.Capability)
+        buf.ReadL(&p.Status)
+        buf.ReadL(&p.AID)
+
+    case Auth:
+        buf.ReadL(&p.AuthAlgo)
+        buf.ReadL(&p.AuthSeq)
+        buf.ReadL(&p.Status)
+
+    case Deauth, Disassoc:
+        buf.ReadL(&p.Reason)
+
+    case Action, ActionNoAck:
+        buf.ReadL(&p.Category)
+        p.Body = buf.Next(buf.Len())
+        return nil
+    }
+
+    for buf.Len() >= 2 {
+        var e Element
+
+        var id, length uint8
+        buf.ReadL(&id)
+        buf.ReadL(&length)
+
+        if int(length) > buf.Len() {
+            return fmt.Errorf("Invalid element length %d", length)
+        }
+
+        e.Id   = ElementId(id)
+        e.Data = buf.Next(int(length))
+
+        p.Elements = append(p.Elements, e)
+    }
+
+    if buf.Len() > 0 {
+        p.Body = buf.Next(buf.Len())
+    }
+
+    return nil
+}
+
+func (p *Packet) Payload() packet.Packet {
+    return p.pkt_payload
+}
+
+func (p *Packet) GuessPayloadType() packet.Type {
+    if !p.Type.HasData() {
+        return packet.None
+    }
+
+    /* encrypted and A-MSDU payloads can't be decoded directly */
+    if p.Flags & Protected != 0 ||
+       (p.Type.IsQoS() && p.QoS & 0x80 != 0) {
+        return packet.Raw
+    }
+
+    return packet.LLC
+}
+
+func (p *Packet) SetPayload(pl packet.Packet) error {
+    p.pkt_payload = pl
+
+    return nil
+}
+
+func (p *Packet) InitChecksum(csum uint32) {
+}
+
+func (p *Packet) String() string {
+    return packet.Stringify(p)
+}
+
+// Return the length of the MAC header.
+func (p *Packet) header_len() int {
+    switch p.Type.Kind() {
+    case 0x00:
+        if p.Flags & Order != 0 {
+            return 28
+        }
+
+        return 24
+
+    case 0x10:
+        switch p.Type {
+        case CTS, ACK, ControlWrapper:
+            return 10
+
+        case BlockAckReq, BlockAck:
+            return 20
+
+        default:
+            return 16
+        }
+
+    case 0x20:
+        length := 24
+
+        if p.Flags & (ToDS | FromDS) == ToDS | FromDS {
+            length += 6
+        }
+
+        if p.Type.IsQoS() {
+            length += 2
+
+            if p.Flags & Order != 0 {
+                length += 4
+            }
+        }
+
+        return length
+
+    default:
+        return 10
+    }
+}
+
+// Return the length of the frame body, excluding the payload.
+func (p *Packet) body_len() int {
+    length := len(p.Body) + len(p.BABitmap)
+
+    if p.Type.Kind() != 0x00 || p.Flags & Protected != 0 {
+        return length
+    }
+
+    switch p.Type {
+    case Beacon, ProbeResp:
+        length += 12
+
+    case AssocReq:
+        length += 4
+
+    case ReassocReq:
+        length += 10
+
+    case AssocResp, ReassocResp, Auth:
+        length += 6
+
+    case Deauth, Disassoc:
+        length += 2
+
+    case Action, ActionNoAck:
+        return length + 1
+    }
+
+    for _, e := range p.Elements {
+        length += 2 + len(e.Data)
+    }
+
+    return length
+}
+
+// Return the traffic identifier of a QoS data frame.
+func (p *Packet) TID() uint8 {
+    return uint8(p.QoS & 0x0f)
+}
+
+// Check whether the FCS of the given raw frame is valid. The frame is expected
+// to include the FCS as its last 4 bytes.
+func VerifyFCS(frame []byte) bool {
+    n := len(frame)
+    if n < 4 {
+        return false
+    }
+
+    return crc32.ChecksumIEEE(frame[:n - 4]) ==
+           binary.LittleEndian.Uint32(frame[n - 4:])
+}
+
+// Return the frame type (i.e. the upper nibble of the type).
+func (t Type) Kind() Type {
+    return t & 0x30
+}
+
+// Check whether the type is a QoS data frame.
+func (t Type) IsQoS() bool {
+    return t.Kind() == 0x20 && t & 0x08 != 0
+}
+
+// Check whether the type is a data frame carrying a frame body.
+func (t Type) HasData() bool {
+    return t.Kind() == 0x20 && t & 0x04 == 0
+}
+
+func (t Type) String() string {
+    switch t {
+    case AssocReq:         return "assoc-req"
+    case AssocResp:        return "assoc-resp"
+    case ReassocReq:       return "reassoc-req"
+    case ReassocResp:      return "reassoc-resp"
+    case ProbeReq:         return "probe-req"
+    case ProbeResp:        return "probe-resp"
+    case TimingAdv:        return "timing-adv"
+    case Beacon:           return "beacon"
+    case ATIM:             return "atim"
+    case Disassoc:         return "disassoc"
+    case Auth:             return "auth"
+    case Deauth:           return "deauth"
+    case Action:           return "action"
+    case ActionNoAck:      return "action-noack"
+    case ControlWrapper:   return "ctrl-wrapper"
+    case BlockAckReq:      return "block-ack-req"
+    case BlockAck:         return "block-ack"
+    case PSPoll:           return "ps-poll"
+    case RTS:              return "rts"
+    case CTS:              return "cts"
+    case ACK:              return "ack"
+    case CFEnd:            return "cf-end"
+    case CFEndAck:         return "cf-end-ack"
+    case Data:             return "data"
+    case DataCFAck:        return "data-cf-ack"
+    case DataCFPoll:       return "data-cf-poll"
+    case DataCFAckPoll:    return "data-cf-ack-poll"
+    case Null:             return "null"
+    case CFAck:            return "cf-ack"
+    case CFPoll:           return "cf-poll"
+    case CFAckPoll:        return "cf-ack-poll"
+    case QoSData:          return "qos-data"
+    case QoSDataCFAck:     return "qos-data-cf-ack"
+    case QoSDataCFPoll:    return "qos-data-cf-poll"
+    case QoSDataCFAckPoll: return "qos-data-cf-ack-poll"
+    case QoSNull:          return "qos-null"
+    case QoSCFPoll:        return "qos-cf-poll"
+    case QoSCFAckPoll:     return "qos-cf-ack-poll"
+    default:               return fmt.Sprintf("0x%x", uint8(t))
+    }
+}
+
+func (f Flags) String() string {
+    var flags []string
+
+    if f & ToDS != 0 {
+        flags = append(flags, "to-ds")
+    }
+
+    if f & FromDS != 0 {
+        flags = append(flags, "from-ds")
+    }
+
+    if f & MoreFrag != 0 {
+        flags = append(flags, "more-frag")
+    }
+
+    if f & Retry != 0 {
+        flags = append(flags, "retry")
+    }
+
+    if f & PowerMgmt != 0 {
+        flags = append(flags, "pwr-mgmt")
+    }
+
+    if f & MoreData != 0 {
+        flags = append(flags, "more-data")
+    }
+
+    if f & Protected != 0 {
+        flags = append(flags, "protected")
+    }
+
+    if f & Order != 0 {
+        flags = append(flags, "order")
+    }
+
+    return strings.Join(flags, "|")
+}
+
+func (c Capability) String() string {
+    var caps []string
+
+    if c & ESS != 0 {
+        caps = append(caps, "ess")
+    }
+
+    if c & IBSS != 0 {
+        caps = append(caps, "ibss")
+    }
+
+    if c & Privacy != 0 {
+        caps = append(caps, "privacy")
+    }
+
+    if c & ShortPreamble != 0 {
+        caps = append(caps, "short-preamble")
+    }
+
+    if c & SpectrumMgmt != 0 {
+        caps = append(caps, "spectrum-mgmt")
+    }
+
+    if c & QoS != 0 {
+        caps = append(caps, "qos")
+    }
+
+    if c & ShortSlotTime != 0 {
+        caps = append(caps, "short-slot")
+    }
+
+    if c & RadioMeasurement != 0 {
+        caps = append(caps, "radio-measurement")
+    }
+
+    return strings.Join(caps, "|")
+}
+
+func (e Element) Equal(other Element) bool {
+    return e.Id == other.Id && bytes.Equal(e.Data, other.Data)
+}
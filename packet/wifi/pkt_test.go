@@ -0,0 +1,358 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package wifi_test
+
+import "bytes"
+import "net"
+import "testing"
+
+import "github.com/ghedo/go.pkt/capture/file"
+import "github.com/ghedo/go.pkt/layers"
+import "github.com/ghedo/go.pkt/packet"
+import "github.com/ghedo/go.pkt/packet/wifi"
+
+var test_simple = []byte{
+    0x80, 0x00, 0x3a, 0x01, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x00, 0x11,
+    0x22, 0x33, 0x44, 0x55, 0x00, 0x11, 0x22, 0x33, 0x44, 0x55, 0x10, 0x00,
+    0x55, 0x44, 0x33, 0x22, 0x11, 0x00, 0x00, 0x00, 0x64, 0x00, 0x11, 0x04,
+    0x00, 0x06, 0x67, 0x6f, 0x2e, 0x70, 0x6b, 0x74, 0x01, 0x08, 0x82, 0x84,
+    0x8b, 0x96, 0x0c, 0x12, 0x18, 0x24, 0x03, 0x01, 0x06, 0x05, 0x04, 0x00,
+    0x01, 0x00, 0x00, 0x30, 0x14, 0x01, 0x00, 0x00, 0x0f, 0xac, 0x04, 0x01,
+    0x00, 0x00, 0x0f, 0xac, 0x04, 0x01, 0x00, 0x00, 0x0f, 0xac, 0x02, 0x00,
+    0x00,
+}
+
+var hwap_str = "00:11:22:33:44:55"
+var hwbc_str = "ff:ff:ff:ff:ff:ff"
+
+func MakeTestSimple() *wifi.Packet {
+    hwap, _ := net.ParseMAC(hwap_str)
+    hwbc, _ := net.ParseMAC(hwbc_str)
+
+    return &wifi.Packet{
+        Type: wifi.Beacon,
+        Duration: 314,
+        Addr1: hwbc,
+        Addr2: hwap,
+        Addr3: hwap,
+        SeqNum: 1,
+        Timestamp: 0x1122334455,
+        Interval: 100,
+        Capability: wifi.ESS | wifi.Privacy | wifi.ShortSlotTime,
+        Elements: []wifi.Element{
+            { wifi.SSID, []byte("go.pkt") },
+            { wifi.Rates, []byte{
+                0x82, 0x84, 0x8b, 0x96, 0x0c, 0x12, 0x18, 0x24,
+            } },
+            { wifi.DSParams, []byte{ 0x06 } },
+            { wifi.TIM, []byte{ 0x00, 0x01, 0x00, 0x00 } },
+            { wifi.RSN, []byte{
+                0x01, 0x00, 0x00, 0x0f, 0xac, 0x04, 0x01, 0x00, 0x00, 0x0f,
+                0xac, 0x04, 0x01, 0x00, 0x00, 0x0f, 0xac, 0x02, 0x00, 0x00,
+            } },
+        },
+    }
+}
+
+func TestPack(t *testing.T) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_simple)))
+
+    p := MakeTestSimple()
+
+    err := p.Pack(&b)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if !bytes.Equal(test_simple, b.Buffer()) {
+        t.Fatalf("Raw packet mismatch: %x", b.Buffer())
+    }
+}
+
+func BenchmarkPack(bn *testing.B) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_simple)))
+
+    p := MakeTestSimple()
+
+    for n := 0; n < bn.N; n++ {
+        p.Pack(&b)
+    }
+}
+
+func TestUnpack(t *testing.T) {
+    var p wifi.Packet
+
+    cmp := MakeTestSimple()
+
+    var b packet.Buffer
+    b.Init(test_simple)
+
+    err := p.Unpack(&b)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if !p.Equals(cmp) {
+        t.Fatalf("Packet mismatch:\n%s\n%s", &p, cmp)
+    }
+}
+
+func BenchmarkUnpack(bn *testing.B) {
+    var p wifi.Packet
+    var b packet.Buffer
+
+    for n := 0; n < bn.N; n++ {
+        b.Init(test_simple)
+        p.Unpack(&b)
+    }
+}
+
+func TestPackFCS(t *testing.T) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_simple) + 4))
+
+    p := MakeTestSimple()
+    p.HasFCS = true
+
+    err := p.Pack(&b)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if !wifi.VerifyFCS(b.Buffer()) {
+        t.Fatalf("Invalid FCS: %x", b.Buffer())
+    }
+
+    if !bytes.Equal(test_simple, b.Buffer()[:len(test_simple)]) {
+        t.Fatalf("Raw packet mismatch: %x", b.Buffer())
+    }
+}
+
+var test_fixture = []struct {
+    Type    wifi.Type
+    Flags   wifi.Flags
+    HasFCS  bool
+    Payload packet.Type
+}{
+    { wifi.Beacon,      0,                                  true,  packet.None },
+    { wifi.ProbeReq,    0,                                  false, packet.None },
+    { wifi.ProbeResp,   0,                                  true,  packet.None },
+    { wifi.Auth,        0,                                  false, packet.None },
+    { wifi.Auth,        0,                                  false, packet.None },
+    { wifi.AssocReq,    0,                                  false, packet.None },
+    { wifi.AssocResp,   0,                                  false, packet.None },
+    { wifi.RTS,         0,                                  false, packet.None },
+    { wifi.CTS,         0,                                  false, packet.None },
+    { wifi.QoSData,     wifi.ToDS,                          true,  packet.UDP  },
+    { wifi.ACK,         0,                                  false, packet.None },
+    { wifi.BlockAckReq, 0,                                  false, packet.None },
+    { wifi.BlockAck,    0,                                  false, packet.None },
+    { wifi.Data,        wifi.ToDS | wifi.FromDS,            false, packet.ARP  },
+    { wifi.QoSData,     wifi.ToDS | wifi.Protected,         true,  packet.Raw  },
+    { wifi.Null,        wifi.ToDS | wifi.PowerMgmt,         false, packet.None },
+    { wifi.Deauth,      0,                                  true,  packet.None },
+    { wifi.Disassoc,    0,                                  false, packet.None },
+}
+
+func TestUnpackFixture(t *testing.T) {
+    src, err := file.Open("pkt_test.pcap")
+    if err != nil {
+        t.Fatalf("Error opening: %s", err)
+    }
+    defer src.Close()
+
+    var pkts []*wifi.Packet
+
+    for {
+        buf, err := src.Capture()
+        if err != nil {
+            t.Fatalf("Error reading: %s", err)
+        }
+
+        if buf == nil {
+            break
+        }
+
+        pkt, err := layers.UnpackAll(buf, src.LinkType())
+        if err != nil {
+            t.Fatalf("Error unpacking: %s", err)
+        }
+
+        i := len(pkts)
+        if i >= len(test_fixture) {
+            t.Fatalf("Too many packets")
+        }
+
+        wifi_pkt, ok := layers.FindLayer(pkt, packet.WiFi).(*wifi.Packet)
+        if !ok {
+            t.Fatalf("Packet %d: not WiFi: %s", i, pkt)
+        }
+
+        exp := test_fixture[i]
+
+        if wifi_pkt.Type != exp.Type || wifi_pkt.Flags != exp.Flags ||
+           wifi_pkt.HasFCS != exp.HasFCS {
+            t.Fatalf("Packet %d: mismatch: %s", i, wifi_pkt)
+        }
+
+        if exp.Payload != packet.None &&
+           layers.FindLayer(wifi_pkt, exp.Payload) == nil {
+            t.Fatalf("Packet %d: no %s payload: %s", i, exp.Payload, pkt)
+        }
+
+        var stack []packet.Packet
+        for p := pkt; p != nil; p = p.Payload() {
+            stack = append(stack, p)
+        }
+
+        out, err := layers.Pack(stack...)
+        if err != nil {
+            t.Fatalf("Packet %d: error packing: %s", i, err)
+        }
+
+        if !bytes.Equal(buf, out) {
+            t.Fatalf("Packet %d: raw packet mismatch:\n%x\n%x", i, buf, out)
+        }
+
+        pkts = append(pkts, wifi_pkt)
+    }
+
+    if len(pkts) != len(test_fixture) {
+        t.Fatalf("Count mismatch: %d", len(pkts))
+    }
+
+    if !pkts[2].Answers(pkts[1]) {
+        t.Fatalf("Probe response doesn't answer request")
+    }
+
+    if !pkts[4].Answers(pkts[3]) {
+        t.Fatalf("Auth response doesn't answer request")
+    }
+
+    if !pkts[8].Answers(pkts[7]) {
+        t.Fatalf("CTS doesn't answer RTS")
+    }
+
+    if !pkts[10].Answers(pkts[9]) {
+        t.Fatalf("ACK doesn't answer data")
+    }
+
+    if !pkts[12].Answers(pkts[11]) {
+        t.Fatalf("Block ACK doesn't answer request")
+    }
+
+    if pkts[9].TID() != 5 {
+        t.Fatalf("TID mismatch: %d", pkts[9].TID())
+    }
+}
+
+func TestElements(t *testing.T) {
+    p := MakeTestSimple()
+
+    ssid, ok := p.SSID()
+    if !ok || ssid != "go.pkt" {
+        t.Fatalf("SSID mismatch: %s", ssid)
+    }
+
+    if p.Channel() != 6 {
+        t.Fatalf("Channel mismatch: %d", p.Channel())
+    }
+
+    rates := p.Rates()
+    if len(rates) != 8 || !rates[0].Basic() || rates[0].Value() != 2 ||
+       rates[4].Basic() || rates[4].Value() != 12 {
+        t.Fatalf("Rates mismatch: %v", rates)
+    }
+
+    rsn := p.RSN()
+    if rsn == nil || rsn.Version != 1 || rsn.GroupCipher != wifi.CipherCCMP ||
+       len(rsn.PairwiseCiphers) != 1 ||
+       rsn.PairwiseCiphers[0] != wifi.CipherCCMP ||
+       len(rsn.AKMs) != 1 || rsn.AKMs[0] != wifi.AKMPSK {
+        t.Fatalf("RSN mismatch: %s", rsn)
+    }
+
+    tim, err := p.Elements[3].Decode()
+    if err != nil || tim.(*wifi.TIMElement).DTIMPeriod != 1 {
+        t.Fatalf("TIM mismatch: %v %s", tim, err)
+    }
+}
+
+func TestVendorElements(t *testing.T) {
+    p := MakeTestSimple()
+
+    p.Elements = []wifi.Element{
+        { wifi.Country, []byte{ 'I', 'T', ' ', 1, 13, 20 } },
+        { wifi.Vendor, []byte{
+            0x00, 0x50, 0xf2, 0x01, 0x01, 0x00, 0x00, 0x50, 0xf2, 0x02,
+            0x01, 0x00, 0x00, 0x50, 0xf2, 0x02, 0x01, 0x00, 0x00, 0x50,
+            0xf2, 0x02,
+        } },
+        { wifi.Vendor, []byte{
+            0x00, 0x50, 0xf2, 0x04, 0x10, 0x4a, 0x00, 0x01, 0x10, 0x10,
+            0x44, 0x00, 0x01, 0x02, 0x10, 0x11, 0x00, 0x04, 0x74, 0x65,
+            0x73, 0x74,
+        } },
+        { wifi.Extension, append([]byte{ 35 }, make([]byte, 21)...) },
+    }
+
+    country, err := p.Elements[0].Decode()
+    if err != nil {
+        t.Fatalf("Error decoding: %s", err)
+    }
+
+    c := country.(*wifi.CountryElement)
+    if c.Code != "IT" || len(c.Triplets) != 1 || c.Triplets[0].MaxPower != 20 {
+        t.Fatalf("Country mismatch: %v", c)
+    }
+
+    wpa := p.WPA()
+    if wpa == nil || wpa.GroupCipher.Type() != 2 || len(wpa.AKMs) != 1 ||
+       wpa.AKMs[0].Type() != 2 {
+        t.Fatalf("WPA mismatch: %s", wpa)
+    }
+
+    wps := p.WPS()
+    if wps == nil || string(wps.Attribute(wifi.WPSDeviceName)) != "test" {
+        t.Fatalf("WPS mismatch: %v", wps)
+    }
+
+    he, err := p.Elements[3].Decode()
+    if err != nil {
+        t.Fatalf("Error decoding: %s", err)
+    }
+
+    if _, ok := he.(*wifi.HECapabilitiesElement); !ok {
+        t.Fatalf("HE capabilities mismatch: %v", he)
+    }
+}
@@ -0,0 +1,245 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+// Provides a passive scanner that builds an inventory of WiFi access points
+// from captured beacon and probe response frames.
+package scan
+
+import "bytes"
+import "net"
+import "sort"
+import "strings"
+
+import "github.com/ghedo/go.pkt/capture"
+import "github.com/ghedo/go.pkt/layers"
+import "github.com/ghedo/go.pkt/packet"
+import "github.com/ghedo/go.pkt/packet/wifi"
+
+// AP describes an access point seen during the scan.
+type AP struct {
+    BSSID    net.HardwareAddr
+    SSID     string
+    Channel  uint8
+    Security Security
+    Ciphers  []wifi.CipherSuite
+    AKMs     []wifi.AKMSuite
+    Beacons  uint64
+    Probes   uint64
+}
+
+type Security uint8
+
+const (
+    Open Security       = 0
+    WEP                 = 1 << 0
+    WPA                 = 1 << 1
+    WPA2                = 1 << 2
+    WPA3                = 1 << 3
+    Enterprise          = 1 << 4
+)
+
+// Inventory collects the access points seen in a capture.
+type Inventory struct {
+    aps map[string]*AP
+}
+
+// Create a new empty inventory.
+func New() *Inventory {
+    return &Inventory{
+        aps: make(map[string]*AP),
+    }
+}
+
+// Update the inventory with the given packet. Only beacon and probe response
+// frames are considered, other packets are ignored. Return the updated access
+// point, or nil.
+func (i *Inventory) Add(pkt packet.Packet) *AP {
+    wifi_pkt, ok := layers.FindLayer(pkt, packet.WiFi).(*wifi.Packet)
+    if !ok {
+        return nil
+    }
+
+    if wifi_pkt.Type != wifi.Beacon && wifi_pkt.Type != wifi.ProbeResp {
+        return nil
+    }
+
+    key := wifi_pkt.Addr3.String()
+
+    ap := i.aps[key]
+    if ap == nil {
+        ap = &AP{ BSSID: wifi_pkt.Addr3 }
+        i.aps[key] = ap
+    }
+
+    if wifi_pkt.Type == wifi.Beacon {
+        ap.Beacons++
+    } else {
+        ap.Probes++
+    }
+
+    /* hidden networks only reveal their SSID in probe responses */
+    if ssid, ok := wifi_pkt.SSID(); ok && !hidden(ssid) {
+        ap.SSID = ssid
+    }
+
+    if channel := wifi_pkt.Channel(); channel != 0 {
+        ap.Channel = channel
+    }
+
+    ap.Security = GetSecurity(wifi_pkt)
+    ap.Ciphers  = nil
+    ap.AKMs     = nil
+
+    for _, r := range []*wifi.RSNElement{ wifi_pkt.RSN(), wifi_pkt.WPA() } {
+        if r == nil {
+            continue
+        }
+
+        ap.Ciphers = append(ap.Ciphers, r.PairwiseCiphers...)
+        ap.AKMs    = append(ap.AKMs, r.AKMs...)
+    }
+
+    return ap
+}
+
+// Capture packets from the given capture handle and add them to the inventory
+// until no more packets are available (e.g. at the end of a dump file).
+func (i *Inventory) Capture(c capture.Handle) error {
+    for {
+        buf, err := c.Capture()
+        if err != nil {
+            return err
+        }
+
+        if buf == nil {
+            return nil
+        }
+
+        pkt, err := layers.UnpackAll(buf, c.LinkType())
+        if err != nil {
+            continue
+        }
+
+        i.Add(pkt)
+    }
+}
+
+// Return the access points in the inventory, sorted by BSSID.
+func (i *Inventory) APs() []*AP {
+    var aps []*AP
+
+    for _, ap := range i.aps {
+        aps = append(aps, ap)
+    }
+
+    sort.Slice(aps, func(a, b int) bool {
+        return bytes.Compare(aps[a].BSSID, aps[b].BSSID) < 0
+    })
+
+    return aps
+}
+
+// Determine the security settings advertised in a beacon or probe response.
+func GetSecurity(p *wifi.Packet) Security {
+    var sec Security
+
+    if r := p.WPA(); r != nil {
+        sec |= WPA | akm_security(r)
+    }
+
+    if r := p.RSN(); r != nil {
+        for _, akm := range r.AKMs {
+            switch akm.Type() {
+            case 0x08, 0x09, 0x0c, 0x12:
+                sec |= WPA3
+
+            default:
+                sec |= WPA2
+            }
+        }
+
+        if len(r.AKMs) == 0 {
+            sec |= WPA2
+        }
+
+        sec |= akm_security(r)
+    }
+
+    if sec == Open && p.Capability & wifi.Privacy != 0 {
+        sec |= WEP
+    }
+
+    return sec
+}
+
+func akm_security(r *wifi.RSNElement) Security {
+    for _, akm := range r.AKMs {
+        switch akm.Type() {
+        case 0x01, 0x03, 0x05, 0x0b, 0x0c:
+            return Enterprise
+        }
+    }
+
+    return 0
+}
+
+func hidden(ssid string) bool {
+    return strings.Trim(ssid, "\x00") == ""
+}
+
+func (s Security) String() string {
+    var sec []string
+
+    if s == Open {
+        return "open"
+    }
+
+    if s & WEP != 0 {
+        sec = append(sec, "wep")
+    }
+
+    if s & WPA != 0 {
+        sec = append(sec, "wpa")
+    }
+
+    if s & WPA2 != 0 {
+        sec = append(sec, "wpa2")
+    }
+
+    if s & WPA3 != 0 {
+        sec = append(sec, "wpa3")
+    }
+
+    if s & Enterprise != 0 {
+        sec = append(sec, "enterprise")
+    }
+
+    return strings.Join(sec, "|")
+}
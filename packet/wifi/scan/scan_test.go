@@ -0,0 +1,125 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package scan_test
+
+import "log"
+import "net"
+import "testing"
+
+import "github.com/ghedo/go.pkt/capture/file"
+import "github.com/ghedo/go.pkt/packet/wifi"
+import "github.com/ghedo/go.pkt/packet/wifi/scan"
+
+func TestCapture(t *testing.T) {
+    src, err := file.Open("../pkt_test.pcap")
+    if err != nil {
+        t.Fatalf("Error opening: %s", err)
+    }
+    defer src.Close()
+
+    inv := scan.New()
+
+    err = inv.Capture(src)
+    if err != nil {
+        t.Fatalf("Error scanning: %s", err)
+    }
+
+    aps := inv.APs()
+    if len(aps) != 1 {
+        t.Fatalf("AP count mismatch: %d", len(aps))
+    }
+
+    ap := aps[0]
+
+    if ap.BSSID.String() != "00:11:22:33:44:55" || ap.SSID != "go.pkt" ||
+       ap.Channel != 6 || ap.Security != scan.WPA2 ||
+       ap.Beacons != 1 || ap.Probes != 1 {
+        t.Fatalf("AP mismatch: %v", ap)
+    }
+}
+
+func TestSecurity(t *testing.T) {
+    bssid, _ := net.ParseMAC("00:11:22:33:44:66")
+
+    beacon := wifi.Make()
+    beacon.Type  = wifi.Beacon
+    beacon.Addr3 = bssid
+
+    inv := scan.New()
+
+    /* hidden open network */
+    beacon.Elements = []wifi.Element{
+        { Id: wifi.SSID, Data: []byte{ 0, 0, 0 } },
+    }
+
+    ap := inv.Add(beacon)
+    if ap == nil || ap.SSID != "" || ap.Security != scan.Open {
+        t.Fatalf("AP mismatch: %v", ap)
+    }
+
+    /* WEP */
+    beacon.Capability = wifi.ESS | wifi.Privacy
+
+    ap = inv.Add(beacon)
+    if ap.Security != scan.WEP {
+        t.Fatalf("Security mismatch: %s", ap.Security)
+    }
+
+    /* WPA3 (SAE) */
+    beacon.Elements = []wifi.Element{ { Id: wifi.RSN, Data: []byte{
+        0x01, 0x00, 0x00, 0x0f, 0xac, 0x04, 0x01, 0x00, 0x00, 0x0f, 0xac,
+        0x04, 0x01, 0x00, 0x00, 0x0f, 0xac, 0x08, 0xc0, 0x00,
+    } } }
+
+    ap = inv.Add(beacon)
+    if ap.Security != scan.WPA3 || ap.Beacons != 3 {
+        t.Fatalf("Security mismatch: %s", ap.Security)
+    }
+}
+
+func ExampleInventory() {
+    src, err := file.Open("/path/to/file/dump.pcap")
+    if err != nil {
+        log.Fatal(err)
+    }
+    defer src.Close()
+
+    inv := scan.New()
+
+    err = inv.Capture(src)
+    if err != nil {
+        log.Fatal(err)
+    }
+
+    for _, ap := range inv.APs() {
+        log.Println(ap.BSSID, ap.SSID, ap.Channel, ap.Security)
+    }
+}
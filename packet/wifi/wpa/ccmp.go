@@ -0,0 +1,267 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package wpa
+
+import "crypto/aes"
+import "crypto/cipher"
+import "crypto/subtle"
+import "encoding/binary"
+import "fmt"
+
+import "github.com/ghedo/go.pkt/packet/wifi"
+
+const ccmp_mic_len = 8
+const ccmp_hdr_len = 8
+
+// Decrypt the CCMP protected body of the given 802.11 frame (i.e. the CCMP
+// header, the encrypted data and the MIC) with the given temporal key, and
+// return the plaintext.
+func DecryptCCMP(tk []byte, hdr *wifi.Packet, body []byte) ([]byte, error) {
+    if len(body) < ccmp_hdr_len + ccmp_mic_len {
+        return nil, fmt.Errorf("Invalid CCMP body length %d", len(body))
+    }
+
+    if body[3] & 0x20 == 0 {
+        return nil, fmt.Errorf("Missing CCMP extended IV")
+    }
+
+    block, err := aes.NewCipher(tk)
+    if err != nil {
+        return nil, err
+    }
+
+    nonce := ccmp_nonce(hdr, body[:ccmp_hdr_len])
+    aad   := ccmp_aad(hdr)
+
+    data := body[ccmp_hdr_len:len(body) - ccmp_mic_len]
+    mic  := body[len(body) - ccmp_mic_len:]
+
+    out := make([]byte, len(data))
+    s0  := ccm_ctr(block, nonce, data, out)
+
+    tag := ccm_mac(block, nonce, aad, out)
+    for i := range mic {
+        tag[i] ^= s0[i]
+    }
+
+    if subtle.ConstantTimeCompare(tag[:ccmp_mic_len], mic) != 1 {
+        return nil, fmt.Errorf("Invalid CCMP MIC")
+    }
+
+    return out, nil
+}
+
+// Encrypt the given plaintext with the given temporal key and packet number,
+// and return the CCMP protected body (CCMP header, encrypted data and MIC) for
+// the given 802.11 frame.
+func EncryptCCMP(tk []byte, hdr *wifi.Packet, key_id uint8, pn uint64, data []byte) ([]byte, error) {
+    block, err := aes.NewCipher(tk)
+    if err != nil {
+        return nil, err
+    }
+
+    ccmp_hdr := []byte{
+        byte(pn), byte(pn >> 8), 0x00, 0x20 | key_id << 6,
+        byte(pn >> 16), byte(pn >> 24), byte(pn >> 32), byte(pn >> 40),
+    }
+
+    nonce := ccmp_nonce(hdr, ccmp_hdr)
+    aad   := ccmp_aad(hdr)
+
+    out := make([]byte, ccmp_hdr_len + len(data) + ccmp_mic_len)
+    copy(out, ccmp_hdr)
+
+    tag := ccm_mac(block, nonce, aad, data)
+    s0  := ccm_ctr(block, nonce, data, out[ccmp_hdr_len:])
+
+    for i := 0; i < ccmp_mic_len; i++ {
+        out[ccmp_hdr_len + len(data) + i] = tag[i] ^ s0[i]
+    }
+
+    return out, nil
+}
+
+// Build the CCM nonce from the priority, the transmitter address and the
+// packet number carried by the CCMP header.
+func ccmp_nonce(hdr *wifi.Packet, ccmp_hdr []byte) []byte {
+    nonce := make([]byte, 13)
+
+    if hdr.Type.IsQoS() {
+        nonce[0] = hdr.TID()
+    }
+
+    if hdr.Type.Kind() == 0x00 {
+        /* management frame protection */
+        nonce[0] |= 0x10
+    }
+
+    copy(nonce[1:7], hdr.Addr2)
+
+    nonce[7]  = ccmp_hdr[7]
+    nonce[8]  = ccmp_hdr[6]
+    nonce[9]  = ccmp_hdr[5]
+    nonce[10] = ccmp_hdr[4]
+    nonce[11] = ccmp_hdr[1]
+    nonce[12] = ccmp_hdr[0]
+
+    return nonce
+}
+
+// Build the additional authentication data from the MAC header, masking the
+// fields that may change on retransmission.
+func ccmp_aad(hdr *wifi.Packet) []byte {
+    fc0 := uint8(hdr.Type & 0x30) >> 2 | uint8(hdr.Type & 0x0f) << 4
+    fc1 := hdr.Flags &^ (wifi.Retry | wifi.PowerMgmt | wifi.MoreData)
+    fc1 |= wifi.Protected
+
+    if hdr.Type.Kind() == 0x20 {
+        fc0 &= 0x8f
+    }
+
+    if hdr.Type.IsQoS() {
+        fc1 &^= wifi.Order
+    }
+
+    aad := []byte{ fc0, uint8(fc1) }
+    aad = append(aad, hdr.Addr1...)
+    aad = append(aad, hdr.Addr2...)
+    aad = append(aad, hdr.Addr3...)
+    aad = append(aad, hdr.FragNum & 0x0f, 0x00)
+
+    if hdr.Flags & (wifi.ToDS | wifi.FromDS) == wifi.ToDS | wifi.FromDS {
+        aad = append(aad, hdr.Addr4...)
+    }
+
+    if hdr.Type.IsQoS() {
+        aad = append(aad, hdr.TID(), 0x00)
+    }
+
+    return aad
+}
+
+// Compute the CCM authentication tag (M = 8, L = 2) over the given AAD and
+// plaintext.
+func ccm_mac(block cipher.Block, nonce, aad, data []byte) []byte {
+    var b [16]byte
+
+    b[0] = 0x40 | (ccmp_mic_len - 2) / 2 << 3 | 0x01
+    copy(b[1:14], nonce)
+    binary.BigEndian.PutUint16(b[14:], uint16(len(data)))
+
+    mac := make([]byte, 16)
+    block.Encrypt(mac, b[:])
+
+    hdr := make([]byte, 2, 2 + len(aad))
+    binary.BigEndian.PutUint16(hdr, uint16(len(aad)))
+
+    ccm_cbc(block, mac, append(hdr, aad...))
+    ccm_cbc(block, mac, data)
+
+    return mac
+}
+
+// Run CBC-MAC over the given data, zero-padded to the block size.
+func ccm_cbc(block cipher.Block, mac, data []byte) {
+    for len(data) > 0 {
+        n := len(data)
+        if n > 16 {
+            n = 16
+        }
+
+        for i := 0; i < n; i++ {
+            mac[i] ^= data[i]
+        }
+
+        block.Encrypt(mac, mac)
+        data = data[n:]
+    }
+}
+
+// Encrypt (or decrypt) the given data in CTR mode, starting with counter 1,
+// and return the key stream block for counter 0, used to encrypt the MIC.
+func ccm_ctr(block cipher.Block, nonce, src, dst []byte) []byte {
+    iv := make([]byte, 16)
+    iv[0] = 0x01
+    copy(iv[1:14], nonce)
+
+    s0 := make([]byte, 16)
+    block.Encrypt(s0, iv)
+
+    iv[15] = 0x01
+    cipher.NewCTR(block, iv).XORKeyStream(dst, src)
+
+    return s0
+}
+
+// Unwrap the given key data with the AES key wrap algorithm (RFC 3394).
+func unwrap(kek, data []byte) ([]byte, error) {
+    if len(data) < 24 || len(data) % 8 != 0 {
+        return nil, fmt.Errorf("Invalid wrapped key length %d", len(data))
+    }
+
+    block, err := aes.NewCipher(kek)
+    if err != nil {
+        return nil, err
+    }
+
+    n := len(data) / 8 - 1
+
+    var a [8]byte
+    copy(a[:], data[:8])
+
+    r := make([]byte, n * 8)
+    copy(r, data[8:])
+
+    var b [16]byte
+
+    for j := 5; j >= 0; j-- {
+        for i := n; i >= 1; i-- {
+            t := uint64(n * j + i)
+
+            binary.BigEndian.PutUint64(b[:8],
+                binary.BigEndian.Uint64(a[:]) ^ t)
+            copy(b[8:], r[(i - 1) * 8:i * 8])
+
+            block.Decrypt(b[:], b[:])
+
+            copy(a[:], b[:8])
+            copy(r[(i - 1) * 8:], b[8:])
+        }
+    }
+
+    for _, v := range a {
+        if v != 0xa6 {
+            return nil, fmt.Errorf("Invalid wrapped key integrity")
+        }
+    }
+
+    return r, nil
+}
@@ -0,0 +1,169 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+// Provides WPA/WPA2-Personal key derivation, 4-way handshake tracking and
+// decryption of CCMP protected 802.11 frames.
+package wpa
+
+import "bytes"
+import "crypto/hmac"
+import "crypto/md5"
+import "crypto/sha1"
+import "encoding/binary"
+import "hash"
+
+import "github.com/ghedo/go.pkt/layers"
+import "github.com/ghedo/go.pkt/packet/eapol"
+
+// Derive the 256-bit pairwise master key from the given passphrase and SSID,
+// using PBKDF2-SHA1 with 4096 iterations.
+func PMK(passphrase, ssid string) []byte {
+    return pbkdf2([]byte(passphrase), []byte(ssid), 4096, 32)
+}
+
+func pbkdf2(password, salt []byte, iter, length int) []byte {
+    prf := hmac.New(sha1.New, password)
+
+    var key []byte
+
+    for block := uint32(1); len(key) < length; block++ {
+        var count [4]byte
+        binary.BigEndian.PutUint32(count[:], block)
+
+        prf.Reset()
+        prf.Write(salt)
+        prf.Write(count[:])
+        u := prf.Sum(nil)
+
+        t := make([]byte, len(u))
+        copy(t, u)
+
+        for i := 1; i < iter; i++ {
+            prf.Reset()
+            prf.Write(u)
+            u = prf.Sum(u[:0])
+
+            for j := range t {
+                t[j] ^= u[j]
+            }
+        }
+
+        key = append(key, t...)
+    }
+
+    return key[:length]
+}
+
+// Compute the IEEE 802.11 pseudo-random function (HMAC-SHA1 based) over the
+// given label and data, returning length bytes of output.
+func PRF(key []byte, label string, data []byte, length int) []byte {
+    mac := hmac.New(sha1.New, key)
+
+    var out []byte
+
+    for i := 0; len(out) < length; i++ {
+        mac.Reset()
+        mac.Write([]byte(label))
+        mac.Write([]byte{ 0x00 })
+        mac.Write(data)
+        mac.Write([]byte{ byte(i) })
+        out = mac.Sum(out)
+    }
+
+    return out[:length]
+}
+
+// Derive the 384-bit pairwise transient key from the PMK, the authenticator
+// and supplicant addresses and their nonces. The returned key is made of the
+// KCK, KEK and TK (16 bytes each), in this order.
+func PTK(pmk, aa, spa, anonce, snonce []byte) []byte {
+    var data []byte
+
+    data = append(data, min_bytes(aa, spa)...)
+    data = append(data, max_bytes(aa, spa)...)
+    data = append(data, min_bytes(anonce, snonce)...)
+    data = append(data, max_bytes(anonce, snonce)...)
+
+    return PRF(pmk, "Pairwise key expansion", data, 48)
+}
+
+func min_bytes(a, b []byte) []byte {
+    if bytes.Compare(a, b) < 0 {
+        return a
+    }
+
+    return b
+}
+
+func max_bytes(a, b []byte) []byte {
+    if bytes.Compare(a, b) < 0 {
+        return b
+    }
+
+    return a
+}
+
+// Compute the MIC of the given EAPOL-Key frame using the key confirmation key.
+// The MIC field of the frame is treated as zero. Only key descriptor versions 1
+// (HMAC-MD5) and 2 (HMAC-SHA1-128) are supported; nil is returned otherwise.
+func MIC(kck []byte, pkt *eapol.Packet) []byte {
+    var h func() hash.Hash
+
+    switch pkt.KeyInfo & eapol.KeyVersionMask {
+    case 1:
+        h = md5.New
+
+    case 2:
+        h = sha1.New
+
+    default:
+        return nil
+    }
+
+    frame := *pkt
+    frame.MIC = make([]byte, 16)
+
+    raw, err := layers.Pack(&frame)
+    if err != nil {
+        return nil
+    }
+
+    mac := hmac.New(h, kck)
+    mac.Write(raw)
+
+    return mac.Sum(nil)[:16]
+}
+
+// Check whether the MIC of the given EAPOL-Key frame is valid.
+func VerifyMIC(kck []byte, pkt *eapol.Packet) bool {
+    mic := MIC(kck, pkt)
+
+    return mic != nil && hmac.Equal(mic, pkt.MIC)
+}
@@ -0,0 +1,282 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package wpa
+
+import "bytes"
+import "fmt"
+import "net"
+import "sort"
+
+import "github.com/ghedo/go.pkt/layers"
+import "github.com/ghedo/go.pkt/packet"
+import "github.com/ghedo/go.pkt/packet/eapol"
+import "github.com/ghedo/go.pkt/packet/raw"
+import "github.com/ghedo/go.pkt/packet/wifi"
+
+// Handshake describes the state of a 4-way handshake between an authenticator
+// (the access point) and a supplicant (the station).
+type Handshake struct {
+    AA       net.HardwareAddr
+    SPA      net.HardwareAddr
+    ANonce   []byte
+    SNonce   []byte
+    Messages uint8
+    PTK      []byte
+}
+
+// Decrypter tracks the 4-way handshakes seen in a capture and decrypts the
+// CCMP protected frames exchanged by the stations whose handshake was seen.
+type Decrypter struct {
+    pmk        []byte
+    handshakes map[string]*Handshake
+    gtks       map[string][4][]byte
+}
+
+// Create a new decrypter for the network with the given SSID and passphrase.
+func New(ssid, passphrase string) *Decrypter {
+    return NewWithPMK(PMK(passphrase, ssid))
+}
+
+// Create a new decrypter using the given pairwise master key.
+func NewWithPMK(pmk []byte) *Decrypter {
+    return &Decrypter{
+        pmk: pmk,
+        handshakes: make(map[string]*Handshake),
+        gtks: make(map[string][4][]byte),
+    }
+}
+
+// Update the handshake state with the given packet. Packets that don't carry
+// an EAPOL-Key frame over 802.11 are ignored and nil is returned, otherwise
+// the matching handshake is returned. An error is returned if the MIC of the
+// frame doesn't match the derived keys (e.g. because of a wrong passphrase).
+func (d *Decrypter) Add(pkt packet.Packet) (*Handshake, error) {
+    w, ok := layers.FindLayer(pkt, packet.WiFi).(*wifi.Packet)
+    if !ok {
+        return nil, nil
+    }
+
+    key, ok := layers.FindLayer(pkt, packet.EAPOL).(*eapol.Packet)
+    if !ok || key.Type != eapol.Key {
+        return nil, nil
+    }
+
+    /* frames sent by the authenticator have the Ack bit set */
+    aa, spa := w.Addr1, w.Addr2
+    if key.KeyInfo & eapol.KeyAck != 0 {
+        aa, spa = w.Addr2, w.Addr1
+    }
+
+    hs := d.handshake(aa, spa)
+
+    msg := key.HandshakeMessage()
+
+    switch msg {
+    case 1:
+        hs.ANonce   = dup(key.Nonce)
+        hs.SNonce   = nil
+        hs.PTK      = nil
+        hs.Messages = 0
+
+    case 2:
+        hs.SNonce = dup(key.Nonce)
+
+        if hs.ANonce == nil {
+            break
+        }
+
+        ptk := PTK(d.pmk, hs.AA, hs.SPA, hs.ANonce, hs.SNonce)
+        if !VerifyMIC(ptk[:16], key) {
+            return hs, fmt.Errorf("Invalid MIC for handshake %s/%s",
+                                  hs.AA, hs.SPA)
+        }
+
+        hs.PTK = ptk
+
+    case 3:
+        if hs.ANonce == nil {
+            hs.ANonce = dup(key.Nonce)
+        }
+    }
+
+    if msg != 0 {
+        hs.Messages |= 1 << uint(msg - 1)
+    }
+
+    if hs.PTK == nil || key.KeyInfo & eapol.KeyAck == 0 {
+        return hs, nil
+    }
+
+    if msg != 1 && !VerifyMIC(hs.PTK[:16], key) {
+        return hs, fmt.Errorf("Invalid MIC for handshake %s/%s",
+                              hs.AA, hs.SPA)
+    }
+
+    /* messages 3 and group key messages carry the GTK */
+    if key.KeyInfo & eapol.KeyEncrypted != 0 {
+        d.install_gtk(hs, key)
+    }
+
+    return hs, nil
+}
+
+func (d *Decrypter) handshake(aa, spa net.HardwareAddr) *Handshake {
+    id := string(aa) + string(spa)
+
+    hs, ok := d.handshakes[id]
+    if !ok {
+        hs = &Handshake{ AA: dup(aa), SPA: dup(spa) }
+        d.handshakes[id] = hs
+    }
+
+    return hs
+}
+
+func (d *Decrypter) install_gtk(hs *Handshake, key *eapol.Packet) {
+    if key.KeyInfo & eapol.KeyVersionMask != 2 {
+        return
+    }
+
+    data, err := unwrap(hs.PTK[16:32], key.Data)
+    if err != nil {
+        return
+    }
+
+    for len(data) >= 2 {
+        id, length := data[0], int(data[1])
+
+        if id == 0xdd && length == 0 || length + 2 > len(data) {
+            break
+        }
+
+        kde := data[2:2 + length]
+        data = data[2 + length:]
+
+        /* GTK KDE (OUI 00-0f-ac, data type 1) */
+        if id != 0xdd || length < 6 ||
+           !bytes.Equal(kde[:4], []byte{ 0x00, 0x0f, 0xac, 0x01 }) {
+            continue
+        }
+
+        gtks := d.gtks[string(hs.AA)]
+        gtks[kde[4] & 0x03] = dup(kde[6:])
+        d.gtks[string(hs.AA)] = gtks
+    }
+}
+
+// Return the list of handshakes seen so far, sorted by authenticator and
+// supplicant address.
+func (d *Decrypter) Handshakes() []*Handshake {
+    var list []*Handshake
+
+    for _, hs := range d.handshakes {
+        list = append(list, hs)
+    }
+
+    sort.Slice(list, func(i, j int) bool {
+        if c := bytes.Compare(list[i].AA, list[j].AA); c != 0 {
+            return c < 0
+        }
+
+        return bytes.Compare(list[i].SPA, list[j].SPA) < 0
+    })
+
+    return list
+}
+
+// Decrypt the CCMP protected 802.11 frame found in the given packet, replacing
+// its raw payload with the decoded plaintext (starting from the LLC layer) and
+// clearing the Protected flag, so that the frame can be handled like any
+// other unprotected frame.
+func (d *Decrypter) Decrypt(pkt packet.Packet) error {
+    w, ok := layers.FindLayer(pkt, packet.WiFi).(*wifi.Packet)
+    if !ok {
+        return fmt.Errorf("No WiFi layer found")
+    }
+
+    if w.Flags & wifi.Protected == 0 || !w.Type.HasData() {
+        return fmt.Errorf("Frame is not a protected data frame")
+    }
+
+    body, ok := w.Payload().(*raw.Packet)
+    if !ok || len(body.Data) < ccmp_hdr_len {
+        return fmt.Errorf("Invalid protected frame body")
+    }
+
+    tk := d.key(w, body.Data[3] >> 6)
+    if tk == nil {
+        return fmt.Errorf("No key found for %s/%s", w.Addr1, w.Addr2)
+    }
+
+    plain, err := DecryptCCMP(tk, w, body.Data)
+    if err != nil {
+        return err
+    }
+
+    pl, err := layers.UnpackAll(plain, packet.LLC)
+    if pl == nil {
+        return err
+    }
+
+    w.Flags &^= wifi.Protected
+
+    return w.SetPayload(pl)
+}
+
+// Return the temporal key used to protect the given frame.
+func (d *Decrypter) key(w *wifi.Packet, key_id uint8) []byte {
+    if w.Addr1[0] & 0x01 != 0 {
+        /* group addressed frames are only sent by the AP */
+        return d.gtks[string(w.Addr2)][key_id & 0x03]
+    }
+
+    for _, id := range []string{
+        string(w.Addr1) + string(w.Addr2),
+        string(w.Addr2) + string(w.Addr1),
+    } {
+        if hs, ok := d.handshakes[id]; ok && hs.PTK != nil {
+            return hs.PTK[32:48]
+        }
+    }
+
+    return nil
+}
+
+// Return whether all the messages of the 4-way handshake were seen.
+func (h *Handshake) Complete() bool {
+    return h.Messages == 0x0f
+}
+
+func dup(data []byte) []byte {
+    out := make([]byte, len(data))
+    copy(out, data)
+    return out
+}
@@ -0,0 +1,234 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package wpa_test
+
+import "bytes"
+import "encoding/hex"
+import "testing"
+
+import "github.com/ghedo/go.pkt/capture/file"
+import "github.com/ghedo/go.pkt/layers"
+import "github.com/ghedo/go.pkt/packet"
+import "github.com/ghedo/go.pkt/packet/arp"
+import "github.com/ghedo/go.pkt/packet/icmpv4"
+import "github.com/ghedo/go.pkt/packet/wifi"
+import "github.com/ghedo/go.pkt/packet/wifi/wpa"
+
+func unhex(s string) []byte {
+    b, _ := hex.DecodeString(s)
+    return b
+}
+
+/* IEEE 802.11 annex J.4 */
+var test_pmk = []struct {
+    Passphrase string
+    SSID       string
+    PMK        string
+}{
+    { "password", "IEEE",
+      "f42c6fc52df0ebef9ebb4b90b38a5f902e83fe1b135a70e23aed762e9710a12e" },
+    { "ThisIsAPassword", "ThisIsASSID",
+      "0dc0d6eb90555ed6419756b9a15ec3e3209b63df707dd508d14581f8982721af" },
+}
+
+func TestPMK(t *testing.T) {
+    for _, v := range test_pmk {
+        pmk := wpa.PMK(v.Passphrase, v.SSID)
+
+        if !bytes.Equal(pmk, unhex(v.PMK)) {
+            t.Fatalf("PMK mismatch for %s: %x", v.SSID, pmk)
+        }
+    }
+}
+
+/* IEEE 802.11 annex J.3 */
+func TestPRF(t *testing.T) {
+    key := bytes.Repeat([]byte{ 0x0b }, 20)
+
+    out := wpa.PRF(key, "prefix", []byte("Hi There"), 64)
+
+    exp := unhex("bcd4c650b30b9684951829e0d75f9d54b862175ed9f00606e17d8da3" +
+                 "5402ffee75df78c3d31e0f889f012120c0862beb67753e7439ae242e" +
+                 "db8373698356cf5a")
+
+    if !bytes.Equal(out, exp) {
+        t.Fatalf("PRF mismatch: %x", out)
+    }
+}
+
+/* IEEE 802.11 annex M.6.4 */
+var test_ccmp_hdr = unhex("0848c32c0fd2e128a57c5030f1844408abaea5b8fcba8033")
+var test_ccmp_tk = unhex("c97c1f67ce371185514a8a19f2bdd52f")
+var test_ccmp_plain = unhex("f8ba1a55d02f85ae967bb62fb6cda8eb7e78a050")
+var test_ccmp_body = unhex("0ce70020769703b5f3d0a2fe9a3dbf2342a643e43246e80c" +
+                           "3c04d0197845ce0b16f97623")
+
+func TestCCMP(t *testing.T) {
+    var hdr wifi.Packet
+
+    var b packet.Buffer
+    b.Init(test_ccmp_hdr)
+
+    err := hdr.Unpack(&b)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    plain, err := wpa.DecryptCCMP(test_ccmp_tk, &hdr, test_ccmp_body)
+    if err != nil {
+        t.Fatalf("Error decrypting: %s", err)
+    }
+
+    if !bytes.Equal(plain, test_ccmp_plain) {
+        t.Fatalf("Plaintext mismatch: %x", plain)
+    }
+
+    body, err := wpa.EncryptCCMP(test_ccmp_tk, &hdr, 0, 0xb5039776e70c,
+                                 test_ccmp_plain)
+    if err != nil {
+        t.Fatalf("Error encrypting: %s", err)
+    }
+
+    if !bytes.Equal(body, test_ccmp_body) {
+        t.Fatalf("Ciphertext mismatch: %x", body)
+    }
+
+    body[len(body) - 1] ^= 0xff
+
+    _, err = wpa.DecryptCCMP(test_ccmp_tk, &hdr, body)
+    if err == nil {
+        t.Fatalf("Tampered frame decrypted")
+    }
+}
+
+func read_fixture(t *testing.T) []packet.Packet {
+    src, err := file.Open("pkt_test.pcap")
+    if err != nil {
+        t.Fatalf("Error opening: %s", err)
+    }
+    defer src.Close()
+
+    var pkts []packet.Packet
+
+    for {
+        buf, err := src.Capture()
+        if err != nil {
+            t.Fatalf("Error reading: %s", err)
+        }
+
+        if buf == nil {
+            break
+        }
+
+        pkt, err := layers.UnpackAll(buf, src.LinkType())
+        if err != nil {
+            t.Fatalf("Error unpacking: %s", err)
+        }
+
+        pkts = append(pkts, pkt)
+    }
+
+    if len(pkts) != 6 {
+        t.Fatalf("Packet count mismatch: %d", len(pkts))
+    }
+
+    return pkts
+}
+
+func TestDecrypter(t *testing.T) {
+    pkts := read_fixture(t)
+
+    d := wpa.New("go.pkt", "correct horse battery")
+
+    for i, pkt := range pkts[:4] {
+        hs, err := d.Add(pkt)
+        if err != nil {
+            t.Fatalf("Packet %d: %s", i, err)
+        }
+
+        if hs == nil {
+            t.Fatalf("Packet %d: no handshake", i)
+        }
+    }
+
+    hs := d.Handshakes()
+    if len(hs) != 1 || !hs[0].Complete() || hs[0].PTK == nil {
+        t.Fatalf("Handshake mismatch: %v", hs)
+    }
+
+    if hs[0].AA.String() != "00:11:22:33:44:55" ||
+       hs[0].SPA.String() != "66:77:88:99:aa:bb" {
+        t.Fatalf("Handshake address mismatch: %s %s", hs[0].AA, hs[0].SPA)
+    }
+
+    err := d.Decrypt(pkts[4])
+    if err != nil {
+        t.Fatalf("Error decrypting unicast frame: %s", err)
+    }
+
+    icmp, ok := layers.FindLayer(pkts[4], packet.ICMPv4).(*icmpv4.Packet)
+    if !ok || icmp.Id != 0x1234 {
+        t.Fatalf("Unicast payload mismatch: %s", pkts[4])
+    }
+
+    err = d.Decrypt(pkts[5])
+    if err != nil {
+        t.Fatalf("Error decrypting group frame: %s", err)
+    }
+
+    a, ok := layers.FindLayer(pkts[5], packet.ARP).(*arp.Packet)
+    if !ok || a.ProtoDstAddr.String() != "192.168.1.100" {
+        t.Fatalf("Group payload mismatch: %s", pkts[5])
+    }
+
+    w := layers.FindLayer(pkts[5], packet.WiFi).(*wifi.Packet)
+    if w.Flags & wifi.Protected != 0 {
+        t.Fatalf("Protected flag not cleared: %s", w.Flags)
+    }
+}
+
+func TestDecrypterWrongPassphrase(t *testing.T) {
+    pkts := read_fixture(t)
+
+    d := wpa.New("go.pkt", "wrong horse battery")
+
+    d.Add(pkts[0])
+
+    _, err := d.Add(pkts[1])
+    if err == nil {
+        t.Fatalf("MIC verified with wrong passphrase")
+    }
+
+    err = d.Decrypt(pkts[4])
+    if err == nil {
+        t.Fatalf("Frame decrypted with wrong passphrase")
+    }
+}
@@ -0,0 +1,151 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+// Provides encoding and decoding for Wake-on-LAN magic packets, sent either
+// directly over Ethernet (EtherType 0x0842) or as UDP payload.
+package wol
+
+import "bytes"
+import "fmt"
+import "net"
+
+import "github.com/ghedo/go.pkt/packet"
+
+type Packet struct {
+    Target   net.HardwareAddr `string:"target"`
+    Password []byte           `string:"skip"`
+}
+
+var sync_stream = []byte{ 0xff, 0xff, 0xff, 0xff, 0xff, 0xff }
+
+// Make a new magic packet for the given MAC address.
+func Make(target net.HardwareAddr) *Packet {
+    return &Packet{
+        Target: target,
+    }
+}
+
+func (p *Packet) GetType() packet.Type {
+    return packet.WoL
+}
+
+func (p *Packet) GetLength() uint16 {
+    return 6 + 16 * 6 + uint16(len(p.Password))
+}
+
+func (p *Packet) Equals(other packet.Packet) bool {
+    return packet.Compare(p, other)
+}
+
+func (p *Packet) Answers(other packet.Packet) bool {
+    return false
+}
+
+func (p *Packet) Pack(buf *packet.Buffer) error {
+    if len(p.Target) != 6 {
+        return fmt.Errorf("Invalid target address %s", p.Target)
+    }
+
+    if len(p.Password) != 0 && len(p.Password) != 4 &&
+       len(p.Password) != 6 {
+        return fmt.Errorf("Invalid SecureOn password length %d",
+                          len(p.Password))
+    }
+
+    buf.Write(sync_stream)
+
+    for i := 0; i < 16; i++ {
+        buf.Write(p.Target)
+    }
+
+    buf.Write(p.Password)
+
+    return nil
+}
+
+func (p *Packet) Unpack(buf *packet.Buffer) error {
+    if !IsMagic(buf.Bytes()) {
+        return fmt.Errorf("Invalid magic packet")
+    }
+
+    buf.Next(6)
+
+    p.Target = net.HardwareAddr(buf.Next(6))
+
+    for i := 1; i < 16; i++ {
+        if !bytes.Equal(buf.Next(6), p.Target) {
+            return fmt.Errorf("Invalid magic packet")
+        }
+    }
+
+    /* other trailing data (e.g. Ethernet padding) is ignored */
+    p.Password = nil
+
+    if buf.Len() == 4 || buf.Len() == 6 {
+        p.Password = buf.Next(buf.Len())
+    }
+
+    return nil
+}
+
+func (p *Packet) Payload() packet.Packet {
+    return nil
+}
+
+func (p *Packet) GuessPayloadType() packet.Type {
+    return packet.None
+}
+
+func (p *Packet) SetPayload(pl packet.Packet) error {
+    return nil
+}
+
+func (p *Packet) InitChecksum(csum uint32) {
+}
+
+func (p *Packet) String() string {
+    return packet.Stringify(p)
+}
+
+// Return whether the given data starts with a magic packet, that is the
+// synchronization stream followed by 16 repetitions of the target address.
+func IsMagic(data []byte) bool {
+    if len(data) < 102 || !bytes.Equal(data[:6], sync_stream) {
+        return false
+    }
+
+    for i := 12; i < 102; i += 6 {
+        if !bytes.Equal(data[i:i + 6], data[6:12]) {
+            return false
+        }
+    }
+
+    return true
+}
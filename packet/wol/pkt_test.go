@@ -0,0 +1,224 @@
+/*
+ * Network packet analysis framework.
+ *
+ * Copyright (c) 2014, Alessandro Ghedini
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are
+ * met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+ * IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+ * THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+ * PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+ * CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+ * EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+ * PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package wol_test
+
+import "bytes"
+import "io/ioutil"
+import "net"
+import "os"
+import "path/filepath"
+import "testing"
+
+import "github.com/ghedo/go.pkt/capture/file"
+import "github.com/ghedo/go.pkt/layers"
+import "github.com/ghedo/go.pkt/network"
+import "github.com/ghedo/go.pkt/packet"
+import "github.com/ghedo/go.pkt/packet/ipv4"
+import "github.com/ghedo/go.pkt/packet/raw"
+import "github.com/ghedo/go.pkt/packet/udp"
+import "github.com/ghedo/go.pkt/packet/wol"
+
+var test_target, _ = net.ParseMAC("00:11:22:33:44:55")
+
+var test_simple = append(append([]byte{
+    0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+}, bytes.Repeat(test_target, 16)...), 0x01, 0x02, 0x03, 0x04)
+
+func MakeTestSimple() *wol.Packet {
+    return &wol.Packet{
+        Target: test_target,
+        Password: []byte{ 0x01, 0x02, 0x03, 0x04 },
+    }
+}
+
+func TestPack(t *testing.T) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_simple)))
+
+    p := MakeTestSimple()
+
+    err := p.Pack(&b)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    if !bytes.Equal(test_simple, b.Buffer()) {
+        t.Fatalf("Raw packet mismatch: %x", b.Buffer())
+    }
+}
+
+func BenchmarkPack(bn *testing.B) {
+    var b packet.Buffer
+    b.Init(make([]byte, len(test_simple)))
+
+    p := MakeTestSimple()
+
+    for n := 0; n < bn.N; n++ {
+        p.Pack(&b)
+    }
+}
+
+func TestUnpack(t *testing.T) {
+    var p wol.Packet
+
+    cmp := MakeTestSimple()
+
+    var b packet.Buffer
+    b.Init(test_simple)
+
+    err := p.Unpack(&b)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if !p.Equals(cmp) {
+        t.Fatalf("Packet mismatch:\n%s\n%s", &p, cmp)
+    }
+}
+
+func BenchmarkUnpack(bn *testing.B) {
+    var p wol.Packet
+    var b packet.Buffer
+
+    for n := 0; n < bn.N; n++ {
+        b.Init(test_simple)
+        p.Unpack(&b)
+    }
+}
+
+func TestUDP(t *testing.T) {
+    ip4_pkt := ipv4.Make()
+    ip4_pkt.SrcAddr = net.ParseIP("192.168.1.10")
+    ip4_pkt.DstAddr = net.ParseIP("192.168.1.255")
+
+    udp_pkt := udp.Make()
+    udp_pkt.SrcPort = 40000
+    udp_pkt.DstPort = udp.WoLEcho
+
+    wol_pkt := wol.Make(test_target)
+
+    buf, err := layers.Pack(ip4_pkt, udp_pkt, wol_pkt)
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    p, err := layers.UnpackAll(buf, packet.IPv4)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    l := layers.FindLayer(p, packet.WoL)
+    if l == nil || !l.Equals(wol_pkt) {
+        t.Fatalf("Packet mismatch: %s", p)
+    }
+
+    /* echo requests that aren't magic packets */
+    buf, err = layers.Pack(ip4_pkt, udp_pkt,
+                           &raw.Packet{ Data: []byte("ping") })
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    p, err = layers.UnpackAll(buf, packet.IPv4)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if layers.FindLayer(p, packet.Raw) == nil {
+        t.Fatalf("Not raw: %s", p)
+    }
+
+    /* echo requests that only start with a synchronization stream */
+    data := bytes.Repeat([]byte{ 0xff }, 6)
+
+    for i := 0; i < 96; i++ {
+        data = append(data, uint8(i))
+    }
+
+    buf, err = layers.Pack(ip4_pkt, udp_pkt, &raw.Packet{ Data: data })
+    if err != nil {
+        t.Fatalf("Error packing: %s", err)
+    }
+
+    p, err = layers.UnpackAll(buf, packet.IPv4)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    if layers.FindLayer(p, packet.Raw) == nil {
+        t.Fatalf("Not raw: %s", p)
+    }
+}
+
+func TestWakeOnLAN(t *testing.T) {
+    dir, err := ioutil.TempDir("", "wol")
+    if err != nil {
+        t.Fatalf("Error creating directory: %s", err)
+    }
+    defer os.RemoveAll(dir)
+
+    dst, err := file.Open(filepath.Join(dir, "wol.pcap"))
+    if err != nil {
+        t.Fatalf("Error opening: %s", err)
+    }
+    defer dst.Close()
+
+    password := []byte{ 0x01, 0x02, 0x03, 0x04, 0x05, 0x06 }
+
+    src, _ := net.ParseMAC("00:11:22:33:44:55")
+
+    err = network.WakeOnLAN(dst, src, test_target, password)
+    if err != nil {
+        t.Fatalf("Error sending: %s", err)
+    }
+
+    buf, err := dst.Capture()
+    if err != nil {
+        t.Fatalf("Error capturing: %s", err)
+    }
+
+    if len(buf) != 122 || !bytes.Equal(buf[6:12], src) ||
+       buf[12] != 0x08 || buf[13] != 0x42 {
+        t.Fatalf("Raw packet mismatch: %x", buf)
+    }
+
+    p, err := layers.UnpackAll(buf, packet.Eth)
+    if err != nil {
+        t.Fatalf("Error unpacking: %s", err)
+    }
+
+    wol_pkt := p.Payload().(*wol.Packet)
+
+    if wol_pkt.Target.String() != test_target.String() ||
+       !bytes.Equal(wol_pkt.Password, password) {
+        t.Fatalf("Packet mismatch: %s", p)
+    }
+}